@@ -0,0 +1,207 @@
+// Package alerts delivers alerts about what monitors and auditors find in CT
+// logs, such as certificates for watched domains or evidence that a log has
+// misbehaved, to webhooks, email and chat.
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/certificate-transparency/go/merkle"
+	"github.com/google/certificate-transparency/go/monitor"
+	"github.com/google/certificate-transparency/go/scanner"
+
+	"github.com/google/certificate-transparency/go"
+)
+
+// Severity is how urgent an Alert is.
+type Severity int
+
+// Severities, from least to most urgent.
+const (
+	// Something of interest, such as a certificate for a watched domain.
+	Info Severity = iota
+	// Something which may need attention, such as a log being unreachable.
+	Warning
+	// Evidence that a log has misbehaved.
+	Critical
+)
+
+var severityNames = []string{"info", "warning", "critical"}
+
+func (s Severity) String() string {
+	if s >= 0 && int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// MarshalText implements encoding.TextMarshaler, so that Severities appear in
+// JSON by name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Severity) UnmarshalText(text []byte) error {
+	for i, n := range severityNames {
+		if n == string(text) {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// EntryRef identifies a log entry an Alert is about.
+type EntryRef struct {
+	Index int64 `json:"index"`
+	// The Merkle leaf hash of the entry, if known.
+	LeafHash []byte `json:"leaf_hash,omitempty"`
+}
+
+// Alert is something a monitor or auditor found which someone should hear
+// about.
+type Alert struct {
+	Severity Severity `json:"severity"`
+	// A one line summary.
+	Title   string `json:"title"`
+	Details string `json:"details,omitempty"`
+	// The URL of the log the alert is about, if any.
+	Log     string     `json:"log,omitempty"`
+	Entries []EntryRef `json:"entries,omitempty"`
+	// Evidence of the log's misbehaviour, for Critical alerts.
+	Evidence *monitor.Evidence `json:"evidence,omitempty"`
+	Time     time.Time         `json:"time"`
+	// The number of alerts before this one which weren't delivered
+	// because a sink's rate limit was exceeded.
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+func (a Alert) String() string {
+	if a.Log != "" {
+		return fmt.Sprintf("%s: %s: %s", a.Severity, a.Log, a.Title)
+	}
+	return fmt.Sprintf("%s: %s", a.Severity, a.Title)
+}
+
+// FromEvent returns the Alert for an Event from an STHFollower, or nil if the
+// event isn't worth alerting on.  Alerts for STHs which contradict the
+// log's earlier STH carry Evidence of it.
+func FromEvent(ev monitor.Event) *Alert {
+	if ev.Type == monitor.STHUpdated {
+		return nil
+	}
+	a := &Alert{Severity: Critical, Time: time.Now().UTC()}
+	if ev.Log != nil {
+		a.Log = ev.Log.URL
+	}
+	if ev.Err != nil {
+		a.Details = ev.Err.Error()
+	}
+	switch ev.Type {
+	case monitor.FetchFailed, monitor.StoreFailed:
+		a.Severity = Warning
+		a.Title = fmt.Sprintf("Failed following log: %s", ev.Type)
+		return a
+	case monitor.RootMismatch:
+		// Two STHs for the same tree size with different roots are
+		// evidence of a split view by themselves.
+		if ev.Log != nil && ev.STH != nil && ev.Previous != nil && ev.STH.TreeSize == ev.Previous.TreeSize {
+			alarm := monitor.Alarm{
+				Type:   monitor.RootsDiffer,
+				Log:    ev.Log,
+				First:  monitor.Observation{Source: "follower", STH: *ev.Previous},
+				Second: monitor.Observation{Source: "follower", STH: *ev.STH, Time: a.Time},
+			}
+			if e, err := alarm.Evidence(); err == nil {
+				a.Evidence = e
+			}
+		}
+	}
+	a.Title = fmt.Sprintf("Log misbehaved: %s", ev.Type)
+	return a
+}
+
+// FromWatchlistAlert returns the Alert for a match a Watchlist found in an
+// entry of the log at logURL.
+func FromWatchlistAlert(logURL string, w scanner.Alert) *Alert {
+	a := &Alert{
+		Severity: Info,
+		Title:    fmt.Sprintf("Certificate for %s", w.Name),
+		Details:  w.String(),
+		Log:      logURL,
+		Time:     time.Now().UTC(),
+	}
+	if w.Entry != nil {
+		ref := EntryRef{Index: w.Entry.Index}
+		if leaf, err := ct.SerializeMerkleTreeLeaf(w.Entry.Leaf); err == nil {
+			ref.LeafHash = merkle.NewSHA256TreeHasher().HashLeaf(leaf)
+		}
+		a.Entries = []EntryRef{ref}
+	}
+	return a
+}
+
+// FromAlarm returns the Alert for an Alarm from a SplitViewDetector.
+func FromAlarm(alarm monitor.Alarm) *Alert {
+	a := &Alert{
+		Severity: Critical,
+		Title:    fmt.Sprintf("Log presented a split view: %s", alarm.Type),
+		Details: fmt.Sprintf("STH for tree size %d from %s conflicts with STH for tree size %d from %s",
+			alarm.First.STH.TreeSize, alarm.First.Source, alarm.Second.STH.TreeSize, alarm.Second.Source),
+		Time: time.Now().UTC(),
+	}
+	if alarm.Err != nil {
+		a.Details += ": " + alarm.Err.Error()
+	}
+	if alarm.Log != nil {
+		a.Log = alarm.Log.URL
+	}
+	if e, err := alarm.Evidence(); err == nil {
+		a.Evidence = e
+	}
+	return a
+}
+
+// FromMMDViolation returns the Alert for an MMDViolation from an MMDAuditor.
+func FromMMDViolation(v monitor.MMDViolation) *Alert {
+	a := &Alert{
+		Severity: Critical,
+		Title:    "Log didn't incorporate an entry within its MMD",
+		Details: fmt.Sprintf("SCT issued at %s isn't included in the STH for tree size %d issued at %s",
+			msTime(v.SCT.Timestamp), v.STH.TreeSize, msTime(v.STH.Timestamp)),
+		Time: time.Now().UTC(),
+	}
+	if v.Err != nil {
+		a.Details += ": " + v.Err.Error()
+	}
+	if v.Log != nil {
+		a.Log = v.Log.URL
+	}
+	if leaf, err := ct.SerializeMerkleTreeLeaf(v.Leaf); err == nil {
+		ref := EntryRef{Index: -1, LeafHash: merkle.NewSHA256TreeHasher().HashLeaf(leaf)}
+		if v.Proof != nil {
+			ref.Index = v.Proof.LeafIndex
+		}
+		a.Entries = []EntryRef{ref}
+	}
+	if e, err := v.Evidence(); err == nil {
+		a.Evidence = e
+	}
+	return a
+}
+
+func msTime(ms uint64) string {
+	return time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+}
+
+// encode returns a's JSON encoding, or an empty object if it can't be encoded.
+func encode(a *Alert) []byte {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return []byte("{}")
+	}
+	return b
+}
@@ -0,0 +1,146 @@
+package alerts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/monitor"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/testlog"
+)
+
+// addCert adds a self-signed certificate to l.
+func addCert(t *testing.T, l *testlog.Log) {
+	der := testcert.Leaf(t, "test.example.com", testcert.NewKey(t), nil).Raw
+	if _, err := l.AddChain([]ct.ASN1Cert{der}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSeverityText(t *testing.T) {
+	for _, s := range []Severity{Info, Warning, Critical} {
+		b, err := json.Marshal(s)
+		if err != nil {
+			t.Fatalf("Marshal(%v)=_,%v", s, err)
+		}
+		var got Severity
+		if err := json.Unmarshal(b, &got); err != nil || got != s {
+			t.Errorf("Unmarshal(%s)=%v,%v, want %v", b, got, err, s)
+		}
+	}
+	var s Severity
+	if err := s.UnmarshalText([]byte("dire")); err == nil {
+		t.Error("UnmarshalText(dire)=nil, want error")
+	}
+}
+
+func TestFromEvent(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := testlog.New(testlog.Options{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork, err := testlog.New(testlog.Options{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addCert(t, l)
+	addCert(t, fork)
+	sth, err := l.STH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	forked, err := fork.STH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &client.LogInfo{URL: "https://log.example.com", PublicKey: &key.PublicKey}
+
+	tests := []struct {
+		ev           monitor.Event
+		wantNil      bool
+		wantSeverity Severity
+		wantEvidence bool
+	}{
+		{ev: monitor.Event{Type: monitor.STHUpdated, Log: info, STH: sth}, wantNil: true},
+		{ev: monitor.Event{Type: monitor.FetchFailed, Log: info, Err: errors.New("timeout")}, wantSeverity: Warning},
+		{ev: monitor.Event{Type: monitor.InvalidSignature, Log: info, STH: sth, Err: errors.New("bad signature")}, wantSeverity: Critical},
+		{ev: monitor.Event{Type: monitor.RootMismatch, Log: info, STH: forked, Previous: sth}, wantSeverity: Critical, wantEvidence: true},
+	}
+	for i, test := range tests {
+		a := FromEvent(test.ev)
+		if test.wantNil {
+			if a != nil {
+				t.Errorf("#%d: FromEvent(%s)=%v, want nil", i, test.ev.Type, a)
+			}
+			continue
+		}
+		if a == nil {
+			t.Errorf("#%d: FromEvent(%s)=nil", i, test.ev.Type)
+			continue
+		}
+		if a.Severity != test.wantSeverity || a.Log != info.URL {
+			t.Errorf("#%d: FromEvent(%s) has severity %v and log %q, want %v and %q", i, test.ev.Type, a.Severity, a.Log, test.wantSeverity, info.URL)
+		}
+		if got := a.Evidence != nil; got != test.wantEvidence {
+			t.Errorf("#%d: FromEvent(%s) has evidence %v, want %v", i, test.ev.Type, got, test.wantEvidence)
+			continue
+		}
+		if a.Evidence != nil {
+			if err := a.Evidence.Verify(&key.PublicKey); err != nil {
+				t.Errorf("#%d: FromEvent(%s).Evidence.Verify()=%v", i, test.ev.Type, err)
+			}
+		}
+	}
+}
+
+func TestFromAlarm(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := testlog.New(testlog.Options{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork, err := testlog.New(testlog.Options{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addCert(t, l)
+	addCert(t, fork)
+	sth, err := l.STH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	forked, err := fork.STH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alarm := monitor.Alarm{
+		Type:   monitor.RootsDiffer,
+		Log:    &client.LogInfo{URL: "https://log.example.com", PublicKey: &key.PublicKey},
+		First:  monitor.Observation{Source: "direct", STH: *sth},
+		Second: monitor.Observation{Source: "gossip", STH: *forked, Time: time.Now()},
+	}
+	a := FromAlarm(alarm)
+	if a.Severity != Critical || a.Log != alarm.Log.URL {
+		t.Errorf("FromAlarm() has severity %v and log %q, want %v and %q", a.Severity, a.Log, Critical, alarm.Log.URL)
+	}
+	if a.Evidence == nil {
+		t.Fatal("FromAlarm() has no evidence")
+	}
+	if err := a.Evidence.Verify(&key.PublicKey); err != nil {
+		t.Errorf("FromAlarm().Evidence.Verify()=%v", err)
+	}
+}
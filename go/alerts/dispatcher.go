@@ -0,0 +1,221 @@
+package alerts
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go/monitor"
+	"golang.org/x/net/context"
+)
+
+// Defaults for SinkOptions.
+const (
+	DefaultMaxAttempts = 5
+	DefaultRetryDelay  = time.Second
+)
+
+// SinkOptions holds optional configuration for how a Dispatcher sends Alerts
+// to a Sink.
+type SinkOptions struct {
+	// Alerts less severe than this aren't sent to the sink.
+	MinSeverity Severity
+	// Number of times each Alert is attempted before it is dropped.  Zero
+	// means DefaultMaxAttempts.
+	MaxAttempts int
+	// Delay before retrying a failed Alert, which doubles with each
+	// attempt.  Zero means DefaultRetryDelay.
+	RetryDelay time.Duration
+	// If positive, the number of Alerts per second the sink is sent, in
+	// bursts of up to Burst.  Alerts beyond that are dropped, and counted
+	// in the Suppressed field of the next Alert sent.  Critical Alerts are
+	// never dropped.
+	Rate  float64
+	Burst int
+}
+
+// limiter is a token bucket of Alerts, as scanner.Budget is of entries, but
+// which refuses Alerts rather than delaying them.
+type limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// allow takes an Alert from the bucket, if there is one.  A nil limiter
+// allows every Alert.
+func (l *limiter) allow(now time.Time) bool {
+	if l == nil {
+		return true
+	}
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+	}
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// dispatchedSink is a Sink a Dispatcher sends to, and its state.
+type dispatchedSink struct {
+	sink Sink
+	opts SinkOptions
+
+	// Held while an Alert is sent, so that Alerts arrive in order and the
+	// sink needn't be safe for concurrent use.
+	mu         sync.Mutex
+	limit      *limiter
+	suppressed int
+}
+
+// Dispatcher sends Alerts to a set of Sinks, retrying those which fail and
+// limiting the rate at which each sink is sent Alerts.  It is safe for
+// concurrent use.
+type Dispatcher struct {
+	mu    sync.Mutex
+	sinks []*dispatchedSink
+	// Replaced in tests.
+	now func() time.Time
+}
+
+// NewDispatcher returns a Dispatcher with no Sinks.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{now: time.Now}
+}
+
+// AddSink adds s to the Sinks d sends Alerts to.
+func (d *Dispatcher) AddSink(s Sink, opts SinkOptions) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultRetryDelay
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sinks = append(d.sinks, &dispatchedSink{sink: s, opts: opts, limit: newLimiter(opts.Rate, opts.Burst)})
+}
+
+// Send logs a, and sends it to each Sink it is severe enough for, in turn.
+// It returns the first error from a Sink which a couldn't be delivered to;
+// Alerts dropped by rate limiting aren't errors.
+func (d *Dispatcher) Send(ctx context.Context, a *Alert) error {
+	if a.Time.IsZero() {
+		a.Time = d.now().UTC()
+	}
+	log.Printf("Alert: %s", a)
+	d.mu.Lock()
+	sinks := d.sinks
+	d.mu.Unlock()
+	var firstErr error
+	for _, s := range sinks {
+		if err := s.send(ctx, a, d.now); err != nil {
+			log.Printf("Failed to send alert with %T: %v", s.sink, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (s *dispatchedSink) send(ctx context.Context, a *Alert, now func() time.Time) error {
+	if a.Severity < s.opts.MinSeverity {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.limit.allow(now()) && a.Severity < Critical {
+		s.suppressed++
+		return nil
+	}
+	// Each sink may have suppressed a different number of Alerts.
+	sa := *a
+	sa.Suppressed = s.suppressed
+	delay := s.opts.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err := s.sink.Send(ctx, &sa)
+		if err == nil {
+			s.suppressed = 0
+			return nil
+		}
+		if attempt >= s.opts.MaxAttempts {
+			return err
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// SendEvents sends the Alerts for events from an STHFollower, until events
+// is closed or ctx is done.
+func (d *Dispatcher) SendEvents(ctx context.Context, events <-chan monitor.Event) {
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if a := FromEvent(ev); a != nil {
+				d.Send(ctx, a)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// SendAlarms sends the Alerts for alarms from a SplitViewDetector, until
+// alarms is closed or ctx is done.
+func (d *Dispatcher) SendAlarms(ctx context.Context, alarms <-chan monitor.Alarm) {
+	for {
+		select {
+		case alarm, ok := <-alarms:
+			if !ok {
+				return
+			}
+			d.Send(ctx, FromAlarm(alarm))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// SendMMDViolations sends the Alerts for violations from an MMDAuditor,
+// until violations is closed or ctx is done.
+func (d *Dispatcher) SendMMDViolations(ctx context.Context, violations <-chan monitor.MMDViolation) {
+	for {
+		select {
+		case v, ok := <-violations:
+			if !ok {
+				return
+			}
+			d.Send(ctx, FromMMDViolation(v))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package alerts
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// fakeSink records the Alerts it is sent, failing the first fails times.
+type fakeSink struct {
+	fails int
+	sent  []Alert
+	calls int
+}
+
+func (s *fakeSink) Send(ctx context.Context, a *Alert) error {
+	s.calls++
+	if s.calls <= s.fails {
+		return errors.New("unavailable")
+	}
+	s.sent = append(s.sent, *a)
+	return nil
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	ctx := context.Background()
+	d := NewDispatcher()
+	flaky := &fakeSink{fails: 2}
+	broken := &fakeSink{fails: 100}
+	d.AddSink(flaky, SinkOptions{MaxAttempts: 3, RetryDelay: time.Millisecond})
+	d.AddSink(broken, SinkOptions{MaxAttempts: 2, RetryDelay: time.Millisecond})
+	if err := d.Send(ctx, &Alert{Title: "test"}); err == nil {
+		t.Error("Send()=nil, want error from broken sink")
+	}
+	if len(flaky.sent) != 1 || flaky.calls != 3 {
+		t.Errorf("flaky sink sent %d alerts in %d calls, want 1 in 3", len(flaky.sent), flaky.calls)
+	}
+	if broken.calls != 2 {
+		t.Errorf("broken sink called %d times, want 2", broken.calls)
+	}
+	if flaky.sent[0].Time.IsZero() {
+		t.Error("alert sent without a time")
+	}
+}
+
+func TestDispatcherFilters(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := NewDispatcher()
+	d.now = func() time.Time { return now }
+	all := &fakeSink{}
+	critical := &fakeSink{}
+	limited := &fakeSink{}
+	d.AddSink(all, SinkOptions{})
+	d.AddSink(critical, SinkOptions{MinSeverity: Critical})
+	d.AddSink(limited, SinkOptions{Rate: 1, Burst: 2})
+
+	tests := []struct {
+		severity Severity
+		advance  time.Duration
+		// Whether limited is sent the alert, and how many alerts it's
+		// told were suppressed.
+		wantLimited    bool
+		wantSuppressed int
+	}{
+		{severity: Info, wantLimited: true},
+		{severity: Warning, wantLimited: true},
+		{severity: Info},
+		{severity: Info},
+		// Critical alerts get through regardless.
+		{severity: Critical, wantLimited: true, wantSuppressed: 2},
+		{severity: Info},
+		{severity: Info, advance: time.Second, wantLimited: true, wantSuppressed: 1},
+	}
+	for i, test := range tests {
+		now = now.Add(test.advance)
+		n := len(limited.sent)
+		if err := d.Send(ctx, &Alert{Severity: test.severity, Title: "test"}); err != nil {
+			t.Errorf("#%d: Send()=%v", i, err)
+		}
+		got := len(limited.sent) > n
+		if got != test.wantLimited {
+			t.Errorf("#%d: limited sink sent alert %v, want %v", i, got, test.wantLimited)
+			continue
+		}
+		if got && limited.sent[n].Suppressed != test.wantSuppressed {
+			t.Errorf("#%d: limited sink told %d alerts were suppressed, want %d", i, limited.sent[n].Suppressed, test.wantSuppressed)
+		}
+	}
+	if len(all.sent) != len(tests) {
+		t.Errorf("unfiltered sink sent %d alerts, want %d", len(all.sent), len(tests))
+	}
+	if len(critical.sent) != 1 {
+		t.Errorf("critical sink sent %d alerts, want 1", len(critical.sent))
+	}
+	for _, a := range all.sent {
+		if a.Suppressed != 0 {
+			t.Errorf("unfiltered sink told %d alerts were suppressed", a.Suppressed)
+		}
+	}
+}
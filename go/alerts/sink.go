@@ -0,0 +1,171 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Sink delivers Alerts somewhere.  Sinks needn't retry or rate limit; a
+// Dispatcher does that for them.
+type Sink interface {
+	Send(ctx context.Context, a *Alert) error
+}
+
+// postJSON POSTs v, as JSON, to url, and fails unless the response status is
+// 2xx.
+func postJSON(ctx context.Context, hc *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := ctxhttp.Do(ctx, hc, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got HTTP Status %s", resp.Status)
+	}
+	return nil
+}
+
+// WebhookSink is a Sink which POSTs each Alert, as JSON, to a URL.
+type WebhookSink struct {
+	URL string
+	// The HTTP client to make requests with.  If nil, http.DefaultClient is
+	// used.
+	HTTPClient *http.Client
+}
+
+// Send implements Sink.
+func (s *WebhookSink) Send(ctx context.Context, a *Alert) error {
+	return postJSON(ctx, s.HTTPClient, s.URL, a)
+}
+
+// SlackMessage is the JSON body of the requests a SlackSink POSTs, in the
+// format of Slack's incoming webhooks, which Mattermost and others accept
+// too.
+type SlackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []SlackAttachment `json:"attachments,omitempty"`
+}
+
+// SlackAttachment is an attachment to a SlackMessage.
+type SlackAttachment struct {
+	Color  string       `json:"color,omitempty"`
+	Text   string       `json:"text,omitempty"`
+	Fields []SlackField `json:"fields,omitempty"`
+}
+
+// SlackField is a field of a SlackAttachment.
+type SlackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+var slackColors = map[Severity]string{Info: "good", Warning: "warning", Critical: "danger"}
+
+// SlackSink is a Sink which POSTs each Alert as a SlackMessage to an incoming
+// webhook URL.
+type SlackSink struct {
+	URL string
+	// The HTTP client to make requests with.  If nil, http.DefaultClient is
+	// used.
+	HTTPClient *http.Client
+}
+
+// Send implements Sink.
+func (s *SlackSink) Send(ctx context.Context, a *Alert) error {
+	return postJSON(ctx, s.HTTPClient, s.URL, slackMessage(a))
+}
+
+func slackMessage(a *Alert) SlackMessage {
+	att := SlackAttachment{
+		Color: slackColors[a.Severity],
+		Text:  a.Details,
+		Fields: []SlackField{
+			{Title: "Severity", Value: a.Severity.String(), Short: true},
+		},
+	}
+	if a.Log != "" {
+		att.Fields = append(att.Fields, SlackField{Title: "Log", Value: a.Log, Short: true})
+	}
+	if len(a.Entries) > 0 {
+		var idx []string
+		for _, e := range a.Entries {
+			idx = append(idx, fmt.Sprint(e.Index))
+		}
+		att.Fields = append(att.Fields, SlackField{Title: "Entries", Value: strings.Join(idx, ", "), Short: true})
+	}
+	if a.Evidence != nil {
+		att.Fields = append(att.Fields, SlackField{Title: "Evidence", Value: string(a.Evidence.Violation), Short: true})
+	}
+	if a.Suppressed > 0 {
+		att.Fields = append(att.Fields, SlackField{Title: "Suppressed", Value: fmt.Sprintf("%d earlier alerts", a.Suppressed), Short: true})
+	}
+	return SlackMessage{Text: a.String(), Attachments: []SlackAttachment{att}}
+}
+
+// SMTPSink is a Sink which emails each Alert, with its JSON encoding, which
+// includes any Evidence, after its details.
+type SMTPSink struct {
+	// The SMTP server to send mail through, as host:port.
+	Addr string
+	// If set, used to authenticate to the server.
+	Auth smtp.Auth
+	From string
+	To   []string
+
+	// For tests; smtp.SendMail if nil.
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// Send implements Sink.  The message can't be cancelled once sending starts.
+func (s *SMTPSink) Send(ctx context.Context, a *Alert) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	send := s.sendMail
+	if send == nil {
+		send = smtp.SendMail
+	}
+	return send(s.Addr, s.Auth, s.From, s.To, s.message(a))
+}
+
+func (s *SMTPSink) message(a *Alert) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&b, "Subject: [CT %s] %s\r\n", a.Severity, oneLine(a.Title))
+	fmt.Fprintf(&b, "Date: %s\r\n", a.Time.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	if a.Log != "" {
+		fmt.Fprintf(&b, "Log: %s\r\n", a.Log)
+	}
+	if a.Details != "" {
+		fmt.Fprintf(&b, "%s\r\n", a.Details)
+	}
+	if a.Suppressed > 0 {
+		fmt.Fprintf(&b, "%d earlier alerts were suppressed.\r\n", a.Suppressed)
+	}
+	fmt.Fprintf(&b, "\r\n%s\r\n", encode(a))
+	return b.Bytes()
+}
+
+// oneLine replaces line breaks in s, so that it can go in a header.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
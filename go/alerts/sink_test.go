@@ -0,0 +1,116 @@
+package alerts
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var testAlert = &Alert{
+	Severity: Warning,
+	Title:    "Failed following log",
+	Details:  "timeout",
+	Log:      "https://log.example.com",
+	Entries:  []EntryRef{{Index: 7}},
+	Time:     time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+// recordPosts returns a server which records the bodies POSTed to it.
+func recordPosts(t *testing.T, bodies chan<- []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("got Content-Type %q, want application/json", ct)
+		}
+		bodies <- b
+	}))
+}
+
+func TestWebhookSink(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	hs := recordPosts(t, bodies)
+	defer hs.Close()
+	s := &WebhookSink{URL: hs.URL}
+	if err := s.Send(context.Background(), testAlert); err != nil {
+		t.Fatalf("Send()=%v", err)
+	}
+	var got Alert
+	if err := json.Unmarshal(<-bodies, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != testAlert.Title || got.Severity != testAlert.Severity || len(got.Entries) != 1 || got.Entries[0].Index != 7 {
+		t.Errorf("webhook got %+v, want %+v", got, testAlert)
+	}
+}
+
+func TestSlackSink(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	hs := recordPosts(t, bodies)
+	defer hs.Close()
+	s := &SlackSink{URL: hs.URL}
+	if err := s.Send(context.Background(), testAlert); err != nil {
+		t.Fatalf("Send()=%v", err)
+	}
+	var got SlackMessage
+	if err := json.Unmarshal(<-bodies, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != testAlert.String() {
+		t.Errorf("got text %q, want %q", got.Text, testAlert.String())
+	}
+	if len(got.Attachments) != 1 || got.Attachments[0].Color != "warning" || got.Attachments[0].Text != testAlert.Details {
+		t.Errorf("got attachments %+v, want one with color warning and text %q", got.Attachments, testAlert.Details)
+	}
+}
+
+func TestSinkHTTPError(t *testing.T) {
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusInternalServerError)
+	}))
+	defer hs.Close()
+	for _, s := range []Sink{&WebhookSink{URL: hs.URL}, &SlackSink{URL: hs.URL}} {
+		if err := s.Send(context.Background(), testAlert); err == nil {
+			t.Errorf("%T.Send()=nil, want error", s)
+		}
+	}
+}
+
+func TestSMTPSink(t *testing.T) {
+	var gotTo []string
+	var gotMsg string
+	s := &SMTPSink{
+		Addr: "localhost:25",
+		From: "ct@example.com",
+		To:   []string{"a@example.com", "b@example.com"},
+		sendMail: func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			gotTo, gotMsg = to, string(msg)
+			return nil
+		},
+	}
+	if err := s.Send(context.Background(), testAlert); err != nil {
+		t.Fatalf("Send()=%v", err)
+	}
+	if len(gotTo) != 2 {
+		t.Errorf("sent to %v, want %v", gotTo, s.To)
+	}
+	for _, want := range []string{
+		"Subject: [CT warning] Failed following log\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Log: https://log.example.com\r\n",
+		`"title":"Failed following log"`,
+	} {
+		if !strings.Contains(gotMsg, want) {
+			t.Errorf("message %q doesn't contain %q", gotMsg, want)
+		}
+	}
+}
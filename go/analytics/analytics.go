@@ -0,0 +1,416 @@
+// Package analytics aggregates statistics about the certificates a scan finds:
+// issuance per CA per day, key types and sizes, signature algorithms and the
+// distribution of validity periods.  An Aggregator is a scanner.RecordSink, so
+// it can be fed a scan's matches directly, or the JSON lines a scan wrote out
+// earlier, and it can export its statistics as JSON and CSV periodically.
+package analytics
+
+import (
+	"bufio"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/scanner"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// DefaultValidityBuckets are the upper bounds, in days, of the validity period
+// buckets an Aggregator counts certificates in if its options don't give any:
+// 90 days, six months, and the limits the Baseline Requirements have set over
+// the years.
+var DefaultValidityBuckets = []int{90, 180, 398, 825, 1185}
+
+// DateFormat is the format of the days issuance is counted by.
+const DateFormat = "2006-01-02"
+
+// Options holds optional configuration for an Aggregator.
+type Options struct {
+	// The upper bounds, in days and in increasing order, of the buckets
+	// certificates' validity periods are counted in.  Validity periods
+	// longer than the last bound are counted in a final, unbounded
+	// bucket.  If nil, DefaultValidityBuckets are used.
+	ValidityBuckets []int
+	// Files to export the statistics to as JSON and CSV, if set, every
+	// ExportInterval and when the Aggregator is closed.  Each export
+	// replaces the last atomically.
+	JSONFile string
+	CSVFile  string
+	// How often to export the statistics; if zero, they are only exported
+	// when the Aggregator is closed.
+	ExportInterval time.Duration
+}
+
+// Counts are the numbers of certificates and precertificates counted towards
+// a statistic.  A certificate and its precertificate are usually both logged,
+// so are counted separately rather than together.
+type Counts struct {
+	Certificates    int64 `json:"certificates"`
+	Precertificates int64 `json:"precertificates"`
+}
+
+func (c *Counts) add(precert bool) {
+	if precert {
+		c.Precertificates++
+	} else {
+		c.Certificates++
+	}
+}
+
+// DailyIssuance counts the certificates an issuer issued on a day.
+type DailyIssuance struct {
+	// The day, in DateFormat, of the certificates' NotBefore, in UTC.
+	Day string `json:"day"`
+	// The Common Name of the certificates' issuer, or its first
+	// Organization if it has no Common Name.
+	Issuer string `json:"issuer"`
+	Counts
+}
+
+// ValidityBucket counts the certificates whose validity period is at most
+// MaxDays long, and longer than the previous bucket's MaxDays.
+type ValidityBucket struct {
+	// Zero for the last, unbounded bucket.
+	MaxDays int `json:"max_days,omitempty"`
+	Counts
+}
+
+// Label returns a short description of the bucket, e.g. "<=90d".
+func (b ValidityBucket) Label() string {
+	if b.MaxDays == 0 {
+		return "longer"
+	}
+	return fmt.Sprintf("<=%dd", b.MaxDays)
+}
+
+// Summary is a snapshot of the statistics an Aggregator has gathered.
+type Summary struct {
+	Total Counts `json:"total"`
+	// Sorted by day, then issuer.
+	Issuance []DailyIssuance `json:"issuance"`
+	// Certificates by subject key type and size, e.g. "RSA-2048" or
+	// "ECDSA-P-256".
+	Keys map[string]Counts `json:"keys"`
+	// Certificates by signature algorithm, e.g. "SHA256-RSA".
+	SignatureAlgorithms map[string]Counts `json:"signature_algorithms"`
+	ValidityPeriods     []ValidityBucket  `json:"validity_periods"`
+}
+
+// WriteJSON writes |s| to |w| as indented JSON.
+func (s *Summary) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// csvHeader is the header row of Summary.WriteCSV's output.
+var csvHeader = []string{"statistic", "day", "key", "certificates", "precertificates"}
+
+// WriteCSV writes |s| to |w| as CSV, one row per count, under the header
+// statistic,day,key,certificates,precertificates.  The statistic is
+// "issuance", with the day and issuer, or "key", "signature_algorithm" or
+// "validity_period", without a day.
+func (s *Summary) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	row := func(statistic, day, key string, c Counts) {
+		cw.Write([]string{statistic, day, key, strconv.FormatInt(c.Certificates, 10), strconv.FormatInt(c.Precertificates, 10)})
+	}
+	for _, d := range s.Issuance {
+		row("issuance", d.Day, d.Issuer, d.Counts)
+	}
+	for _, k := range sortedKeys(s.Keys) {
+		row("key", "", k, s.Keys[k])
+	}
+	for _, k := range sortedKeys(s.SignatureAlgorithms) {
+		row("signature_algorithm", "", k, s.SignatureAlgorithms[k])
+	}
+	for _, b := range s.ValidityPeriods {
+		row("validity_period", "", b.Label(), b.Counts)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func sortedKeys(m map[string]Counts) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type issuanceKey struct {
+	day, issuer string
+}
+
+// Aggregator gathers statistics about the certificates written to it.  It is
+// a scanner.RecordSink, and is safe for concurrent use.
+type Aggregator struct {
+	opts Options
+
+	mu       sync.Mutex
+	total    Counts
+	issuance map[issuanceKey]*Counts
+	keys     map[string]*Counts
+	sigAlgs  map[string]*Counts
+	validity []Counts
+
+	done     chan struct{}
+	exported chan struct{}
+}
+
+// NewAggregator returns an Aggregator configured by |opts|.  If it exports its
+// statistics periodically, it does so until it is closed.
+func NewAggregator(opts Options) *Aggregator {
+	if opts.ValidityBuckets == nil {
+		opts.ValidityBuckets = DefaultValidityBuckets
+	}
+	a := &Aggregator{
+		opts:     opts,
+		issuance: make(map[issuanceKey]*Counts),
+		keys:     make(map[string]*Counts),
+		sigAlgs:  make(map[string]*Counts),
+		validity: make([]Counts, len(opts.ValidityBuckets)+1),
+		done:     make(chan struct{}),
+		exported: make(chan struct{}),
+	}
+	if opts.ExportInterval > 0 && (opts.JSONFile != "" || opts.CSVFile != "") {
+		go a.exportPeriodically()
+	} else {
+		close(a.exported)
+	}
+	return a
+}
+
+// Add counts the certificate or precertificate |c|.
+func (a *Aggregator) Add(c *x509.Certificate, precert bool) {
+	issuer := c.Issuer.CommonName
+	if issuer == "" && len(c.Issuer.Organization) > 0 {
+		issuer = c.Issuer.Organization[0]
+	}
+	day := c.NotBefore.UTC().Format(DateFormat)
+	bucket := sort.SearchInts(a.opts.ValidityBuckets, validityDays(c))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.total.add(precert)
+	key := issuanceKey{day, issuer}
+	if a.issuance[key] == nil {
+		a.issuance[key] = &Counts{}
+	}
+	a.issuance[key].add(precert)
+	addTo(a.keys, keyName(c), precert)
+	addTo(a.sigAlgs, signatureAlgorithmName(c.SignatureAlgorithm), precert)
+	a.validity[bucket].add(precert)
+}
+
+func addTo(m map[string]*Counts, k string, precert bool) {
+	if m[k] == nil {
+		m[k] = &Counts{}
+	}
+	m[k].add(precert)
+}
+
+// validityDays returns the length of |c|'s validity period in whole days,
+// rounded up.  NotAfter is inclusive, as in the Baseline Requirements, so a
+// certificate valid from 00:00:00 to 23:59:59 89 days later is valid for 90
+// days.
+func validityDays(c *x509.Certificate) int {
+	d := c.NotAfter.Sub(c.NotBefore) + time.Second
+	days := int(d / (24 * time.Hour))
+	if d%(24*time.Hour) != 0 {
+		days++
+	}
+	return days
+}
+
+// keyName returns the type and size of |c|'s subject public key.
+func keyName(c *x509.Certificate) string {
+	switch k := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", k.N.BitLen())
+	case *dsa.PublicKey:
+		return fmt.Sprintf("DSA-%d", k.P.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + k.Curve.Params().Name
+	}
+	return "unknown"
+}
+
+var signatureAlgorithmNames = map[x509.SignatureAlgorithm]string{
+	x509.MD2WithRSA:      "MD2-RSA",
+	x509.MD5WithRSA:      "MD5-RSA",
+	x509.SHA1WithRSA:     "SHA1-RSA",
+	x509.SHA256WithRSA:   "SHA256-RSA",
+	x509.SHA384WithRSA:   "SHA384-RSA",
+	x509.SHA512WithRSA:   "SHA512-RSA",
+	x509.DSAWithSHA1:     "DSA-SHA1",
+	x509.DSAWithSHA256:   "DSA-SHA256",
+	x509.ECDSAWithSHA1:   "ECDSA-SHA1",
+	x509.ECDSAWithSHA256: "ECDSA-SHA256",
+	x509.ECDSAWithSHA384: "ECDSA-SHA384",
+	x509.ECDSAWithSHA512: "ECDSA-SHA512",
+}
+
+func signatureAlgorithmName(alg x509.SignatureAlgorithm) string {
+	if name, ok := signatureAlgorithmNames[alg]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Write implements scanner.Sink.
+func (a *Aggregator) Write(entry *ct.LogEntry) error {
+	c := entry.Certificate()
+	if c == nil {
+		return fmt.Errorf("entry %d has no certificate", entry.Index)
+	}
+	a.Add(c, entry.IsPrecert())
+	return nil
+}
+
+// WriteRecord implements scanner.RecordSink, parsing the Record's DER.
+func (a *Aggregator) WriteRecord(r scanner.Record) error {
+	c, err := x509.ParseCertificate(r.DER)
+	if x509.IsFatal(err) {
+		return fmt.Errorf("entry %d: %v", r.Index, err)
+	}
+	a.Add(c, r.EntryType == "precert")
+	return nil
+}
+
+// ReadJSONLines adds the Records in |r|, the output of a
+// scanner.JSONLinesSink, to the statistics.  It stops at the first Record it
+// can't read or parse.
+func (a *Aggregator) ReadJSONLines(r io.Reader) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var rec scanner.Record
+		if err := dec.Decode(&rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := a.WriteRecord(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// Summary returns a snapshot of the statistics.
+func (a *Aggregator) Summary() *Summary {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := &Summary{
+		Total:               a.total,
+		Issuance:            make([]DailyIssuance, 0, len(a.issuance)),
+		Keys:                make(map[string]Counts),
+		SignatureAlgorithms: make(map[string]Counts),
+	}
+	for k, c := range a.issuance {
+		s.Issuance = append(s.Issuance, DailyIssuance{Day: k.day, Issuer: k.issuer, Counts: *c})
+	}
+	sort.Slice(s.Issuance, func(i, j int) bool {
+		if s.Issuance[i].Day != s.Issuance[j].Day {
+			return s.Issuance[i].Day < s.Issuance[j].Day
+		}
+		return s.Issuance[i].Issuer < s.Issuance[j].Issuer
+	})
+	for k, c := range a.keys {
+		s.Keys[k] = *c
+	}
+	for k, c := range a.sigAlgs {
+		s.SignatureAlgorithms[k] = *c
+	}
+	for i, c := range a.validity {
+		b := ValidityBucket{Counts: c}
+		if i < len(a.opts.ValidityBuckets) {
+			b.MaxDays = a.opts.ValidityBuckets[i]
+		}
+		s.ValidityPeriods = append(s.ValidityPeriods, b)
+	}
+	return s
+}
+
+// Export writes the statistics to the JSONFile and CSVFile in the options,
+// if they are set.
+func (a *Aggregator) Export() error {
+	s := a.Summary()
+	if a.opts.JSONFile != "" {
+		if err := writeFile(a.opts.JSONFile, s.WriteJSON); err != nil {
+			return err
+		}
+	}
+	if a.opts.CSVFile != "" {
+		if err := writeFile(a.opts.CSVFile, s.WriteCSV); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile replaces the file at |path| with what |write| writes, atomically.
+func writeFile(path string, write func(io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (a *Aggregator) exportPeriodically() {
+	defer close(a.exported)
+	ticker := time.NewTicker(a.opts.ExportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			if err := a.Export(); err != nil {
+				log.Printf("Failed to export statistics: %s", err)
+			}
+		}
+	}
+}
+
+// Close implements scanner.Sink.  It stops any periodic exports, and exports
+// the final statistics.
+func (a *Aggregator) Close() error {
+	select {
+	case <-a.done:
+		return errors.New("analytics: Aggregator already closed")
+	default:
+	}
+	close(a.done)
+	<-a.exported
+	return a.Export()
+}
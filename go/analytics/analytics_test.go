@@ -0,0 +1,184 @@
+package analytics
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/scanner"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+var day = time.Date(2016, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+func testCert(issuer string, notBefore time.Time, days int) *x509.Certificate {
+	return &x509.Certificate{
+		Issuer:             pkix.Name{CommonName: issuer},
+		NotBefore:          notBefore,
+		NotAfter:           notBefore.Add(time.Duration(days)*24*time.Hour - time.Second),
+		PublicKey:          &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), 2047), E: 65537},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+	}
+}
+
+func TestAggregatorSummary(t *testing.T) {
+	a := NewAggregator(Options{ValidityBuckets: []int{90, 398}})
+	a.Add(testCert("CA 1", day, 90), false)
+	a.Add(testCert("CA 1", day.Add(time.Hour), 91), true)
+	a.Add(testCert("CA 2", day, 398), false)
+	c := testCert("", day.Add(-time.Hour), 1000)
+	c.Issuer.Organization = []string{"Org CA"}
+	c.PublicKey = &ecdsa.PublicKey{Curve: elliptic.P256()}
+	c.SignatureAlgorithm = x509.ECDSAWithSHA256
+	a.Add(c, true)
+
+	s := a.Summary()
+	want := &Summary{
+		Total: Counts{2, 2},
+		Issuance: []DailyIssuance{
+			{Day: "2016-02-29", Issuer: "Org CA", Counts: Counts{0, 1}},
+			{Day: "2016-03-01", Issuer: "CA 1", Counts: Counts{1, 1}},
+			{Day: "2016-03-01", Issuer: "CA 2", Counts: Counts{1, 0}},
+		},
+		Keys:                map[string]Counts{"RSA-2048": {2, 1}, "ECDSA-P-256": {0, 1}},
+		SignatureAlgorithms: map[string]Counts{"SHA256-RSA": {2, 1}, "ECDSA-SHA256": {0, 1}},
+		ValidityPeriods: []ValidityBucket{
+			{MaxDays: 90, Counts: Counts{1, 0}},
+			{MaxDays: 398, Counts: Counts{1, 1}},
+			{Counts: Counts{0, 1}},
+		},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("Summary()=%+v, want %+v", s, want)
+	}
+
+	var buf bytes.Buffer
+	if err := s.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := `statistic,day,key,certificates,precertificates
+issuance,2016-02-29,Org CA,0,1
+issuance,2016-03-01,CA 1,1,1
+issuance,2016-03-01,CA 2,1,0
+key,,ECDSA-P-256,0,1
+key,,RSA-2048,2,1
+signature_algorithm,,ECDSA-SHA256,0,1
+signature_algorithm,,SHA256-RSA,2,1
+validity_period,,<=90d,1,0
+validity_period,,<=398d,1,1
+validity_period,,longer,0,1
+`
+	if buf.String() != wantCSV {
+		t.Errorf("WriteCSV() wrote\n%s\nwant\n%s", buf.String(), wantCSV)
+	}
+
+	buf.Reset()
+	if err := s.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got Summary
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("WriteJSON() wrote invalid JSON: %v", err)
+	}
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("WriteJSON() round trip gave %+v, want %+v", got, want)
+	}
+}
+
+func TestAggregatorRecords(t *testing.T) {
+	tmpl := testcert.Template("Test CA", false)
+	tmpl.NotBefore, tmpl.NotAfter = day, day.Add(30*24*time.Hour)
+	tmpl.SignatureAlgorithm = x509.ECDSAWithSHA256
+	der := testcert.Issue(t, tmpl, testcert.NewKey(t), nil).Raw
+	var buf bytes.Buffer
+	sink := scanner.NewJSONLinesSink(&buf)
+	sink.WriteRecord(scanner.Record{Index: 1, EntryType: "x509", DER: der})
+	sink.WriteRecord(scanner.Record{Index: 2, EntryType: "precert", DER: der})
+
+	a := NewAggregator(Options{})
+	if err := a.ReadJSONLines(&buf); err != nil {
+		t.Fatalf("ReadJSONLines()=%v", err)
+	}
+	if err := a.Write(&ct.LogEntry{Index: 3, X509Cert: testCert("Test CA", day, 30)}); err != nil {
+		t.Fatalf("Write()=%v", err)
+	}
+	s := a.Summary()
+	want := []DailyIssuance{{Day: "2016-03-01", Issuer: "Test CA", Counts: Counts{2, 1}}}
+	if !reflect.DeepEqual(s.Issuance, want) {
+		t.Errorf("Issuance=%+v, want %+v", s.Issuance, want)
+	}
+	if got := s.SignatureAlgorithms["ECDSA-SHA256"]; got != (Counts{1, 1}) {
+		t.Errorf("SignatureAlgorithms[ECDSA-SHA256]=%+v, want {1 1}", got)
+	}
+	if got := s.Keys["ECDSA-P-256"]; got != (Counts{1, 1}) {
+		t.Errorf("Keys[ECDSA-P-256]=%+v, want {1 1}", got)
+	}
+	if got := s.ValidityPeriods[0]; got.MaxDays != 90 || got.Counts != (Counts{2, 1}) {
+		t.Errorf("ValidityPeriods[0]=%+v, want three certificates of at most 90 days", got)
+	}
+
+	if err := a.WriteRecord(scanner.Record{Index: 4, DER: []byte{1, 2, 3}}); err == nil {
+		t.Error("WriteRecord(invalid DER) succeeded")
+	}
+	if err := a.Write(&ct.LogEntry{Index: 5}); err == nil {
+		t.Error("Write(entry without a certificate) succeeded")
+	}
+}
+
+func TestAggregatorExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "analytics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jsonFile, csvFile := filepath.Join(dir, "stats.json"), filepath.Join(dir, "stats.csv")
+	a := NewAggregator(Options{JSONFile: jsonFile, CSVFile: csvFile, ExportInterval: 10 * time.Millisecond})
+	a.Add(testCert("CA 1", day, 90), false)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(csvFile); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("statistics weren't exported periodically")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	a.Add(testCert("CA 2", day, 90), false)
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close()=%v", err)
+	}
+	data, err := ioutil.ReadFile(csvFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "issuance,2016-03-01,CA 2,1,0") {
+		t.Errorf("final CSV export is missing the last certificate:\n%s", data)
+	}
+	data, err = ioutil.ReadFile(jsonFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s Summary
+	if err := json.Unmarshal(data, &s); err != nil || s.Total.Certificates != 2 {
+		t.Errorf("final JSON export gave %+v,%v, want two certificates", s.Total, err)
+	}
+	if err := a.Close(); err == nil {
+		t.Error("second Close() succeeded")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/google/certificate-transparency/go/analytics"
+)
+
+var outputJSON = flag.String("output_json", "", "File to write the statistics to as JSON")
+var outputCSV = flag.String("output_csv", "", "File to write the statistics to as CSV")
+
+// Aggregates issuance statistics from the JSON lines files the scanner's
+// -output_jsonl flag writes, given as arguments.
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("Usage: analytics [-output_json file] [-output_csv file] matches.jsonl...")
+	}
+	a := analytics.NewAggregator(analytics.Options{JSONFile: *outputJSON, CSVFile: *outputCSV})
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = a.ReadJSONLines(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Failed to read %s: %s", path, err)
+		}
+	}
+	if *outputJSON == "" && *outputCSV == "" {
+		if err := a.Summary().WriteJSON(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
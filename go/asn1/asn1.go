@@ -13,6 +13,8 @@
 // (encoding/asn1).  The main difference is that this version tries to correct
 // for errors (e.g. use of tagPrintableString when the string data is really
 // ISO8859-1 - a common error present in many x509 certificates in the wild.)
+// How strictly DER is enforced can be chosen with UnmarshalWithOptions; see
+// Strictness.
 // END CT CHANGES
 package asn1
 
@@ -387,6 +389,14 @@ type RawContent []byte
 // SET OF (tag 17) are mapped to SEQUENCE and SEQUENCE OF (tag 16) since we
 // don't distinguish between ordered and unordered objects in this code.
 func parseTagAndLength(bytes []byte, initOffset int) (ret tagAndLength, offset int, err error) {
+	// START CT CHANGES
+	var d decoder
+	return d.parseTagAndLength(bytes, initOffset)
+}
+
+// parseTagAndLength is parseTagAndLength, parsing with the Strictness of d.
+func (d *decoder) parseTagAndLength(bytes []byte, initOffset int) (ret tagAndLength, offset int, err error) {
+	// END CT CHANGES
 	offset = initOffset
 	b := bytes[offset]
 	offset++
@@ -397,10 +407,24 @@ func parseTagAndLength(bytes []byte, initOffset int) (ret tagAndLength, offset i
 	// If the bottom five bits are set, then the tag number is actually base 128
 	// encoded afterwards
 	if ret.tag == 0x1f {
+		// START CT CHANGES
+		if offset < len(bytes) && bytes[offset] == 0x80 {
+			if err = d.allow(d.base+initOffset, SyntaxError{"tag number not minimally-encoded"}, true); err != nil {
+				return
+			}
+		}
+		// END CT CHANGES
 		ret.tag, offset, err = parseBase128Int(bytes, offset)
 		if err != nil {
 			return
 		}
+		// START CT CHANGES
+		if ret.tag < 0x1f {
+			if err = d.allow(d.base+initOffset, SyntaxError{"tag number not minimally-encoded"}, true); err != nil {
+				return
+			}
+		}
+		// END CT CHANGES
 	}
 	if offset >= len(bytes) {
 		err = SyntaxError{"truncated tag or length"}
@@ -419,6 +443,9 @@ func parseTagAndLength(bytes []byte, initOffset int) (ret tagAndLength, offset i
 			return
 		}
 		ret.length = 0
+		// START CT CHANGES
+		lengthOffset := offset
+		// END CT CHANGES
 		for i := 0; i < numBytes; i++ {
 			if offset >= len(bytes) {
 				err = SyntaxError{"truncated tag or length"}
@@ -434,12 +461,19 @@ func parseTagAndLength(bytes []byte, initOffset int) (ret tagAndLength, offset i
 			}
 			ret.length <<= 8
 			ret.length |= int(b)
-			if ret.length == 0 {
-				// DER requires that lengths be minimal.
-				err = StructuralError{"superfluous leading zeros in length"}
+		}
+		// START CT CHANGES
+		// DER requires that lengths be minimal.
+		if bytes[lengthOffset] == 0 {
+			if err = d.allow(d.base+initOffset, StructuralError{"superfluous leading zeros in length"}, false); err != nil {
+				return
+			}
+		} else if ret.length < 0x80 {
+			if err = d.allow(d.base+initOffset, StructuralError{"length not encoded in short form"}, true); err != nil {
 				return
 			}
 		}
+		// END CT CHANGES
 	}
 
 	return
@@ -448,7 +482,7 @@ func parseTagAndLength(bytes []byte, initOffset int) (ret tagAndLength, offset i
 // parseSequenceOf is used for SEQUENCE OF and SET OF values. It tries to parse
 // a number of ASN.1 values from the given byte slice and returns them as a
 // slice of Go values of the given type.
-func parseSequenceOf(bytes []byte, sliceType reflect.Type, elemType reflect.Type) (ret reflect.Value, err error) {
+func (d *decoder) parseSequenceOf(bytes []byte, sliceType reflect.Type, elemType reflect.Type) (ret reflect.Value, err error) {
 	expectedTag, compoundType, ok := getUniversalType(elemType)
 	if !ok {
 		err = StructuralError{"unknown Go type for slice"}
@@ -460,7 +494,7 @@ func parseSequenceOf(bytes []byte, sliceType reflect.Type, elemType reflect.Type
 	numElements := 0
 	for offset := 0; offset < len(bytes); {
 		var t tagAndLength
-		t, offset, err = parseTagAndLength(bytes, offset)
+		t, offset, err = d.parseTagAndLength(bytes, offset)
 		if err != nil {
 			return
 		}
@@ -484,7 +518,7 @@ func parseSequenceOf(bytes []byte, sliceType reflect.Type, elemType reflect.Type
 	params := fieldParameters{}
 	offset := 0
 	for i := 0; i < numElements; i++ {
-		offset, err = parseField(ret.Index(i), bytes, offset, params)
+		offset, err = d.parseField(ret.Index(i), bytes, offset, params)
 		if err != nil {
 			return
 		}
@@ -561,7 +595,7 @@ func iso8859_1ToUTF8(bytes []byte) string {
 // parseField is the main parsing function. Given a byte slice and an offset
 // into the array, it will try to parse a suitable ASN.1 value out and store it
 // in the given Value.
-func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParameters) (offset int, err error) {
+func (d *decoder) parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParameters) (offset int, err error) {
 	offset = initOffset
 	fieldType := v.Type()
 
@@ -576,7 +610,7 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 	// Deal with raw values.
 	if fieldType == rawValueType {
 		var t tagAndLength
-		t, offset, err = parseTagAndLength(bytes, offset)
+		t, offset, err = d.parseTagAndLength(bytes, offset)
 		if err != nil {
 			return
 		}
@@ -593,7 +627,7 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 	// Deal with the ANY type.
 	if ifaceType := fieldType; ifaceType.Kind() == reflect.Interface && ifaceType.NumMethod() == 0 {
 		var t tagAndLength
-		t, offset, err = parseTagAndLength(bytes, offset)
+		t, offset, err = d.parseTagAndLength(bytes, offset)
 		if err != nil {
 			return
 		}
@@ -604,10 +638,18 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		var result interface{}
 		if !t.isCompound && t.class == classUniversal {
 			innerBytes := bytes[offset : offset+t.length]
+			// START CT CHANGES
+			at := d.base + offset
+			// END CT CHANGES
 			switch t.tag {
 			case tagPrintableString:
 				result, err = parsePrintableString(innerBytes)
 				// START CT CHANGES
+				if err == nil {
+					err = d.checkPrintableString(innerBytes, at)
+				}
+				// END CT CHANGES
+				// START CT CHANGES
 				if err != nil && strings.Contains(err.Error(), "PrintableString contains invalid character") {
 					// Probably an ISO8859-1 string stuffed in, check if it
 					// would be valid and assume that's what's happened if so,
@@ -615,9 +657,12 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 					// the bytes
 					switch {
 					case couldBeISO8859_1(innerBytes):
-						result, err = iso8859_1ToUTF8(innerBytes), nil
+						result, err = iso8859_1ToUTF8(innerBytes), d.allow(at, SyntaxError{"PrintableString contains ISO 8859-1 text"}, true)
 					case couldBeT61(innerBytes):
 						result, err = parseT61String(innerBytes)
+						if err == nil {
+							err = d.allow(at, SyntaxError{"PrintableString contains T.61 text"}, true)
+						}
 					default:
 						result = nil
 						err = errors.New("PrintableString contains invalid character, but couldn't determine correct String type.")
@@ -631,13 +676,21 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 			case tagUTF8String:
 				result, err = parseUTF8String(innerBytes)
 			case tagInteger:
-				result, err = parseInt64(innerBytes)
+				// START CT CHANGES
+				if err = d.checkInteger(innerBytes, at); err == nil {
+					result, err = parseInt64(innerBytes)
+				}
 			case tagBitString:
-				result, err = parseBitString(innerBytes)
+				result, err = d.parseBitString(innerBytes, at)
 			case tagOID:
-				result, err = parseObjectIdentifier(innerBytes)
+				if err = d.checkBase128(innerBytes, at); err == nil {
+					result, err = parseObjectIdentifier(innerBytes)
+				}
 			case tagUTCTime:
-				result, err = parseUTCTime(innerBytes)
+				if err = d.checkTime(innerBytes, true, at); err == nil {
+					result, err = parseUTCTime(innerBytes)
+				}
+				// END CT CHANGES
 			case tagOctetString:
 				result = innerBytes
 			default:
@@ -659,7 +712,7 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		return
 	}
 
-	t, offset, err := parseTagAndLength(bytes, offset)
+	t, offset, err := d.parseTagAndLength(bytes, offset)
 	if err != nil {
 		return
 	}
@@ -670,7 +723,7 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		}
 		if t.class == expectedClass && t.tag == *params.tag && (t.length == 0 || t.isCompound) {
 			if t.length > 0 {
-				t, offset, err = parseTagAndLength(bytes, offset)
+				t, offset, err = d.parseTagAndLength(bytes, offset)
 				if err != nil {
 					return
 				}
@@ -740,11 +793,19 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		return
 	}
 	innerBytes := bytes[offset : offset+t.length]
+	// START CT CHANGES
+	at := d.base + offset
+	// END CT CHANGES
 	offset += t.length
 
 	// We deal with the structures defined in this package first.
 	switch fieldType {
 	case objectIdentifierType:
+		// START CT CHANGES
+		if err = d.checkBase128(innerBytes, at); err != nil {
+			return
+		}
+		// END CT CHANGES
 		newSlice, err1 := parseObjectIdentifier(innerBytes)
 		v.Set(reflect.MakeSlice(v.Type(), len(newSlice), len(newSlice)))
 		if err1 == nil {
@@ -753,7 +814,7 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		err = err1
 		return
 	case bitStringType:
-		bs, err1 := parseBitString(innerBytes)
+		bs, err1 := d.parseBitString(innerBytes, at)
 		if err1 == nil {
 			v.Set(reflect.ValueOf(bs))
 		}
@@ -762,6 +823,11 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 	case timeType:
 		var time time.Time
 		var err1 error
+		// START CT CHANGES
+		if err = d.checkTime(innerBytes, universalTag == tagUTCTime, at); err != nil {
+			return
+		}
+		// END CT CHANGES
 		if universalTag == tagUTCTime {
 			time, err1 = parseUTCTime(innerBytes)
 		} else {
@@ -773,6 +839,11 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		err = err1
 		return
 	case enumeratedType:
+		// START CT CHANGES
+		if err = d.checkInteger(innerBytes, at); err != nil {
+			return
+		}
+		// END CT CHANGES
 		parsedInt, err1 := parseInt32(innerBytes)
 		if err1 == nil {
 			v.SetInt(int64(parsedInt))
@@ -783,19 +854,29 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		v.SetBool(true)
 		return
 	case bigIntType:
+		// START CT CHANGES
+		if err = d.checkInteger(innerBytes, at); err != nil {
+			return
+		}
+		// END CT CHANGES
 		parsedInt := parseBigInt(innerBytes)
 		v.Set(reflect.ValueOf(parsedInt))
 		return
 	}
 	switch val := v; val.Kind() {
 	case reflect.Bool:
-		parsedBool, err1 := parseBool(innerBytes)
+		parsedBool, err1 := d.parseBool(innerBytes, at)
 		if err1 == nil {
 			val.SetBool(parsedBool)
 		}
 		err = err1
 		return
 	case reflect.Int, reflect.Int32, reflect.Int64:
+		// START CT CHANGES
+		if err = d.checkInteger(innerBytes, at); err != nil {
+			return
+		}
+		// END CT CHANGES
 		if val.Type().Size() == 4 {
 			parsedInt, err1 := parseInt32(innerBytes)
 			if err1 == nil {
@@ -820,13 +901,17 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 			val.Field(0).Set(reflect.ValueOf(RawContent(bytes)))
 		}
 
+		// START CT CHANGES
+		defer func(base int) { d.base = base }(d.base)
+		d.base = at
+		// END CT CHANGES
 		innerOffset := 0
 		for i := 0; i < structType.NumField(); i++ {
 			field := structType.Field(i)
 			if i == 0 && field.Type == rawContentsType {
 				continue
 			}
-			innerOffset, err = parseField(val.Field(i), innerBytes, innerOffset, parseFieldParameters(field.Tag.Get("asn1")))
+			innerOffset, err = d.parseField(val.Field(i), innerBytes, innerOffset, parseFieldParameters(field.Tag.Get("asn1")))
 			if err != nil {
 				return
 			}
@@ -842,7 +927,11 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 			reflect.Copy(val, reflect.ValueOf(innerBytes))
 			return
 		}
-		newSlice, err1 := parseSequenceOf(innerBytes, sliceType, sliceType.Elem())
+		// START CT CHANGES
+		defer func(base int) { d.base = base }(d.base)
+		d.base = at
+		// END CT CHANGES
+		newSlice, err1 := d.parseSequenceOf(innerBytes, sliceType, sliceType.Elem())
 		if err1 == nil {
 			val.Set(newSlice)
 		}
@@ -853,6 +942,11 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		switch universalTag {
 		case tagPrintableString:
 			v, err = parsePrintableString(innerBytes)
+			// START CT CHANGES
+			if err == nil {
+				err = d.checkPrintableString(innerBytes, at)
+			}
+			// END CT CHANGES
 		case tagIA5String:
 			v, err = parseIA5String(innerBytes)
 		case tagT61String:
@@ -947,8 +1041,15 @@ func Unmarshal(b []byte, val interface{}) (rest []byte, err error) {
 // UnmarshalWithParams allows field parameters to be specified for the
 // top-level element. The form of the params is the same as the field tags.
 func UnmarshalWithParams(b []byte, val interface{}, params string) (rest []byte, err error) {
+	// START CT CHANGES
+	var d decoder
+	return d.unmarshal(b, val, params)
+}
+
+func (d *decoder) unmarshal(b []byte, val interface{}, params string) (rest []byte, err error) {
+	// END CT CHANGES
 	v := reflect.ValueOf(val).Elem()
-	offset, err := parseField(v, b, 0, parseFieldParameters(params))
+	offset, err := d.parseField(v, b, 0, parseFieldParameters(params))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,45 @@
+package asn1
+
+// This file exports what the CT packages need to walk DER element by element,
+// for structures with optional tagged fields which Unmarshal can't match.
+
+// ASN.1 tags for the universal types.
+const (
+	TagBoolean         = tagBoolean
+	TagInteger         = tagInteger
+	TagBitString       = tagBitString
+	TagOctetString     = tagOctetString
+	TagOID             = tagOID
+	TagEnum            = tagEnum
+	TagUTF8String      = tagUTF8String
+	TagSequence        = tagSequence
+	TagSet             = tagSet
+	TagPrintableString = tagPrintableString
+	TagT61String       = tagT61String
+	TagIA5String       = tagIA5String
+	TagUTCTime         = tagUTCTime
+	TagGeneralizedTime = tagGeneralizedTime
+	TagGeneralString   = tagGeneralString
+)
+
+// ASN.1 tag classes.
+const (
+	ClassUniversal       = classUniversal
+	ClassApplication     = classApplication
+	ClassContextSpecific = classContextSpecific
+	ClassPrivate         = classPrivate
+)
+
+// ReadElements splits der into the TLV elements it contains.
+func ReadElements(der []byte) ([]RawValue, error) {
+	var elems []RawValue
+	for len(der) > 0 {
+		var e RawValue
+		var err error
+		if der, err = Unmarshal(der, &e); err != nil {
+			return nil, err
+		}
+		elems = append(elems, e)
+	}
+	return elems, nil
+}
@@ -0,0 +1,160 @@
+package asn1
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Strictness says how strictly Unmarshal applies the rules of DER: which
+// encodings which aren't DER, but which are found in real certificates and
+// logs, it parses anyway.
+type Strictness int
+
+const (
+	// LogCompatible rejects encodings which aren't DER, except for those
+	// common in certificates logged in CT logs: integers and lengths which
+	// aren't minimally encoded, times without seconds or not in UTC, and
+	// PrintableStrings holding '*' or ISO 8859-1 or T.61 text.  It is how
+	// Unmarshal and UnmarshalWithParams parse.
+	LogCompatible Strictness = iota
+	// StrictDER rejects every encoding which isn't DER.
+	StrictDER
+	// Tolerant also parses BER-ish encodings which aren't found in logs,
+	// e.g. lengths with leading zeros, booleans other than 0x00 and 0xff,
+	// and BIT STRINGs with unused bits set, and reports each Deviation
+	// from DER which it parsed.  Indefinite lengths are still rejected.
+	Tolerant
+)
+
+func (s Strictness) String() string {
+	switch s {
+	case LogCompatible:
+		return "log-compatible"
+	case StrictDER:
+		return "strict"
+	case Tolerant:
+		return "tolerant"
+	}
+	return fmt.Sprintf("Strictness(%d)", int(s))
+}
+
+// A Deviation is a departure from DER which was parsed anyway.
+type Deviation struct {
+	// The offset in the input of the element which deviated.
+	Offset int
+	// The error which parsing with StrictDER would have failed with.
+	Err error
+}
+
+func (d Deviation) String() string {
+	return fmt.Sprintf("offset %d: %v", d.Offset, d.Err)
+}
+
+// UnmarshalOptions holds the options for UnmarshalWithOptions.
+type UnmarshalOptions struct {
+	// The field parameters of the top-level element, as for
+	// UnmarshalWithParams.
+	Params     string
+	Strictness Strictness
+}
+
+// UnmarshalWithOptions is UnmarshalWithParams, parsing with the Strictness of
+// opts.  It also returns the Deviations from DER which were parsed, in the
+// order they were found, which is only ever non-empty when parsing with
+// Tolerant.
+func UnmarshalWithOptions(b []byte, val interface{}, opts UnmarshalOptions) (rest []byte, deviations []Deviation, err error) {
+	d := &decoder{strictness: opts.Strictness}
+	rest, err = d.unmarshal(b, val, opts.Params)
+	return rest, d.deviations, err
+}
+
+// decoder holds the state of one call to Unmarshal.
+type decoder struct {
+	strictness Strictness
+	deviations []Deviation
+	// The offset in the input of the bytes being parsed, to which the
+	// offsets parseField is given are relative.
+	base int
+}
+
+// allow returns nil if d parses a deviation from DER at offset at, about
+// which err says, or err if not.  logCompatible says whether LogCompatible
+// parsing allows it.
+func (d *decoder) allow(at int, err error, logCompatible bool) error {
+	switch {
+	case d.strictness == Tolerant:
+		d.deviations = append(d.deviations, Deviation{Offset: at, Err: err})
+		return nil
+	case d.strictness == LogCompatible && logCompatible:
+		return nil
+	}
+	return err
+}
+
+// checkInteger checks that an INTEGER, at offset at, is minimally encoded.
+func (d *decoder) checkInteger(b []byte, at int) error {
+	if len(b) == 0 {
+		return d.allow(at, SyntaxError{"empty integer"}, true)
+	}
+	if len(b) > 1 && (b[0] == 0 && b[1]&0x80 == 0 || b[0] == 0xff && b[1]&0x80 == 0x80) {
+		return d.allow(at, SyntaxError{"integer not minimally-encoded"}, true)
+	}
+	return nil
+}
+
+// checkBase128 checks that the base 128 integers making up b, at offset at,
+// are minimally encoded.
+func (d *decoder) checkBase128(b []byte, at int) error {
+	start := true
+	for i, c := range b {
+		if start && c == 0x80 {
+			return d.allow(at+i, SyntaxError{"base 128 integer not minimally-encoded"}, true)
+		}
+		start = c&0x80 == 0
+	}
+	return nil
+}
+
+// checkTime checks that a UTCTime, if utc is set, or GeneralizedTime, at
+// offset at, is in UTC and includes seconds.
+func (d *decoder) checkTime(b []byte, utc bool, at int) error {
+	if len(b) == 0 || b[len(b)-1] != 'Z' {
+		return d.allow(at, SyntaxError{"time not in UTC"}, true)
+	}
+	if utc && len(b) == len("0601021504Z") {
+		return d.allow(at, SyntaxError{"UTCTime without seconds"}, true)
+	}
+	return nil
+}
+
+// checkPrintableString checks that a PrintableString, at offset at, doesn't
+// hold '*', which isn't in its character set.
+func (d *decoder) checkPrintableString(b []byte, at int) error {
+	if bytes.IndexByte(b, '*') >= 0 {
+		return d.allow(at, SyntaxError{"PrintableString contains '*'"}, true)
+	}
+	return nil
+}
+
+// parseBool is parseBool, parsing any non-zero octet as true if d allows it.
+func (d *decoder) parseBool(b []byte, at int) (bool, error) {
+	ret, err := parseBool(b)
+	if err != nil && len(b) == 1 {
+		if err = d.allow(at, err, false); err == nil {
+			ret = true
+		}
+	}
+	return ret, err
+}
+
+// parseBitString is parseBitString, parsing BIT STRINGs with unused bits set
+// if d allows it.
+func (d *decoder) parseBitString(b []byte, at int) (BitString, error) {
+	ret, err := parseBitString(b)
+	if err != nil && len(b) > 1 && b[0] <= 7 {
+		if err = d.allow(at, err, false); err == nil {
+			ret = BitString{Bytes: b[1:], BitLength: (len(b)-1)*8 - int(b[0])}
+		}
+	}
+	return ret, err
+}
@@ -0,0 +1,93 @@
+package asn1
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type strictnessTest struct {
+	in   []byte
+	val  func() interface{}
+	want interface{}
+	// Whether LogCompatible and StrictDER parsing accept in; Tolerant
+	// parsing always does, with a Deviation unless both do.
+	logCompatible, strict bool
+}
+
+func newIntVal() interface{}    { return new(int) }
+func newBoolVal() interface{}   { return new(bool) }
+func newStringVal() interface{} { return new(string) }
+
+var strictnessTestData = []strictnessTest{
+	{[]byte{0x02, 0x01, 0x05}, newIntVal, 5, true, true},
+	{[]byte{0x02, 0x02, 0x00, 0x05}, newIntVal, 5, true, false},
+	{[]byte{0x02, 0x02, 0xff, 0xfb}, newIntVal, -5, true, false},
+	{[]byte{0x02, 0x81, 0x01, 0x05}, newIntVal, 5, true, false},
+	{[]byte{0x02, 0x82, 0x00, 0x01, 0x05}, newIntVal, 5, false, false},
+	{[]byte{0x01, 0x01, 0xff}, newBoolVal, true, true, true},
+	{[]byte{0x01, 0x01, 0x01}, newBoolVal, true, false, false},
+	{[]byte{0x03, 0x02, 0x07, 0x81}, func() interface{} { return new(BitString) }, BitString{Bytes: []byte{0x81}, BitLength: 1}, false, false},
+	{[]byte{0x13, 0x03, 'a', '*', 'b'}, newStringVal, "a*b", true, false},
+	{[]byte{0x17, 0x0b, '9', '1', '0', '1', '0', '2', '1', '5', '0', '4', 'Z'}, func() interface{} { return new(time.Time) }, time.Date(1991, 1, 2, 15, 4, 0, 0, time.UTC), true, false},
+	{[]byte{0x06, 0x03, 0x2a, 0x80, 0x01}, func() interface{} { return new(ObjectIdentifier) }, ObjectIdentifier{1, 2, 1}, true, false},
+}
+
+func TestUnmarshalStrictness(t *testing.T) {
+	for i, test := range strictnessTestData {
+		for _, s := range []Strictness{LogCompatible, StrictDER, Tolerant} {
+			val := test.val()
+			_, devs, err := UnmarshalWithOptions(test.in, val, UnmarshalOptions{Strictness: s})
+			wantOK := s == Tolerant || s == LogCompatible && test.logCompatible || s == StrictDER && test.strict
+			if (err == nil) != wantOK {
+				t.Errorf("#%d: UnmarshalWithOptions(%x, %s)=_,_,%v, want success %t", i, test.in, s, err, wantOK)
+				continue
+			}
+			if s == Tolerant {
+				if wantDevs := !(test.logCompatible && test.strict); (len(devs) == 1) != wantDevs || len(devs) > 1 {
+					t.Errorf("#%d: UnmarshalWithOptions(%x, %s)=_,%v,_, want deviation %t", i, test.in, s, devs, wantDevs)
+				}
+			} else if len(devs) != 0 {
+				t.Errorf("#%d: UnmarshalWithOptions(%x, %s)=_,%v,_, want no deviations", i, test.in, s, devs)
+			}
+			if err != nil {
+				continue
+			}
+			if got := reflect.ValueOf(val).Elem().Interface(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("#%d: UnmarshalWithOptions(%x, %s) parsed %v, want %v", i, test.in, s, got, test.want)
+			}
+		}
+		// Unmarshal parses as LogCompatible does.
+		if _, err := Unmarshal(test.in, test.val()); (err == nil) != test.logCompatible {
+			t.Errorf("#%d: Unmarshal(%x)=_,%v, want success %t", i, test.in, err, test.logCompatible)
+		}
+	}
+}
+
+func TestUnmarshalDeviationOffsets(t *testing.T) {
+	var val struct {
+		A int
+		B []bool
+	}
+	in := []byte{0x30, 0x0b, 0x02, 0x01, 0x05, 0x30, 0x06, 0x01, 0x01, 0xff, 0x01, 0x01, 0x01}
+	_, devs, err := UnmarshalWithOptions(in, &val, UnmarshalOptions{Strictness: Tolerant})
+	if err != nil {
+		t.Fatalf("UnmarshalWithOptions()=_,_,%v", err)
+	}
+	if len(devs) != 1 || devs[0].Offset != 12 {
+		t.Errorf("UnmarshalWithOptions()=_,%v,_, want one deviation at offset 12", devs)
+	}
+	if val.A != 5 || !reflect.DeepEqual(val.B, []bool{true, true}) {
+		t.Errorf("UnmarshalWithOptions() parsed %+v, want {A:5 B:[true true]}", val)
+	}
+}
+
+func TestUnmarshalIndefiniteLength(t *testing.T) {
+	in := []byte{0x30, 0x80, 0x02, 0x01, 0x05, 0x00, 0x00}
+	for _, s := range []Strictness{LogCompatible, StrictDER, Tolerant} {
+		var val struct{ A int }
+		if _, _, err := UnmarshalWithOptions(in, &val, UnmarshalOptions{Strictness: s}); err == nil {
+			t.Errorf("UnmarshalWithOptions(indefinite length, %s) succeeded, want error", s)
+		}
+	}
+}
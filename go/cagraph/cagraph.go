@@ -0,0 +1,216 @@
+// Package cagraph collects the CA certificates seen in log entries' chains and
+// builds the graph of which of them issued which, including cross-signs, so
+// that every path from a certificate to a set of roots through the CAs the
+// logs have seen can be found.
+package cagraph
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// node is a certificate in the graph, with its edges.
+type node struct {
+	cert *x509.Certificate
+	// The nodes whose keys signed cert, and the nodes cert's key signed.
+	issuers, issued []*node
+}
+
+// Graph is the issuer graph of a set of CA certificates.  It has an edge from
+// each certificate to each certificate whose key verifiably signed it, so a CA
+// which has been cross-signed has a certificate, and so a node, for each of
+// its issuers, with the same subject and public key.  A Graph is safe for
+// concurrent use.
+type Graph struct {
+	mu sync.RWMutex
+	// By the SHA-256 hash of the certificate, its subject and its issuer.
+	byHash    map[[sha256.Size]byte]*node
+	bySubject map[[sha256.Size]byte][]*node
+	byIssuer  map[[sha256.Size]byte][]*node
+	pool      *x509.CertPool
+}
+
+// New returns an empty Graph.
+func New() *Graph {
+	return &Graph{
+		byHash:    make(map[[sha256.Size]byte]*node),
+		bySubject: make(map[[sha256.Size]byte][]*node),
+		byIssuer:  make(map[[sha256.Size]byte][]*node),
+		pool:      x509.NewCertPool(),
+	}
+}
+
+// Len returns the number of certificates in the graph.
+func (g *Graph) Len() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return len(g.byHash)
+}
+
+// Add adds |c| to the graph, if it is a CA certificate, and links it to the
+// certificates already in the graph which issued it or which it issued.  It
+// returns whether |c| was added: false if it isn't a CA or was already there.
+func (g *Graph) Add(c *x509.Certificate) bool {
+	if !c.BasicConstraintsValid || !c.IsCA {
+		return false
+	}
+	h := sha256.Sum256(c.Raw)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.byHash[h] != nil {
+		return false
+	}
+	n := &node{cert: c}
+	for _, parent := range g.bySubject[sha256.Sum256(c.RawIssuer)] {
+		if c.CheckSignatureFrom(parent.cert) == nil {
+			n.issuers = append(n.issuers, parent)
+			parent.issued = append(parent.issued, n)
+		}
+	}
+	for _, child := range g.byIssuer[sha256.Sum256(c.RawSubject)] {
+		if child.cert.CheckSignatureFrom(c) == nil {
+			child.issuers = append(child.issuers, n)
+			n.issued = append(n.issued, child)
+		}
+	}
+	if c.CheckSignatureFrom(c) == nil {
+		n.issuers = append(n.issuers, n)
+		n.issued = append(n.issued, n)
+	}
+	g.byHash[h] = n
+	subject, issuer := sha256.Sum256(c.RawSubject), sha256.Sum256(c.RawIssuer)
+	g.bySubject[subject] = append(g.bySubject[subject], n)
+	g.byIssuer[issuer] = append(g.byIssuer[issuer], n)
+	g.pool.AddCert(c)
+	return true
+}
+
+// AddEntry adds the CA certificates in |entry|'s chain to the graph, and its
+// certificate too if that is a CA.  Certificates which can't be parsed are
+// skipped.  It returns the number of certificates added.
+func (g *Graph) AddEntry(entry *ct.LogEntry) int {
+	added := 0
+	if c := entry.Certificate(); c != nil && !entry.IsPrecert() && g.Add(c) {
+		added++
+	}
+	for _, der := range entry.Chain {
+		c, err := x509.ParseCertificate(der)
+		if x509.IsFatal(err) {
+			continue
+		}
+		if g.Add(c) {
+			added++
+		}
+	}
+	return added
+}
+
+// Write adds |entry|'s CA certificates to the graph, as AddEntry does, so that
+// a Graph can be used as a scanner.Sink.
+func (g *Graph) Write(entry *ct.LogEntry) error {
+	g.AddEntry(entry)
+	return nil
+}
+
+// Close does nothing; it is for using a Graph as a scanner.Sink.
+func (g *Graph) Close() error {
+	return nil
+}
+
+// Contains reports whether |c| is in the graph.
+func (g *Graph) Contains(c *x509.Certificate) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.byHash[sha256.Sum256(c.Raw)] != nil
+}
+
+// Certificates returns the certificates in the graph.
+func (g *Graph) Certificates() []*x509.Certificate {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	certs := make([]*x509.Certificate, 0, len(g.byHash))
+	for _, n := range g.byHash {
+		certs = append(certs, n.cert)
+	}
+	return certs
+}
+
+func certs(nodes []*node) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for _, n := range nodes {
+		certs = append(certs, n.cert)
+	}
+	return certs
+}
+
+// Issuers returns the certificates in the graph whose keys signed |c|, which
+// needn't be in the graph itself.  A self-signed certificate is its own
+// issuer.
+func (g *Graph) Issuers(c *x509.Certificate) []*x509.Certificate {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if n := g.byHash[sha256.Sum256(c.Raw)]; n != nil {
+		return certs(n.issuers)
+	}
+	var issuers []*x509.Certificate
+	for _, parent := range g.bySubject[sha256.Sum256(c.RawIssuer)] {
+		if c.CheckSignatureFrom(parent.cert) == nil {
+			issuers = append(issuers, parent.cert)
+		}
+	}
+	return issuers
+}
+
+// Issued returns the certificates in the graph which |c|'s key signed.
+func (g *Graph) Issued(c *x509.Certificate) []*x509.Certificate {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if n := g.byHash[sha256.Sum256(c.Raw)]; n != nil {
+		return certs(n.issued)
+	}
+	var issued []*x509.Certificate
+	for _, child := range g.byIssuer[sha256.Sum256(c.RawSubject)] {
+		if child.cert.CheckSignatureFrom(c) == nil {
+			issued = append(issued, child.cert)
+		}
+	}
+	return issued
+}
+
+// CrossSigns returns the certificates in the graph, other than |c|, with the
+// same subject and public key as |c|: the other certificates of the same CA,
+// usually issued by other CAs.
+func (g *Graph) CrossSigns(c *x509.Certificate) []*x509.Certificate {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var crossSigns []*x509.Certificate
+	for _, n := range g.bySubject[sha256.Sum256(c.RawSubject)] {
+		if bytes.Equal(n.cert.RawSubjectPublicKeyInfo, c.RawSubjectPublicKeyInfo) && !n.cert.Equal(c) {
+			crossSigns = append(crossSigns, n.cert)
+		}
+	}
+	return crossSigns
+}
+
+// Paths returns every path from |c| to a certificate in |roots| through the
+// certificates in the graph, as x509.BuildAllPaths finds them.  If |roots| is
+// nil, the system roots are used.
+func (g *Graph) Paths(c *x509.Certificate, roots *x509.CertPool) ([]x509.Path, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return x509.BuildAllPaths(c, g.pool, roots)
+}
+
+// FindIssuers returns the certificates in the graph whose subject matches the
+// issuer of |cert|, whether or not they signed it, so that a Graph can be
+// used as a fixchain.IssuerSource.
+func (g *Graph) FindIssuers(ctx context.Context, cert *x509.Certificate) ([]*x509.Certificate, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return certs(g.bySubject[sha256.Sum256(cert.RawIssuer)]), nil
+}
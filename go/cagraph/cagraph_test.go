@@ -0,0 +1,143 @@
+package cagraph
+
+import (
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// hierarchy is two roots, an intermediate issued by the first and
+// cross-signed by the second, and a leaf issued by the intermediate.
+type hierarchy struct {
+	rootA, rootB, inter, crossSigned, leaf *x509.Certificate
+}
+
+func newHierarchy(t *testing.T) *hierarchy {
+	rootA, rootB := testcert.NewCA(t, "Root A", nil), testcert.NewCA(t, "Root B", nil)
+	interKey := testcert.NewKey(t)
+	h := &hierarchy{
+		rootA:       rootA.Cert,
+		rootB:       rootB.Cert,
+		inter:       testcert.Issue(t, testcert.Template("Intermediate", true), interKey, rootA),
+		crossSigned: testcert.Issue(t, testcert.Template("Intermediate", true), interKey, rootB),
+	}
+	inter := &testcert.CA{Cert: h.inter, Key: interKey}
+	h.leaf = testcert.Issue(t, testcert.Template("www.example.com", false), testcert.NewKey(t), inter)
+	return h
+}
+
+func certSet(certs []*x509.Certificate) map[*x509.Certificate]bool {
+	m := make(map[*x509.Certificate]bool)
+	for _, c := range certs {
+		m[c] = true
+	}
+	return m
+}
+
+func TestGraphEdges(t *testing.T) {
+	h := newHierarchy(t)
+	g := New()
+	// Add children before their issuers, so that both directions of
+	// linking are exercised.
+	for _, c := range []*x509.Certificate{h.inter, h.rootA, h.crossSigned, h.rootB} {
+		if !g.Add(c) {
+			t.Errorf("Add(%s)=false, want true", c.Subject.CommonName)
+		}
+	}
+	if g.Add(h.inter) {
+		t.Error("Add(duplicate)=true, want false")
+	}
+	if g.Add(h.leaf) {
+		t.Error("Add(leaf)=true, want false")
+	}
+	if got := g.Len(); got != 4 {
+		t.Errorf("Len()=%d, want 4", got)
+	}
+	if g.Contains(h.leaf) || !g.Contains(h.crossSigned) {
+		t.Error("Contains() gave the wrong answer")
+	}
+
+	for _, test := range []struct {
+		desc string
+		got  []*x509.Certificate
+		want []*x509.Certificate
+	}{
+		{"Issuers(leaf)", g.Issuers(h.leaf), []*x509.Certificate{h.inter, h.crossSigned}},
+		{"Issuers(inter)", g.Issuers(h.inter), []*x509.Certificate{h.rootA}},
+		{"Issuers(crossSigned)", g.Issuers(h.crossSigned), []*x509.Certificate{h.rootB}},
+		{"Issuers(rootA)", g.Issuers(h.rootA), []*x509.Certificate{h.rootA}},
+		{"Issued(rootA)", g.Issued(h.rootA), []*x509.Certificate{h.rootA, h.inter}},
+		{"Issued(inter)", g.Issued(h.inter), nil},
+		{"CrossSigns(inter)", g.CrossSigns(h.inter), []*x509.Certificate{h.crossSigned}},
+		{"CrossSigns(rootA)", g.CrossSigns(h.rootA), nil},
+	} {
+		got, want := certSet(test.got), certSet(test.want)
+		if len(test.got) != len(test.want) || len(got) != len(want) {
+			t.Errorf("%s returned %d certificates, want %d", test.desc, len(test.got), len(test.want))
+			continue
+		}
+		for c := range want {
+			if !got[c] {
+				t.Errorf("%s is missing %s", test.desc, c.Issuer.CommonName)
+			}
+		}
+	}
+}
+
+func TestGraphPaths(t *testing.T) {
+	h := newHierarchy(t)
+	g := New()
+	g.AddEntry(&ct.LogEntry{X509Cert: h.leaf, Chain: []ct.ASN1Cert{h.inter.Raw, h.rootA.Raw, []byte{1, 2, 3}}})
+	g.AddEntry(&ct.LogEntry{X509Cert: h.rootB, Chain: []ct.ASN1Cert{h.crossSigned.Raw}})
+	if got := g.Len(); got != 4 {
+		t.Fatalf("Len()=%d after AddEntry, want 4", got)
+	}
+
+	for _, test := range []struct {
+		roots []*x509.Certificate
+		want  []string
+	}{
+		{[]*x509.Certificate{h.rootA}, []string{"Root A"}},
+		{[]*x509.Certificate{h.rootB}, []string{"Root B"}},
+		{[]*x509.Certificate{h.rootA, h.rootB}, []string{"Root A", "Root B"}},
+	} {
+		pool := x509.NewCertPool()
+		for _, r := range test.roots {
+			pool.AddCert(r)
+		}
+		paths, err := g.Paths(h.leaf, pool)
+		if err != nil {
+			t.Errorf("Paths(roots %v)=_,%v", test.want, err)
+			continue
+		}
+		got := make(map[string]bool)
+		for _, p := range paths {
+			if len(p.Chain) != 3 {
+				t.Errorf("Paths(roots %v) returned a path of length %d, want 3", test.want, len(p.Chain))
+			}
+			got[p.Chain[len(p.Chain)-1].Subject.CommonName] = true
+		}
+		if len(paths) != len(test.want) {
+			t.Errorf("Paths(roots %v) returned %d paths, want %d", test.want, len(paths), len(test.want))
+		}
+		for _, root := range test.want {
+			if !got[root] {
+				t.Errorf("Paths(roots %v) has no path to %s", test.want, root)
+			}
+		}
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(testcert.NewCA(t, "Other Root", nil).Cert)
+	if _, err := g.Paths(h.leaf, pool); err == nil {
+		t.Error("Paths(unrelated root) succeeded, want error")
+	}
+
+	issuers, err := g.FindIssuers(context.Background(), h.leaf)
+	if err != nil || len(issuers) != 2 {
+		t.Errorf("FindIssuers(leaf)=%d certificates,%v, want the intermediate and its cross-sign", len(issuers), err)
+	}
+}
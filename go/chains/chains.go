@@ -0,0 +1,138 @@
+// Package chains normalizes certificate chains: removing duplicate
+// certificates, putting them in order from the leaf towards the root,
+// stripping roots, and canonicalizing chains so that the same set of
+// certificates always gives the same chain.
+//
+// A chain's first certificate is always taken to be its leaf, and is never
+// moved or removed.  None of the functions modify the chains they are given.
+package chains
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// Parse parses the certificates of chain, tolerating the non-fatal errors
+// x509.ParseCertificate returns for certificates which logs accept.
+func Parse(chain []ct.ASN1Cert) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, len(chain))
+	for i, der := range chain {
+		cert, err := x509.ParseCertificate(der)
+		if x509.IsFatal(err) {
+			return nil, fmt.Errorf("failed to parse certificate %d: %v", i, err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// Raw returns the DER encodings of the certificates of chain.
+func Raw(chain []*x509.Certificate) []ct.ASN1Cert {
+	raw := make([]ct.ASN1Cert, len(chain))
+	for i, cert := range chain {
+		raw[i] = cert.Raw
+	}
+	return raw
+}
+
+// Contains reports whether cert is in chain.
+func Contains(chain []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range chain {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// IssuedBy reports whether cert was issued by issuer: whether its issuer is
+// issuer's subject and its signature verifies with issuer's key.
+func IssuedBy(cert, issuer *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, issuer.RawSubject) && cert.CheckSignatureFrom(issuer) == nil
+}
+
+// IsSelfIssued reports whether cert's issuer is its own subject, as roots'
+// are.  Its signature isn't checked.
+func IsSelfIssued(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject)
+}
+
+// Dedupe returns chain without repeats of certificates earlier in it.
+func Dedupe(chain []*x509.Certificate) []*x509.Certificate {
+	var deduped []*x509.Certificate
+	for _, cert := range chain {
+		if !Contains(deduped, cert) {
+			deduped = append(deduped, cert)
+		}
+	}
+	return deduped
+}
+
+// Order returns the path from chain's leaf through the issuers found in
+// chain: the leaf, then the certificate of chain which issued it, then the
+// one which issued that, and so on, until a self-issued certificate or one
+// whose issuer isn't in chain.  Where several certificates of chain issued
+// the same certificate, e.g. cross-signed intermediates, the earliest is
+// used.  Certificates which aren't on the path are dropped.
+func Order(chain []*x509.Certificate) []*x509.Certificate {
+	if len(chain) == 0 {
+		return nil
+	}
+	ordered := []*x509.Certificate{chain[0]}
+	for cur := chain[0]; !IsSelfIssued(cur); {
+		var issuer *x509.Certificate
+		for _, c := range chain[1:] {
+			if !Contains(ordered, c) && IssuedBy(cur, c) {
+				issuer = c
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		ordered = append(ordered, issuer)
+		cur = issuer
+	}
+	return ordered
+}
+
+// StripRoots returns chain without the self-signed certificates at its end,
+// which logs and TLS clients already have.  The leaf is kept even if it is
+// self-signed.
+func StripRoots(chain []*x509.Certificate) []*x509.Certificate {
+	end := len(chain)
+	for end > 1 && IsSelfIssued(chain[end-1]) && chain[end-1].CheckSignatureFrom(chain[end-1]) == nil {
+		end--
+	}
+	return append([]*x509.Certificate(nil), chain[:end]...)
+}
+
+// Canonicalize returns the ordered, deduplicated path from chain's leaf
+// through its issuers, as Order does, but independent of the order of the
+// certificates after the leaf: where several certificates could be the next
+// on the path, those with equal subjects are ordered by their DER encodings,
+// and the first used.  Chains with the same leaf and set of certificates are
+// therefore canonicalized to the same chain.
+func Canonicalize(chain []*x509.Certificate) []*x509.Certificate {
+	deduped := Dedupe(chain)
+	if len(deduped) == 0 {
+		return nil
+	}
+	sort.Sort(bySubjectThenDER(deduped[1:]))
+	return Order(deduped)
+}
+
+type bySubjectThenDER []*x509.Certificate
+
+func (b bySubjectThenDER) Len() int      { return len(b) }
+func (b bySubjectThenDER) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b bySubjectThenDER) Less(i, j int) bool {
+	if c := bytes.Compare(b[i].RawSubject, b[j].RawSubject); c != 0 {
+		return c < 0
+	}
+	return bytes.Compare(b[i].Raw, b[j].Raw) < 0
+}
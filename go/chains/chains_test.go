@@ -0,0 +1,135 @@
+package chains
+
+import (
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// testChain holds a leaf issued by an intermediate which is cross-signed by
+// two roots.
+type testChain struct {
+	root1, root2         *x509.Certificate
+	inter1, inter2, leaf *x509.Certificate
+	unrelated            *x509.Certificate
+}
+
+func newTestChain(t *testing.T) *testChain {
+	root1, root2 := testcert.NewCA(t, "Root 1", nil), testcert.NewCA(t, "Root 2", nil)
+	interKey := testcert.NewKey(t)
+	c := &testChain{
+		root1:     root1.Cert,
+		root2:     root2.Cert,
+		inter1:    testcert.Issue(t, testcert.Template("Intermediate", true), interKey, root1),
+		inter2:    testcert.Issue(t, testcert.Template("Intermediate", true), interKey, root2),
+		unrelated: testcert.NewCA(t, "Unrelated", nil).Cert,
+	}
+	inter := &testcert.CA{Cert: c.inter1, Key: interKey}
+	c.leaf = testcert.Issue(t, testcert.Template("leaf.example.com", false), testcert.NewKey(t), inter)
+	return c
+}
+
+func names(chain []*x509.Certificate) []string {
+	var n []string
+	for _, c := range chain {
+		n = append(n, c.Subject.CommonName)
+	}
+	return n
+}
+
+func checkChain(t *testing.T, desc string, got, want []*x509.Certificate) {
+	if len(got) != len(want) {
+		t.Errorf("%s = %v, want %v", desc, names(got), names(want))
+		return
+	}
+	for i := range got {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("%s[%d] = %s (serial %v), want %s (serial %v)", desc, i, got[i].Subject.CommonName, got[i].SerialNumber, want[i].Subject.CommonName, want[i].SerialNumber)
+		}
+	}
+}
+
+func TestParseAndRaw(t *testing.T) {
+	c := newTestChain(t)
+	chain := []*x509.Certificate{c.leaf, c.inter1, c.root1}
+	parsed, err := Parse(Raw(chain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChain(t, "Parse(Raw(chain))", parsed, chain)
+
+	if _, err := Parse([]ct.ASN1Cert{c.leaf.Raw, []byte("not a certificate")}); err == nil {
+		t.Error("Parse(garbage) succeeded")
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	c := newTestChain(t)
+	got := Dedupe([]*x509.Certificate{c.leaf, c.inter1, c.leaf, c.root1, c.inter1})
+	checkChain(t, "Dedupe", got, []*x509.Certificate{c.leaf, c.inter1, c.root1})
+	if got := Dedupe(nil); len(got) != 0 {
+		t.Errorf("Dedupe(nil) = %v", names(got))
+	}
+}
+
+func TestOrder(t *testing.T) {
+	c := newTestChain(t)
+	tests := []struct {
+		desc  string
+		chain []*x509.Certificate
+		want  []*x509.Certificate
+	}{
+		{"ordered", []*x509.Certificate{c.leaf, c.inter1, c.root1}, []*x509.Certificate{c.leaf, c.inter1, c.root1}},
+		{"reversed", []*x509.Certificate{c.leaf, c.root1, c.inter1}, []*x509.Certificate{c.leaf, c.inter1, c.root1}},
+		{"unrelated dropped", []*x509.Certificate{c.leaf, c.unrelated, c.root1, c.inter1}, []*x509.Certificate{c.leaf, c.inter1, c.root1}},
+		{"duplicates dropped", []*x509.Certificate{c.leaf, c.inter1, c.inter1, c.root1, c.root1}, []*x509.Certificate{c.leaf, c.inter1, c.root1}},
+		{"no issuer", []*x509.Certificate{c.leaf, c.root1}, []*x509.Certificate{c.leaf}},
+		{"cross-signed, first used", []*x509.Certificate{c.leaf, c.inter2, c.inter1, c.root1, c.root2}, []*x509.Certificate{c.leaf, c.inter2, c.root2}},
+		{"root only", []*x509.Certificate{c.root1, c.inter1}, []*x509.Certificate{c.root1}},
+		{"empty", nil, nil},
+	}
+	for _, test := range tests {
+		checkChain(t, "Order("+test.desc+")", Order(test.chain), test.want)
+	}
+}
+
+func TestStripRoots(t *testing.T) {
+	c := newTestChain(t)
+	tests := []struct {
+		desc  string
+		chain []*x509.Certificate
+		want  []*x509.Certificate
+	}{
+		{"with root", []*x509.Certificate{c.leaf, c.inter1, c.root1}, []*x509.Certificate{c.leaf, c.inter1}},
+		{"without root", []*x509.Certificate{c.leaf, c.inter1}, []*x509.Certificate{c.leaf, c.inter1}},
+		{"two roots", []*x509.Certificate{c.leaf, c.inter1, c.root1, c.root2}, []*x509.Certificate{c.leaf, c.inter1}},
+		{"self-signed leaf", []*x509.Certificate{c.root1}, []*x509.Certificate{c.root1}},
+		{"empty", nil, nil},
+	}
+	for _, test := range tests {
+		chain := append([]*x509.Certificate(nil), test.chain...)
+		checkChain(t, "StripRoots("+test.desc+")", StripRoots(chain), test.want)
+		checkChain(t, "chain after StripRoots("+test.desc+")", chain, test.chain)
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	c := newTestChain(t)
+	chains := [][]*x509.Certificate{
+		{c.leaf, c.inter1, c.root1, c.inter2, c.root2},
+		{c.leaf, c.inter2, c.root2, c.inter1, c.root1},
+		{c.leaf, c.root2, c.root1, c.inter2, c.inter1, c.inter1},
+		{c.leaf, c.unrelated, c.inter1, c.inter2, c.root1, c.root2},
+	}
+	want := Canonicalize(chains[0])
+	if len(want) != 3 || !want[0].Equal(c.leaf) {
+		t.Fatalf("Canonicalize(%v) = %v, want leaf, intermediate and root", names(chains[0]), names(want))
+	}
+	for _, chain := range chains[1:] {
+		orig := append([]*x509.Certificate(nil), chain...)
+		checkChain(t, "Canonicalize", Canonicalize(chain), want)
+		checkChain(t, "chain after Canonicalize", chain, orig)
+	}
+}
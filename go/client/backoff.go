@@ -0,0 +1,135 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// BackoffPolicy controls how requests which fail, or which the log answers
+// with a 408, 429 or 5xx status, are retried.  A Retry-After header in the
+// log's response takes precedence over the policy's delay, and requests which
+// timed out on the server (408) are retried immediately.
+type BackoffPolicy struct {
+	// Delay before the first retry.
+	Initial time.Duration
+	// Each retry's delay is Multiplier times the previous one, up to Max.
+	// A Multiplier less than 1 means the delay is always Initial, and a
+	// zero Max means the delay isn't capped.
+	Multiplier float64
+	Max        time.Duration
+	// Each delay is randomly adjusted by up to this fraction of itself in
+	// either direction, so that clients throttled at the same time don't
+	// all retry at the same time.
+	Jitter float64
+	// Maximum number of retries of each request, or zero to retry
+	// indefinitely.  This includes EntryIterators' get-entries calls,
+	// which are only limited to DefaultEntriesMaxRetries when Options
+	// don't set a policy.
+	MaxRetries int
+}
+
+// DefaultBackoffPolicy is used by LogClients whose Options don't set one.  It
+// places no limit on the number of retries, so requests such as AddChain are
+// retried until their context expires, or indefinitely if they have none;
+// callers which want a limit must set MaxRetries in their own policy.  The
+// get-entries calls of such LogClients' EntryIterators are the exception,
+// being retried at most DefaultEntriesMaxRetries times.
+var DefaultBackoffPolicy = BackoffPolicy{
+	Initial:    time.Second,
+	Multiplier: 2,
+	Max:        time.Minute,
+	Jitter:     0.2,
+}
+
+// ResponseMetadata describes how the response to a request was obtained.
+type ResponseMetadata struct {
+	// Number of times the request was retried.
+	Retries int
+	// Total time spent backing off between retries.
+	Backoff time.Duration
+	// Status code of the last response received, or zero if none was.
+	StatusCode int
+	// Number of responses with a 429 (Too Many Requests) status, which
+	// show that the log is overloaded, or limiting this client's rate.
+	Throttled int
+}
+
+// delay returns how long to back off before the retry following |retries|
+// earlier ones.
+func (p *BackoffPolicy) delay(retries int) time.Duration {
+	d := float64(p.Initial)
+	if p.Multiplier > 1 {
+		for i := 0; i < retries && (p.Max == 0 || d < float64(p.Max)); i++ {
+			d *= p.Multiplier
+		}
+	}
+	if p.Max > 0 && d > float64(p.Max) {
+		d = float64(p.Max)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// isRetryableStatus reports whether a request which got an HTTP response with
+// |status| should be retried.
+func isRetryableStatus(status int) bool {
+	return status == http.StatusRequestTimeout || status == 429 || status >= 500
+}
+
+// retryAfter returns the delay requested by the Retry-After header of |resp|,
+// which is either a number of seconds or an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(h); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// backoff waits before retrying a request which failed with |err| or got the
+// retryable response |resp|, and updates |md| to record the retry.  It
+// returns an error instead if |maxRetries| retries have already been made,
+// unless it is zero, or |ctx| expires first.
+func (c *LogClient) backoff(ctx context.Context, maxRetries int, md *ResponseMetadata, resp *http.Response, err error) error {
+	if resp != nil && resp.StatusCode == 429 {
+		md.Throttled++
+	}
+	if maxRetries > 0 && md.Retries >= maxRetries {
+		return fmt.Errorf("giving up after %d retries: %v", md.Retries, err)
+	}
+	d, ok := retryAfter(resp, time.Now())
+	switch {
+	case ok:
+	case resp != nil && resp.StatusCode == http.StatusRequestTimeout:
+		d = 0
+	default:
+		d = c.backoffPolicy.delay(md.Retries)
+	}
+	log.Printf("Got %v, backing-off %s", err, d)
+	if err := backoffForRetry(ctx, d); err != nil {
+		return err
+	}
+	md.Retries++
+	md.Backoff += d
+	return nil
+}
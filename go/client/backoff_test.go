@@ -0,0 +1,149 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"golang.org/x/net/context"
+)
+
+func TestBackoffPolicyDelay(t *testing.T) {
+	tests := []struct {
+		policy  BackoffPolicy
+		retries int
+		want    time.Duration
+	}{
+		{BackoffPolicy{Initial: time.Second}, 0, time.Second},
+		{BackoffPolicy{Initial: time.Second}, 5, time.Second},
+		{BackoffPolicy{Initial: time.Second, Multiplier: 2}, 3, 8 * time.Second},
+		{BackoffPolicy{Initial: time.Second, Multiplier: 2, Max: 5 * time.Second}, 3, 5 * time.Second},
+		{BackoffPolicy{Initial: time.Second, Multiplier: 2, Max: 5 * time.Second}, 1000, 5 * time.Second},
+	}
+	for i, test := range tests {
+		if got := test.policy.delay(test.retries); got != test.want {
+			t.Errorf("#%d: delay(%d)=%s, want %s", i, test.retries, got, test.want)
+		}
+	}
+
+	p := BackoffPolicy{Initial: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if d := p.delay(0); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("delay(0)=%s with jitter 0.5, want within [500ms, 1.5s]", d)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"10", 10 * time.Second, true},
+		{"0", 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+	}
+	for i, test := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if test.header != "" {
+			resp.Header.Set("Retry-After", test.header)
+		}
+		got, ok := retryAfter(resp, now)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("#%d: retryAfter(%q)=%s,%t, want %s,%t", i, test.header, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestAddChainRetries(t *testing.T) {
+	tests := []struct {
+		statuses    []int // Returned before success.
+		maxRetries  int
+		wantRetries int
+		wantErr     bool
+	}{
+		{statuses: nil, wantRetries: 0},
+		{statuses: []int{429, 500, 503}, wantRetries: 3},
+		{statuses: []int{429, 429, 429}, maxRetries: 2, wantRetries: 2, wantErr: true},
+		{statuses: []int{400}, wantRetries: 0, wantErr: true},
+	}
+	for i, test := range tests {
+		requests := 0
+		hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests <= len(test.statuses) {
+				if test.statuses[requests-1] == 429 {
+					w.Header().Set("Retry-After", "0")
+				}
+				w.WriteHeader(test.statuses[requests-1])
+				return
+			}
+			w.Write([]byte(validAddChainResponse))
+		}))
+		c := NewWithOptions(hs.URL, Options{Backoff: &BackoffPolicy{
+			Initial:    time.Millisecond,
+			Multiplier: 2,
+			Jitter:     0.5,
+			MaxRetries: test.maxRetries,
+		}})
+		sct, md, err := c.AddChainWithMetadata(context.Background(), []ct.ASN1Cert{[]byte("cert")})
+		hs.Close()
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("#%d: AddChainWithMetadata()=_,_,%v, want error: %t", i, err, test.wantErr)
+		}
+		if !test.wantErr && sct == nil {
+			t.Errorf("#%d: AddChainWithMetadata() returned no SCT", i)
+		}
+		if md.Retries != test.wantRetries {
+			t.Errorf("#%d: got %d retries, want %d", i, md.Retries, test.wantRetries)
+		}
+		wantStatus := 200
+		if test.wantErr {
+			wantStatus = test.statuses[len(test.statuses)-1]
+		}
+		if md.StatusCode != wantStatus {
+			t.Errorf("#%d: got status %d, want %d", i, md.StatusCode, wantStatus)
+		}
+	}
+}
+
+func TestDefaultBackoffRetries(t *testing.T) {
+	// More failures than any limit, each asking for an immediate retry.
+	const failures = 20
+	requests := 0
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= failures {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(validAddChainResponse))
+	}))
+	defer hs.Close()
+	c := NewWithOptions(hs.URL, Options{})
+
+	// AddChain retries until it succeeds.
+	if _, md, err := c.AddChainWithMetadata(context.Background(), []ct.ASN1Cert{[]byte("cert")}); err != nil || md.Retries != failures {
+		t.Errorf("AddChainWithMetadata()=_,%+v,%v, want success after %d retries", md, err, failures)
+	}
+
+	// EntryIterators give up after DefaultEntriesMaxRetries.
+	requests = 0
+	it := c.Entries(context.Background(), 0, 0)
+	if it.Next() {
+		t.Fatal("Entries() returned an entry")
+	}
+	if it.Err() == nil || it.Retries() != DefaultEntriesMaxRetries {
+		t.Errorf("Entries() failed with %v after %d retries, want an error after %d", it.Err(), it.Retries(), DefaultEntriesMaxRetries)
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"golang.org/x/net/context"
+)
+
+// BatchOptions controls how AddChainBatch submits chains.
+type BatchOptions struct {
+	// Maximum number of chains submitted at once.  Values less than 1 are
+	// treated as 1.
+	Concurrency int
+
+	// Maximum number of attempts to submit each chain, including the
+	// first.  Values less than 1 are treated as 1.  Only attempts which
+	// exceed AttemptTimeout are retried: retryable HTTP failures are
+	// already retried within each attempt, and the log rejecting a chain
+	// isn't worth retrying.
+	Attempts int
+
+	// Timeout for each attempt.  Zero means no per-attempt timeout.
+	AttemptTimeout time.Duration
+
+	// Submit the chains with add-pre-chain rather than add-chain.
+	Precert bool
+}
+
+// BatchResult is the outcome of submitting one of the chains passed to
+// AddChainBatch.
+type BatchResult struct {
+	SCT      *ct.SignedCertificateTimestamp // nil if the submission failed
+	Err      error
+	Attempts int
+	// Total number of retries made within the attempts, according to the
+	// client's BackoffPolicy.
+	Retries int
+}
+
+// AddChainBatch submits each of the (DER represented) chains to the log, with
+// the parallelism and retries set by opts, and returns the result for each
+// chain in the same order.  If ctx expires, the chains which haven't been
+// submitted by then fail with the context's error.
+func (c *LogClient) AddChainBatch(ctx context.Context, chains [][]ct.ASN1Cert, opts BatchOptions) []BatchResult {
+	path := AddChainPath
+	if opts.Precert {
+		path = AddPreChainPath
+	}
+	workers := opts.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(chains) {
+		workers = len(chains)
+	}
+
+	results := make([]BatchResult, len(chains))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] = c.addChainAttempts(ctx, path, chains[i], opts)
+			}
+		}()
+	}
+	for i := range chains {
+		if ctx.Err() != nil {
+			results[i].Err = ctx.Err()
+			continue
+		}
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return results
+}
+
+// addChainAttempts submits chain, retrying attempts which time out.
+func (c *LogClient) addChainAttempts(ctx context.Context, path string, chain []ct.ASN1Cert, opts BatchOptions) BatchResult {
+	attempts := opts.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var r BatchResult
+	for r.Attempts < attempts {
+		r.Attempts++
+		actx := ctx
+		cancel := func() {}
+		if opts.AttemptTimeout > 0 {
+			actx, cancel = context.WithTimeout(ctx, opts.AttemptTimeout)
+		}
+		var md *ResponseMetadata
+		r.SCT, md, r.Err = c.addChainWithRetry(actx, path, chain)
+		r.Retries += md.Retries
+		timedOut := actx.Err() == context.DeadlineExceeded
+		cancel()
+		if r.Err == nil || !timedOut || ctx.Err() != nil {
+			break
+		}
+	}
+	return r
+}
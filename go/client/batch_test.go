@@ -0,0 +1,109 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"golang.org/x/net/context"
+)
+
+const validAddChainResponse = `{"sct_version":0,"id":"KHYaGJAn++880NYaAY12sFBXKcenQRvMvfYE9F1CYVM=","timestamp":1337,"extensions":"","signature":"BAMARjBEAiAIc21J5ZbdKZHw5wLxCP+MhBEsV5+nfvGyakOIv6FOvAIgWYMZb6Pw///uiNM7QTg2Of1OqmK1GbeGuEl9VJN8v8c="}`
+
+func TestAddChainBatch(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	slowAttempts := 0
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != AddChainPath {
+			t.Errorf("Incorrect URL path: %s", r.URL.Path)
+		}
+		var req addChainRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Chain) != 1 {
+			t.Errorf("Failed to decode add-chain request: %v", err)
+			return
+		}
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		slow := req.Chain[0] == "c2xvdw==" && slowAttempts == 0 // "slow"
+		if slow {
+			slowAttempts++
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+
+		switch {
+		case req.Chain[0] == "YmFk": // "bad"
+			http.Error(w, "bad chain", http.StatusBadRequest)
+			return
+		case slow:
+			// The first attempt for this chain times out.
+			time.Sleep(200 * time.Millisecond)
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+		w.Write([]byte(validAddChainResponse))
+	}))
+	defer hs.Close()
+
+	chains := [][]ct.ASN1Cert{{[]byte("good")}, {[]byte("bad")}, {[]byte("slow")}}
+	for i := 0; i < 5; i++ {
+		chains = append(chains, []ct.ASN1Cert{[]byte("good")})
+	}
+	c := New(hs.URL)
+	results := c.AddChainBatch(context.Background(), chains, BatchOptions{
+		Concurrency:    3,
+		Attempts:       2,
+		AttemptTimeout: 100 * time.Millisecond,
+	})
+
+	if len(results) != len(chains) {
+		t.Fatalf("AddChainBatch() returned %d results, expected %d", len(results), len(chains))
+	}
+	for i, r := range results {
+		switch i {
+		case 1:
+			if r.Err == nil || r.SCT != nil || r.Attempts != 1 {
+				t.Errorf("#%d: result for rejected chain is %+v, expected a single failed attempt", i, r)
+			}
+		case 2:
+			if r.Err != nil || r.SCT == nil || r.Attempts != 2 {
+				t.Errorf("#%d: result for slow chain is %+v, expected success on the second attempt", i, r)
+			}
+		default:
+			if r.Err != nil || r.SCT == nil || r.SCT.Timestamp != 1337 || r.Attempts != 1 {
+				t.Errorf("#%d: result is %+v, expected an SCT on the first attempt", i, r)
+			}
+		}
+	}
+	if maxInFlight > 3 {
+		t.Errorf("%d submissions were in flight at once, expected at most 3", maxInFlight)
+	}
+}
+
+func TestAddChainBatchCancelled(t *testing.T) {
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(validAddChainResponse))
+	}))
+	defer hs.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := New(hs.URL).AddChainBatch(ctx, [][]ct.ASN1Cert{{[]byte("a")}, {[]byte("b")}}, BatchOptions{})
+	for i, r := range results {
+		if r.Err != context.Canceled {
+			t.Errorf("#%d: result is %+v, expected the context's error", i, r)
+		}
+	}
+}
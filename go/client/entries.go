@@ -0,0 +1,156 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/certificate-transparency/go"
+	"golang.org/x/net/context"
+)
+
+// Defaults for the Options which configure EntryIterators.
+const (
+	// Number of entries requested with each get-entries call, unless
+	// Options says otherwise.
+	DefaultEntriesBatchSize = 1000
+	// Number of times each get-entries call is retried before giving up,
+	// by LogClients whose Options don't set a BackoffPolicy.
+	DefaultEntriesMaxRetries = 4
+)
+
+// EntryIterator iterates over a range of a log's entries, fetching them in
+// batches with get-entries as they are needed.  It is not safe for concurrent
+// use.  A typical loop is:
+//
+//	it := client.Entries(ctx, start, end)
+//	for it.Next() {
+//		entry := it.Entry()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type EntryIterator struct {
+	c         *LogClient
+	ctx       context.Context
+	next, end int64 // The range of entries still to be fetched.
+	batchSize int64
+	buf       []ct.LogEntry
+	entry     *ct.LogEntry
+	err       error
+	retries   int
+}
+
+// Entries returns an iterator over the entries in the sequence [|start|,
+// |end|] of the log.
+//
+// Each batch is requested with a single get-entries call.  Logs may return
+// fewer entries than were asked for, in which case the batch size is reduced
+// to the number returned.  Calls which fail, or which receive a 408, 429 or 5xx
+// response, are retried according to the client's BackoffPolicy, and calls
+// which receive any other 4xx response are retried with half the batch size,
+// as some logs reject requests for too many entries outright.
+func (c *LogClient) Entries(ctx context.Context, start, end int64) *EntryIterator {
+	it := &EntryIterator{
+		c:         c,
+		ctx:       ctx,
+		next:      start,
+		end:       end,
+		batchSize: c.entriesBatchSize,
+	}
+	switch {
+	case end < 0:
+		it.err = errors.New("end should be >= 0")
+	case end < start:
+		it.err = errors.New("start should be <= end")
+	}
+	return it
+}
+
+// Next advances the iterator to the next entry, which is then available from
+// Entry.  It returns false when there are no more entries, or if fetching them
+// failed, in which case Err returns the error.
+func (it *EntryIterator) Next() bool {
+	it.entry = nil
+	if it.err != nil {
+		return false
+	}
+	if len(it.buf) == 0 {
+		if it.next > it.end {
+			return false
+		}
+		if it.err = it.fetch(); it.err != nil {
+			return false
+		}
+	}
+	it.entry = &it.buf[0]
+	it.buf = it.buf[1:]
+	return true
+}
+
+// Entry returns the entry the iterator is at.
+func (it *EntryIterator) Entry() *ct.LogEntry {
+	return it.entry
+}
+
+// Err returns the error, if any, which stopped the iterator.
+func (it *EntryIterator) Err() error {
+	return it.err
+}
+
+// Retries returns the number of get-entries calls the iterator has retried
+// according to the client's BackoffPolicy.
+func (it *EntryIterator) Retries() int {
+	return it.retries
+}
+
+// fetch fetches the next batch of entries into the iterator's buffer.
+func (it *EntryIterator) fetch() error {
+	md := &ResponseMetadata{}
+	defer func() { it.retries += md.Retries }()
+	for {
+		end := it.next + it.batchSize - 1
+		if end > it.end {
+			end = it.end
+		}
+		var resp getEntriesResponse
+		httpResp, body, err := it.c.getAndParse(it.ctx, it.c.getEntriesURI(it.next, end), &resp)
+		if it.ctx != nil && it.ctx.Err() != nil {
+			return it.ctx.Err()
+		}
+		switch {
+		case err != nil:
+		case httpResp.StatusCode == 200:
+			if len(resp.Entries) == 0 {
+				// The log may not have integrated the entries yet.
+				err = fmt.Errorf("log returned no entries for [%d, %d]", it.next, end)
+				break
+			}
+			if n := int64(len(resp.Entries)); n > end-it.next+1 {
+				resp.Entries = resp.Entries[:end-it.next+1]
+			} else if n < end-it.next+1 {
+				it.batchSize = n
+			}
+			entries, err := parseEntries(it.next, &resp)
+			if err != nil {
+				return err
+			}
+			it.buf = entries
+			it.next += int64(len(entries))
+			return nil
+		case isRetryableStatus(httpResp.StatusCode):
+			err = fmt.Errorf("got HTTP Status %s: %s", httpResp.Status, body)
+		case httpResp.StatusCode >= 400 && httpResp.StatusCode < 500 && it.batchSize > 1:
+			// Retry immediately with a smaller batch, which doesn't
+			// count as a retry.
+			it.batchSize /= 2
+			continue
+		default:
+			return fmt.Errorf("got HTTP Status %s: %s", httpResp.Status, body)
+		}
+
+		if err := it.c.backoff(it.ctx, it.c.entriesMaxRetries, md, httpResp, err); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// fakeEntriesLog serves get-entries for a log of size entries, returning at
+// most maxPerCall entries per call and rejecting calls for more than
+// maxRequest entries with a 400.  The first failFirst calls get a 503.
+type fakeEntriesLog struct {
+	size       int64
+	maxPerCall int64
+	maxRequest int64
+	failFirst  int
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (l *fakeEntriesLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	start, _ := strconv.ParseInt(q.Get("start"), 10, 64)
+	end, _ := strconv.ParseInt(q.Get("end"), 10, 64)
+	l.mu.Lock()
+	l.requests = append(l.requests, fmt.Sprintf("%d-%d", start, end))
+	fail := len(l.requests) <= l.failFirst
+	l.mu.Unlock()
+
+	switch {
+	case fail:
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	case l.maxRequest > 0 && end-start+1 > l.maxRequest:
+		http.Error(w, "too many entries", http.StatusBadRequest)
+		return
+	}
+	if end >= l.size {
+		end = l.size - 1
+	}
+	if l.maxPerCall > 0 && end-start+1 > l.maxPerCall {
+		end = start + l.maxPerCall - 1
+	}
+	var entries []string
+	for i := start; i <= end; i++ {
+		entries = append(entries, fmt.Sprintf(`{"leaf_input": "%s","extra_data": "%s"}`, CertEntryB64, CertEntryExtraDataB64))
+	}
+	fmt.Fprintf(w, `{"entries":[%s]}`, strings.Join(entries, ","))
+}
+
+func TestEntries(t *testing.T) {
+	tests := []struct {
+		log          *fakeEntriesLog
+		start, end   int64
+		wantRequests []string
+		wantErr      bool
+	}{
+		{
+			log:          &fakeEntriesLog{size: 10},
+			start:        2,
+			end:          8,
+			wantRequests: []string{"2-5", "6-8"},
+		},
+		{
+			// The log returns fewer entries than were asked for.
+			log:          &fakeEntriesLog{size: 10, maxPerCall: 3},
+			start:        0,
+			end:          9,
+			wantRequests: []string{"0-3", "3-5", "6-8", "9-9"},
+		},
+		{
+			// The log rejects requests for too many entries.
+			log:          &fakeEntriesLog{size: 10, maxRequest: 2},
+			start:        0,
+			end:          4,
+			wantRequests: []string{"0-3", "0-1", "2-3", "4-4"},
+		},
+		{
+			log:          &fakeEntriesLog{size: 10, failFirst: 2},
+			start:        0,
+			end:          3,
+			wantRequests: []string{"0-3", "0-3", "0-3"},
+		},
+		{
+			log:          &fakeEntriesLog{size: 10, failFirst: 3},
+			start:        0,
+			end:          3,
+			wantRequests: []string{"0-3", "0-3", "0-3"},
+			wantErr:      true,
+		},
+		{
+			// The log hasn't got the entries.
+			log:          &fakeEntriesLog{size: 2},
+			start:        0,
+			end:          5,
+			wantRequests: []string{"0-3", "2-3", "2-3", "2-3"},
+			wantErr:      true,
+		},
+	}
+
+	for i, test := range tests {
+		ts := httptest.NewServer(test.log)
+		c := NewWithOptions(ts.URL, Options{
+			EntriesBatchSize: 4,
+			Backoff:          &BackoffPolicy{Initial: time.Millisecond, MaxRetries: 2},
+		})
+		it := c.Entries(context.Background(), test.start, test.end)
+		want := test.start
+		for it.Next() {
+			if got := it.Entry().Index; got != want {
+				t.Errorf("#%d: got entry %d, want %d", i, got, want)
+			}
+			want++
+		}
+		ts.Close()
+
+		if err := it.Err(); (err != nil) != test.wantErr {
+			t.Errorf("#%d: Err()=%v, want error: %t", i, err, test.wantErr)
+		}
+		if !test.wantErr && want != test.end+1 {
+			t.Errorf("#%d: iterated up to entry %d, want %d", i, want-1, test.end)
+		}
+		if got := strings.Join(test.log.requests, " "); got != strings.Join(test.wantRequests, " ") {
+			t.Errorf("#%d: requested %s, want %s", i, got, strings.Join(test.wantRequests, " "))
+		}
+	}
+}
+
+func TestEntriesBadRange(t *testing.T) {
+	c := New("http://localhost")
+	for _, r := range [][2]int64{{0, -1}, {5, 4}} {
+		it := c.Entries(context.Background(), r[0], r[1])
+		if it.Next() || it.Err() == nil {
+			t.Errorf("Entries(%d, %d) iterated without error", r[0], r[1])
+		}
+	}
+}
+
+func TestEntriesCancelled(t *testing.T) {
+	l := &fakeEntriesLog{size: 10, failFirst: 100}
+	ts := httptest.NewServer(l)
+	defer ts.Close()
+	c := NewWithOptions(ts.URL, Options{Backoff: &BackoffPolicy{Initial: time.Hour}})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	it := c.Entries(ctx, 0, 9)
+	if it.Next() {
+		t.Fatal("Next()=true, want false")
+	}
+	if it.Err() != context.DeadlineExceeded {
+		t.Errorf("Err()=%v, want %v", it.Err(), context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RequestInfo describes an HTTP request which a LogClient is making to its
+// log, for the Options.OnRequest and OnResponse hooks.
+type RequestInfo struct {
+	Method string // "GET" or "POST"
+	// The API entrypoint requested, e.g. AddChainPath, which is the URI's
+	// path relative to the log's base URI.
+	Entrypoint string
+	URI        string // The full URI requested, including any query
+}
+
+// ResponseInfo describes how an HTTP request which a LogClient made to its log
+// completed.
+type ResponseInfo struct {
+	RequestInfo
+	// HTTP status code of the response, which is zero if none was received.
+	StatusCode int
+	// Time from sending the request to reading the whole response body.
+	Latency time.Duration
+	// Error the request failed with, if it didn't get a response or the
+	// body couldn't be read.  Responses with non-200 statuses aren't
+	// errors.
+	Err error
+}
+
+// entrypoint returns the API entrypoint which u, a URI under the log's base
+// URI, requests.
+func (c *LogClient) entrypoint(u *url.URL) string {
+	path := u.Path
+	if base, err := url.Parse(c.uri); err == nil {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(base.Path, "/"))
+	}
+	return path
+}
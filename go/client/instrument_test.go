@@ -0,0 +1,75 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"golang.org/x/net/context"
+)
+
+func TestHooks(t *testing.T) {
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/logs/test" + AddChainPath:
+			w.Write([]byte(validAddChainResponse))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer hs.Close()
+
+	var requests []RequestInfo
+	var responses []ResponseInfo
+	client := NewWithOptions(hs.URL+"/logs/test", Options{
+		OnRequest: func(ctx context.Context, info RequestInfo) {
+			requests = append(requests, info)
+		},
+		OnResponse: func(ctx context.Context, info ResponseInfo) {
+			responses = append(responses, info)
+		},
+	})
+	if _, err := client.AddChainWithContext(context.Background(), []ct.ASN1Cert{[]byte("cert")}); err != nil {
+		t.Fatalf("AddChainWithContext()=_,%v", err)
+	}
+	if _, err := client.GetSTH(); err == nil {
+		t.Fatalf("GetSTH()=_,nil, want error")
+	}
+
+	tests := []struct {
+		method, entrypoint string
+		status             int
+	}{
+		{"POST", AddChainPath, http.StatusOK},
+		{"GET", GetSTHPath, http.StatusNotFound},
+	}
+	if len(requests) != len(tests) || len(responses) != len(tests) {
+		t.Fatalf("got %d requests and %d responses, want %d of each", len(requests), len(responses), len(tests))
+	}
+	for i, test := range tests {
+		if got := requests[i]; got.Method != test.method || got.Entrypoint != test.entrypoint {
+			t.Errorf("#%d: got request %+v, want %s %s", i, got, test.method, test.entrypoint)
+		}
+		got := responses[i]
+		if got.RequestInfo != requests[i] {
+			t.Errorf("#%d: response has RequestInfo %+v, want %+v", i, got.RequestInfo, requests[i])
+		}
+		if got.StatusCode != test.status || got.Err != nil {
+			t.Errorf("#%d: got response with status %d and error %v, want %d and nil", i, got.StatusCode, got.Err, test.status)
+		}
+		if got.Latency <= 0 {
+			t.Errorf("#%d: got latency %v, want positive", i, got.Latency)
+		}
+	}
+
+	// Requests which get no response report an error.
+	hs.Close()
+	responses = nil
+	if _, err := client.GetSTH(); err == nil {
+		t.Fatalf("GetSTH()=_,nil, want error")
+	}
+	if len(responses) != 1 || responses[0].StatusCode != 0 || responses[0].Err == nil {
+		t.Errorf("got responses %+v, want one with an error", responses)
+	}
+}
@@ -11,28 +11,108 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"strconv"
+	"sync"
 	"time"
 
 	"github.com/google/certificate-transparency/go"
 	"github.com/mreiferson/go-httpclient"
 	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
 )
 
 // URI paths for CT Log endpoints
 const (
-	AddChainPath    = "/ct/v1/add-chain"
-	AddPreChainPath = "/ct/v1/add-pre-chain"
-	GetSTHPath      = "/ct/v1/get-sth"
-	GetEntriesPath  = "/ct/v1/get-entries"
+	AddChainPath          = "/ct/v1/add-chain"
+	AddPreChainPath       = "/ct/v1/add-pre-chain"
+	GetSTHPath            = "/ct/v1/get-sth"
+	GetEntriesPath        = "/ct/v1/get-entries"
+	GetSTHConsistencyPath = "/ct/v1/get-sth-consistency"
+	GetProofByHashPath    = "/ct/v1/get-proof-by-hash"
+	GetRootsPath          = "/ct/v1/get-roots"
 )
 
 // LogClient represents a client for a given CT Log instance
 type LogClient struct {
 	uri        string       // the base URI of the log. e.g. http://ct.googleapis/pilot
 	httpClient *http.Client // used to interact with the log via HTTP
+	verifier   *ct.SignatureVerifier
+
+	entriesBatchSize  int64
+	entriesMaxRetries int
+	backoffPolicy     BackoffPolicy
+
+	rootsCacheTTL time.Duration
+	rootsMu       sync.Mutex
+	roots         *acceptedRoots
+
+	onRequest  func(ctx context.Context, info RequestInfo)
+	onResponse func(ctx context.Context, info ResponseInfo)
+
+	version ct.Version
+}
+
+// Options holds optional configuration for a LogClient.
+type Options struct {
+	// If non-nil, the signature of every SCT returned by add-chain or
+	// add-pre-chain is verified with the log's public key before the SCT is
+	// returned, and a VerificationError is returned if it doesn't verify.
+	Verifier *ct.SignatureVerifier
+
+	// Number of entries requested by each get-entries call made by an
+	// EntryIterator.  Logs may return fewer, in which case the iterator
+	// asks for no more than the log returned from then on.  Zero means
+	// DefaultEntriesBatchSize.
+	EntriesBatchSize int64
+
+	// How failed requests are retried.  If nil, DefaultBackoffPolicy is
+	// used, except that EntryIterators retry each get-entries call at most
+	// DefaultEntriesMaxRetries times.  A policy set here applies to
+	// EntryIterators too, so one whose MaxRetries is zero makes them retry
+	// each get-entries call indefinitely, like every other request; set
+	// MaxRetries to keep them bounded.
+	Backoff *BackoffPolicy
+
+	// The HTTP client used to talk to the log, e.g. one whose transport is
+	// shared with other LogClients.  If nil, a client is created using a
+	// transport tuned by Transport, or the default transport if Transport
+	// is nil too.
+	HTTPClient *http.Client
+	Transport  *TransportOptions
+	// Timeout for each HTTP request, including reading the response body,
+	// when the client is created from Transport.  Zero means 30 seconds.
+	RequestTimeout time.Duration
+
+	// How long the roots returned by GetAcceptedRoots are cached for.
+	// Zero means DefaultRootsCacheTTL, and a negative value disables the
+	// cache.
+	RootsCacheTTL time.Duration
+
+	// Hooks called before each HTTP request is made to the log, and once
+	// it completes, including each retry, e.g. to trace requests or record
+	// metrics.  They may be called concurrently, with the context of the
+	// call which made the request, which is context.Background() for calls
+	// which don't take one.
+	OnRequest  func(ctx context.Context, info RequestInfo)
+	OnResponse func(ctx context.Context, info ResponseInfo)
+
+	// The version of the CT protocol the log speaks.  The zero value is
+	// ct.V1.  The methods whose names end in V2 can only be used with
+	// ct.V2 logs, and the others only with ct.V1 logs.  If Verifier is
+	// set, a V2 client also verifies the signatures of the tree heads it
+	// returns.
+	Version ct.Version
+}
+
+// VerificationError is returned when the signature on an SCT returned by the
+// log doesn't verify.
+type VerificationError struct {
+	SCT *ct.SignedCertificateTimestamp // The SCT returned by the log
+	Err error
+}
+
+func (e VerificationError) Error() string {
+	return fmt.Sprintf("failed to verify SCT signature: %v", e.Err)
 }
 
 //////////////////////////////////////////////////////////////////////////////////
@@ -87,6 +167,12 @@ type getAuditProofResponse struct {
 	TreeSize uint64   `json:"tree_size"` // the tree size against which this proof is constructed
 }
 
+// getProofByHashResponse represents the JSON response to the CT get-proof-by-hash method
+type getProofByHashResponse struct {
+	LeafIndex int64    `json:"leaf_index"` // the index of the leaf with the hash
+	AuditPath []string `json:"audit_path"` // the hashes which make up the proof
+}
+
 // getAcceptedRootsResponse represents the JSON response to the CT get-roots method.
 type getAcceptedRootsResponse struct {
 	Certificates []string `json:"certificates"`
@@ -103,50 +189,102 @@ type getEntryAndProofResponse struct {
 // |uri| is the base URI of the CT log instance to interact with, e.g.
 // http://ct.googleapis.com/pilot
 func New(uri string) *LogClient {
+	return NewWithOptions(uri, Options{})
+}
+
+// NewWithOptions constructs a new LogClient instance in the same way as New,
+// taking the rest of its configuration from opts.
+func NewWithOptions(uri string, opts Options) *LogClient {
 	var c LogClient
 	c.uri = uri
-	transport := &httpclient.Transport{
-		ConnectTimeout:        10 * time.Second,
-		RequestTimeout:        30 * time.Second,
-		ResponseHeaderTimeout: 30 * time.Second,
-		MaxIdleConnsPerHost:   10,
-		DisableKeepAlives:     false,
-	}
-	c.httpClient = &http.Client{Transport: transport}
+	c.verifier = opts.Verifier
+	c.entriesBatchSize = opts.EntriesBatchSize
+	if c.entriesBatchSize <= 0 {
+		c.entriesBatchSize = DefaultEntriesBatchSize
+	}
+	c.backoffPolicy = DefaultBackoffPolicy
+	c.entriesMaxRetries = DefaultEntriesMaxRetries
+	if opts.Backoff != nil {
+		c.backoffPolicy = *opts.Backoff
+		c.entriesMaxRetries = opts.Backoff.MaxRetries
+	}
+	c.rootsCacheTTL = durationOrDefault(opts.RootsCacheTTL, DefaultRootsCacheTTL)
+	c.onRequest = opts.OnRequest
+	c.onResponse = opts.OnResponse
+	c.version = opts.Version
+	switch {
+	case opts.HTTPClient != nil:
+		c.httpClient = opts.HTTPClient
+	case opts.Transport != nil:
+		c.httpClient = &http.Client{
+			Transport: NewTransport(*opts.Transport),
+			Timeout:   durationOrDefault(opts.RequestTimeout, 30*time.Second),
+		}
+	default:
+		transport := &httpclient.Transport{
+			ConnectTimeout:        10 * time.Second,
+			RequestTimeout:        30 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			MaxIdleConnsPerHost:   10,
+			DisableKeepAlives:     false,
+		}
+		c.httpClient = &http.Client{Transport: transport}
+	}
 	return &c
 }
 
+// URI returns the base URI of the log the client talks to.
+func (c *LogClient) URI() string {
+	return c.uri
+}
+
+// Version returns the version of the CT protocol the client speaks to the
+// log.
+func (c *LogClient) Version() ct.Version {
+	return c.version
+}
+
 // Makes a HTTP call to |uri|, and attempts to parse the response as a JSON
 // representation of the structure in |res|.
 // Returns a non-nil |error| if there was a problem.
 func (c *LogClient) fetchAndParse(uri string, res interface{}) error {
-	req, err := http.NewRequest("GET", uri, nil)
+	resp, body, err := c.getAndParse(nil, uri, res)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Keep-Alive", "timeout=15, max=100")
-	resp, err := c.httpClient.Do(req)
-	var body []byte
-	if resp != nil {
-		body, err = ioutil.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			return err
-		}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("got HTTP Status %s: %s", resp.Status, body)
 	}
+	return nil
+}
+
+// Makes a HTTP GET call to |uri|, and attempts to parse the response as a JSON
+// representation of the structure in |res| if the call succeeds with status
+// 200.  The call is abandoned if |ctx| is non-nil and expires first.
+// Returns a non-nil |error| if there was a problem.
+func (c *LogClient) getAndParse(ctx context.Context, uri string, res interface{}) (*http.Response, string, error) {
+	req, err := http.NewRequest("GET", uri, nil)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
-	if err = json.Unmarshal(body, &res); err != nil {
-		return err
+	req.Header.Set("Keep-Alive", "timeout=15, max=100")
+	resp, body, err := c.do(ctx, req)
+	if err != nil {
+		return resp, string(body), err
 	}
-	return nil
+	if resp.StatusCode == 200 {
+		if err = json.Unmarshal(body, &res); err != nil {
+			return resp, string(body), err
+		}
+	}
+	return resp, string(body), nil
 }
 
 // Makes a HTTP POST call to |uri|, and attempts to parse the response as a JSON
-// representation of the structure in |res|.
+// representation of the structure in |res|.  The call is abandoned if |ctx| is
+// non-nil and expires first.
 // Returns a non-nil |error| if there was a problem.
-func (c *LogClient) postAndParse(uri string, req interface{}, res interface{}) (*http.Response, string, error) {
+func (c *LogClient) postAndParse(ctx context.Context, uri string, req interface{}, res interface{}) (*http.Response, string, error) {
 	postBody, err := json.Marshal(req)
 	if err != nil {
 		return nil, "", err
@@ -157,14 +295,7 @@ func (c *LogClient) postAndParse(uri string, req interface{}, res interface{}) (
 	}
 	httpReq.Header.Set("Keep-Alive", "timeout=15, max=100")
 	httpReq.Header.Set("Content-Type", "application/json")
-	resp, err := c.httpClient.Do(httpReq)
-	// Read all of the body, if there is one, so that the http.Client can do
-	// Keep-Alive:
-	var body []byte
-	if resp != nil {
-		body, err = ioutil.ReadAll(resp.Body)
-		resp.Body.Close()
-	}
+	resp, body, err := c.do(ctx, httpReq)
 	if err != nil {
 		return resp, string(body), err
 	}
@@ -179,6 +310,49 @@ func (c *LogClient) postAndParse(uri string, req interface{}, res interface{}) (
 	return resp, string(body), nil
 }
 
+// Makes the HTTP request |req|, abandoning it if |ctx| is non-nil and expires
+// first, and reads the whole of the response body.  The client's hooks are
+// called around the request.
+func (c *LogClient) do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	hookCtx := ctx
+	if hookCtx == nil {
+		hookCtx = context.Background()
+	}
+	info := RequestInfo{
+		Method:     req.Method,
+		Entrypoint: c.entrypoint(req.URL),
+		URI:        req.URL.String(),
+	}
+	if c.onRequest != nil {
+		c.onRequest(hookCtx, info)
+	}
+	start := time.Now()
+
+	var resp *http.Response
+	var err error
+	if ctx != nil {
+		resp, err = ctxhttp.Do(ctx, c.httpClient, req)
+	} else {
+		resp, err = c.httpClient.Do(req)
+	}
+	// Read all of the body, if there is one, so that the http.Client can do
+	// Keep-Alive:
+	var body []byte
+	if resp != nil {
+		body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	if c.onResponse != nil {
+		rinfo := ResponseInfo{RequestInfo: info, Latency: time.Since(start), Err: err}
+		if resp != nil {
+			rinfo.StatusCode = resp.StatusCode
+		}
+		c.onResponse(hookCtx, rinfo)
+	}
+	return resp, body, err
+}
+
 func backoffForRetry(ctx context.Context, d time.Duration) error {
 	backoffTimer := time.NewTimer(d)
 	if ctx != nil {
@@ -193,97 +367,165 @@ func backoffForRetry(ctx context.Context, d time.Duration) error {
 	return nil
 }
 
+// Makes a HTTP POST call to |uri| in the same way as postAndParse, retrying
+// according to the client's BackoffPolicy until the log responds with status
+// 200, it responds with a status that isn't worth retrying, or |ctx| expires.
+func (c *LogClient) postWithRetry(ctx context.Context, uri string, req interface{}, res interface{}) (*ResponseMetadata, error) {
+	md := &ResponseMetadata{}
+	for {
+		httpResp, errorBody, err := c.postAndParse(ctx, uri, req, res)
+		if err != nil {
+			if ctx != nil && ctx.Err() != nil {
+				return md, ctx.Err()
+			}
+		} else {
+			md.StatusCode = httpResp.StatusCode
+			if httpResp.StatusCode == 200 {
+				return md, nil
+			}
+			err = fmt.Errorf("got HTTP Status %s: %s", httpResp.Status, errorBody)
+			if !isRetryableStatus(httpResp.StatusCode) {
+				return md, err
+			}
+		}
+		if err := c.backoff(ctx, c.backoffPolicy.MaxRetries, md, httpResp, err); err != nil {
+			return md, err
+		}
+	}
+}
+
 // Attempts to add |chain| to the log, using the api end-point specified by
-// |path|. If provided context expires before submission is complete an
-// error will be returned.
-func (c *LogClient) addChainWithRetry(ctx context.Context, path string, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+// |path|, retrying according to the client's BackoffPolicy. If provided
+// context expires before submission is complete an error will be returned.
+func (c *LogClient) addChainWithRetry(ctx context.Context, path string, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, *ResponseMetadata, error) {
 	var resp addChainResponse
 	var req addChainRequest
 	for _, link := range chain {
 		req.Chain = append(req.Chain, base64.StdEncoding.EncodeToString(link))
 	}
-	httpStatus := "Unknown"
-	backoffSeconds := 0
-	done := false
-	for !done {
-		if backoffSeconds > 0 {
-			log.Printf("Got %s, backing-off %d seconds", httpStatus, backoffSeconds)
-		}
-		err := backoffForRetry(ctx, time.Second*time.Duration(backoffSeconds))
-		if err != nil {
-			return nil, err
-		}
-		if backoffSeconds > 0 {
-			backoffSeconds = 0
-		}
-		httpResp, errorBody, err := c.postAndParse(c.uri+path, &req, &resp)
-		if err != nil {
-			backoffSeconds = 10
-			continue
-		}
-		switch {
-		case httpResp.StatusCode == 200:
-			done = true
-		case httpResp.StatusCode == 408:
-			// request timeout, retry immediately
-		case httpResp.StatusCode == 503:
-			// Retry
-			backoffSeconds = 10
-			if retryAfter := httpResp.Header.Get("Retry-After"); retryAfter != "" {
-				if seconds, err := strconv.Atoi(retryAfter); err == nil {
-					backoffSeconds = seconds
-				}
-			}
-		default:
-			return nil, fmt.Errorf("got HTTP Status %s: %s", httpResp.Status, errorBody)
-		}
-		httpStatus = httpResp.Status
+	md, err := c.postWithRetry(ctx, c.uri+path, &req, &resp)
+	if err != nil {
+		return nil, md, err
 	}
 
 	rawLogID, err := base64.StdEncoding.DecodeString(resp.ID)
 	if err != nil {
-		return nil, err
+		return nil, md, err
 	}
 	rawSignature, err := base64.StdEncoding.DecodeString(resp.Signature)
 	if err != nil {
-		return nil, err
+		return nil, md, err
 	}
 	ds, err := ct.UnmarshalDigitallySigned(bytes.NewReader(rawSignature))
 	if err != nil {
-		return nil, err
+		return nil, md, err
 	}
 	var logID ct.SHA256Hash
 	copy(logID[:], rawLogID)
-	return &ct.SignedCertificateTimestamp{
+	sct := &ct.SignedCertificateTimestamp{
 		SCTVersion: resp.SCTVersion,
 		LogID:      logID,
 		Timestamp:  resp.Timestamp,
 		Extensions: ct.CTExtensions(resp.Extensions),
-		Signature:  *ds}, nil
+		Signature:  *ds}
+	if c.verifier != nil {
+		if err := c.verifySCT(sct, path, chain); err != nil {
+			return nil, md, VerificationError{SCT: sct, Err: err}
+		}
+	}
+	return sct, md, nil
+}
+
+// verifySCT checks the signature of |sct|, which the log returned for |chain|
+// when it was submitted to the api end-point specified by |path|.
+func (c *LogClient) verifySCT(sct *ct.SignedCertificateTimestamp, path string, chain []ct.ASN1Cert) error {
+	if len(chain) == 0 {
+		return errors.New("empty chain")
+	}
+	entry := ct.LogEntry{
+		Leaf: ct.MerkleTreeLeaf{
+			Version:  ct.V1,
+			LeafType: ct.TimestampedEntryLeafType,
+			TimestampedEntry: ct.TimestampedEntry{
+				Timestamp:  sct.Timestamp,
+				Extensions: sct.Extensions,
+			},
+		},
+	}
+	te := &entry.Leaf.TimestampedEntry
+	if path == AddPreChainPath {
+		if len(chain) < 2 {
+			return errors.New("precertificate chain has no issuer")
+		}
+		precert, err := NewPreCert(chain[0], chain[1])
+		if err != nil {
+			return err
+		}
+		te.EntryType = ct.PrecertLogEntryType
+		te.PrecertEntry = *precert
+	} else {
+		te.EntryType = ct.X509LogEntryType
+		te.X509Entry = chain[0]
+	}
+	return c.verifier.VerifySCTSignature(*sct, entry)
 }
 
 // AddChain adds the (DER represented) X509 |chain| to the log.
 func (c *LogClient) AddChain(chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
-	return c.addChainWithRetry(nil, AddChainPath, chain)
+	sct, _, err := c.addChainWithRetry(nil, AddChainPath, chain)
+	return sct, err
 }
 
 // AddPreChain adds the (DER represented) Precertificate |chain| to the log.
 func (c *LogClient) AddPreChain(chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
-	return c.addChainWithRetry(nil, AddPreChainPath, chain)
+	sct, _, err := c.addChainWithRetry(nil, AddPreChainPath, chain)
+	return sct, err
 }
 
 // AddChainWithContext adds the (DER represented) X509 |chain| to the log and
 // fails if the provided context expires before the chain is submitted.
 func (c *LogClient) AddChainWithContext(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	sct, _, err := c.addChainWithRetry(ctx, AddChainPath, chain)
+	return sct, err
+}
+
+// AddPreChainWithContext adds the (DER represented) Precertificate |chain|
+// to the log and fails if the provided context expires before the chain is
+// submitted.
+func (c *LogClient) AddPreChainWithContext(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	sct, _, err := c.addChainWithRetry(ctx, AddPreChainPath, chain)
+	return sct, err
+}
+
+// AddChainWithMetadata is like AddChainWithContext, but also returns how the
+// log's response was obtained, e.g. how many times the submission had to be
+// retried.  The metadata is returned even if the submission fails.
+func (c *LogClient) AddChainWithMetadata(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, *ResponseMetadata, error) {
 	return c.addChainWithRetry(ctx, AddChainPath, chain)
 }
 
+// AddPreChainWithMetadata is the add-pre-chain equivalent of
+// AddChainWithMetadata.
+func (c *LogClient) AddPreChainWithMetadata(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, *ResponseMetadata, error) {
+	return c.addChainWithRetry(ctx, AddPreChainPath, chain)
+}
+
 // GetSTH retrieves the current STH from the log.
 // Returns a populated SignedTreeHead, or a non-nil error.
 func (c *LogClient) GetSTH() (sth *ct.SignedTreeHead, err error) {
+	return c.GetSTHWithContext(nil)
+}
+
+// GetSTHWithContext retrieves the current STH from the log, and fails if the
+// provided context expires first.  The STH's signature isn't verified.
+func (c *LogClient) GetSTHWithContext(ctx context.Context) (sth *ct.SignedTreeHead, err error) {
 	var resp getSTHResponse
-	if err = c.fetchAndParse(c.uri+GetSTHPath, &resp); err != nil {
-		return
+	httpResp, body, err := c.getAndParse(ctx, c.uri+GetSTHPath, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != 200 {
+		return nil, fmt.Errorf("got HTTP Status %s: %s", httpResp.Status, body)
 	}
 	sth = &ct.SignedTreeHead{
 		TreeSize:  resp.TreeSize,
@@ -323,19 +565,35 @@ func (c *LogClient) GetEntries(start, end int64) ([]ct.LogEntry, error) {
 		return nil, errors.New("start should be <= end")
 	}
 	var resp getEntriesResponse
-	err := c.fetchAndParse(fmt.Sprintf("%s%s?start=%d&end=%d", c.uri, GetEntriesPath, start, end), &resp)
+	err := c.fetchAndParse(c.getEntriesURI(start, end), &resp)
 	if err != nil {
 		return nil, err
 	}
+	return parseEntries(start, &resp)
+}
+
+func (c *LogClient) getEntriesURI(start, end int64) string {
+	return fmt.Sprintf("%s%s?start=%d&end=%d", c.uri, GetEntriesPath, start, end)
+}
+
+// parseEntries parses the entries in a get-entries response, the first of
+// which is the entry at index |start|.
+func parseEntries(start int64, resp *getEntriesResponse) ([]ct.LogEntry, error) {
 	entries := make([]ct.LogEntry, len(resp.Entries))
 	for index, entry := range resp.Entries {
 		leafBytes, err := base64.StdEncoding.DecodeString(entry.LeafInput)
+		if err != nil {
+			return nil, err
+		}
 		leaf, err := ct.ReadMerkleTreeLeaf(bytes.NewBuffer(leafBytes))
 		if err != nil {
 			return nil, err
 		}
 		entries[index].Leaf = *leaf
 		chainBytes, err := base64.StdEncoding.DecodeString(entry.ExtraData)
+		if err != nil {
+			return nil, err
+		}
 
 		var chain []ct.ASN1Cert
 		switch leaf.TimestampedEntry.EntryType {
@@ -0,0 +1,508 @@
+// ctclient talks to a CT log from the command line, to debug logs: it makes
+// one request of the log's API, verifies the response with the log's public
+// key where it can, and prints it, as text or JSON.
+//
+// Usage: ctclient --log_uri=URI [--public_key=FILE] [flags] <command>, where
+// command is one of sth, consistency, inclusion, get-entries, get-roots,
+// add-chain and add-pre-chain.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/keys"
+	"github.com/google/certificate-transparency/go/merkle"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+var logURI = flag.String("log_uri", "", "CT log base URI")
+var pubKey = flag.String("public_key", "", "File containing the log's public key in PEM, DER or base64 format, to verify its responses with")
+var output = flag.String("output", "text", "How to print responses: text or json")
+var timeout = flag.Duration("timeout", time.Minute, "Time allowed for the command's requests")
+var first = flag.Uint64("first", 0, "consistency: size of the first tree")
+var firstHash = flag.String("first_hash", "", "consistency: base64 root hash of the first tree, to verify the proof with")
+var second = flag.Uint64("second", 0, "consistency: size of the second tree; the tree of the log's current STH if zero")
+var secondHash = flag.String("second_hash", "", "consistency: base64 root hash of the second tree, if --second is set")
+var index = flag.Int64("index", -1, "inclusion: index of the entry to prove the inclusion of, which is fetched")
+var leafHash = flag.String("leaf_hash", "", "inclusion: base64 Merkle leaf hash of the entry to prove the inclusion of, instead of --index")
+var treeSize = flag.Uint64("tree_size", 0, "inclusion: size of the tree to prove inclusion in; the tree of the log's current STH if zero")
+var rootHash = flag.String("root_hash", "", "inclusion: base64 root hash of the tree, if --tree_size is set")
+var start = flag.Int64("start", 0, "get-entries: index of the first entry to get")
+var end = flag.Int64("end", 0, "get-entries: index of the last entry to get")
+var chainFile = flag.String("chain", "", "add-chain, add-pre-chain: PEM file holding the chain to submit, starting with the certificate or precertificate")
+
+const timeFormat = "2006-01-02 15:04:05.000 MST"
+
+// result is the outcome of a command, printed as text or encoded as JSON.
+type result interface {
+	text() string
+}
+
+// verified describes whether a response was verified, in text.
+func verified(ok bool) string {
+	if ok {
+		return "verified"
+	}
+	return "NOT verified"
+}
+
+func msTime(ms uint64) string {
+	return time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC().Format(timeFormat)
+}
+
+func b64(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+type sthResult struct {
+	TreeSize          uint64 `json:"tree_size"`
+	Timestamp         uint64 `json:"timestamp"`
+	RootHash          []byte `json:"sha256_root_hash"`
+	SignatureVerified bool   `json:"signature_verified"`
+}
+
+func newSTHResult(sth *ct.SignedTreeHead, ok bool) *sthResult {
+	return &sthResult{TreeSize: sth.TreeSize, Timestamp: sth.Timestamp, RootHash: sth.SHA256RootHash[:], SignatureVerified: ok}
+}
+
+func (r *sthResult) text() string {
+	return fmt.Sprintf("Tree size: %d\nTimestamp: %s\nRoot hash: %s\nSignature %s\n", r.TreeSize, msTime(r.Timestamp), b64(r.RootHash), verified(r.SignatureVerified))
+}
+
+type proofResult struct {
+	FirstSize  uint64   `json:"first"`
+	SecondSize uint64   `json:"second"`
+	Proof      [][]byte `json:"consistency"`
+	Verified   bool     `json:"verified"`
+}
+
+func (r *proofResult) text() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Consistency proof from tree size %d to %d:\n", r.FirstSize, r.SecondSize)
+	for _, h := range r.Proof {
+		fmt.Fprintf(&b, "  %s\n", b64(h))
+	}
+	fmt.Fprintf(&b, "Proof %s\n", verified(r.Verified))
+	return b.String()
+}
+
+type inclusionResult struct {
+	LeafIndex int64    `json:"leaf_index"`
+	TreeSize  uint64   `json:"tree_size"`
+	LeafHash  []byte   `json:"leaf_hash"`
+	AuditPath [][]byte `json:"audit_path"`
+	Verified  bool     `json:"verified"`
+}
+
+func (r *inclusionResult) text() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Inclusion proof of leaf %s at index %d in tree size %d:\n", b64(r.LeafHash), r.LeafIndex, r.TreeSize)
+	for _, h := range r.AuditPath {
+		fmt.Fprintf(&b, "  %s\n", b64(h))
+	}
+	fmt.Fprintf(&b, "Proof %s\n", verified(r.Verified))
+	return b.String()
+}
+
+type entryResult struct {
+	Index     int64    `json:"index"`
+	Type      string   `json:"type"`
+	Timestamp uint64   `json:"timestamp"`
+	LeafHash  []byte   `json:"leaf_hash"`
+	Subject   string   `json:"subject,omitempty"`
+	DNSNames  []string `json:"dns_names,omitempty"`
+	// The certificate, or precertificate's TBSCertificate, logged.
+	Cert  []byte   `json:"cert"`
+	Chain [][]byte `json:"chain"`
+}
+
+type entriesResult struct {
+	Entries []entryResult `json:"entries"`
+	// The tree size of the STH the entries were verified against, if any.
+	VerifiedTreeSize uint64 `json:"verified_tree_size,omitempty"`
+}
+
+func (r *entriesResult) text() string {
+	var b bytes.Buffer
+	for _, e := range r.Entries {
+		fmt.Fprintf(&b, "%d: %s %s, logged %s, leaf hash %s, %d chain certificates\n", e.Index, e.Type, e.Subject, msTime(e.Timestamp), b64(e.LeafHash), len(e.Chain))
+		if len(e.DNSNames) > 0 {
+			fmt.Fprintf(&b, "  DNS names: %s\n", strings.Join(e.DNSNames, ", "))
+		}
+	}
+	if r.VerifiedTreeSize > 0 {
+		fmt.Fprintf(&b, "Entries verified against the STH of tree size %d\n", r.VerifiedTreeSize)
+	} else {
+		fmt.Fprintf(&b, "Entries %s\n", verified(false))
+	}
+	return b.String()
+}
+
+type rootResult struct {
+	Subject string `json:"subject"`
+	SHA256  []byte `json:"sha256"`
+	Cert    []byte `json:"cert"`
+}
+
+type rootsResult struct {
+	Roots []rootResult `json:"roots"`
+}
+
+func (r *rootsResult) text() string {
+	var b bytes.Buffer
+	for _, root := range r.Roots {
+		fmt.Fprintf(&b, "%x %s\n", root.SHA256, root.Subject)
+	}
+	fmt.Fprintf(&b, "%d roots\n", len(r.Roots))
+	return b.String()
+}
+
+type sctResult struct {
+	Version           int    `json:"sct_version"`
+	LogID             []byte `json:"id"`
+	Timestamp         uint64 `json:"timestamp"`
+	Extensions        []byte `json:"extensions"`
+	Signature         []byte `json:"signature"`
+	SignatureVerified bool   `json:"signature_verified"`
+}
+
+func (r *sctResult) text() string {
+	return fmt.Sprintf("SCT version: %d\nLog ID: %s\nTimestamp: %s\nExtensions: %s\nSignature %s\n", r.Version, b64(r.LogID), msTime(r.Timestamp), b64(r.Extensions), verified(r.SignatureVerified))
+}
+
+// readKey returns the SignatureVerifier for the public key in the PEM file at
+// path, or nil if path is empty.
+func readKey(path string) *ct.SignatureVerifier {
+	if path == "" {
+		return nil
+	}
+	key, err := keys.LoadPublicKey(path)
+	if err != nil {
+		log.Fatalf("failed to read public key: %v", err)
+	}
+	v, err := ct.NewSignatureVerifier(key)
+	if err != nil {
+		log.Fatalf("%s: %v", path, err)
+	}
+	return v
+}
+
+func decodeHash(name, s string) (ct.SHA256Hash, error) {
+	var h ct.SHA256Hash
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return h, fmt.Errorf("--%s: %v", name, err)
+	}
+	if len(b) != sha256.Size {
+		return h, fmt.Errorf("--%s is %d bytes long, want %d", name, len(b), sha256.Size)
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// commands holds the state shared by the commands.
+type commands struct {
+	ctx      context.Context
+	c        *client.LogClient
+	verifier *ct.SignatureVerifier
+}
+
+// getSTH fetches the log's STH, and returns whether its signature verified.
+// A signature which doesn't verify is an error.
+func (cmd *commands) getSTH() (*ct.SignedTreeHead, bool, error) {
+	sth, err := cmd.c.GetSTHWithContext(cmd.ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if cmd.verifier == nil {
+		return sth, false, nil
+	}
+	if err := cmd.verifier.VerifySTHSignature(*sth); err != nil {
+		return nil, false, fmt.Errorf("STH of tree size %d: %v", sth.TreeSize, err)
+	}
+	return sth, true, nil
+}
+
+// tree returns the tree of size size with the base64 root hash hash, or the
+// tree of the log's current, verified, STH if size is zero.  The result
+// reports whether it can be trusted: if not, proofs against it can't be
+// verified.
+func (cmd *commands) tree(size uint64, hash, hashFlag string) (*ct.SignedTreeHead, bool, error) {
+	if size == 0 {
+		return cmd.getSTH()
+	}
+	if hash == "" {
+		return &ct.SignedTreeHead{TreeSize: size}, false, nil
+	}
+	h, err := decodeHash(hashFlag, hash)
+	if err != nil {
+		return nil, false, err
+	}
+	return &ct.SignedTreeHead{TreeSize: size, SHA256RootHash: h}, true, nil
+}
+
+func (cmd *commands) sth() (result, error) {
+	sth, ok, err := cmd.getSTH()
+	if err != nil {
+		return nil, err
+	}
+	return newSTHResult(sth, ok), nil
+}
+
+func (cmd *commands) consistency() (result, error) {
+	if *first == 0 {
+		return nil, errors.New("--first is required")
+	}
+	secondTree, secondOK, err := cmd.tree(*second, *secondHash, "second_hash")
+	if err != nil {
+		return nil, err
+	}
+	if *first > secondTree.TreeSize {
+		return nil, fmt.Errorf("--first %d is larger than the second tree, of size %d", *first, secondTree.TreeSize)
+	}
+	proof, err := cmd.c.GetConsistencyProof(cmd.ctx, *first, secondTree.TreeSize)
+	if err != nil {
+		return nil, err
+	}
+	r := &proofResult{FirstSize: *first, SecondSize: secondTree.TreeSize, Proof: proof}
+	if *firstHash == "" || !secondOK {
+		return r, nil
+	}
+	h, err := decodeHash("first_hash", *firstHash)
+	if err != nil {
+		return nil, err
+	}
+	v := merkle.NewVerifier(merkle.NewSHA256TreeHasher())
+	if err := v.VerifyConsistency(*first, secondTree.TreeSize, h[:], secondTree.SHA256RootHash[:], proof); err != nil {
+		return nil, fmt.Errorf("consistency proof from tree size %d to %d doesn't verify: %v", *first, secondTree.TreeSize, err)
+	}
+	r.Verified = true
+	return r, nil
+}
+
+func (cmd *commands) inclusion() (result, error) {
+	hasher := merkle.NewSHA256TreeHasher()
+	var hash []byte
+	switch {
+	case *leafHash != "" && *index >= 0:
+		return nil, errors.New("only one of --leaf_hash and --index may be set")
+	case *leafHash != "":
+		h, err := decodeHash("leaf_hash", *leafHash)
+		if err != nil {
+			return nil, err
+		}
+		hash = h[:]
+	case *index >= 0:
+		it := cmd.c.Entries(cmd.ctx, *index, *index)
+		if !it.Next() {
+			if err := it.Err(); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("log returned no entry %d", *index)
+		}
+		leaf, err := ct.SerializeMerkleTreeLeaf(it.Entry().Leaf)
+		if err != nil {
+			return nil, err
+		}
+		hash = hasher.HashLeaf(leaf)
+	default:
+		return nil, errors.New("one of --leaf_hash and --index is required")
+	}
+	tree, ok, err := cmd.tree(*treeSize, *rootHash, "root_hash")
+	if err != nil {
+		return nil, err
+	}
+	proof, err := cmd.c.GetProofByHash(cmd.ctx, hash, tree.TreeSize)
+	if err != nil {
+		return nil, err
+	}
+	r := &inclusionResult{LeafIndex: proof.LeafIndex, TreeSize: proof.TreeSize, LeafHash: proof.LeafHash, AuditPath: proof.AuditPath}
+	if *index >= 0 && proof.LeafIndex != *index {
+		return nil, fmt.Errorf("entry %d is at index %d of the tree", *index, proof.LeafIndex)
+	}
+	if !ok {
+		return r, nil
+	}
+	if proof.LeafIndex < 0 {
+		return nil, fmt.Errorf("invalid leaf index %d", proof.LeafIndex)
+	}
+	if err := merkle.NewVerifier(hasher).VerifyInclusion(uint64(proof.LeafIndex), tree.TreeSize, hash, tree.SHA256RootHash[:], proof.AuditPath); err != nil {
+		return nil, fmt.Errorf("inclusion proof doesn't verify: %v", err)
+	}
+	r.Verified = true
+	return r, nil
+}
+
+func (cmd *commands) getEntries() (result, error) {
+	if *start < 0 || *end < *start {
+		return nil, fmt.Errorf("bad range [%d, %d]", *start, *end)
+	}
+	var entries []ct.LogEntry
+	it := cmd.c.Entries(cmd.ctx, *start, *end)
+	for it.Next() {
+		entries = append(entries, *it.Entry())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	r := &entriesResult{}
+	hasher := merkle.NewSHA256TreeHasher()
+	for _, e := range entries {
+		leaf, err := ct.SerializeMerkleTreeLeaf(e.Leaf)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %v", e.Index, err)
+		}
+		er := entryResult{Index: e.Index, Timestamp: e.Leaf.TimestampedEntry.Timestamp, LeafHash: hasher.HashLeaf(leaf)}
+		for _, c := range e.Chain {
+			er.Chain = append(er.Chain, c)
+		}
+		te := &e.Leaf.TimestampedEntry
+		switch te.EntryType {
+		case ct.X509LogEntryType:
+			er.Type, er.Cert = "certificate", te.X509Entry
+			if cert, err := x509.ParseCertificate(te.X509Entry); !x509.IsFatal(err) {
+				er.Subject, er.DNSNames = cert.Subject.CommonName, cert.DNSNames
+			}
+		case ct.PrecertLogEntryType:
+			er.Type, er.Cert = "precertificate", te.PrecertEntry.TBSCertificate
+			if tbs, err := x509.ParseTBSCertificate(te.PrecertEntry.TBSCertificate); !x509.IsFatal(err) {
+				er.Subject, er.DNSNames = tbs.Subject.CommonName, tbs.DNSNames
+			}
+		default:
+			er.Type = te.EntryType.String()
+		}
+		r.Entries = append(r.Entries, er)
+	}
+	if cmd.verifier == nil || len(entries) == 0 {
+		return r, nil
+	}
+	sth, _, err := cmd.getSTH()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.c.VerifyEntries(cmd.ctx, entries, *sth); err != nil {
+		return nil, err
+	}
+	r.VerifiedTreeSize = sth.TreeSize
+	return r, nil
+}
+
+func (cmd *commands) getRoots() (result, error) {
+	roots, err := cmd.c.GetAcceptedRoots(cmd.ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := &rootsResult{}
+	for _, der := range roots {
+		h := sha256.Sum256(der)
+		root := rootResult{SHA256: h[:], Cert: der, Subject: "(unparseable)"}
+		if cert, err := x509.ParseCertificate(der); !x509.IsFatal(err) {
+			root.Subject = cert.Subject.CommonName
+		}
+		r.Roots = append(r.Roots, root)
+	}
+	return r, nil
+}
+
+func (cmd *commands) addChain(precert bool) (result, error) {
+	if *chainFile == "" {
+		return nil, errors.New("--chain is required")
+	}
+	data, err := ioutil.ReadFile(*chainFile)
+	if err != nil {
+		return nil, err
+	}
+	var chain []ct.ASN1Cert
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificates in %s", *chainFile)
+	}
+	// The client verifies the SCT's signature if it has the log's key.
+	var sct *ct.SignedCertificateTimestamp
+	if precert {
+		sct, err = cmd.c.AddPreChainWithContext(cmd.ctx, chain)
+	} else {
+		sct, err = cmd.c.AddChainWithContext(cmd.ctx, chain)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sctResult{
+		Version:           int(sct.SCTVersion),
+		LogID:             sct.LogID[:],
+		Timestamp:         sct.Timestamp,
+		Extensions:        sct.Extensions,
+		Signature:         sct.Signature.Signature,
+		SignatureVerified: cmd.verifier != nil,
+	}, nil
+}
+
+func main() {
+	flag.Parse()
+	if *logURI == "" || flag.NArg() != 1 {
+		log.Fatal("Usage: ctclient --log_uri=URI [--public_key=FILE] [flags] sth|consistency|inclusion|get-entries|get-roots|add-chain|add-pre-chain")
+	}
+	if *output != "text" && *output != "json" {
+		log.Fatalf("Unknown --output %q", *output)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	cmd := &commands{ctx: ctx, verifier: readKey(*pubKey)}
+	cmd.c = client.NewWithOptions(*logURI, client.Options{Verifier: cmd.verifier})
+
+	var r result
+	var err error
+	switch flag.Arg(0) {
+	case "sth":
+		r, err = cmd.sth()
+	case "consistency":
+		r, err = cmd.consistency()
+	case "inclusion":
+		r, err = cmd.inclusion()
+	case "get-entries":
+		r, err = cmd.getEntries()
+	case "get-roots":
+		r, err = cmd.getRoots()
+	case "add-chain":
+		r, err = cmd.addChain(false)
+	case "add-pre-chain":
+		r, err = cmd.addChain(true)
+	default:
+		log.Fatalf("Unknown command %q", flag.Arg(0))
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", flag.Arg(0), err)
+	}
+	if *output == "json" {
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(append(b, '\n'))
+		return
+	}
+	fmt.Print(r.text())
+}
@@ -0,0 +1,287 @@
+package client
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// LogInfo describes one of the logs a MultiLog submits to.
+type LogInfo struct {
+	// Human readable name of the log.
+	Description string
+	// Base URI of the log, as passed to New.
+	URL string
+	// The log's public key.  If non-nil, the signatures of the SCTs the
+	// log returns are verified with it.
+	PublicKey crypto.PublicKey
+	// The log's Maximum Merge Delay, within which it promises to
+	// incorporate the entries it returns SCTs for.
+	MMD time.Duration
+	// Name of the organisation which operates the log, e.g. "Google", as
+	// matched by QuorumRequirements.
+	Operator string
+	// If the log is temporally sharded, the range [NotAfterStart,
+	// NotAfterLimit) of certificate expiry times it accepts.  If both are
+	// zero, the log accepts certificates with any expiry.
+	NotAfterStart, NotAfterLimit time.Time
+}
+
+// Sharded reports whether the log is temporally sharded.
+func (l *LogInfo) Sharded() bool {
+	return !l.NotAfterStart.IsZero() || !l.NotAfterLimit.IsZero()
+}
+
+// AcceptsExpiry reports whether the log accepts certificates which expire at
+// notAfter.
+func (l *LogInfo) AcceptsExpiry(notAfter time.Time) bool {
+	if !l.NotAfterStart.IsZero() && notAfter.Before(l.NotAfterStart) {
+		return false
+	}
+	return l.NotAfterLimit.IsZero() || notAfter.Before(l.NotAfterLimit)
+}
+
+// QuorumRequirement is a requirement for SCTs from a number of logs, which
+// are either operated by one of Operators, or if ExcludeOperators is set,
+// operated by none of them.  A requirement with no Operators is met by SCTs
+// from any log.
+type QuorumRequirement struct {
+	Count            int
+	Operators        []string
+	ExcludeOperators bool
+}
+
+func (r QuorumRequirement) matches(l *LogInfo) bool {
+	if len(r.Operators) == 0 {
+		return true
+	}
+	for _, op := range r.Operators {
+		if op == l.Operator {
+			return !r.ExcludeOperators
+		}
+	}
+	return r.ExcludeOperators
+}
+
+// Quorum is a set of requirements, all of which must be met for a submission
+// to succeed.  Each SCT counts towards at most one requirement, so for
+// example
+//
+//	Quorum{
+//		{Count: 2, Operators: []string{"Google"}},
+//		{Count: 1, Operators: []string{"Google"}, ExcludeOperators: true},
+//	}
+//
+// requires SCTs from 2 logs operated by Google and 1 log which isn't.
+type Quorum []QuorumRequirement
+
+// SatisfiedBy reports whether SCTs from each of logs satisfy the quorum.
+func (q Quorum) SatisfiedBy(logs []*LogInfo) bool {
+	// Assign each log to a slot of a requirement it matches, finding an
+	// augmenting path whenever a log can't take a free slot directly.
+	var slots []QuorumRequirement
+	for _, r := range q {
+		for i := 0; i < r.Count; i++ {
+			slots = append(slots, r)
+		}
+	}
+	owner := make([]int, len(slots)) // Index into logs+1, or 0 if free.
+	var assign func(l int, seen []bool) bool
+	assign = func(l int, seen []bool) bool {
+		for s, r := range slots {
+			if seen[s] || !r.matches(logs[l]) {
+				continue
+			}
+			seen[s] = true
+			if owner[s] == 0 || assign(owner[s]-1, seen) {
+				owner[s] = l + 1
+				return true
+			}
+		}
+		return false
+	}
+	filled := 0
+	for l := range logs {
+		if assign(l, make([]bool, len(slots))) {
+			filled++
+		}
+	}
+	return filled == len(slots)
+}
+
+// MultiLogOptions holds configuration for a MultiLog.
+type MultiLogOptions struct {
+	// Deadline for each log's submission.  Zero means the logs have until
+	// the context passed to AddChain expires.
+	Timeout time.Duration
+	// SCTs which must be obtained for a submission to succeed.  If nil,
+	// an SCT is required from every log.
+	Quorum Quorum
+	// Check the logs' accepted roots before submitting, so that logs
+	// which are bound to reject a chain aren't sent it.  They fail with
+	// ErrRootNotAccepted instead.  If a log's roots can't be fetched, the
+	// chain is submitted to it anyway.
+	CheckRoots bool
+	// Options for the LogClient used for each log.  The Verifier is
+	// replaced by one for the log's PublicKey, if it has one.
+	ClientOptions Options
+}
+
+// LoggedSCT is an SCT together with the log which issued it.
+type LoggedSCT struct {
+	Log *LogInfo
+	SCT *ct.SignedCertificateTimestamp
+}
+
+// QuorumError is returned by MultiLog when the submissions which succeeded
+// don't satisfy its Quorum.
+type QuorumError struct {
+	SCTs   []LoggedSCT
+	Errors map[string]error // By log URL.
+}
+
+func (e QuorumError) Error() string {
+	var errs []string
+	for url, err := range e.Errors {
+		errs = append(errs, fmt.Sprintf("%s: %v", url, err))
+	}
+	return fmt.Sprintf("quorum not satisfied by %d SCTs: %s", len(e.SCTs), strings.Join(errs, "; "))
+}
+
+// MultiLog submits chains to a set of logs in parallel.  If any of the logs
+// are temporally sharded, each chain is only submitted to the shards which
+// accept its leaf's expiry.
+type MultiLog struct {
+	logs    []*LogInfo
+	clients []*LogClient
+	opts    MultiLogOptions
+	sharded bool
+}
+
+// NewMultiLog returns a MultiLog which submits to logs.
+func NewMultiLog(logs []LogInfo, opts MultiLogOptions) (*MultiLog, error) {
+	m := &MultiLog{opts: opts}
+	for i := range logs {
+		l := logs[i]
+		copts := opts.ClientOptions
+		if l.PublicKey != nil {
+			v, err := ct.NewSignatureVerifier(l.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", l.URL, err)
+			}
+			copts.Verifier = v
+		}
+		m.logs = append(m.logs, &l)
+		m.clients = append(m.clients, NewWithOptions(l.URL, copts))
+		m.sharded = m.sharded || l.Sharded()
+	}
+	return m, nil
+}
+
+// AddChain submits the (DER represented) X509 |chain| to each log which
+// accepts its leaf, returning the SCTs obtained as soon as they satisfy the
+// quorum, at which point the outstanding submissions are abandoned.  If the
+// quorum can't be satisfied once every submission has finished, a
+// QuorumError is returned, and if no log accepts the leaf's expiry,
+// ErrNoAcceptingShard is.
+func (m *MultiLog) AddChain(ctx context.Context, chain []ct.ASN1Cert) ([]LoggedSCT, error) {
+	return m.addChain(ctx, AddChainPath, chain)
+}
+
+// AddPreChain is the add-pre-chain equivalent of AddChain.
+func (m *MultiLog) AddPreChain(ctx context.Context, chain []ct.ASN1Cert) ([]LoggedSCT, error) {
+	return m.addChain(ctx, AddPreChainPath, chain)
+}
+
+type logResult struct {
+	log *LogInfo
+	sct *ct.SignedCertificateTimestamp
+	err error
+}
+
+func (m *MultiLog) satisfied(scts []LoggedSCT, logs int) bool {
+	if m.opts.Quorum == nil {
+		return len(scts) == logs
+	}
+	infos := make([]*LogInfo, len(scts))
+	for i, s := range scts {
+		infos[i] = s.Log
+	}
+	return m.opts.Quorum.SatisfiedBy(infos)
+}
+
+// selectLogs returns the indices of the logs to submit chain to.
+func (m *MultiLog) selectLogs(chain []ct.ASN1Cert) ([]int, error) {
+	var selected []int
+	if !m.sharded {
+		for i := range m.logs {
+			selected = append(selected, i)
+		}
+		return selected, nil
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("empty chain")
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse leaf to select log shards: %v", err)
+	}
+	for i, l := range m.logs {
+		if l.AcceptsExpiry(leaf.NotAfter) {
+			selected = append(selected, i)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, ErrNoAcceptingShard
+	}
+	return selected, nil
+}
+
+func (m *MultiLog) addChain(ctx context.Context, path string, chain []ct.ASN1Cert) ([]LoggedSCT, error) {
+	selected, err := m.selectLogs(chain)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan logResult, len(selected))
+	for _, i := range selected {
+		go func(l *LogInfo, c *LogClient) {
+			lctx := ctx
+			if m.opts.Timeout > 0 {
+				var lcancel context.CancelFunc
+				lctx, lcancel = context.WithTimeout(ctx, m.opts.Timeout)
+				defer lcancel()
+			}
+			if m.opts.CheckRoots {
+				if ok, err := c.WillAccept(lctx, chain); err == nil && !ok {
+					results <- logResult{log: l, err: ErrRootNotAccepted}
+					return
+				}
+			}
+			sct, _, err := c.addChainWithRetry(lctx, path, chain)
+			results <- logResult{log: l, sct: sct, err: err}
+		}(m.logs[i], m.clients[i])
+	}
+
+	var scts []LoggedSCT
+	errs := make(map[string]error)
+	for range selected {
+		r := <-results
+		if r.err != nil {
+			errs[r.log.URL] = r.err
+			continue
+		}
+		scts = append(scts, LoggedSCT{Log: r.log, SCT: r.sct})
+		if m.satisfied(scts, len(selected)) {
+			return scts, nil
+		}
+	}
+	return nil, QuorumError{SCTs: scts, Errors: errs}
+}
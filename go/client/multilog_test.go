@@ -0,0 +1,137 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"golang.org/x/net/context"
+)
+
+var googleQuorum = Quorum{
+	{Count: 2, Operators: []string{"Google"}},
+	{Count: 1, Operators: []string{"Google"}, ExcludeOperators: true},
+}
+
+func TestQuorumSatisfiedBy(t *testing.T) {
+	g1, g2, g3 := &LogInfo{Operator: "Google"}, &LogInfo{Operator: "Google"}, &LogInfo{Operator: "Google"}
+	o1, o2 := &LogInfo{Operator: "Other"}, &LogInfo{Operator: "Another"}
+	tests := []struct {
+		quorum Quorum
+		logs   []*LogInfo
+		want   bool
+	}{
+		{googleQuorum, []*LogInfo{g1, g2, o1}, true},
+		{googleQuorum, []*LogInfo{o1, g1, o2, g2}, true},
+		{googleQuorum, []*LogInfo{g1, g2, g3}, false},
+		{googleQuorum, []*LogInfo{g1, o1, o2}, false},
+		{googleQuorum, nil, false},
+		// A log which could meet either requirement must be used for
+		// the one only it can meet.
+		{Quorum{{Count: 1}, {Count: 1, Operators: []string{"Other"}}}, []*LogInfo{o1, g1}, true},
+		{Quorum{{Count: 2}, {Count: 1, Operators: []string{"Other"}}}, []*LogInfo{o1, g1}, false},
+		{Quorum{}, nil, true},
+	}
+	for i, test := range tests {
+		if got := test.quorum.SatisfiedBy(test.logs); got != test.want {
+			t.Errorf("#%d: SatisfiedBy()=%t, want %t", i, got, test.want)
+		}
+	}
+}
+
+// fakeLog returns a server which answers add-chain with a 400 if fail is set,
+// or otherwise once hang is closed if it is non-nil.
+func fakeLog(hang <-chan struct{}, fail bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hang != nil {
+			<-hang
+		}
+		if fail {
+			http.Error(w, "bad chain", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(validAddChainResponse))
+	}))
+}
+
+func TestMultiLogAddChain(t *testing.T) {
+	hang := make(chan struct{})
+	fast, slow, failing := fakeLog(nil, false), fakeLog(hang, false), fakeLog(nil, true)
+	defer fast.Close()
+	defer slow.Close()
+	defer failing.Close()
+	// Runs before the servers are closed.
+	defer close(hang)
+
+	tests := []struct {
+		logs     []LogInfo
+		quorum   Quorum
+		wantSCTs int
+		wantErrs int // If the quorum isn't satisfied.
+	}{
+		{
+			logs: []LogInfo{
+				{URL: fast.URL, Operator: "Google"},
+				{URL: slow.URL, Operator: "Other"},
+				{URL: fast.URL, Operator: "Google"},
+				{URL: fast.URL, Operator: "Other"},
+			},
+			quorum:   googleQuorum,
+			wantSCTs: 3,
+		},
+		{
+			logs: []LogInfo{
+				{URL: fast.URL, Operator: "Google"},
+				{URL: fast.URL, Operator: "Google"},
+				{URL: slow.URL, Operator: "Other"},
+				{URL: failing.URL, Operator: "Other"},
+			},
+			quorum:   googleQuorum,
+			wantSCTs: 2,
+			wantErrs: 2,
+		},
+		{
+			logs:     []LogInfo{{URL: fast.URL}, {URL: fast.URL}},
+			wantSCTs: 2,
+		},
+		{
+			logs:     []LogInfo{{URL: fast.URL}, {URL: failing.URL}},
+			wantSCTs: 1,
+			wantErrs: 1,
+		},
+	}
+	for i, test := range tests {
+		m, err := NewMultiLog(test.logs, MultiLogOptions{
+			Timeout: 100 * time.Millisecond,
+			Quorum:  test.quorum,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		scts, err := m.AddChain(context.Background(), []ct.ASN1Cert{[]byte("cert")})
+		if test.wantErrs == 0 {
+			if err != nil {
+				t.Errorf("#%d: AddChain()=_,%v, want nil error", i, err)
+			}
+			if len(scts) != test.wantSCTs {
+				t.Errorf("#%d: got %d SCTs, want %d", i, len(scts), test.wantSCTs)
+			}
+			for _, s := range scts {
+				if s.Log.URL == slow.URL || s.SCT == nil {
+					t.Errorf("#%d: got unexpected SCT %+v", i, s)
+				}
+			}
+			continue
+		}
+		qerr, ok := err.(QuorumError)
+		if !ok {
+			t.Errorf("#%d: AddChain()=_,%v, want QuorumError", i, err)
+			continue
+		}
+		if len(qerr.SCTs) != test.wantSCTs || len(qerr.Errors) != test.wantErrs {
+			t.Errorf("#%d: got QuorumError with %d SCTs and %d errors, want %d and %d", i, len(qerr.SCTs), len(qerr.Errors), test.wantSCTs, test.wantErrs)
+		}
+	}
+}
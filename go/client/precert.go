@@ -0,0 +1,68 @@
+package client
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// PrecertificateTBS returns the TBSCertificate of the DER encoded precertificate
+// with the poison extension removed, which is what the SCTs for the
+// precertificate sign (RFC6962 section 3.2).
+func PrecertificateTBS(der []byte) ([]byte, error) {
+	cert, err := x509.ParseCertificate(der)
+	if x509.IsFatal(err) {
+		return nil, err
+	}
+	if !cert.IsPrecertificate() {
+		return nil, errors.New("certificate has no CT poison extension, so is not a precertificate")
+	}
+	return x509.BuildPrecertTBS(cert.RawTBSCertificate)
+}
+
+// CreatePrecertificate creates a precertificate for the certificate which
+// x509.CreateCertificate would create from the same arguments, i.e. one that
+// is identical but for the critical poison extension (RFC6962 section 3.1).
+// The template isn't modified.  The DER of the precertificate is returned,
+// ready to be submitted with AddPreChain followed by issuer.
+//
+// Precertificates signed by a Precertificate Signing Certificate aren't
+// supported, so issuer should be the certificate's actual issuer.
+func CreatePrecertificate(rand io.Reader, template, issuer *x509.Certificate, pub, priv interface{}) ([]byte, error) {
+	for _, e := range template.ExtraExtensions {
+		if e.Id.Equal(x509.OIDExtensionCTPoison) {
+			return nil, errors.New("template already has a CT poison extension")
+		}
+	}
+	tmpl := *template
+	tmpl.ExtraExtensions = make([]pkix.Extension, len(template.ExtraExtensions), len(template.ExtraExtensions)+1)
+	copy(tmpl.ExtraExtensions, template.ExtraExtensions)
+	tmpl.ExtraExtensions = append(tmpl.ExtraExtensions, x509.NewPoisonExtension())
+	return x509.CreateCertificate(rand, &tmpl, issuer, pub, priv)
+}
+
+// NewPreCert returns the PreCert which SCTs for the DER encoded precertificate
+// issued by issuer sign, so that they can be verified against it.
+func NewPreCert(precert, issuer ct.ASN1Cert) (*ct.PreCert, error) {
+	iss, err := x509.ParseCertificate(issuer)
+	if err != nil {
+		return nil, err
+	}
+	for _, eku := range iss.UnknownExtKeyUsage {
+		if eku.Equal(x509.OIDExtKeyUsageCTPrecertSigning) {
+			return nil, errors.New("precertificates issued by a Precertificate Signing Certificate are not supported")
+		}
+	}
+	tbs, err := PrecertificateTBS(precert)
+	if err != nil {
+		return nil, err
+	}
+	return &ct.PreCert{
+		IssuerKeyHash:  sha256.Sum256(iss.RawSubjectPublicKeyInfo),
+		TBSCertificate: tbs,
+	}, nil
+}
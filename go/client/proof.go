@@ -0,0 +1,257 @@
+package client
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/merkle"
+	"golang.org/x/net/context"
+)
+
+// ConsistencyProof is a proof that one of a log's tree heads is an append-only
+// extension of another, as checked by VerifyConsistency.
+type ConsistencyProof struct {
+	FirstSize, SecondSize uint64
+	Proof                 [][]byte
+}
+
+// ConsistencyError is returned by VerifyConsistency when the log's proof
+// doesn't show that its tree heads are consistent, which means the log has
+// misbehaved.  Errors fetching the proof are returned as they are.
+type ConsistencyError struct {
+	First, Second ct.SignedTreeHead
+	Proof         [][]byte
+	Err           error
+}
+
+func (e ConsistencyError) Error() string {
+	return fmt.Sprintf("tree heads of size %d and %d are not consistent: %v", e.First.TreeSize, e.Second.TreeSize, e.Err)
+}
+
+// HTTPError is returned when a log answers a request for a proof with a
+// status other than 200, e.g. because it has no entry with the hash asked
+// for.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e HTTPError) Error() string {
+	return fmt.Sprintf("got HTTP Status %s: %s", e.Status, e.Body)
+}
+
+// GetConsistencyProof fetches a proof that the tree of size |second| is an
+// append-only extension of the tree of size |first| (see section 4.4).
+func (c *LogClient) GetConsistencyProof(ctx context.Context, first, second uint64) ([][]byte, error) {
+	var resp getConsistencyProofResponse
+	uri := fmt.Sprintf("%s%s?first=%d&second=%d", c.uri, GetSTHConsistencyPath, first, second)
+	httpResp, body, err := c.getAndParse(ctx, uri, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != 200 {
+		return nil, HTTPError{StatusCode: httpResp.StatusCode, Status: httpResp.Status, Body: body}
+	}
+	return decodeHashes(resp.Consistency)
+}
+
+// decodeHashes decodes the base64 encoded hashes of a proof.
+func decodeHashes(encoded []string) ([][]byte, error) {
+	hashes := make([][]byte, len(encoded))
+	for i, e := range encoded {
+		h, err := base64.StdEncoding.DecodeString(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 encoding in proof: %v", err)
+		}
+		hashes[i] = h
+	}
+	return hashes, nil
+}
+
+// ProofSource is something proofs can be fetched from, such as a LogClient,
+// so that clients for the other interfaces logs expose can share their
+// verification.
+type ProofSource interface {
+	GetConsistencyProof(ctx context.Context, first, second uint64) ([][]byte, error)
+	GetProofByHash(ctx context.Context, hash []byte, treeSize uint64) (*InclusionProof, error)
+}
+
+// VerifyConsistency fetches a consistency proof between the tree heads
+// |first| and |second|, in either order, and verifies it against their root
+// hashes.  It returns the verified proof, or a ConsistencyError if the proof
+// doesn't verify.  The signatures on the tree heads aren't checked.
+func (c *LogClient) VerifyConsistency(ctx context.Context, first, second ct.SignedTreeHead) (*ConsistencyProof, error) {
+	return VerifyConsistencyWith(ctx, c, first, second)
+}
+
+// VerifyConsistencyWith is like LogClient.VerifyConsistency, but fetches the
+// proof from |src|.
+func VerifyConsistencyWith(ctx context.Context, src ProofSource, first, second ct.SignedTreeHead) (*ConsistencyProof, error) {
+	if first.TreeSize > second.TreeSize {
+		first, second = second, first
+	}
+	var proof [][]byte
+	// No proof is needed if either tree is empty, or they are the same size.
+	if first.TreeSize > 0 && first.TreeSize < second.TreeSize {
+		var err error
+		if proof, err = src.GetConsistencyProof(ctx, first.TreeSize, second.TreeSize); err != nil {
+			return nil, err
+		}
+	}
+	v := merkle.NewVerifier(merkle.NewSHA256TreeHasher())
+	err := v.VerifyConsistency(first.TreeSize, second.TreeSize, first.SHA256RootHash[:], second.SHA256RootHash[:], proof)
+	if err != nil {
+		return nil, ConsistencyError{First: first, Second: second, Proof: proof, Err: err}
+	}
+	return &ConsistencyProof{FirstSize: first.TreeSize, SecondSize: second.TreeSize, Proof: proof}, nil
+}
+
+// InclusionProof is a proof that the leaf with hash LeafHash is at index
+// LeafIndex of the log's tree of size TreeSize.
+type InclusionProof struct {
+	LeafIndex int64
+	TreeSize  uint64
+	LeafHash  []byte
+	AuditPath [][]byte
+}
+
+// InclusionError is returned by ProveInclusion when the log's proof doesn't
+// show that the entry is included in the tree head, which means the log has
+// misbehaved.  Errors fetching the proof are returned as they are.
+type InclusionError struct {
+	Proof *InclusionProof
+	STH   ct.SignedTreeHead
+	Err   error
+}
+
+func (e InclusionError) Error() string {
+	return fmt.Sprintf("leaf %d is not included in tree head of size %d: %v", e.Proof.LeafIndex, e.STH.TreeSize, e.Err)
+}
+
+// GetProofByHash fetches a proof that the leaf with hash |hash| is included in
+// the tree of size |treeSize| (see section 4.5).
+func (c *LogClient) GetProofByHash(ctx context.Context, hash []byte, treeSize uint64) (*InclusionProof, error) {
+	var resp getProofByHashResponse
+	uri := fmt.Sprintf("%s%s?hash=%s&tree_size=%d", c.uri, GetProofByHashPath, url.QueryEscape(base64.StdEncoding.EncodeToString(hash)), treeSize)
+	httpResp, body, err := c.getAndParse(ctx, uri, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != 200 {
+		return nil, HTTPError{StatusCode: httpResp.StatusCode, Status: httpResp.Status, Body: body}
+	}
+	path, err := decodeHashes(resp.AuditPath)
+	if err != nil {
+		return nil, err
+	}
+	return &InclusionProof{
+		LeafIndex: resp.LeafIndex,
+		TreeSize:  treeSize,
+		LeafHash:  hash,
+		AuditPath: path,
+	}, nil
+}
+
+// ProveInclusion fetches a proof that |entry| is included in the tree head
+// |sth|, and verifies it against the tree head's root hash.  It returns the
+// verified proof, or an InclusionError if the proof doesn't verify.  The
+// signature on the tree head isn't checked.
+func (c *LogClient) ProveInclusion(ctx context.Context, entry *ct.LogEntry, sth ct.SignedTreeHead) (*InclusionProof, error) {
+	return ProveInclusionWith(ctx, c, entry, sth)
+}
+
+// ProveInclusionWith is like LogClient.ProveInclusion, but fetches the proof
+// from |src|.
+func ProveInclusionWith(ctx context.Context, src ProofSource, entry *ct.LogEntry, sth ct.SignedTreeHead) (*InclusionProof, error) {
+	leaf, err := ct.SerializeMerkleTreeLeaf(entry.Leaf)
+	if err != nil {
+		return nil, err
+	}
+	hasher := merkle.NewSHA256TreeHasher()
+	proof, err := src.GetProofByHash(ctx, hasher.HashLeaf(leaf), sth.TreeSize)
+	if err != nil {
+		return nil, err
+	}
+	if proof.LeafIndex < 0 {
+		return nil, InclusionError{Proof: proof, STH: sth, Err: fmt.Errorf("invalid leaf index %d", proof.LeafIndex)}
+	}
+	v := merkle.NewVerifier(hasher)
+	if err := v.VerifyInclusion(uint64(proof.LeafIndex), sth.TreeSize, proof.LeafHash, sth.SHA256RootHash[:], proof.AuditPath); err != nil {
+		return nil, InclusionError{Proof: proof, STH: sth, Err: err}
+	}
+	return proof, nil
+}
+
+// VerifyEntries checks that |entries|, which must be consecutive, as
+// returned by get-entries, are the entries at their indices in the tree head
+// |sth|, using inclusion proofs of the first and last of them.  The
+// signature on the tree head isn't checked.
+func (c *LogClient) VerifyEntries(ctx context.Context, entries []ct.LogEntry, sth ct.SignedTreeHead) error {
+	return VerifyEntriesWith(ctx, c, entries, sth)
+}
+
+// VerifyEntriesWith is like LogClient.VerifyEntries, but fetches the proofs
+// from |src|.
+func VerifyEntriesWith(ctx context.Context, src ProofSource, entries []ct.LogEntry, sth ct.SignedTreeHead) error {
+	if len(entries) == 0 {
+		return errors.New("no entries")
+	}
+	hasher := merkle.NewSHA256TreeHasher()
+	hashes := make([][]byte, len(entries))
+	for i := range entries {
+		if entries[i].Index != entries[0].Index+int64(i) {
+			return fmt.Errorf("entry %d follows entry %d", entries[i].Index, entries[i-1].Index)
+		}
+		leaf, err := ct.SerializeMerkleTreeLeaf(entries[i].Leaf)
+		if err != nil {
+			return fmt.Errorf("failed to serialize entry %d: %v", entries[i].Index, err)
+		}
+		hashes[i] = hasher.HashLeaf(leaf)
+	}
+	first, last := entries[0].Index, entries[len(entries)-1].Index
+	if first < 0 || uint64(last) >= sth.TreeSize {
+		return fmt.Errorf("entries [%d, %d] aren't in the tree of size %d", first, last, sth.TreeSize)
+	}
+	proof := func(index int64, hash []byte) ([][]byte, error) {
+		p, err := src.GetProofByHash(ctx, hash, sth.TreeSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get inclusion proof of entry %d: %v", index, err)
+		}
+		if p.LeafIndex != index {
+			return nil, fmt.Errorf("entry returned at index %d is at index %d of the tree", index, p.LeafIndex)
+		}
+		return p.AuditPath, nil
+	}
+
+	// The range's first and last leaves need proofs, unless they are at
+	// the edges of the tree.
+	var startProof, endProof [][]byte
+	var err error
+	if first > 0 {
+		if startProof, err = proof(first, hashes[0]); err != nil {
+			return err
+		}
+	}
+	if uint64(last) < sth.TreeSize-1 {
+		if endProof, err = proof(last, hashes[len(hashes)-1]); err != nil {
+			return err
+		}
+	}
+	v, err := merkle.NewVerifier(hasher).NewRangeVerifier(uint64(first), sth.TreeSize, sth.SHA256RootHash[:], startProof)
+	if err != nil {
+		return fmt.Errorf("failed to verify entries [%d, %d]: %v", first, last, err)
+	}
+	for _, h := range hashes {
+		if err := v.AddLeafHash(h); err != nil {
+			return fmt.Errorf("failed to verify entries [%d, %d]: %v", first, last, err)
+		}
+	}
+	if err := v.Finish(endProof); err != nil {
+		return fmt.Errorf("entries [%d, %d] are not those in the tree: %v", first, last, err)
+	}
+	return nil
+}
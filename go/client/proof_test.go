@@ -0,0 +1,235 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/merkle"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/testlog"
+	"golang.org/x/net/context"
+)
+
+// Root hashes of the test trees of size 6 and 8 from the C++ MerkleTree tests,
+// and the consistency proof between them.
+const (
+	root6Hex = "76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef"
+	root8Hex = "5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328"
+)
+
+var proof6To8Hex = []string{
+	"0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a",
+	"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+	"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+}
+
+func testSTH(t *testing.T, size uint64, rootHex string) ct.SignedTreeHead {
+	sth := ct.SignedTreeHead{TreeSize: size}
+	root, err := hex.DecodeString(rootHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(sth.SHA256RootHash[:], root)
+	return sth
+}
+
+// consistencyServer serves get-sth-consistency with proof, counting the
+// requests it gets.
+func consistencyServer(t *testing.T, proof []string, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if r.URL.Path != GetSTHConsistencyPath {
+			t.Errorf("Incorrect URL path: %s", r.URL.Path)
+		}
+		if q := r.URL.Query(); q.Get("first") != "6" || q.Get("second") != "8" {
+			t.Errorf("Incorrect query: %s", r.URL.RawQuery)
+		}
+		if proof == nil {
+			http.Error(w, "no proof", http.StatusInternalServerError)
+			return
+		}
+		var hashes []string
+		for _, h := range proof {
+			b, _ := hex.DecodeString(h)
+			hashes = append(hashes, fmt.Sprintf("%q", base64.StdEncoding.EncodeToString(b)))
+		}
+		fmt.Fprintf(w, `{"consistency":[%s]}`, strings.Join(hashes, ","))
+	}))
+}
+
+func TestVerifyConsistency(t *testing.T) {
+	sth6, sth8 := testSTH(t, 6, root6Hex), testSTH(t, 8, root8Hex)
+	tampered := append([]string{root6Hex}, proof6To8Hex[1:]...)
+	tests := []struct {
+		first, second    ct.SignedTreeHead
+		proof            []string
+		wantRequests     int
+		wantConsistent   bool
+		wantConsistError bool
+	}{
+		{first: sth6, second: sth8, proof: proof6To8Hex, wantRequests: 1, wantConsistent: true},
+		{first: sth8, second: sth6, proof: proof6To8Hex, wantRequests: 1, wantConsistent: true},
+		{first: sth8, second: sth8, wantConsistent: true},
+		{first: ct.SignedTreeHead{}, second: sth8, wantConsistent: true},
+		{first: testSTH(t, 8, root6Hex), second: sth8, wantConsistError: true},
+		{first: sth6, second: sth8, proof: tampered, wantRequests: 1, wantConsistError: true},
+		{first: sth6, second: sth8, proof: proof6To8Hex[:2], wantRequests: 1, wantConsistError: true},
+		{first: sth6, second: sth8, wantRequests: 1},
+	}
+	for i, test := range tests {
+		requests := 0
+		ts := consistencyServer(t, test.proof, &requests)
+		proof, err := New(ts.URL).VerifyConsistency(context.Background(), test.first, test.second)
+		ts.Close()
+
+		if requests != test.wantRequests {
+			t.Errorf("#%d: made %d requests, want %d", i, requests, test.wantRequests)
+		}
+		if test.wantConsistent {
+			if err != nil {
+				t.Errorf("#%d: VerifyConsistency()=_,%v, want nil error", i, err)
+			} else if proof.FirstSize > proof.SecondSize || len(proof.Proof) != len(test.proof) {
+				t.Errorf("#%d: VerifyConsistency()=%+v, want proof of %d hashes", i, proof, len(test.proof))
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("#%d: VerifyConsistency()=%+v,nil, want error", i, proof)
+			continue
+		}
+		if _, ok := err.(ConsistencyError); ok != test.wantConsistError {
+			t.Errorf("#%d: VerifyConsistency() error %v is ConsistencyError: %t, want %t", i, err, ok, test.wantConsistError)
+		}
+	}
+}
+
+func TestProveInclusion(t *testing.T) {
+	entry := &ct.LogEntry{Leaf: ct.MerkleTreeLeaf{
+		Version:  ct.V1,
+		LeafType: ct.TimestampedEntryLeafType,
+		TimestampedEntry: ct.TimestampedEntry{
+			Timestamp: 1337,
+			EntryType: ct.X509LogEntryType,
+			X509Entry: []byte("certificate"),
+		},
+	}}
+	leaf, err := ct.SerializeMerkleTreeLeaf(entry.Leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The entry is the second leaf of a tree of size 2.
+	hasher := merkle.NewSHA256TreeHasher()
+	leafHash := hasher.HashLeaf(leaf)
+	otherHash := hasher.HashLeaf([]byte("other"))
+	sth := ct.SignedTreeHead{TreeSize: 2}
+	copy(sth.SHA256RootHash[:], hasher.HashChildren(otherHash, leafHash))
+
+	tests := []struct {
+		leafIndex     int64
+		path          [][]byte
+		status        int
+		wantInclusion bool
+		wantInclusErr bool
+	}{
+		{leafIndex: 1, path: [][]byte{otherHash}, status: 200, wantInclusion: true},
+		{leafIndex: 0, path: [][]byte{otherHash}, status: 200, wantInclusErr: true},
+		{leafIndex: 1, path: [][]byte{leafHash}, status: 200, wantInclusErr: true},
+		{leafIndex: 1, path: nil, status: 200, wantInclusErr: true},
+		{leafIndex: -1, path: [][]byte{otherHash}, status: 200, wantInclusErr: true},
+		{status: http.StatusNotFound},
+	}
+	for i, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != GetProofByHashPath {
+				t.Errorf("#%d: Incorrect URL path: %s", i, r.URL.Path)
+			}
+			q := r.URL.Query()
+			if q.Get("hash") != base64.StdEncoding.EncodeToString(leafHash) || q.Get("tree_size") != "2" {
+				t.Errorf("#%d: Incorrect query: %s", i, r.URL.RawQuery)
+			}
+			if test.status != 200 {
+				http.Error(w, "not found", test.status)
+				return
+			}
+			var path []string
+			for _, h := range test.path {
+				path = append(path, fmt.Sprintf("%q", base64.StdEncoding.EncodeToString(h)))
+			}
+			fmt.Fprintf(w, `{"leaf_index":%d,"audit_path":[%s]}`, test.leafIndex, strings.Join(path, ","))
+		}))
+		proof, err := New(ts.URL).ProveInclusion(context.Background(), entry, sth)
+		ts.Close()
+
+		if test.wantInclusion {
+			if err != nil {
+				t.Errorf("#%d: ProveInclusion()=_,%v, want nil error", i, err)
+			} else if proof.LeafIndex != 1 || proof.TreeSize != 2 || len(proof.AuditPath) != 1 {
+				t.Errorf("#%d: ProveInclusion()=%+v, want proof for leaf 1", i, proof)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("#%d: ProveInclusion()=%+v,nil, want error", i, proof)
+			continue
+		}
+		if _, ok := err.(InclusionError); ok != test.wantInclusErr {
+			t.Errorf("#%d: ProveInclusion() error %v is InclusionError: %t, want %t", i, err, ok, test.wantInclusErr)
+		}
+	}
+}
+
+func TestVerifyEntries(t *testing.T) {
+	l, err := testlog.New(testlog.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := testcert.NewCA(t, "Test CA", nil)
+	key := testcert.NewKey(t)
+	for i := 0; i < 7; i++ {
+		cert := testcert.Leaf(t, fmt.Sprintf("leaf%d.example.com", i), key, issuer)
+		if _, err := l.AddChain([]ct.ASN1Cert{cert.Raw, issuer.Cert.Raw}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts := httptest.NewServer(l)
+	defer ts.Close()
+	lc := New(ts.URL)
+	sth, err := l.STH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := lc.GetEntries(0, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []struct{ start, end int }{{0, 6}, {0, 0}, {6, 6}, {2, 4}, {1, 6}} {
+		if err := lc.VerifyEntries(context.Background(), entries[r.start:r.end+1], *sth); err != nil {
+			t.Errorf("VerifyEntries(entries [%d, %d])=%v, want nil", r.start, r.end, err)
+		}
+	}
+
+	tampered := append([]ct.LogEntry{}, entries[2:5]...)
+	tampered[1].Leaf.TimestampedEntry.Timestamp++
+	if err := lc.VerifyEntries(context.Background(), tampered, *sth); err == nil {
+		t.Error("VerifyEntries(tampered entries)=nil, want error")
+	}
+	gap := []ct.LogEntry{entries[2], entries[4]}
+	if err := lc.VerifyEntries(context.Background(), gap, *sth); err == nil {
+		t.Error("VerifyEntries(non-consecutive entries)=nil, want error")
+	}
+	small := *sth
+	small.TreeSize = 5
+	if err := lc.VerifyEntries(context.Background(), entries[4:], small); err == nil {
+		t.Error("VerifyEntries(entries beyond tree size)=nil, want error")
+	}
+	if err := lc.VerifyEntries(context.Background(), nil, *sth); err == nil {
+		t.Error("VerifyEntries(no entries)=nil, want error")
+	}
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/chains"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// DefaultRootsCacheTTL is how long LogClients cache the log's accepted roots
+// for, unless Options says otherwise.
+const DefaultRootsCacheTTL = time.Hour
+
+// ErrRootNotAccepted is returned by MultiLog for logs which were skipped
+// because they don't accept the chain's root.
+var ErrRootNotAccepted = errors.New("chain doesn't lead to a root the log accepts")
+
+// acceptedRoots is a log's accepted roots, as fetched at a point in time.
+type acceptedRoots struct {
+	fetched time.Time
+	der     []ct.ASN1Cert
+	byHash  map[[sha256.Size]byte]bool
+	parsed  []*x509.Certificate
+}
+
+func newAcceptedRoots(der []ct.ASN1Cert, fetched time.Time) *acceptedRoots {
+	r := &acceptedRoots{
+		fetched: fetched,
+		der:     der,
+		byHash:  make(map[[sha256.Size]byte]bool),
+	}
+	for _, d := range der {
+		r.byHash[sha256.Sum256(d)] = true
+		// Roots the x509 package can't parse can still be matched
+		// exactly.
+		if cert, err := x509.ParseCertificate(d); err == nil {
+			r.parsed = append(r.parsed, cert)
+		}
+	}
+	return r
+}
+
+// GetAcceptedRoots retrieves the set of roots the log accepts chains ending in
+// (see section 4.7).  The roots are cached for the client's RootsCacheTTL.
+func (c *LogClient) GetAcceptedRoots(ctx context.Context) ([]ct.ASN1Cert, error) {
+	r, err := c.acceptedRoots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.der, nil
+}
+
+func (c *LogClient) acceptedRoots(ctx context.Context) (*acceptedRoots, error) {
+	c.rootsMu.Lock()
+	defer c.rootsMu.Unlock()
+	if c.roots != nil && time.Since(c.roots.fetched) < c.rootsCacheTTL {
+		return c.roots, nil
+	}
+
+	var resp getAcceptedRootsResponse
+	httpResp, body, err := c.getAndParse(ctx, c.uri+GetRootsPath, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != 200 {
+		return nil, fmt.Errorf("got HTTP Status %s: %s", httpResp.Status, body)
+	}
+	der := make([]ct.ASN1Cert, len(resp.Certificates))
+	for i, cert := range resp.Certificates {
+		if der[i], err = base64.StdEncoding.DecodeString(cert); err != nil {
+			return nil, fmt.Errorf("invalid base64 encoding in certificates: %v", err)
+		}
+	}
+	r := newAcceptedRoots(der, time.Now())
+	if c.rootsCacheTTL > 0 {
+		c.roots = r
+	}
+	return r, nil
+}
+
+// WillAccept reports whether the log accepts the root of |chain|, i.e.
+// whether one of its certificates is an accepted root, or its last
+// certificate was issued by one.  Submitting chains it returns false for is
+// bound to fail.  Nothing else about the chain is checked.
+func (c *LogClient) WillAccept(ctx context.Context, chain []ct.ASN1Cert) (bool, error) {
+	if len(chain) == 0 {
+		return false, errors.New("empty chain")
+	}
+	r, err := c.acceptedRoots(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, cert := range chain {
+		if r.byHash[sha256.Sum256(cert)] {
+			return true, nil
+		}
+	}
+	last, err := x509.ParseCertificate(chain[len(chain)-1])
+	if x509.IsFatal(err) {
+		return false, err
+	}
+	for _, root := range r.parsed {
+		if chains.IssuedBy(last, root) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/testcert"
+	"golang.org/x/net/context"
+)
+
+// rootsServer returns a server which serves roots from get-roots, and
+// counts the requests made to it.  Other requests fail.
+func rootsServer(t *testing.T, roots ...[]byte) (*httptest.Server, *int) {
+	var resp getAcceptedRootsResponse
+	for _, r := range roots {
+		resp.Certificates = append(resp.Certificates, base64.StdEncoding.EncodeToString(r))
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := new(int)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != GetRootsPath {
+			http.Error(w, "bad chain", http.StatusBadRequest)
+			return
+		}
+		*requests++
+		w.Write(body)
+	})), requests
+}
+
+func TestGetAcceptedRootsCaches(t *testing.T) {
+	c := makeTestCerts(t)
+	hs, requests := rootsServer(t, c.issuer.Raw)
+	defer hs.Close()
+
+	tests := []struct {
+		ttl          time.Duration
+		wantRequests int
+	}{
+		{0, 1},
+		{-1, 3},
+	}
+	for i, test := range tests {
+		*requests = 0
+		client := NewWithOptions(hs.URL, Options{RootsCacheTTL: test.ttl})
+		for j := 0; j < 3; j++ {
+			roots, err := client.GetAcceptedRoots(context.Background())
+			if err != nil {
+				t.Fatalf("#%d: GetAcceptedRoots()=_,%v", i, err)
+			}
+			if len(roots) != 1 || string(roots[0]) != string(c.issuer.Raw) {
+				t.Errorf("#%d: GetAcceptedRoots()=%v, want the issuer", i, roots)
+			}
+		}
+		if *requests != test.wantRequests {
+			t.Errorf("#%d: made %d requests, want %d", i, *requests, test.wantRequests)
+		}
+	}
+}
+
+func TestWillAccept(t *testing.T) {
+	c := makeTestCerts(t)
+	other := testcert.NewCA(t, "Other CA", nil).Cert
+	// A different CA with the same name as the issuer.
+	impostor := testcert.NewCA(t, "Test CA", nil).Cert
+	hs, _ := rootsServer(t, c.issuer.Raw)
+	defer hs.Close()
+	client := New(hs.URL)
+
+	tests := []struct {
+		chain []ct.ASN1Cert
+		want  bool
+	}{
+		{[]ct.ASN1Cert{c.cert.Raw, c.issuer.Raw}, true},
+		{[]ct.ASN1Cert{c.cert.Raw}, true},
+		{[]ct.ASN1Cert{c.precert}, true},
+		{[]ct.ASN1Cert{c.issuer.Raw}, true},
+		{[]ct.ASN1Cert{other.Raw}, false},
+		{[]ct.ASN1Cert{impostor.Raw}, false},
+	}
+	for i, test := range tests {
+		got, err := client.WillAccept(context.Background(), test.chain)
+		if err != nil {
+			t.Errorf("#%d: WillAccept()=_,%v", i, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("#%d: WillAccept()=%t, want %t", i, got, test.want)
+		}
+	}
+	if _, err := client.WillAccept(context.Background(), nil); err == nil {
+		t.Error("WillAccept(nil)=_,nil, want error")
+	}
+}
+
+func TestMultiLogCheckRoots(t *testing.T) {
+	c := makeTestCerts(t)
+	accepting, _ := rootsServer(t, c.issuer.Raw)
+	defer accepting.Close()
+	other := testcert.NewCA(t, "Other CA", nil).Cert
+	rejecting, _ := rootsServer(t, other.Raw)
+	defer rejecting.Close()
+
+	m, err := NewMultiLog([]LogInfo{{URL: accepting.URL}, {URL: rejecting.URL}}, MultiLogOptions{CheckRoots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.AddChain(context.Background(), []ct.ASN1Cert{c.cert.Raw})
+	qerr, ok := err.(QuorumError)
+	if !ok {
+		t.Fatalf("AddChain()=_,%v, want QuorumError", err)
+	}
+	if got := qerr.Errors[rejecting.URL]; got != ErrRootNotAccepted {
+		t.Errorf("got error %v from rejecting log, want ErrRootNotAccepted", got)
+	}
+	if got := qerr.Errors[accepting.URL]; got == ErrRootNotAccepted {
+		t.Errorf("accepting log was skipped")
+	}
+}
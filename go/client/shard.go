@@ -0,0 +1,80 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/certificate-transparency/go/loglist"
+)
+
+// ErrNoAcceptingShard is returned when none of the configured logs accepts
+// certificates with a chain's expiry.
+var ErrNoAcceptingShard = errors.New("no log shard accepts the certificate's expiry time")
+
+// LogInfoFromList returns the LogInfo for a log from a log list, including
+// the range of expiry times it accepts if it is temporally sharded.
+func LogInfoFromList(l *loglist.Log) (LogInfo, error) {
+	key, err := l.PublicKey()
+	if err != nil {
+		return LogInfo{}, fmt.Errorf("log %q: %v", l.Description, err)
+	}
+	info := LogInfo{
+		Description: l.Description,
+		URL:         l.URL,
+		PublicKey:   key,
+		MMD:         l.MMDDuration(),
+		Operator:    l.Operator,
+	}
+	if i := l.TemporalInterval; i != nil {
+		info.NotAfterStart, info.NotAfterLimit = i.StartInclusive, i.EndExclusive
+	}
+	return info, nil
+}
+
+// AcceptingLogs returns the logs in ll which are currently accepting
+// submissions, i.e. are qualified or usable.
+func AcceptingLogs(ll *loglist.LogList) ([]LogInfo, error) {
+	var infos []LogInfo
+	for _, l := range ll.Logs() {
+		switch status, _ := l.Status(); status {
+		case loglist.QualifiedStatus, loglist.UsableStatus:
+		default:
+			continue
+		}
+		info, err := LogInfoFromList(l)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// SelectLogs returns those of logs which accept certificates that expire at
+// notAfter, which are the ones which aren't temporally sharded and the shards
+// whose interval includes notAfter.  It returns ErrNoAcceptingShard if there
+// are none.
+func SelectLogs(logs []LogInfo, notAfter time.Time) ([]LogInfo, error) {
+	var selected []LogInfo
+	for i := range logs {
+		if logs[i].AcceptsExpiry(notAfter) {
+			selected = append(selected, logs[i])
+		}
+	}
+	if len(selected) == 0 {
+		return nil, ErrNoAcceptingShard
+	}
+	return selected, nil
+}
+
+// NewMultiLogFromList returns a MultiLog which submits to the logs in ll which
+// are accepting submissions, selecting the temporal shards which accept each
+// chain's expiry.
+func NewMultiLogFromList(ll *loglist.LogList, opts MultiLogOptions) (*MultiLog, error) {
+	logs, err := AcceptingLogs(ll)
+	if err != nil {
+		return nil, err
+	}
+	return NewMultiLog(logs, opts)
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/loglist"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+func shardLog(url string, year int) LogInfo {
+	return LogInfo{
+		URL:           url,
+		NotAfterStart: time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfterLimit: time.Date(year+1, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestSelectLogs(t *testing.T) {
+	logs := []LogInfo{shardLog("2039", 2039), shardLog("2040", 2040), {URL: "all"}}
+	tests := []struct {
+		notAfter time.Time
+		want     []string
+	}{
+		{time.Date(2039, 6, 1, 0, 0, 0, 0, time.UTC), []string{"2039", "all"}},
+		{time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC), []string{"2040", "all"}},
+		{time.Date(2041, 1, 1, 0, 0, 0, 0, time.UTC), []string{"all"}},
+	}
+	for i, test := range tests {
+		selected, err := SelectLogs(logs, test.notAfter)
+		if err != nil {
+			t.Errorf("#%d: SelectLogs()=_,%v", i, err)
+			continue
+		}
+		var got []string
+		for _, l := range selected {
+			got = append(got, l.URL)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("#%d: SelectLogs()=%v, want %v", i, got, test.want)
+		}
+	}
+	if _, err := SelectLogs(logs[:2], time.Date(2041, 1, 1, 0, 0, 0, 0, time.UTC)); err != ErrNoAcceptingShard {
+		t.Errorf("SelectLogs(no shard)=_,%v, want %v", err, ErrNoAcceptingShard)
+	}
+}
+
+func TestMultiLogSelectsShards(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		w.Write([]byte(validAddChainResponse))
+	}))
+	defer ts.Close()
+
+	// The test leaf expires at the start of 2040.
+	c := makeTestCerts(t)
+	chain := []ct.ASN1Cert{c.cert.Raw, c.issuer.Raw}
+	m, err := NewMultiLog([]LogInfo{
+		shardLog(ts.URL+"/2039", 2039),
+		shardLog(ts.URL+"/2040", 2040),
+		{URL: ts.URL + "/all"},
+	}, MultiLogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scts, err := m.AddChain(context.Background(), chain)
+	if err != nil || len(scts) != 2 {
+		t.Fatalf("AddChain()=%v,%v, want 2 SCTs", scts, err)
+	}
+	mu.Lock()
+	if requests["/2039"+AddChainPath] != 0 || requests["/2040"+AddChainPath] != 1 || requests["/all"+AddChainPath] != 1 {
+		t.Errorf("Got requests %v, want one each to the 2040 shard and the unsharded log", requests)
+	}
+	mu.Unlock()
+
+	m, err = NewMultiLog([]LogInfo{shardLog(ts.URL+"/2039", 2039)}, MultiLogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddChain(context.Background(), chain); err != ErrNoAcceptingShard {
+		t.Errorf("AddChain() with no accepting shard=_,%v, want %v", err, ErrNoAcceptingShard)
+	}
+}
+
+func TestAcceptingLogs(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := sha256.Sum256(der)
+	logJSON := func(url, state, interval string) string {
+		j := fmt.Sprintf(`{"log_id": %q, "key": %q, "url": %q, "mmd": 86400, "state": {%q: {"timestamp": "2020-01-01T00:00:00Z"}}`,
+			base64.StdEncoding.EncodeToString(id[:]), base64.StdEncoding.EncodeToString(der), url, state)
+		if interval != "" {
+			j += `, "temporal_interval": ` + interval
+		}
+		return j + "}"
+	}
+	ll, err := loglist.NewFromJSON([]byte(`{"log_list_timestamp": "2021-01-01T00:00:00Z", "operators": [{"name": "Op", "logs": [` +
+		logJSON("usable", "usable", `{"start_inclusive": "2040-01-01T00:00:00Z", "end_exclusive": "2041-01-01T00:00:00Z"}`) + "," +
+		logJSON("qualified", "qualified", "") + "," +
+		logJSON("retired", "retired", "") + "]}]}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := AcceptingLogs(ll)
+	if err != nil {
+		t.Fatalf("AcceptingLogs()=_,%v", err)
+	}
+	if len(logs) != 2 || logs[0].URL != "usable" || logs[1].URL != "qualified" {
+		t.Fatalf("AcceptingLogs()=%+v, want the usable and qualified logs", logs)
+	}
+	if !logs[0].Sharded() || logs[1].Sharded() || logs[0].Operator != "Op" || logs[0].MMD != 24*time.Hour || logs[0].PublicKey == nil {
+		t.Errorf("AcceptingLogs() didn't convert log details: %+v", logs)
+	}
+}
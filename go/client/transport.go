@@ -0,0 +1,73 @@
+package client
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// TransportOptions tunes the connection handling of the HTTP transport used to
+// talk to a log.  High-volume clients such as monitors should allow enough
+// idle connections per host to cover the requests they make concurrently:
+// connections beyond the limit are closed after each request, and the
+// sockets they leave in TIME_WAIT can exhaust the ephemeral ports.
+type TransportOptions struct {
+	// Maximum number of idle connections kept across all hosts.  Zero means
+	// no limit.
+	MaxIdleConns int
+	// Maximum number of idle connections kept per host.  Zero means 10.
+	MaxIdleConnsPerHost int
+	// How long an idle connection is kept before it is closed.  Zero means
+	// 90 seconds.
+	IdleConnTimeout time.Duration
+	// Timeout for establishing a connection.  Zero means 10 seconds.
+	DialTimeout time.Duration
+	// Period of TCP keep-alive probes on connections.  Zero means 30
+	// seconds.
+	KeepAlive time.Duration
+	// Timeout for reading a response's headers once the request has been
+	// sent.  Zero means 30 seconds.
+	ResponseHeaderTimeout time.Duration
+	// Speak HTTP/2 to logs which support it, multiplexing concurrent
+	// requests over a single connection.
+	EnableHTTP2 bool
+}
+
+func durationOrDefault(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
+
+// NewTransport returns an http.Transport tuned by o.  A single transport may
+// be shared by several LogClients, through Options.HTTPClient, so that they
+// share its connection pool.
+func NewTransport(o TransportOptions) *http.Transport {
+	perHost := o.MaxIdleConnsPerHost
+	if perHost == 0 {
+		perHost = 10
+	}
+	dialer := &net.Dialer{
+		Timeout:   durationOrDefault(o.DialTimeout, 10*time.Second),
+		KeepAlive: durationOrDefault(o.KeepAlive, 30*time.Second),
+	}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		Dial:                  dialer.Dial,
+		TLSHandshakeTimeout:   10 * time.Second,
+		MaxIdleConns:          o.MaxIdleConns,
+		MaxIdleConnsPerHost:   perHost,
+		IdleConnTimeout:       durationOrDefault(o.IdleConnTimeout, 90*time.Second),
+		ResponseHeaderTimeout: durationOrDefault(o.ResponseHeaderTimeout, 30*time.Second),
+	}
+	if o.EnableHTTP2 {
+		if err := http2.ConfigureTransport(t); err != nil {
+			log.Printf("Failed to enable HTTP/2, using HTTP/1.1: %v", err)
+		}
+	}
+	return t
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+)
+
+func TestNewTransport(t *testing.T) {
+	tr := NewTransport(TransportOptions{})
+	if tr.MaxIdleConnsPerHost != 10 || tr.IdleConnTimeout != 90*time.Second || tr.ResponseHeaderTimeout != 30*time.Second {
+		t.Errorf("NewTransport({}) didn't apply defaults: %+v", tr)
+	}
+	tr = NewTransport(TransportOptions{
+		MaxIdleConns:          50,
+		MaxIdleConnsPerHost:   20,
+		IdleConnTimeout:       time.Minute,
+		ResponseHeaderTimeout: time.Second,
+	})
+	if tr.MaxIdleConns != 50 || tr.MaxIdleConnsPerHost != 20 || tr.IdleConnTimeout != time.Minute || tr.ResponseHeaderTimeout != time.Second {
+		t.Errorf("NewTransport() didn't apply options: %+v", tr)
+	}
+}
+
+func TestSharedTransportReusesConnections(t *testing.T) {
+	var mu sync.Mutex
+	conns := 0
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(validAddChainResponse))
+	}))
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	hc := &http.Client{Transport: NewTransport(TransportOptions{})}
+	clients := []*LogClient{
+		NewWithOptions(ts.URL, Options{HTTPClient: hc}),
+		NewWithOptions(ts.URL, Options{HTTPClient: hc}),
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := clients[i%2].AddChain([]ct.ASN1Cert{[]byte("cert")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 1 {
+		t.Errorf("Made %d connections, want 1", conns)
+	}
+}
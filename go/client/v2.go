@@ -0,0 +1,271 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/merkle"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// URI paths for the endpoints of CT v2 (RFC6962-bis) logs, see section 5 of
+// RFC9162.
+const (
+	SubmitEntryV2Path       = "/ct/v2/submit-entry"
+	GetSTHV2Path            = "/ct/v2/get-sth"
+	GetSTHConsistencyV2Path = "/ct/v2/get-sth-consistency"
+	GetProofByHashV2Path    = "/ct/v2/get-proof-by-hash"
+)
+
+// The submission types of submit-entry requests.
+const (
+	submissionTypeCertificate    = 1
+	submissionTypePrecertificate = 2
+)
+
+var errNotV2 = errors.New("client is not for a V2 log, see Options.Version")
+
+// submitEntryRequest represents the JSON request body sent to the v2
+// submit-entry method.
+type submitEntryRequest struct {
+	Submission string   `json:"submission"` // the certificate or precertificate
+	Type       int      `json:"type"`       // what Submission is
+	Chain      []string `json:"chain"`      // the rest of the chain
+}
+
+// submitEntryResponse represents the JSON response to the v2 submit-entry
+// method.  Both fields are TransItems.
+type submitEntryResponse struct {
+	SCT string `json:"sct"`
+	STH string `json:"sth"`
+}
+
+// getSTHV2Response represents the JSON response to the v2 get-sth method.
+type getSTHV2Response struct {
+	STH string `json:"sth"`
+}
+
+// getSTHConsistencyV2Response represents the JSON response to the v2
+// get-sth-consistency method.
+type getSTHConsistencyV2Response struct {
+	Consistency string `json:"consistency"`
+	STH         string `json:"sth"`
+}
+
+// getProofByHashV2Response represents the JSON response to the v2
+// get-proof-by-hash method.
+type getProofByHashV2Response struct {
+	Inclusion string `json:"inclusion"`
+	STH       string `json:"sth"`
+}
+
+// decodeTransItem decodes the base64 encoded TransItem |encoded|, which the log
+// returned as |name|, and checks it is of type |want|.
+func decodeTransItem(name, encoded string, want ...ct.VersionedTransType) (*ct.TransItem, error) {
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 encoding in %s: %v", name, err)
+	}
+	t, err := ct.DeserializeTransItemOfType(b, want...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return t, nil
+}
+
+// AddChainV2 submits the (DER represented) X509 |chain| to a V2 log, and
+// returns the SCT TransItem the log issues for it.  The chain must include
+// the certificate's issuer if the client has a Verifier.
+func (c *LogClient) AddChainV2(ctx context.Context, chain []ct.ASN1Cert) (*ct.TransItem, error) {
+	return c.submitEntryV2(ctx, submissionTypeCertificate, chain)
+}
+
+// AddPreChainV2 submits the (DER represented) Precertificate |chain| to a V2
+// log, and returns the SCT TransItem the log issues for it.
+func (c *LogClient) AddPreChainV2(ctx context.Context, chain []ct.ASN1Cert) (*ct.TransItem, error) {
+	return c.submitEntryV2(ctx, submissionTypePrecertificate, chain)
+}
+
+func (c *LogClient) submitEntryV2(ctx context.Context, submissionType int, chain []ct.ASN1Cert) (*ct.TransItem, error) {
+	if c.version != ct.V2 {
+		return nil, errNotV2
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("empty chain")
+	}
+	req := submitEntryRequest{
+		Submission: base64.StdEncoding.EncodeToString(chain[0]),
+		Type:       submissionType,
+		Chain:      []string{},
+	}
+	for _, link := range chain[1:] {
+		req.Chain = append(req.Chain, base64.StdEncoding.EncodeToString(link))
+	}
+	var resp submitEntryResponse
+	if _, err := c.postWithRetry(ctx, c.uri+SubmitEntryV2Path, &req, &resp); err != nil {
+		return nil, err
+	}
+	want := ct.X509SCTV2Type
+	if submissionType == submissionTypePrecertificate {
+		want = ct.PrecertSCTV2Type
+	}
+	sct, err := decodeTransItem("sct", resp.SCT, want)
+	if err != nil {
+		return nil, err
+	}
+	if c.verifier != nil {
+		if err := c.verifySCTV2(sct, chain); err != nil {
+			return nil, fmt.Errorf("failed to verify SCT signature: %v", err)
+		}
+	}
+	return sct, nil
+}
+
+// verifySCTV2 checks the signature of the SCT TransItem |sct|, which the log
+// returned for |chain|.
+func (c *LogClient) verifySCTV2(sct *ct.TransItem, chain []ct.ASN1Cert) error {
+	if len(chain) < 2 {
+		return errors.New("chain has no issuer")
+	}
+	issuer, err := x509.ParseCertificate(chain[1])
+	if x509.IsFatal(err) {
+		return err
+	}
+	var tbs []byte
+	if sct.VersionedType == ct.PrecertSCTV2Type {
+		if tbs, err = PrecertificateTBS(chain[0]); err != nil {
+			return err
+		}
+	} else {
+		cert, err := x509.ParseCertificate(chain[0])
+		if x509.IsFatal(err) {
+			return err
+		}
+		tbs = cert.RawTBSCertificate
+	}
+	keyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	entry, err := ct.EntryTransItemForSCTV2(*sct, tbs, keyHash[:])
+	if err != nil {
+		return err
+	}
+	return c.verifier.VerifySCTV2Signature(*sct.SCT(), *entry)
+}
+
+// decodeSTHV2 decodes the base64 encoded STH TransItem |encoded|, checking
+// its signature if the client has a Verifier.
+func (c *LogClient) decodeSTHV2(encoded string) (*ct.SignedTreeHeadDataV2, error) {
+	t, err := decodeTransItem("sth", encoded, ct.SignedTreeHeadV2Type)
+	if err != nil {
+		return nil, err
+	}
+	if c.verifier != nil {
+		if err := c.verifier.VerifySTHV2Signature(t.SignedTreeHead); err != nil {
+			return nil, fmt.Errorf("failed to verify STH signature: %v", err)
+		}
+	}
+	return &t.SignedTreeHead, nil
+}
+
+// GetSTHV2 retrieves the current STH from a V2 log.  The STH's signature is
+// verified if the client has a Verifier.
+func (c *LogClient) GetSTHV2(ctx context.Context) (*ct.SignedTreeHeadDataV2, error) {
+	if c.version != ct.V2 {
+		return nil, errNotV2
+	}
+	var resp getSTHV2Response
+	httpResp, body, err := c.getAndParse(ctx, c.uri+GetSTHV2Path, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != 200 {
+		return nil, fmt.Errorf("got HTTP Status %s: %s", httpResp.Status, body)
+	}
+	return c.decodeSTHV2(resp.STH)
+}
+
+// GetConsistencyProofV2 fetches a proof from a V2 log that the tree of size
+// |second| is an append-only extension of the tree of size |first|.
+func (c *LogClient) GetConsistencyProofV2(ctx context.Context, first, second uint64) (*ct.ConsistencyProofDataV2, error) {
+	if c.version != ct.V2 {
+		return nil, errNotV2
+	}
+	var resp getSTHConsistencyV2Response
+	uri := fmt.Sprintf("%s%s?first=%d&second=%d", c.uri, GetSTHConsistencyV2Path, first, second)
+	httpResp, body, err := c.getAndParse(ctx, uri, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != 200 {
+		return nil, fmt.Errorf("got HTTP Status %s: %s", httpResp.Status, body)
+	}
+	t, err := decodeTransItem("consistency", resp.Consistency, ct.ConsistencyProofV2Type)
+	if err != nil {
+		return nil, err
+	}
+	return &t.ConsistencyProof, nil
+}
+
+// GetProofByHashV2 fetches a proof from a V2 log that the leaf with hash
+// |hash| is included in the tree of size |treeSize|.
+func (c *LogClient) GetProofByHashV2(ctx context.Context, hash []byte, treeSize uint64) (*ct.InclusionProofDataV2, error) {
+	if c.version != ct.V2 {
+		return nil, errNotV2
+	}
+	var resp getProofByHashV2Response
+	uri := fmt.Sprintf("%s%s?hash=%s&tree_size=%d", c.uri, GetProofByHashV2Path, url.QueryEscape(base64.StdEncoding.EncodeToString(hash)), treeSize)
+	httpResp, body, err := c.getAndParse(ctx, uri, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != 200 {
+		return nil, fmt.Errorf("got HTTP Status %s: %s", httpResp.Status, body)
+	}
+	t, err := decodeTransItem("inclusion", resp.Inclusion, ct.InclusionProofV2Type)
+	if err != nil {
+		return nil, err
+	}
+	return &t.InclusionProof, nil
+}
+
+// nodeHashes returns the hashes of a v2 proof path.
+func nodeHashes(path []ct.NodeHashV2) [][]byte {
+	hashes := make([][]byte, len(path))
+	for i, h := range path {
+		hashes[i] = h.Value
+	}
+	return hashes
+}
+
+// ProveInclusionV2 fetches a proof from a V2 log that |entry|, an entry
+// TransItem, is included in the tree head |sth|, and verifies it against the
+// tree head's root hash.  It returns the verified proof, or an error if the
+// proof doesn't verify.  The signature on the tree head isn't checked.
+func (c *LogClient) ProveInclusionV2(ctx context.Context, entry ct.TransItem, sth ct.SignedTreeHeadDataV2) (*ct.InclusionProofDataV2, error) {
+	if entry.Entry() == nil {
+		return nil, fmt.Errorf("TransItem of type %v is not an entry", entry.VersionedType)
+	}
+	leaf, err := ct.SerializeTransItem(entry)
+	if err != nil {
+		return nil, err
+	}
+	hasher := merkle.NewSHA256TreeHasher()
+	leafHash := hasher.HashLeaf(leaf)
+	treeSize := sth.TreeHead.TreeSize
+	proof, err := c.GetProofByHashV2(ctx, leafHash, treeSize)
+	if err != nil {
+		return nil, err
+	}
+	if proof.TreeSize != treeSize {
+		return nil, fmt.Errorf("got inclusion proof for tree size %d, want %d", proof.TreeSize, treeSize)
+	}
+	v := merkle.NewVerifier(hasher)
+	if err := v.VerifyInclusion(proof.LeafIndex, treeSize, leafHash, sth.TreeHead.RootHash.Value, nodeHashes(proof.InclusionPath)); err != nil {
+		return nil, fmt.Errorf("leaf %d is not included in tree head of size %d: %v", proof.LeafIndex, treeSize, err)
+	}
+	return proof, nil
+}
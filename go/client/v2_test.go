@@ -0,0 +1,222 @@
+package client
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/merkle"
+	"golang.org/x/net/context"
+)
+
+var v2TestLogID = ct.LogIDV2{0x2b, 0x06, 0x01}
+
+// fakeV2Log is a CT v2 log holding two entries, for a certificate and a
+// precertificate, which signs with key.
+type fakeV2Log struct {
+	t       *testing.T
+	key     *ecdsa.PrivateKey
+	entries []ct.TransItem
+	scts    map[int]ct.TransItem // by submission type
+	leaves  [][]byte             // hashes of the entries
+	sth     ct.TransItem
+}
+
+func (l *fakeV2Log) sign(data []byte) []byte {
+	h := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, l.key, h[:])
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	return sig
+}
+
+func (l *fakeV2Log) encode(item ct.TransItem) string {
+	b, err := ct.SerializeTransItem(item)
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func newFakeV2Log(t *testing.T, c *testCerts) *fakeV2Log {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &fakeV2Log{t: t, key: key, scts: make(map[int]ct.TransItem)}
+	keyHash := sha256.Sum256(c.issuer.RawSubjectPublicKeyInfo)
+	hasher := merkle.NewSHA256TreeHasher()
+	for _, s := range []struct {
+		submissionType int
+		sctType        ct.VersionedTransType
+	}{
+		{submissionTypeCertificate, ct.X509SCTV2Type},
+		{submissionTypePrecertificate, ct.PrecertSCTV2Type},
+	} {
+		sct := ct.TransItem{VersionedType: s.sctType}
+		sct.SCT().LogID = v2TestLogID
+		sct.SCT().Timestamp = 1337
+		// A precertificate's TBSCertificate without the poison is the
+		// certificate's.
+		entry, err := ct.EntryTransItemForSCTV2(sct, c.cert.RawTBSCertificate, keyHash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		input, err := ct.SerializeSCTV2SignatureInput(*entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sct.SCT().Signature = l.sign(input)
+		l.scts[s.submissionType] = sct
+		l.entries = append(l.entries, *entry)
+		l.leaves = append(l.leaves, hasher.HashLeaf(input))
+	}
+
+	l.sth = ct.TransItem{
+		VersionedType: ct.SignedTreeHeadV2Type,
+		SignedTreeHead: ct.SignedTreeHeadDataV2{
+			LogID: v2TestLogID,
+			TreeHead: ct.TreeHeadDataV2{
+				Timestamp: 1338,
+				TreeSize:  2,
+				RootHash:  ct.NodeHashV2{Value: hasher.HashChildren(l.leaves[0], l.leaves[1])},
+			},
+		},
+	}
+	input, err := ct.SerializeSTHV2SignatureInput(l.sth.SignedTreeHead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.sth.SignedTreeHead.Signature = l.sign(input)
+	return l
+}
+
+func (l *fakeV2Log) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var resp interface{}
+	switch r.URL.Path {
+	case SubmitEntryV2Path:
+		var req submitEntryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp = submitEntryResponse{SCT: l.encode(l.scts[req.Type]), STH: l.encode(l.sth)}
+	case GetSTHV2Path:
+		resp = getSTHV2Response{STH: l.encode(l.sth)}
+	case GetProofByHashV2Path:
+		hash, err := base64.StdEncoding.DecodeString(r.URL.Query().Get("hash"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for i, leaf := range l.leaves {
+			if bytes.Equal(hash, leaf) {
+				proof := ct.TransItem{
+					VersionedType: ct.InclusionProofV2Type,
+					InclusionProof: ct.InclusionProofDataV2{
+						LogID:         v2TestLogID,
+						TreeSize:      2,
+						LeafIndex:     uint64(i),
+						InclusionPath: []ct.NodeHashV2{{Value: l.leaves[1-i]}},
+					},
+				}
+				resp = getProofByHashV2Response{Inclusion: l.encode(proof), STH: l.encode(l.sth)}
+			}
+		}
+	}
+	if resp == nil {
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestV2MethodsNeedV2Client(t *testing.T) {
+	client := New("http://localhost:1")
+	if client.Version() != ct.V1 {
+		t.Errorf("Version()=%v, want V1", client.Version())
+	}
+	if _, err := client.GetSTHV2(context.Background()); err != errNotV2 {
+		t.Errorf("GetSTHV2()=_,%v, want %v", err, errNotV2)
+	}
+	if _, err := client.AddChainV2(context.Background(), []ct.ASN1Cert{{1}}); err != errNotV2 {
+		t.Errorf("AddChainV2()=_,%v, want %v", err, errNotV2)
+	}
+}
+
+func TestV2Log(t *testing.T) {
+	c := makeTestCerts(t)
+	l := newFakeV2Log(t, c)
+	hs := httptest.NewServer(l)
+	defer hs.Close()
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for i, test := range []struct {
+		key     *ecdsa.PrivateKey
+		wantErr bool
+	}{
+		{key: l.key},
+		{key: otherKey, wantErr: true},
+	} {
+		verifier, err := ct.NewSignatureVerifier(&test.key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := NewWithOptions(hs.URL, Options{Verifier: verifier, Version: ct.V2})
+		sct, err := client.AddChainV2(ctx, []ct.ASN1Cert{c.cert.Raw, c.issuer.Raw})
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("#%d: AddChainV2()=%v,%v, want error %v", i, sct, err, test.wantErr)
+		} else if err == nil && sct.VersionedType != ct.X509SCTV2Type {
+			t.Errorf("#%d: AddChainV2() returned a %v, want X509SCTV2", i, sct.VersionedType)
+		}
+		sct, err = client.AddPreChainV2(ctx, []ct.ASN1Cert{c.precert, c.issuer.Raw})
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("#%d: AddPreChainV2()=%v,%v, want error %v", i, sct, err, test.wantErr)
+		} else if err == nil && sct.VersionedType != ct.PrecertSCTV2Type {
+			t.Errorf("#%d: AddPreChainV2() returned a %v, want PrecertSCTV2", i, sct.VersionedType)
+		}
+		sth, err := client.GetSTHV2(ctx)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("#%d: GetSTHV2()=%v,%v, want error %v", i, sth, err, test.wantErr)
+		} else if err == nil && sth.TreeHead.TreeSize != 2 {
+			t.Errorf("#%d: GetSTHV2() returned tree size %d, want 2", i, sth.TreeHead.TreeSize)
+		}
+	}
+
+	client := NewWithOptions(hs.URL, Options{Version: ct.V2})
+	sth := l.sth.SignedTreeHead
+	for i, entry := range l.entries {
+		proof, err := client.ProveInclusionV2(ctx, entry, sth)
+		if err != nil {
+			t.Errorf("ProveInclusionV2(entry %d)=_,%v, want no error", i, err)
+		} else if proof.LeafIndex != uint64(i) {
+			t.Errorf("ProveInclusionV2(entry %d) returned a proof for leaf %d", i, proof.LeafIndex)
+		}
+	}
+	sth.TreeHead.RootHash = ct.NodeHashV2{Value: make([]byte, sha256.Size)}
+	if _, err := client.ProveInclusionV2(ctx, l.entries[0], sth); err == nil {
+		t.Error("ProveInclusionV2(wrong root hash)=_,nil, want error")
+	}
+	if _, err := client.ProveInclusionV2(ctx, l.sth, sth); err == nil {
+		t.Error("ProveInclusionV2(STH as entry)=_,nil, want error")
+	}
+}
@@ -0,0 +1,224 @@
+package client
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// testCerts holds an issuer, a precertificate it issued and the certificate
+// which corresponds to the precertificate.
+type testCerts struct {
+	issuer  *x509.Certificate
+	precert []byte
+	cert    *x509.Certificate
+}
+
+func makeTestCerts(t *testing.T) *testCerts {
+	ca := testcert.NewCA(t, "Test CA", nil)
+	tmpl := testcert.LeafTemplate("leaf.example.com")
+	key := testcert.NewKey(t)
+	precert, err := CreatePrecertificate(rand.Reader, tmpl, ca.Cert, &key.PublicKey, ca.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCerts{issuer: ca.Cert, precert: precert, cert: testcert.Issue(t, tmpl, key, ca)}
+}
+
+func TestPrecertificateTBS(t *testing.T) {
+	c := makeTestCerts(t)
+	tbs, err := PrecertificateTBS(c.precert)
+	if err != nil {
+		t.Fatalf("PrecertificateTBS()=_,%v", err)
+	}
+	// Removing the poison leaves the TBSCertificate of the certificate
+	// issued from the same template.
+	if !bytes.Equal(tbs, c.cert.RawTBSCertificate) {
+		t.Errorf("PrecertificateTBS() doesn't match the certificate's TBSCertificate")
+	}
+	if _, err := PrecertificateTBS(c.cert.Raw); err == nil {
+		t.Errorf("PrecertificateTBS(certificate)=_,nil, want error")
+	}
+	if _, err := PrecertificateTBS([]byte("garbage")); err == nil {
+		t.Errorf("PrecertificateTBS(garbage)=_,nil, want error")
+	}
+}
+
+func TestCreatePrecertificate(t *testing.T) {
+	key := testcert.NewKey(t)
+	tmpl := testcert.LeafTemplate("leaf.example.com")
+	der, err := CreatePrecertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreatePrecertificate()=_,%v", err)
+	}
+	if len(tmpl.ExtraExtensions) != 0 {
+		t.Errorf("CreatePrecertificate() modified the template")
+	}
+	if _, err := PrecertificateTBS(der); err != nil {
+		t.Errorf("PrecertificateTBS()=_,%v", err)
+	}
+
+	tmpl.ExtraExtensions = []pkix.Extension{x509.NewPoisonExtension()}
+	if _, err := CreatePrecertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key); err == nil {
+		t.Errorf("CreatePrecertificate(poisoned template)=_,nil, want error")
+	}
+}
+
+func TestNewPreCert(t *testing.T) {
+	c := makeTestCerts(t)
+	pc, err := NewPreCert(c.precert, c.issuer.Raw)
+	if err != nil {
+		t.Fatalf("NewPreCert()=_,%v", err)
+	}
+	if pc.IssuerKeyHash != sha256.Sum256(c.issuer.RawSubjectPublicKeyInfo) {
+		t.Errorf("NewPreCert() has the wrong issuer key hash")
+	}
+	if !bytes.Equal(pc.TBSCertificate, c.cert.RawTBSCertificate) {
+		t.Errorf("NewPreCert() has the wrong TBSCertificate")
+	}
+
+	signing := testcert.Template("Precert Signer", false)
+	signing.UnknownExtKeyUsage = []asn1.ObjectIdentifier{x509.OIDExtKeyUsageCTPrecertSigning}
+	der := testcert.Issue(t, signing, testcert.NewKey(t), nil).Raw
+	if _, err := NewPreCert(c.precert, der); err == nil {
+		t.Errorf("NewPreCert(_, precert signing certificate)=_,nil, want error")
+	}
+}
+
+// signedAddChainResponse returns an add-chain response containing an SCT for
+// entry signed by key.
+func signedAddChainResponse(t *testing.T, key *ecdsa.PrivateKey, entry ct.LogEntry) []byte {
+	sct := ct.SignedCertificateTimestamp{SCTVersion: ct.V1, Timestamp: 1337}
+	entry.Leaf.TimestampedEntry.Timestamp = sct.Timestamp
+	input, err := ct.SerializeSCTSignatureInput(sct, entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256(input)
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := ct.MarshalDigitallySigned(ct.DigitallySigned{
+		HashAlgorithm:      ct.SHA256,
+		SignatureAlgorithm: ct.ECDSA,
+		Signature:          sig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := json.Marshal(addChainResponse{
+		SCTVersion: sct.SCTVersion,
+		ID:         base64.StdEncoding.EncodeToString(make([]byte, 32)),
+		Timestamp:  sct.Timestamp,
+		Signature:  base64.StdEncoding.EncodeToString(ds),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestAddChainVerifiesSCT(t *testing.T) {
+	c := makeTestCerts(t)
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x509Entry := ct.LogEntry{Leaf: ct.MerkleTreeLeaf{
+		Version:  ct.V1,
+		LeafType: ct.TimestampedEntryLeafType,
+		TimestampedEntry: ct.TimestampedEntry{
+			EntryType: ct.X509LogEntryType,
+			X509Entry: c.cert.Raw,
+		},
+	}}
+	precertEntry := ct.LogEntry{Leaf: ct.MerkleTreeLeaf{
+		Version:  ct.V1,
+		LeafType: ct.TimestampedEntryLeafType,
+		TimestampedEntry: ct.TimestampedEntry{
+			EntryType: ct.PrecertLogEntryType,
+			PrecertEntry: ct.PreCert{
+				IssuerKeyHash:  sha256.Sum256(c.issuer.RawSubjectPublicKeyInfo),
+				TBSCertificate: c.cert.RawTBSCertificate,
+			},
+		},
+	}}
+	responses := map[string][]byte{
+		AddChainPath:    signedAddChainResponse(t, logKey, x509Entry),
+		AddPreChainPath: signedAddChainResponse(t, logKey, precertEntry),
+	}
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(responses[r.URL.Path])
+	}))
+	defer hs.Close()
+
+	tests := []struct {
+		key     *ecdsa.PrivateKey
+		precert bool
+		wantErr bool
+	}{
+		{key: logKey},
+		{key: logKey, precert: true},
+		{key: otherKey, wantErr: true},
+		{key: otherKey, precert: true, wantErr: true},
+	}
+	for i, test := range tests {
+		verifier, err := ct.NewSignatureVerifier(&test.key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := NewWithOptions(hs.URL, Options{Verifier: verifier})
+		var sct *ct.SignedCertificateTimestamp
+		if test.precert {
+			sct, err = client.AddPreChain([]ct.ASN1Cert{c.precert, c.issuer.Raw})
+		} else {
+			sct, err = client.AddChain([]ct.ASN1Cert{c.cert.Raw, c.issuer.Raw})
+		}
+		if !test.wantErr {
+			if err != nil || sct == nil {
+				t.Errorf("#%d: got %v,%v, want an SCT", i, sct, err)
+			}
+			continue
+		}
+		if sct != nil {
+			t.Errorf("#%d: got SCT %v, want nil", i, sct)
+		}
+		verr, ok := err.(VerificationError)
+		if !ok {
+			t.Errorf("#%d: got error %v (%T), want VerificationError", i, err, err)
+			continue
+		}
+		if verr.SCT == nil || verr.SCT.Timestamp != 1337 {
+			t.Errorf("#%d: VerificationError.SCT=%v, want the returned SCT", i, verr.SCT)
+		}
+	}
+
+	// Without a verifier, the SCT is returned unchecked.
+	if _, err := New(hs.URL).AddChain([]ct.ASN1Cert{c.issuer.Raw}); err != nil {
+		t.Errorf("AddChain() without verifier=_,%v, want nil error", err)
+	}
+}
@@ -0,0 +1,123 @@
+package ctpolicy
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go/loglist"
+	"github.com/google/certificate-transparency/go/tlsprobe"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// DefaultAuditWorkers is the number of hosts Audit probes concurrently,
+// unless its options say otherwise.
+const DefaultAuditWorkers = 10
+
+// AuditOptions holds optional configuration for Audit.
+type AuditOptions struct {
+	// Number of hosts probed concurrently.  Zero means
+	// DefaultAuditWorkers.
+	Workers int
+	// Port probed on hosts which don't specify one.  If empty, 443 is
+	// probed.
+	DefaultPort string
+	// Options for each probe, whose Timeout limits the time spent on each
+	// host.  Their ServerName is ignored: each host is sent its own name.
+	Probe tlsprobe.Options
+	// If set, called for the list to verify each host's SCTs against,
+	// instead of using the one passed to Audit, e.g. a loglist.Updater's
+	// List, so that a long audit follows changes to the list.
+	LogList func() *loglist.LogList
+}
+
+// HostReport is the outcome of auditing a single host.
+type HostReport struct {
+	// The host as given to Audit.
+	Host string
+	// When the host was probed.
+	Time time.Time
+	// Why the host couldn't be probed, or nil if it was.  The other fields
+	// are only set if it was.
+	Err error
+	// The chain the host served, leaf first.
+	Chain []*x509.Certificate
+	// Why any of the SCTs the host served couldn't be parsed.
+	ParseErrors []error
+	// The outcome of checking the leaf and its SCTs against the policies.
+	*Report
+}
+
+// hostAddr returns the host:port to probe for host, which may include a port.
+func hostAddr(host, defaultPort string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	if defaultPort == "" {
+		defaultPort = "443"
+	}
+	return net.JoinHostPort(host, defaultPort)
+}
+
+// Audit probes each host received from hosts, concurrently, and checks the
+// chain and SCTs each serves against policies, with the SCTs verified against
+// ll as of the time of the probe.  hosts are host names or IP addresses,
+// optionally with a port.  fn is called with the report for each host as it
+// is completed, from one goroutine at a time.  Audit returns once hosts is
+// closed and every host received has been reported, or once ctx is done, in
+// which case the hosts being probed are not reported.
+func Audit(ctx context.Context, hosts <-chan string, ll *loglist.LogList, policies []Policy, opts AuditOptions, fn func(*HostReport)) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultAuditWorkers
+	}
+	probeOpts := opts.Probe
+	probeOpts.ServerName = ""
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				var host string
+				var ok bool
+				select {
+				case <-ctx.Done():
+					return
+				case host, ok = <-hosts:
+					if !ok {
+						return
+					}
+				}
+				list := ll
+				if opts.LogList != nil {
+					list = opts.LogList()
+				}
+				r := auditHost(ctx, host, list, policies, opts.DefaultPort, probeOpts)
+				if ctx.Err() != nil {
+					return
+				}
+				mu.Lock()
+				fn(r)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func auditHost(ctx context.Context, host string, ll *loglist.LogList, policies []Policy, defaultPort string, opts tlsprobe.Options) *HostReport {
+	r := &HostReport{Host: host, Time: time.Now()}
+	probe, err := tlsprobe.Probe(ctx, hostAddr(host, defaultPort), opts)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.Chain = probe.Chain
+	r.ParseErrors = probe.ParseErrors
+	r.Report = Check(probe.Chain[0], probe.Chain[1:], probe.SCTs, ll, r.Time, policies...)
+	return r
+}
@@ -0,0 +1,354 @@
+// ct_audit probes a list of TLS servers concurrently and checks the chain
+// and SCTs each serves against CT policies, to audit an estate for CT
+// compliance.  Hosts are read one per line from the files named on the
+// command line, or from stdin if there are none; blank lines and lines
+// starting with # are skipped.  A report on each host is appended to the
+// output as a JSON line as soon as it is probed, so that an interrupted audit
+// can be resumed with --resume, which skips the hosts already in the output.
+//
+// The log list is read from --log_list, or fetched from --log_list_url and
+// verified against its signature, in which case it is fetched again every
+// --log_list_refresh so that a long audit follows changes to the logs.
+package main
+
+import (
+	"bufio"
+	"crypto"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/certificate-transparency/go/ctpolicy"
+	"github.com/google/certificate-transparency/go/keys"
+	"github.com/google/certificate-transparency/go/loglist"
+	"github.com/google/certificate-transparency/go/storage"
+	"github.com/google/certificate-transparency/go/tlsprobe"
+	"golang.org/x/net/context"
+)
+
+var logListFile = flag.String("log_list", "", "File holding the JSON log list to verify SCTs against")
+var logListURL = flag.String("log_list_url", "", "URL to fetch the JSON log list to verify SCTs against from, instead of --log_list")
+var logListSigURL = flag.String("log_list_sig_url", "", "URL of the signature of the list at --log_list_url")
+var logListKey = flag.String("log_list_key", "", "File holding the PEM public key which signs the list at --log_list_url")
+var logListRefresh = flag.Duration("log_list_refresh", time.Hour, "How often to fetch the list at --log_list_url again")
+var outputFile = flag.String("output", "", "File to append host reports to as JSON lines; stdout if empty")
+var resume = flag.Bool("resume", false, "Skip the hosts already reported in --output")
+var dbFile = flag.String("db", "", "SQLite3 database to also record the audit results, and the entries of the validly signed SCTs served, in; to follow hosts' compliance, and check logs incorporate the entries, over time")
+var policies = flag.String("policies", "chrome,apple", "Comma-separated policies to check: chrome or apple")
+var workers = flag.Int("workers", ctpolicy.DefaultAuditWorkers, "Number of hosts probed concurrently")
+var hostTimeout = flag.Duration("host_timeout", tlsprobe.DefaultTimeout, "Time allowed for probing each host")
+var port = flag.String("port", "443", "Port probed on hosts which don't specify one")
+var progressInterval = flag.Duration("progress", 10*time.Second, "How often to log progress; zero disables progress reports")
+
+// sctJSON is the outcome of verifying an SCT, as reported.
+type sctJSON struct {
+	Source    string `json:"source"`
+	LogID     []byte `json:"log_id,omitempty"`
+	Log       string `json:"log,omitempty"`
+	Timestamp uint64 `json:"timestamp,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// hostJSON is the report on a host, as written to the output.
+type hostJSON struct {
+	Host        string            `json:"host"`
+	Time        time.Time         `json:"time"`
+	Error       string            `json:"error,omitempty"`
+	Subject     string            `json:"subject,omitempty"`
+	NotAfter    *time.Time        `json:"not_after,omitempty"`
+	ParseErrors []string          `json:"parse_errors,omitempty"`
+	SCTs        []sctJSON         `json:"scts,omitempty"`
+	Policies    map[string]string `json:"policies,omitempty"`
+	Satisfied   bool              `json:"satisfied"`
+}
+
+// newHostJSON returns the JSON report on r.  The policies map each policy's
+// name to why it isn't satisfied, or to "" if it is.
+func newHostJSON(r *ctpolicy.HostReport) *hostJSON {
+	j := &hostJSON{Host: r.Host, Time: r.Time}
+	if r.Err != nil {
+		j.Error = r.Err.Error()
+		return j
+	}
+	j.Subject = r.Chain[0].Subject.CommonName
+	j.NotAfter = &r.Chain[0].NotAfter
+	for _, err := range r.ParseErrors {
+		j.ParseErrors = append(j.ParseErrors, err.Error())
+	}
+	for _, s := range r.SCTs {
+		sj := sctJSON{Source: s.Source.String()}
+		if s.SCT != nil {
+			sj.LogID = s.SCT.LogID[:]
+			sj.Timestamp = s.SCT.Timestamp
+		}
+		if s.Log != nil {
+			sj.Log = s.Log.URL
+		}
+		if s.Err != nil {
+			sj.Error = s.Err.Error()
+		}
+		j.SCTs = append(j.SCTs, sj)
+	}
+	j.Policies = make(map[string]string)
+	for _, p := range r.Policies {
+		j.Policies[p.Policy] = ""
+		if p.Err != nil {
+			j.Policies[p.Policy] = p.Err.Error()
+		}
+	}
+	j.Satisfied = r.Satisfied()
+	return j
+}
+
+// newAuditResult returns the result to store of the report j.
+func newAuditResult(j *hostJSON) storage.AuditResult {
+	return storage.AuditResult{Host: j.Host, Time: j.Time, Error: j.Error, Policies: j.Policies}
+}
+
+// storeEntries records the entries of the SCTs in r whose signatures
+// verified in db, so that their logs can be checked to incorporate them.
+func storeEntries(db *storage.SQLiteStore, r *ctpolicy.HostReport) error {
+	if r.Report == nil {
+		return nil
+	}
+	for _, s := range r.SCTs {
+		if s.Leaf == nil {
+			continue
+		}
+		e, err := storage.NewSCTEntry(*s.SCT, *s.Leaf)
+		if err != nil {
+			return err
+		}
+		if err := db.StoreSCTEntry(*e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reported returns the hosts already reported in the output file at path,
+// which may not exist yet.  A partial last line, left by an interrupted
+// write, is truncated so that its host is probed again.
+func reported(path string) (map[string]bool, error) {
+	done := make(map[string]bool)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var size int64
+	for {
+		b, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			if len(b) == 0 {
+				return done, nil
+			}
+			return done, os.Truncate(path, size)
+		} else if err != nil {
+			return nil, err
+		}
+		size += int64(len(b))
+		var j hostJSON
+		if err := json.Unmarshal(b, &j); err != nil {
+			log.Printf("%s: skipping unparseable report: %v", path, err)
+			continue
+		}
+		done[j.Host] = true
+	}
+}
+
+// readHosts sends the hosts read from r, which aren't in skip, to hosts,
+// until r is exhausted or ctx is done.
+func readHosts(ctx context.Context, r io.Reader, skip map[string]bool, hosts chan<- string) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		host := strings.TrimSpace(s.Text())
+		if host == "" || strings.HasPrefix(host, "#") || skip[host] {
+			continue
+		}
+		select {
+		case hosts <- host:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return s.Err()
+}
+
+func main() {
+	flag.Parse()
+	if (*logListFile == "") == (*logListURL == "") {
+		log.Fatal("Usage: ct_audit (--log_list=FILE | --log_list_url=URL --log_list_sig_url=URL --log_list_key=FILE) [--output=FILE [--resume]] [flags] [hosts files]")
+	}
+	if *logListURL != "" && (*logListSigURL == "" || *logListKey == "") {
+		log.Fatal("--log_list_url needs --log_list_sig_url and --log_list_key")
+	}
+	if *resume && *outputFile == "" {
+		log.Fatal("--resume needs --output")
+	}
+	var ps []ctpolicy.Policy
+	for _, name := range strings.Split(*policies, ",") {
+		p := ctpolicy.Named(name)
+		if p == nil {
+			log.Fatalf("Unknown policy %q", name)
+		}
+		ps = append(ps, p)
+	}
+
+	var ll *loglist.LogList
+	var updater *loglist.Updater
+	var err error
+	if *logListURL != "" {
+		var key crypto.PublicKey
+		if key, err = keys.LoadPublicKey(*logListKey); err != nil {
+			log.Fatal(err)
+		}
+		updater = loglist.NewUpdater(*logListURL, *logListSigURL, key, nil)
+		if err := updater.Update(context.Background()); err != nil {
+			log.Fatalf("Failed to fetch log list: %v", err)
+		}
+		updater.Subscribe(func(changes []loglist.LogChange) {
+			for _, c := range changes {
+				log.Printf("Log list update: %s (%s) changed from %s to %s", c.Log.Description, c.Log.URL, c.Old, c.New)
+			}
+		})
+	} else {
+		var data []byte
+		if data, err = ioutil.ReadFile(*logListFile); err != nil {
+			log.Fatal(err)
+		}
+		if ll, err = loglist.NewFromJSON(data); err != nil {
+			log.Fatalf("%s: %v", *logListFile, err)
+		}
+	}
+
+	skip := make(map[string]bool)
+	out := os.Stdout
+	if *outputFile != "" {
+		if *resume {
+			if skip, err = reported(*outputFile); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Resuming: skipping %d hosts already reported", len(skip))
+		}
+		flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		if !*resume {
+			flags |= os.O_TRUNC
+		}
+		if out, err = os.OpenFile(*outputFile, flags, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var db *storage.SQLiteStore
+	if *dbFile != "" {
+		if db, err = storage.NewSQLiteStore(*dbFile); err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		log.Print("Interrupted; abandoning the hosts being probed")
+		cancel()
+	}()
+	if updater != nil {
+		go updater.Run(ctx, *logListRefresh)
+	}
+
+	var probed, satisfied, failed uint64
+	if *progressInterval > 0 {
+		t := time.NewTicker(*progressInterval)
+		defer t.Stop()
+		go func() {
+			for range t.C {
+				log.Printf("%d hosts probed: %d satisfy all policies, %d couldn't be probed",
+					atomic.LoadUint64(&probed), atomic.LoadUint64(&satisfied), atomic.LoadUint64(&failed))
+			}
+		}()
+	}
+
+	hosts := make(chan string)
+	// Set atomically, as an interrupted audit doesn't wait for the hosts
+	// to be read.
+	var readFailed int32
+	go func() {
+		defer close(hosts)
+		if flag.NArg() == 0 {
+			if err := readHosts(ctx, os.Stdin, skip, hosts); err != nil {
+				log.Printf("stdin: %v", err)
+				atomic.StoreInt32(&readFailed, 1)
+			}
+		}
+		for _, name := range flag.Args() {
+			f, err := os.Open(name)
+			if err != nil {
+				log.Print(err)
+				atomic.StoreInt32(&readFailed, 1)
+				continue
+			}
+			err = readHosts(ctx, f, skip, hosts)
+			f.Close()
+			if err != nil {
+				log.Printf("%s: %v", name, err)
+				atomic.StoreInt32(&readFailed, 1)
+			}
+		}
+	}()
+
+	opts := ctpolicy.AuditOptions{Workers: *workers, DefaultPort: *port, Probe: tlsprobe.Options{Timeout: *hostTimeout}}
+	if updater != nil {
+		opts.LogList = updater.List
+	}
+	ctpolicy.Audit(ctx, hosts, ll, ps, opts, func(r *ctpolicy.HostReport) {
+		j := newHostJSON(r)
+		if db != nil {
+			if err := db.StoreAuditResult(newAuditResult(j)); err != nil {
+				log.Fatalf("Failed to store audit result: %v", err)
+			}
+			if err := storeEntries(db, r); err != nil {
+				log.Fatalf("Failed to store SCT entries: %v", err)
+			}
+		}
+		b, err := json.Marshal(j)
+		if err == nil {
+			// Each report is written whole, so that it survives
+			// the audit being interrupted.
+			_, err = out.Write(append(b, '\n'))
+		}
+		if err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+		atomic.AddUint64(&probed, 1)
+		switch {
+		case r.Err != nil:
+			atomic.AddUint64(&failed, 1)
+		case r.Satisfied():
+			atomic.AddUint64(&satisfied, 1)
+		}
+	})
+	if out != os.Stdout {
+		if err := out.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("Done: %d hosts probed: %d satisfy all policies, %d couldn't be probed", probed, satisfied, failed)
+	if atomic.LoadInt32(&readFailed) != 0 || ctx.Err() != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,99 @@
+package ctpolicy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency/go/loglist"
+	"golang.org/x/net/context"
+)
+
+func TestHostAddr(t *testing.T) {
+	tests := []struct {
+		host, port, want string
+	}{
+		{"example.com", "", "example.com:443"},
+		{"example.com", "8443", "example.com:8443"},
+		{"example.com:444", "8443", "example.com:444"},
+		{"2001:db8::1", "", "[2001:db8::1]:443"},
+		{"[2001:db8::1]:444", "", "[2001:db8::1]:444"},
+	}
+	for _, test := range tests {
+		if got := hostAddr(test.host, test.port); got != test.want {
+			t.Errorf("hostAddr(%q, %q)=%q, want %q", test.host, test.port, got, test.want)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	hs := httptest.NewTLSServer(http.NotFoundHandler())
+	up := strings.TrimPrefix(hs.URL, "https://")
+	closed := httptest.NewTLSServer(http.NotFoundHandler())
+	down := strings.TrimPrefix(closed.URL, "https://")
+	closed.Close()
+	defer hs.Close()
+
+	hosts := make(chan string, 3)
+	hosts <- up
+	hosts <- down
+	hosts <- up
+	close(hosts)
+	reports := make(map[string][]*HostReport)
+	Audit(context.Background(), hosts, testList(), []Policy{Chrome, Apple}, AuditOptions{Workers: 2}, func(r *HostReport) {
+		reports[r.Host] = append(reports[r.Host], r)
+	})
+
+	if len(reports[up]) != 2 {
+		t.Fatalf("got %d reports for %s, want 2", len(reports[up]), up)
+	}
+	for _, r := range reports[up] {
+		if r.Err != nil {
+			t.Errorf("%s: got error %v", up, r.Err)
+			continue
+		}
+		if len(r.Chain) == 0 || r.Report == nil || len(r.Policies) != 2 {
+			t.Errorf("%s: got chain %v and report %v, want a report on both policies", up, r.Chain, r.Report)
+			continue
+		}
+		if r.Satisfied() {
+			t.Errorf("%s: Satisfied()=true for a server without SCTs", up)
+		}
+	}
+	if len(reports[down]) != 1 || reports[down][0].Err == nil || reports[down][0].Report != nil {
+		t.Errorf("got reports %v for %s, want one with an error", reports[down], down)
+	}
+}
+
+func TestAuditCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hosts := make(chan string)
+	called := false
+	// Audit returns although hosts is never closed.
+	Audit(ctx, hosts, testList(), []Policy{Chrome}, AuditOptions{}, func(*HostReport) { called = true })
+	if called {
+		t.Error("Audit() reported a host after being cancelled")
+	}
+}
+
+func TestAuditLogList(t *testing.T) {
+	closed := httptest.NewTLSServer(http.NotFoundHandler())
+	down := strings.TrimPrefix(closed.URL, "https://")
+	closed.Close()
+
+	hosts := make(chan string, 2)
+	hosts <- down
+	hosts <- down
+	close(hosts)
+	var lists int
+	opts := AuditOptions{LogList: func() *loglist.LogList {
+		lists++
+		return testList()
+	}, Workers: 1}
+	Audit(context.Background(), hosts, nil, []Policy{Chrome}, opts, func(*HostReport) {})
+	if lists != 2 {
+		t.Errorf("LogList called %d times, want once per host", lists)
+	}
+}
@@ -0,0 +1,314 @@
+// ct_policy_check reports whether a certificate and the SCTs served with it
+// satisfy CT policies, so that site operators can check a deployment before
+// the policies are enforced.  The chain and SCTs are either probed from a TLS
+// server, or read from files.  Each SCT is verified against a log list, and
+// the outcome printed along with that of each policy.  The exit status is 1
+// if any policy isn't satisfied.
+//
+// Usage: ct_policy_check --log_list=FILE (--addr=HOST:PORT | --chain=FILE
+// [--scts=FILE,...] [--ocsp_response=FILE]) [flags]
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/ctpolicy"
+	"github.com/google/certificate-transparency/go/loglist"
+	"github.com/google/certificate-transparency/go/revocation"
+	"github.com/google/certificate-transparency/go/sctverify"
+	"github.com/google/certificate-transparency/go/tlsprobe"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+var logListFile = flag.String("log_list", "", "File holding the JSON log list to verify SCTs against")
+var addr = flag.String("addr", "", "host:port of a TLS server to probe for its chain and SCTs")
+var serverName = flag.String("server_name", "", "Name to send in SNI when probing; the host part of --addr if empty")
+var timeout = flag.Duration("timeout", tlsprobe.DefaultTimeout, "Time allowed for probing the server")
+var chainFile = flag.String("chain", "", "PEM file holding the chain to check, starting with the certificate, instead of probing a server")
+var sctFiles = flag.String("scts", "", "Comma-separated files each holding a serialized SCT delivered in the TLS extension with --chain")
+var ocspFile = flag.String("ocsp_response", "", "File holding a DER OCSP response stapled with --chain, whose SCTs are checked too")
+var verifyOCSP = flag.Bool("verify_ocsp", false, "Only use the SCTs in the stapled OCSP response if it is current and signed by the certificate's issuer")
+var policies = flag.String("policies", "chrome,apple", "Comma-separated policies to check: chrome, apple or custom")
+var customN = flag.Int("custom_n", 1, "Number of --custom_logs which SCTs are required from by the custom policy")
+var customLogs = flag.String("custom_logs", "", "Comma-separated base64 IDs of the logs counted by the custom policy")
+var output = flag.String("output", "text", "How to print the report: text or json")
+
+const timeFormat = "2006-01-02 15:04:05.000 MST"
+
+// sctResult is the outcome of verifying an SCT, as printed.
+type sctResult struct {
+	Source    string `json:"source"`
+	LogID     []byte `json:"log_id,omitempty"`
+	Log       string `json:"log,omitempty"`
+	Operator  string `json:"operator,omitempty"`
+	LogStatus string `json:"log_status,omitempty"`
+	Timestamp uint64 `json:"timestamp,omitempty"`
+	Valid     bool   `json:"valid"`
+	Error     string `json:"error,omitempty"`
+}
+
+// policyResult is the outcome of checking a policy, as printed.
+type policyResult struct {
+	Policy    string `json:"policy"`
+	Satisfied bool   `json:"satisfied"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// report is the report printed, as text or JSON.
+type report struct {
+	Subject     string         `json:"subject"`
+	NotBefore   time.Time      `json:"not_before"`
+	NotAfter    time.Time      `json:"not_after"`
+	ParseErrors []string       `json:"parse_errors,omitempty"`
+	SCTs        []sctResult    `json:"scts"`
+	Policies    []policyResult `json:"policies"`
+	Satisfied   bool           `json:"satisfied"`
+}
+
+func newReport(cert *x509.Certificate, r *ctpolicy.Report, parseErrs []error) *report {
+	rep := &report{Subject: cert.Subject.CommonName, NotBefore: cert.NotBefore, NotAfter: cert.NotAfter, SCTs: []sctResult{}, Satisfied: r.Satisfied()}
+	for _, err := range parseErrs {
+		rep.ParseErrors = append(rep.ParseErrors, err.Error())
+	}
+	for _, s := range r.SCTs {
+		sr := sctResult{Source: s.Source.String(), Valid: s.Err == nil}
+		if s.SCT != nil {
+			sr.LogID = s.SCT.LogID[:]
+			sr.Timestamp = s.SCT.Timestamp
+		}
+		if s.Log != nil {
+			sr.Log = s.Log.Description
+			if sr.Log == "" {
+				sr.Log = s.Log.URL
+			}
+			sr.Operator = s.Log.Operator
+			status, _ := s.Log.Status()
+			sr.LogStatus = status.String()
+		}
+		if s.Err != nil {
+			sr.Error = s.Err.Error()
+		}
+		rep.SCTs = append(rep.SCTs, sr)
+	}
+	for _, p := range r.Policies {
+		pr := policyResult{Policy: p.Policy, Satisfied: p.Err == nil}
+		if p.Err != nil {
+			pr.Reason = p.Err.Error()
+		}
+		rep.Policies = append(rep.Policies, pr)
+	}
+	return rep
+}
+
+func (r *report) text() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Certificate %q, valid from %s to %s\n", r.Subject, r.NotBefore.UTC().Format(timeFormat), r.NotAfter.UTC().Format(timeFormat))
+	for _, e := range r.ParseErrors {
+		fmt.Fprintf(&b, "Parse error: %s\n", e)
+	}
+	fmt.Fprintf(&b, "%d SCTs:\n", len(r.SCTs))
+	for _, s := range r.SCTs {
+		verdict := "valid"
+		if !s.Valid {
+			verdict = "INVALID: " + s.Error
+		}
+		fmt.Fprintf(&b, "  %s SCT", s.Source)
+		if s.Timestamp != 0 {
+			fmt.Fprintf(&b, " issued %s", time.Unix(0, int64(s.Timestamp)*int64(time.Millisecond)).UTC().Format(timeFormat))
+		}
+		if s.Log != "" {
+			fmt.Fprintf(&b, " by %s (%s, %s)", s.Log, s.Operator, s.LogStatus)
+		} else if s.LogID != nil {
+			fmt.Fprintf(&b, " by log %x", s.LogID)
+		}
+		fmt.Fprintf(&b, ": %s\n", verdict)
+	}
+	for _, p := range r.Policies {
+		if p.Satisfied {
+			fmt.Fprintf(&b, "Policy %s: satisfied\n", p.Policy)
+		} else {
+			fmt.Fprintf(&b, "Policy %s: NOT satisfied: %s\n", p.Policy, p.Reason)
+		}
+	}
+	return b.String()
+}
+
+// readChain returns the certificates in the PEM file at path.
+func readChain(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if x509.IsFatal(err) {
+			return nil, fmt.Errorf("%s: certificate %d: %v", path, len(chain), err)
+		}
+		chain = append(chain, c)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return chain, nil
+}
+
+// ocspVerifier returns the verifier of stapled OCSP responses which
+// --verify_ocsp asks for, or nil.
+func ocspVerifier() sctverify.OCSPVerifier {
+	if *verifyOCSP {
+		return revocation.VerifyOCSPResponse
+	}
+	return nil
+}
+
+// readSCTs returns the SCTs in the files named by --scts and those for the
+// first certificate of |chain| in the OCSP response in --ocsp_response.
+func readSCTs(chain []*x509.Certificate) ([]sctverify.DeliveredSCT, error) {
+	var scts []sctverify.DeliveredSCT
+	if *sctFiles != "" {
+		for _, path := range strings.Split(*sctFiles, ",") {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			r := bytes.NewReader(data)
+			sct, err := ct.DeserializeSCT(r)
+			if err == nil && r.Len() > 0 {
+				err = fmt.Errorf("%d trailing bytes", r.Len())
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			scts = append(scts, sctverify.DeliveredSCT{SCT: sct, Source: sctverify.TLSExtension})
+		}
+	}
+	if *ocspFile != "" {
+		data, err := ioutil.ReadFile(*ocspFile)
+		if err != nil {
+			return nil, err
+		}
+		var ocspSCTs []ct.SignedCertificateTimestamp
+		switch {
+		case len(chain) > 1:
+			ocspSCTs, err = sctverify.CertOCSPSCTs(data, chain[0], chain[1], ocspVerifier())
+		case *verifyOCSP:
+			err = errors.New("--verify_ocsp needs the certificate's issuer in --chain")
+		default:
+			ocspSCTs, err = sctverify.OCSPSCTs(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", *ocspFile, err)
+		}
+		for i := range ocspSCTs {
+			scts = append(scts, sctverify.DeliveredSCT{SCT: &ocspSCTs[i], Source: sctverify.OCSPResponse})
+		}
+	}
+	return scts, nil
+}
+
+// parsePolicies returns the policies named by --policies.
+func parsePolicies() ([]ctpolicy.Policy, error) {
+	var ps []ctpolicy.Policy
+	for _, name := range strings.Split(*policies, ",") {
+		if p := ctpolicy.Named(name); p != nil {
+			ps = append(ps, p)
+			continue
+		}
+		if name != "custom" {
+			return nil, fmt.Errorf("unknown policy %q", name)
+		}
+		if *customLogs == "" {
+			return nil, fmt.Errorf("the custom policy needs --custom_logs")
+		}
+		var ids []ct.SHA256Hash
+		for _, s := range strings.Split(*customLogs, ",") {
+			var id ct.SHA256Hash
+			if err := id.FromBase64String(s); err != nil {
+				return nil, fmt.Errorf("--custom_logs: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		if *customN < 1 || *customN > len(ids) {
+			return nil, fmt.Errorf("--custom_n must be between 1 and the number of --custom_logs, %d", len(ids))
+		}
+		ps = append(ps, ctpolicy.NOfM(*customN, ids))
+	}
+	return ps, nil
+}
+
+func main() {
+	flag.Parse()
+	if *logListFile == "" || (*addr == "") == (*chainFile == "") {
+		log.Fatal("Usage: ct_policy_check --log_list=FILE (--addr=HOST:PORT | --chain=FILE [--scts=FILE,...] [--ocsp_response=FILE]) [flags]")
+	}
+	if *addr != "" && (*sctFiles != "" || *ocspFile != "") {
+		log.Fatal("--scts and --ocsp_response can only be used with --chain")
+	}
+	if *output != "text" && *output != "json" {
+		log.Fatalf("Unknown --output %q", *output)
+	}
+	ps, err := parsePolicies()
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(*logListFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ll, err := loglist.NewFromJSON(data)
+	if err != nil {
+		log.Fatalf("%s: %v", *logListFile, err)
+	}
+
+	var chain []*x509.Certificate
+	var scts []sctverify.DeliveredSCT
+	var parseErrs []error
+	if *addr != "" {
+		r, err := tlsprobe.Probe(context.Background(), *addr, tlsprobe.Options{ServerName: *serverName, Timeout: *timeout, VerifyOCSP: ocspVerifier()})
+		if err != nil {
+			log.Fatalf("Failed to probe %s: %v", *addr, err)
+		}
+		chain, scts, parseErrs = r.Chain, r.SCTs, r.ParseErrors
+	} else {
+		if chain, err = readChain(*chainFile); err != nil {
+			log.Fatal(err)
+		}
+		if scts, err = readSCTs(chain); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	r := newReport(chain[0], ctpolicy.Check(chain[0], chain[1:], scts, ll, time.Now(), ps...), parseErrs)
+	if *output == "json" {
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(append(b, '\n'))
+	} else {
+		fmt.Print(r.text())
+	}
+	if !r.Satisfied {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,220 @@
+// Package ctpolicy checks whether the SCTs served with a certificate satisfy
+// CT policies, such as those of Chrome and Apple, so that site operators can
+// check a deployment before the policies are enforced against it.
+package ctpolicy
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/loglist"
+	"github.com/google/certificate-transparency/go/sctverify"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// Policy is a CT policy, which the valid SCTs served with a certificate must
+// satisfy.
+type Policy interface {
+	// Name identifies the policy in reports.
+	Name() string
+	// Check returns nil if the valid SCTs in results, which were verified
+	// for cert against ll, satisfy the policy, or an error saying why they
+	// don't.  SCTs whose results have errors don't count.
+	Check(cert *x509.Certificate, results []sctverify.Result, ll *loglist.LogList) error
+}
+
+// Chrome is Chrome's CT policy, as implemented by LogList.CheckChromePolicy.
+// It is satisfied if either the embedded SCTs or those delivered in the TLS
+// handshake or an OCSP response satisfy it.
+var Chrome Policy = chromePolicy{}
+
+// Apple is Apple's CT policy: embedded SCTs are required from two logs, or
+// three if the certificate is valid for more than 180 days, and delivered
+// SCTs from two logs, with the logs run by at least two operators.
+var Apple Policy = &CountPolicy{
+	PolicyName:    "apple",
+	Embedded:      2,
+	EmbeddedLong:  3,
+	ShortLifetime: 180 * 24 * time.Hour,
+	Delivered:     2,
+	Operators:     2,
+}
+
+// Named returns the built in policy with the given name, chrome or apple, or
+// nil if there isn't one.
+func Named(name string) Policy {
+	for _, p := range []Policy{Chrome, Apple} {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// NOfM returns a policy requiring SCTs, however delivered, from at least n
+// of logs, which are identified by their IDs.
+func NOfM(n int, logs []ct.SHA256Hash) *CountPolicy {
+	return &CountPolicy{
+		PolicyName:   fmt.Sprintf("%d-of-%d", n, len(logs)),
+		Embedded:     n,
+		EmbeddedLong: n,
+		Delivered:    n,
+		Logs:         logs,
+	}
+}
+
+type chromePolicy struct{}
+
+func (chromePolicy) Name() string { return "chrome" }
+
+func (chromePolicy) Check(cert *x509.Certificate, results []sctverify.Result, ll *loglist.LogList) error {
+	var embedded, delivered []*ct.SignedCertificateTimestamp
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+		case r.Source == sctverify.Embedded:
+			embedded = append(embedded, r.SCT)
+		default:
+			delivered = append(delivered, r.SCT)
+		}
+	}
+	embeddedErr := ll.CheckChromePolicy(embedded, cert.NotBefore, cert.NotAfter, true)
+	if embeddedErr == nil || len(delivered) == 0 {
+		return embeddedErr
+	}
+	deliveredErr := ll.CheckChromePolicy(delivered, cert.NotBefore, cert.NotAfter, false)
+	if deliveredErr == nil || len(embedded) == 0 {
+		return deliveredErr
+	}
+	return embeddedErr
+}
+
+// CountPolicy is a policy requiring valid SCTs from a number of distinct logs,
+// run by a number of distinct operators.  Embedded SCTs and those delivered
+// in the TLS handshake or an OCSP response are counted separately, and the
+// policy is satisfied if either meets its requirement.
+type CountPolicy struct {
+	PolicyName string
+	// Number of distinct logs embedded SCTs are required from, for
+	// certificates valid for up to ShortLifetime, and for longer.  If
+	// ShortLifetime is zero, EmbeddedLong is ignored.  Zero means
+	// embedded SCTs can't satisfy the policy.
+	Embedded, EmbeddedLong int
+	ShortLifetime          time.Duration
+	// Number of distinct logs delivered SCTs are required from.  Zero
+	// means delivered SCTs can't satisfy the policy.
+	Delivered int
+	// Number of distinct operators the logs must be run by.
+	Operators int
+	// If non-nil, only SCTs from these logs count.
+	Logs []ct.SHA256Hash
+}
+
+// CountPolicyError describes why a set of SCTs doesn't satisfy a CountPolicy.
+// It describes the embedded SCTs, unless only delivered SCTs were served.
+type CountPolicyError struct {
+	Policy                       string
+	Embedded                     bool
+	Required, Counted            int // Number of SCTs from distinct logs.
+	RequiredOperators, Operators int // Number of distinct operators of those logs.
+}
+
+func (e CountPolicyError) Error() string {
+	source := "delivered"
+	if e.Embedded {
+		source = "embedded"
+	}
+	return fmt.Sprintf("%s SCTs don't satisfy %s CT policy: %d of %d required SCTs from distinct logs, from %d of %d required operators",
+		source, e.Policy, e.Counted, e.Required, e.Operators, e.RequiredOperators)
+}
+
+// Name returns the policy's name.
+func (p *CountPolicy) Name() string { return p.PolicyName }
+
+// Check checks whether the valid SCTs in results satisfy the policy.
+func (p *CountPolicy) Check(cert *x509.Certificate, results []sctverify.Result, ll *loglist.LogList) error {
+	allowed := make(map[[sha256.Size]byte]bool)
+	for _, id := range p.Logs {
+		allowed[id] = true
+	}
+	embedded := p.Embedded
+	if p.ShortLifetime > 0 && cert.NotAfter.Sub(cert.NotBefore) > p.ShortLifetime {
+		embedded = p.EmbeddedLong
+	}
+	errs := make(map[bool]error)
+	served := make(map[bool]bool)
+	for _, isEmbedded := range []bool{true, false} {
+		required := p.Delivered
+		if isEmbedded {
+			required = embedded
+		}
+		logs := make(map[*loglist.Log]bool)
+		operators := make(map[string]bool)
+		for _, r := range results {
+			if (r.Source == sctverify.Embedded) != isEmbedded || r.SCT == nil {
+				continue
+			}
+			served[isEmbedded] = true
+			if r.Err != nil || r.Log == nil || (p.Logs != nil && !allowed[r.SCT.LogID]) {
+				continue
+			}
+			logs[r.Log] = true
+			operators[r.Log.Operator] = true
+		}
+		if required > 0 && len(logs) >= required && len(operators) >= p.Operators {
+			return nil
+		}
+		errs[isEmbedded] = CountPolicyError{
+			Policy:            p.PolicyName,
+			Embedded:          isEmbedded,
+			Required:          required,
+			Counted:           len(logs),
+			RequiredOperators: p.Operators,
+			Operators:         len(operators),
+		}
+	}
+	if served[false] && !served[true] {
+		return errs[false]
+	}
+	return errs[true]
+}
+
+// PolicyResult is the outcome of checking a certificate against a policy.
+type PolicyResult struct {
+	Policy string
+	// Why the policy isn't satisfied, or nil if it is.
+	Err error
+}
+
+// Report is the outcome of checking the SCTs served with a certificate
+// against a number of policies.
+type Report struct {
+	// The outcome of verifying each SCT, as returned by
+	// sctverify.VerifySCTs.
+	SCTs []sctverify.Result
+	// The outcome for each policy, in the order they were given.
+	Policies []PolicyResult
+}
+
+// Satisfied reports whether every policy in the report was satisfied.
+func (r *Report) Satisfied() bool {
+	for _, p := range r.Policies {
+		if p.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Check verifies the SCTs delivered with cert, and those embedded in it, as
+// sctverify.VerifySCTs does, and checks the valid ones against each of
+// policies.  chain holds the rest of cert's chain, starting with its issuer.
+func Check(cert *x509.Certificate, chain []*x509.Certificate, scts []sctverify.DeliveredSCT, ll *loglist.LogList, at time.Time, policies ...Policy) *Report {
+	r := &Report{SCTs: sctverify.VerifySCTs(cert, chain, scts, ll, at)}
+	for _, p := range policies {
+		r.Policies = append(r.Policies, PolicyResult{Policy: p.Name(), Err: p.Check(cert, r.SCTs, ll)})
+	}
+	return r
+}
@@ -0,0 +1,132 @@
+package ctpolicy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/loglist"
+	"github.com/google/certificate-transparency/go/sctverify"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+var notBefore = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testList returns a list of four usable logs, the first two run by one
+// operator and the others by another.
+func testList() *loglist.LogList {
+	usable := &loglist.LogStates{Usable: &loglist.LogState{Timestamp: notBefore.Add(-time.Hour)}}
+	ll := &loglist.LogList{}
+	for _, op := range []string{"A", "B"} {
+		o := &loglist.Operator{Name: op}
+		for i := 0; i < 2; i++ {
+			id := ct.SHA256Hash{byte(len(ll.Logs()) + len(o.Logs) + 1)}
+			o.Logs = append(o.Logs, &loglist.Log{LogID: id[:], State: usable, Operator: op})
+		}
+		ll.Operators = append(ll.Operators, o)
+	}
+	return ll
+}
+
+func result(ll *loglist.LogList, log int, source sctverify.Source, err error) sctverify.Result {
+	l := ll.Logs()[log]
+	sct := &ct.SignedCertificateTimestamp{Timestamp: uint64(notBefore.Unix() * 1000)}
+	copy(sct.LogID[:], l.LogID)
+	return sctverify.Result{DeliveredSCT: sctverify.DeliveredSCT{SCT: sct, Source: source}, Log: l, Err: err}
+}
+
+func TestPolicies(t *testing.T) {
+	ll := testList()
+	short := &x509.Certificate{NotBefore: notBefore, NotAfter: notBefore.Add(90 * 24 * time.Hour)}
+	long := &x509.Certificate{NotBefore: notBefore, NotAfter: notBefore.Add(365 * 24 * time.Hour)}
+	e := func(log int) sctverify.Result { return result(ll, log, sctverify.Embedded, nil) }
+	d := func(log int) sctverify.Result { return result(ll, log, sctverify.TLSExtension, nil) }
+	bad := result(ll, 3, sctverify.Embedded, sctverify.ErrFutureTimestamp)
+	oneOfTwo := NOfM(1, []ct.SHA256Hash{{3}, {4}})
+
+	tests := []struct {
+		desc    string
+		policy  Policy
+		cert    *x509.Certificate
+		results []sctverify.Result
+		want    bool
+	}{
+		{"chrome embedded", Chrome, short, []sctverify.Result{e(0), e(2)}, true},
+		{"chrome embedded long", Chrome, long, []sctverify.Result{e(0), e(2)}, false},
+		{"chrome embedded long enough", Chrome, long, []sctverify.Result{e(0), e(1), e(2)}, true},
+		{"chrome one operator", Chrome, short, []sctverify.Result{e(0), e(1)}, false},
+		{"chrome invalid SCT", Chrome, long, []sctverify.Result{e(0), e(1), bad}, false},
+		{"chrome delivered", Chrome, long, []sctverify.Result{d(0), d(2)}, true},
+		{"chrome not mixed", Chrome, long, []sctverify.Result{e(0), e(1), d(2)}, false},
+		{"chrome either", Chrome, long, []sctverify.Result{e(0), d(1), d(2)}, true},
+		{"apple embedded", Apple, short, []sctverify.Result{e(0), e(2)}, true},
+		{"apple embedded long", Apple, long, []sctverify.Result{e(0), e(2)}, false},
+		{"apple one operator", Apple, short, []sctverify.Result{d(0), d(1)}, false},
+		{"apple delivered", Apple, long, []sctverify.Result{d(0), d(3)}, true},
+		{"apple same log", Apple, short, []sctverify.Result{e(0), e(0)}, false},
+		{"1-of-2", oneOfTwo, long, []sctverify.Result{d(2)}, true},
+		{"1-of-2 other logs", oneOfTwo, long, []sctverify.Result{e(0), e(1)}, false},
+		{"1-of-2 invalid", oneOfTwo, long, []sctverify.Result{bad}, false},
+	}
+	for _, test := range tests {
+		err := test.policy.Check(test.cert, test.results, ll)
+		if got := err == nil; got != test.want {
+			t.Errorf("%s: Check()=%v, want satisfied: %t", test.desc, err, test.want)
+		}
+	}
+}
+
+func TestCountPolicyError(t *testing.T) {
+	ll := testList()
+	cert := &x509.Certificate{NotBefore: notBefore, NotAfter: notBefore.Add(365 * 24 * time.Hour)}
+	tests := []struct {
+		results []sctverify.Result
+		want    CountPolicyError
+	}{
+		{nil, CountPolicyError{Policy: "apple", Embedded: true, Required: 3, RequiredOperators: 2}},
+		{
+			[]sctverify.Result{result(ll, 0, sctverify.OCSPResponse, nil)},
+			CountPolicyError{Policy: "apple", Required: 2, Counted: 1, RequiredOperators: 2, Operators: 1},
+		},
+		{
+			[]sctverify.Result{result(ll, 0, sctverify.Embedded, nil), result(ll, 2, sctverify.OCSPResponse, nil)},
+			CountPolicyError{Policy: "apple", Embedded: true, Required: 3, Counted: 1, RequiredOperators: 2, Operators: 1},
+		},
+	}
+	for i, test := range tests {
+		err := Apple.Check(cert, test.results, ll)
+		if got, ok := err.(CountPolicyError); !ok || got != test.want {
+			t.Errorf("#%d: Check()=%#v, want %#v", i, err, test.want)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	ll := testList()
+	cert := &x509.Certificate{NotBefore: notBefore, NotAfter: notBefore.Add(90 * 24 * time.Hour)}
+	r := Check(cert, nil, nil, ll, notBefore, Chrome, NOfM(0, nil))
+	if len(r.SCTs) != 0 {
+		t.Errorf("got %d SCT results, want none", len(r.SCTs))
+	}
+	if len(r.Policies) != 2 || r.Policies[0].Policy != "chrome" || r.Policies[1].Policy != "0-of-0" {
+		t.Fatalf("got policy results %v, want chrome and 0-of-0", r.Policies)
+	}
+	if r.Policies[0].Err == nil || r.Policies[1].Err == nil {
+		t.Errorf("got policy results %v, want neither satisfied", r.Policies)
+	}
+	if r.Satisfied() {
+		t.Error("Satisfied()=true, want false")
+	}
+	if (&Report{Policies: []PolicyResult{{Policy: "chrome"}}}).Satisfied() != true {
+		t.Error("Satisfied()=false for a satisfied policy, want true")
+	}
+}
+
+func TestNamed(t *testing.T) {
+	if Named("chrome") != Chrome || Named("apple") != Apple {
+		t.Error("Named() didn't return the built in policies")
+	}
+	if p := Named("custom"); p != nil {
+		t.Errorf("Named(custom)=%v, want nil", p)
+	}
+}
@@ -0,0 +1,198 @@
+// Package dnsclient is a client for the DNS interface which some CT logs
+// expose alongside their HTTP API, through which tree heads and proofs are
+// fetched with TXT lookups (see the CT-over-DNS description in the
+// certificate-transparency docs).  It suits auditors on networks which only
+// allow DNS out.
+package dnsclient
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/merkle"
+	"golang.org/x/net/context"
+)
+
+// TXTResolver looks up TXT records.  *net.Resolver is one.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Options are how a LogClient resolves a log's DNS records, and whether it
+// checks the tree heads they hold.  The zero Options use the system resolver
+// and don't check signatures.
+type Options struct {
+	// Used to look up the log's records.  If nil, net.DefaultResolver is
+	// used.
+	Resolver TXTResolver
+	// If non-nil, the signature of every STH is verified with the log's
+	// public key before the STH is returned.
+	Verifier *ct.SignatureVerifier
+}
+
+// LogClient fetches tree heads and proofs from a log's DNS interface.  It can
+// be used wherever a client.ProofSource can.
+type LogClient struct {
+	domain   string
+	resolver TXTResolver
+	verifier *ct.SignatureVerifier
+}
+
+// New returns a LogClient for the log whose records are under |domain|, e.g.
+// pilot.ct.googleapis.com.
+func New(domain string, opts Options) *LogClient {
+	c := &LogClient{
+		domain:   strings.TrimSuffix(domain, "."),
+		resolver: opts.Resolver,
+		verifier: opts.Verifier,
+	}
+	if c.resolver == nil {
+		c.resolver = net.DefaultResolver
+	}
+	return c
+}
+
+// lookup returns the contents of the single TXT record at |name| under the
+// log's domain.
+func (c *LogClient) lookup(ctx context.Context, name string) (string, error) {
+	fqdn := name + "." + c.domain
+	txts, err := c.resolver.LookupTXT(ctx, fqdn)
+	if err != nil {
+		return "", err
+	}
+	if len(txts) != 1 {
+		return "", fmt.Errorf("got %d TXT records for %s, want 1", len(txts), fqdn)
+	}
+	return txts[0], nil
+}
+
+// GetSTH retrieves the current STH from the log's sth record, which holds the
+// tree size, timestamp, base64 encoded root hash and base64 encoded
+// signature, separated by dots.
+func (c *LogClient) GetSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	txt, err := c.lookup(ctx, "sth")
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(txt, ".")
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("malformed STH record %q", txt)
+	}
+	sth := &ct.SignedTreeHead{Version: ct.V1}
+	if sth.TreeSize, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid tree size: %v", err)
+	}
+	if sth.Timestamp, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %v", err)
+	}
+	if err := sth.SHA256RootHash.FromBase64String(fields[2]); err != nil {
+		return nil, fmt.Errorf("invalid root hash: %v", err)
+	}
+	if err := sth.TreeHeadSignature.FromBase64String(fields[3]); err != nil {
+		return nil, err
+	}
+	if c.verifier != nil {
+		if err := c.verifier.VerifySTHSignature(*sth); err != nil {
+			return nil, err
+		}
+	}
+	return sth, nil
+}
+
+// getHashes fetches the |count| hashes of a proof, which the log serves a
+// few at a time as binary from the records "<start>.|name|", where start is
+// the index of the first hash wanted.
+func (c *LogClient) getHashes(ctx context.Context, name string, count int) ([][]byte, error) {
+	hashes := make([][]byte, 0, count)
+	for len(hashes) < count {
+		txt, err := c.lookup(ctx, fmt.Sprintf("%d.%s", len(hashes), name))
+		if err != nil {
+			return nil, err
+		}
+		if len(txt) == 0 || len(txt)%sha256.Size != 0 {
+			return nil, fmt.Errorf("proof record of length %d isn't a whole number of hashes", len(txt))
+		}
+		for ; len(txt) > 0 && len(hashes) < count; txt = txt[sha256.Size:] {
+			hashes = append(hashes, []byte(txt[:sha256.Size]))
+		}
+		if len(txt) > 0 {
+			return nil, errors.New("proof has too many hashes")
+		}
+	}
+	return hashes, nil
+}
+
+// GetConsistencyProof fetches a proof that the tree of size |second| is an
+// append-only extension of the tree of size |first| from the log's
+// sth-consistency records.
+func (c *LogClient) GetConsistencyProof(ctx context.Context, first, second uint64) ([][]byte, error) {
+	if first > second {
+		return nil, fmt.Errorf("first tree size %d is greater than second %d", first, second)
+	}
+	n := merkle.ConsistencyProofSize(first, second)
+	return c.getHashes(ctx, fmt.Sprintf("%d.%d.sth-consistency", first, second), n)
+}
+
+// GetLeafIndex looks up the index of the leaf with hash |hash| in the log's
+// hash records, which are named by the unpadded base32 encoding of the hash.
+func (c *LogClient) GetLeafIndex(ctx context.Context, hash []byte) (uint64, error) {
+	name := strings.TrimRight(base32.StdEncoding.EncodeToString(hash), "=")
+	txt, err := c.lookup(ctx, name+".hash")
+	if err != nil {
+		return 0, err
+	}
+	index, err := strconv.ParseUint(txt, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid leaf index: %v", err)
+	}
+	return index, nil
+}
+
+// GetProofByHash looks up the index of the leaf with hash |hash| in the log's
+// hash records, then fetches its audit path in the tree of size |treeSize|
+// from the "<index>.<treeSize>.tree" records, several TXT lookups in all.  It
+// fails without fetching the path if the index is beyond the tree.
+func (c *LogClient) GetProofByHash(ctx context.Context, hash []byte, treeSize uint64) (*client.InclusionProof, error) {
+	index, err := c.GetLeafIndex(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if index >= treeSize {
+		return nil, fmt.Errorf("leaf index %d is beyond tree size %d", index, treeSize)
+	}
+	n := merkle.InclusionProofSize(index, treeSize)
+	path, err := c.getHashes(ctx, fmt.Sprintf("%d.%d.tree", index, treeSize), n)
+	if err != nil {
+		return nil, err
+	}
+	return &client.InclusionProof{
+		LeafIndex: int64(index),
+		TreeSize:  treeSize,
+		LeafHash:  hash,
+		AuditPath: path,
+	}, nil
+}
+
+// VerifyConsistency fetches the proof between the tree heads |first| and
+// |second|, in either order, from the log's sth-consistency records, and
+// checks it against their root hashes, returning a client.ConsistencyError if
+// it doesn't match.  The tree heads' signatures aren't checked, even with
+// Options.Verifier set, which only applies to those GetSTH returns.
+func (c *LogClient) VerifyConsistency(ctx context.Context, first, second ct.SignedTreeHead) (*client.ConsistencyProof, error) {
+	return client.VerifyConsistencyWith(ctx, c, first, second)
+}
+
+// ProveInclusion hashes |entry| to find it in the log's hash records, fetches
+// its audit path in the tree head |sth| from the tree records, and checks it
+// against the tree head's root hash, returning a client.InclusionError if it
+// doesn't match.  As with VerifyConsistency, |sth|'s signature isn't checked.
+func (c *LogClient) ProveInclusion(ctx context.Context, entry *ct.LogEntry, sth ct.SignedTreeHead) (*client.InclusionProof, error) {
+	return client.ProveInclusionWith(ctx, c, entry, sth)
+}
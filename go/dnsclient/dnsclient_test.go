@@ -0,0 +1,201 @@
+package dnsclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/merkle"
+	"golang.org/x/net/context"
+)
+
+// fakeResolver serves TXT records from a map.
+type fakeResolver map[string]string
+
+func (r fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	txt, ok := r[name]
+	if !ok {
+		return nil, fmt.Errorf("no such host %s", name)
+	}
+	return []string{txt}, nil
+}
+
+const domain = "log.example.com"
+
+// testLog is the tree of three entries, and the records a log serving it
+// over DNS has, with one hash in each proof record.
+type testLog struct {
+	entries  []ct.LogEntry
+	hashes   [][]byte // Leaf hashes
+	root2    []byte   // Of the tree of the first two entries
+	root3    []byte
+	sth      ct.SignedTreeHead
+	key      *ecdsa.PrivateKey
+	resolver fakeResolver
+}
+
+func addProofRecords(r fakeResolver, name string, proof [][]byte) {
+	for i, h := range proof {
+		r[fmt.Sprintf("%d.%s.%s", i, name, domain)] = string(h)
+	}
+}
+
+func newTestLog(t *testing.T) *testLog {
+	hasher := merkle.NewSHA256TreeHasher()
+	l := &testLog{resolver: make(fakeResolver)}
+	for i := 0; i < 3; i++ {
+		e := ct.LogEntry{Leaf: ct.MerkleTreeLeaf{
+			Version:  ct.V1,
+			LeafType: ct.TimestampedEntryLeafType,
+			TimestampedEntry: ct.TimestampedEntry{
+				Timestamp: uint64(i),
+				EntryType: ct.X509LogEntryType,
+				X509Entry: ct.ASN1Cert(fmt.Sprintf("cert %d", i)),
+			},
+		}}
+		leaf, err := ct.SerializeMerkleTreeLeaf(e.Leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := hasher.HashLeaf(leaf)
+		l.entries = append(l.entries, e)
+		l.hashes = append(l.hashes, h)
+		l.resolver[strings.TrimRight(base32.StdEncoding.EncodeToString(h), "=")+".hash."+domain] = fmt.Sprint(i)
+	}
+	l.root2 = hasher.HashChildren(l.hashes[0], l.hashes[1])
+	l.root3 = hasher.HashChildren(l.root2, l.hashes[2])
+	addProofRecords(l.resolver, "2.3.sth-consistency", [][]byte{l.hashes[2]})
+	addProofRecords(l.resolver, "1.2.sth-consistency", [][]byte{l.hashes[1]})
+	addProofRecords(l.resolver, "0.3.tree", [][]byte{l.hashes[1], l.hashes[2]})
+	addProofRecords(l.resolver, "2.3.tree", [][]byte{l.root2})
+
+	var err error
+	if l.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	l.sth = ct.SignedTreeHead{Version: ct.V1, TreeSize: 3, Timestamp: 1000}
+	copy(l.sth.SHA256RootHash[:], l.root3)
+	input, err := ct.SerializeSTHSignatureInput(l.sth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(input)
+	r, s, err := ecdsa.Sign(rand.Reader, l.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.sth.TreeHeadSignature = ct.DigitallySigned{HashAlgorithm: ct.SHA256, SignatureAlgorithm: ct.ECDSA, Signature: sig}
+	b64Sig, err := l.sth.TreeHeadSignature.Base64String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.resolver["sth."+domain] = fmt.Sprintf("3.1000.%s.%s", l.sth.SHA256RootHash.Base64String(), b64Sig)
+	return l
+}
+
+func TestGetSTH(t *testing.T) {
+	l := newTestLog(t)
+	v, err := ct.NewSignatureVerifier(&l.key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(domain+".", Options{Resolver: l.resolver, Verifier: v})
+	sth, err := c.GetSTH(context.Background())
+	if err != nil {
+		t.Fatalf("GetSTH()=_,%v", err)
+	}
+	if sth.TreeSize != 3 || sth.Timestamp != 1000 || sth.SHA256RootHash != l.sth.SHA256RootHash {
+		t.Errorf("GetSTH()=%+v, want %+v", sth, l.sth)
+	}
+
+	for _, bad := range []string{
+		"3.1000.AAAA",
+		"x.1000.AAAA.AAAA",
+		"3.1000.AAAA.BAMAAA==",
+		// Signs tree size 3, not 4.
+		strings.Replace(l.resolver["sth."+domain], "3.", "4.", 1),
+	} {
+		l.resolver["sth."+domain] = bad
+		if sth, err := c.GetSTH(context.Background()); err == nil {
+			t.Errorf("GetSTH(%q)=%+v,nil, want error", bad, sth)
+		}
+	}
+}
+
+func TestVerifyConsistency(t *testing.T) {
+	l := newTestLog(t)
+	c := New(domain, Options{Resolver: l.resolver})
+	var sth1, sth2 ct.SignedTreeHead
+	sth1.TreeSize, sth2.TreeSize = 2, 3
+	copy(sth1.SHA256RootHash[:], l.root2)
+	copy(sth2.SHA256RootHash[:], l.root3)
+	proof, err := c.VerifyConsistency(context.Background(), sth2, sth1)
+	if err != nil {
+		t.Fatalf("VerifyConsistency()=_,%v", err)
+	}
+	if proof.FirstSize != 2 || proof.SecondSize != 3 || len(proof.Proof) != 1 {
+		t.Errorf("VerifyConsistency()=%+v, want the proof from 2 to 3", proof)
+	}
+
+	sth1.SHA256RootHash[0] ^= 1
+	if _, err := c.VerifyConsistency(context.Background(), sth1, sth2); err == nil {
+		t.Error("VerifyConsistency(wrong root)=_,nil, want error")
+	} else if _, ok := err.(client.ConsistencyError); !ok {
+		t.Errorf("VerifyConsistency(wrong root)=_,%v, want ConsistencyError", err)
+	}
+
+	// The proof from 1 to 3 isn't served.
+	sth1.TreeSize = 1
+	if _, err := c.VerifyConsistency(context.Background(), sth1, sth2); err == nil {
+		t.Error("VerifyConsistency(missing proof)=_,nil, want error")
+	}
+}
+
+func TestProveInclusion(t *testing.T) {
+	l := newTestLog(t)
+	c := New(domain, Options{Resolver: l.resolver})
+	for _, i := range []int{0, 2} {
+		proof, err := c.ProveInclusion(context.Background(), &l.entries[i], l.sth)
+		if err != nil {
+			t.Errorf("ProveInclusion(%d)=_,%v", i, err)
+			continue
+		}
+		if proof.LeafIndex != int64(i) || proof.TreeSize != 3 {
+			t.Errorf("ProveInclusion(%d)=%+v", i, proof)
+		}
+	}
+
+	// The proof for entry 1 isn't served.
+	if _, err := c.ProveInclusion(context.Background(), &l.entries[1], l.sth); err == nil {
+		t.Error("ProveInclusion(missing proof)=_,nil, want error")
+	}
+	// A record holding half a hash.
+	l.resolver["1.0.3.tree."+domain] = string(l.hashes[2][:16])
+	if _, err := c.ProveInclusion(context.Background(), &l.entries[0], l.sth); err == nil {
+		t.Error("ProveInclusion(truncated proof)=_,nil, want error")
+	}
+	// A record holding two hashes, where one is wanted.
+	l.resolver["0.2.3.tree."+domain] = string(l.root2) + string(l.root2)
+	if _, err := c.ProveInclusion(context.Background(), &l.entries[2], l.sth); err == nil {
+		t.Error("ProveInclusion(long proof)=_,nil, want error")
+	}
+	l.resolver["0.2.3.tree."+domain] = string(l.hashes[0])
+	if _, err := c.ProveInclusion(context.Background(), &l.entries[2], l.sth); err == nil {
+		t.Error("ProveInclusion(wrong proof)=_,nil, want error")
+	} else if _, ok := err.(client.InclusionError); !ok {
+		t.Errorf("ProveInclusion(wrong proof)=_,%v, want InclusionError", err)
+	}
+}
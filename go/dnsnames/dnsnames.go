@@ -0,0 +1,119 @@
+// Package dnsnames extracts and normalizes the domain names of certificates,
+// and finds their registrable domains using a public suffix list, for
+// matching and reporting certificates by domain.
+package dnsnames
+
+import (
+	"errors"
+	"fmt"
+	"net/http/cookiejar"
+	"sort"
+	"strings"
+
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// Normalize returns the lower case ASCII form of a domain name, with any
+// trailing dot removed and any non-ASCII labels encoded as Punycode A-labels.
+// A leading "*" label is kept.  This is a subset of the IDNA ToASCII
+// operation: it doesn't apply IDNA's Unicode mappings, beyond lower-casing,
+// so the Unicode name should already be in NFC form.
+func Normalize(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" {
+		return "", errors.New("empty domain name")
+	}
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		ascii := true
+		for _, r := range label {
+			if r >= 0x80 {
+				ascii = false
+				break
+			}
+		}
+		if !ascii {
+			label = "xn--" + punycodeEncode(label)
+			labels[i] = label
+		}
+		if label == "*" && i == 0 {
+			continue
+		}
+		if len(label) == 0 || len(label) > 63 {
+			return "", fmt.Errorf("invalid label %q in domain name %q", label, domain)
+		}
+		for _, c := range []byte(label) {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return "", fmt.Errorf("invalid character %q in domain name %q", c, domain)
+			}
+		}
+	}
+	domain = strings.Join(labels, ".")
+	if len(domain) > 253 {
+		return "", fmt.Errorf("domain name %q is too long", domain)
+	}
+	return domain, nil
+}
+
+// IsWildcard reports whether the normalized |name| is a wildcard, such as
+// *.example.com.
+func IsWildcard(name string) bool {
+	return strings.HasPrefix(name, "*.")
+}
+
+// RegistrableDomain returns the registrable domain of |name|, the label below
+// its public suffix on |psl| and the suffix, e.g. example.co.uk for
+// www.example.co.uk.  The registrable domain of a wildcard is that of the
+// domain it is below.  It is an error if |name| isn't a valid domain name, or
+// is a public suffix itself, e.g. co.uk or *.co.uk.
+// golang.org/x/net/publicsuffix.List is the usual choice of |psl|.
+func RegistrableDomain(name string, psl cookiejar.PublicSuffixList) (string, error) {
+	norm, err := Normalize(name)
+	if err != nil {
+		return "", err
+	}
+	norm = strings.TrimPrefix(norm, "*.")
+	suffix := psl.PublicSuffix(norm)
+	if len(norm) <= len(suffix) || !strings.HasSuffix(norm, "."+suffix) {
+		return "", fmt.Errorf("%q is a public suffix", name)
+	}
+	rest := norm[:len(norm)-len(suffix)-1]
+	return rest[strings.LastIndexByte(rest, '.')+1:] + "." + suffix, nil
+}
+
+// Names returns the normalized, distinct domain names of |c|: its DNS
+// Subject Alternative Names, and its Subject Common Name if that is a domain
+// name, in the order they appear.
+func Names(c *x509.Certificate) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range append([]string{c.Subject.CommonName}, c.DNSNames...) {
+		norm, err := Normalize(name)
+		if err != nil {
+			// Not a domain name, e.g. a Common Name which is
+			// something else.
+			continue
+		}
+		if !seen[norm] {
+			seen[norm] = true
+			names = append(names, norm)
+		}
+	}
+	return names
+}
+
+// RegistrableDomains returns the distinct registrable domains of the Names
+// of |c| on |psl|, sorted.  Names which are public suffixes are left out.
+func RegistrableDomains(c *x509.Certificate, psl cookiejar.PublicSuffixList) []string {
+	var domains []string
+	seen := make(map[string]bool)
+	for _, name := range Names(c) {
+		d, err := RegistrableDomain(name, psl)
+		if err == nil && !seen[d] {
+			seen[d] = true
+			domains = append(domains, d)
+		}
+	}
+	sort.Strings(domains)
+	return domains
+}
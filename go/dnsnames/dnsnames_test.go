@@ -0,0 +1,125 @@
+package dnsnames
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// fakePSL is a public suffix list of the suffixes in it.
+type fakePSL map[string]bool
+
+func (l fakePSL) PublicSuffix(domain string) string {
+	for d := domain; ; {
+		if l[d] {
+			return d
+		}
+		i := strings.IndexByte(d, '.')
+		if i < 0 {
+			return d
+		}
+		d = d[i+1:]
+	}
+}
+
+func (l fakePSL) String() string { return "fake" }
+
+func TestPunycodeEncode(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"bücher", "bcher-kva"},
+		{"münchen", "mnchen-3ya"},
+		// From section 7.1 of RFC 3492.
+		{"他们为什么不说中文", "ihqwcrb4cv8a8dqg056pqjye"},
+		{"ليهمابتكلموشعربي؟", "egbpdaj6bu4bxfgehfvwxn"},
+		{"3年b組金八先生", "3b-ww4c5e180e575a65lsy2b"},
+	} {
+		if got := punycodeEncode(test.in); got != test.want {
+			t.Errorf("punycodeEncode(%q)=%q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"Example.COM.", "example.com"},
+		{"*.Bücher.example", "*.xn--bcher-kva.example"},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example"},
+		{" _dmarc.example.com ", "_dmarc.example.com"},
+		{"", ""},
+		{"a..b", ""},
+		{"a.*.b", ""},
+		{"Example Inc", ""},
+		{strings.Repeat("a", 64) + ".com", ""},
+	} {
+		got, err := Normalize(test.in)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("Normalize(%q)=%q,nil, want error", test.in, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("Normalize(%q)=%q,%v, want %q", test.in, got, err, test.want)
+		}
+	}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	psl := fakePSL{"com": true, "uk": true, "co.uk": true, "github.io": true}
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"www.Example.com.", "example.com"},
+		{"example.com", "example.com"},
+		{"*.login.example.co.uk", "example.co.uk"},
+		{"a.b.example.github.io", "example.github.io"},
+		{"Bücher.co.uk", "xn--bcher-kva.co.uk"},
+		{"co.uk", ""},
+		{"*.co.uk", ""},
+		{"github.io", ""},
+		{"Example Inc", ""},
+	} {
+		got, err := RegistrableDomain(test.in, psl)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("RegistrableDomain(%q)=%q,nil, want error", test.in, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("RegistrableDomain(%q)=%q,%v, want %q", test.in, got, err, test.want)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	c := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "WWW.example.com."},
+		DNSNames: []string{"www.example.com", "*.Example.com", "example.co.uk", "co.uk", "not a name"},
+	}
+	if got, want := Names(c), []string{"www.example.com", "*.example.com", "example.co.uk", "co.uk"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names()=%q, want %q", got, want)
+	}
+	c.Subject.CommonName = "Example Inc"
+	if got, want := Names(c), []string{"www.example.com", "*.example.com", "example.co.uk", "co.uk"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() with a non-domain CN=%q, want %q", got, want)
+	}
+
+	psl := fakePSL{"com": true, "uk": true, "co.uk": true}
+	if got, want := RegistrableDomains(c, psl), []string{"example.co.uk", "example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RegistrableDomains()=%q, want %q", got, want)
+	}
+}
+
+func TestIsWildcard(t *testing.T) {
+	if !IsWildcard("*.example.com") || IsWildcard("www.example.com") || IsWildcard("*example.com") {
+		t.Error("IsWildcard() gave the wrong answer")
+	}
+}
@@ -0,0 +1,118 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// ErrNoIssuer is returned by LogEntry.IssuerKeyHash for certificate entries
+// without a chain, from which the issuer would be taken.
+var ErrNoIssuer = errors.New("entry has no chain to take the issuer from")
+
+// Parse parses the certificate of a certificate entry into X509Cert, or the
+// precertificate of a precertificate entry into Precert, unless it has
+// already been parsed.  Errors which aren't fatal, as x509.IsFatal reports,
+// are returned with the certificate still set, as logs accept certificates
+// with such errors.  A precertificate entry needs its chain, which starts with
+// the precertificate itself.
+func (e *LogEntry) Parse() error {
+	if e.X509Cert != nil || e.Precert != nil {
+		return nil
+	}
+	te := &e.Leaf.TimestampedEntry
+	switch te.EntryType {
+	case X509LogEntryType:
+		cert, err := x509.ParseCertificate(te.X509Entry)
+		if x509.IsFatal(err) {
+			return err
+		}
+		e.X509Cert = cert
+		return err
+	case PrecertLogEntryType:
+		tbs, err := x509.ParseTBSCertificate(te.PrecertEntry.TBSCertificate)
+		if x509.IsFatal(err) {
+			return err
+		}
+		if len(e.Chain) == 0 {
+			return errors.New("precertificate entry has no chain")
+		}
+		e.Precert = &Precertificate{
+			Raw:            e.Chain[0],
+			IssuerKeyHash:  te.PrecertEntry.IssuerKeyHash,
+			TBSCertificate: *tbs,
+		}
+		return err
+	}
+	return fmt.Errorf("unknown entry type %v", te.EntryType)
+}
+
+// IsPrecert reports whether e is a precertificate entry: whether Precert is
+// set, or, if neither it nor X509Cert is, the type of its leaf's entry.
+func (e *LogEntry) IsPrecert() bool {
+	switch {
+	case e.Precert != nil:
+		return true
+	case e.X509Cert != nil:
+		return false
+	}
+	return e.Leaf.TimestampedEntry.EntryType == PrecertLogEntryType
+}
+
+// Certificate returns the parsed certificate of the entry, or the
+// TBSCertificate of its precertificate, which hold the same fields, or nil if
+// neither has been parsed.
+func (e *LogEntry) Certificate() *x509.Certificate {
+	switch {
+	case e.X509Cert != nil:
+		return e.X509Cert
+	case e.Precert != nil:
+		return &e.Precert.TBSCertificate
+	}
+	return nil
+}
+
+// RawCertificate returns the DER certificate of the entry, or its DER
+// precertificate, or nil if it is a precertificate entry without a chain.
+func (e *LogEntry) RawCertificate() []byte {
+	switch {
+	case e.Precert != nil:
+		return e.Precert.Raw
+	case e.X509Cert != nil:
+		return e.X509Cert.Raw
+	case e.IsPrecert():
+		if len(e.Chain) == 0 {
+			return nil
+		}
+		return e.Chain[0]
+	}
+	return e.Leaf.TimestampedEntry.X509Entry
+}
+
+// IssuerKeyHash returns the SHA-256 hash of the DER SubjectPublicKeyInfo of
+// the key which issued the entry's certificate or precertificate.  That of a
+// precertificate is in its leaf; that of a certificate is taken from its
+// issuer, the first certificate of its chain, which is parsed.
+func (e *LogEntry) IssuerKeyHash() ([sha256.Size]byte, error) {
+	switch {
+	case e.Precert != nil:
+		return e.Precert.IssuerKeyHash, nil
+	case e.IsPrecert():
+		return e.Leaf.TimestampedEntry.PrecertEntry.IssuerKeyHash, nil
+	}
+	if len(e.Chain) == 0 {
+		return [sha256.Size]byte{}, ErrNoIssuer
+	}
+	issuer, err := x509.ParseCertificate(e.Chain[0])
+	if x509.IsFatal(err) {
+		return [sha256.Size]byte{}, fmt.Errorf("failed to parse issuer: %v", err)
+	}
+	return sha256.Sum256(issuer.RawSubjectPublicKeyInfo), nil
+}
+
+// Extensions returns the CT extensions of the entry's leaf.
+func (e *LogEntry) Extensions() CTExtensions {
+	return e.Leaf.TimestampedEntry.Extensions
+}
@@ -0,0 +1,116 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// entryTestChain returns a certificate for leaf.example.com and the root which
+// issued it.
+func entryTestChain(t *testing.T) (leaf, root *x509.Certificate) {
+	ca := testcert.NewCA(t, "Test Root", nil)
+	return testcert.Leaf(t, "leaf.example.com", testcert.NewKey(t), ca), ca.Cert
+}
+
+func TestLogEntryX509(t *testing.T) {
+	leaf, root := entryTestChain(t)
+	e := LogEntry{
+		Leaf: MerkleTreeLeaf{TimestampedEntry: TimestampedEntry{
+			EntryType:  X509LogEntryType,
+			X509Entry:  leaf.Raw,
+			Extensions: CTExtensions{1, 2},
+		}},
+		Chain: []ASN1Cert{root.Raw},
+	}
+	if c := e.Certificate(); c != nil {
+		t.Errorf("Certificate()=%v before Parse(), want nil", c)
+	}
+	if err := e.Parse(); err != nil {
+		t.Fatalf("Parse()=%v", err)
+	}
+	if e.X509Cert == nil || e.Precert != nil {
+		t.Fatalf("Parse() set X509Cert=%v, Precert=%v, want only X509Cert", e.X509Cert, e.Precert)
+	}
+	if e.IsPrecert() {
+		t.Error("IsPrecert()=true, want false")
+	}
+	if got := e.Certificate(); got != e.X509Cert {
+		t.Errorf("Certificate()=%v, want X509Cert", got)
+	}
+	if got := e.RawCertificate(); string(got) != string(leaf.Raw) {
+		t.Error("RawCertificate() isn't the certificate")
+	}
+	hash, err := e.IssuerKeyHash()
+	if want := sha256.Sum256(root.RawSubjectPublicKeyInfo); err != nil || hash != want {
+		t.Errorf("IssuerKeyHash()=%x,%v, want %x,nil", hash, err, want)
+	}
+	if got := e.Extensions(); string(got) != "\x01\x02" {
+		t.Errorf("Extensions()=%x, want 0102", got)
+	}
+
+	e.Chain = nil
+	if _, err := e.IssuerKeyHash(); err != ErrNoIssuer {
+		t.Errorf("IssuerKeyHash(no chain)=_,%v, want %v", err, ErrNoIssuer)
+	}
+}
+
+func TestLogEntryPrecert(t *testing.T) {
+	leaf, root := entryTestChain(t)
+	keyHash := sha256.Sum256(root.RawSubjectPublicKeyInfo)
+	e := LogEntry{
+		Leaf: MerkleTreeLeaf{TimestampedEntry: TimestampedEntry{
+			EntryType: PrecertLogEntryType,
+			PrecertEntry: PreCert{
+				IssuerKeyHash:  keyHash,
+				TBSCertificate: leaf.RawTBSCertificate,
+			},
+		}},
+		Chain: []ASN1Cert{leaf.Raw, root.Raw},
+	}
+	if err := e.Parse(); err != nil {
+		t.Fatalf("Parse()=%v", err)
+	}
+	if e.Precert == nil || e.X509Cert != nil {
+		t.Fatalf("Parse() set X509Cert=%v, Precert=%v, want only Precert", e.X509Cert, e.Precert)
+	}
+	if !e.IsPrecert() {
+		t.Error("IsPrecert()=false, want true")
+	}
+	if got := e.Certificate(); got != &e.Precert.TBSCertificate {
+		t.Errorf("Certificate()=%v, want Precert.TBSCertificate", got)
+	} else if got.Subject.CommonName != "leaf.example.com" {
+		t.Errorf("Certificate().Subject.CommonName=%q, want leaf.example.com", got.Subject.CommonName)
+	}
+	if got := e.RawCertificate(); string(got) != string(leaf.Raw) {
+		t.Error("RawCertificate() isn't the first certificate of the chain")
+	}
+	if hash, err := e.IssuerKeyHash(); err != nil || hash != keyHash {
+		t.Errorf("IssuerKeyHash()=%x,%v, want %x,nil", hash, err, keyHash)
+	}
+
+	e.Precert, e.Chain = nil, nil
+	if err := e.Parse(); err == nil {
+		t.Error("Parse(precert without chain)=nil, want error")
+	}
+	if got := e.RawCertificate(); got != nil {
+		t.Errorf("RawCertificate(precert without chain)=%x, want nil", got)
+	}
+}
+
+func TestLogEntryParseErrors(t *testing.T) {
+	for _, e := range []LogEntry{
+		{Leaf: MerkleTreeLeaf{TimestampedEntry: TimestampedEntry{EntryType: X509LogEntryType, X509Entry: []byte("garbage")}}},
+		{Leaf: MerkleTreeLeaf{TimestampedEntry: TimestampedEntry{EntryType: PrecertLogEntryType, PrecertEntry: PreCert{TBSCertificate: []byte("garbage")}}}, Chain: []ASN1Cert{[]byte("garbage")}},
+		{Leaf: MerkleTreeLeaf{TimestampedEntry: TimestampedEntry{EntryType: 42}}},
+	} {
+		if err := e.Parse(); err == nil {
+			t.Errorf("Parse(%v entry)=nil, want error", e.Leaf.TimestampedEntry.EntryType)
+		}
+		if c := e.Certificate(); c != nil {
+			t.Errorf("Certificate() after failed Parse()=%v, want nil", c)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package fixchain
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// AIAStrategy is a Strategy which fetches issuers from the CA Issuers URLs in
+// the authority information access extension of each certificate.  When a
+// certificate has more than one URL they are fetched at once, and the
+// remaining fetches are cancelled as soon as one returns the issuer.
+type AIAStrategy struct{}
+
+// Name implements Strategy.
+func (AIAStrategy) Name() string {
+	return "AIA"
+}
+
+// FindIssuers implements Strategy.  Failures to fetch or parse the URLs are
+// returned as FixErrors.
+func (AIAStrategy) FindIssuers(ctx context.Context, cert *x509.Certificate, fetch Fetcher) ([]*x509.Certificate, error) {
+	var issuers []*x509.Certificate
+	var ferrs FixErrors
+	var urls []string
+	for _, url := range cert.IssuingCertificateURL {
+		// Certificates for the PKCS#7 URLs we know of are built in, so
+		// they aren't fetched.
+		if r := urlReplacement(url); r != nil {
+			log.Printf("Replaced %s: %+v", url, r)
+			issuers = append(issuers, r...)
+			continue
+		}
+		urls = append(urls, url)
+	}
+
+	switch len(urls) {
+	case 0:
+	case 1:
+		icerts, ferr := fetchIssuers(ctx, fetch, urls[0])
+		if ferr != nil {
+			ferrs = append(ferrs, ferr)
+		}
+		issuers = append(issuers, icerts...)
+	default:
+		icerts, errs := fetchIssuersParallel(ctx, fetch, cert, urls)
+		ferrs = append(ferrs, errs...)
+		issuers = append(issuers, icerts...)
+	}
+
+	if len(ferrs) > 0 {
+		return issuers, ferrs
+	}
+	return issuers, nil
+}
+
+// fetchIssuers fetches and parses the certificates at the given AIA URL,
+// which may be a single certificate or a PKCS#7 or PEM bundle.
+func fetchIssuers(ctx context.Context, fetch Fetcher, url string) ([]*x509.Certificate, *FixError) {
+	body, err := fetch.Fetch(ctx, url)
+	if err != nil {
+		ferr := &FixError{
+			Type:  CannotFetchURL,
+			URL:   url,
+			Error: err,
+		}
+		if se, ok := err.(httpStatusError); ok {
+			ferr.HTTPStatus = se.status
+		}
+		return nil, ferr
+	}
+	icerts, err := parseIssuerCertificates(body)
+	if err != nil {
+		return nil, &FixError{
+			Type:  ParseFailure,
+			URL:   url,
+			Bad:   body,
+			Error: err,
+		}
+	}
+	return icerts, nil
+}
+
+type issuerFetch struct {
+	icerts []*x509.Certificate
+	ferr   *FixError
+}
+
+// fetchIssuersParallel fetches all the given AIA URLs of cert at once, and
+// returns the certificates they return.  As soon as one of them returns
+// cert's issuer, the remaining fetches are cancelled.  Errors are returned for
+// the URLs that failed before then.
+func fetchIssuersParallel(ctx context.Context, fetch Fetcher, cert *x509.Certificate, urls []string) ([]*x509.Certificate, []*FixError) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan issuerFetch, len(urls))
+	for _, url := range urls {
+		go func(url string) {
+			icerts, ferr := fetchIssuers(ctx, fetch, url)
+			results <- issuerFetch{icerts, ferr}
+		}(url)
+	}
+
+	var icerts []*x509.Certificate
+	var ferrs []*FixError
+	for range urls {
+		r := <-results
+		if r.ferr != nil {
+			// Fetches that were cancelled because another succeeded
+			// aren't errors.
+			if ctx.Err() == nil {
+				ferrs = append(ferrs, r.ferr)
+			}
+			continue
+		}
+		for _, icert := range r.icerts {
+			icerts = append(icerts, icert)
+			if bytes.Equal(icert.RawSubject, cert.RawIssuer) {
+				cancel()
+			}
+		}
+	}
+	return icerts, ferrs
+}
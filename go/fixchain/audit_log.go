@@ -0,0 +1,88 @@
+package fixchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// AuditRecord is a line of the audit log written to FixerOptions.AuditLog,
+// recording a single attempt to fetch a URL over the network.  Cached URLs
+// aren't fetched, so aren't recorded.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Hex SHA-256 hash of the DER of the leaf whose chain was being fixed.
+	Leaf      string `json:"leaf_sha256,omitempty"`
+	URL       string `json:"url"`
+	Status    int    `json:"status,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+	Bytes     int    `json:"bytes"`
+	// Hex SHA-256 hash of the body, if one was read.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// auditLog writes AuditRecords to a writer as JSON lines.
+type auditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newAuditLog(w io.Writer) *auditLog {
+	if w == nil {
+		return nil
+	}
+	return &auditLog{enc: json.NewEncoder(w)}
+}
+
+// record writes a record of a fetch of url, which started at start, if a is
+// non-nil.  The leaf is taken from ctx.
+func (a *auditLog) record(ctx context.Context, url string, start time.Time, status int, body []byte, err error) {
+	if a == nil {
+		return
+	}
+	r := AuditRecord{
+		Time:      start.UTC(),
+		URL:       url,
+		Status:    status,
+		LatencyMS: int64(time.Since(start) / time.Millisecond),
+		Bytes:     len(body),
+	}
+	if leaf := leafFromContext(ctx); leaf != nil {
+		h := sha256.Sum256(leaf.Raw)
+		r.Leaf = hex.EncodeToString(h[:])
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if body != nil {
+		h := sha256.Sum256(body)
+		r.SHA256 = hex.EncodeToString(h[:])
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.enc.Encode(r); err != nil {
+		log.Printf("audit: failed to record fetch of %s: %s", url, err)
+	}
+}
+
+type leafKey struct{}
+
+// withLeaf returns a context carrying the leaf whose chain is being fixed, for
+// the audit log.
+func withLeaf(ctx context.Context, leaf *x509.Certificate) context.Context {
+	return context.WithValue(ctx, leafKey{}, leaf)
+}
+
+func leafFromContext(ctx context.Context) *x509.Certificate {
+	leaf, _ := ctx.Value(leafKey{}).(*x509.Certificate)
+	return leaf
+}
@@ -0,0 +1,70 @@
+package fixchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestAuditLog(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/issuer.crt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("issuer"))
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	u := newURLCache(&http.Client{}, &FixerOptions{AuditLog: &buf})
+	leaf := GetTestCertificateFromPEM(t, googleLeaf)
+	ctx := withLeaf(context.Background(), leaf)
+	u.getURL(ctx, ts.URL+"/issuer.crt")
+	// Cached, so not fetched again.
+	u.getURL(ctx, ts.URL+"/issuer.crt")
+	u.getURL(ctx, ts.URL+"/missing.crt")
+
+	leafHash := sha256.Sum256(leaf.Raw)
+	bodyHash := sha256.Sum256([]byte("issuer"))
+	expected := []AuditRecord{
+		{
+			Leaf:   hex.EncodeToString(leafHash[:]),
+			URL:    ts.URL + "/issuer.crt",
+			Status: http.StatusOK,
+			Bytes:  6,
+			SHA256: hex.EncodeToString(bodyHash[:]),
+		},
+		{
+			Leaf:   hex.EncodeToString(leafHash[:]),
+			URL:    ts.URL + "/missing.crt",
+			Status: http.StatusNotFound,
+			Error:  "can't deal with status 404",
+		},
+	}
+
+	dec := json.NewDecoder(&buf)
+	for i, e := range expected {
+		var r AuditRecord
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("#%d: failed to decode audit record: %s", i, err)
+		}
+		if r.Time.IsZero() {
+			t.Errorf("#%d: audit record has no time", i)
+		}
+		r.Time = e.Time
+		r.LatencyMS = 0
+		if r != e {
+			t.Errorf("#%d: audit record is %+v, expected %+v", i, r, e)
+		}
+	}
+	if dec.More() {
+		t.Errorf("Audit log has more records than the %d expected", len(expected))
+	}
+}
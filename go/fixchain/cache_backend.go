@@ -0,0 +1,95 @@
+package fixchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheBackend is the interface used by the Fixer to store the bodies of the
+// URLs it fetches.  Implementations must be safe for concurrent use.  Clients
+// wishing to keep their cache across restarts (e.g. in Redis or LevelDB)
+// should implement this interface.
+type CacheBackend interface {
+	// Get returns the body cached for url, and whether it was found.
+	Get(url string) ([]byte, bool)
+
+	// Put stores body as the cached response for url.
+	Put(url string, body []byte) error
+}
+
+// memoryCache is the default CacheBackend, which stores everything in memory
+// and is lost when the process exits.
+type memoryCache struct {
+	m map[string][]byte
+	sync.RWMutex
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{m: make(map[string][]byte)}
+}
+
+func (c *memoryCache) Get(url string) ([]byte, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	body, ok := c.m[url]
+	return body, ok
+}
+
+func (c *memoryCache) Put(url string, body []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	c.m[url] = body
+	return nil
+}
+
+// DiskCache is a CacheBackend which stores each cached body in its own file
+// in a directory, so that it persists across restarts.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a DiskCache which stores its files in dir, creating
+// dir if it doesn't already exist.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (d *DiskCache) path(url string) string {
+	h := sha256.Sum256([]byte(url))
+	return filepath.Join(d.dir, hex.EncodeToString(h[:]))
+}
+
+// Get returns the body cached for url, and whether it was found.
+func (d *DiskCache) Get(url string) ([]byte, bool) {
+	body, err := ioutil.ReadFile(d.path(url))
+	if err != nil {
+		return nil, false
+	}
+	return body, true
+}
+
+// Put stores body as the cached response for url.  The body is written to a
+// temporary file first so that a crash can't leave a truncated entry behind.
+func (d *DiskCache) Put(url string, body []byte) error {
+	tmp, err := ioutil.TempFile(d.dir, "tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path(url))
+}
@@ -0,0 +1,56 @@
+package fixchain
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func testCacheBackend(t *testing.T, name string, c CacheBackend) {
+	url := "http://example.com/intermediate.crt"
+	if _, ok := c.Get(url); ok {
+		t.Errorf("%s: Get() of uncached URL returned a body", name)
+	}
+	body := []byte("certificate")
+	if err := c.Put(url, body); err != nil {
+		t.Fatalf("%s: Put() failed: %s", name, err)
+	}
+	got, ok := c.Get(url)
+	if !ok {
+		t.Fatalf("%s: Get() of cached URL returned nothing", name)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("%s: Get() returned %q, expected %q", name, got, body)
+	}
+	if _, ok := c.Get("http://example.com/other.crt"); ok {
+		t.Errorf("%s: Get() of different URL returned a body", name)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	testCacheBackend(t, "memoryCache", newMemoryCache())
+}
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixchain")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatalf("NewDiskCache() failed: %s", err)
+	}
+	testCacheBackend(t, "DiskCache", d)
+
+	// A new DiskCache over the same directory sees the cached body.
+	d, err = NewDiskCache(dir)
+	if err != nil {
+		t.Fatalf("NewDiskCache() failed: %s", err)
+	}
+	if _, ok := d.Get("http://example.com/intermediate.crt"); !ok {
+		t.Error("DiskCache didn't persist cached body")
+	}
+}
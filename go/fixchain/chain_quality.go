@@ -0,0 +1,97 @@
+package fixchain
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/revocation"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// Penalties deducted from a chain's score for each of its weaknesses.  SHA-1
+// signatures are penalised most, as browsers reject chains containing them.
+const (
+	sha1SignaturePenalty       = 40
+	expiredIntermediatePenalty = 20
+	chainLengthPenalty         = 5
+	maxChainScore              = 100
+)
+
+// ChainQuality describes the properties of a fixed chain which make it more
+// or less desirable than other chains for the same certificate.
+type ChainQuality struct {
+	// Number of certificates in the chain, including the leaf and root.
+	Length int
+	// Number of certificates in the chain whose signatures use SHA-1.  The
+	// root's self-signature isn't counted, as it isn't relied on.
+	SHA1Signatures int
+	// Number of intermediates which have expired.
+	ExpiredIntermediates int
+	// Certificate policies asserted by the leaf.
+	PolicyOIDs []asn1.ObjectIdentifier
+
+	// Score summarising the above, where higher is better.  It starts from
+	// 100, with penalties for SHA-1 signatures, then expired
+	// intermediates, then length.
+	Score int
+}
+
+// ChainWithMetadata is a fixed chain together with a description of its
+// quality, as pushed to FixerOptions.ChainsWithMetadata.
+type ChainWithMetadata struct {
+	Chain   []*x509.Certificate
+	Quality ChainQuality
+	// The revocation status of each certificate in the chain but the
+	// root, if FixerOptions.Revocation is set.
+	Revocation []revocation.Status
+}
+
+// isSHA1Signature reports whether a signature uses SHA-1.
+func isSHA1Signature(alg x509.SignatureAlgorithm) bool {
+	switch alg {
+	case x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		return true
+	}
+	return false
+}
+
+// ScoreChain returns the quality of chain, which runs from the leaf to the
+// root, as of now.
+func ScoreChain(chain []*x509.Certificate, now time.Time) ChainQuality {
+	q := ChainQuality{Length: len(chain)}
+	for i, c := range chain {
+		if i < len(chain)-1 && isSHA1Signature(c.SignatureAlgorithm) {
+			q.SHA1Signatures++
+		}
+		if i > 0 && i < len(chain)-1 && now.After(c.NotAfter) {
+			q.ExpiredIntermediates++
+		}
+	}
+	if len(chain) > 0 {
+		q.PolicyOIDs = chain[0].PolicyIdentifiers
+	}
+	q.Score = maxChainScore -
+		sha1SignaturePenalty*q.SHA1Signatures -
+		expiredIntermediatePenalty*q.ExpiredIntermediates -
+		chainLengthPenalty*q.Length
+	return q
+}
+
+// byScore sorts chains from the highest score to the lowest, keeping the
+// order of chains with equal scores.
+type byScore []*ChainWithMetadata
+
+func (s byScore) Len() int           { return len(s) }
+func (s byScore) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool { return s[i].Quality.Score > s[j].Quality.Score }
+
+// scoreChains returns chains annotated with their quality, best first.
+func scoreChains(chains [][]*x509.Certificate, now time.Time) []*ChainWithMetadata {
+	scored := make([]*ChainWithMetadata, 0, len(chains))
+	for _, chain := range chains {
+		scored = append(scored, &ChainWithMetadata{Chain: chain, Quality: ScoreChain(chain, now)})
+	}
+	sort.Stable(byScore(scored))
+	return scored
+}
@@ -0,0 +1,127 @@
+package fixchain
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/revocation"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+func TestScoreChain(t *testing.T) {
+	now := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	policy := asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}
+	leaf := &x509.Certificate{SignatureAlgorithm: x509.SHA256WithRSA, NotAfter: now.AddDate(1, 0, 0), PolicyIdentifiers: []asn1.ObjectIdentifier{policy}}
+	sha1Leaf := &x509.Certificate{SignatureAlgorithm: x509.SHA1WithRSA, NotAfter: now.AddDate(1, 0, 0)}
+	intermediate := &x509.Certificate{SignatureAlgorithm: x509.SHA256WithRSA, NotAfter: now.AddDate(5, 0, 0)}
+	expired := &x509.Certificate{SignatureAlgorithm: x509.ECDSAWithSHA1, NotAfter: now.AddDate(-1, 0, 0)}
+	root := &x509.Certificate{SignatureAlgorithm: x509.SHA1WithRSA, NotAfter: now.AddDate(-1, 0, 0)}
+
+	tests := []struct {
+		chain    []*x509.Certificate
+		expected ChainQuality
+	}{
+		{
+			[]*x509.Certificate{leaf, intermediate, root},
+			ChainQuality{Length: 3, PolicyOIDs: []asn1.ObjectIdentifier{policy}, Score: 85},
+		},
+		{
+			[]*x509.Certificate{sha1Leaf, intermediate, root},
+			ChainQuality{Length: 3, SHA1Signatures: 1, Score: 45},
+		},
+		{
+			[]*x509.Certificate{leaf, intermediate, expired, root},
+			ChainQuality{Length: 4, SHA1Signatures: 1, ExpiredIntermediates: 1, PolicyOIDs: []asn1.ObjectIdentifier{policy}, Score: 20},
+		},
+	}
+
+	for i, test := range tests {
+		q := ScoreChain(test.chain, now)
+		if q.Length != test.expected.Length || q.SHA1Signatures != test.expected.SHA1Signatures ||
+			q.ExpiredIntermediates != test.expected.ExpiredIntermediates || q.Score != test.expected.Score ||
+			len(q.PolicyOIDs) != len(test.expected.PolicyOIDs) {
+			t.Errorf("#%d: ScoreChain() = %+v, expected %+v", i, q, test.expected)
+		}
+	}
+
+	scored := scoreChains([][]*x509.Certificate{tests[2].chain, tests[1].chain, tests[0].chain}, now)
+	for i, expected := range []int{85, 45, 20} {
+		if scored[i].Quality.Score != expected {
+			t.Errorf("scoreChains() chain #%d has score %d, expected %d", i, scored[i].Quality.Score, expected)
+		}
+	}
+}
+
+func TestChainsWithMetadata(t *testing.T) {
+	errors := make(chan *FixError)
+	metadata := make(chan *ChainWithMetadata)
+	f := NewFixerWithOptions(context.Background(), 1, nil, errors, &http.Client{}, FixerOptions{ChainsWithMetadata: metadata})
+
+	var got []*ChainWithMetadata
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go testErrors(t, 0, nil, errors, &wg)
+	go func() {
+		defer wg.Done()
+		for c := range metadata {
+			got = append(got, c)
+		}
+	}()
+	f.QueueChain(GetTestCertificateFromPEM(t, googleLeaf),
+		extractTestChain(t, 0, []string{thawteIntermediate}),
+		extractTestRoots(t, 0, []string{verisignRoot}))
+	f.Wait()
+	close(errors)
+	close(metadata)
+	wg.Wait()
+
+	if len(got) != 1 {
+		t.Fatalf("Got %d chains with metadata, expected 1", len(got))
+	}
+	matchTestChainList(t, 0, [][]string{{"Google", "Thawte", "VeriSign"}}, [][]*x509.Certificate{got[0].Chain})
+	if got[0].Quality.Length != 3 {
+		t.Errorf("Chain has quality %+v, expected length 3", got[0].Quality)
+	}
+}
+
+// revokedLeafChecker is a revocation.Checker which says that every leaf is
+// revoked, and every CA is good.
+type revokedLeafChecker struct{}
+
+func (revokedLeafChecker) Check(ctx context.Context, cert, issuer *x509.Certificate) revocation.Status {
+	if cert.IsCA {
+		return revocation.Status{State: revocation.Good}
+	}
+	return revocation.Status{State: revocation.Revoked, Reason: revocation.KeyCompromise}
+}
+
+func TestChainsWithMetadataRevocation(t *testing.T) {
+	errors := make(chan *FixError)
+	metadata := make(chan *ChainWithMetadata, 1)
+	f := NewFixerWithOptions(context.Background(), 1, nil, errors, &http.Client{}, FixerOptions{
+		ChainsWithMetadata: metadata,
+		Revocation:         revokedLeafChecker{},
+	})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go testErrors(t, 0, nil, errors, &wg)
+	f.QueueChain(GetTestCertificateFromPEM(t, googleLeaf),
+		extractTestChain(t, 0, []string{thawteIntermediate}),
+		extractTestRoots(t, 0, []string{verisignRoot}))
+	f.Wait()
+	close(errors)
+	close(metadata)
+	wg.Wait()
+
+	c := <-metadata
+	if c == nil {
+		t.Fatal("Got no chain with metadata")
+	}
+	if len(c.Revocation) != 2 || c.Revocation[0].State != revocation.Revoked || c.Revocation[1].State != revocation.Good {
+		t.Errorf("Chain has revocation statuses %v, expected the leaf revoked and the intermediate good", c.Revocation)
+	}
+}
@@ -0,0 +1,60 @@
+package fixchain
+
+import (
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// ChainSelection determines which of the valid chains found for a certificate
+// are output.  A certificate whose issuer has been cross-signed can have
+// several valid chains, terminating in different roots.
+type ChainSelection int
+
+// ChainSelection values
+const (
+	// Output every valid chain found.
+	AllChains ChainSelection = iota
+	// Output only the shortest valid chain.
+	ShortestChain
+	// Output only the chains terminating in FixerOptions.PreferredRoot, or
+	// every valid chain if there are none.
+	PreferredRootChains
+	// Output only the chain with the highest ChainQuality score.
+	BestChain
+)
+
+// selectChains returns the chains from chains chosen by selection.
+func selectChains(chains [][]*x509.Certificate, selection ChainSelection, preferredRoot *x509.Certificate) [][]*x509.Certificate {
+	if len(chains) == 0 {
+		return chains
+	}
+	switch selection {
+	case ShortestChain:
+		shortest := chains[0]
+		for _, chain := range chains[1:] {
+			if len(chain) < len(shortest) {
+				shortest = chain
+			}
+		}
+		return [][]*x509.Certificate{shortest}
+	case PreferredRootChains:
+		if preferredRoot == nil {
+			return chains
+		}
+		var preferred [][]*x509.Certificate
+		for _, chain := range chains {
+			if chain[len(chain)-1].Equal(preferredRoot) {
+				preferred = append(preferred, chain)
+			}
+		}
+		if len(preferred) == 0 {
+			return chains
+		}
+		return preferred
+	case BestChain:
+		return [][]*x509.Certificate{scoreChains(chains, time.Now())[0].Chain}
+	default:
+		return chains
+	}
+}
@@ -0,0 +1,51 @@
+package fixchain
+
+import (
+	"testing"
+
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+func TestSelectChains(t *testing.T) {
+	leaf := &x509.Certificate{Raw: []byte("leaf")}
+	intermediate := &x509.Certificate{Raw: []byte("intermediate")}
+	crossSign := &x509.Certificate{Raw: []byte("cross-sign")}
+	newRoot := &x509.Certificate{Raw: []byte("new root")}
+	oldRoot := &x509.Certificate{Raw: []byte("old root")}
+	otherRoot := &x509.Certificate{Raw: []byte("other root")}
+
+	long := []*x509.Certificate{leaf, intermediate, crossSign, oldRoot}
+	short := []*x509.Certificate{leaf, intermediate, newRoot}
+	chains := [][]*x509.Certificate{long, short}
+
+	selectTests := []struct {
+		selection ChainSelection
+		root      *x509.Certificate
+		expected  [][]*x509.Certificate
+	}{
+		{AllChains, nil, chains},
+		{ShortestChain, nil, [][]*x509.Certificate{short}},
+		{PreferredRootChains, oldRoot, [][]*x509.Certificate{long}},
+		{PreferredRootChains, newRoot, [][]*x509.Certificate{short}},
+		{PreferredRootChains, otherRoot, chains},
+		{PreferredRootChains, nil, chains},
+		{BestChain, nil, [][]*x509.Certificate{short}},
+	}
+
+	for i, test := range selectTests {
+		got := selectChains(chains, test.selection, test.root)
+		if len(got) != len(test.expected) {
+			t.Errorf("#%d: selectChains() returned %d chains, expected %d", i, len(got), len(test.expected))
+			continue
+		}
+		for j := range got {
+			if len(got[j]) != len(test.expected[j]) || !got[j][len(got[j])-1].Equal(test.expected[j][len(test.expected[j])-1]) {
+				t.Errorf("#%d: selectChains() chain #%d doesn't match expected chain", i, j)
+			}
+		}
+	}
+
+	if got := selectChains(nil, ShortestChain, nil); len(got) != 0 {
+		t.Errorf("selectChains() of no chains returned %d chains", len(got))
+	}
+}
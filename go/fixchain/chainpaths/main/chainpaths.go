@@ -0,0 +1,125 @@
+// chainpaths lists every path from a certificate to a root through a set of
+// intermediates, with when each path is valid, what it can be used for, and
+// any name constraints it breaks.  Nothing is fetched: use it to see what a
+// chain already provides before fixing it.
+package main
+
+import (
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+var certFile = flag.String("cert", "", "PEM file holding the certificate, optionally followed by its chain")
+var intermediatesFile = flag.String("intermediates", "", "PEM file holding additional intermediates to build paths through")
+var rootsFile = flag.String("roots", "", "PEM file holding the roots; the system roots are used if empty")
+
+const timeFormat = "2006-01-02 15:04:05 MST"
+
+var keyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageServerAuth:      "serverAuth",
+	x509.ExtKeyUsageClientAuth:      "clientAuth",
+	x509.ExtKeyUsageCodeSigning:     "codeSigning",
+	x509.ExtKeyUsageEmailProtection: "emailProtection",
+	x509.ExtKeyUsageTimeStamping:    "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSPSigning",
+}
+
+// readCerts returns the certificates in the PEM file |filename|.
+func readCerts(filename string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if x509.IsFatal(err) {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		certs = append(certs, c)
+	}
+	return certs, nil
+}
+
+func printPath(i int, p *x509.Path) {
+	fmt.Printf("Path %d:\n", i)
+	for j, c := range p.Chain {
+		fmt.Printf("  %d: %s\n", j, c.Subject.CommonName)
+	}
+	if p.NotAfter.Before(p.NotBefore) {
+		fmt.Printf("  never valid: the certificates' validity periods don't overlap\n")
+	} else {
+		fmt.Printf("  valid from %s to %s\n", p.NotBefore.Format(timeFormat), p.NotAfter.Format(timeFormat))
+	}
+	var usages []string
+	for _, u := range p.KeyUsages {
+		usages = append(usages, keyUsageNames[u])
+	}
+	if len(usages) == 0 {
+		usages = []string{"none"}
+	}
+	fmt.Printf("  key usages: %s\n", strings.Join(usages, ", "))
+	for _, v := range p.NameConstraintViolations {
+		fmt.Printf("  %s\n", v.Error())
+	}
+}
+
+func main() {
+	flag.Parse()
+	if *certFile == "" {
+		log.Fatal("Must specify --cert")
+	}
+	certs, err := readCerts(*certFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(certs) == 0 {
+		log.Fatalf("No certificates in %s", *certFile)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	if *intermediatesFile != "" {
+		extra, err := readCerts(*intermediatesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, c := range extra {
+			intermediates.AddCert(c)
+		}
+	}
+	var roots *x509.CertPool
+	if *rootsFile != "" {
+		rootCerts, err := readCerts(*rootsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		roots = x509.NewCertPool()
+		for _, c := range rootCerts {
+			roots.AddCert(c)
+		}
+	}
+
+	paths, err := x509.BuildAllPaths(certs[0], intermediates, roots)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i := range paths {
+		printPath(i, &paths[i])
+	}
+}
@@ -0,0 +1,107 @@
+package fixchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// checkpointVersion is the version of the checkpoint format written by
+// Checkpoint.  Resume rejects checkpoints with any other version.
+const checkpointVersion = 1
+
+type checkpointJSON struct {
+	Version int              `json:"version"`
+	Done    [][]byte         `json:"done"`
+	Pending []pendingFixJSON `json:"pending"`
+}
+
+type pendingFixJSON struct {
+	Cert     []byte   `json:"cert"`
+	Chain    [][]byte `json:"chain,omitempty"`
+	Priority int      `json:"priority,omitempty"`
+}
+
+// Checkpoint writes the state of the Fixer to w, so that a job interrupted
+// part way through can be resumed by calling Resume on a new Fixer.  The
+// state consists of the hashes of the chains which have been fixed, and the
+// chains which have been queued but not yet fixed.  Checkpoint may be called
+// while chains are being fixed.
+func (f *Fixer) Checkpoint(w io.Writer) error {
+	// Take the pending chains first: a chain is marked as done before it is
+	// removed from the pending chains, so every chain is in at least one of
+	// the two.
+	c := checkpointJSON{Version: checkpointVersion, Pending: []pendingFixJSON{}, Done: [][]byte{}}
+	for _, fix := range f.pending.fixes() {
+		p := pendingFixJSON{Cert: fix.cert.Raw, Priority: fix.priority}
+		for _, cert := range fix.chain {
+			p.Chain = append(p.Chain, cert.Raw)
+		}
+		c.Pending = append(c.Pending, p)
+	}
+	for _, k := range f.done.keys() {
+		h := k
+		c.Done = append(c.Done, h[:])
+	}
+	return json.NewEncoder(w).Encode(&c)
+}
+
+// Resume reads a checkpoint written by Checkpoint from r.  Chains which were
+// fixed before the checkpoint was taken are skipped if they are queued again,
+// and chains which were pending are queued to be fixed with respect to the
+// given roots.  Chains are only recognised as fixed if they are queued with
+// the same roots as before.  Resume should be called before any chains are
+// queued, and blocks until all the pending chains have been queued.
+func (f *Fixer) Resume(r io.Reader, roots *x509.CertPool) error {
+	var c checkpointJSON
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return fmt.Errorf("failed to decode checkpoint: %s", err)
+	}
+	if c.Version != checkpointVersion {
+		return fmt.Errorf("unsupported checkpoint version %d, expected %d", c.Version, checkpointVersion)
+	}
+
+	type pendingFix struct {
+		cert     *x509.Certificate
+		chain    []*x509.Certificate
+		priority int
+	}
+	// Parse everything before changing the Fixer's state, so that a corrupt
+	// checkpoint leaves it untouched.
+	var done [][hashSize]byte
+	for i, d := range c.Done {
+		if len(d) != hashSize {
+			return fmt.Errorf("done entry %d has length %d, expected %d", i, len(d), hashSize)
+		}
+		var h [hashSize]byte
+		copy(h[:], d)
+		done = append(done, h)
+	}
+	var pending []pendingFix
+	for i, p := range c.Pending {
+		cert, err := parseCertificate(p.Cert)
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate of pending entry %d: %s", i, err)
+		}
+		pf := pendingFix{cert: cert, priority: p.Priority}
+		for _, der := range p.Chain {
+			cert, err := parseCertificate(der)
+			if err != nil {
+				return fmt.Errorf("failed to parse chain of pending entry %d: %s", i, err)
+			}
+			pf.chain = append(pf.chain, cert)
+		}
+		pending = append(pending, pf)
+	}
+
+	for _, h := range done {
+		f.done.set(h, true)
+		f.resumed.set(h, true)
+	}
+	for _, p := range pending {
+		f.QueueChainWithPriority(p.cert, p.chain, roots, p.priority)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package fixchain
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency/go/chains"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	leaf := GetTestCertificateFromPEM(t, googleLeaf)
+	fixed := &toFix{cert: leaf, chain: chains.Dedupe(extractTestChain(t, 0, []string{verisignRoot, thawteIntermediate}))}
+	pending := &toFix{cert: leaf, chain: chains.Dedupe(extractTestChain(t, 0, []string{thawteIntermediate})), priority: 3}
+
+	var old Fixer
+	old.done.set(fixed.hash(), true)
+	old.pending.add(pending.hash(), pending)
+	var buf bytes.Buffer
+	if err := old.Checkpoint(&buf); err != nil {
+		t.Fatalf("Checkpoint() failed: %s", err)
+	}
+
+	// Run the new Fixer in dry-run mode so that no fetches are made.
+	reports := make(chan *DryRunReport, 10)
+	f := NewFixerWithOptions(context.Background(), 1, nil, nil, &http.Client{}, FixerOptions{DryRunReports: reports})
+	if err := f.Resume(&buf, nil); err != nil {
+		t.Fatalf("Resume() failed: %s", err)
+	}
+	f.QueueChain(leaf, fixed.chain, nil)
+	f.Wait()
+	close(reports)
+
+	var got []*DryRunReport
+	for r := range reports {
+		got = append(got, r)
+	}
+	if len(got) != 1 {
+		t.Fatalf("Got %d chains fixed after Resume(), expected 1", len(got))
+	}
+	if len(got[0].Chain) != 1 || !got[0].Chain[0].Equal(pending.chain[0]) {
+		t.Error("Chain fixed after Resume() wasn't the pending chain")
+	}
+	if f.skipped != 1 {
+		t.Errorf("%d chains skipped, expected 1", f.skipped)
+	}
+
+	// The new Fixer's checkpoint still records the chain fixed before.
+	buf.Reset()
+	if err := f.Checkpoint(&buf); err != nil {
+		t.Fatalf("Checkpoint() failed: %s", err)
+	}
+	var again Fixer
+	if err := again.Resume(&buf, nil); err != nil {
+		t.Fatalf("Resume() failed: %s", err)
+	}
+	if !again.resumed.get(fixed.hash()) {
+		t.Error("Chain fixed before the first checkpoint wasn't in the second")
+	}
+}
+
+func TestResumeErrors(t *testing.T) {
+	resumeErrorTests := []struct {
+		checkpoint string
+		err        string
+	}{
+		{`not json`, "failed to decode"},
+		{`{"version":2,"done":[],"pending":[]}`, "unsupported checkpoint version 2"},
+		{`{"version":1,"done":["AAAA"],"pending":[]}`, "done entry 0 has length 3"},
+		{`{"version":1,"done":[],"pending":[{"cert":"AAAA"}]}`, "failed to parse certificate of pending entry 0"},
+	}
+
+	for i, test := range resumeErrorTests {
+		var f Fixer
+		err := f.Resume(strings.NewReader(test.checkpoint), x509.NewCertPool())
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("#%d: Resume() returned error %v, expected it to contain %q", i, err, test.err)
+		}
+	}
+}
@@ -3,43 +3,17 @@ package fixchain
 import (
 	"crypto/sha256"
 	"sync"
-
-	"github.com/google/certificate-transparency/go/x509"
 )
 
-type dedupedChain struct {
-	certs []*x509.Certificate
-}
-
-func (d *dedupedChain) addCert(cert *x509.Certificate) {
-	// Check that the certificate isn't being added twice.
-	for _, c := range d.certs {
-		if c.Equal(cert) {
-			return
-		}
-	}
-	d.certs = append(d.certs, cert)
-}
-
-func newDedupedChain(chain []*x509.Certificate) *dedupedChain {
-	d := &dedupedChain{}
-	for _, cert := range chain {
-		d.addCert(cert)
-	}
-	return d
-}
-
 const hashSize = sha256.Size
 
+// lockedMap is a set of hashes which is safe for concurrent use.  The zero
+// lockedMap is ready to use.
 type lockedMap struct {
 	m map[[hashSize]byte]bool
 	sync.RWMutex
 }
 
-func newLockedMap() *lockedMap {
-	return &lockedMap{m: make(map[[hashSize]byte]bool)}
-}
-
 func (m *lockedMap) get(hash [hashSize]byte) bool {
 	m.RLock()
 	defer m.RUnlock()
@@ -49,5 +23,68 @@ func (m *lockedMap) get(hash [hashSize]byte) bool {
 func (m *lockedMap) set(hash [hashSize]byte, b bool) {
 	m.Lock()
 	defer m.Unlock()
+	if m.m == nil {
+		m.m = make(map[[hashSize]byte]bool)
+	}
 	m.m[hash] = b
 }
+
+func (m *lockedMap) keys() [][hashSize]byte {
+	m.RLock()
+	defer m.RUnlock()
+	var keys [][hashSize]byte
+	for k, b := range m.m {
+		if b {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+type pendingEntry struct {
+	fix *toFix
+	n   int
+}
+
+// pendingMap holds the chains which have been queued but not yet fixed,
+// keyed by their hash. The zero pendingMap is ready to use.
+type pendingMap struct {
+	m map[[hashSize]byte]*pendingEntry
+	sync.Mutex
+}
+
+func (m *pendingMap) add(hash [hashSize]byte, fix *toFix) {
+	m.Lock()
+	defer m.Unlock()
+	if m.m == nil {
+		m.m = make(map[[hashSize]byte]*pendingEntry)
+	}
+	if e, ok := m.m[hash]; ok {
+		e.n++
+		return
+	}
+	m.m[hash] = &pendingEntry{fix: fix, n: 1}
+}
+
+func (m *pendingMap) remove(hash [hashSize]byte) {
+	m.Lock()
+	defer m.Unlock()
+	e, ok := m.m[hash]
+	if !ok {
+		return
+	}
+	e.n--
+	if e.n <= 0 {
+		delete(m.m, hash)
+	}
+}
+
+func (m *pendingMap) fixes() []*toFix {
+	m.Lock()
+	defer m.Unlock()
+	var fixes []*toFix
+	for _, e := range m.m {
+		fixes = append(fixes, e.fix)
+	}
+	return fixes
+}
@@ -0,0 +1,94 @@
+package fixchain
+
+import (
+	"github.com/google/certificate-transparency/go/chains"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// DryRunReport describes what would be done to fix a chain, without any
+// network fetches actually being made.
+type DryRunReport struct {
+	Cert  *x509.Certificate   // The supplied leaf certificate
+	Chain []*x509.Certificate // The supplied chain
+
+	// Whether the chain verifies as supplied, in which case nothing would
+	// be fetched.
+	Verified bool
+	// Every path from the leaf to a root which the supplied chain already
+	// provides, from x509.BuildAllPaths, including any which Verify would
+	// reject because of their key usages or name constraints.
+	Paths []x509.Path
+
+	// Certificates from the leaf and supplied chain whose issuer is not
+	// present in either the supplied chain or the roots.
+	MissingIssuers []*x509.Certificate
+
+	// The AIA URLs which would be fetched, in the order they would be tried,
+	// if the chain doesn't verify.  Fetching stops as soon as the chain
+	// can be verified, so not all of them would necessarily be contacted.
+	// URLs with a built-in replacement are not included, as they are never
+	// fetched.
+	URLs []string
+}
+
+// DryRun analyses the chain for the certificate that is passed to it, with
+// respect to the given roots, and reports which issuers are missing and which
+// URLs Fix would contact, without performing any network fetches.
+func DryRun(cert *x509.Certificate, chain []*x509.Certificate, roots *x509.CertPool) *DryRunReport {
+	fix := &toFix{
+		cert:  cert,
+		chain: chains.Dedupe(chain),
+		roots: roots,
+	}
+	return fix.dryRun()
+}
+
+func (fix *toFix) dryRun() *DryRunReport {
+	intermediates := x509.NewCertPool()
+	for _, c := range fix.chain {
+		intermediates.AddCert(c)
+	}
+	opts := x509.VerifyOptions{
+		Intermediates:     intermediates,
+		Roots:             fix.roots,
+		DisableTimeChecks: true,
+		KeyUsages:         []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	report := &DryRunReport{Cert: fix.cert, Chain: fix.chain}
+	report.Paths, _ = x509.BuildAllPaths(fix.cert, intermediates, fix.roots)
+	if _, err := fix.cert.Verify(opts); err == nil {
+		report.Verified = true
+		return report
+	}
+
+	subjects := make(map[string]bool)
+	for _, c := range fix.chain {
+		subjects[string(c.RawSubject)] = true
+	}
+	if fix.roots != nil {
+		for _, s := range fix.roots.Subjects() {
+			subjects[string(s)] = true
+		}
+	}
+
+	d := chains.Dedupe(append(append([]*x509.Certificate{}, fix.chain...), fix.cert))
+	seen := make(map[string]bool)
+	for _, c := range d {
+		// Self-issued certificates are their own issuer.
+		if string(c.RawIssuer) != string(c.RawSubject) && !subjects[string(c.RawIssuer)] {
+			report.MissingIssuers = append(report.MissingIssuers, c)
+		}
+		for _, url := range c.IssuingCertificateURL {
+			if seen[url] {
+				continue
+			}
+			seen[url] = true
+			if _, ok := replacements[url]; ok {
+				continue
+			}
+			report.URLs = append(report.URLs, url)
+		}
+	}
+	return report
+}
@@ -0,0 +1,70 @@
+package fixchain
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	dryRunTests := []struct {
+		cert  string
+		chain []string
+		roots []string
+
+		verified       bool
+		paths          int
+		missingIssuers []string
+		fetchLeafAIA   bool
+	}{
+		{ // Correct chain verifies, so nothing would be fetched
+			cert:  googleLeaf,
+			chain: []string{verisignRoot, thawteIntermediate},
+			roots: []string{verisignRoot},
+
+			verified: true,
+			paths:    1,
+		},
+		{ // Incomplete chain is missing the leaf's issuer
+			cert:  googleLeaf,
+			roots: []string{verisignRoot},
+
+			missingIssuers: []string{"Google"},
+			fetchLeafAIA:   true,
+		},
+		{ // Correct chain with no roots isn't missing any issuers
+			cert:  googleLeaf,
+			chain: []string{verisignRoot, thawteIntermediate},
+
+			fetchLeafAIA: true,
+		},
+	}
+
+	for i, test := range dryRunTests {
+		cert := GetTestCertificateFromPEM(t, test.cert)
+		report := DryRun(cert, extractTestChain(t, i, test.chain), extractTestRoots(t, i, test.roots))
+
+		if report.Verified != test.verified {
+			t.Errorf("#%d: Verified = %t, expected %t", i, report.Verified, test.verified)
+		}
+		if len(report.Paths) != test.paths {
+			t.Errorf("#%d: Got %d paths, expected %d", i, len(report.Paths), test.paths)
+		}
+		if len(report.MissingIssuers) != len(test.missingIssuers) {
+			t.Errorf("#%d: Got %d missing issuers, expected %d", i, len(report.MissingIssuers), len(test.missingIssuers))
+		} else {
+			for j, c := range report.MissingIssuers {
+				if !strings.Contains(nameToKey(&c.Subject), test.missingIssuers[j]) {
+					t.Errorf("#%d: Missing issuer #%d is for %s, expected %s", i, j, nameToKey(&c.Subject), test.missingIssuers[j])
+				}
+			}
+		}
+		var urls []string
+		if test.fetchLeafAIA {
+			urls = cert.IssuingCertificateURL
+		}
+		if !reflect.DeepEqual(report.URLs, urls) {
+			t.Errorf("#%d: URLs = %v, expected %v", i, report.URLs, urls)
+		}
+	}
+}
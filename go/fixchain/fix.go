@@ -1,11 +1,12 @@
 package fixchain
 
 import (
-	"encoding/pem"
-	"log"
 	"net/http"
+	"time"
 
+	"github.com/google/certificate-transparency/go/chains"
 	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
 )
 
 // Fix attempts to fix the certificate chain for the certificate that is passed
@@ -14,26 +15,51 @@ import (
 // presence of FixErrors does not mean the fix was unsuccessful.  Callers should
 // check for returned chains to determine success.
 func Fix(cert *x509.Certificate, chain []*x509.Certificate, roots *x509.CertPool, client *http.Client) ([][]*x509.Certificate, []*FixError) {
+	return FixWithContext(context.Background(), cert, chain, roots, client)
+}
+
+// FixWithContext attempts to fix the certificate chain in the same way as Fix,
+// but gives up, abandoning any outstanding HTTP fetches, if ctx is cancelled.
+// If ctx has a deadline which passes, a TimedOut error is returned.
+func FixWithContext(ctx context.Context, cert *x509.Certificate, chain []*x509.Certificate, roots *x509.CertPool, client *http.Client) ([][]*x509.Certificate, []*FixError) {
 	fix := &toFix{
+		ctx:   ctx,
 		cert:  cert,
-		chain: newDedupedChain(chain),
+		chain: chains.Dedupe(chain),
 		roots: roots,
-		cache: newURLCache(client, false),
+		cache: newURLCache(client, &FixerOptions{}),
+		fopts: &FixerOptions{},
 	}
 	return fix.handleChain()
 }
 
 type toFix struct {
+	ctx   context.Context
 	cert  *x509.Certificate
-	chain *dedupedChain
+	chain []*x509.Certificate
 	roots *x509.CertPool
 	opts  *x509.VerifyOptions
 	cache *urlCache
+	fopts *FixerOptions
+
+	// Position in the Fixer's queue.
+	priority int
+	seq      uint64
+	// Hash identifying the chain, set when it is queued by a Fixer.
+	key [hashSize]byte
+	// Time by which the attempt to fix the chain must finish, if any.
+	deadline time.Time
+
+	// Intermediates found while fixing the chain, and the best partial
+	// chain if it couldn't be fixed and partial chains were requested.
+	found   []*x509.Certificate
+	partial *PartialChain
 }
 
 func (fix *toFix) handleChain() ([][]*x509.Certificate, []*FixError) {
+	fix.ctx = withLeaf(fix.ctx, fix.cert)
 	intermediates := x509.NewCertPool()
-	for _, c := range fix.chain.certs {
+	for _, c := range fix.chain {
 		intermediates.AddCert(c)
 	}
 
@@ -42,6 +68,8 @@ func (fix *toFix) handleChain() ([][]*x509.Certificate, []*FixError) {
 		Roots:             fix.roots,
 		DisableTimeChecks: true,
 		KeyUsages:         []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		MaxChainLength:    fix.fopts.MaxChainLength,
+		DetectKeyLoops:    fix.fopts.DetectKeyLoops,
 	}
 
 	var retferrs []*FixError
@@ -52,8 +80,14 @@ func (fix *toFix) handleChain() ([][]*x509.Certificate, []*FixError) {
 		if ferrs != nil {
 			retferrs = append(retferrs, ferrs...)
 		}
+		if fix.ctx.Err() == context.DeadlineExceeded {
+			retferrs = append(retferrs, fix.timedOut())
+		}
+		if len(chains) == 0 && fix.fopts.PartialChains != nil {
+			fix.partial = fix.partialChain()
+		}
 	}
-	return chains, retferrs
+	return selectChains(chains, fix.fopts.ChainSelection, fix.fopts.PreferredRoot), retferrs
 }
 
 func (fix *toFix) constructChain() ([][]*x509.Certificate, []*FixError) {
@@ -63,7 +97,7 @@ func (fix *toFix) constructChain() ([][]*x509.Certificate, []*FixError) {
 			&FixError{
 				Type:  VerifyFailed,
 				Cert:  fix.cert,
-				Chain: fix.chain.certs,
+				Chain: fix.chain,
 				Error: err,
 			},
 		}
@@ -73,14 +107,22 @@ func (fix *toFix) constructChain() ([][]*x509.Certificate, []*FixError) {
 
 func (fix *toFix) fixChain() ([][]*x509.Certificate, []*FixError) {
 	var ferrs []*FixError
-	d := *fix.chain
-	d.addCert(fix.cert)
-	for _, c := range d.certs {
-		urls := c.IssuingCertificateURL
-		for _, url := range urls {
-			ferr := fix.augmentIntermediates(url)
-			if ferr != nil {
-				ferrs = append(ferrs, ferr)
+	d := chains.Dedupe(append(append([]*x509.Certificate{}, fix.chain...), fix.cert))
+strategies:
+	for _, s := range fix.fopts.strategies() {
+		for _, c := range d {
+			if fix.ctx.Err() != nil {
+				break strategies
+			}
+			issuers, err := s.FindIssuers(fix.ctx, c, fix.cache)
+			if err != nil {
+				ferrs = append(ferrs, fix.strategyErrors(s, err)...)
+			}
+			if len(issuers) == 0 {
+				continue
+			}
+			for _, issuer := range issuers {
+				fix.addIntermediate(issuer)
 			}
 			chains, err := fix.cert.Verify(*fix.opts)
 			if err == nil {
@@ -88,53 +130,52 @@ func (fix *toFix) fixChain() ([][]*x509.Certificate, []*FixError) {
 			}
 		}
 	}
+	// Report chains that were only abandoned because of the limits on
+	// chain construction, which may indicate a pathological CA graph.
+	if fix.opts.MaxChainLength > 0 || fix.opts.DetectKeyLoops {
+		_, err := fix.cert.Verify(*fix.opts)
+		if _, ok := err.(x509.ChainLimitError); ok {
+			ferrs = append(ferrs, &FixError{
+				Type:  ChainLimitExceeded,
+				Cert:  fix.cert,
+				Chain: fix.chain,
+				Error: err,
+			})
+		}
+	}
 	return nil, append(ferrs, &FixError{
 		Type:  FixFailed,
 		Cert:  fix.cert,
-		Chain: fix.chain.certs,
+		Chain: fix.chain,
 	})
 }
 
-func (fix *toFix) augmentIntermediates(url string) *FixError {
-	// PKCS#7 additions as (at time of writing) there is no standard Go PKCS#7
-	// implementation
-	r := urlReplacement(url)
-	if r != nil {
-		log.Printf("Replaced %s: %+v", url, r)
-		for _, c := range r {
-			fix.opts.Intermediates.AddCert(c)
+// setDeadline limits the attempt to fix the chain to the chain's deadline, or
+// to timeout from now if that is sooner.  The returned function releases the
+// resources used by the deadline, and must be called once the attempt is over.
+func (fix *toFix) setDeadline(timeout time.Duration) context.CancelFunc {
+	deadline := fix.deadline
+	if timeout > 0 {
+		if d := time.Now().Add(timeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
 		}
-		return nil
 	}
-
-	body, err := fix.cache.getURL(url)
-	if err != nil {
-		return &FixError{
-			Type:  CannotFetchURL,
-			Cert:  fix.cert,
-			Chain: fix.chain.certs,
-			URL:   url,
-			Error: err,
-		}
-	}
-	icert, err := x509.ParseCertificate(body)
-	if err != nil {
-		s, _ := pem.Decode(body)
-		if s != nil {
-			icert, err = x509.ParseCertificate(s.Bytes)
-		}
+	if deadline.IsZero() {
+		return func() {}
 	}
+	var cancel context.CancelFunc
+	fix.ctx, cancel = context.WithDeadline(fix.ctx, deadline)
+	return cancel
+}
 
-	if err != nil {
-		return &FixError{
-			Type:  ParseFailure,
-			Cert:  fix.cert,
-			Chain: fix.chain.certs,
-			URL:   url,
-			Bad:   body,
-			Error: err,
-		}
-	}
-	fix.opts.Intermediates.AddCert(icert)
-	return nil
+// timedOut returns the error reporting that the attempt to fix the chain
+// wasn't finished by its deadline.
+func (fix *toFix) timedOut() *FixError {
+	return &FixError{Type: TimedOut, Cert: fix.cert, Chain: fix.chain, Error: context.DeadlineExceeded}
+}
+
+// addIntermediate adds c to the intermediates used to verify the chain.
+func (fix *toFix) addIntermediate(c *x509.Certificate) {
+	fix.opts.Intermediates.AddCert(c)
+	fix.found = append(fix.found, c)
 }
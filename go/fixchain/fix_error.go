@@ -1,6 +1,8 @@
 package fixchain
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/google/certificate-transparency/go/x509"
@@ -16,34 +18,130 @@ const (
 	FixFailed
 	LogPostFailed
 	VerifyFailed
+	IssuerLookupFailed
+	ChainLimitExceeded
+	TimedOut
+	OutputDropped
 )
 
 // FixError is the struct with which errors in the fixing process are reported
 type FixError struct {
-	Type  errorType
-	Cert  *x509.Certificate   // The supplied leaf certificate
-	Chain []*x509.Certificate // The supplied chain
-	URL   string              // URL, if a URL is involved
-	Bad   []byte              // The offending bytes, if applicable
-	Error error               // And the error
+	Type       errorType
+	Cert       *x509.Certificate   // The supplied leaf certificate
+	Chain      []*x509.Certificate // The supplied chain
+	URL        string              // URL, if a URL is involved
+	HTTPStatus int                 // HTTP status, if fetching URL returned an error status
+	Bad        []byte              // The offending bytes, if applicable
+	Error      error               // And the error
+}
+
+var errorTypeStrings = map[errorType]string{
+	None:               "None",
+	ParseFailure:       "ParseFailure",
+	CannotFetchURL:     "CannotFetchURL",
+	FixFailed:          "FixFailed",
+	LogPostFailed:      "LogPostFailed",
+	VerifyFailed:       "VerifyFailed",
+	IssuerLookupFailed: "IssuerLookupFailed",
+	ChainLimitExceeded: "ChainLimitExceeded",
+	TimedOut:           "TimedOut",
+	OutputDropped:      "OutputDropped",
 }
 
 // TypeString returns a string describing e.Type
 func (e FixError) TypeString() string {
-	switch e.Type {
-	case None:
-		return "None"
-	case ParseFailure:
-		return "ParseFailure"
-	case CannotFetchURL:
-		return "CannotFetchURL"
-	case FixFailed:
-		return "FixFailed"
-	case LogPostFailed:
-		return "LogPostFailed"
-	case VerifyFailed:
-		return "VerifyFailed"
-	default:
-		return fmt.Sprintf("Type %d", e.Type)
+	if s, ok := errorTypeStrings[e.Type]; ok {
+		return s
+	}
+	return fmt.Sprintf("Type %d", e.Type)
+}
+
+// fixErrorJSON is the JSON encoding of a FixError.  The error type is encoded
+// by name, so that the encoding is stable if new types are added, and
+// certificates are encoded as base64 DER.
+type fixErrorJSON struct {
+	Type       string   `json:"type"`
+	Cert       []byte   `json:"cert,omitempty"`
+	Chain      [][]byte `json:"chain,omitempty"`
+	URL        string   `json:"url,omitempty"`
+	HTTPStatus int      `json:"http_status,omitempty"`
+	Bad        []byte   `json:"bad,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// MarshalJSON returns the JSON encoding of e.
+func (e FixError) MarshalJSON() ([]byte, error) {
+	j := fixErrorJSON{
+		Type:       e.TypeString(),
+		URL:        e.URL,
+		HTTPStatus: e.HTTPStatus,
+		Bad:        e.Bad,
+	}
+	if e.Cert != nil {
+		j.Cert = e.Cert.Raw
+	}
+	for _, c := range e.Chain {
+		j.Chain = append(j.Chain, c.Raw)
+	}
+	if e.Error != nil {
+		j.Error = e.Error.Error()
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON sets e to the FixError encoded in b, as produced by
+// MarshalJSON.  The original error can't be recovered, so e.Error is set to
+// an error with the same message.
+func (e *FixError) UnmarshalJSON(b []byte) error {
+	var j fixErrorJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	t, ok := errorTypeFromString(j.Type)
+	if !ok {
+		return fmt.Errorf("unknown FixError type %q", j.Type)
+	}
+	ferr := FixError{
+		Type:       t,
+		URL:        j.URL,
+		HTTPStatus: j.HTTPStatus,
+		Bad:        j.Bad,
+	}
+	if j.Cert != nil {
+		cert, err := parseCertificate(j.Cert)
+		if err != nil {
+			return err
+		}
+		ferr.Cert = cert
+	}
+	for _, der := range j.Chain {
+		cert, err := parseCertificate(der)
+		if err != nil {
+			return err
+		}
+		ferr.Chain = append(ferr.Chain, cert)
+	}
+	if j.Error != "" {
+		ferr.Error = errors.New(j.Error)
+	}
+	*e = ferr
+	return nil
+}
+
+func errorTypeFromString(s string) (errorType, bool) {
+	for t, ts := range errorTypeStrings {
+		if ts == s {
+			return t, true
+		}
+	}
+	return None, false
+}
+
+// parseCertificate parses der, ignoring non-fatal errors.
+func parseCertificate(der []byte) (*x509.Certificate, error) {
+	cert, err := x509.ParseCertificate(der)
+	if _, ok := err.(x509.NonFatalErrors); ok {
+		err = nil
 	}
+	return cert, err
 }
@@ -1,6 +1,11 @@
 package fixchain
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
 
 func TestTypeString(t *testing.T) {
 	fixErrorTests := []struct {
@@ -31,6 +36,22 @@ func TestTypeString(t *testing.T) {
 			FixError{Type: VerifyFailed},
 			"VerifyFailed",
 		},
+		{
+			FixError{Type: IssuerLookupFailed},
+			"IssuerLookupFailed",
+		},
+		{
+			FixError{Type: ChainLimitExceeded},
+			"ChainLimitExceeded",
+		},
+		{
+			FixError{Type: TimedOut},
+			"TimedOut",
+		},
+		{
+			FixError{Type: OutputDropped},
+			"OutputDropped",
+		},
 		{
 			FixError{},
 			"None",
@@ -43,3 +64,65 @@ func TestTypeString(t *testing.T) {
 		}
 	}
 }
+
+func TestFixErrorJSON(t *testing.T) {
+	leaf := GetTestCertificateFromPEM(t, googleLeaf)
+	chain := extractTestChain(t, 0, []string{thawteIntermediate, verisignRoot})
+	ferr := FixError{
+		Type:       CannotFetchURL,
+		Cert:       leaf,
+		Chain:      chain,
+		URL:        "http://example.com/ca.crt",
+		HTTPStatus: 503,
+		Bad:        []byte{1, 2, 3},
+		Error:      errors.New("can't deal with status 503"),
+	}
+
+	b, err := json.Marshal(ferr)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %s", err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("json.Unmarshal() into map failed: %s", err)
+	}
+	if got, want := m["type"], "CannotFetchURL"; got != want {
+		t.Errorf("Encoded type is %v, expected %s", got, want)
+	}
+	if got, want := m["http_status"], 503.0; got != want {
+		t.Errorf("Encoded http_status is %v, expected %v", got, want)
+	}
+
+	var got FixError
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %s", err)
+	}
+	if got.Type != ferr.Type || got.URL != ferr.URL || got.HTTPStatus != ferr.HTTPStatus ||
+		!bytes.Equal(got.Bad, ferr.Bad) || got.Error.Error() != ferr.Error.Error() {
+		t.Errorf("Round-tripped FixError %+v doesn't match original %+v", got, ferr)
+	}
+	if got.Cert == nil || !got.Cert.Equal(leaf) {
+		t.Error("Round-tripped FixError has wrong Cert")
+	}
+	if len(got.Chain) != len(chain) {
+		t.Fatalf("Round-tripped FixError has chain of length %d, expected %d", len(got.Chain), len(chain))
+	}
+	for i := range chain {
+		if !got.Chain[i].Equal(chain[i]) {
+			t.Errorf("Round-tripped FixError has wrong cert at chain position %d", i)
+		}
+	}
+
+	// Empty fields are left out, and zero values survive the round trip.
+	b, err = json.Marshal(FixError{Type: FixFailed})
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %s", err)
+	}
+	if got, want := string(b), `{"type":"FixFailed"}`; got != want {
+		t.Errorf("json.Marshal() = %s, expected %s", got, want)
+	}
+
+	if err := json.Unmarshal([]byte(`{"type":"NoSuchType"}`), &got); err == nil {
+		t.Error("json.Unmarshal() of unknown type succeeded")
+	}
+}
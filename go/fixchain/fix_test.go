@@ -2,9 +2,13 @@ package fixchain
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/google/certificate-transparency/go/chains"
 	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
 )
 
 var constructChainTests = []fixTest{
@@ -106,10 +110,12 @@ var fixChainTests = []fixTest{
 func setUpFix(t *testing.T, i int, ft *fixTest) *toFix {
 	// Create & populate toFix to test from fixTest info
 	fix := &toFix{
+		ctx:   context.Background(),
 		cert:  GetTestCertificateFromPEM(t, ft.cert),
-		chain: newDedupedChain(extractTestChain(t, i, ft.chain)),
+		chain: chains.Dedupe(extractTestChain(t, i, ft.chain)),
 		roots: extractTestRoots(t, i, ft.roots),
-		cache: newURLCache(&http.Client{}, false),
+		cache: newURLCache(&http.Client{}, &FixerOptions{}),
+		fopts: &FixerOptions{},
 	}
 
 	intermediates := x509.NewCertPool()
@@ -169,3 +175,58 @@ func TestFix(t *testing.T) {
 		matchTestErrorList(t, i, test.expectedErrs, ferrs)
 	}
 }
+
+func TestFixChainParallelFetch(t *testing.T) {
+	cancelled := make(chan bool, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			cancelled <- true
+		case <-time.After(10 * time.Second):
+			cancelled <- false
+		}
+	})
+	mux.HandleFunc("/issuer", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(thawteIntermediate))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	ft := &fixTest{cert: googleLeaf, roots: []string{verisignRoot}}
+	fix := setUpFix(t, 0, ft)
+	// The slow URL is listed first, so it would hold up a sequential fix.
+	leaf := *fix.cert
+	leaf.IssuingCertificateURL = []string{ts.URL + "/slow", ts.URL + "/issuer"}
+	fix.cert = &leaf
+
+	start := time.Now()
+	chains, ferrs := fix.fixChain()
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("fixChain() waited for the slow URL")
+	}
+	matchTestChainList(t, 0, [][]string{{"Google", "Thawte", "VeriSign"}}, chains)
+	matchTestErrorList(t, 0, nil, ferrs)
+	if !<-cancelled {
+		t.Error("Fetch of slow URL wasn't cancelled")
+	}
+}
+
+func TestFixChainLimits(t *testing.T) {
+	ft := &fixTest{
+		cert:  googleLeaf,
+		chain: []string{thawteIntermediate},
+		roots: []string{verisignRoot},
+	}
+	fix := setUpFix(t, 0, ft)
+	fix.fopts.MaxChainLength = 2
+	// Don't fetch anything, so the only way to fix the chain is to exceed
+	// the limit.
+	leaf := *fix.cert
+	leaf.IssuingCertificateURL = nil
+	fix.cert = &leaf
+
+	chains, ferrs := fix.handleChain()
+	matchTestChainList(t, 0, nil, chains)
+	matchTestErrorList(t, 0, []errorType{VerifyFailed, ChainLimitExceeded, FixFailed}, ferrs)
+}
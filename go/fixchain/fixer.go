@@ -1,52 +1,119 @@
 package fixchain
 
 import (
+	"io"
 	"log"
 	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/google/certificate-transparency/go/chains"
+	"github.com/google/certificate-transparency/go/revocation"
 	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
 )
 
 // Fixer contains methods to asynchronously fix certificate chains and
 // properties to store information about each attempt that is made to fix a
 // certificate chain.
 type Fixer struct {
-	toFix  chan *toFix
+	// Counters are updated atomically, and read with Stats.  The 64-bit
+	// counters come first so they are 64-bit aligned on 32-bit platforms,
+	// as sync/atomic requires.
+	queued           int64
+	reconstructed    uint64
+	notReconstructed uint64
+	fixed            uint64
+	notFixed         uint64
+	skipped          uint64
+	alreadyDone      uint64
+	timedOut         uint64
+	dropped          uint64
+	blockedFor       int64 // Nanoseconds
+	active           uint32
+
+	ctx    context.Context
+	toFix  chan *toFix                // Chains queued to be fixed
+	work   chan *toFix                // Chains handed out to workers, in priority order
 	chains chan<- []*x509.Certificate // Chains successfully fixed by the fixer
 	errors chan<- *FixError
 
-	active uint32
-	// Counters may not be entirely accurate due to non-atomicity
-	reconstructed    uint
-	notReconstructed uint
-	fixed            uint
-	notFixed         uint
-	skipped          uint
-	alreadyDone      uint
+	wg       sync.WaitGroup
+	outputWG sync.WaitGroup
 
-	wg    sync.WaitGroup
-	cache *urlCache
-	done  *lockedMap
+	workersMu sync.Mutex
+	workers   []chan struct{} // Closed to remove each worker
+	cache     *urlCache
+	done      lockedMap  // Chains which have been fixed
+	resumed   lockedMap  // Chains fixed before the checkpoint passed to Resume
+	pending   pendingMap // Chains which have been queued but not yet fixed
+	inFlight  fixGroup
+	metrics   Metrics
+	reports   chan<- *DryRunReport
+	partials  chan<- *PartialChain
+	opts      FixerOptions
 }
 
 // QueueChain adds the given cert and chain to the queue to be fixed by the
-// fixer, with respect to the given roots.
+// fixer, with respect to the given roots.  If the Fixer's context has been
+// cancelled the chain is dropped.
 func (f *Fixer) QueueChain(cert *x509.Certificate, chain []*x509.Certificate, roots *x509.CertPool) {
-	f.toFix <- &toFix{
-		cert:  cert,
-		chain: newDedupedChain(chain),
-		roots: roots,
-		cache: f.cache,
+	f.QueueChainWithPriority(cert, chain, roots, 0)
+}
+
+// QueueChainWithPriority adds the given cert and chain to the queue in the same
+// way as QueueChain, but the chain will be fixed before any queued chains with
+// a lower priority.  QueueChain uses priority 0.  ExpiryPriority can be used
+// to fix certificates which are close to expiry first.
+//
+// Chains which were fixed before the checkpoint passed to Resume are skipped.
+func (f *Fixer) QueueChainWithPriority(cert *x509.Certificate, chain []*x509.Certificate, roots *x509.CertPool, priority int) {
+	f.queueChain(cert, chain, roots, priority, time.Time{})
+}
+
+// QueueChainWithDeadline adds the given cert and chain to the queue in the
+// same way as QueueChainWithPriority, but the attempt to fix the chain is
+// abandoned with a TimedOut error if it hasn't finished by deadline, including
+// any time spent waiting in the queue.  If FixerOptions.ChainTimeout is set,
+// the earlier of the two applies.
+func (f *Fixer) QueueChainWithDeadline(cert *x509.Certificate, chain []*x509.Certificate, roots *x509.CertPool, priority int, deadline time.Time) {
+	f.queueChain(cert, chain, roots, priority, deadline)
+}
+
+func (f *Fixer) queueChain(cert *x509.Certificate, chain []*x509.Certificate, roots *x509.CertPool, priority int, deadline time.Time) {
+	fix := &toFix{
+		ctx:      f.ctx,
+		cert:     cert,
+		chain:    chains.Dedupe(chain),
+		roots:    roots,
+		cache:    f.cache,
+		fopts:    &f.opts,
+		priority: priority,
+		deadline: deadline,
+	}
+	fix.key = fix.hash()
+	if f.resumed.get(fix.key) {
+		atomic.AddUint64(&f.skipped, 1)
+		f.metrics.IncCounter(SkippedCounter)
+		return
+	}
+
+	atomic.AddInt64(&f.queued, 1)
+	defer atomic.AddInt64(&f.queued, -1)
+	f.pending.add(fix.key, fix)
+	select {
+	case f.toFix <- fix:
+	case <-f.ctx.Done():
 	}
 }
 
-// Wait for all the fixer workers to finish.
+// Wait for all the fixer workers to finish, and for any buffered output to be
+// pushed to the chains and errors channels.
 func (f *Fixer) Wait() {
 	close(f.toFix)
 	f.wg.Wait()
+	f.closeOutputBuffers()
 }
 
 func (f *Fixer) updateCounters(ferrs []*FixError) {
@@ -58,6 +125,9 @@ func (f *Fixer) updateCounters(ferrs []*FixError) {
 			verifyFailed = true
 		case FixFailed:
 			fixFailed = true
+		case TimedOut:
+			atomic.AddUint64(&f.timedOut, 1)
+			f.metrics.IncCounter(TimedOutCounter)
 		}
 	}
 	// No errors --> reconstructed
@@ -65,71 +135,319 @@ func (f *Fixer) updateCounters(ferrs []*FixError) {
 	// VerifyFailed but no FixFailed --> fixed
 	// VerifyFailed and FixFailed --> notFixed
 	if verifyFailed {
-		f.notReconstructed++
+		atomic.AddUint64(&f.notReconstructed, 1)
+		f.metrics.IncCounter(NotReconstructedCounter)
 		// FixFailed error will only be present if a VerifyFailed error is, as
 		// fixChain() is only called if constructChain() fails.
 		if fixFailed {
-			f.notFixed++
+			atomic.AddUint64(&f.notFixed, 1)
+			f.metrics.IncCounter(NotFixedCounter)
 			return
 		}
-		f.fixed++
+		atomic.AddUint64(&f.fixed, 1)
+		f.metrics.IncCounter(FixedCounter)
 		return
 	}
-	f.reconstructed++
+	atomic.AddUint64(&f.reconstructed, 1)
+	f.metrics.IncCounter(ReconstructedCounter)
 }
 
-func (f *Fixer) fixServer() {
+// fixServer fixes chains handed out by dispatch until there are no more, the
+// Fixer's context is cancelled, or quit is closed.  A nil quit is never closed.
+func (f *Fixer) fixServer(quit <-chan struct{}) {
 	defer f.wg.Done()
 
-	for fix := range f.toFix {
-		atomic.AddUint32(&f.active, 1)
-		chains, ferrs := fix.handleChain()
-		f.updateCounters(ferrs)
-		for _, ferr := range ferrs {
-			f.errors <- ferr
+	for {
+		// Check quit first, as a worker for which both quit and work
+		// are ready would otherwise choose between them at random.
+		select {
+		case <-quit:
+			return
+		default:
+		}
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-quit:
+			return
+		case fix, ok := <-f.work:
+			if !ok {
+				return
+			}
+			f.metrics.SetGauge(ActiveWorkersGauge, int64(atomic.AddUint32(&f.active, 1)))
+			if f.reports != nil {
+				select {
+				case f.reports <- fix.dryRun():
+				case <-f.ctx.Done():
+				}
+			} else {
+				cancel := fix.setDeadline(f.opts.ChainTimeout)
+				chains, ferrs, shared, err := f.inFlight.do(fix.ctx, fix.key, fix.handleChain)
+				cancel()
+				switch {
+				case err == context.DeadlineExceeded:
+					// The chain's own deadline passed while it waited for
+					// the attempt it was coalesced with.
+					ferrs = []*FixError{fix.timedOut()}
+					f.updateCounters(ferrs)
+				case err != nil:
+					// The Fixer was cancelled while waiting, or the
+					// attempt panicked, so there is nothing to report.
+				case shared:
+					// Another worker made this attempt and updated the
+					// counters for it.
+					atomic.AddUint64(&f.alreadyDone, 1)
+					f.metrics.IncCounter(AlreadyDoneCounter)
+				default:
+					f.updateCounters(ferrs)
+				}
+				if err == nil || err == context.DeadlineExceeded {
+					f.output(chains, ferrs)
+				}
+				if !shared && fix.partial != nil {
+					select {
+					case f.partials <- fix.partial:
+					case <-f.ctx.Done():
+					}
+				}
+			}
+			// If the context was cancelled part way through, the chain
+			// stays pending so that it is fixed again after a Resume.
+			if f.ctx.Err() == nil {
+				if f.reports == nil {
+					f.done.set(fix.key, true)
+				}
+				f.pending.remove(fix.key)
+			}
+			f.metrics.SetGauge(ActiveWorkersGauge, int64(atomic.AddUint32(&f.active, ^uint32(0))))
+		}
+	}
+}
+
+// output pushes the results of a fix attempt to the Fixer's channels
+// according to its OutputPolicy, giving up early if the Fixer's context is
+// cancelled.
+func (f *Fixer) output(chains [][]*x509.Certificate, ferrs []*FixError) {
+	for _, ferr := range ferrs {
+		if !f.sendError(ferr) {
+			return
 		}
-		for _, chain := range chains {
-			f.chains <- chain
+	}
+	if f.opts.ChainsWithMetadata != nil {
+		for _, c := range scoreChains(chains, time.Now()) {
+			if f.opts.Revocation != nil {
+				c.Revocation = revocation.CheckChain(f.ctx, f.opts.Revocation, c.Chain)
+			}
+			if !f.sendChain(c.Chain, c) {
+				return
+			}
+		}
+		return
+	}
+	for _, chain := range chains {
+		if !f.sendChain(chain, nil) {
+			return
 		}
-		atomic.AddUint32(&f.active, ^uint32(0))
 	}
 }
 
-func (f *Fixer) newFixServerPool(workerCount int) {
-	for i := 0; i < workerCount; i++ {
+// SetWorkerCount changes the number of workers fixing chains to n, so that
+// concurrency can be scaled up or down while the Fixer is running, e.g. when
+// remote servers are rate limiting it.  Removed workers finish fixing the
+// chain they are working on, if any, before they exit; SetWorkerCount doesn't
+// wait for them.  While there are no workers, queued chains wait to be fixed
+// and Wait blocks.
+func (f *Fixer) SetWorkerCount(n int) {
+	if n < 0 {
+		n = 0
+	}
+	f.workersMu.Lock()
+	defer f.workersMu.Unlock()
+	for len(f.workers) < n {
+		quit := make(chan struct{})
+		f.workers = append(f.workers, quit)
 		f.wg.Add(1)
-		go f.fixServer()
+		go f.fixServer(quit)
 	}
+	for len(f.workers) > n {
+		last := len(f.workers) - 1
+		close(f.workers[last])
+		f.workers = f.workers[:last]
+	}
+	f.metrics.SetGauge(WorkersGauge, int64(n))
+}
+
+// WorkerCount returns the number of workers, as last set by SetWorkerCount or
+// when the Fixer was created.  Removed workers which are still finishing
+// their last chain aren't counted.
+func (f *Fixer) WorkerCount() int {
+	f.workersMu.Lock()
+	defer f.workersMu.Unlock()
+	return len(f.workers)
 }
 
 func (f *Fixer) logStats() {
 	t := time.NewTicker(time.Second)
 	go func() {
 		for _ = range t.C {
+			s := f.Stats()
 			log.Printf("fixers: %d active, "+
 				"%d reconstructed, %d not reconstructed, "+
 				"%d fixed, %d not fixed, %d skipped, %d already done",
-				f.active, f.reconstructed, f.notReconstructed,
-				f.fixed, f.notFixed, f.skipped, f.alreadyDone)
+				s.Active, s.Reconstructed, s.NotReconstructed,
+				s.Fixed, s.NotFixed, s.Skipped, s.AlreadyDone)
 		}
 	}()
 }
 
+// FixerOptions holds configuration options for the Fixer.
+type FixerOptions struct {
+	// Cache used to store the bodies of URLs fetched while fixing chains.
+	// If nil, an in-memory cache is used.
+	Cache CacheBackend
+
+	// Which of the valid chains found for each certificate to output.
+	ChainSelection ChainSelection
+
+	// Root used to choose chains when ChainSelection is
+	// PreferredRootChains, e.g. to prefer the ISRG root over the DST root
+	// which cross-signs it.
+	PreferredRoot *x509.Certificate
+
+	// Local store of intermediates which is searched for missing issuers
+	// before any of the Strategies, so that chains which can be fixed from
+	// it are fixed without any network access.
+	Intermediates *IntermediateStore
+
+	// Strategies used to find the issuers missing from chains, in the order
+	// they are tried.  If nil, DefaultStrategies is used.
+	Strategies []Strategy
+
+	// Sources, such as CT logs, which are searched for missing issuers after
+	// the Strategies have been tried, in order.  This is equivalent to
+	// adding an IssuerSourceStrategy for each to the end of Strategies.
+	IssuerSources []IssuerSource
+
+	// Maximum number of certificates, including the leaf and root, in the
+	// chains that are built.  Zero means no limit.
+	MaxChainLength int
+
+	// Stop building chains through the same subject and public key twice,
+	// as happens in cross-signed hierarchies where CAs sign each other,
+	// rather than only when the same certificate appears twice.
+	DetectKeyLoops bool
+
+	// Maximum time a worker spends trying to fix any one chain, after which
+	// the attempt is abandoned with a TimedOut error, so that slow servers
+	// can't stall workers indefinitely.  Zero means no limit.
+	ChainTimeout time.Duration
+
+	// Configuration of the HTTP client used to fetch URLs, which is built
+	// from it when no client is passed to NewFixerWithOptions.
+	HTTP *HTTPOptions
+
+	// How long URLs which are found to be dead, because they return 404 Not
+	// Found or 410 Gone or their server refuses connections, are
+	// remembered as such and not fetched again.  Zero disables negative
+	// caching.
+	NegativeCacheTTL time.Duration
+
+	// Policy for retrying fetches of URLs which fail with a transient error.
+	// The zero value makes a single attempt.
+	Retry RetryPolicy
+
+	// Maximum number of requests per second made to any one host when
+	// fetching URLs, in bursts of up to HostBurst requests.  Zero means
+	// unlimited.
+	HostRateLimit float64
+	HostBurst     int
+
+	// Metrics to which the Fixer exports its statistics.  If nil, they are
+	// only available through LogStats.
+	Metrics Metrics
+
+	// If non-nil, the Fixer runs in dry-run mode: instead of fixing each
+	// chain it pushes a DryRunReport describing what it would fetch to
+	// this channel, and nothing is pushed to the chains or errors channels.
+	DryRunReports chan<- *DryRunReport
+
+	// If non-nil, whenever a chain can't be fixed the longest partial
+	// chain that could be built from the leaf, and the reason it couldn't
+	// be completed, is pushed to this channel.  Chains identical to one
+	// that is being fixed concurrently only produce one PartialChain.
+	PartialChains chan<- *PartialChain
+
+	// Number of chains and of errors buffered between the workers and the
+	// chains and errors channels, so that workers aren't held up by a
+	// consumer which is briefly slow.  Zero means unbuffered.
+	OutputBuffer int
+
+	// What workers do when they can't push a result because the chains,
+	// ChainsWithMetadata or errors channel, and its buffer, are full.  Under DropOutput, results
+	// are dropped after waiting for OutputTimeout, so that a stalled
+	// consumer can't stall the workers indefinitely.
+	OutputPolicy  OutputPolicy
+	OutputTimeout time.Duration
+
+	// If non-nil, fixed chains are pushed to this channel together with
+	// their ChainQuality, best first, instead of to the chains channel.
+	ChainsWithMetadata chan<- *ChainWithMetadata
+
+	// If non-nil, the revocation status of the certificates in the chains
+	// pushed to ChainsWithMetadata is checked with it, and recorded in
+	// their Revocation, e.g. with a revocation.HTTPChecker.
+	Revocation revocation.Checker
+
+	// If non-nil, every attempt to fetch a URL is recorded in this audit
+	// log as a line of JSON encoding an AuditRecord.  Writes are serialised.
+	AuditLog io.Writer
+
+	// Periodically log statistics about the Fixer and its cache.
+	LogStats bool
+}
+
 // NewFixer creates a new asynchronous fixer and starts up a pool of
 // workerCount workers.  Errors are pushed to the errors channel, and fixed
 // chains are pushed to the chains channel.  client is used to try to get any
 // missing certificates that are needed when attempting to fix chains.
 func NewFixer(workerCount int, chains chan<- []*x509.Certificate, errors chan<- *FixError, client *http.Client, logStats bool) *Fixer {
+	return NewFixerWithContext(context.Background(), workerCount, chains, errors, client, logStats)
+}
+
+// NewFixerWithContext creates a new asynchronous fixer in the same way as
+// NewFixer, but all of its workers, and any HTTP fetches they have in flight,
+// stop as soon as ctx is cancelled.  Chains queued after cancellation are
+// dropped.
+func NewFixerWithContext(ctx context.Context, workerCount int, chains chan<- []*x509.Certificate, errors chan<- *FixError, client *http.Client, logStats bool) *Fixer {
+	return NewFixerWithOptions(ctx, workerCount, chains, errors, client, FixerOptions{LogStats: logStats})
+}
+
+// NewFixerWithOptions creates a new asynchronous fixer in the same way as
+// NewFixerWithContext, taking the rest of its configuration from opts.  If
+// client is nil and opts.HTTP is set, the client is built from opts.HTTP.
+func NewFixerWithOptions(ctx context.Context, workerCount int, chains chan<- []*x509.Certificate, errors chan<- *FixError, client *http.Client, opts FixerOptions) *Fixer {
 	f := &Fixer{
+		ctx:    ctx,
 		toFix:  make(chan *toFix),
+		work:   make(chan *toFix),
 		chains: chains,
 		errors: errors,
-		cache:  newURLCache(client, logStats),
-		done:   newLockedMap(),
+		cache:  newURLCache(client, &opts),
+		opts:   opts,
+	}
+	f.metrics = opts.Metrics
+	f.reports = opts.DryRunReports
+	f.partials = opts.PartialChains
+	if f.metrics == nil {
+		f.metrics = nopMetrics{}
+	}
+	if opts.OutputBuffer > 0 {
+		f.startOutputBuffers(opts.OutputBuffer)
 	}
 
-	f.newFixServerPool(workerCount)
-	if logStats {
+	go f.dispatch()
+	f.SetWorkerCount(workerCount)
+	if opts.LogStats {
 		f.logStats()
 	}
 	return f
@@ -2,11 +2,14 @@ package fixchain
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
 )
 
 // Helper functions
@@ -57,10 +60,130 @@ func TestNewFixer(t *testing.T) {
 	wg.Wait()
 }
 
+// NewFixerWithContext() test
+func TestNewFixerWithContextCancel(t *testing.T) {
+	chains := make(chan []*x509.Certificate)
+	errors := make(chan *FixError)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	f := NewFixerWithContext(ctx, 10, chains, errors, &http.Client{}, false)
+	cancel()
+	// Nothing is reading from chains or errors, so if the cancelled Fixer
+	// still tried to fix these chains QueueChain() or Wait() would block.
+	for _, test := range handleChainTests {
+		f.QueueChain(GetTestCertificateFromPEM(t, test.cert),
+			extractTestChain(t, 0, test.chain), extractTestRoots(t, 0, test.roots))
+	}
+	f.Wait()
+}
+
+func TestChainDeadline(t *testing.T) {
+	// The AIA server never responds until the test is over.
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	leaf := *GetTestCertificateFromPEM(t, googleLeaf)
+	leaf.IssuingCertificateURL = []string{ts.URL}
+	roots := extractTestRoots(t, 0, []string{verisignRoot})
+
+	tests := []struct {
+		timeout      time.Duration
+		deadline     time.Duration // From when the chain is queued
+		expectedErrs []errorType
+	}{
+		{
+			timeout:      50 * time.Millisecond,
+			expectedErrs: []errorType{VerifyFailed, CannotFetchURL, FixFailed, TimedOut},
+		},
+		{
+			deadline:     50 * time.Millisecond,
+			expectedErrs: []errorType{VerifyFailed, CannotFetchURL, FixFailed, TimedOut},
+		},
+		{
+			// The deadline has passed before the attempt starts, so
+			// nothing is fetched.
+			timeout:      time.Hour,
+			deadline:     -time.Second,
+			expectedErrs: []errorType{VerifyFailed, FixFailed, TimedOut},
+		},
+	}
+
+	for i, test := range tests {
+		chains := make(chan []*x509.Certificate)
+		errors := make(chan *FixError)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go testChains(t, i, nil, chains, &wg)
+		go testErrors(t, i, test.expectedErrs, errors, &wg)
+
+		f := NewFixerWithOptions(context.Background(), 1, chains, errors, &http.Client{}, FixerOptions{ChainTimeout: test.timeout})
+		var deadline time.Time
+		if test.deadline != 0 {
+			deadline = time.Now().Add(test.deadline)
+		}
+		f.QueueChainWithDeadline(&leaf, nil, roots, 0, deadline)
+		f.Wait()
+		close(chains)
+		close(errors)
+		wg.Wait()
+
+		if s := f.Stats(); s.TimedOut != 1 || s.NotFixed != 1 {
+			t.Errorf("#%d: Stats() returned %+v, expected 1 timed out and not fixed", i, s)
+		}
+	}
+}
+
+func TestSetWorkerCount(t *testing.T) {
+	chains := make(chan []*x509.Certificate, 10)
+	errors := make(chan *FixError, 10)
+	f := NewFixer(2, chains, errors, &http.Client{}, false)
+	if n := f.WorkerCount(); n != 2 {
+		t.Errorf("WorkerCount() = %d, expected 2", n)
+	}
+	f.SetWorkerCount(5)
+	if n := f.WorkerCount(); n != 5 {
+		t.Errorf("WorkerCount() = %d after scaling up, expected 5", n)
+	}
+
+	// With no workers, queued chains wait until workers are added.
+	f.SetWorkerCount(0)
+	if s := f.Stats(); s.Workers != 0 {
+		t.Errorf("Stats() returned %d workers after scaling down, expected 0", s.Workers)
+	}
+	leaf := GetTestCertificateFromPEM(t, googleLeaf)
+	chain := extractTestChain(t, 0, []string{thawteIntermediate})
+	roots := extractTestRoots(t, 0, []string{verisignRoot})
+	queued := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			f.QueueChain(leaf, chain, roots)
+		}
+		close(queued)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if s := f.Stats(); s.Reconstructed != 0 {
+		t.Errorf("Stats() returned %d reconstructed with no workers, expected 0", s.Reconstructed)
+	}
+
+	f.SetWorkerCount(1)
+	<-queued
+	f.Wait()
+	if s := f.Stats(); s.Reconstructed != 3 {
+		t.Errorf("Stats() returned %d reconstructed, expected 3", s.Reconstructed)
+	}
+	if len(chains) != 3 || len(errors) != 0 {
+		t.Errorf("Fixer output %d chains and %d errors, expected 3 chains", len(chains), len(errors))
+	}
+}
+
 // Fixer.fixServer() test
 func TestFixServer(t *testing.T) {
-	cache := &urlCache{cache: make(map[string][]byte), client: &http.Client{}}
-	f := &Fixer{cache: cache}
+	cache := newURLCache(&http.Client{}, &FixerOptions{})
+	f := &Fixer{ctx: context.Background(), cache: cache, metrics: nopMetrics{}}
 
 	var wg sync.WaitGroup
 	fixServerTests := handleChainTests
@@ -71,6 +194,7 @@ func TestFixServer(t *testing.T) {
 		chains := make(chan []*x509.Certificate)
 		errors := make(chan *FixError)
 		f.toFix = make(chan *toFix)
+		f.work = make(chan *toFix)
 		f.chains = chains
 		f.errors = errors
 
@@ -78,8 +202,9 @@ func TestFixServer(t *testing.T) {
 		go testChains(t, i, fst.expectedChains, chains, &wg)
 		go testErrors(t, i, fst.expectedErrs, errors, &wg)
 
+		go f.dispatch()
 		f.wg.Add(1)
-		go f.fixServer()
+		go f.fixServer(nil)
 		f.QueueChain(GetTestCertificateFromPEM(t, fst.cert),
 			extractTestChain(t, i, fst.chain), extractTestRoots(t, i, fst.roots))
 		f.Wait()
@@ -94,6 +219,7 @@ func TestFixServer(t *testing.T) {
 	chains := make(chan []*x509.Certificate)
 	errors := make(chan *FixError)
 	f.toFix = make(chan *toFix)
+	f.work = make(chan *toFix)
 	f.chains = chains
 	f.errors = errors
 
@@ -109,8 +235,9 @@ func TestFixServer(t *testing.T) {
 	go testChains(t, i, expectedChains, chains, &wg)
 	go testErrors(t, i, expectedErrs, errors, &wg)
 
+	go f.dispatch()
 	f.wg.Add(1)
-	go f.fixServer()
+	go f.fixServer(nil)
 	for _, fst := range fixServerTests {
 		f.QueueChain(GetTestCertificateFromPEM(t, fst.cert),
 			extractTestChain(t, i, fst.chain), extractTestRoots(t, i, fst.roots))
@@ -126,10 +253,10 @@ func TestFixServer(t *testing.T) {
 func TestUpdateCounters(t *testing.T) {
 	counterTests := []struct {
 		errors           []errorType
-		reconstructed    uint
-		notReconstructed uint
-		fixed            uint
-		notFixed         uint
+		reconstructed    uint64
+		notReconstructed uint64
+		fixed            uint64
+		notFixed         uint64
 	}{
 		{[]errorType{}, 1, 0, 0, 0},
 		{[]errorType{VerifyFailed}, 0, 1, 1, 0},
@@ -141,7 +268,7 @@ func TestUpdateCounters(t *testing.T) {
 	}
 
 	for i, test := range counterTests {
-		f := &Fixer{}
+		f := &Fixer{metrics: nopMetrics{}}
 		var ferrs []*FixError
 		for _, err := range test.errors {
 			ferrs = append(ferrs, &FixError{Type: err})
@@ -166,6 +293,29 @@ func TestUpdateCounters(t *testing.T) {
 	}
 }
 
+func TestStats(t *testing.T) {
+	f := &Fixer{metrics: nopMetrics{}, cache: newURLCache(&http.Client{}, &FixerOptions{})}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.updateCounters([]*FixError{{Type: VerifyFailed}})
+			f.Stats()
+		}()
+	}
+	wg.Wait()
+	f.cache.getURL(context.Background(), "not a url")
+
+	s := f.Stats()
+	if s.NotReconstructed != 10 || s.Fixed != 10 || s.Reconstructed != 0 || s.NotFixed != 0 {
+		t.Errorf("Stats() returned %+v, expected 10 not reconstructed and fixed", s)
+	}
+	if s.Cache.Errors != 1 {
+		t.Errorf("Stats() returned %d cache errors, expected 1", s.Cache.Errors)
+	}
+}
+
 // Fixer.QueueChain() tests
 type queueTest struct {
 	cert  string
@@ -202,13 +352,13 @@ func testQueueChain(t *testing.T, i int, qt *queueTest, f *Fixer) {
 	defer f.wg.Done()
 	fix := <-f.toFix
 	// Check the deduped chain
-	if len(fix.chain.certs) != len(qt.dchain) {
+	if len(fix.chain) != len(qt.dchain) {
 		t.Errorf("#%d: Expected a chain of length %d, got one of length %d",
-			i, len(qt.dchain), len(fix.chain.certs))
+			i, len(qt.dchain), len(fix.chain))
 	}
 
 	if qt.dchain != nil {
-		for j, cert := range fix.chain.certs {
+		for j, cert := range fix.chain {
 			if !strings.Contains(nameToKey(&cert.Subject), qt.dchain[j]) {
 				t.Errorf("#%d: Chain does not match expected chain at position %d", i, j)
 			}
@@ -219,7 +369,7 @@ func testQueueChain(t *testing.T, i int, qt *queueTest, f *Fixer) {
 func TestQueueChain(t *testing.T) {
 	ch := make(chan *toFix)
 	defer close(ch)
-	f := &Fixer{toFix: ch}
+	f := &Fixer{ctx: context.Background(), toFix: ch, metrics: nopMetrics{}}
 
 	for i, qt := range queueTests {
 		f.wg.Add(1)
@@ -0,0 +1,116 @@
+package fixchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// errFixPanicked is returned to callers waiting for a fix attempt which
+// panicked.
+var errFixPanicked = errors.New("fix attempt panicked")
+
+// fixCall is a fix attempt that is in progress, or has completed.
+type fixCall struct {
+	done    chan struct{} // Closed when the attempt completes
+	waiters int           // Callers waiting for the attempt, guarded by the fixGroup's mu
+	chains  [][]*x509.Certificate
+	ferrs   []*FixError
+	err     error
+}
+
+// fixGroup coalesces concurrent attempts to fix identical chains, so that
+// only one attempt is made and its result is shared.  The zero fixGroup is
+// ready to use.
+type fixGroup struct {
+	mu sync.Mutex
+	m  map[[hashSize]byte]*fixCall
+}
+
+// do calls fn and returns its result, unless an attempt with the same key is
+// already in progress, in which case it waits for that attempt to complete and
+// returns its result instead, with shared set to true.  A caller which stops
+// waiting because ctx is done gets ctx's error, as does one whose attempt
+// panicked errFixPanicked.
+func (g *fixGroup) do(ctx context.Context, key [hashSize]byte, fn func() ([][]*x509.Certificate, []*FixError)) (chains [][]*x509.Certificate, ferrs []*FixError, shared bool, err error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[[hashSize]byte]*fixCall)
+	}
+	if c, ok := g.m[key]; ok {
+		c.waiters++
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.chains, c.ferrs, true, c.err
+		case <-ctx.Done():
+			return nil, nil, true, ctx.Err()
+		}
+	}
+	c := &fixCall{done: make(chan struct{}), err: errFixPanicked}
+	g.m[key] = c
+	g.mu.Unlock()
+
+	// Release the waiters even if fn panics.
+	defer func() {
+		g.mu.Lock()
+		delete(g.m, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.chains, c.ferrs = fn()
+	c.err = nil
+	return c.chains, c.ferrs, false, nil
+}
+
+// waiters returns the number of callers which have waited for the attempt
+// with key in progress, or -1 if there is none.
+func (g *fixGroup) waiters(key [hashSize]byte) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.m[key]; ok {
+		return c.waiters
+	}
+	return -1
+}
+
+// hash returns a hash of the leaf, supplied chain and roots of fix, which
+// identifies fix attempts that will produce the same result.
+func (fix *toFix) hash() [hashSize]byte {
+	h := sha256.New()
+	writeLengthPrefixed := func(b []byte) {
+		var l [8]byte
+		binary.BigEndian.PutUint64(l[:], uint64(len(b)))
+		h.Write(l[:])
+		h.Write(b)
+	}
+	writeLengthPrefixed(fix.cert.Raw)
+	for _, c := range fix.chain {
+		writeLengthPrefixed(c.Raw)
+	}
+	// Separate the chain from the roots, so that a chain can't collide
+	// with a shorter chain whose roots begin with its last certificate.
+	writeLengthPrefixed(nil)
+	if fix.roots != nil {
+		subjects := fix.roots.Subjects()
+		sort.Sort(byteSlices(subjects))
+		for _, s := range subjects {
+			writeLengthPrefixed(s)
+		}
+	}
+	var r [hashSize]byte
+	copy(r[:], h.Sum(nil))
+	return r
+}
+
+type byteSlices [][]byte
+
+func (b byteSlices) Len() int           { return len(b) }
+func (b byteSlices) Less(i, j int) bool { return bytes.Compare(b[i], b[j]) < 0 }
+func (b byteSlices) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
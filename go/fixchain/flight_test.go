@@ -0,0 +1,158 @@
+package fixchain
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/chains"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// startFixCall starts an attempt with key in g that blocks until release is
+// closed, and waits for it to begin.  The returned channel is closed when the
+// attempt has returned.
+func startFixCall(t *testing.T, g *fixGroup, key [hashSize]byte, release <-chan struct{}) <-chan struct{} {
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		_, _, shared, err := g.do(context.Background(), key, func() ([][]*x509.Certificate, []*FixError) {
+			close(started)
+			<-release
+			return nil, []*FixError{{Type: FixFailed}}
+		})
+		if shared || err != nil {
+			t.Errorf("First call got shared=%t, err=%v, want its own result", shared, err)
+		}
+	}()
+	<-started
+	return finished
+}
+
+// awaitWaiters waits until n callers are waiting for the attempt with key.
+func awaitWaiters(t *testing.T, g *fixGroup, key [hashSize]byte, n int) {
+	for i := 0; g.waiters(key) < n; i++ {
+		if i == 1000 {
+			t.Fatalf("%d callers waiting, expected %d", g.waiters(key), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFixGroup(t *testing.T) {
+	var g fixGroup
+	var key [hashSize]byte
+	release := make(chan struct{})
+
+	// The first call blocks until released, so the others are coalesced
+	// with it.
+	finished := startFixCall(t, &g, key, release)
+	var calls int32
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ferrs, shared, err := g.do(context.Background(), key, func() ([][]*x509.Certificate, []*FixError) {
+				atomic.AddInt32(&calls, 1)
+				return nil, nil
+			})
+			if !shared || err != nil {
+				t.Errorf("Concurrent call got shared=%t, err=%v, want a shared result", shared, err)
+			}
+			if len(ferrs) != 1 || ferrs[0].Type != FixFailed {
+				t.Error("Concurrent call didn't get the result of the first call")
+			}
+		}()
+	}
+	awaitWaiters(t, &g, key, n)
+	close(release)
+	wg.Wait()
+	<-finished
+
+	if calls != 0 {
+		t.Errorf("%d concurrent calls made their own attempt, expected none", calls)
+	}
+
+	// Once the first call has completed, a new call makes its own attempt.
+	_, _, shared, _ := g.do(context.Background(), key, func() ([][]*x509.Certificate, []*FixError) { return nil, nil })
+	if shared {
+		t.Error("Call after completion got a shared result")
+	}
+}
+
+func TestFixGroupWaiterContext(t *testing.T) {
+	var g fixGroup
+	var key [hashSize]byte
+	release := make(chan struct{})
+	finished := startFixCall(t, &g, key, release)
+
+	// A waiter gives up when its own context is done, without waiting
+	// for the attempt it was coalesced with.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, _, err := g.do(ctx, key, func() ([][]*x509.Certificate, []*FixError) {
+		t.Error("Waiter made its own attempt")
+		return nil, nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Waiter with expired context got err=%v, want %v", err, context.DeadlineExceeded)
+	}
+	close(release)
+	<-finished
+}
+
+func TestFixGroupPanic(t *testing.T) {
+	var g fixGroup
+	var key [hashSize]byte
+	release := make(chan struct{})
+	panicked := make(chan struct{})
+	go func() {
+		defer close(panicked)
+		defer func() { recover() }()
+		g.do(context.Background(), key, func() ([][]*x509.Certificate, []*FixError) {
+			<-release
+			panic("fix failed")
+		})
+	}()
+	// Wait for the attempt to be in progress.
+	awaitWaiters(t, &g, key, 0)
+
+	waited := make(chan error)
+	go func() {
+		_, _, _, err := g.do(context.Background(), key, func() ([][]*x509.Certificate, []*FixError) { return nil, nil })
+		waited <- err
+	}()
+	awaitWaiters(t, &g, key, 1)
+	close(release)
+	if err := <-waited; err != errFixPanicked {
+		t.Errorf("Waiter for panicking attempt got err=%v, want %v", err, errFixPanicked)
+	}
+	<-panicked
+	if n := g.waiters(key); n != -1 {
+		t.Errorf("Attempt still in progress after panicking, with %d waiters", n)
+	}
+}
+
+func TestToFixHash(t *testing.T) {
+	leaf := GetTestCertificateFromPEM(t, googleLeaf)
+	a := &toFix{cert: leaf, chain: chains.Dedupe(extractTestChain(t, 0, []string{verisignRoot, thawteIntermediate}))}
+	b := &toFix{cert: leaf, chain: chains.Dedupe(extractTestChain(t, 0, []string{verisignRoot, verisignRoot, thawteIntermediate}))}
+	c := &toFix{cert: leaf, chain: chains.Dedupe(extractTestChain(t, 0, []string{thawteIntermediate}))}
+	if a.hash() != b.hash() {
+		t.Error("Identical deduped chains have different hashes")
+	}
+	if a.hash() == c.hash() {
+		t.Error("Different chains have the same hash")
+	}
+
+	d := &toFix{cert: leaf, chain: a.chain, roots: x509.NewCertPool()}
+	d.roots.AddCert(GetTestCertificateFromPEM(t, verisignRoot))
+	if a.hash() == d.hash() {
+		t.Error("Chains with different roots have the same hash")
+	}
+}
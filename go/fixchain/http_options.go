@@ -0,0 +1,118 @@
+package fixchain
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// HTTPOptions configures the HTTP client used to fetch URLs, so that callers
+// such as those inside corporate networks don't need to build their own.
+type HTTPOptions struct {
+	// Proxy through which all requests are made.  If nil, the proxy is
+	// taken from the environment, as for http.DefaultTransport.
+	Proxy *url.URL
+
+	// TLS configuration used for https URLs, e.g. to trust a corporate
+	// intercepting proxy's root.  If nil, the default configuration is
+	// used.
+	TLSConfig *tls.Config
+
+	// Dial is used to make connections.  If nil, net.Dialer is used.
+	Dial func(network, addr string) (net.Conn, error)
+
+	// User-Agent header sent with every request.  If empty, Go's default
+	// is sent.
+	UserAgent string
+
+	// Timeout for each request, including reading the body.  Zero means no
+	// timeout beyond that of RetryPolicy.
+	Timeout time.Duration
+
+	// HTTP/2 is used with servers which support it unless DisableHTTP2 is
+	// set.
+	DisableHTTP2 bool
+
+	// Hooks called before each request is sent, and once it completes with
+	// either a response or an error, e.g. to instrument fetches.  They are
+	// called concurrently from the Fixer's workers.
+	OnRequest  func(req *http.Request)
+	OnResponse func(req *http.Request, resp *http.Response, err error, elapsed time.Duration)
+}
+
+// NewClient returns an http.Client configured by o.
+func (o *HTTPOptions) NewClient() *http.Client {
+	proxy := http.ProxyFromEnvironment
+	if o.Proxy != nil {
+		proxy = http.ProxyURL(o.Proxy)
+	}
+	dial := o.Dial
+	if dial == nil {
+		dial = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial
+	}
+	t := &http.Transport{
+		Proxy:               proxy,
+		Dial:                dial,
+		TLSClientConfig:     o.TLSConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConnsPerHost: 10,
+	}
+	if !o.DisableHTTP2 {
+		// A Transport with its own TLS configuration or dialer only
+		// speaks HTTP/2 if it is configured to explicitly.
+		if err := http2.ConfigureTransport(t); err != nil {
+			log.Printf("Failed to enable HTTP/2, using HTTP/1.1: %s", err)
+		}
+	}
+
+	var rt http.RoundTripper = t
+	if o.UserAgent != "" || o.OnRequest != nil || o.OnResponse != nil {
+		rt = &instrumentedTransport{
+			rt:         t,
+			userAgent:  o.UserAgent,
+			onRequest:  o.OnRequest,
+			onResponse: o.OnResponse,
+		}
+	}
+	return &http.Client{Transport: rt, Timeout: o.Timeout}
+}
+
+// instrumentedTransport is an http.RoundTripper which sets the User-Agent of
+// requests and calls the HTTPOptions hooks around them.
+type instrumentedTransport struct {
+	rt         http.RoundTripper
+	userAgent  string
+	onRequest  func(req *http.Request)
+	onResponse func(req *http.Request, resp *http.Response, err error, elapsed time.Duration)
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.userAgent != "" {
+		// RoundTrippers mustn't modify the request they are given.
+		r := new(http.Request)
+		*r = *req
+		r.Header = make(http.Header, len(req.Header)+1)
+		for k, v := range req.Header {
+			r.Header[k] = v
+		}
+		r.Header.Set("User-Agent", t.userAgent)
+		req = r
+	}
+	if t.onRequest != nil {
+		t.onRequest(req)
+	}
+	start := time.Now()
+	resp, err := t.rt.RoundTrip(req)
+	if t.onResponse != nil {
+		t.onResponse(req, resp, err, time.Since(start))
+	}
+	return resp, err
+}
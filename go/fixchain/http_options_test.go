@@ -0,0 +1,73 @@
+package fixchain
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestHTTPOptions(t *testing.T) {
+	var gotUA atomic.Value
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUA.Store(r.UserAgent())
+		w.Write([]byte("body"))
+	}))
+	defer ts.Close()
+
+	var requests, responses int32
+	opts := &FixerOptions{HTTP: &HTTPOptions{
+		UserAgent: "fixchain-test/1.0",
+		OnRequest: func(req *http.Request) {
+			atomic.AddInt32(&requests, 1)
+		},
+		OnResponse: func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Errorf("OnResponse() called with %v, %v, expected 200 OK", resp, err)
+			}
+			atomic.AddInt32(&responses, 1)
+		},
+	}}
+	u := newURLCache(nil, opts)
+	body, err := u.getURL(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("getURL() returned error: %s", err)
+	}
+	if string(body) != "body" {
+		t.Errorf("getURL() returned %q, expected \"body\"", body)
+	}
+	if ua := gotUA.Load(); ua != "fixchain-test/1.0" {
+		t.Errorf("Server saw User-Agent %q, expected fixchain-test/1.0", ua)
+	}
+	if requests != 1 || responses != 1 {
+		t.Errorf("Hooks called for %d requests and %d responses, expected 1 each", requests, responses)
+	}
+}
+
+func TestHTTPOptionsProxy(t *testing.T) {
+	// The proxy answers for every URL.
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse proxy URL: %s", err)
+	}
+
+	c := (&HTTPOptions{Proxy: proxyURL}).NewClient()
+	resp, err := c.Get("http://fixchain.invalid/issuer.crt")
+	if err != nil {
+		t.Fatalf("Get() returned error: %s", err)
+	}
+	resp.Body.Close()
+	if proxied != 1 {
+		t.Errorf("Proxy saw %d requests, expected 1", proxied)
+	}
+}
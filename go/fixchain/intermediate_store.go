@@ -0,0 +1,165 @@
+package fixchain
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// IntermediateStore is an IssuerSource which finds issuers amongst a local,
+// curated set of intermediate certificates, so that chains can be fixed
+// deterministically and without network access.  The certificates are loaded
+// from either a directory, every file in which holds DER or PEM certificates
+// or PKCS#7 bundles, or a single such bundle file.
+//
+// The store is reloaded when its files change, which is checked for at most
+// once every check interval when issuers are looked up.  If the files can't
+// be loaded, the certificates loaded before are kept.  An IntermediateStore is
+// safe for concurrent use.
+type IntermediateStore struct {
+	path          string
+	checkInterval time.Duration
+
+	mu          sync.RWMutex
+	bySubject   map[[hashSize]byte][]*x509.Certificate
+	count       int
+	fingerprint string
+	lastCheck   time.Time
+}
+
+// NewIntermediateStore loads the certificates at path, which is a directory or
+// a single file, and returns an IntermediateStore containing them.  The store
+// checks whether the files have changed at most once every checkInterval; if
+// checkInterval is zero, it is only reloaded by calling Reload.
+func NewIntermediateStore(path string, checkInterval time.Duration) (*IntermediateStore, error) {
+	s := &IntermediateStore{path: path, checkInterval: checkInterval}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Len returns the number of certificates in the store.
+func (s *IntermediateStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.count
+}
+
+// Reload loads the certificates at the store's path again, replacing those
+// loaded before, if its files have changed since they were last loaded.
+func (s *IntermediateStore) Reload() error {
+	fingerprint, files, err := s.stat()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastCheck = time.Now()
+	if s.bySubject != nil && fingerprint == s.fingerprint {
+		return nil
+	}
+
+	bySubject := make(map[[hashSize]byte][]*x509.Certificate)
+	count := 0
+	for _, file := range files {
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		certs, err := parseIssuerCertificates(body)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+	certs:
+		for _, cert := range certs {
+			h := sha256.Sum256(cert.RawSubject)
+			for _, c := range bySubject[h] {
+				if c.Equal(cert) {
+					continue certs
+				}
+			}
+			bySubject[h] = append(bySubject[h], cert)
+			count++
+		}
+	}
+	s.bySubject = bySubject
+	s.count = count
+	s.fingerprint = fingerprint
+	return nil
+}
+
+// stat returns the files to load from the store's path, and a fingerprint of
+// their names, sizes and modification times which changes when they do.
+func (s *IntermediateStore) stat() (string, []string, error) {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return "", nil, err
+	}
+	if !fi.IsDir() {
+		return fingerprintFiles([]os.FileInfo{fi}), []string{s.path}, nil
+	}
+
+	// ReadDir returns the entries sorted by name, so the fingerprint and
+	// the order in which certificates are loaded are stable.
+	entries, err := ioutil.ReadDir(s.path)
+	if err != nil {
+		return "", nil, err
+	}
+	var infos []os.FileInfo
+	var files []string
+	for _, e := range entries {
+		if !e.Mode().IsRegular() {
+			continue
+		}
+		infos = append(infos, e)
+		files = append(files, filepath.Join(s.path, e.Name()))
+	}
+	return fingerprintFiles(infos), files, nil
+}
+
+func fingerprintFiles(infos []os.FileInfo) string {
+	var fp string
+	for _, fi := range infos {
+		fp += fmt.Sprintf("%s/%d/%d\n", fi.Name(), fi.Size(), fi.ModTime().UnixNano())
+	}
+	return fp
+}
+
+// maybeReload reloads the store if the check interval has passed since its
+// files were last checked for changes.
+func (s *IntermediateStore) maybeReload() {
+	if s.checkInterval == 0 {
+		return
+	}
+	s.mu.RLock()
+	due := time.Since(s.lastCheck) >= s.checkInterval
+	s.mu.RUnlock()
+	if !due {
+		return
+	}
+	if err := s.Reload(); err != nil {
+		s.mu.Lock()
+		s.lastCheck = time.Now()
+		s.mu.Unlock()
+		log.Printf("Failed to reload intermediate store %s, keeping %d certificates: %s", s.path, s.Len(), err)
+	}
+}
+
+// FindIssuers returns the certificates in the store whose subject matches the
+// issuer of cert.
+func (s *IntermediateStore) FindIssuers(ctx context.Context, cert *x509.Certificate) ([]*x509.Certificate, error) {
+	s.maybeReload()
+	h := sha256.Sum256(cert.RawIssuer)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bySubject[h], nil
+}
@@ -0,0 +1,96 @@
+package fixchain
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestIntermediateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixchain")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	thawte := GetTestCertificateFromPEM(t, thawteIntermediate)
+	if err := ioutil.WriteFile(filepath.Join(dir, "thawte.pem"), []byte(thawteIntermediate), 0644); err != nil {
+		t.Fatalf("Failed to write thawte.pem: %s", err)
+	}
+	s, err := NewIntermediateStore(dir, time.Nanosecond)
+	if err != nil {
+		t.Fatalf("NewIntermediateStore() returned error: %s", err)
+	}
+	if s.Len() != 1 {
+		t.Errorf("Len() = %d, expected 1", s.Len())
+	}
+	issuers, err := s.FindIssuers(context.Background(), GetTestCertificateFromPEM(t, googleLeaf))
+	if err != nil {
+		t.Fatalf("FindIssuers() returned error: %s", err)
+	}
+	if len(issuers) != 1 || !issuers[0].Equal(thawte) {
+		t.Errorf("FindIssuers() returned %d issuers, expected just Thawte", len(issuers))
+	}
+
+	// New files are picked up when issuers are next looked up, and
+	// duplicates are ignored.
+	if err := ioutil.WriteFile(filepath.Join(dir, "thawte.der"), thawte.Raw, 0644); err != nil {
+		t.Fatalf("Failed to write thawte.der: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "verisign.pem"), []byte(verisignRoot), 0644); err != nil {
+		t.Fatalf("Failed to write verisign.pem: %s", err)
+	}
+	s.FindIssuers(context.Background(), thawte)
+	if s.Len() != 2 {
+		t.Errorf("Len() = %d after adding files, expected 2", s.Len())
+	}
+
+	// A file that can't be parsed doesn't discard what was loaded before.
+	if err := ioutil.WriteFile(filepath.Join(dir, "bad.pem"), []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("Failed to write bad.pem: %s", err)
+	}
+	if err := s.Reload(); err == nil {
+		t.Errorf("Reload() with an unparseable file returned no error")
+	}
+	s.FindIssuers(context.Background(), thawte)
+	if s.Len() != 2 {
+		t.Errorf("Len() = %d after failed reload, expected 2", s.Len())
+	}
+
+	if _, err := NewIntermediateStore(filepath.Join(dir, "missing"), 0); err == nil {
+		t.Errorf("NewIntermediateStore() with a missing path returned no error")
+	}
+}
+
+func TestFixChainFromIntermediateStore(t *testing.T) {
+	f, err := ioutil.TempFile("", "fixchain")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(thawteIntermediate)
+	f.Close()
+
+	s, err := NewIntermediateStore(f.Name(), 0)
+	if err != nil {
+		t.Fatalf("NewIntermediateStore() returned error: %s", err)
+	}
+
+	ft := &fixTest{
+		cert:  googleLeaf,
+		roots: []string{verisignRoot},
+	}
+	fix := setUpFix(t, 0, ft)
+	// Fetching fails, so the chain can only be fixed from the store.
+	fix.cache = newURLCache(&http.Client{Transport: failingTransport{}}, &FixerOptions{})
+	fix.fopts = &FixerOptions{Intermediates: s}
+
+	chains, ferrs := fix.fixChain()
+	matchTestChainList(t, 0, [][]string{{"Google", "Thawte", "VeriSign"}}, chains)
+	matchTestErrorList(t, 0, nil, ferrs)
+}
@@ -0,0 +1,80 @@
+package fixchain
+
+import (
+	"github.com/google/certificate-transparency/go/cagraph"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// IssuerSource is the interface used by the Fixer to find candidate issuers
+// for certificates whose chains can't be fixed from their AIA URLs.
+// Implementations must be safe for concurrent use.
+type IssuerSource interface {
+	// FindIssuers returns certificates which may have issued cert.
+	FindIssuers(ctx context.Context, cert *x509.Certificate) ([]*x509.Certificate, error)
+}
+
+// The number of entries requested per get-entries call by LogIssuerSource.
+const logIssuerBatchSize = 1000
+
+// LogIssuerSource is an IssuerSource which finds issuers amongst the CA
+// certificates that have been submitted to CT logs as part of entries' chains.
+// RFC6962 logs can't be searched by issuer, so the intermediates in ranges of
+// each log's entries are fetched and added to a cagraph.Graph ahead of time,
+// using AddLogRange.
+type LogIssuerSource struct {
+	graph *cagraph.Graph
+}
+
+// NewLogIssuerSource returns an empty LogIssuerSource.
+func NewLogIssuerSource() *LogIssuerSource {
+	return NewGraphIssuerSource(cagraph.New())
+}
+
+// NewGraphIssuerSource returns a LogIssuerSource which finds issuers amongst
+// the certificates in |g|, e.g. a Graph a scan has built, and adds those it
+// fetches to |g|.
+func NewGraphIssuerSource(g *cagraph.Graph) *LogIssuerSource {
+	return &LogIssuerSource{graph: g}
+}
+
+// Graph returns the issuer graph of the certificates in the source.
+func (l *LogIssuerSource) Graph() *cagraph.Graph {
+	return l.graph
+}
+
+// AddLogRange fetches the entries in the range [start, end] from the log that
+// c talks to, and indexes every CA certificate found in their chains.
+func (l *LogIssuerSource) AddLogRange(c *client.LogClient, start, end int64) error {
+	for start <= end {
+		batchEnd := start + logIssuerBatchSize - 1
+		if batchEnd > end {
+			batchEnd = end
+		}
+		entries, err := c.GetEntries(start, batchEnd)
+		if err != nil {
+			return err
+		}
+		for i := range entries {
+			l.graph.AddEntry(&entries[i])
+		}
+		// Logs MAY return fewer entries than were requested.
+		start += int64(len(entries))
+		if len(entries) == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// AddCert adds cert to the source, if it is a CA certificate.
+func (l *LogIssuerSource) AddCert(cert *x509.Certificate) {
+	l.graph.Add(cert)
+}
+
+// FindIssuers returns the certificates in the source whose subject matches
+// the issuer of cert.
+func (l *LogIssuerSource) FindIssuers(ctx context.Context, cert *x509.Certificate) ([]*x509.Certificate, error) {
+	return l.graph.FindIssuers(ctx, cert)
+}
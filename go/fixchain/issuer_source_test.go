@@ -0,0 +1,56 @@
+package fixchain
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("no network in this test")
+}
+
+func TestLogIssuerSource(t *testing.T) {
+	l := NewLogIssuerSource()
+	thawte := GetTestCertificateFromPEM(t, thawteIntermediate)
+	l.AddCert(thawte)
+	l.AddCert(thawte)
+
+	issuers, err := l.FindIssuers(context.Background(), GetTestCertificateFromPEM(t, googleLeaf))
+	if err != nil {
+		t.Fatalf("FindIssuers() returned error: %s", err)
+	}
+	if len(issuers) != 1 || !issuers[0].Equal(thawte) {
+		t.Errorf("FindIssuers() returned %d issuers, expected just Thawte", len(issuers))
+	}
+
+	issuers, err = l.FindIssuers(context.Background(), GetTestCertificateFromPEM(t, megaLeaf))
+	if err != nil {
+		t.Fatalf("FindIssuers() returned error: %s", err)
+	}
+	if len(issuers) != 0 {
+		t.Errorf("FindIssuers() returned %d issuers for unrelated cert, expected none", len(issuers))
+	}
+}
+
+func TestFixChainFromIssuerSource(t *testing.T) {
+	l := NewLogIssuerSource()
+	l.AddCert(GetTestCertificateFromPEM(t, thawteIntermediate))
+
+	ft := &fixTest{
+		cert:  googleLeaf,
+		roots: []string{verisignRoot},
+	}
+	fix := setUpFix(t, 0, ft)
+	// AIA fetching fails, so the chain can only be fixed from the log.
+	fix.cache = newURLCache(&http.Client{Transport: failingTransport{}}, &FixerOptions{})
+	fix.fopts = &FixerOptions{IssuerSources: []IssuerSource{l}}
+
+	chains, ferrs := fix.fixChain()
+	matchTestChainList(t, 0, [][]string{{"Google", "Thawte", "VeriSign"}}, chains)
+	matchTestErrorList(t, 0, nil, ferrs)
+}
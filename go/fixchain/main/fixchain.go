@@ -0,0 +1,352 @@
+// fixchain reads certificate chains, fixes them with a fixchain.Fixer, and
+// writes the fixed chains and the errors found fixing them to separate
+// outputs.  Chains are read from the files named on the command line, or from
+// stdin if there are none, either as JSON lines of the form
+// {"chain": ["<base64 DER>", ...]}, as in add-chain requests, or as PEM
+// bundles.  Each chain starts with its leaf.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/certificate-transparency/go/fixchain"
+	"github.com/google/certificate-transparency/go/revocation"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+var inputFormat = flag.String("input_format", "jsonl", "Format of the input: jsonl, one JSON object with a chain per line, or pem, one PEM bundle per file, with bundles on stdin separated by blank lines")
+var outputFormat = flag.String("output_format", "jsonl", "Format to write fixed chains in: jsonl or pem, with chains separated by blank lines")
+var outputFile = flag.String("output", "", "File to write fixed chains to; stdout if empty")
+var errorsFile = flag.String("errors", "", "File to write errors to as JSON lines; stderr if empty")
+var rootsFile = flag.String("roots", "", "PEM file holding the roots to fix chains to; the system roots are used if empty")
+var intermediatesPath = flag.String("intermediates", "", "PEM file, or directory of them, holding intermediates to search before fetching any")
+var workers = flag.Int("workers", 10, "Number of chains fixed concurrently")
+var chainTimeout = flag.Duration("chain_timeout", time.Minute, "Maximum time spent fixing any one chain; zero means no limit")
+var maxChainLength = flag.Int("max_chain_length", 0, "Maximum number of certificates in fixed chains; zero means no limit")
+var checkRevocation = flag.Bool("check_revocation", false, "Check the revocation status of the certificates in fixed chains with OCSP and CRLs, and add it to jsonl output")
+var progressInterval = flag.Duration("progress", 10*time.Second, "How often to log progress; zero disables progress reports")
+
+var errNoChain = errors.New("no certificates in chain")
+
+// chainJSON is the JSON encoding of a chain, in input and output.
+type chainJSON struct {
+	Chain [][]byte `json:"chain"`
+	// The revocation status of each certificate but the root, in output
+	// with -check_revocation.
+	Revocation []revocation.Status `json:"revocation,omitempty"`
+}
+
+// counts are the totals reported as progress, updated atomically.
+type counts struct {
+	read, fixed, errors uint64
+}
+
+// parsePEM returns the certificates in the PEM data.
+func parsePEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if x509.IsFatal(err) {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+	return certs, nil
+}
+
+// parseDER returns the certificates with the DER encodings ders, of which
+// there must be at least one.
+func parseDER(ders [][]byte) ([]*x509.Certificate, error) {
+	if len(ders) == 0 {
+		return nil, errNoChain
+	}
+	var certs []*x509.Certificate
+	for i, der := range ders {
+		c, err := x509.ParseCertificate(der)
+		if x509.IsFatal(err) {
+			return nil, fmt.Errorf("certificate %d: %v", i, err)
+		}
+		certs = append(certs, c)
+	}
+	return certs, nil
+}
+
+// readChains calls fn with each chain read from r, named name, or with the
+// bytes of the chain and the error if one can't be parsed, until r is
+// exhausted or ctx is done.
+func readChains(ctx context.Context, name string, r io.Reader, fn func(chain []*x509.Certificate, bad []byte, err error)) error {
+	br := bufio.NewReader(r)
+	var pemData []byte
+	for line := 1; ctx.Err() == nil; line++ {
+		b, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		eof := err == io.EOF
+		switch *inputFormat {
+		case "jsonl":
+			if len(bytes.TrimSpace(b)) > 0 {
+				var j chainJSON
+				if err := json.Unmarshal(b, &j); err != nil {
+					fn(nil, b, fmt.Errorf("%s:%d: %v", name, line, err))
+				} else if chain, err := parseDER(j.Chain); err != nil {
+					fn(nil, b, fmt.Errorf("%s:%d: %v", name, line, err))
+				} else {
+					fn(chain, nil, nil)
+				}
+			}
+		case "pem":
+			// A blank line which isn't inside a PEM block ends a
+			// bundle.
+			pemData = append(pemData, b...)
+			blank := len(bytes.TrimSpace(b)) == 0
+			if (blank || eof) && bytes.Count(pemData, []byte("-----BEGIN")) == bytes.Count(pemData, []byte("-----END")) {
+				if len(bytes.TrimSpace(pemData)) > 0 {
+					if chain, err := parsePEM(pemData); err != nil {
+						fn(nil, pemData, fmt.Errorf("%s:%d: %v", name, line, err))
+					} else if len(chain) > 0 {
+						fn(chain, nil, nil)
+					}
+				}
+				pemData = nil
+			}
+		}
+		if eof {
+			return nil
+		}
+	}
+	return nil
+}
+
+func writeChain(w io.Writer, chain []*x509.Certificate, statuses []revocation.Status) error {
+	if *outputFormat == "pem" {
+		for _, c := range chain {
+			if err := pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	}
+	j := chainJSON{Revocation: statuses}
+	for _, c := range chain {
+		j.Chain = append(j.Chain, c.Raw)
+	}
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// create returns a buffered writer for the file at path, or for def if path
+// is empty, and a function to flush and close it.
+func create(path string, def *os.File) (*bufio.Writer, func() error) {
+	f := def
+	if path != "" {
+		var err error
+		if f, err = os.Create(path); err != nil {
+			log.Fatal(err)
+		}
+	}
+	w := bufio.NewWriter(f)
+	return w, func() error {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if f == def {
+			return nil
+		}
+		return f.Close()
+	}
+}
+
+func main() {
+	flag.Parse()
+	if *inputFormat != "jsonl" && *inputFormat != "pem" {
+		log.Fatalf("Unknown --input_format %q", *inputFormat)
+	}
+	if *outputFormat != "jsonl" && *outputFormat != "pem" {
+		log.Fatalf("Unknown --output_format %q", *outputFormat)
+	}
+
+	var roots *x509.CertPool
+	if *rootsFile != "" {
+		data, err := ioutil.ReadFile(*rootsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rootCerts, err := parsePEM(data)
+		if err != nil {
+			log.Fatalf("%s: %v", *rootsFile, err)
+		}
+		if len(rootCerts) == 0 {
+			log.Fatalf("No certificates in %s", *rootsFile)
+		}
+		roots = x509.NewCertPool()
+		for _, c := range rootCerts {
+			roots.AddCert(c)
+		}
+	}
+	opts := fixchain.FixerOptions{
+		ChainTimeout:   *chainTimeout,
+		MaxChainLength: *maxChainLength,
+		HTTP:           &fixchain.HTTPOptions{UserAgent: "fixchain"},
+	}
+	if *intermediatesPath != "" {
+		s, err := fixchain.NewIntermediateStore(*intermediatesPath, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Intermediates = s
+	}
+	var metadata chan *fixchain.ChainWithMetadata
+	if *checkRevocation {
+		metadata = make(chan *fixchain.ChainWithMetadata)
+		opts.ChainsWithMetadata = metadata
+		opts.Revocation = revocation.NewHTTPChecker(revocation.HTTPCheckerOptions{})
+	}
+
+	out, closeOut := create(*outputFile, os.Stdout)
+	errOut, closeErrOut := create(*errorsFile, os.Stderr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		log.Print("Interrupted; abandoning the chains being fixed")
+		cancel()
+	}()
+
+	var c counts
+	chains := make(chan []*x509.Certificate)
+	ferrs := make(chan *fixchain.FixError)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for chain := range chains {
+			if err := writeChain(out, chain, nil); err != nil {
+				log.Fatalf("Failed to write chain: %v", err)
+			}
+			atomic.AddUint64(&c.fixed, 1)
+		}
+	}()
+	if metadata != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range metadata {
+				if err := writeChain(out, m.Chain, m.Revocation); err != nil {
+					log.Fatalf("Failed to write chain: %v", err)
+				}
+				atomic.AddUint64(&c.fixed, 1)
+			}
+		}()
+	}
+	go func() {
+		defer wg.Done()
+		for ferr := range ferrs {
+			b, err := json.Marshal(ferr)
+			if err == nil {
+				_, err = errOut.Write(append(b, '\n'))
+			}
+			if err != nil {
+				log.Fatalf("Failed to write error: %v", err)
+			}
+			atomic.AddUint64(&c.errors, 1)
+		}
+	}()
+
+	f := fixchain.NewFixerWithOptions(ctx, *workers, chains, ferrs, nil, opts)
+	if *progressInterval > 0 {
+		t := time.NewTicker(*progressInterval)
+		defer t.Stop()
+		go func() {
+			for range t.C {
+				s := f.Stats()
+				log.Printf("%d chains read, %d fixed chains and %d errors written; "+
+					"%d workers active, %d reconstructed, %d fixed, %d not fixed, %d timed out",
+					atomic.LoadUint64(&c.read), atomic.LoadUint64(&c.fixed), atomic.LoadUint64(&c.errors),
+					s.Active, s.Reconstructed, s.Fixed, s.NotFixed, s.TimedOut)
+			}
+		}()
+	}
+
+	queue := func(chain []*x509.Certificate, bad []byte, err error) {
+		atomic.AddUint64(&c.read, 1)
+		if err != nil {
+			ferrs <- &fixchain.FixError{Type: fixchain.ParseFailure, Bad: bad, Error: err}
+			return
+		}
+		f.QueueChain(chain[0], chain[1:], roots)
+	}
+	failed := false
+	if flag.NArg() == 0 {
+		if err := readChains(ctx, "stdin", os.Stdin, queue); err != nil {
+			log.Print(err)
+			failed = true
+		}
+	}
+	for _, name := range flag.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			log.Print(err)
+			failed = true
+			continue
+		}
+		err = readChains(ctx, name, file, queue)
+		file.Close()
+		if err != nil {
+			log.Print(err)
+			failed = true
+		}
+	}
+
+	f.Wait()
+	close(chains)
+	close(ferrs)
+	if metadata != nil {
+		close(metadata)
+	}
+	wg.Wait()
+	for _, fn := range []func() error{closeOut, closeErrOut} {
+		if err := fn(); err != nil {
+			log.Print(err)
+			failed = true
+		}
+	}
+	log.Printf("Done: %d chains read, %d fixed chains and %d errors written",
+		atomic.LoadUint64(&c.read), atomic.LoadUint64(&c.fixed), atomic.LoadUint64(&c.errors))
+	if ctx.Err() != nil {
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// When runMainEnv is set, the test binary runs main with the arguments in it,
+// so that tests can run the command in a subprocess.
+const runMainEnv = "FIXCHAIN_TEST_MAIN_ARGS"
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(runMainEnv); ok {
+		os.Args = append([]string{"fixchain"}, strings.Fields(args)...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestEmptyInput(t *testing.T) {
+	for _, args := range []string{"-progress=0", "-progress=0 -check_revocation"} {
+		cmd := exec.Command(os.Args[0])
+		cmd.Env = append(os.Environ(), runMainEnv+"="+args)
+		cmd.Stdin = bytes.NewReader(nil)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("fixchain %s failed: %v\n%s", args, err, stderr.String())
+			}
+		case <-time.After(30 * time.Second):
+			cmd.Process.Kill()
+			t.Errorf("fixchain %s didn't exit given no input", args)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package fixchain
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Names of the counters and gauges reported by the Fixer to its Metrics.
+const (
+	ReconstructedCounter    = "reconstructed"
+	NotReconstructedCounter = "not_reconstructed"
+	FixedCounter            = "fixed"
+	NotFixedCounter         = "not_fixed"
+	SkippedCounter          = "skipped"
+	AlreadyDoneCounter      = "already_done"
+	TimedOutCounter         = "timed_out"
+	OutputDroppedCounter    = "output_dropped"
+
+	// Number of chains in the priority queue, waiting for a worker.
+	QueueDepthGauge    = "queue_depth"
+	ActiveWorkersGauge = "active_workers"
+	WorkersGauge       = "workers"
+	// Total time workers have been blocked pushing results, in milliseconds.
+	OutputBlockedGauge = "output_blocked_ms"
+)
+
+// Metrics is the interface through which the Fixer exports its statistics.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// IncCounter increments the named counter by one.
+	IncCounter(name string)
+
+	// SetGauge sets the named gauge to v.
+	SetGauge(name string, v int64)
+}
+
+// nopMetrics is the Metrics used when none is configured.
+type nopMetrics struct{}
+
+func (nopMetrics) IncCounter(string)      {}
+func (nopMetrics) SetGauge(string, int64) {}
+
+// ExpvarMetrics is a Metrics which publishes the Fixer's statistics through
+// the expvar package, and so at /debug/vars on http.DefaultServeMux.
+type ExpvarMetrics struct {
+	m *expvar.Map
+}
+
+// NewExpvarMetrics returns an ExpvarMetrics which publishes the Fixer's
+// statistics as the expvar map with the given name.  If that map is already
+// published, e.g. by an earlier ExpvarMetrics, it is added to rather than
+// replaced, as expvar can't unpublish a variable.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	if m, ok := expvar.Get(name).(*expvar.Map); ok {
+		return &ExpvarMetrics{m: m}
+	}
+	return &ExpvarMetrics{m: expvar.NewMap(name)}
+}
+
+// IncCounter increments the named counter by one.
+func (e *ExpvarMetrics) IncCounter(name string) {
+	e.m.Add(name, 1)
+}
+
+// SetGauge sets the named gauge to v.
+func (e *ExpvarMetrics) SetGauge(name string, v int64) {
+	i := new(expvar.Int)
+	i.Set(v)
+	e.m.Set(name, i)
+}
+
+// PrometheusMetrics is a Metrics which keeps the Fixer's statistics in memory
+// and serves them over HTTP in the Prometheus text exposition format.
+type PrometheusMetrics struct {
+	namespace string
+	mu        sync.Mutex
+	counters  map[string]int64
+	gauges    map[string]int64
+}
+
+// NewPrometheusMetrics returns a PrometheusMetrics whose metric names are all
+// prefixed with namespace, e.g. "fixchain".
+func NewPrometheusMetrics(namespace string) *PrometheusMetrics {
+	p := &PrometheusMetrics{
+		namespace: namespace,
+		counters:  make(map[string]int64),
+		gauges:    make(map[string]int64),
+	}
+	// Make sure all the Fixer's metrics are exported from the start, not
+	// only once they first change.
+	for _, c := range []string{ReconstructedCounter, NotReconstructedCounter,
+		FixedCounter, NotFixedCounter, SkippedCounter, AlreadyDoneCounter,
+		TimedOutCounter, OutputDroppedCounter} {
+		p.counters[c] = 0
+	}
+	for _, g := range []string{QueueDepthGauge, ActiveWorkersGauge, WorkersGauge, OutputBlockedGauge} {
+		p.gauges[g] = 0
+	}
+	return p
+}
+
+// IncCounter increments the named counter by one.
+func (p *PrometheusMetrics) IncCounter(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counters[name]++
+}
+
+// SetGauge sets the named gauge to v.
+func (p *PrometheusMetrics) SetGauge(name string, v int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gauges[name] = v
+}
+
+func sortedKeys(m map[string]int64) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ServeHTTP writes the current value of every metric to rw, so that a
+// PrometheusMetrics can be registered as the handler for e.g. /metrics.
+func (p *PrometheusMetrics) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, name := range sortedKeys(p.counters) {
+		n := p.namespace + "_" + name + "_total"
+		fmt.Fprintf(rw, "# TYPE %s counter\n%s %d\n", n, n, p.counters[name])
+	}
+	for _, name := range sortedKeys(p.gauges) {
+		n := p.namespace + "_" + name
+		fmt.Fprintf(rw, "# TYPE %s gauge\n%s %d\n", n, n, p.gauges[name])
+	}
+}
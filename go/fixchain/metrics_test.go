@@ -0,0 +1,64 @@
+package fixchain
+
+import (
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	p := NewPrometheusMetrics("fixchain")
+	f := &Fixer{metrics: p}
+	f.updateCounters([]*FixError{})
+	f.updateCounters([]*FixError{{Type: VerifyFailed}})
+	f.updateCounters([]*FixError{{Type: VerifyFailed}, {Type: FixFailed}})
+	p.SetGauge(QueueDepthGauge, 7)
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body := rr.Body.String()
+
+	for _, want := range []string{
+		"# TYPE fixchain_reconstructed_total counter\nfixchain_reconstructed_total 1\n",
+		"fixchain_not_reconstructed_total 2\n",
+		"fixchain_fixed_total 1\n",
+		"fixchain_not_fixed_total 1\n",
+		"fixchain_skipped_total 0\n",
+		"fixchain_already_done_total 0\n",
+		"# TYPE fixchain_queue_depth gauge\nfixchain_queue_depth 7\n",
+		"fixchain_active_workers 0\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Metrics output doesn't contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	e := NewExpvarMetrics("fixchain_test")
+	// The map stays published, so it may have counts from earlier runs.
+	fixed := func() int64 {
+		if v, ok := e.m.Get(FixedCounter).(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	before := fixed()
+	e.IncCounter(FixedCounter)
+	e.IncCounter(FixedCounter)
+	e.SetGauge(ActiveWorkersGauge, 3)
+
+	if got, want := fixed(), before+2; got != want {
+		t.Errorf("%s = %d, expected %d", FixedCounter, got, want)
+	}
+	if got, want := e.m.Get(ActiveWorkersGauge).String(), "3"; got != want {
+		t.Errorf("%s = %s, expected %s", ActiveWorkersGauge, got, want)
+	}
+
+	// A second ExpvarMetrics with the same name adds to the same map.
+	NewExpvarMetrics("fixchain_test").IncCounter(FixedCounter)
+	if got, want := fixed(), before+3; got != want {
+		t.Errorf("%s = %d after second NewExpvarMetrics, expected %d", FixedCounter, got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package fixchain
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// negativeEntry records a fetch of a URL which failed in a way that is
+// unlikely to change soon.
+type negativeEntry struct {
+	status  int
+	err     error
+	expires time.Time
+}
+
+// negativeCache remembers URLs which are known to be dead, so that they aren't
+// fetched again for every chain that refers to them.  A nil negativeCache
+// remembers nothing.
+type negativeCache struct {
+	ttl time.Duration
+	mu  sync.Mutex
+	m   map[string]negativeEntry
+}
+
+func newNegativeCache(ttl time.Duration) *negativeCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &negativeCache{ttl: ttl, m: make(map[string]negativeEntry)}
+}
+
+// get returns the failure recorded for url, if it hasn't expired.
+func (n *negativeCache) get(url string, now time.Time) (negativeEntry, bool) {
+	if n == nil {
+		return negativeEntry{}, false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	e, ok := n.m[url]
+	if !ok {
+		return negativeEntry{}, false
+	}
+	if !now.Before(e.expires) {
+		delete(n.m, url)
+		return negativeEntry{}, false
+	}
+	return e, true
+}
+
+// put records that fetching url failed with the given status and error, if
+// the failure is one which is worth remembering.  It reports whether it was
+// recorded.
+func (n *negativeCache) put(url string, status int, err error, now time.Time) bool {
+	if n == nil || !isDeadURL(status, err) {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.m[url] = negativeEntry{status: status, err: err, expires: now.Add(n.ttl)}
+	return true
+}
+
+// isDeadURL reports whether a fetch which failed with err, having received
+// the given HTTP status (or 0 if no response was received), shows that the URL
+// doesn't exist: it is not found or gone, or its server refuses connections.
+func isDeadURL(status int, err error) bool {
+	if err == nil {
+		return false
+	}
+	if status != 0 {
+		return status == http.StatusNotFound || status == http.StatusGone
+	}
+	return isConnRefused(err)
+}
+
+// isConnRefused reports whether err is the failure to connect to a server
+// which refused the connection.
+func isConnRefused(err error) bool {
+	for {
+		switch e := err.(type) {
+		case *url.Error:
+			err = e.Err
+		case *net.OpError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		default:
+			return err == syscall.ECONNREFUSED
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package fixchain
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestNegativeCache(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	u := newURLCache(&http.Client{}, &FixerOptions{NegativeCacheTTL: 50 * time.Millisecond})
+	for i := 0; i < 3; i++ {
+		if _, err := u.getURL(context.Background(), ts.URL+"/missing"); err == nil {
+			t.Fatalf("#%d: getURL() of a missing URL returned no error", i)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Missing URL was fetched %d times, expected once", n)
+	}
+	if s := u.stats(); s.NegativeHits != 2 || s.NegativePuts != 1 {
+		t.Errorf("stats() returned %+v, expected 2 negative hits and 1 put", s)
+	}
+
+	// Once the TTL passes, the URL is fetched again.
+	time.Sleep(50 * time.Millisecond)
+	u.getURL(context.Background(), ts.URL+"/missing")
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("Missing URL was fetched %d times after the TTL, expected twice", n)
+	}
+
+	// Transient failures aren't remembered.
+	atomic.StoreInt32(&requests, 0)
+	u.getURL(context.Background(), ts.URL+"/unavailable")
+	u.getURL(context.Background(), ts.URL+"/unavailable")
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("Unavailable URL was fetched %d times, expected twice", n)
+	}
+}
+
+func TestNegativeCacheConnRefused(t *testing.T) {
+	// Nothing listens on the address once the listener is closed.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	url := "http://" + l.Addr().String() + "/issuer.crt"
+	l.Close()
+
+	u := newURLCache(&http.Client{}, &FixerOptions{NegativeCacheTTL: time.Hour})
+	if _, err := u.getURL(context.Background(), url); err == nil {
+		t.Fatalf("getURL() of a refused URL returned no error")
+	} else if !isConnRefused(err) {
+		t.Fatalf("getURL() returned %v, expected connection refused", err)
+	}
+	u.getURL(context.Background(), url)
+	if s := u.stats(); s.Errors != 1 || s.NegativeHits != 1 {
+		t.Errorf("stats() returned %+v, expected 1 error and 1 negative hit", s)
+	}
+}
+
+func TestIsDeadURL(t *testing.T) {
+	tests := []struct {
+		status   int
+		err      error
+		expected bool
+	}{
+		{0, nil, false},
+		{http.StatusNotFound, httpStatusError{http.StatusNotFound}, true},
+		{http.StatusGone, httpStatusError{http.StatusGone}, true},
+		{http.StatusServiceUnavailable, httpStatusError{http.StatusServiceUnavailable}, false},
+		{0, context.DeadlineExceeded, false},
+	}
+	for i, test := range tests {
+		if got := isDeadURL(test.status, test.err); got != test.expected {
+			t.Errorf("#%d: isDeadURL(%d, %v) = %t, expected %t", i, test.status, test.err, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package fixchain
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+	"golang.org/x/net/context"
+)
+
+var (
+	oidSHA1              = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidOCSPBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+)
+
+// OCSP structures from RFC 6960 section 4.  Only the parts needed to request
+// the status of a certificate and read the certificates in the response are
+// included.
+type ocspCertID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type ocspRequestEntry struct {
+	Cert ocspCertID
+}
+
+type ocspTBSRequest struct {
+	RequestList []ocspRequestEntry
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspResponse struct {
+	Status        asn1.Enumerated
+	ResponseBytes ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+// OCSPStrategy is a Strategy which asks a certificate's OCSP responders for its
+// status, for certificates that have no AIA CA Issuers URL, and returns the
+// certificates included in the responses.  Many responders include the
+// issuer, or a responder certificate issued by it, in their responses.
+//
+// Building the request requires the hash of the issuer's public key, which
+// is taken from the certificate's authority key identifier, as most CAs
+// compute it as RFC 5280 suggests.
+type OCSPStrategy struct{}
+
+// Name implements Strategy.
+func (OCSPStrategy) Name() string {
+	return "OCSP"
+}
+
+// FindIssuers implements Strategy.
+func (OCSPStrategy) FindIssuers(ctx context.Context, cert *x509.Certificate, fetch Fetcher) ([]*x509.Certificate, error) {
+	if len(cert.IssuingCertificateURL) > 0 || len(cert.OCSPServer) == 0 || len(cert.AuthorityKeyId) == 0 {
+		return nil, nil
+	}
+	req, err := newOCSPRequest(cert)
+	if err != nil {
+		return nil, err
+	}
+	var issuers []*x509.Certificate
+	var lastErr error
+	for _, server := range cert.OCSPServer {
+		body, err := fetch.Fetch(ctx, ocspGetURL(server, req))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		certs, err := parseOCSPResponseCertificates(body)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %s", server, err)
+			continue
+		}
+		issuers = append(issuers, certs...)
+	}
+	if len(issuers) == 0 {
+		return nil, lastErr
+	}
+	return issuers, nil
+}
+
+// newOCSPRequest returns the DER encoding of an OCSP request for cert.
+func newOCSPRequest(cert *x509.Certificate) ([]byte, error) {
+	nameHash := sha1.Sum(cert.RawIssuer)
+	req := ocspRequest{
+		TBSRequest: ocspTBSRequest{
+			RequestList: []ocspRequestEntry{{
+				Cert: ocspCertID{
+					HashAlgorithm: pkix.AlgorithmIdentifier{
+						Algorithm:  oidSHA1,
+						Parameters: asn1.RawValue{Tag: 5 /* ASN.1 NULL */},
+					},
+					IssuerNameHash: nameHash[:],
+					IssuerKeyHash:  cert.AuthorityKeyId,
+					SerialNumber:   cert.SerialNumber,
+				},
+			}},
+		},
+	}
+	return asn1.Marshal(req)
+}
+
+// ocspGetURL returns the URL for a GET request to an OCSP responder, as
+// described in RFC 6960 appendix A.1.
+func ocspGetURL(server string, req []byte) string {
+	if !strings.HasSuffix(server, "/") {
+		server += "/"
+	}
+	return server + url.QueryEscape(base64.StdEncoding.EncodeToString(req))
+}
+
+// parseOCSPResponseCertificates returns the certificates included in a DER
+// encoded OCSP response.
+func parseOCSPResponseCertificates(der []byte) ([]*x509.Certificate, error) {
+	var resp ocspResponse
+	if _, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status != 0 {
+		return nil, fmt.Errorf("OCSP response has status %d", resp.Status)
+	}
+	if !resp.ResponseBytes.ResponseType.Equal(oidOCSPBasicResponse) {
+		return nil, fmt.Errorf("OCSP response type %v is not basic", resp.ResponseBytes.ResponseType)
+	}
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(resp.ResponseBytes.Response, &basic); err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for _, raw := range basic.Certificates {
+		cert, err := parseCertificate(raw.FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
@@ -0,0 +1,70 @@
+package fixchain
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+func TestOCSPStrategy(t *testing.T) {
+	thawte := GetTestCertificateFromPEM(t, thawteIntermediate)
+	ft := &fixTest{cert: googleLeaf, roots: []string{verisignRoot}}
+	fix := setUpFix(t, 0, ft)
+	fix.fopts.Strategies = []Strategy{OCSPStrategy{}}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b64, err := url.QueryUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/"))
+		if err != nil {
+			t.Errorf("Failed to unescape OCSP request: %s", err)
+			return
+		}
+		der, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			t.Errorf("Failed to decode OCSP request %q: %s", b64, err)
+			return
+		}
+		var req ocspRequest
+		if _, err := asn1.Unmarshal(der, &req); err != nil {
+			t.Errorf("Failed to parse OCSP request: %s", err)
+			return
+		}
+		if len(req.TBSRequest.RequestList) != 1 || req.TBSRequest.RequestList[0].Cert.SerialNumber.Cmp(fix.cert.SerialNumber) != 0 {
+			t.Errorf("OCSP request isn't for the leaf")
+		}
+
+		basic, err := asn1.Marshal(ocspBasicResponse{
+			TBSResponseData:    asn1.RawValue{FullBytes: []byte{0x30, 0}},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1},
+			Signature:          asn1.BitString{Bytes: []byte{0}, BitLength: 8},
+			Certificates:       []asn1.RawValue{{FullBytes: thawte.Raw}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to marshal basic OCSP response: %s", err)
+		}
+		resp, err := asn1.Marshal(ocspResponse{
+			ResponseBytes: ocspResponseBytes{ResponseType: oidOCSPBasicResponse, Response: basic},
+		})
+		if err != nil {
+			t.Fatalf("Failed to marshal OCSP response: %s", err)
+		}
+		w.Write(resp)
+	}))
+	defer ts.Close()
+
+	// The leaf has no CA Issuers URL, so can only be fixed through OCSP.
+	leaf := *fix.cert
+	leaf.IssuingCertificateURL = nil
+	leaf.OCSPServer = []string{ts.URL}
+	leaf.AuthorityKeyId = []byte{1, 2, 3, 4}
+	fix.cert = &leaf
+
+	chains, ferrs := fix.fixChain()
+	matchTestChainList(t, 0, [][]string{{"Google", "Thawte", "VeriSign"}}, chains)
+	matchTestErrorList(t, 0, nil, ferrs)
+}
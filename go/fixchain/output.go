@@ -0,0 +1,153 @@
+package fixchain
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// OutputPolicy is what a Fixer does when the consumer of its chains,
+// ChainsWithMetadata or errors channel isn't keeping up, and a worker can't push a result to it.
+type OutputPolicy int
+
+const (
+	// BlockOutput makes the worker wait until the result is read, so that
+	// nothing is lost but a stalled consumer stalls every worker.
+	BlockOutput OutputPolicy = iota
+	// DropOutput makes the worker drop the result once it has waited for
+	// FixerOptions.OutputTimeout.  A dropped chain is reported as an
+	// OutputDropped error instead, and dropped errors are only counted.
+	DropOutput
+)
+
+var errChainsFull = errors.New("chains channel full, chain dropped")
+
+// startOutputBuffers interposes buffers of the given size between the workers
+// and the chains and errors channels, which are drained by a goroutine each
+// until the buffers are closed by Wait.
+func (f *Fixer) startOutputBuffers(size int) {
+	chains, errs := f.chains, f.errors
+	chainBuf := make(chan []*x509.Certificate, size)
+	errBuf := make(chan *FixError, size)
+	f.chains, f.errors = chainBuf, errBuf
+
+	f.outputWG.Add(2)
+	go func() {
+		defer f.outputWG.Done()
+		for chain := range chainBuf {
+			select {
+			case chains <- chain:
+			case <-f.ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		defer f.outputWG.Done()
+		for ferr := range errBuf {
+			select {
+			case errs <- ferr:
+			case <-f.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// closeOutputBuffers closes the output buffers, if there are any, and waits
+// for what is in them to be pushed to the chains and errors channels.
+func (f *Fixer) closeOutputBuffers() {
+	if f.opts.OutputBuffer <= 0 {
+		return
+	}
+	close(f.chains)
+	close(f.errors)
+	f.outputWG.Wait()
+}
+
+// dropTimer returns a channel which fires when a blocked send should give up
+// and drop its result, which is never under BlockOutput, and a function to
+// release the timer.
+func (f *Fixer) dropTimer() (<-chan time.Time, func() bool) {
+	if f.opts.OutputPolicy != DropOutput {
+		return nil, func() bool { return false }
+	}
+	t := time.NewTimer(f.opts.OutputTimeout)
+	return t.C, t.Stop
+}
+
+// blocked records that a worker was blocked pushing a result since start.
+func (f *Fixer) blocked(start time.Time) {
+	total := atomic.AddInt64(&f.blockedFor, int64(time.Since(start)))
+	f.metrics.SetGauge(OutputBlockedGauge, total/int64(time.Millisecond))
+}
+
+func (f *Fixer) drop() {
+	atomic.AddUint64(&f.dropped, 1)
+	f.metrics.IncCounter(OutputDroppedCounter)
+}
+
+// sendError pushes ferr to the errors channel according to the OutputPolicy.
+// It returns false if the Fixer's context was cancelled first.
+func (f *Fixer) sendError(ferr *FixError) bool {
+	select {
+	case f.errors <- ferr:
+		return true
+	default:
+	}
+
+	defer f.blocked(time.Now())
+	timeout, stop := f.dropTimer()
+	defer stop()
+	select {
+	case f.errors <- ferr:
+	case <-timeout:
+		f.drop()
+	case <-f.ctx.Done():
+		return false
+	}
+	return true
+}
+
+// sendChain pushes chain to the chains channel, or m, which holds chain, to
+// the ChainsWithMetadata channel if it isn't nil, according to the
+// OutputPolicy.  It returns false if the Fixer's context was cancelled first.
+func (f *Fixer) sendChain(chain []*x509.Certificate, m *ChainWithMetadata) bool {
+	// Only one of the channels is sent on, as a nil channel never is.
+	chains, withMetadata := f.chains, f.opts.ChainsWithMetadata
+	if m != nil {
+		chains = nil
+	} else {
+		withMetadata = nil
+	}
+	select {
+	case chains <- chain:
+		return true
+	case withMetadata <- m:
+		return true
+	default:
+	}
+
+	start := time.Now()
+	timeout, stop := f.dropTimer()
+	defer stop()
+	select {
+	case chains <- chain:
+		f.blocked(start)
+	case withMetadata <- m:
+		f.blocked(start)
+	case <-timeout:
+		f.blocked(start)
+		f.drop()
+		ferr := &FixError{Type: OutputDropped, Chain: chain, Error: errChainsFull}
+		if len(chain) > 0 {
+			ferr.Cert = chain[0]
+		}
+		return f.sendError(ferr)
+	case <-f.ctx.Done():
+		return false
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package fixchain
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+func TestOutputBuffer(t *testing.T) {
+	chains := make(chan []*x509.Certificate)
+	errors := make(chan *FixError)
+	f := NewFixerWithOptions(context.Background(), 2, chains, errors, &http.Client{}, FixerOptions{OutputBuffer: 10})
+
+	leaf := GetTestCertificateFromPEM(t, googleLeaf)
+	chain := extractTestChain(t, 0, []string{thawteIntermediate})
+	roots := extractTestRoots(t, 0, []string{verisignRoot})
+	for i := 0; i < 5; i++ {
+		f.QueueChain(leaf, chain, roots)
+	}
+
+	// Nothing is reading the chains yet, so the workers can only finish
+	// if their output is buffered.
+	for start := time.Now(); f.Stats().Reconstructed != 5; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Workers didn't finish without a consumer: %+v", f.Stats())
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go testChains(t, 0, [][]string{
+		{"Google", "Thawte", "VeriSign"},
+		{"Google", "Thawte", "VeriSign"},
+		{"Google", "Thawte", "VeriSign"},
+		{"Google", "Thawte", "VeriSign"},
+		{"Google", "Thawte", "VeriSign"},
+	}, chains, &wg)
+	go testErrors(t, 0, nil, errors, &wg)
+	f.Wait()
+	close(chains)
+	close(errors)
+	wg.Wait()
+}
+
+func TestDropOutput(t *testing.T) {
+	for _, withMetadata := range []bool{false, true} {
+		// Nothing ever reads the chains.
+		chains := make(chan []*x509.Certificate)
+		errors := make(chan *FixError)
+		opts := FixerOptions{
+			OutputPolicy:  DropOutput,
+			OutputTimeout: 10 * time.Millisecond,
+		}
+		if withMetadata {
+			opts.ChainsWithMetadata = make(chan *ChainWithMetadata)
+		}
+		f := NewFixerWithOptions(context.Background(), 1, chains, errors, &http.Client{}, opts)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go testErrors(t, 0, []errorType{OutputDropped}, errors, &wg)
+		f.QueueChain(GetTestCertificateFromPEM(t, googleLeaf),
+			extractTestChain(t, 0, []string{thawteIntermediate}),
+			extractTestRoots(t, 0, []string{verisignRoot}))
+		f.Wait()
+		close(errors)
+		wg.Wait()
+
+		s := f.Stats()
+		if s.Dropped != 1 {
+			t.Errorf("withMetadata=%t: Stats() returned %d dropped, expected 1", withMetadata, s.Dropped)
+		}
+		if s.OutputBlocked < 10*time.Millisecond {
+			t.Errorf("withMetadata=%t: Stats() returned %s blocked, expected at least the output timeout", withMetadata, s.OutputBlocked)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package fixchain
+
+import (
+	"fmt"
+
+	"github.com/google/certificate-transparency/go/chains"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// PartialChain is the longest chain that could be built from a certificate
+// whose chain couldn't be fixed, with the reason it couldn't be completed.
+type PartialChain struct {
+	Cert  *x509.Certificate   // The supplied leaf certificate
+	Chain []*x509.Certificate // The supplied chain
+
+	// The partial chain, starting with the leaf and followed by each issuer
+	// that could be found from the supplied chain and fetched certificates.
+	Partial []*x509.Certificate
+
+	// Why the partial chain couldn't be extended to a root.
+	Reason string
+}
+
+// partialChain builds the longest chain it can from the leaf of fix, using the
+// supplied chain and any intermediates found while trying to fix it.
+func (fix *toFix) partialChain() *PartialChain {
+	candidates := append(append([]*x509.Certificate{}, fix.chain...), fix.found...)
+	p := &PartialChain{
+		Cert:    fix.cert,
+		Chain:   fix.chain,
+		Partial: []*x509.Certificate{fix.cert},
+	}
+
+	cur := fix.cert
+	for {
+		if string(cur.RawIssuer) == string(cur.RawSubject) {
+			p.Reason = fmt.Sprintf("chain ends in self-signed certificate %s, which is not a trusted root", subjectName(cur))
+			return p
+		}
+		var issuer *x509.Certificate
+		for _, c := range candidates {
+			if string(c.RawSubject) == string(cur.RawIssuer) && !chains.Contains(p.Partial, c) && cur.CheckSignatureFrom(c) == nil {
+				issuer = c
+				break
+			}
+		}
+		if issuer == nil {
+			p.Reason = fmt.Sprintf("no issuer found for %s", subjectName(cur))
+			if fix.roots != nil {
+				for _, s := range fix.roots.Subjects() {
+					if string(s) == string(cur.RawIssuer) {
+						p.Reason = fmt.Sprintf("issuer of %s has the subject of a trusted root, but the chain doesn't verify", subjectName(cur))
+						break
+					}
+				}
+			}
+			return p
+		}
+		p.Partial = append(p.Partial, issuer)
+		cur = issuer
+	}
+}
+
+// subjectName returns a short human readable name for the subject of cert.
+func subjectName(cert *x509.Certificate) string {
+	n := cert.Subject
+	switch {
+	case n.CommonName != "":
+		return fmt.Sprintf("%q", n.CommonName)
+	case len(n.OrganizationalUnit) > 0:
+		return fmt.Sprintf("%q", n.OrganizationalUnit[0])
+	case len(n.Organization) > 0:
+		return fmt.Sprintf("%q", n.Organization[0])
+	}
+	return "(empty subject)"
+}
@@ -0,0 +1,51 @@
+package fixchain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+func TestPartialChain(t *testing.T) {
+	partialChainTests := []struct {
+		cert  string
+		chain []string
+		roots []string
+
+		partial []string
+		reason  string
+	}{
+		{ // No roots, so the chain ends at the self-signed root
+			cert:  googleLeaf,
+			chain: []string{verisignRoot, thawteIntermediate},
+
+			partial: []string{"Google", "Thawte", "VeriSign"},
+			reason:  "self-signed",
+		},
+		{ // Missing intermediate
+			cert:  googleLeaf,
+			roots: []string{verisignRoot},
+
+			partial: []string{"Google"},
+			reason:  "no issuer found",
+		},
+		{ // Intermediate is present but its issuer isn't
+			cert:  googleLeaf,
+			chain: []string{thawteIntermediate},
+
+			partial: []string{"Google", "Thawte"},
+			reason:  "no issuer found",
+		},
+	}
+
+	for i, test := range partialChainTests {
+		ft := &fixTest{cert: test.cert, chain: test.chain, roots: test.roots}
+		fix := setUpFix(t, i, ft)
+		p := fix.partialChain()
+		matchTestChainList(t, i, [][]string{test.partial}, [][]*x509.Certificate{p.Partial})
+		if !strings.Contains(p.Reason, test.reason) {
+			t.Errorf("#%d: Reason %q doesn't contain %q", i, p.Reason, test.reason)
+		}
+	}
+}
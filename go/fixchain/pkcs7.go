@@ -0,0 +1,118 @@
+package fixchain
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+var oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+// contentInfo is the outer structure of a PKCS#7 message (RFC 2315 section 7).
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// parsePKCS7Certificates returns the certificates contained in a DER encoded
+// PKCS#7 SignedData message, such as a .p7c or .p7b file.
+func parsePKCS7Certificates(der []byte) ([]*x509.Certificate, error) {
+	var ci contentInfo
+	rest, err := asn1.Unmarshal(der, &ci)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, asn1.SyntaxError{Msg: "trailing data after PKCS#7 message"}
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("PKCS#7 content type %v is not SignedData", ci.ContentType)
+	}
+	// SignedData (RFC 2315 section 9.1) is a SEQUENCE in which the
+	// certificates are an optional [0] IMPLICIT SET.  RawValue fields don't
+	// take part in matching optional tags, so the fields are walked by hand
+	// rather than unmarshalled into a struct.
+	var sd asn1.RawValue
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	var certSet []byte
+	for b := sd.Bytes; len(b) > 0; {
+		var field asn1.RawValue
+		if b, err = asn1.Unmarshal(b, &field); err != nil {
+			return nil, err
+		}
+		if field.Class == asn1.ClassContextSpecific && field.Tag == 0 {
+			certSet = field.Bytes
+			break
+		}
+	}
+
+	var certs []*x509.Certificate
+	for b := certSet; len(b) > 0; {
+		var raw asn1.RawValue
+		if b, err = asn1.Unmarshal(b, &raw); err != nil {
+			return nil, err
+		}
+		cert, err := parseCertificate(raw.FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("PKCS#7 message contains no certificates")
+	}
+	return certs, nil
+}
+
+// parseIssuerCertificates returns the certificates in the body of a response
+// from an AIA URL, which may be a single DER certificate, a DER PKCS#7 bundle,
+// or one or more PEM blocks containing either.
+func parseIssuerCertificates(body []byte) ([]*x509.Certificate, error) {
+	certs, err := parseDERCertificates(body)
+	if err == nil {
+		return certs, nil
+	}
+
+	var pemCerts []*x509.Certificate
+	for rest := body; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE", "PKCS7":
+		default:
+			continue
+		}
+		c, perr := parseDERCertificates(block.Bytes)
+		if perr != nil {
+			return nil, perr
+		}
+		pemCerts = append(pemCerts, c...)
+	}
+	if len(pemCerts) == 0 {
+		// Report why the body didn't parse as DER, as there was no PEM.
+		return nil, err
+	}
+	return pemCerts, nil
+}
+
+// parseDERCertificates parses der as a certificate, falling back to a PKCS#7
+// bundle of certificates.
+func parseDERCertificates(der []byte) ([]*x509.Certificate, error) {
+	cert, err := parseCertificate(der)
+	if err == nil {
+		return []*x509.Certificate{cert}, nil
+	}
+	certs, perr := parsePKCS7Certificates(der)
+	if perr != nil {
+		return nil, err
+	}
+	return certs, nil
+}
@@ -0,0 +1,80 @@
+package fixchain
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// Thawte intermediate and VeriSign root, as a DER PKCS#7 bundle made with
+// openssl crl2pkcs7 -nocrl.
+const thawteVerisignPKCS7 = `
+MIIFkgYJKoZIhvcNAQcCoIIFgzCCBX8CAQExADALBgkqhkiG9w0BBwGgggVnMIID
+IzCCAoygAwIBAgIEMAAAAjANBgkqhkiG9w0BAQUFADBfMQswCQYDVQQGEwJVUzEX
+MBUGA1UEChMOVmVyaVNpZ24sIEluYy4xNzA1BgNVBAsTLkNsYXNzIDMgUHVibGlj
+IFByaW1hcnkgQ2VydGlmaWNhdGlvbiBBdXRob3JpdHkwHhcNMDQwNTEzMDAwMDAw
+WhcNMTQwNTEyMjM1OTU5WjBMMQswCQYDVQQGEwJaQTElMCMGA1UEChMcVGhhd3Rl
+IENvbnN1bHRpbmcgKFB0eSkgTHRkLjEWMBQGA1UEAxMNVGhhd3RlIFNHQyBDQTCB
+nzANBgkqhkiG9w0BAQEFAAOBjQAwgYkCgYEA1NNn0I0Vf67NMf59HZGhPwtxPKzM
+yGT7Y/wySweUvW+Aui/hBJPAM/wJMyPpC3QrccQDxtLN4i/1CWPN/0ilAL/g5/OI
+ty0y3pg25gqtAHvEZEo7hHUD8nCSfQ5i9SGraTaEMXWQ+L/HbIgbBpV8yeWo3nWh
+LHpo39XKHIdYYBkCAwEAAaOB/jCB+zASBgNVHRMBAf8ECDAGAQH/AgEAMAsGA1Ud
+DwQEAwIBBjARBglghkgBhvhCAQEEBAMCAQYwKAYDVR0RBCEwH6QdMBsxGTAXBgNV
+BAMTEFByaXZhdGVMYWJlbDMtMTUwMQYDVR0fBCowKDAmoCSgIoYgaHR0cDovL2Ny
+bC52ZXJpc2lnbi5jb20vcGNhMy5jcmwwMgYIKwYBBQUHAQEEJjAkMCIGCCsGAQUF
+BzABhhZodHRwOi8vb2NzcC50aGF3dGUuY29tMDQGA1UdJQQtMCsGCCsGAQUFBwMB
+BggrBgEFBQcDAgYJYIZIAYb4QgQBBgpghkgBhvhFAQgBMA0GCSqGSIb3DQEBBQUA
+A4GBAFWsY+reod3SkF+fC852vhNRj5PZBSvIG3dLrWlQoe7e3P3bB+noOZTcq3J5
+Lwa/q4FwxKjt6lM07e8eU9kGx1Yr0Vz00YqOtCuxN5BICEIlxT6Ky3/rbwTRbcV0
+oveifHtgPHfNDs5IAn8BL7abN+AqKjbc1YXWrOU/VG+WHgWvMIICPDCCAaUCEHC6
+5B0Q2Sk0tjjKewPMur8wDQYJKoZIhvcNAQECBQAwXzELMAkGA1UEBhMCVVMxFzAV
+BgNVBAoTDlZlcmlTaWduLCBJbmMuMTcwNQYDVQQLEy5DbGFzcyAzIFB1YmxpYyBQ
+cmltYXJ5IENlcnRpZmljYXRpb24gQXV0aG9yaXR5MB4XDTk2MDEyOTAwMDAwMFoX
+DTI4MDgwMTIzNTk1OVowXzELMAkGA1UEBhMCVVMxFzAVBgNVBAoTDlZlcmlTaWdu
+LCBJbmMuMTcwNQYDVQQLEy5DbGFzcyAzIFB1YmxpYyBQcmltYXJ5IENlcnRpZmlj
+YXRpb24gQXV0aG9yaXR5MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDJXFme
+8huKARS0EN8EQNvjV69qRUCPhAwL0TPZ2RHP7gJYHyX3KqhEBarsAx94f56TuZoA
+qiN91qyFomNFx3InzPRMxnVx0jnvT0Lwdd8KkMaOIG+YD/isI19wKTakyYbnsZog
+y1Olhec9vn2a/iRFM9x2Fe0PonFkTGUugWhFpwIDAQABMA0GCSqGSIb3DQEBAgUA
+A4GBALtMEivPLCYATxQT3ab7/AoRhIzzKBxnki98tsX63/Dolbwdj2wsqFHMc9ik
+wFPwTtYmwHYBV4GSXiHx0bH/59AhWM1pF+NEHJwZRDmJXNycAA9WjQKZ7aKQRUzk
+uxCkPfAyAw7xzvjoyVGM5mKf5p/AfbdynMk2OmufTqj/ZA1kMQA=`
+
+func TestParseIssuerCertificates(t *testing.T) {
+	p7, err := base64.StdEncoding.DecodeString(thawteVerisignPKCS7)
+	if err != nil {
+		t.Fatalf("Failed to decode PKCS#7 test data: %s", err)
+	}
+	thawte := GetTestCertificateFromPEM(t, thawteIntermediate)
+	p7PEM := pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: p7})
+
+	parseTests := []struct {
+		body []byte
+		want []string
+	}{
+		{thawte.Raw, []string{"Thawte"}},
+		{[]byte(thawteIntermediate), []string{"Thawte"}},
+		{[]byte(thawteIntermediate + "\n" + verisignRoot), []string{"Thawte", "VeriSign"}},
+		{p7, []string{"Thawte", "VeriSign"}},
+		{p7PEM, []string{"Thawte", "VeriSign"}},
+		{[]byte("not a certificate"), nil},
+		{p7[:len(p7)-10], nil},
+	}
+
+	for i, test := range parseTests {
+		certs, err := parseIssuerCertificates(test.body)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("#%d: parseIssuerCertificates() succeeded, expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: parseIssuerCertificates() failed: %s", i, err)
+			continue
+		}
+		matchTestChainList(t, i, [][]string{test.want}, [][]*x509.Certificate{certs})
+	}
+}
@@ -0,0 +1,86 @@
+package fixchain
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// Maximum number of chains held in the Fixer's priority queue waiting for a
+// worker.  Once it is full QueueChain blocks.
+const queueSize = 1000
+
+// fixHeap is a heap of chains waiting to be fixed, ordered so that the chain
+// with the highest priority is at the top, and chains with equal priority are
+// fixed in the order they were queued.
+type fixHeap []*toFix
+
+func (h fixHeap) Len() int { return len(h) }
+
+func (h fixHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h fixHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *fixHeap) Push(x interface{}) { *h = append(*h, x.(*toFix)) }
+
+func (h *fixHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// dispatch moves chains from the toFix channel, on which they are queued, to
+// the work channel, from which the workers take them, always handing out the
+// highest priority chain it holds.  Once toFix is closed and every queued
+// chain has been handed out, work is closed.
+func (f *Fixer) dispatch() {
+	var q fixHeap
+	var seq uint64
+	in := f.toFix
+	for {
+		var out chan *toFix
+		var next *toFix
+		if q.Len() > 0 {
+			out = f.work
+			next = q[0]
+		} else if in == nil {
+			close(f.work)
+			return
+		}
+		accept := in
+		if q.Len() >= queueSize {
+			accept = nil
+		}
+
+		select {
+		case fix, ok := <-accept:
+			if !ok {
+				in = nil
+				continue
+			}
+			fix.seq = seq
+			seq++
+			heap.Push(&q, fix)
+		case out <- next:
+			heap.Pop(&q)
+		case <-f.ctx.Done():
+			return
+		}
+		f.metrics.SetGauge(QueueDepthGauge, int64(q.Len()))
+	}
+}
+
+// ExpiryPriority returns a priority for QueueChainWithPriority which is higher
+// the sooner cert expires, so that certificates which are about to expire are
+// fixed before the rest of the backlog.
+func ExpiryPriority(cert *x509.Certificate, now time.Time) int {
+	return -int(cert.NotAfter.Sub(now) / (24 * time.Hour))
+}
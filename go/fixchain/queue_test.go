@@ -0,0 +1,83 @@
+package fixchain
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// depthMetrics records the largest and latest values of QueueDepthGauge.
+type depthMetrics struct {
+	mu       sync.Mutex
+	max, now int64
+}
+
+func (m *depthMetrics) IncCounter(name string) {}
+
+func (m *depthMetrics) SetGauge(name string, v int64) {
+	if name != QueueDepthGauge {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = v
+	if v > m.max {
+		m.max = v
+	}
+}
+
+func TestDispatchPriority(t *testing.T) {
+	metrics := &depthMetrics{}
+	f := &Fixer{
+		ctx:     context.Background(),
+		toFix:   make(chan *toFix),
+		work:    make(chan *toFix),
+		metrics: metrics,
+	}
+	go f.dispatch()
+
+	cert := GetTestCertificateFromPEM(t, googleLeaf)
+	priorities := []int{0, 5, -1, 5, 10, 0}
+	for _, p := range priorities {
+		f.QueueChainWithPriority(cert, nil, nil, p)
+	}
+	close(f.toFix)
+
+	// Chains come out highest priority first, and in the order they were
+	// queued within a priority.
+	expected := []struct {
+		priority int
+		seq      uint64
+	}{{10, 4}, {5, 1}, {5, 3}, {0, 0}, {0, 5}, {-1, 2}}
+	i := 0
+	for fix := range f.work {
+		if i >= len(expected) {
+			t.Fatalf("Dispatched more chains than were queued")
+		}
+		if fix.priority != expected[i].priority || fix.seq != expected[i].seq {
+			t.Errorf("#%d: Dispatched chain with priority %d, seq %d, expected priority %d, seq %d",
+				i, fix.priority, fix.seq, expected[i].priority, expected[i].seq)
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Errorf("Dispatched %d chains, expected %d", i, len(expected))
+	}
+	// Every chain was queued before the first was dispatched.
+	if metrics.max != int64(len(expected)) || metrics.now != 0 {
+		t.Errorf("Queue depth reached %d and ended at %d, expected %d and 0", metrics.max, metrics.now, len(expected))
+	}
+}
+
+func TestExpiryPriority(t *testing.T) {
+	now := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	soon := &x509.Certificate{NotAfter: now.Add(2 * 24 * time.Hour)}
+	later := &x509.Certificate{NotAfter: now.Add(200 * 24 * time.Hour)}
+	if ExpiryPriority(soon, now) <= ExpiryPriority(later, now) {
+		t.Errorf("ExpiryPriority() for cert expiring soon (%d) isn't higher than for cert expiring later (%d)",
+			ExpiryPriority(soon, now), ExpiryPriority(later, now))
+	}
+}
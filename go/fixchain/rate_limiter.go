@@ -0,0 +1,102 @@
+package fixchain
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// tokenBucket holds the state of the rate limit for a single host.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// hostLimiter limits the rate at which requests are made to each host, using
+// a token bucket per host.
+type hostLimiter struct {
+	rate  float64 // Requests per second
+	burst float64 // Maximum number of requests made at once
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	// Number of requests which had to wait, and the total time spent waiting.
+	throttled uint64
+	waited    time.Duration
+}
+
+// newHostLimiter returns a hostLimiter which allows rate requests per second,
+// in bursts of up to burst requests, to each host.  If rate is not positive
+// newHostLimiter returns nil, and a nil hostLimiter allows every request
+// immediately.
+func newHostLimiter(rate float64, burst int) *hostLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &hostLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// reserve takes a token from the bucket for host, and returns how long the
+// caller must wait before making its request.
+func (h *hostLimiter) reserve(host string, now time.Time) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b, ok := h.buckets[host]
+	if !ok {
+		b = &tokenBucket{tokens: h.burst, last: now}
+		h.buckets[host] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * h.rate
+	if b.tokens > h.burst {
+		b.tokens = h.burst
+	}
+	b.last = now
+	// Tokens can go negative, which reserves them for callers which are
+	// already waiting.
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	d := time.Duration(-b.tokens / h.rate * float64(time.Second))
+	h.throttled++
+	h.waited += d
+	return d
+}
+
+// wait blocks until a request may be made to the host of rawurl, or ctx is
+// cancelled.
+func (h *hostLimiter) wait(ctx context.Context, rawurl string) error {
+	if h == nil {
+		return nil
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		// The fetch itself will fail and report this.
+		return nil
+	}
+	d := h.reserve(u.Host, time.Now())
+	if d == 0 {
+		return nil
+	}
+	return wait(ctx, d)
+}
+
+// stats returns the number of requests which have been throttled, and the
+// total time they have spent waiting.
+func (h *hostLimiter) stats() (uint64, time.Duration) {
+	if h == nil {
+		return 0, 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.throttled, h.waited
+}
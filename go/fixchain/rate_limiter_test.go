@@ -0,0 +1,53 @@
+package fixchain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHostLimiterReserve(t *testing.T) {
+	h := newHostLimiter(2, 2)
+	now := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	reserveTests := []struct {
+		host     string
+		after    time.Duration
+		expected time.Duration
+	}{
+		// The burst is allowed straight away.
+		{"a.example.com", 0, 0},
+		{"a.example.com", 0, 0},
+		// Then requests are spaced out at the rate.
+		{"a.example.com", 0, 500 * time.Millisecond},
+		{"a.example.com", 0, time.Second},
+		// Other hosts have their own bucket.
+		{"b.example.com", 0, 0},
+		// Tokens are refilled over time.
+		{"a.example.com", 2 * time.Second, 0},
+		{"a.example.com", 0, 0},
+		{"a.example.com", 0, 500 * time.Millisecond},
+	}
+	for i, test := range reserveTests {
+		now = now.Add(test.after)
+		if got := h.reserve(test.host, now); got != test.expected {
+			t.Errorf("#%d: reserve(%s) returned %s, expected %s", i, test.host, got, test.expected)
+		}
+	}
+
+	if throttled, waited := h.stats(); throttled != 3 || waited != 2*time.Second {
+		t.Errorf("stats() returned %d throttled for %s, expected 3 for 2s", throttled, waited)
+	}
+}
+
+func TestNilHostLimiter(t *testing.T) {
+	h := newHostLimiter(0, 10)
+	if h != nil {
+		t.Fatal("newHostLimiter() with zero rate returned a limiter")
+	}
+	if err := h.wait(nil, "http://example.com/"); err != nil {
+		t.Errorf("wait() on nil limiter returned error: %s", err)
+	}
+	if throttled, _ := h.stats(); throttled != 0 {
+		t.Errorf("stats() on nil limiter returned %d throttled", throttled)
+	}
+}
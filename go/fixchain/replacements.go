@@ -7,8 +7,8 @@ import (
 	"github.com/google/certificate-transparency/go/x509"
 )
 
-// Go has no PKCS#7 implementation. Rather than fix that, manually
-// replace the few PKCS#7 URLs we know of.
+// The contents of the few PKCS#7 URLs we know of.  These were added before
+// PKCS#7 responses could be parsed, and still save fetching them.
 
 var replacements = map[string][]string{
 	"http://gca.nat.gov.tw/repository/Certs/IssuedToThisCA.p7b": {
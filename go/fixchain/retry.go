@@ -0,0 +1,91 @@
+package fixchain
+
+import (
+	"math/rand"
+	"net"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// RetryPolicy determines how fetches of URLs that fail with a transient error
+// (a 5xx status, a timeout or a connection failure) are retried.  The zero
+// RetryPolicy makes a single attempt with no timeout.
+type RetryPolicy struct {
+	// Maximum number of attempts to fetch a URL, including the first.
+	// Values less than 1 are treated as 1.
+	MaxAttempts int
+
+	// Timeout for each attempt.  Zero means no per-attempt timeout.
+	Timeout time.Duration
+
+	// Backoff before the first retry.  The backoff doubles on each
+	// subsequent retry, up to MaxBackoff.
+	InitialBackoff time.Duration
+
+	// Upper bound on the backoff between attempts.  Zero means no bound.
+	MaxBackoff time.Duration
+
+	// Fraction of each backoff, in [0, 1], which is randomised so that
+	// workers retrying the same server don't do so in lockstep.
+	Jitter float64
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with sensible defaults.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		Timeout:        30 * time.Second,
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Second,
+		Jitter:         0.5,
+	}
+}
+
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns how long to wait before making attempt number attempt
+// (counting from 1 for the first retry).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff == 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// wait blocks for d, returning early with an error if ctx is cancelled.
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// isTransient reports whether a fetch which failed with err, having received
+// the given HTTP status (or 0 if no response was received), is worth retrying.
+func isTransient(status int, err error) bool {
+	if err == nil {
+		return false
+	}
+	if status != 0 {
+		return status >= 500 && status < 600
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
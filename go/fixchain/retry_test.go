@@ -0,0 +1,109 @@
+package fixchain
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	backoffTests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{100, 5 * time.Second},
+	}
+	for _, test := range backoffTests {
+		if got := p.backoff(test.attempt); got != test.expected {
+			t.Errorf("backoff(%d) returned %s, expected %s", test.attempt, got, test.expected)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 500*time.Millisecond || got > time.Second {
+			t.Errorf("backoff(1) with jitter returned %s, expected between 500ms and 1s", got)
+		}
+	}
+}
+
+func TestGetURLRetry(t *testing.T) {
+	retryTests := []struct {
+		failures    int
+		status      int
+		maxAttempts int
+		expectErr   bool
+		expectCalls int
+	}{
+		{0, http.StatusServiceUnavailable, 3, false, 1},
+		{2, http.StatusServiceUnavailable, 3, false, 3},
+		{3, http.StatusServiceUnavailable, 3, true, 3},
+		{2, http.StatusServiceUnavailable, 0, true, 1},
+		// Permanent errors aren't retried.
+		{2, http.StatusNotFound, 3, true, 1},
+	}
+
+	for i, test := range retryTests {
+		calls := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls <= test.failures {
+				w.WriteHeader(test.status)
+				return
+			}
+			w.Write([]byte("body"))
+		}))
+
+		u := newURLCache(&http.Client{}, &FixerOptions{Retry: RetryPolicy{MaxAttempts: test.maxAttempts}})
+		_, err := u.getURL(context.Background(), ts.URL)
+		ts.Close()
+
+		if gotErr := err != nil; gotErr != test.expectErr {
+			t.Errorf("#%d: getURL() returned error %v, expected error: %t", i, err, test.expectErr)
+		}
+		if calls != test.expectCalls {
+			t.Errorf("#%d: server received %d requests, expected %d", i, calls, test.expectCalls)
+		}
+	}
+}
+
+func TestGetURLRetryTruncatedBody(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			// Promising more than is written makes the server close the
+			// connection part way through the body.
+			w.Header().Set("Content-Length", "100")
+		}
+		w.Write([]byte("body"))
+	}))
+	defer ts.Close()
+
+	u := newURLCache(&http.Client{}, &FixerOptions{Retry: RetryPolicy{MaxAttempts: 2}, NegativeCacheTTL: time.Hour})
+	body, err := u.getURL(context.Background(), ts.URL)
+	if err != nil || string(body) != "body" {
+		t.Errorf("getURL()=%q, %v, expected the body after a retry", body, err)
+	}
+	if calls != 2 {
+		t.Errorf("server received %d requests, expected 2", calls)
+	}
+
+	// Failures after a 200 OK aren't remembered.
+	calls = 0
+	u = newURLCache(&http.Client{}, &FixerOptions{Retry: RetryPolicy{MaxAttempts: 1}, NegativeCacheTTL: time.Hour})
+	if _, err := u.getURL(context.Background(), ts.URL); err == nil {
+		t.Fatal("getURL() of truncated body succeeded")
+	}
+	if _, err := u.getURL(context.Background(), ts.URL); err != nil || calls != 2 {
+		t.Errorf("getURL() after a truncated body returned %v after %d requests, expected a new request to succeed", err, calls)
+	}
+}
@@ -0,0 +1,236 @@
+package fixchain
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Canonical sources of the built-in root policies.
+const (
+	// Mozilla's roots with the websites trust bit, as published by CCADB.
+	MozillaRootsURL = "https://ccadb.my.salesforce-sites.com/mozilla/IncludedRootsPEMTxt?TrustBitsInclude=Websites"
+	// The Chrome Root Store.  Gitiles serves the file base64 encoded.
+	ChromeRootsURL = "https://chromium.googlesource.com/chromium/src/+/main/net/data/ssl/chrome_root_store/root_store.certs?format=TEXT"
+	// Apple's roots, as published with the source of its Security
+	// framework.  There is no bundle, so GitHub's contents API is used to
+	// list the DER files of the roots, which are then fetched one by one.
+	AppleRootsURL = "https://api.github.com/repos/apple-oss-distributions/security_certificates/contents/certificates/roots"
+)
+
+// DefaultRootPolicyMaxAge is how long the roots of a built-in root policy are
+// used before they are refreshed from their source.
+const DefaultRootPolicyMaxAge = 24 * time.Hour
+
+// RootPolicy is a named set of roots, such as a browser's root store, which
+// chains can be fixed with respect to using QueueChainWithPolicy.  The roots
+// are loaded from a PEM bundle when they are first needed, and refreshed from
+// it once they are older than the policy's maximum age.  A RootPolicy is safe
+// for concurrent use.
+type RootPolicy struct {
+	name   string
+	source string
+	decode func([]byte) ([]byte, error)
+	// If set, fetches the PEM bundle from source instead of load.
+	fetch  func(ctx context.Context, client *http.Client, source string) ([]byte, error)
+	maxAge time.Duration
+
+	mu     sync.Mutex
+	roots  *x509.CertPool
+	loaded time.Time
+}
+
+// NewRootPolicy returns a RootPolicy whose roots are loaded from the PEM
+// bundle at source, which is either an http or https URL or a file path.  The
+// roots are refreshed once they are older than maxAge; if maxAge is zero,
+// they are loaded once and never refreshed.
+func NewRootPolicy(name, source string, maxAge time.Duration) *RootPolicy {
+	return &RootPolicy{name: name, source: source, maxAge: maxAge}
+}
+
+// NewStaticRootPolicy returns a RootPolicy containing the roots in the given
+// PEM bundle, which is never refreshed.
+func NewStaticRootPolicy(name string, pemCerts []byte) (*RootPolicy, error) {
+	roots, err := parseRoots(pemCerts)
+	if err != nil {
+		return nil, err
+	}
+	return &RootPolicy{name: name, roots: roots, loaded: time.Now()}, nil
+}
+
+// RootPolicyByName returns the built-in root policy with the given name, which
+// is one of "mozilla", "chrome" or "apple".  The roots are loaded from the
+// policy's canonical source when they are first needed.  Other root stores
+// can be used with NewRootPolicy, given a PEM bundle of their roots.
+func RootPolicyByName(name string) (*RootPolicy, error) {
+	switch name {
+	case "mozilla":
+		return NewRootPolicy(name, MozillaRootsURL, DefaultRootPolicyMaxAge), nil
+	case "chrome":
+		p := NewRootPolicy(name, ChromeRootsURL, DefaultRootPolicyMaxAge)
+		p.decode = decodeBase64
+		return p, nil
+	case "apple":
+		return newAppleRootPolicy(AppleRootsURL), nil
+	}
+	return nil, fmt.Errorf("unknown root policy %q", name)
+}
+
+// Name returns the name of the policy.
+func (p *RootPolicy) Name() string {
+	return p.name
+}
+
+// Roots returns the roots of the policy, loading them using client if they
+// haven't been loaded yet or are out of date.  If they are out of date but
+// can't be refreshed, the previous roots continue to be used.
+func (p *RootPolicy) Roots(ctx context.Context, client *http.Client) (*x509.CertPool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.roots != nil && (p.source == "" || p.maxAge <= 0 || time.Since(p.loaded) < p.maxAge) {
+		return p.roots, nil
+	}
+	if err := p.refresh(ctx, client); err != nil {
+		if p.roots == nil {
+			return nil, err
+		}
+		log.Printf("root policy %s: failed to refresh, using roots loaded %s: %s", p.name, p.loaded, err)
+	}
+	return p.roots, nil
+}
+
+// Refresh reloads the roots of the policy from its source using client,
+// regardless of their age.
+func (p *RootPolicy) Refresh(ctx context.Context, client *http.Client) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.refresh(ctx, client)
+}
+
+func (p *RootPolicy) refresh(ctx context.Context, client *http.Client) error {
+	if p.source == "" {
+		return nil
+	}
+	var body []byte
+	var err error
+	if p.fetch != nil {
+		body, err = p.fetch(ctx, client, p.source)
+	} else {
+		body, err = p.load(ctx, client)
+	}
+	if err != nil {
+		return fmt.Errorf("root policy %s: failed to load %s: %s", p.name, p.source, err)
+	}
+	if p.decode != nil {
+		if body, err = p.decode(body); err != nil {
+			return fmt.Errorf("root policy %s: failed to decode %s: %s", p.name, p.source, err)
+		}
+	}
+	roots, err := parseRoots(body)
+	if err != nil {
+		return fmt.Errorf("root policy %s: %s: %s", p.name, p.source, err)
+	}
+	p.roots = roots
+	p.loaded = time.Now()
+	return nil
+}
+
+func (p *RootPolicy) load(ctx context.Context, client *http.Client) ([]byte, error) {
+	if !strings.HasPrefix(p.source, "http://") && !strings.HasPrefix(p.source, "https://") {
+		return ioutil.ReadFile(p.source)
+	}
+	return fetchURL(ctx, client, p.source)
+}
+
+// newAppleRootPolicy returns the "apple" policy, whose roots are listed by the
+// GitHub contents API at listURL.
+func newAppleRootPolicy(listURL string) *RootPolicy {
+	p := NewRootPolicy("apple", listURL, DefaultRootPolicyMaxAge)
+	p.fetch = fetchGitHubRoots
+	return p
+}
+
+// fetchGitHubRoots returns a PEM bundle of the certificates in the directory
+// which the GitHub contents API lists at listURL.  Each file holds one
+// certificate, in DER or PEM form.
+func fetchGitHubRoots(ctx context.Context, client *http.Client, listURL string) ([]byte, error) {
+	body, err := fetchURL(ctx, client, listURL)
+	if err != nil {
+		return nil, err
+	}
+	var files []struct {
+		Name        string `json:"name"`
+		Type        string `json:"type"`
+		DownloadURL string `json:"download_url"`
+	}
+	if err := json.Unmarshal(body, &files); err != nil {
+		return nil, fmt.Errorf("failed to parse directory listing: %s", err)
+	}
+	var bundle bytes.Buffer
+	for _, f := range files {
+		if f.Type != "file" || f.DownloadURL == "" {
+			continue
+		}
+		cert, err := fetchURL(ctx, client, f.DownloadURL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Name, err)
+		}
+		if bytes.Contains(cert, []byte("-----BEGIN")) {
+			bundle.Write(cert)
+			bundle.WriteByte('\n')
+			continue
+		}
+		pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: cert})
+	}
+	return bundle.Bytes(), nil
+}
+
+func fetchURL(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	resp, err := ctxhttp.Get(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpStatusError{resp.StatusCode}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func parseRoots(pemCerts []byte) (*x509.CertPool, error) {
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pemCerts) {
+		return nil, errors.New("no certificates found in PEM bundle")
+	}
+	return roots, nil
+}
+
+func decodeBase64(b []byte) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+}
+
+// QueueChainWithPolicy adds the given cert and chain to the queue to be fixed
+// by the fixer in the same way as QueueChain, with respect to the current
+// roots of the given policy.  An error is returned if the policy's roots
+// can't be loaded.
+func (f *Fixer) QueueChainWithPolicy(cert *x509.Certificate, chain []*x509.Certificate, policy *RootPolicy) error {
+	roots, err := policy.Roots(f.ctx, f.cache.client)
+	if err != nil {
+		return err
+	}
+	f.QueueChain(cert, chain, roots)
+	return nil
+}
@@ -0,0 +1,168 @@
+package fixchain
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRootPolicyRefresh(t *testing.T) {
+	var requests, fail int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&fail) != 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(verisignRoot))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	p := NewRootPolicy("test", ts.URL, time.Hour)
+	for i := 0; i < 2; i++ {
+		roots, err := p.Roots(ctx, &http.Client{})
+		if err != nil {
+			t.Fatalf("Roots() failed: %s", err)
+		}
+		if len(roots.Subjects()) != 1 {
+			t.Fatalf("Got %d roots, expected 1", len(roots.Subjects()))
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Roots were fetched %d times, expected once", requests)
+	}
+
+	// Once the roots are out of date they are refreshed, but if that fails
+	// the previous roots are still used.
+	p.maxAge = time.Nanosecond
+	atomic.StoreInt32(&fail, 1)
+	roots, err := p.Roots(ctx, &http.Client{})
+	if err != nil {
+		t.Fatalf("Roots() failed after failed refresh: %s", err)
+	}
+	if len(roots.Subjects()) != 1 {
+		t.Errorf("Got %d roots after failed refresh, expected 1", len(roots.Subjects()))
+	}
+	if requests != 2 {
+		t.Errorf("Roots were fetched %d times, expected twice", requests)
+	}
+	if err := p.Refresh(ctx, &http.Client{}); err == nil {
+		t.Error("Refresh() succeeded with a failing source")
+	}
+
+	// Roots that have never been loaded can't fall back.
+	if _, err := NewRootPolicy("test", ts.URL, 0).Roots(ctx, &http.Client{}); err == nil {
+		t.Error("Roots() succeeded with a failing source and no previous roots")
+	}
+}
+
+func TestRootPolicySources(t *testing.T) {
+	ctx := context.Background()
+
+	f, err := ioutil.TempFile("", "roots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write([]byte(verisignRoot + thawteIntermediate))
+	f.Close()
+	roots, err := NewRootPolicy("file", f.Name(), 0).Roots(ctx, nil)
+	if err != nil {
+		t.Fatalf("Roots() failed for file: %s", err)
+	}
+	if len(roots.Subjects()) != 2 {
+		t.Errorf("Got %d roots from file, expected 2", len(roots.Subjects()))
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(base64.StdEncoding.EncodeToString([]byte(verisignRoot))))
+	}))
+	defer ts.Close()
+	p := NewRootPolicy("base64", ts.URL, 0)
+	p.decode = decodeBase64
+	roots, err = p.Roots(ctx, &http.Client{})
+	if err != nil {
+		t.Fatalf("Roots() failed for base64 bundle: %s", err)
+	}
+	if len(roots.Subjects()) != 1 {
+		t.Errorf("Got %d roots from base64 bundle, expected 1", len(roots.Subjects()))
+	}
+
+	s, err := NewStaticRootPolicy("static", []byte(verisignRoot))
+	if err != nil {
+		t.Fatalf("NewStaticRootPolicy() failed: %s", err)
+	}
+	if err := s.Refresh(ctx, nil); err != nil {
+		t.Errorf("Refresh() failed for static policy: %s", err)
+	}
+	if _, err := NewStaticRootPolicy("static", []byte("not PEM")); err == nil {
+		t.Error("NewStaticRootPolicy() succeeded without any certificates")
+	}
+}
+
+func TestRootPolicyByName(t *testing.T) {
+	for _, name := range []string{"mozilla", "chrome", "apple"} {
+		p, err := RootPolicyByName(name)
+		if err != nil {
+			t.Errorf("RootPolicyByName(%q) failed: %s", name, err)
+			continue
+		}
+		if p.Name() != name {
+			t.Errorf("RootPolicyByName(%q) returned policy named %q", name, p.Name())
+		}
+	}
+	for _, name := range []string{"unknown"} {
+		if _, err := RootPolicyByName(name); err == nil {
+			t.Errorf("RootPolicyByName(%q) succeeded", name)
+		}
+	}
+}
+
+func TestAppleRootPolicy(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/roots":
+			fmt.Fprintf(w, `[
+				{"name": "VeriSign.cer", "type": "file", "download_url": "%[1]s/VeriSign.cer"},
+				{"name": "Thawte.pem", "type": "file", "download_url": "%[1]s/Thawte.pem"},
+				{"name": "old", "type": "dir", "download_url": null}
+			]`, ts.URL)
+		case "/broken":
+			fmt.Fprintf(w, `[{"name": "Missing.cer", "type": "file", "download_url": "%s/Missing.cer"}]`, ts.URL)
+		case "/VeriSign.cer":
+			w.Write(GetTestCertificateFromPEM(t, verisignRoot).Raw)
+		case "/Thawte.pem":
+			w.Write([]byte(thawteIntermediate))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	p := newAppleRootPolicy(ts.URL + "/roots")
+	roots, err := p.Roots(context.Background(), &http.Client{})
+	if err != nil {
+		t.Fatalf("Roots() failed: %s", err)
+	}
+	if len(roots.Subjects()) != 2 {
+		t.Errorf("Got %d roots, expected 2", len(roots.Subjects()))
+	}
+
+	// A listing or root which can't be fetched fails the whole refresh.
+	for _, path := range []string{"/missing", "/broken"} {
+		p = newAppleRootPolicy(ts.URL + path)
+		if err := p.Refresh(context.Background(), &http.Client{}); err == nil {
+			t.Errorf("Refresh() of %s succeeded", path)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package fixchain
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// FixerStats is a snapshot of the statistics of a Fixer.
+type FixerStats struct {
+	Workers int   // Workers, whether or not they are fixing a chain
+	Active  int   // Workers currently fixing a chain
+	Queued  int64 // Callers of QueueChain waiting for their chain to be queued
+
+	Reconstructed    uint64 // Chains which verified as supplied
+	NotReconstructed uint64 // Chains which didn't verify as supplied
+	Fixed            uint64 // Chains which didn't verify as supplied, but were fixed
+	NotFixed         uint64 // Chains which couldn't be fixed
+	Skipped          uint64 // Chains skipped because they were fixed before the checkpoint passed to Resume
+	AlreadyDone      uint64 // Chains which shared the result of an identical chain being fixed concurrently
+	TimedOut         uint64 // Fix attempts abandoned at their deadline
+	Dropped          uint64 // Chains and errors dropped under the DropOutput policy
+
+	OutputBlocked time.Duration // Total time workers were blocked pushing results
+
+	Cache URLCacheStats
+}
+
+// URLCacheStats is a snapshot of the statistics of the cache of URLs fetched
+// by a Fixer.
+type URLCacheStats struct {
+	Hits         uint64
+	Misses       uint64
+	Errors       uint64 // Fetches which failed without a response
+	BadStatus    uint64 // Fetches which returned a status other than 200 OK
+	ReadFailures uint64
+	PutFailures  uint64 // Bodies which couldn't be stored in the cache
+	Retries      uint64
+	NegativeHits uint64 // Fetches skipped because the URL was known to be dead
+	NegativePuts uint64 // Dead URLs remembered in the negative cache
+
+	Throttled    uint64        // Fetches delayed by the per-host rate limit
+	ThrottledFor time.Duration // Total time fetches were delayed for
+}
+
+// Stats returns a snapshot of the statistics of the Fixer.  It is safe to call
+// concurrently with the Fixer's other methods.
+func (f *Fixer) Stats() FixerStats {
+	s := FixerStats{
+		Workers:          f.WorkerCount(),
+		Active:           int(atomic.LoadUint32(&f.active)),
+		Queued:           atomic.LoadInt64(&f.queued),
+		Reconstructed:    atomic.LoadUint64(&f.reconstructed),
+		NotReconstructed: atomic.LoadUint64(&f.notReconstructed),
+		Fixed:            atomic.LoadUint64(&f.fixed),
+		NotFixed:         atomic.LoadUint64(&f.notFixed),
+		Skipped:          atomic.LoadUint64(&f.skipped),
+		AlreadyDone:      atomic.LoadUint64(&f.alreadyDone),
+		TimedOut:         atomic.LoadUint64(&f.timedOut),
+		Dropped:          atomic.LoadUint64(&f.dropped),
+		OutputBlocked:    time.Duration(atomic.LoadInt64(&f.blockedFor)),
+	}
+	if f.cache != nil {
+		s.Cache = f.cache.stats()
+	}
+	return s
+}
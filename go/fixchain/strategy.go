@@ -0,0 +1,150 @@
+package fixchain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// Fetcher fetches the bodies of URLs on behalf of a Strategy, through the
+// Fixer's cache and subject to its retry policy and rate limits.
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) ([]byte, error)
+}
+
+// Strategy is a way of finding certificates which are missing from a chain.
+// To fix a chain, each strategy is asked in turn for the issuers of each
+// certificate in the chain, until the chain verifies.  Implementations must
+// be safe for concurrent use.
+type Strategy interface {
+	// Name identifies the strategy in errors.
+	Name() string
+
+	// FindIssuers returns certificates which may have issued cert, using
+	// fetch for any network access.  Any issuers that are returned are
+	// used even if an error is also returned.  An error of type FixErrors
+	// is reported as is, and any other error as an IssuerLookupFailed
+	// FixError.
+	FindIssuers(ctx context.Context, cert *x509.Certificate, fetch Fetcher) ([]*x509.Certificate, error)
+}
+
+// DefaultStrategies returns the strategies used when FixerOptions.Strategies
+// is nil: fetching issuers from AIA URLs.  Other strategies can be added to
+// them, e.g. append(DefaultStrategies(), OCSPStrategy{}).
+func DefaultStrategies() []Strategy {
+	return []Strategy{AIAStrategy{}}
+}
+
+// FixErrors is an error made up of one or more FixErrors, which a Strategy
+// can return to report errors such as the failure to fetch a URL in detail.
+// The Cert and Chain of each FixError are filled in by the Fixer if nil.
+type FixErrors []*FixError
+
+func (e FixErrors) Error() string {
+	var s []string
+	for _, ferr := range e {
+		msg := ferr.TypeString()
+		if ferr.URL != "" {
+			msg += " " + ferr.URL
+		}
+		if ferr.Error != nil {
+			msg += ": " + ferr.Error.Error()
+		}
+		s = append(s, msg)
+	}
+	return strings.Join(s, "; ")
+}
+
+// strategies returns the strategies used to fix chains: the Intermediates,
+// then Strategies, or the DefaultStrategies if it is nil, followed by the
+// IssuerSources.
+func (o *FixerOptions) strategies() []Strategy {
+	strategies := o.Strategies
+	if strategies == nil {
+		strategies = DefaultStrategies()
+	}
+	if o.Intermediates == nil && len(o.IssuerSources) == 0 {
+		return strategies
+	}
+	s := make([]Strategy, 0, len(strategies)+len(o.IssuerSources)+1)
+	if o.Intermediates != nil {
+		s = append(s, IssuerSourceStrategy{o.Intermediates})
+	}
+	s = append(s, strategies...)
+	for _, src := range o.IssuerSources {
+		s = append(s, IssuerSourceStrategy{src})
+	}
+	return s
+}
+
+// strategyErrors converts an error returned by s into FixErrors.
+func (fix *toFix) strategyErrors(s Strategy, err error) []*FixError {
+	if ferrs, ok := err.(FixErrors); ok {
+		for _, ferr := range ferrs {
+			if ferr.Cert == nil {
+				ferr.Cert = fix.cert
+			}
+			if ferr.Chain == nil {
+				ferr.Chain = fix.chain
+			}
+		}
+		return ferrs
+	}
+	return []*FixError{{
+		Type:  IssuerLookupFailed,
+		Cert:  fix.cert,
+		Chain: fix.chain,
+		Error: fmt.Errorf("%s: %s", s.Name(), err),
+	}}
+}
+
+// Fetch implements Fetcher.
+func (u *urlCache) Fetch(ctx context.Context, url string) ([]byte, error) {
+	return u.getURL(ctx, url)
+}
+
+// IssuerSourceStrategy is a Strategy which finds issuers using an
+// IssuerSource, such as a LogIssuerSource.
+type IssuerSourceStrategy struct {
+	Source IssuerSource
+}
+
+// Name implements Strategy.
+func (IssuerSourceStrategy) Name() string {
+	return "IssuerSource"
+}
+
+// FindIssuers implements Strategy.
+func (s IssuerSourceStrategy) FindIssuers(ctx context.Context, cert *x509.Certificate, fetch Fetcher) ([]*x509.Certificate, error) {
+	return s.Source.FindIssuers(ctx, cert)
+}
+
+// CrossSignStrategy is a Strategy which searches an IssuerSource for
+// cross-signed versions of the certificates in a chain: certificates with the
+// same subject and public key, but a different issuer.  These can lead to a
+// root that the chain as supplied doesn't.
+type CrossSignStrategy struct {
+	Source IssuerSource
+}
+
+// Name implements Strategy.
+func (CrossSignStrategy) Name() string {
+	return "CrossSign"
+}
+
+// FindIssuers implements Strategy.
+func (s CrossSignStrategy) FindIssuers(ctx context.Context, cert *x509.Certificate, fetch Fetcher) ([]*x509.Certificate, error) {
+	// IssuerSources are searched by issuer, so look for certificates which
+	// could have issued one issued by cert.
+	probe := &x509.Certificate{RawIssuer: cert.RawSubject}
+	candidates, err := s.Source.FindIssuers(ctx, probe)
+	var crossSigned []*x509.Certificate
+	for _, c := range candidates {
+		if string(c.RawSubjectPublicKeyInfo) == string(cert.RawSubjectPublicKeyInfo) && !c.Equal(cert) {
+			crossSigned = append(crossSigned, c)
+		}
+	}
+	return crossSigned, err
+}
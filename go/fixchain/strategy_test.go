@@ -0,0 +1,74 @@
+package fixchain
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestStrategies(t *testing.T) {
+	l := NewLogIssuerSource()
+	tests := []struct {
+		opts     FixerOptions
+		expected []string
+	}{
+		{FixerOptions{}, []string{"AIA"}},
+		{FixerOptions{Strategies: []Strategy{}}, nil},
+		{FixerOptions{Strategies: []Strategy{OCSPStrategy{}, AIAStrategy{}}}, []string{"OCSP", "AIA"}},
+		{FixerOptions{IssuerSources: []IssuerSource{l}}, []string{"AIA", "IssuerSource"}},
+		{FixerOptions{Strategies: []Strategy{CrossSignStrategy{l}}, IssuerSources: []IssuerSource{l, l}}, []string{"CrossSign", "IssuerSource", "IssuerSource"}},
+		{FixerOptions{Intermediates: &IntermediateStore{}, Strategies: []Strategy{}}, []string{"IssuerSource"}},
+	}
+
+	for i, test := range tests {
+		s := test.opts.strategies()
+		if len(s) != len(test.expected) {
+			t.Errorf("#%d: strategies() returned %d strategies, expected %d", i, len(s), len(test.expected))
+			continue
+		}
+		for j, name := range test.expected {
+			if s[j].Name() != name {
+				t.Errorf("#%d: strategy %d is %s, expected %s", i, j, s[j].Name(), name)
+			}
+		}
+	}
+}
+
+func TestStrategyErrors(t *testing.T) {
+	fix := setUpFix(t, 0, &fixTest{cert: googleLeaf, chain: []string{thawteIntermediate}})
+
+	ferrs := fix.strategyErrors(AIAStrategy{}, FixErrors{{Type: CannotFetchURL, URL: "http://example.com"}})
+	if len(ferrs) != 1 || ferrs[0].Type != CannotFetchURL || ferrs[0].Cert != fix.cert || len(ferrs[0].Chain) != 1 {
+		t.Errorf("strategyErrors() didn't pass FixErrors through with the cert and chain filled in: %+v", ferrs)
+	}
+
+	ferrs = fix.strategyErrors(OCSPStrategy{}, errors.New("boom"))
+	if len(ferrs) != 1 || ferrs[0].Type != IssuerLookupFailed || ferrs[0].Error.Error() != "OCSP: boom" {
+		t.Errorf("strategyErrors() = %+v, expected an IssuerLookupFailed error naming the strategy", ferrs)
+	}
+}
+
+func TestCrossSignStrategy(t *testing.T) {
+	l := NewLogIssuerSource()
+	thawte := GetTestCertificateFromPEM(t, thawteIntermediate)
+	l.AddCert(thawte)
+	s := CrossSignStrategy{l}
+
+	// A certificate is not a cross-signed version of itself.
+	issuers, err := s.FindIssuers(context.Background(), thawte, nil)
+	if err != nil {
+		t.Fatalf("FindIssuers() returned error: %s", err)
+	}
+	if len(issuers) != 0 {
+		t.Errorf("FindIssuers() returned %d certs for Thawte, expected none", len(issuers))
+	}
+
+	issuers, err = s.FindIssuers(context.Background(), GetTestCertificateFromPEM(t, googleLeaf), nil)
+	if err != nil {
+		t.Fatalf("FindIssuers() returned error: %s", err)
+	}
+	if len(issuers) != 0 {
+		t.Errorf("FindIssuers() returned %d certs for Google, expected none", len(issuers))
+	}
+}
@@ -0,0 +1,154 @@
+package fixchain
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// SubmitterLog is a CT log to which a Submitter posts chains.
+type SubmitterLog struct {
+	// Name identifying the log in SubmittedChains and errors, e.g. its URL.
+	Name   string
+	Client *client.LogClient
+
+	// Maximum number of add-chain requests per second made to the log, in
+	// bursts of up to Burst requests.  Zero means unlimited.  Requests
+	// which the log rejects with a 503 are retried by the LogClient.
+	RateLimit float64
+	Burst     int
+}
+
+// SubmittedChain records the SCT returned by a log for a chain submitted to
+// it.
+type SubmittedChain struct {
+	Chain []*x509.Certificate
+	Log   string
+	SCT   *ct.SignedCertificateTimestamp
+}
+
+type submitterLog struct {
+	SubmitterLog
+	limiter *hostLimiter
+}
+
+// Submitter posts chains, such as those fixed by a Fixer, to a list of CT logs
+// using add-chain.
+type Submitter struct {
+	ctx    context.Context
+	logs   []*submitterLog
+	chains <-chan []*x509.Certificate
+	scts   chan<- *SubmittedChain
+	errors chan<- *FixError
+
+	// Counters are updated atomically.
+	submitted uint64
+	failed    uint64
+
+	wg sync.WaitGroup
+}
+
+// NewSubmitter creates a Submitter and starts a pool of workerCount workers
+// which post every chain read from the chains channel to each of the given
+// logs, until chains is closed or ctx is cancelled.  The SCT returned for each
+// submission is pushed to the scts channel, and submissions which fail are
+// pushed to the errors channel as LogPostFailed errors.  Either channel may be
+// nil if the caller isn't interested.
+func NewSubmitter(ctx context.Context, workerCount int, logs []SubmitterLog, chains <-chan []*x509.Certificate, scts chan<- *SubmittedChain, errors chan<- *FixError) *Submitter {
+	s := &Submitter{
+		ctx:    ctx,
+		chains: chains,
+		scts:   scts,
+		errors: errors,
+	}
+	for _, l := range logs {
+		s.logs = append(s.logs, &submitterLog{
+			SubmitterLog: l,
+			limiter:      newHostLimiter(l.RateLimit, l.Burst),
+		})
+	}
+	for i := 0; i < workerCount; i++ {
+		s.wg.Add(1)
+		go s.submitServer()
+	}
+	return s
+}
+
+// Wait for all the Submitter's workers to finish.  The chains channel must be
+// closed, or the Submitter's context cancelled, first.
+func (s *Submitter) Wait() {
+	s.wg.Wait()
+}
+
+// Stats returns the number of submissions which have succeeded and failed.
+func (s *Submitter) Stats() (submitted, failed uint64) {
+	return atomic.LoadUint64(&s.submitted), atomic.LoadUint64(&s.failed)
+}
+
+func (s *Submitter) submitServer() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case chain, ok := <-s.chains:
+			if !ok {
+				return
+			}
+			for _, l := range s.logs {
+				if s.ctx.Err() != nil {
+					return
+				}
+				s.submit(l, chain)
+			}
+		}
+	}
+}
+
+func (s *Submitter) submit(l *submitterLog, chain []*x509.Certificate) {
+	if l.limiter != nil {
+		if err := wait(s.ctx, l.limiter.reserve(l.Name, time.Now())); err != nil {
+			return
+		}
+	}
+
+	var der []ct.ASN1Cert
+	for _, c := range chain {
+		der = append(der, c.Raw)
+	}
+	sct, err := l.Client.AddChainWithContext(s.ctx, der)
+	if err != nil {
+		if s.ctx.Err() != nil {
+			return
+		}
+		atomic.AddUint64(&s.failed, 1)
+		if s.errors != nil {
+			ferr := &FixError{
+				Type:  LogPostFailed,
+				Chain: chain,
+				URL:   l.Name,
+				Error: err,
+			}
+			if len(chain) > 0 {
+				ferr.Cert = chain[0]
+			}
+			select {
+			case s.errors <- ferr:
+			case <-s.ctx.Done():
+			}
+		}
+		return
+	}
+	atomic.AddUint64(&s.submitted, 1)
+	if s.scts != nil {
+		select {
+		case s.scts <- &SubmittedChain{Chain: chain, Log: l.Name, SCT: sct}:
+		case <-s.ctx.Done():
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package fixchain
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+const testAddChainResponse = `{"sct_version":0,"id":"KHYaGJAn++880NYaAY12sFBXKcenQRvMvfYE9F1CYVM=","timestamp":1337,"extensions":"","signature":"BAMARjBEAiAIc21J5ZbdKZHw5wLxCP+MhBEsV5+nfvGyakOIv6FOvAIgWYMZb6Pw///uiNM7QTg2Of1OqmK1GbeGuEl9VJN8v8c="}`
+
+func TestSubmitter(t *testing.T) {
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != client.AddChainPath {
+			t.Errorf("Incorrect URL path: %s", r.URL.Path)
+		}
+		w.Write([]byte(testAddChainResponse))
+	}))
+	defer good.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer bad.Close()
+
+	chains := make(chan []*x509.Certificate)
+	scts := make(chan *SubmittedChain, 10)
+	errors := make(chan *FixError, 10)
+	logs := []SubmitterLog{
+		{Name: "good", Client: client.New(good.URL), RateLimit: 100, Burst: 1},
+		{Name: "bad", Client: client.New(bad.URL)},
+	}
+	s := NewSubmitter(context.Background(), 2, logs, chains, scts, errors)
+
+	chain := extractTestChain(t, 0, []string{googleLeaf, thawteIntermediate})
+	const n = 3
+	for i := 0; i < n; i++ {
+		chains <- chain
+	}
+	close(chains)
+	s.Wait()
+	close(scts)
+	close(errors)
+
+	var gotSCTs int
+	for sct := range scts {
+		gotSCTs++
+		if sct.Log != "good" {
+			t.Errorf("Got SCT from log %q, expected \"good\"", sct.Log)
+		}
+		if sct.SCT.Timestamp != 1337 {
+			t.Errorf("Got SCT with timestamp %d, expected 1337", sct.SCT.Timestamp)
+		}
+	}
+	if gotSCTs != n {
+		t.Errorf("Got %d SCTs, expected %d", gotSCTs, n)
+	}
+	var gotErrs int
+	for ferr := range errors {
+		gotErrs++
+		if ferr.Type != LogPostFailed || ferr.URL != "bad" {
+			t.Errorf("Got %s error for %q, expected LogPostFailed for \"bad\"", ferr.TypeString(), ferr.URL)
+		}
+	}
+	if gotErrs != n {
+		t.Errorf("Got %d errors, expected %d", gotErrs, n)
+	}
+	if submitted, failed := s.Stats(); submitted != n || failed != n {
+		t.Errorf("Stats() returned %d submitted and %d failed, expected %d of each", submitted, failed, n)
+	}
+}
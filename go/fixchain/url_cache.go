@@ -4,59 +4,191 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
 )
 
+// httpStatusError is returned when a URL is fetched successfully, but the
+// response has a status other than 200 OK.
+type httpStatusError struct {
+	status int
+}
+
+func (e httpStatusError) Error() string {
+	return fmt.Sprintf("can't deal with status %d", e.status)
+}
+
+// bodyReadError is returned when a response was received, but its body
+// couldn't be read, e.g. because the connection was reset or the attempt timed
+// out part way through.  Like a failure to get a response, it is a net.Error,
+// so is retried.
+type bodyReadError struct {
+	err error
+}
+
+func (e bodyReadError) Error() string {
+	return fmt.Sprintf("failed to read body: %s", e.err)
+}
+
+func (e bodyReadError) Timeout() bool {
+	if ne, ok := e.err.(net.Error); ok {
+		return ne.Timeout()
+	}
+	return e.err == context.DeadlineExceeded
+}
+
+func (e bodyReadError) Temporary() bool { return true }
+
 type urlCache struct {
-	client *http.Client
-	cache  map[string][]byte
-	// counters may not be totally accurate due to non-atomicity
-	hit       uint
-	miss      uint
-	errors    uint
-	badStatus uint
-	readFail  uint
+	// counters are updated atomically, and read with stats.  They come
+	// first so they are 64-bit aligned on 32-bit platforms.
+	hit       uint64
+	miss      uint64
+	errors    uint64
+	badStatus uint64
+	readFail  uint64
+	putFail   uint64
+	retries   uint64
+	negHit    uint64
+	negPut    uint64
+
+	client  *http.Client
+	cache   CacheBackend
+	retry   RetryPolicy
+	limiter *hostLimiter
+	audit   *auditLog
+	dead    *negativeCache
 }
 
-func (u *urlCache) getURL(url string) ([]byte, error) {
-	r, ok := u.cache[url]
+func (u *urlCache) getURL(ctx context.Context, url string) ([]byte, error) {
+	r, ok := u.cache.Get(url)
 	if ok {
-		u.hit++
+		atomic.AddUint64(&u.hit, 1)
 		return r, nil
 	}
-	c, err := u.client.Get(url)
+	if e, ok := u.dead.get(url, time.Now()); ok {
+		atomic.AddUint64(&u.negHit, 1)
+		return nil, e.err
+	}
+	var status int
+	var err error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			atomic.AddUint64(&u.retries, 1)
+			if err := wait(ctx, u.retry.backoff(attempt)); err != nil {
+				return nil, err
+			}
+		}
+		r, status, err = u.fetch(ctx, url)
+		if attempt+1 >= u.retry.attempts() || !isTransient(status, err) || ctx.Err() != nil {
+			break
+		}
+	}
 	if err != nil {
-		u.errors++
+		// Don't remember failures caused by the caller giving up.
+		if ctx.Err() == nil && u.dead.put(url, status, err, time.Now()) {
+			atomic.AddUint64(&u.negPut, 1)
+		}
 		return nil, err
 	}
+	atomic.AddUint64(&u.miss, 1)
+	if err := u.cache.Put(url, r); err != nil {
+		// Failing to cache the body doesn't stop it being used this time.
+		atomic.AddUint64(&u.putFail, 1)
+		log.Printf("cache: failed to store %s: %s", url, err)
+	}
+	return r, nil
+}
+
+// fetch makes a single attempt to get url, subject to the retry policy's
+// per-attempt timeout.  The HTTP status is returned if a response was received
+// and, if it was 200 OK, its body was read.
+// The attempt is recorded in the audit log, if there is one.
+func (u *urlCache) fetch(ctx context.Context, url string) (body []byte, status int, err error) {
+	if err := u.limiter.wait(ctx, url); err != nil {
+		return nil, 0, err
+	}
+	start := time.Now()
+	defer func() {
+		u.audit.record(ctx, url, start, status, body, err)
+	}()
+	if u.retry.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.retry.Timeout)
+		defer cancel()
+	}
+	c, err := ctxhttp.Get(ctx, u.client, url)
+	if err != nil {
+		atomic.AddUint64(&u.errors, 1)
+		return nil, 0, err
+	}
 	defer c.Body.Close()
-	// TODO(katjoyce): Add caching of permanent errors.
 	if c.StatusCode != 200 {
-		u.badStatus++
-		return nil, fmt.Errorf("can't deal with status %d", c.StatusCode)
+		atomic.AddUint64(&u.badStatus, 1)
+		return nil, c.StatusCode, httpStatusError{c.StatusCode}
 	}
-	r, err = ioutil.ReadAll(c.Body)
+	r, err := ioutil.ReadAll(c.Body)
 	if err != nil {
-		u.readFail++
-		return nil, err
+		atomic.AddUint64(&u.readFail, 1)
+		return nil, 0, bodyReadError{err}
+	}
+	return r, c.StatusCode, nil
+}
+
+// stats returns a snapshot of the statistics of the cache.
+func (u *urlCache) stats() URLCacheStats {
+	throttled, waited := u.limiter.stats()
+	return URLCacheStats{
+		Hits:         atomic.LoadUint64(&u.hit),
+		Misses:       atomic.LoadUint64(&u.miss),
+		Errors:       atomic.LoadUint64(&u.errors),
+		BadStatus:    atomic.LoadUint64(&u.badStatus),
+		ReadFailures: atomic.LoadUint64(&u.readFail),
+		PutFailures:  atomic.LoadUint64(&u.putFail),
+		Retries:      atomic.LoadUint64(&u.retries),
+		NegativeHits: atomic.LoadUint64(&u.negHit),
+		NegativePuts: atomic.LoadUint64(&u.negPut),
+		Throttled:    throttled,
+		ThrottledFor: waited,
 	}
-	u.miss++
-	u.cache[url] = r
-	return r, nil
 }
 
-func newURLCache(c *http.Client, logStats bool) *urlCache {
-	u := &urlCache{cache: make(map[string][]byte), client: c}
+// newURLCache returns a urlCache which fetches URLs using c, or a client built
+// from opts.HTTP if c is nil, taking the rest of its configuration from opts.
+func newURLCache(c *http.Client, opts *FixerOptions) *urlCache {
+	if c == nil && opts.HTTP != nil {
+		c = opts.HTTP.NewClient()
+	}
+	cache := opts.Cache
+	if cache == nil {
+		cache = newMemoryCache()
+	}
+	u := &urlCache{
+		cache:   cache,
+		client:  c,
+		retry:   opts.Retry,
+		limiter: newHostLimiter(opts.HostRateLimit, opts.HostBurst),
+		audit:   newAuditLog(opts.AuditLog),
+		dead:    newNegativeCache(opts.NegativeCacheTTL),
+	}
 
-	if logStats {
+	if opts.LogStats {
 		t := time.NewTicker(time.Second)
 		go func() {
 			for _ = range t.C {
-				log.Printf("cache: %d hits, %d misses, %d errors, "+
-					"%d bad status, %d read fail, %d cached", u.hit,
-					u.miss, u.errors, u.badStatus, u.readFail,
-					len(u.cache))
+				s := u.stats()
+				log.Printf("cache: %d hits, %d misses, %d negative hits, "+
+					"%d errors, %d bad status, %d read fail, "+
+					"%d put fail, %d negative put, %d retries, "+
+					"%d throttled for %s", s.Hits, s.Misses,
+					s.NegativeHits, s.Errors, s.BadStatus,
+					s.ReadFailures, s.PutFailures, s.NegativePuts,
+					s.Retries, s.Throttled, s.ThrottledFor)
 			}
 		}()
 	}
@@ -0,0 +1,77 @@
+package gossip
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	ct "github.com/google/certificate-transparency/go"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// PollinationClient exchanges STHs with a gossip point's sth-pollination
+// endpoint, as an HTTPS client does with the servers it visits, so that STHs
+// spread between the clients of a log and the views of it they were given can
+// be compared.
+type PollinationClient struct {
+	uri        string
+	httpClient *http.Client
+	verifiers  SignatureVerifierMap
+	clock      clock
+}
+
+// NewPollinationClient returns a PollinationClient for the gossip point at
+// uri, e.g. "https://example.com", which makes requests with hc, or
+// http.DefaultClient if it is nil.  STHs the gossip point returns are checked
+// against verifiers, the logs the client knows.
+func NewPollinationClient(uri string, hc *http.Client, verifiers SignatureVerifierMap) *PollinationClient {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &PollinationClient{
+		uri:        strings.TrimSuffix(uri, "/"),
+		httpClient: hc,
+		verifiers:  verifiers,
+		clock:      realClock{},
+	}
+}
+
+// Pollinate sends sths to the gossip point and returns the STHs it sends back
+// which are fresh, from known logs and validly signed.  The others are
+// dropped, as the gossip point would drop them.
+func (c *PollinationClient) Pollinate(ctx context.Context, sths []ct.SignedTreeHead) ([]ct.SignedTreeHead, error) {
+	if sths == nil {
+		// The gossip point needs an array, even if it is empty.
+		sths = []ct.SignedTreeHead{}
+	}
+	body, err := json.Marshal(STHPollination{STHs: sths})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", c.uri+STHPollinationPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := ctxhttp.Do(ctx, c.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got HTTP status %q from %s: %s", resp.Status, c.uri, respBody)
+	}
+	var p STHPollination
+	if err := json.Unmarshal(respBody, &p); err != nil {
+		return nil, fmt.Errorf("invalid STH pollination received from %s: %v", c.uri, err)
+	}
+	return c.verifiers.validPollen(p.STHs, c.clock.Now()), nil
+}
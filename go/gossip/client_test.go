@@ -0,0 +1,104 @@
+package gossip
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func newTestGossipPoint(t *testing.T, s Store, clockMillis int64) *httptest.Server {
+	h := newHandlerWithClock(s, mustCreateSignatureVerifiers(t), testStuckClock(clockMillis))
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc(SCTFeedbackPath, h.HandleSCTFeedback)
+	serveMux.HandleFunc(STHPollinationPath, h.HandleSTHPollination)
+	return httptest.NewServer(serveMux)
+}
+
+func newTestPollinationClient(t *testing.T, uri string) *PollinationClient {
+	c := NewPollinationClient(uri, nil, mustCreateSignatureVerifiers(t))
+	c.clock = testStuckClock(stuckClockTimeMillis)
+	return c
+}
+
+func TestPollinate(t *testing.T) {
+	s := NewMemoryStore()
+	ts := newTestGossipPoint(t, s, stuckClockTimeMillis)
+	defer ts.Close()
+	c := newTestPollinationClient(t, ts.URL)
+
+	// A new gossip point has no pollen to return.
+	got, err := c.Pollinate(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Pollinate(nil)=_,%v", err)
+	}
+	assert.Equal(t, 0, len(got))
+
+	sent := sthPollinationFromString(t, addSTHPollinationJSON)
+	// Duplicates are only stored once.
+	sths := append(sent.STHs, sent.STHs[0])
+	got, err = c.Pollinate(context.Background(), sths)
+	if err != nil {
+		t.Fatalf("Pollinate()=_,%v", err)
+	}
+	assert.Equal(t, len(sent.STHs), s.NumSTHs())
+	assert.Equal(t, len(sent.STHs), len(got))
+	for _, sth := range sent.STHs {
+		assert.Contains(t, got, sth)
+	}
+
+	for _, pollen := range []string{addSTHPollinationUnknownLogIDJSON, addSTHPollinationInvalidSignatureJSON} {
+		if _, err := c.Pollinate(context.Background(), sthPollinationFromString(t, pollen).STHs); err != nil {
+			t.Errorf("Pollinate()=_,%v", err)
+		}
+	}
+	assert.Equal(t, len(sent.STHs), s.NumSTHs())
+}
+
+func TestHandlerDropsStalePollen(t *testing.T) {
+	s := NewMemoryStore()
+	ts := newTestGossipPoint(t, s, stuckClockTimeFutureMillis)
+	defer ts.Close()
+	c := newTestPollinationClient(t, ts.URL)
+
+	if _, err := c.Pollinate(context.Background(), sthPollinationFromString(t, addSTHPollinationJSON).STHs); err != nil {
+		t.Fatalf("Pollinate()=_,%v", err)
+	}
+	assert.Equal(t, 0, s.NumSTHs())
+}
+
+func TestPollinateChecksReturnedPollen(t *testing.T) {
+	for i, test := range []struct {
+		status  int
+		body    string
+		want    int
+		wantErr bool
+	}{
+		{status: http.StatusOK, body: addSTHPollinationJSON, want: 3},
+		{status: http.StatusOK, body: addSTHPollinationUnknownLogIDJSON},
+		{status: http.StatusOK, body: addSTHPollinationInvalidSignatureJSON},
+		{status: http.StatusOK, body: "blahblah,,}{", wantErr: true},
+		{status: http.StatusInternalServerError, body: "{}", wantErr: true},
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != STHPollinationPath {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, test.body)
+		}))
+		got, err := newTestPollinationClient(t, ts.URL).Pollinate(context.Background(), nil)
+		ts.Close()
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("#%d: Pollinate()=_,%v, want error %v", i, err, test.wantErr)
+			continue
+		}
+		if len(got) != test.want {
+			t.Errorf("#%d: Pollinate() returned %d STHs, want %d", i, len(got), test.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package gossip
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// HandlerOptions holds the optional settings of a Handler.
+type HandlerOptions struct {
+	// If set, SCT feedback is validated (gossip draft section 7.1.1):
+	// each chain must parse and each certificate in it be signed by the
+	// next, and SCTs must be from known logs and sign the chain's leaf,
+	// or, for SCTs embedded in it, its precertificate.  Chains which fail
+	// are dropped, as are SCTs which fail along with them.
+	ValidateSCTFeedback bool
+	// If non-nil, validated chains must also verify up to one of Roots.
+	Roots *x509.CertPool
+	// If non-empty, validated chains must be for a leaf certificate with
+	// a DNS name which is one of Domains or a subdomain of one; feedback
+	// for other sites is dropped.
+	Domains []string
+}
+
+// parseChain decodes and parses the base64 DER certificates of chain, and
+// checks that each is signed by the next.
+func parseChain(chain []string) ([]*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("empty chain")
+	}
+	var certs []*x509.Certificate
+	for i, b64 := range chain {
+		der, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 for certificate %d: %v", i, err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if x509.IsFatal(err) {
+			return nil, fmt.Errorf("failed to parse certificate %d: %v", i, err)
+		}
+		if i > 0 {
+			if err := certs[i-1].CheckSignatureFrom(cert); err != nil {
+				return nil, fmt.Errorf("certificate %d isn't signed by the next: %v", i-1, err)
+			}
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// inDomains reports whether name is one of domains, or a subdomain of one.
+func inDomains(name string, domains []string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSuffix(d, "."))
+		if name == d || strings.HasSuffix(name, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkChain checks that the chain certs is acceptable under opts.
+func (opts *HandlerOptions) checkChain(certs []*x509.Certificate) error {
+	leaf := certs[0]
+	if opts.Roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         opts.Roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return fmt.Errorf("chain doesn't verify to a trusted root: %v", err)
+		}
+	}
+	if len(opts.Domains) > 0 {
+		names := leaf.DNSNames
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = []string{leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			if inDomains(name, opts.Domains) {
+				return nil
+			}
+		}
+		return fmt.Errorf("certificate for %v isn't for one of our domains", names)
+	}
+	return nil
+}
+
+// verifySCT checks that the base64 TLS encoded SCT b64 is from a known log
+// and signs the leaf of certs, either as a certificate or, if it was
+// embedded, as the precertificate it was issued from.
+func (m SignatureVerifierMap) verifySCT(b64 string, certs []*x509.Certificate) error {
+	b, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return fmt.Errorf("invalid base64 for SCT: %v", err)
+	}
+	sct, err := ct.DeserializeSCT(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("failed to parse SCT: %v", err)
+	}
+	v, found := m[sct.LogID]
+	if !found {
+		return fmt.Errorf("SCT from unknown logID: %s", sct.LogID.Base64String())
+	}
+	entry := ct.LogEntry{
+		Leaf: ct.MerkleTreeLeaf{
+			Version:  ct.V1,
+			LeafType: ct.TimestampedEntryLeafType,
+			TimestampedEntry: ct.TimestampedEntry{
+				Timestamp:  sct.Timestamp,
+				EntryType:  ct.X509LogEntryType,
+				X509Entry:  certs[0].Raw,
+				Extensions: sct.Extensions,
+			},
+		},
+	}
+	err = v.VerifySCTSignature(*sct, entry)
+	if err == nil || len(certs) < 2 {
+		return err
+	}
+	tbs, tbsErr := x509.BuildPrecertTBS(certs[0].RawTBSCertificate)
+	if tbsErr != nil {
+		return err
+	}
+	te := &entry.Leaf.TimestampedEntry
+	te.EntryType = ct.PrecertLogEntryType
+	te.X509Entry = nil
+	te.PrecertEntry = ct.PreCert{
+		IssuerKeyHash:  sha256.Sum256(certs[1].RawSubjectPublicKeyInfo),
+		TBSCertificate: tbs,
+	}
+	return v.VerifySCTSignature(*sct, entry)
+}
+
+// validFeedback returns the entries of feedback whose chains are acceptable,
+// with only their SCTs which verify, dropping entries left with none.
+func (h *Handler) validFeedback(feedback SCTFeedback) SCTFeedback {
+	var valid SCTFeedback
+	for _, f := range feedback.Feedback {
+		certs, err := parseChain(f.X509Chain)
+		if err == nil {
+			err = h.opts.checkChain(certs)
+		}
+		if err != nil {
+			log.Printf("Dropping SCT feedback: %v", err)
+			continue
+		}
+		entry := SCTFeedbackEntry{X509Chain: f.X509Chain}
+		for _, sct := range f.SCTData {
+			if err := h.verifiers.verifySCT(sct, certs); err != nil {
+				log.Printf("Dropping SCT from feedback: %v", err)
+				continue
+			}
+			entry.SCTData = append(entry.SCTData, sct)
+		}
+		if len(entry.SCTData) > 0 {
+			valid.Feedback = append(valid.Feedback, entry)
+		}
+	}
+	return valid
+}
@@ -0,0 +1,151 @@
+package gossip
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/testlog"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// feedbackChain is a chain, and the SCTs a log issued for it, as base64 for
+// SCT feedback.
+type feedbackChain struct {
+	root       *x509.Certificate
+	chain      []string
+	sct        string // For the certificate.
+	precertSCT string // For the precertificate it was issued from.
+}
+
+// newFeedbackChain returns a chain for a certificate for dnsName, with SCTs
+// from l.
+func newFeedbackChain(t *testing.T, l *testlog.Log, dnsName string) feedbackChain {
+	ca := testcert.NewCA(t, "Test Root", nil)
+	root := ca.Cert
+	tmpl := testcert.LeafTemplate(dnsName)
+	key := testcert.NewKey(t)
+	cert := testcert.Issue(t, tmpl, key, ca).Raw
+	precert, err := client.CreatePrecertificate(rand.Reader, tmpl, root, &key.PublicKey, ca.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct, err := l.AddChain([]ct.ASN1Cert{cert, root.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	precertSCT, err := l.AddPreChain([]ct.ASN1Cert{precert, root.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feedbackChain{
+		root:       root,
+		chain:      []string{base64.StdEncoding.EncodeToString(cert), base64.StdEncoding.EncodeToString(root.Raw)},
+		sct:        encodeSCT(t, sct),
+		precertSCT: encodeSCT(t, precertSCT),
+	}
+}
+
+func encodeSCT(t *testing.T, sct *ct.SignedCertificateTimestamp) string {
+	b, err := ct.SerializeSCT(*sct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestValidateSCTFeedback(t *testing.T) {
+	l, err := testlog.New(testlog.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := testlog.New(testlog.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := ct.NewSignatureVerifier(l.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiers := SignatureVerifierMap{l.LogID(): *verifier}
+	ours := newFeedbackChain(t, l, "www.example.com")
+	theirs := newFeedbackChain(t, l, "www.example.org")
+	unknownLog := newFeedbackChain(t, other, "mail.example.com")
+	roots := x509.NewCertPool()
+	roots.AddCert(ours.root)
+	roots.AddCert(unknownLog.root)
+
+	for i, test := range []struct {
+		opts     HandlerOptions
+		feedback []SCTFeedbackEntry
+		want     int
+	}{
+		// Without validation, anything is stored.
+		{HandlerOptions{}, []SCTFeedbackEntry{{X509Chain: []string{"CHAIN00"}, SCTData: []string{"SCT00"}}}, 1},
+		{HandlerOptions{ValidateSCTFeedback: true}, []SCTFeedbackEntry{{X509Chain: []string{"CHAIN00"}, SCTData: []string{"SCT00"}}}, 0},
+		{HandlerOptions{ValidateSCTFeedback: true}, []SCTFeedbackEntry{{X509Chain: ours.chain, SCTData: []string{ours.sct, ours.precertSCT}}}, 2},
+		// Only the SCTs which are for the chain are kept.
+		{HandlerOptions{ValidateSCTFeedback: true}, []SCTFeedbackEntry{{X509Chain: ours.chain, SCTData: []string{ours.sct, theirs.sct, "SCT00"}}}, 1},
+		{HandlerOptions{ValidateSCTFeedback: true}, []SCTFeedbackEntry{{X509Chain: unknownLog.chain, SCTData: []string{unknownLog.sct}}}, 0},
+		// A chain whose certificates aren't signed by the next.
+		{HandlerOptions{ValidateSCTFeedback: true}, []SCTFeedbackEntry{{X509Chain: []string{ours.chain[0], theirs.chain[1]}, SCTData: []string{ours.sct}}}, 0},
+		{HandlerOptions{ValidateSCTFeedback: true, Roots: roots}, []SCTFeedbackEntry{
+			{X509Chain: ours.chain, SCTData: []string{ours.sct}},
+			{X509Chain: theirs.chain, SCTData: []string{theirs.sct}},
+		}, 1},
+		{HandlerOptions{ValidateSCTFeedback: true, Domains: []string{"example.com"}}, []SCTFeedbackEntry{
+			{X509Chain: ours.chain, SCTData: []string{ours.sct}},
+			{X509Chain: theirs.chain, SCTData: []string{theirs.sct}},
+		}, 1},
+		{HandlerOptions{ValidateSCTFeedback: true, Domains: []string{"www.example.org"}}, []SCTFeedbackEntry{
+			{X509Chain: ours.chain, SCTData: []string{ours.sct}},
+			{X509Chain: theirs.chain, SCTData: []string{theirs.sct}},
+		}, 1},
+	} {
+		s := NewMemoryStore()
+		h := NewHandlerWithOptions(s, verifiers, test.opts)
+		body, err := json.Marshal(SCTFeedback{Feedback: test.feedback})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", SCTFeedbackPath, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.HandleSCTFeedback(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("#%d: HandleSCTFeedback() returned status %d, want %d", i, rr.Code, http.StatusOK)
+		}
+		if got := s.NumSCTFeedback(); got != test.want {
+			t.Errorf("#%d: HandleSCTFeedback() stored %d pieces of feedback, want %d", i, got, test.want)
+		}
+	}
+}
+
+func TestInDomains(t *testing.T) {
+	domains := []string{"example.com", "Example.NET."}
+	for _, test := range []struct {
+		name string
+		want bool
+	}{
+		{"example.com", true},
+		{"www.example.com", true},
+		{"WWW.EXAMPLE.COM.", true},
+		{"www.example.net", true},
+		{"badexample.com", false},
+		{"example.com.evil.org", false},
+		{"com", false},
+	} {
+		if got := inDomains(test.name, domains); got != test.want {
+			t.Errorf("inDomains(%q)=%v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -27,11 +27,55 @@ func (realClock) Now() time.Time {
 // SignatureVerifierMap is a map of SignatureVerifier by LogID
 type SignatureVerifierMap map[ct.SHA256Hash]ct.SignatureVerifier
 
+// Paths of the gossip endpoints (RFC6962-bis gossip draft, section 7).
+const (
+	SCTFeedbackPath    = "/.well-known/ct/v1/sct-feedback"
+	STHPollinationPath = "/.well-known/ct/v1/sth-pollination"
+)
+
+// How old, or how far in the future, a pollinated STH can be.  STHs older
+// than maxPollenAge aren't "fresh" in the gossip draft's terms, so are
+// neither kept nor passed on.
+const (
+	maxPollenAge  = 14 * 24 * time.Hour
+	maxPollenSkew = time.Hour
+)
+
 // Handler for the gossip HTTP requests.
 type Handler struct {
-	storage   *Storage
+	storage   Store
 	verifiers SignatureVerifierMap
 	clock     clock
+	opts      HandlerOptions
+}
+
+// validPollen returns the STHs of sths which are fresh at now, from known
+// logs and validly signed, without duplicates.
+func (m SignatureVerifierMap) validPollen(sths []ct.SignedTreeHead, now time.Time) []ct.SignedTreeHead {
+	oldest := uint64(now.Add(-maxPollenAge).UnixNano() / int64(time.Millisecond))
+	newest := uint64(now.Add(maxPollenSkew).UnixNano() / int64(time.Millisecond))
+	seen := make(map[sthKey]bool)
+	valid := make([]ct.SignedTreeHead, 0, len(sths))
+	for _, sth := range sths {
+		if sth.Timestamp < oldest || sth.Timestamp > newest {
+			log.Printf("Pollination entry with timestamp %d isn't fresh, dropping", sth.Timestamp)
+			continue
+		}
+		v, found := m[sth.LogID]
+		if !found {
+			log.Printf("Pollination entry for unknown logID: %s", sth.LogID.Base64String())
+			continue
+		}
+		if err := v.VerifySTHSignature(sth); err != nil {
+			log.Printf("Failed to verify STH, dropping: %v", err)
+			continue
+		}
+		if key := keyOf(sth); !seen[key] {
+			seen[key] = true
+			valid = append(valid, sth)
+		}
+	}
+	return valid
 }
 
 func writeWrongMethodResponse(rw *http.ResponseWriter, allowed string) {
@@ -45,7 +89,8 @@ func writeErrorResponse(rw *http.ResponseWriter, status int, body string) {
 }
 
 // HandleSCTFeedback handles requests POSTed to .../sct-feedback.
-// It attempts to store the provided SCT Feedback
+// It attempts to store the provided SCT Feedback, validating it first if the
+// Handler was created with ValidateSCTFeedback set.
 func (h *Handler) HandleSCTFeedback(rw http.ResponseWriter, req *http.Request) {
 	if req.Method != "POST" {
 		writeWrongMethodResponse(&rw, "POST")
@@ -59,9 +104,9 @@ func (h *Handler) HandleSCTFeedback(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// TODO(alcutter): 5.1.1 Validate leaf chains up to a trusted root
-	// TODO(alcutter): 5.1.1/2 Verify each SCT is valid and from a known log, discard those which aren't
-	// TODO(alcutter): 5.1.1/3 Discard leaves for domains other than ours.
+	if h.opts.ValidateSCTFeedback {
+		feedback = h.validFeedback(feedback)
+	}
 	if err := h.storage.AddSCTFeedback(feedback); err != nil {
 		writeErrorResponse(&rw, http.StatusInternalServerError, fmt.Sprintf("Unable to store feedback: %v", err))
 		return
@@ -85,20 +130,7 @@ func (h *Handler) HandleSTHPollination(rw http.ResponseWriter, req *http.Request
 		return
 	}
 
-	sthToKeep := make([]ct.SignedTreeHead, 0, len(p.STHs))
-	for _, sth := range p.STHs {
-		v, found := h.verifiers[sth.LogID]
-		if !found {
-			log.Printf("Pollination entry for unknown logID: %s", sth.LogID.Base64String())
-			continue
-		}
-		if err := v.VerifySTHSignature(sth); err != nil {
-			log.Printf("Failed to verify STH, dropping: %v", err)
-			continue
-		}
-		sthToKeep = append(sthToKeep, sth)
-	}
-	p.STHs = sthToKeep
+	p.STHs = h.verifiers.validPollen(p.STHs, h.clock.Now())
 
 	err := h.storage.AddSTHPollination(p)
 	if err != nil {
@@ -106,7 +138,7 @@ func (h *Handler) HandleSTHPollination(rw http.ResponseWriter, req *http.Request
 		return
 	}
 
-	freshTime := h.clock.Now().AddDate(0, 0, -14)
+	freshTime := h.clock.Now().Add(-maxPollenAge)
 	rp, err := h.storage.GetRandomSTHPollination(freshTime, *defaultNumPollinationsToReturn)
 	if err != nil {
 		writeErrorResponse(&rw, http.StatusInternalServerError, fmt.Sprintf("Couldn't fetch pollination to return: %v", err))
@@ -120,21 +152,28 @@ func (h *Handler) HandleSTHPollination(rw http.ResponseWriter, req *http.Request
 	}
 }
 
-// NewHandler creates a new Handler object, taking a pointer a Storage object to
-// use for storing and retrieving feedback and pollination data, and a
-// SignatureVerifierMap for verifying signatures from known logs.
-func NewHandler(s *Storage, v SignatureVerifierMap) Handler {
+// NewHandler creates a new Handler object, taking a Store to use for storing
+// and retrieving feedback and pollination data, and a SignatureVerifierMap for
+// verifying signatures from known logs.
+func NewHandler(s Store, v SignatureVerifierMap) Handler {
+	return NewHandlerWithOptions(s, v, HandlerOptions{})
+}
+
+// NewHandlerWithOptions is like NewHandler, but with the optional settings
+// opts.
+func NewHandlerWithOptions(s Store, v SignatureVerifierMap, opts HandlerOptions) Handler {
 	return Handler{
 		storage:   s,
 		verifiers: v,
 		clock:     realClock{},
+		opts:      opts,
 	}
 }
 
 // NewHandler creates a new Handler object, taking a pointer a Storage object to
 // use for storing and retrieving feedback and pollination data, and a
 // SignatureVerifierMap for verifying signatures from known logs.
-func newHandlerWithClock(s *Storage, v SignatureVerifierMap, c clock) Handler {
+func newHandlerWithClock(s Store, v SignatureVerifierMap, c clock) Handler {
 	return Handler{
 		storage:   s,
 		verifiers: v,
@@ -11,11 +11,15 @@ import (
 
 	ct "github.com/google/certificate-transparency/go"
 	"github.com/google/certificate-transparency/go/gossip"
+	"github.com/google/certificate-transparency/go/x509"
 )
 
 var dbPath = flag.String("database", "/tmp/gossip.sq3", "Path to database.")
 var listenAddress = flag.String("listen", ":8080", "Listen address:port for HTTP server.")
 var logKeys = flag.String("log_public_keys", "", "Comma separated list of files containing trusted Logs' public keys in PEM format")
+var validateFeedback = flag.Bool("validate_sct_feedback", false, "Drop SCT feedback whose chains don't parse or whose SCTs aren't valid ones from trusted Logs")
+var rootsPath = flag.String("roots", "", "File containing the PEM certificates of roots SCT feedback chains must verify to, if --validate_sct_feedback is set")
+var domains = flag.String("domains", "", "Comma separated list of domains to accept SCT feedback for, if --validate_sct_feedback is set")
 
 func createVerifiers() (*gossip.SignatureVerifierMap, error) {
 	m := make(gossip.SignatureVerifierMap)
@@ -45,12 +49,34 @@ func createVerifiers() (*gossip.SignatureVerifierMap, error) {
 	return &m, nil
 }
 
+func handlerOptions() (gossip.HandlerOptions, error) {
+	opts := gossip.HandlerOptions{ValidateSCTFeedback: *validateFeedback}
+	if len(*rootsPath) > 0 {
+		pem, err := ioutil.ReadFile(*rootsPath)
+		if err != nil {
+			return opts, fmt.Errorf("failed to read roots file %s: %v", *rootsPath, err)
+		}
+		opts.Roots = x509.NewCertPool()
+		if !opts.Roots.AppendCertsFromPEM(pem) {
+			return opts, fmt.Errorf("no certificates found in roots file %s", *rootsPath)
+		}
+	}
+	if len(*domains) > 0 {
+		opts.Domains = strings.Split(*domains, ",")
+	}
+	return opts, nil
+}
+
 func main() {
 	flag.Parse()
 	verifierMap, err := createVerifiers()
 	if err != nil {
 		log.Fatalf("Failed to load log public keys: %v", err)
 	}
+	opts, err := handlerOptions()
+	if err != nil {
+		log.Fatalf("Invalid SCT feedback options: %v", err)
+	}
 	log.Print("Starting gossip server.")
 
 	storage := gossip.Storage{}
@@ -59,10 +85,10 @@ func main() {
 	}
 	defer storage.Close()
 
-	handler := gossip.NewHandler(&storage, *verifierMap)
+	handler := gossip.NewHandlerWithOptions(&storage, *verifierMap, opts)
 	serveMux := http.NewServeMux()
-	serveMux.HandleFunc("/.well-known/ct/v1/sct-feedback", handler.HandleSCTFeedback)
-	serveMux.HandleFunc("/.well-known/ct/v1/sth-pollination", handler.HandleSTHPollination)
+	serveMux.HandleFunc(gossip.SCTFeedbackPath, handler.HandleSCTFeedback)
+	serveMux.HandleFunc(gossip.STHPollinationPath, handler.HandleSTHPollination)
 	server := &http.Server{
 		Addr:    *listenAddress,
 		Handler: serveMux,
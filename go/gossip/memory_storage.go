@@ -0,0 +1,110 @@
+package gossip
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	ct "github.com/google/certificate-transparency/go"
+)
+
+// Store persists the gossip a Handler receives.  Storage is an SQLite3-backed
+// Store, and MemoryStore one which keeps it in memory.
+type Store interface {
+	// AddSCTFeedback stores the passed in feedback, ignoring entries
+	// already stored.
+	AddSCTFeedback(feedback SCTFeedback) error
+	// AddSTHPollination stores the passed in pollination, ignoring STHs
+	// already stored.
+	AddSTHPollination(pollination STHPollination) error
+	// GetRandomSTHPollination returns up to limit STHs, chosen at
+	// random, from those stored whose timestamps aren't before newerThan.
+	GetRandomSTHPollination(newerThan time.Time, limit int) (*STHPollination, error)
+}
+
+// sthKey identifies an STH, as the primary key of Storage's sths table does.
+type sthKey struct {
+	version   ct.Version
+	treeSize  uint64
+	timestamp uint64
+	root      ct.SHA256Hash
+	logID     ct.SHA256Hash
+}
+
+func keyOf(sth ct.SignedTreeHead) sthKey {
+	return sthKey{sth.Version, sth.TreeSize, sth.Timestamp, sth.SHA256RootHash, sth.LogID}
+}
+
+// MemoryStore is a Store which keeps gossip in memory, e.g. for tests or
+// short-lived gossip points.  It is safe for concurrent use.
+type MemoryStore struct {
+	mu       sync.Mutex
+	feedback map[string]bool // by chain and SCT
+	keys     map[sthKey]bool
+	sths     []ct.SignedTreeHead
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{feedback: make(map[string]bool), keys: make(map[sthKey]bool)}
+}
+
+// AddSCTFeedback stores the passed in feedback object.
+func (s *MemoryStore) AddSCTFeedback(feedback SCTFeedback) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range feedback.Feedback {
+		chain := strings.Join(f.X509Chain, "")
+		for _, sct := range f.SCTData {
+			s.feedback[chain+"\x00"+sct] = true
+		}
+	}
+	return nil
+}
+
+// AddSTHPollination stores the passed in pollination object.
+func (s *MemoryStore) AddSTHPollination(pollination STHPollination) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sth := range pollination.STHs {
+		if key := keyOf(sth); !s.keys[key] {
+			s.keys[key] = true
+			s.sths = append(s.sths, sth)
+		}
+	}
+	return nil
+}
+
+// GetRandomSTHPollination returns a random selection of the STHs stored whose
+// timestamps aren't before newerThan.
+func (s *MemoryStore) GetRandomSTHPollination(newerThan time.Time, limit int) (*STHPollination, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldest := uint64(newerThan.Unix() * 1000)
+	pollination := STHPollination{STHs: make([]ct.SignedTreeHead, 0)}
+	for _, i := range rand.Perm(len(s.sths)) {
+		if len(pollination.STHs) >= limit {
+			break
+		}
+		if s.sths[i].Timestamp >= oldest {
+			pollination.STHs = append(pollination.STHs, s.sths[i])
+		}
+	}
+	return &pollination, nil
+}
+
+// NumSTHs returns the number of STHs stored.
+func (s *MemoryStore) NumSTHs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sths)
+}
+
+// NumSCTFeedback returns the number of pieces of SCT feedback, each an SCT
+// for a chain, stored.
+func (s *MemoryStore) NumSCTFeedback() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.feedback)
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/storage"
 	"github.com/mattn/go-sqlite3"
 )
 
@@ -40,6 +41,12 @@ const schema = `
 
         );`
 
+// migrations are the gossip schema's, in order.  The first, schema, predates
+// the schema being versioned, so only creates the tables which don't exist.
+var migrations = []storage.Migration{
+	{Description: "Create the STH, SCT, chain and SCT feedback tables", SQL: schema},
+}
+
 const insertChain = `INSERT INTO chains(chain) VALUES ($1);`
 const insertSCT = `INSERT INTO scts(sct) VALUES ($1);`
 const insertSCTFeedback = `INSERT INTO sct_feedback(chain_id, sct_id) VALUES ($1, $2);`
@@ -110,7 +117,7 @@ func (s *Storage) Open(dbPath string) error {
 	if err != nil {
 		return err
 	}
-	if _, err := s.db.Exec(schema); err != nil {
+	if err := storage.Migrate(s.db, "gossip", migrations); err != nil {
 		return err
 	}
 	for _, p := range []statementSQLPair{
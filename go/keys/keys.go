@@ -0,0 +1,148 @@
+// Package keys loads the public keys of logs, from files or log lists, and
+// the private keys logs sign with, from files or hardware security modules.
+package keys
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/loglist"
+)
+
+// ParsePublicKey parses a public key encoded as a PEM PUBLIC KEY block, or as
+// a DER SubjectPublicKeyInfo, either raw or base64 encoded as in log lists.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	der, err := publicKeyDER(data)
+	if err != nil {
+		return nil, err
+	}
+	return ct.PublicKeyFromDER(der)
+}
+
+// publicKeyDER returns the DER SubjectPublicKeyInfo in data, encoded as for
+// ParsePublicKey.
+func publicKeyDER(data []byte) ([]byte, error) {
+	// DER SubjectPublicKeyInfos start with a SEQUENCE tag, 0x30, whereas
+	// base64 encoded ones start with M, and PEM with dashes.
+	if len(data) > 0 && data[0] == 0x30 {
+		return data, nil
+	}
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("-----BEGIN")) {
+		block, _ := pem.Decode(trimmed)
+		if block == nil {
+			return nil, errors.New("keys: failed to decode PEM")
+		}
+		if block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("keys: PEM block is %s, not PUBLIC KEY", block.Type)
+		}
+		return block.Bytes, nil
+	}
+	der, err := base64.StdEncoding.DecodeString(string(trimmed))
+	if err != nil {
+		return nil, fmt.Errorf("keys: public key is neither PEM, DER nor base64: %v", err)
+	}
+	return der, nil
+}
+
+// LoadPublicKey reads a public key from the file at path, encoded as for
+// ParsePublicKey.
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := ParsePublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return pk, nil
+}
+
+// Set is a set of log public keys, indexed by their key IDs, each with the
+// ct.LogVerifier made from it.  Keys are only parsed once, however many times
+// they are added.  A Set is safe for concurrent use.
+type Set struct {
+	mu   sync.RWMutex
+	byID map[ct.SHA256Hash]*ct.LogVerifier
+}
+
+// NewSet returns an empty Set.
+func NewSet() *Set {
+	return &Set{byID: make(map[ct.SHA256Hash]*ct.LogVerifier)}
+}
+
+// Add adds the public key pk to the set, if it isn't already in it, and
+// returns its verifier.
+func (s *Set) Add(pk crypto.PublicKey) (*ct.LogVerifier, error) {
+	id, err := ct.KeyID(pk)
+	if err != nil {
+		return nil, err
+	}
+	if v := s.Get(id); v != nil {
+		return v, nil
+	}
+	v, err := ct.NewLogVerifier(pk)
+	if err != nil {
+		return nil, err
+	}
+	return s.put(v), nil
+}
+
+// AddDER adds the public key in the DER SubjectPublicKeyInfo der to the set,
+// if it isn't already in it, and returns its verifier.
+func (s *Set) AddDER(der []byte) (*ct.LogVerifier, error) {
+	if v := s.Get(sha256.Sum256(der)); v != nil {
+		return v, nil
+	}
+	v, err := ct.NewLogVerifierFromDER(der)
+	if err != nil {
+		return nil, err
+	}
+	return s.put(v), nil
+}
+
+// AddLogList adds the keys of all the logs in ll to the set.
+func (s *Set) AddLogList(ll *loglist.LogList) error {
+	for _, l := range ll.Logs() {
+		if _, err := s.AddDER(l.Key); err != nil {
+			return fmt.Errorf("log %q: %v", l.Description, err)
+		}
+	}
+	return nil
+}
+
+// put adds v to the set, unless another goroutine has added its key since
+// it was looked up, and returns the verifier in the set.
+func (s *Set) put(v *ct.LogVerifier) *ct.LogVerifier {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing := s.byID[v.KeyID()]; existing != nil {
+		return existing
+	}
+	s.byID[v.KeyID()] = v
+	return v
+}
+
+// Get returns the verifier for the key with ID id, or nil if it isn't in the
+// set.
+func (s *Set) Get(id ct.SHA256Hash) *ct.LogVerifier {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.byID[id]
+}
+
+// Len returns the number of keys in the set.
+func (s *Set) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.byID)
+}
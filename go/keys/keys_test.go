@@ -0,0 +1,146 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/loglist"
+)
+
+func mustMarshal(t *testing.T, pk interface{}) []byte {
+	der, err := x509.MarshalPKIXPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestParsePublicKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pk := range []interface{}{&ecKey.PublicKey, edKey} {
+		der := mustMarshal(t, pk)
+		for _, data := range [][]byte{
+			der,
+			pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+			[]byte(base64.StdEncoding.EncodeToString(der) + "\n"),
+		} {
+			got, err := ParsePublicKey(data)
+			if err != nil {
+				t.Errorf("ParsePublicKey(%q)=_,%v", data, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, pk) {
+				t.Errorf("ParsePublicKey(%q)=%v, want %v", data, got, pk)
+			}
+		}
+	}
+
+	for _, data := range []string{
+		"",
+		"not a key",
+		"-----BEGIN CERTIFICATE-----\nMAA=\n-----END CERTIFICATE-----\n",
+		"-----BEGIN PUBLIC KEY-----\n",
+	} {
+		if _, err := ParsePublicKey([]byte(data)); err == nil {
+			t.Errorf("ParsePublicKey(%q)=_,nil, want error", data)
+		}
+	}
+}
+
+func TestLoadPublicKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: mustMarshal(t, &key.PublicKey)}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if pk, err := LoadPublicKey(path); err != nil || !reflect.DeepEqual(pk, &key.PublicKey) {
+		t.Errorf("LoadPublicKey()=%v,%v, want %v", pk, err, &key.PublicKey)
+	}
+	if _, err := LoadPublicKey(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("LoadPublicKey(missing file)=_,nil, want error")
+	}
+}
+
+func TestSet(t *testing.T) {
+	var ders [][]byte
+	for i := 0; i < 2; i++ {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ders = append(ders, mustMarshal(t, &key.PublicKey))
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSet()
+	v, err := s.AddDER(ders[0])
+	if err != nil {
+		t.Fatalf("AddDER()=_,%v", err)
+	}
+	if v.KeyID() != sha256.Sum256(ders[0]) {
+		t.Errorf("got verifier with key ID %x, want %x", v.KeyID(), sha256.Sum256(ders[0]))
+	}
+	// Adding the same key again returns the same verifier.
+	if again, err := s.AddDER(ders[0]); err != nil || again != v {
+		t.Errorf("AddDER(again)=%p,%v, want %p", again, err, v)
+	}
+	if again, err := s.Add(v.PublicKey()); err != nil || again != v {
+		t.Errorf("Add(same key)=%p,%v, want %p", again, err, v)
+	}
+	ev, err := s.Add(edKey)
+	if err != nil {
+		t.Fatalf("Add(Ed25519 key)=_,%v", err)
+	}
+	if got := s.Get(sha256.Sum256(mustMarshal(t, edKey))); got != ev {
+		t.Errorf("Get(Ed25519 key ID)=%p, want %p", got, ev)
+	}
+	if _, err := s.AddDER([]byte("garbage")); err == nil {
+		t.Error("AddDER(garbage)=_,nil, want error")
+	}
+
+	id0, id := v.KeyID(), sha256.Sum256(ders[1])
+	ll := &loglist.LogList{Operators: []*loglist.Operator{{Name: "Test", Logs: []*loglist.Log{
+		{Description: "log 0", LogID: id0[:], Key: ders[0]},
+		{Description: "log 1", LogID: id[:], Key: ders[1]},
+	}}}}
+	if err := s.AddLogList(ll); err != nil {
+		t.Fatalf("AddLogList()=%v", err)
+	}
+	if s.Len() != 3 || s.Get(id) == nil || s.Get(ct.SHA256Hash{}) != nil {
+		t.Errorf("got %d keys, want the 3 added", s.Len())
+	}
+	ll.Operators[0].Logs[0].Key = []byte("garbage")
+	if err := s.AddLogList(ll); err == nil {
+		t.Error("AddLogList(with bad key)=nil, want error")
+	}
+}
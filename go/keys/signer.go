@@ -0,0 +1,153 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/google/certificate-transparency/go"
+)
+
+// Signer signs the structures a log signs, such as SCTs and STHs, with the
+// log's private key.  Signers must be safe for concurrent use.
+type Signer interface {
+	// Public returns the public key of the log.
+	Public() crypto.PublicKey
+	// KeyID returns the ID of the log, the SHA-256 hash of its public
+	// key.
+	KeyID() ct.SHA256Hash
+	// Sign returns a signature over data, which for RSA and ECDSA keys is
+	// over its SHA-256 hash, and for Ed25519 keys over data itself.
+	Sign(data []byte) (ct.DigitallySigned, error)
+}
+
+// cryptoSigner is a Signer using a crypto.Signer.
+type cryptoSigner struct {
+	key       crypto.Signer
+	rand      io.Reader
+	algorithm ct.SignatureAlgorithm
+	keyID     ct.SHA256Hash
+}
+
+// NewSigner returns a Signer which signs with key: either a private key, or a
+// crypto.Signer backed by an HSM, as PKCS#11 libraries provide.  The key's ID
+// is derived once, here.  Randomness for signing is read from rand, or from
+// crypto/rand if it is nil.
+func NewSigner(key crypto.Signer, rand io.Reader) (Signer, error) {
+	algorithm, err := ct.SignatureAlgorithmForKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	id, err := ct.KeyID(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &cryptoSigner{key: key, rand: rand, algorithm: algorithm, keyID: id}, nil
+}
+
+func (s *cryptoSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s *cryptoSigner) KeyID() ct.SHA256Hash {
+	return s.keyID
+}
+
+func (s *cryptoSigner) Sign(data []byte) (ct.DigitallySigned, error) {
+	r := s.rand
+	if r == nil {
+		r = rand.Reader
+	}
+	ds := ct.DigitallySigned{HashAlgorithm: ct.SHA256, SignatureAlgorithm: s.algorithm}
+	var err error
+	if s.algorithm == ct.Ed25519 {
+		ds.HashAlgorithm = ct.Intrinsic
+		ds.Signature, err = s.key.Sign(r, data, crypto.Hash(0))
+	} else {
+		hash := sha256.Sum256(data)
+		ds.Signature, err = s.key.Sign(r, hash[:], crypto.SHA256)
+	}
+	if err != nil {
+		return ct.DigitallySigned{}, err
+	}
+	return ds, nil
+}
+
+// ParsePrivateKey parses a PEM encoded private key: an EC PRIVATE KEY, an RSA
+// PRIVATE KEY, or a PKCS#8 PRIVATE KEY holding an ECDSA, RSA or Ed25519 key.
+// Encrypted keys aren't supported.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("keys: failed to decode PEM")
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key := key.(type) {
+		case *ecdsa.PrivateKey:
+			return key, nil
+		case *rsa.PrivateKey:
+			return key, nil
+		case ed25519.PrivateKey:
+			return key, nil
+		}
+		return nil, fmt.Errorf("keys: unsupported private key type %T", key)
+	}
+	return nil, fmt.Errorf("keys: unsupported PEM block type %s", block.Type)
+}
+
+// LoadSigner returns a Signer for the PEM encoded private key in the file at
+// path, as accepted by ParsePrivateKey.
+func LoadSigner(path string) (Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return NewSigner(key, nil)
+}
+
+// PKCS11Config identifies a private key held in a PKCS#11 token, such as an
+// HSM.
+type PKCS11Config struct {
+	// Path of the PKCS#11 module, the library which talks to the token.
+	Module string
+	// Label of the token holding the key, and the PIN to log in with.
+	TokenLabel string
+	PIN        string
+	// Label of the key in the token.
+	KeyLabel string
+}
+
+// ErrPKCS11Unsupported is returned by NewPKCS11Signer.
+var ErrPKCS11Unsupported = errors.New("keys: PKCS#11 isn't supported by this build; use NewSigner with a crypto.Signer from a PKCS#11 library")
+
+// NewPKCS11Signer returns a Signer for the key in a PKCS#11 token.  No PKCS#11
+// implementation is built in, so it always returns ErrPKCS11Unsupported; it
+// holds the place of one, which would provide a crypto.Signer for NewSigner.
+func NewPKCS11Signer(config PKCS11Config) (Signer, error) {
+	if config.Module == "" || config.KeyLabel == "" {
+		return nil, errors.New("keys: PKCS#11 module and key label are required")
+	}
+	return nil, ErrPKCS11Unsupported
+}
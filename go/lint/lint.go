@@ -0,0 +1,184 @@
+// Package lint checks certificates for common signs of misissuance, such as
+// validity periods longer than the Baseline Requirements allow, weak keys and
+// SHA-1 signatures.  A Linter is a scanner.EntryMatcher, so running one over a
+// log turns the scanner into a misissuance monitor.
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// Severity is how serious breaking a Lint is.
+type Severity int
+
+// Severities, from least to most serious.
+const (
+	// Bad practice, but not forbidden.
+	Notice Severity = iota
+	// Forbidden in some circumstances, or likely to cause problems.
+	Warning
+	// Forbidden.
+	Error
+)
+
+var severityNames = []string{"notice", "warning", "error"}
+
+func (s Severity) String() string {
+	if s >= 0 && int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// MarshalText implements encoding.TextMarshaler, so that Severities appear in
+// JSON by name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Severity) UnmarshalText(text []byte) error {
+	for i, n := range severityNames {
+		if n == string(text) {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// Lint is a rule which certificates should follow.
+type Lint struct {
+	// A short identifier for the rule, e.g. "sha1_signature".
+	Name        string
+	Description string
+	Severity    Severity
+	// Check returns a description of each way |c| breaks the rule, or
+	// nothing if it follows it.  |c| may be the TBSCertificate of a
+	// precertificate, so its signature mustn't be relied on.
+	Check func(c *x509.Certificate) []string
+}
+
+// Finding reports that a certificate breaks a Lint.
+type Finding struct {
+	// The entry the certificate is from, and its index, if the certificate
+	// was linted from a log entry.
+	Entry *ct.LogEntry `json:"-"`
+	Index int64        `json:"index"`
+	// The Lint's Name and Severity.
+	Lint     string   `json:"lint"`
+	Severity Severity `json:"severity"`
+	// How the certificate breaks the Lint.
+	Detail string `json:"detail"`
+}
+
+func (f Finding) String() string {
+	if f.Entry != nil {
+		return fmt.Sprintf("entry %d: %s: %s: %s", f.Index, f.Severity, f.Lint, f.Detail)
+	}
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Lint, f.Detail)
+}
+
+// LinterOptions holds optional configuration for a Linter.
+type LinterOptions struct {
+	// The Lints to run; nil means DefaultLints.
+	Lints []*Lint
+	// Findings less severe than this are ignored.
+	MinSeverity Severity
+}
+
+// Linter checks certificates against a set of Lints.  It is an EntryMatcher,
+// matching the entries whose certificates or precertificates break any of
+// them.
+type Linter struct {
+	opts LinterOptions
+}
+
+// NewLinter returns a Linter configured by |opts|.
+func NewLinter(opts LinterOptions) *Linter {
+	if opts.Lints == nil {
+		opts.Lints = DefaultLints
+	}
+	return &Linter{opts: opts}
+}
+
+// Check returns the Findings for the ways |c| breaks the Linter's Lints.
+func (l *Linter) Check(c *x509.Certificate) []Finding {
+	var findings []Finding
+	for _, lint := range l.opts.Lints {
+		if lint.Severity < l.opts.MinSeverity {
+			continue
+		}
+		for _, detail := range lint.Check(c) {
+			findings = append(findings, Finding{Lint: lint.Name, Severity: lint.Severity, Detail: detail})
+		}
+	}
+	return findings
+}
+
+// Findings returns the Findings for the certificate or precertificate of
+// |entry|, whose X509Cert or Precert is set.
+func (l *Linter) Findings(entry *ct.LogEntry) []Finding {
+	c := entry.Certificate()
+	if c == nil {
+		return nil
+	}
+	findings := l.Check(c)
+	for i := range findings {
+		findings[i].Entry, findings[i].Index = entry, entry.Index
+	}
+	return findings
+}
+
+// EntryMatches implements scanner.EntryMatcher.
+func (l *Linter) EntryMatches(entry *ct.LogEntry) bool {
+	return len(l.Findings(entry)) > 0
+}
+
+func (l *Linter) String() string {
+	var names []string
+	for _, lint := range l.opts.Lints {
+		names = append(names, lint.Name)
+	}
+	return fmt.Sprintf("Linter(%s, min=%s)", strings.Join(names, " "), l.opts.MinSeverity)
+}
+
+// FindingWriter writes Findings to a writer as JSON, one per line.
+type FindingWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewFindingWriter returns a FindingWriter which writes to |w|.  Closing it
+// closes |w| if it is an io.Closer.
+func NewFindingWriter(w io.Writer) *FindingWriter {
+	return &FindingWriter{w: w, enc: json.NewEncoder(w)}
+}
+
+// Write writes |findings|.  It is safe for concurrent use.
+func (w *FindingWriter) Write(findings []Finding) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, f := range findings {
+		if err := w.enc.Encode(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying writer if it is an io.Closer.
+func (w *FindingWriter) Close() error {
+	if c, ok := w.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
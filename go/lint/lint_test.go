@@ -0,0 +1,136 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// Lints which complain about certificates with a given common name.
+var (
+	noticeLint = &Lint{Name: "notice", Severity: Notice, Check: func(c *x509.Certificate) []string {
+		if c.Subject.CommonName == "notice" {
+			return []string{"notice 1", "notice 2"}
+		}
+		return nil
+	}}
+	errorLint = &Lint{Name: "error", Severity: Error, Check: func(c *x509.Certificate) []string {
+		if c.Subject.CommonName == "error" {
+			return []string{"error"}
+		}
+		return nil
+	}}
+)
+
+func certNamed(cn string) *x509.Certificate {
+	c := &x509.Certificate{}
+	c.Subject.CommonName = cn
+	return c
+}
+
+func TestLinterCheck(t *testing.T) {
+	l := NewLinter(LinterOptions{Lints: []*Lint{noticeLint, errorLint}})
+	if got := l.Check(certNamed("fine")); len(got) != 0 {
+		t.Errorf("Check(fine)=%v, want none", got)
+	}
+	want := []Finding{
+		{Lint: "notice", Severity: Notice, Detail: "notice 1"},
+		{Lint: "notice", Severity: Notice, Detail: "notice 2"},
+	}
+	if got := l.Check(certNamed("notice")); !reflect.DeepEqual(got, want) {
+		t.Errorf("Check(notice)=%v, want %v", got, want)
+	}
+
+	l = NewLinter(LinterOptions{Lints: []*Lint{noticeLint, errorLint}, MinSeverity: Warning})
+	if got := l.Check(certNamed("notice")); len(got) != 0 {
+		t.Errorf("Check(notice) with MinSeverity=Warning = %v, want none", got)
+	}
+	want = []Finding{{Lint: "error", Severity: Error, Detail: "error"}}
+	if got := l.Check(certNamed("error")); !reflect.DeepEqual(got, want) {
+		t.Errorf("Check(error)=%v, want %v", got, want)
+	}
+
+	if l := NewLinter(LinterOptions{}); len(l.opts.Lints) != len(DefaultLints) {
+		t.Errorf("NewLinter() runs %d lints, want DefaultLints", len(l.opts.Lints))
+	}
+}
+
+func TestLinterEntries(t *testing.T) {
+	l := NewLinter(LinterOptions{Lints: []*Lint{errorLint}})
+	cert := &ct.LogEntry{Index: 1, X509Cert: certNamed("error")}
+	precert := &ct.LogEntry{Index: 2, Precert: &ct.Precertificate{TBSCertificate: *certNamed("error")}}
+	fine := &ct.LogEntry{Index: 3, X509Cert: certNamed("fine")}
+	for i, tc := range []struct {
+		entry *ct.LogEntry
+		want  []Finding
+	}{
+		{entry: cert, want: []Finding{{Entry: cert, Index: 1, Lint: "error", Severity: Error, Detail: "error"}}},
+		{entry: precert, want: []Finding{{Entry: precert, Index: 2, Lint: "error", Severity: Error, Detail: "error"}}},
+		{entry: fine},
+		{entry: &ct.LogEntry{Index: 4}},
+	} {
+		got := l.Findings(tc.entry)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("#%d: Findings()=%v, want %v", i, got, tc.want)
+		}
+		if m := l.EntryMatches(tc.entry); m != (len(tc.want) > 0) {
+			t.Errorf("#%d: EntryMatches()=%t, want %t", i, m, !m)
+		}
+	}
+	if got, want := l.Findings(cert)[0].String(), "entry 1: error: error: error"; got != want {
+		t.Errorf("String()=%q, want %q", got, want)
+	}
+}
+
+func TestSeverityText(t *testing.T) {
+	for _, s := range []Severity{Notice, Warning, Error} {
+		text, err := s.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Severity
+		if err := got.UnmarshalText(text); err != nil || got != s {
+			t.Errorf("UnmarshalText(%q)=%v,%v, want %v", text, got, err, s)
+		}
+	}
+	var s Severity
+	if err := s.UnmarshalText([]byte("fatal")); err == nil {
+		t.Error("UnmarshalText(fatal)=nil, want error")
+	}
+	if got, want := Severity(7).String(), "Severity(7)"; got != want {
+		t.Errorf("String()=%q, want %q", got, want)
+	}
+}
+
+func TestFindingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewFindingWriter(&buf)
+	findings := []Finding{
+		{Index: 1, Lint: "weak_key", Severity: Error, Detail: "RSA key of 1024 bits"},
+		{Index: 2, Lint: "missing_ext_key_usage", Severity: Warning, Detail: "no extended key usage"},
+	}
+	if err := w.Write(findings); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(findings) {
+		t.Fatalf("wrote %d lines, want %d", len(lines), len(findings))
+	}
+	if want := `{"index":1,"lint":"weak_key","severity":"error","detail":"RSA key of 1024 bits"}`; lines[0] != want {
+		t.Errorf("wrote %s, want %s", lines[0], want)
+	}
+	for i, line := range lines {
+		var f Finding
+		if err := json.Unmarshal([]byte(line), &f); err != nil || !reflect.DeepEqual(f, findings[i]) {
+			t.Errorf("#%d: read back %v,%v, want %v", i, f, err, findings[i])
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package lint
+
+import (
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// DefaultLints is every Lint in this package.
+var DefaultLints = []*Lint{
+	ValidityTooLong,
+	MissingExtKeyUsage,
+	InvalidSANEncoding,
+	InvalidDNSName,
+	WeakKey,
+	SHA1Signature,
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// isCA reports whether |c| is a CA certificate, which the rules for
+// subscriber certificates don't apply to.
+func isCA(c *x509.Certificate) bool {
+	return c.BasicConstraintsValid && c.IsCA
+}
+
+// The maximum validity periods of subscriber certificates, by the date from
+// which they apply, latest first.
+var maxValidities = []struct {
+	from         time.Time
+	months, days int
+	description  string
+}{
+	{from: date(2020, time.September, 1), days: 398, description: "398 days"},
+	{from: date(2018, time.March, 1), days: 825, description: "825 days"},
+	{from: date(2015, time.April, 1), months: 39, description: "39 months"},
+	{from: date(2012, time.July, 1), months: 60, description: "60 months"},
+}
+
+// ValidityTooLong checks that subscriber certificates aren't valid for longer
+// than the Baseline Requirements allowed when they were issued (section
+// 6.3.2).  Certificates are taken to be issued at their NotBefore.
+var ValidityTooLong = &Lint{
+	Name:        "validity_too_long",
+	Description: "Subscriber certificates must not be valid for longer than the Baseline Requirements allow",
+	Severity:    Error,
+	Check: func(c *x509.Certificate) []string {
+		if isCA(c) {
+			return nil
+		}
+		for _, v := range maxValidities {
+			if c.NotBefore.Before(v.from) {
+				continue
+			}
+			if c.NotAfter.After(c.NotBefore.AddDate(0, v.months, v.days)) {
+				days := int(c.NotAfter.Sub(c.NotBefore) / (24 * time.Hour))
+				return []string{fmt.Sprintf("valid for %d days, more than the %s allowed from %s", days, v.description, v.from.Format("2006-01-02"))}
+			}
+			return nil
+		}
+		return nil
+	},
+}
+
+// MissingExtKeyUsage checks that subscriber certificates have an extended
+// key usage extension (Baseline Requirements section 7.1.2.3).
+var MissingExtKeyUsage = &Lint{
+	Name:        "missing_ext_key_usage",
+	Description: "Subscriber certificates must have an extended key usage",
+	Severity:    Warning,
+	Check: func(c *x509.Certificate) []string {
+		if isCA(c) || len(c.ExtKeyUsage) > 0 || len(c.UnknownExtKeyUsage) > 0 {
+			return nil
+		}
+		return []string{"no extended key usage"}
+	},
+}
+
+// InvalidSANEncoding checks that Subject Alternative Names are encoded
+// correctly: that their strings are valid IA5Strings, and that IP addresses
+// are 4 or 16 bytes long.  Such names are mangled or dropped when the
+// certificate is parsed, so it is parsed again to find them.
+var InvalidSANEncoding = &Lint{
+	Name:        "invalid_san_encoding",
+	Description: "Subject Alternative Names must be encoded correctly",
+	Severity:    Error,
+	Check: func(c *x509.Certificate) []string {
+		_, err := x509.ParseTBSCertificate(c.RawTBSCertificate)
+		nfe, ok := err.(x509.NonFatalErrors)
+		if !ok {
+			return nil
+		}
+		var details []string
+		for _, e := range nfe.Errors {
+			switch e := e.(type) {
+			case x509.InvalidString:
+				switch e.Field {
+				case "dNSName", "rfc822Name", "uniformResourceIdentifier":
+					details = append(details, e.Error())
+				}
+			case x509.InvalidIPAddress:
+				details = append(details, e.Error())
+			}
+		}
+		return details
+	},
+}
+
+// InvalidDNSName checks that DNS names are syntactically valid host names,
+// or wildcards covering them (RFC 5280 section 4.2.1.6 and Baseline
+// Requirements section 7.1.4.2.1).
+var InvalidDNSName = &Lint{
+	Name:        "invalid_dns_name",
+	Description: "DNS names must be valid host names or wildcards",
+	Severity:    Error,
+	Check: func(c *x509.Certificate) []string {
+		var details []string
+		for _, name := range c.DNSNames {
+			if problem := checkDNSName(name); problem != "" {
+				details = append(details, fmt.Sprintf("DNS name %q %s", name, problem))
+			}
+		}
+		return details
+	},
+}
+
+// checkDNSName returns what is wrong with |name|, if anything.
+func checkDNSName(name string) string {
+	if len(name) == 0 {
+		return "is empty"
+	}
+	if len(name) > 253 {
+		return "is longer than 253 characters"
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if label == "*" && i == 0 && len(labels) > 2 {
+			continue
+		}
+		if len(label) == 0 {
+			return "has an empty label"
+		}
+		if len(label) > 63 {
+			return "has a label longer than 63 characters"
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return "has a label starting or ending with a hyphen"
+		}
+		for _, r := range label {
+			switch {
+			case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '-':
+			case r == '*':
+				return "has a wildcard which isn't the whole of the first of at least three labels"
+			default:
+				return fmt.Sprintf("has invalid character %q", r)
+			}
+		}
+	}
+	return ""
+}
+
+// WeakKey checks that keys are strong enough: RSA and DSA keys must have at
+// least 2048 bits, RSA exponents must be odd and greater than 1, and ECDSA
+// keys must be on curves of at least 256 bits (Baseline Requirements section
+// 6.1.5 and 6.1.6).
+var WeakKey = &Lint{
+	Name:        "weak_key",
+	Description: "Keys must be strong enough",
+	Severity:    Error,
+	Check: func(c *x509.Certificate) []string {
+		switch k := c.PublicKey.(type) {
+		case *rsa.PublicKey:
+			var details []string
+			if bits := k.N.BitLen(); bits < 2048 {
+				details = append(details, fmt.Sprintf("RSA key of %d bits", bits))
+			}
+			if k.E < 3 || k.E%2 == 0 {
+				details = append(details, fmt.Sprintf("RSA public exponent %d", k.E))
+			}
+			return details
+		case *dsa.PublicKey:
+			if bits := k.P.BitLen(); bits < 2048 {
+				return []string{fmt.Sprintf("DSA key of %d bits", bits)}
+			}
+		case *ecdsa.PublicKey:
+			if params := k.Curve.Params(); params.BitSize < 256 {
+				return []string{fmt.Sprintf("ECDSA key on %s", params.Name)}
+			}
+		}
+		return nil
+	},
+}
+
+// sha1Deprecation is when the Baseline Requirements stopped CAs issuing
+// subscriber certificates signed with SHA-1 (section 7.1.3).
+var sha1Deprecation = date(2016, time.January, 1)
+
+var sha1Algorithms = map[x509.SignatureAlgorithm]string{
+	x509.SHA1WithRSA:   "SHA1WithRSA",
+	x509.DSAWithSHA1:   "DSAWithSHA1",
+	x509.ECDSAWithSHA1: "ECDSAWithSHA1",
+}
+
+// SHA1Signature checks that certificates issued since SHA-1 was deprecated
+// aren't signed with it.  The algorithm is the one in the TBSCertificate, so
+// precertificates are checked too.
+var SHA1Signature = &Lint{
+	Name:        "sha1_signature",
+	Description: "Certificates must not be signed with SHA-1 after its deprecation",
+	Severity:    Error,
+	Check: func(c *x509.Certificate) []string {
+		alg, ok := sha1Algorithms[c.SignatureAlgorithm]
+		if !ok || c.NotBefore.Before(sha1Deprecation) {
+			return nil
+		}
+		return []string{fmt.Sprintf("signed with %s, deprecated from %s", alg, sha1Deprecation.Format("2006-01-02"))}
+	},
+}
@@ -0,0 +1,156 @@
+package lint
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+type lintTest struct {
+	cert *x509.Certificate
+	want []string
+}
+
+func runLintTests(t *testing.T, lint *Lint, tests []lintTest) {
+	for i, tc := range tests {
+		if got := lint.Check(tc.cert); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("#%d: %s.Check()=%q, want %q", i, lint.Name, got, tc.want)
+		}
+	}
+}
+
+func validFor(notBefore time.Time, years, months, days int) *x509.Certificate {
+	return &x509.Certificate{NotBefore: notBefore, NotAfter: notBefore.AddDate(years, months, days)}
+}
+
+func TestValidityTooLong(t *testing.T) {
+	ca := validFor(date(2017, time.January, 1), 20, 0, 0)
+	ca.BasicConstraintsValid, ca.IsCA = true, true
+	runLintTests(t, ValidityTooLong, []lintTest{
+		{cert: validFor(date(2010, time.January, 1), 10, 0, 0)},
+		{cert: validFor(date(2013, time.January, 1), 5, 0, 0)},
+		{
+			cert: validFor(date(2013, time.January, 1), 5, 0, 1),
+			want: []string{"valid for 1827 days, more than the 60 months allowed from 2012-07-01"},
+		},
+		{cert: validFor(date(2016, time.January, 1), 3, 3, 0)},
+		{
+			cert: validFor(date(2016, time.January, 1), 5, 0, 0),
+			want: []string{"valid for 1827 days, more than the 39 months allowed from 2015-04-01"},
+		},
+		{cert: validFor(date(2019, time.January, 1), 0, 0, 825)},
+		{
+			cert: validFor(date(2019, time.January, 1), 0, 0, 826),
+			want: []string{"valid for 826 days, more than the 825 days allowed from 2018-03-01"},
+		},
+		{cert: validFor(date(2021, time.January, 1), 0, 0, 398)},
+		{
+			cert: validFor(date(2021, time.January, 1), 2, 0, 0),
+			want: []string{"valid for 730 days, more than the 398 days allowed from 2020-09-01"},
+		},
+		{cert: ca},
+	})
+}
+
+func TestMissingExtKeyUsage(t *testing.T) {
+	runLintTests(t, MissingExtKeyUsage, []lintTest{
+		{cert: &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}},
+		{cert: &x509.Certificate{UnknownExtKeyUsage: []asn1.ObjectIdentifier{{1, 2, 3}}}},
+		{cert: &x509.Certificate{BasicConstraintsValid: true, IsCA: true}},
+		{cert: &x509.Certificate{}, want: []string{"no extended key usage"}},
+	})
+}
+
+// createCertificate returns a certificate with |dnsNames|, in which the bytes
+// |old| are replaced by |new| once it is signed.
+func createCertificate(t *testing.T, dnsNames []string, old, new string) *x509.Certificate {
+	tmpl := testcert.Template("www.example.com", false)
+	tmpl.DNSNames = dnsNames
+	der := testcert.Issue(t, tmpl, testcert.NewKey(t), nil).Raw
+	der = bytes.Replace(der, []byte(old), []byte(new), -1)
+	c, err := x509.ParseCertificate(der)
+	if x509.IsFatal(err) {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestInvalidSANEncoding(t *testing.T) {
+	runLintTests(t, InvalidSANEncoding, []lintTest{
+		{cert: createCertificate(t, []string{"www.example.com"}, "", "")},
+		{
+			cert: createCertificate(t, []string{"www.exXmple.com"}, "www.exXmple.com", "www.ex\xe4mple.com"),
+			want: []string{`x509: invalid IA5String in dNSName ("www.ex\xe4mple.com")`},
+		},
+	})
+}
+
+func TestInvalidDNSName(t *testing.T) {
+	runLintTests(t, InvalidDNSName, []lintTest{
+		{cert: &x509.Certificate{DNSNames: []string{"example.com", "www.example.com", "*.example.com", "x-1.example.com"}}},
+		{
+			cert: &x509.Certificate{DNSNames: []string{
+				"www..example.com",
+				"-www.example.com",
+				"www_1.example.com",
+				"*.com",
+				"w*w.example.com",
+				"www.*.example.com",
+				"",
+			}},
+			want: []string{
+				`DNS name "www..example.com" has an empty label`,
+				`DNS name "-www.example.com" has a label starting or ending with a hyphen`,
+				`DNS name "www_1.example.com" has invalid character '_'`,
+				`DNS name "*.com" has a wildcard which isn't the whole of the first of at least three labels`,
+				`DNS name "w*w.example.com" has a wildcard which isn't the whole of the first of at least three labels`,
+				`DNS name "www.*.example.com" has a wildcard which isn't the whole of the first of at least three labels`,
+				`DNS name "" is empty`,
+			},
+		},
+	})
+}
+
+func TestWeakKey(t *testing.T) {
+	strongRSA := &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), 2047), E: 65537}
+	weakRSA := &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), 1023), E: 4}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakDSA := &dsa.PublicKey{Parameters: dsa.Parameters{P: new(big.Int).Lsh(big.NewInt(1), 1023)}}
+	runLintTests(t, WeakKey, []lintTest{
+		{cert: &x509.Certificate{PublicKey: strongRSA}},
+		{cert: &x509.Certificate{PublicKey: &p256.PublicKey}},
+		{cert: &x509.Certificate{}},
+		{cert: &x509.Certificate{PublicKey: weakRSA}, want: []string{"RSA key of 1024 bits", "RSA public exponent 4"}},
+		{cert: &x509.Certificate{PublicKey: &p224.PublicKey}, want: []string{"ECDSA key on P-224"}},
+		{cert: &x509.Certificate{PublicKey: weakDSA}, want: []string{"DSA key of 1024 bits"}},
+	})
+}
+
+func TestSHA1Signature(t *testing.T) {
+	runLintTests(t, SHA1Signature, []lintTest{
+		{cert: &x509.Certificate{SignatureAlgorithm: x509.SHA1WithRSA, NotBefore: date(2015, time.December, 31)}},
+		{cert: &x509.Certificate{SignatureAlgorithm: x509.SHA256WithRSA, NotBefore: date(2016, time.June, 1)}},
+		{
+			cert: &x509.Certificate{SignatureAlgorithm: x509.ECDSAWithSHA1, NotBefore: date(2016, time.June, 1)},
+			want: []string{"signed with ECDSAWithSHA1, deprecated from 2016-01-01"},
+		},
+	})
+}
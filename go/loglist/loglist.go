@@ -0,0 +1,213 @@
+// Package loglist parses the lists of known CT logs published by browser
+// vendors, such as https://www.gstatic.com/ct/log_list/v3/log_list.json, and
+// evaluates sets of SCTs against the CT policies they enforce.
+package loglist
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+)
+
+// LogList is a list of known logs, grouped by the organisation which operates
+// them.
+type LogList struct {
+	Version   string      `json:"version,omitempty"`
+	Timestamp time.Time   `json:"log_list_timestamp"`
+	Operators []*Operator `json:"operators"`
+}
+
+// Operator is an organisation which operates logs.
+type Operator struct {
+	Name  string   `json:"name"`
+	Email []string `json:"email,omitempty"`
+	Logs  []*Log   `json:"logs"`
+}
+
+// Log describes a single log.
+type Log struct {
+	Description string `json:"description,omitempty"`
+	// SHA-256 hash of Key.
+	LogID []byte `json:"log_id"`
+	// DER encoded SubjectPublicKeyInfo of the log's key.
+	Key []byte `json:"key"`
+	URL string `json:"url"`
+	// Maximum Merge Delay, in seconds.
+	MMD              int               `json:"mmd"`
+	State            *LogStates        `json:"state,omitempty"`
+	TemporalInterval *TemporalInterval `json:"temporal_interval,omitempty"`
+
+	// Name of the log's operator, filled in when the list is parsed.
+	Operator string `json:"-"`
+}
+
+// LogStates holds the log's current state, which is the only non-nil field.
+type LogStates struct {
+	Pending   *LogState         `json:"pending,omitempty"`
+	Qualified *LogState         `json:"qualified,omitempty"`
+	Usable    *LogState         `json:"usable,omitempty"`
+	ReadOnly  *ReadOnlyLogState `json:"readonly,omitempty"`
+	Retired   *LogState         `json:"retired,omitempty"`
+	Rejected  *LogState         `json:"rejected,omitempty"`
+}
+
+// LogState records when a log entered a state.
+type LogState struct {
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ReadOnlyLogState records when a log was frozen, and its tree at the time.
+type ReadOnlyLogState struct {
+	LogState
+	FinalTreeHead TreeHead `json:"final_tree_head"`
+}
+
+// TreeHead is the size and root hash of a log's tree.
+type TreeHead struct {
+	TreeSize       int64  `json:"tree_size"`
+	SHA256RootHash []byte `json:"sha256_root_hash"`
+}
+
+// TemporalInterval is the range of certificate expiry times a temporally
+// sharded log accepts: certificates whose NotAfter is in [StartInclusive,
+// EndExclusive).
+type TemporalInterval struct {
+	StartInclusive time.Time `json:"start_inclusive"`
+	EndExclusive   time.Time `json:"end_exclusive"`
+}
+
+// Status is the state a log is in.
+type Status int
+
+// Log states, in the order logs move through them.  Logs may be rejected
+// from the pending or qualified states.
+const (
+	UnknownStatus Status = iota
+	PendingStatus
+	QualifiedStatus
+	UsableStatus
+	ReadOnlyStatus
+	RetiredStatus
+	RejectedStatus
+)
+
+func (s Status) String() string {
+	switch s {
+	case PendingStatus:
+		return "pending"
+	case QualifiedStatus:
+		return "qualified"
+	case UsableStatus:
+		return "usable"
+	case ReadOnlyStatus:
+		return "readonly"
+	case RetiredStatus:
+		return "retired"
+	case RejectedStatus:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// Status returns the log's current state, and when it entered it.
+func (l *Log) Status() (Status, time.Time) {
+	s := l.State
+	switch {
+	case s == nil:
+		return UnknownStatus, time.Time{}
+	case s.Pending != nil:
+		return PendingStatus, s.Pending.Timestamp
+	case s.Qualified != nil:
+		return QualifiedStatus, s.Qualified.Timestamp
+	case s.Usable != nil:
+		return UsableStatus, s.Usable.Timestamp
+	case s.ReadOnly != nil:
+		return ReadOnlyStatus, s.ReadOnly.Timestamp
+	case s.Retired != nil:
+		return RetiredStatus, s.Retired.Timestamp
+	case s.Rejected != nil:
+		return RejectedStatus, s.Rejected.Timestamp
+	}
+	return UnknownStatus, time.Time{}
+}
+
+// PublicKey returns the log's parsed public key.
+func (l *Log) PublicKey() (crypto.PublicKey, error) {
+	return ct.PublicKeyFromDER(l.Key)
+}
+
+// Verifier returns a verifier for signatures by the log's key.
+func (l *Log) Verifier() (*ct.LogVerifier, error) {
+	return ct.NewLogVerifierFromDER(l.Key)
+}
+
+// MMDDuration returns the log's Maximum Merge Delay.
+func (l *Log) MMDDuration() time.Duration {
+	return time.Duration(l.MMD) * time.Second
+}
+
+// AcceptsExpiry reports whether the log accepts certificates which expire at
+// notAfter, which all logs which aren't temporally sharded do.
+func (l *Log) AcceptsExpiry(notAfter time.Time) bool {
+	i := l.TemporalInterval
+	return i == nil || (!notAfter.Before(i.StartInclusive) && notAfter.Before(i.EndExclusive))
+}
+
+// NewFromJSON parses a log list in the JSON format published by Chrome.
+func NewFromJSON(b []byte) (*LogList, error) {
+	var ll LogList
+	if err := json.Unmarshal(b, &ll); err != nil {
+		return nil, fmt.Errorf("failed to parse log list: %v", err)
+	}
+	for _, op := range ll.Operators {
+		for _, l := range op.Logs {
+			l.Operator = op.Name
+			if len(l.Key) > 0 {
+				if id := sha256.Sum256(l.Key); !bytes.Equal(id[:], l.LogID) {
+					return nil, fmt.Errorf("log %q: log_id isn't the hash of its key", l.Description)
+				}
+			}
+		}
+	}
+	return &ll, nil
+}
+
+// FindLogByID returns the log with the given log ID, or nil if there isn't
+// one.
+func (ll *LogList) FindLogByID(id [sha256.Size]byte) *Log {
+	for _, op := range ll.Operators {
+		for _, l := range op.Logs {
+			if bytes.Equal(l.LogID, id[:]) {
+				return l
+			}
+		}
+	}
+	return nil
+}
+
+// FindLogByURL returns the log with the given URL, or nil if there isn't one.
+func (ll *LogList) FindLogByURL(url string) *Log {
+	for _, op := range ll.Operators {
+		for _, l := range op.Logs {
+			if l.URL == url {
+				return l
+			}
+		}
+	}
+	return nil
+}
+
+// Logs returns all the logs in the list.
+func (ll *LogList) Logs() []*Log {
+	var logs []*Log
+	for _, op := range ll.Operators {
+		logs = append(logs, op.Logs...)
+	}
+	return logs
+}
@@ -0,0 +1,138 @@
+package loglist
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// testLog describes a log in the list built by testLogListJSON.
+type testLog struct {
+	operator string
+	url      string
+	state    string // JSON of the log's state.
+	interval string // JSON of the log's temporal interval, if it has one.
+}
+
+var testLogs = []testLog{
+	{operator: "Google", url: "https://google1/", state: `{"usable": {"timestamp": "2019-01-01T00:00:00Z"}}`},
+	{operator: "Google", url: "https://google2/", state: `{"retired": {"timestamp": "2020-01-01T00:00:00Z"}}`},
+	{operator: "Other", url: "https://other1/", state: `{"usable": {"timestamp": "2019-01-01T00:00:00Z"}}`,
+		interval: `{"start_inclusive": "2025-01-01T00:00:00Z", "end_exclusive": "2025-07-01T00:00:00Z"}`},
+	{operator: "Other", url: "https://other2/", state: `{"readonly": {"timestamp": "2021-01-01T00:00:00Z", "final_tree_head": {"tree_size": 10, "sha256_root_hash": ""}}}`},
+	{operator: "Third", url: "https://third1/", state: `{"pending": {"timestamp": "2021-01-01T00:00:00Z"}}`},
+}
+
+// testLogListJSON returns a log list containing testLogs with freshly
+// generated keys, and the IDs of the logs.
+func testLogListJSON(t *testing.T, timestamp string) ([]byte, [][sha256.Size]byte) {
+	var ids [][sha256.Size]byte
+	var ops []string
+	opLogs := make(map[string][]string)
+	for i, l := range testLogs {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := sha256.Sum256(der)
+		ids = append(ids, id)
+		j := fmt.Sprintf(`{"description": "log %d", "log_id": %q, "key": %q, "url": %q, "mmd": 86400, "state": %s`,
+			i, base64.StdEncoding.EncodeToString(id[:]), base64.StdEncoding.EncodeToString(der), l.url, l.state)
+		if l.interval != "" {
+			j += `, "temporal_interval": ` + l.interval
+		}
+		if _, ok := opLogs[l.operator]; !ok {
+			ops = append(ops, l.operator)
+		}
+		opLogs[l.operator] = append(opLogs[l.operator], j+"}")
+	}
+	var opJSON []string
+	for _, op := range ops {
+		opJSON = append(opJSON, fmt.Sprintf(`{"name": %q, "email": ["ct@example.com"], "logs": [%s]}`, op, strings.Join(opLogs[op], ",")))
+	}
+	return []byte(fmt.Sprintf(`{"version": "1.0", "log_list_timestamp": %q, "operators": [%s]}`, timestamp, strings.Join(opJSON, ","))), ids
+}
+
+func TestNewFromJSON(t *testing.T) {
+	b, ids := testLogListJSON(t, "2021-06-01T00:00:00Z")
+	ll, err := NewFromJSON(b)
+	if err != nil {
+		t.Fatalf("NewFromJSON()=_,%v", err)
+	}
+	if len(ll.Operators) != 3 || len(ll.Logs()) != len(testLogs) {
+		t.Fatalf("Got %d operators and %d logs, want 3 and %d", len(ll.Operators), len(ll.Logs()), len(testLogs))
+	}
+	wantStatus := []Status{UsableStatus, RetiredStatus, UsableStatus, ReadOnlyStatus, PendingStatus}
+	for i, id := range ids {
+		l := ll.FindLogByID(id)
+		if l == nil {
+			t.Errorf("#%d: FindLogByID() didn't find log", i)
+			continue
+		}
+		if l.URL != testLogs[i].url || l.Operator != testLogs[i].operator {
+			t.Errorf("#%d: got log %s operated by %s, want %s operated by %s", i, l.URL, l.Operator, testLogs[i].url, testLogs[i].operator)
+		}
+		if s, _ := l.Status(); s != wantStatus[i] {
+			t.Errorf("#%d: Status()=%s, want %s", i, s, wantStatus[i])
+		}
+		if _, err := l.PublicKey(); err != nil {
+			t.Errorf("#%d: PublicKey()=_,%v", i, err)
+		}
+		if l.MMDDuration() != 24*time.Hour {
+			t.Errorf("#%d: MMDDuration()=%s, want 24h", i, l.MMDDuration())
+		}
+		if ll.FindLogByURL(l.URL) != l {
+			t.Errorf("#%d: FindLogByURL() didn't find log", i)
+		}
+	}
+	if ll.FindLogByID([sha256.Size]byte{}) != nil || ll.FindLogByURL("https://unknown/") != nil {
+		t.Error("Found unknown log")
+	}
+
+	if _, err := NewFromJSON([]byte("{")); err == nil {
+		t.Error("NewFromJSON(invalid)=_,nil, want error")
+	}
+	mismatched := strings.Replace(string(b), base64.StdEncoding.EncodeToString(ids[0][:]), base64.StdEncoding.EncodeToString(ids[1][:]), 1)
+	if _, err := NewFromJSON([]byte(mismatched)); err == nil {
+		t.Error("NewFromJSON(mismatched log_id)=_,nil, want error")
+	}
+}
+
+func TestAcceptsExpiry(t *testing.T) {
+	b, ids := testLogListJSON(t, "2021-06-01T00:00:00Z")
+	ll, err := NewFromJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharded, unsharded := ll.FindLogByID(ids[2]), ll.FindLogByID(ids[0])
+	tests := []struct {
+		notAfter string
+		want     bool
+	}{
+		{"2024-12-31T23:59:59Z", false},
+		{"2025-01-01T00:00:00Z", true},
+		{"2025-06-30T23:59:59Z", true},
+		{"2025-07-01T00:00:00Z", false},
+	}
+	for i, test := range tests {
+		notAfter, _ := time.Parse(time.RFC3339, test.notAfter)
+		if got := sharded.AcceptsExpiry(notAfter); got != test.want {
+			t.Errorf("#%d: AcceptsExpiry(%s)=%t, want %t", i, test.notAfter, got, test.want)
+		}
+		if !unsharded.AcceptsExpiry(notAfter) {
+			t.Errorf("#%d: unsharded log doesn't accept %s", i, test.notAfter)
+		}
+	}
+}
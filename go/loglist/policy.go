@@ -0,0 +1,82 @@
+package loglist
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+)
+
+// Certificates valid for longer than this need an extra SCT under Chrome's
+// CT policy.
+const chromeShortLifetime = 180 * 24 * time.Hour
+
+// countsForEmbedded reports whether an SCT issued by l at sctTime counts
+// towards the policy for embedded SCTs: the log must be usable or have been
+// frozen since, or have been retired after issuing it.
+func (l *Log) countsForEmbedded(sctTime time.Time) bool {
+	switch status, since := l.Status(); status {
+	case QualifiedStatus, UsableStatus, ReadOnlyStatus:
+		return true
+	case RetiredStatus:
+		return sctTime.Before(since)
+	}
+	return false
+}
+
+// countsForDelivered reports whether an SCT issued by l counts towards the
+// policy for SCTs delivered in the TLS handshake or an OCSP response, for
+// which the log must currently be accepting certificates.
+func (l *Log) countsForDelivered() bool {
+	switch status, _ := l.Status(); status {
+	case QualifiedStatus, UsableStatus:
+		return true
+	}
+	return false
+}
+
+// ChromePolicyError describes why a set of SCTs doesn't satisfy Chrome's CT
+// policy.
+type ChromePolicyError struct {
+	Required, Counted int // Number of SCTs from distinct logs.
+	Operators         int // Number of distinct operators of those logs.
+}
+
+func (e ChromePolicyError) Error() string {
+	return fmt.Sprintf("SCTs don't satisfy Chrome CT policy: %d of %d required SCTs from distinct logs, from %d of 2 required operators", e.Counted, e.Required, e.Operators)
+}
+
+// CheckChromePolicy checks whether scts satisfy Chrome's CT policy for a
+// certificate valid from notBefore to notAfter, according to the log states
+// in the list.  If embedded is set, the SCTs are embedded in the certificate;
+// otherwise they are delivered in the TLS handshake or an OCSP response.
+//
+// Each log counts at most once.  Embedded SCTs are required from two logs, or
+// three if the certificate is valid for more than 180 days; delivered SCTs
+// are required from two logs.  Either way the logs must be run by at least
+// two operators.  SCTs from logs which aren't in the list don't count, and
+// their signatures are assumed to have been verified already.
+func (ll *LogList) CheckChromePolicy(scts []*ct.SignedCertificateTimestamp, notBefore, notAfter time.Time, embedded bool) error {
+	required := 2
+	if embedded && notAfter.Sub(notBefore) > chromeShortLifetime {
+		required = 3
+	}
+	logs := make(map[*Log]bool)
+	operators := make(map[string]bool)
+	for _, sct := range scts {
+		l := ll.FindLogByID(sct.LogID)
+		if l == nil || logs[l] {
+			continue
+		}
+		if embedded && !l.countsForEmbedded(ct.TimestampToTime(sct.Timestamp)) ||
+			!embedded && !l.countsForDelivered() {
+			continue
+		}
+		logs[l] = true
+		operators[l.Operator] = true
+	}
+	if len(logs) < required || len(operators) < 2 {
+		return ChromePolicyError{Required: required, Counted: len(logs), Operators: len(operators)}
+	}
+	return nil
+}
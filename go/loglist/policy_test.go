@@ -0,0 +1,63 @@
+package loglist
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+)
+
+func TestCheckChromePolicy(t *testing.T) {
+	b, ids := testLogListJSON(t, "2021-06-01T00:00:00Z")
+	ll, err := NewFromJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	beforeRetirement := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	afterRetirement := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	sct := func(log int, at time.Time) *ct.SignedCertificateTimestamp {
+		s := &ct.SignedCertificateTimestamp{Timestamp: uint64(at.UnixNano() / int64(time.Millisecond))}
+		if log >= 0 {
+			s.LogID = ids[log]
+		}
+		return s
+	}
+	notBefore := beforeRetirement
+	short, long := notBefore.Add(90*24*time.Hour), notBefore.Add(365*24*time.Hour)
+
+	tests := []struct {
+		scts     []*ct.SignedCertificateTimestamp
+		notAfter time.Time
+		embedded bool
+		want     bool
+	}{
+		{[]*ct.SignedCertificateTimestamp{sct(0, notBefore), sct(2, notBefore)}, short, true, true},
+		// A longer lived certificate needs another SCT.
+		{[]*ct.SignedCertificateTimestamp{sct(0, notBefore), sct(2, notBefore)}, long, true, false},
+		{[]*ct.SignedCertificateTimestamp{sct(0, notBefore), sct(2, notBefore), sct(3, notBefore)}, long, true, true},
+		// SCTs must come from two operators.
+		{[]*ct.SignedCertificateTimestamp{sct(2, notBefore), sct(3, notBefore)}, short, true, false},
+		// The same log only counts once.
+		{[]*ct.SignedCertificateTimestamp{sct(0, notBefore), sct(0, notBefore), sct(2, notBefore)}, long, true, false},
+		// Retired logs count for SCTs issued before their retirement.
+		{[]*ct.SignedCertificateTimestamp{sct(1, beforeRetirement), sct(2, notBefore)}, short, true, true},
+		{[]*ct.SignedCertificateTimestamp{sct(1, afterRetirement), sct(2, notBefore)}, short, true, false},
+		// Pending and unknown logs don't count.
+		{[]*ct.SignedCertificateTimestamp{sct(0, notBefore), sct(4, notBefore)}, short, true, false},
+		{[]*ct.SignedCertificateTimestamp{sct(0, notBefore), sct(-1, notBefore)}, short, true, false},
+		// Delivered SCTs need only two, but from logs accepting
+		// certificates.
+		{[]*ct.SignedCertificateTimestamp{sct(0, notBefore), sct(2, notBefore)}, long, false, true},
+		{[]*ct.SignedCertificateTimestamp{sct(0, notBefore), sct(3, notBefore)}, long, false, false},
+		{[]*ct.SignedCertificateTimestamp{sct(1, beforeRetirement), sct(2, notBefore)}, short, false, false},
+	}
+	for i, test := range tests {
+		err := ll.CheckChromePolicy(test.scts, notBefore, test.notAfter, test.embedded)
+		if got := err == nil; got != test.want {
+			t.Errorf("#%d: CheckChromePolicy()=%v, want compliant: %t", i, err, test.want)
+		}
+		if _, ok := err.(ChromePolicyError); err != nil && !ok {
+			t.Errorf("#%d: CheckChromePolicy() error %v isn't a ChromePolicyError", i, err)
+		}
+	}
+}
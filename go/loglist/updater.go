@@ -0,0 +1,234 @@
+package loglist
+
+import (
+	"crypto"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// VerifySignature checks that sig is a signature of a log list's JSON by key,
+// which is RSA (PKCS#1 v1.5) or ECDSA, with SHA-256, or Ed25519, as published
+// alongside the list, e.g. at
+// https://www.gstatic.com/ct/log_list/v3/log_list.sig.
+func VerifySignature(key crypto.PublicKey, json, sig []byte) error {
+	v, err := ct.NewLogVerifier(key)
+	if err != nil {
+		return fmt.Errorf("unsupported log list signing key: %v", err)
+	}
+	if err := v.VerifyImplicit(json, sig); err != nil {
+		return fmt.Errorf("failed to verify log list signature: %v", err)
+	}
+	return nil
+}
+
+// LogChange records that a log's state differs between two lists.  A log
+// added to the list changes from UnknownStatus, and one removed from it
+// changes to UnknownStatus, in which case Log is its entry in the old list.
+type LogChange struct {
+	Log      *Log
+	Old, New Status
+}
+
+// Updater keeps a LogList up to date with one published at a URL, whose
+// signature is verified before it is used.  It is safe for concurrent use.
+type Updater struct {
+	client          *http.Client
+	listURL, sigURL string
+	key             crypto.PublicKey
+
+	// Held throughout an update, so that changes are queued in order.
+	updateMu sync.Mutex
+
+	// Guards the subscribers and the changes queued for them.  Changes
+	// are delivered by one Update at a time, without holding a lock, so
+	// that subscribers can call the Updater.
+	notifyMu    sync.Mutex
+	subscribers []func([]LogChange)
+	pending     [][]LogChange
+	notifying   bool
+
+	mu   sync.RWMutex
+	list *LogList
+}
+
+// maxListSize is the largest log list, or signature, which Update fetches.
+const maxListSize = 10 << 20
+
+// NewUpdater returns an Updater which fetches the list from listURL and its
+// signature by key from sigURL, using client, or http.DefaultClient if client
+// is nil.  No list is fetched until Update or Run is called.
+func NewUpdater(listURL, sigURL string, key crypto.PublicKey, client *http.Client) *Updater {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Updater{client: client, listURL: listURL, sigURL: sigURL, key: key}
+}
+
+// List returns the most recently fetched list, or nil if none has been.
+func (u *Updater) List() *LogList {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.list
+}
+
+// Subscribe arranges for f to be called with the changes in log states each
+// time Update replaces the list with one in which any log's state differs.
+// The first list fetched isn't compared with anything, so doesn't call f.
+// Calls are made one at a time, in the order of the updates, but may be made
+// by a concurrent Update after the one which fetched the list returns.  f may
+// call the Updater's methods.
+func (u *Updater) Subscribe(f func([]LogChange)) {
+	u.notifyMu.Lock()
+	defer u.notifyMu.Unlock()
+	u.subscribers = append(u.subscribers, f)
+}
+
+// Changes returns the logs whose states differ between old and new, matching
+// logs by their IDs.
+func Changes(old, new *LogList) []LogChange {
+	oldLogs := make(map[string]*Log)
+	for _, l := range old.Logs() {
+		oldLogs[string(l.LogID)] = l
+	}
+	var changes []LogChange
+	for _, l := range new.Logs() {
+		was := UnknownStatus
+		if ol, ok := oldLogs[string(l.LogID)]; ok {
+			was, _ = ol.Status()
+			delete(oldLogs, string(l.LogID))
+		}
+		if s, _ := l.Status(); s != was {
+			changes = append(changes, LogChange{Log: l, Old: was, New: s})
+		}
+	}
+	for _, l := range old.Logs() {
+		if _, ok := oldLogs[string(l.LogID)]; !ok {
+			continue
+		}
+		if s, _ := l.Status(); s != UnknownStatus {
+			changes = append(changes, LogChange{Log: l, Old: s, New: UnknownStatus})
+		}
+	}
+	return changes
+}
+
+func (u *Updater) fetch(ctx context.Context, url string) ([]byte, error) {
+	resp, err := ctxhttp.Get(ctx, u.client, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxListSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: got HTTP Status %s", url, resp.Status)
+	}
+	if len(body) > maxListSize {
+		return nil, fmt.Errorf("%s: response is larger than %d bytes", url, maxListSize)
+	}
+	return body, nil
+}
+
+// Update fetches the list and, if its signature verifies and it isn't older
+// than the current list, replaces the current list with it, then notifies
+// subscribers of any changes in log states.  If it fails, the current list is
+// kept.
+func (u *Updater) Update(ctx context.Context) error {
+	if err := u.update(ctx); err != nil {
+		return err
+	}
+	u.notify()
+	return nil
+}
+
+// update replaces the list, as Update does, and queues the changes for the
+// subscribers.
+func (u *Updater) update(ctx context.Context) error {
+	u.updateMu.Lock()
+	defer u.updateMu.Unlock()
+	json, err := u.fetch(ctx, u.listURL)
+	if err != nil {
+		return err
+	}
+	sig, err := u.fetch(ctx, u.sigURL)
+	if err != nil {
+		return err
+	}
+	if err := VerifySignature(u.key, json, sig); err != nil {
+		return err
+	}
+	ll, err := NewFromJSON(json)
+	if err != nil {
+		return err
+	}
+
+	// Only update replaces the list, so it can be read without u.mu here.
+	old := u.list
+	if old != nil && ll.Timestamp.Before(old.Timestamp) {
+		return fmt.Errorf("fetched log list from %s is older than the current one", ll.Timestamp)
+	}
+	u.mu.Lock()
+	u.list = ll
+	u.mu.Unlock()
+
+	if old == nil {
+		return nil
+	}
+	if changes := Changes(old, ll); len(changes) > 0 {
+		u.notifyMu.Lock()
+		u.pending = append(u.pending, changes)
+		u.notifyMu.Unlock()
+	}
+	return nil
+}
+
+// notify delivers the queued changes to the subscribers, unless another call
+// is already doing so, in which case that call delivers them after those it
+// is delivering.
+func (u *Updater) notify() {
+	u.notifyMu.Lock()
+	if u.notifying {
+		u.notifyMu.Unlock()
+		return
+	}
+	u.notifying = true
+	for len(u.pending) > 0 {
+		changes := u.pending[0]
+		u.pending = u.pending[1:]
+		subscribers := append([]func([]LogChange){}, u.subscribers...)
+		u.notifyMu.Unlock()
+		for _, f := range subscribers {
+			f(changes)
+		}
+		u.notifyMu.Lock()
+	}
+	u.notifying = false
+	u.notifyMu.Unlock()
+}
+
+// Run calls Update every interval until ctx is done, logging failures.
+func (u *Updater) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := u.Update(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to update log list from %s: %v", u.listURL, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
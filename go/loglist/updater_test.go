@@ -0,0 +1,255 @@
+package loglist
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"golang.org/x/net/context"
+)
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, data []byte) []byte {
+	h := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestUpdater(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list, sig []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/log_list.json":
+			w.Write(list)
+		case "/log_list.sig":
+			w.Write(sig)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	u := NewUpdater(ts.URL+"/log_list.json", ts.URL+"/log_list.sig", &key.PublicKey, nil)
+	ctx := context.Background()
+
+	if u.List() != nil {
+		t.Fatal("List() before Update()=non-nil")
+	}
+	list, _ = testLogListJSON(t, "2021-06-01T00:00:00Z")
+	sig = sign(t, key, list)
+	if err := u.Update(ctx); err != nil {
+		t.Fatalf("Update()=%v", err)
+	}
+	first := u.List()
+	if first == nil || len(first.Logs()) != len(testLogs) {
+		t.Fatalf("List()=%+v after Update(), want list of %d logs", first, len(testLogs))
+	}
+
+	tests := []struct {
+		desc      string
+		timestamp string
+		badSig    bool
+		wantErr   bool
+	}{
+		{"bad signature", "2021-07-01T00:00:00Z", true, true},
+		{"older list", "2021-05-01T00:00:00Z", false, true},
+		{"newer list", "2021-07-01T00:00:00Z", false, false},
+	}
+	for _, test := range tests {
+		before := u.List()
+		list, _ = testLogListJSON(t, test.timestamp)
+		sig = sign(t, key, list)
+		if test.badSig {
+			sig = sign(t, key, []byte("something else"))
+		}
+		err := u.Update(ctx)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: Update()=%v, want error: %t", test.desc, err, test.wantErr)
+		}
+		if kept := u.List() == before; kept != test.wantErr {
+			t.Errorf("%s: list kept: %t, want %t", test.desc, kept, test.wantErr)
+		}
+	}
+
+	before := u.List()
+	list = append(bytes.Repeat([]byte(" "), maxListSize), list...)
+	sig = sign(t, key, list)
+	if err := u.Update(ctx); err == nil || u.List() != before {
+		t.Errorf("Update() of list larger than %d bytes=%v, want error", maxListSize, err)
+	}
+
+	u = NewUpdater(ts.URL+"/missing.json", ts.URL+"/log_list.sig", &key.PublicKey, nil)
+	if err := u.Update(ctx); err == nil || u.List() != nil {
+		t.Errorf("Update() of missing list=%v, want error", err)
+	}
+}
+
+func TestUpdaterSubscribe(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/log_list.sig" {
+			w.Write(sign(t, key, list))
+			return
+		}
+		w.Write(list)
+	}))
+	defer ts.Close()
+	u := NewUpdater(ts.URL+"/log_list.json", ts.URL+"/log_list.sig", &key.PublicKey, nil)
+	var got [][]LogChange
+	u.Subscribe(func(changes []LogChange) { got = append(got, changes) })
+	ctx := context.Background()
+
+	first, _ := testLogListJSON(t, "2021-06-01T00:00:00Z")
+	// google1 is retired, and third1 leaves the list.
+	second := bytes.Replace(first, []byte(`{"usable": {"timestamp": "2019-01-01T00:00:00Z"}}`), []byte(`{"retired": {"timestamp": "2021-07-01T00:00:00Z"}}`), 1)
+	var ll LogList
+	if err := json.Unmarshal(second, &ll); err != nil {
+		t.Fatal(err)
+	}
+	ll.Timestamp = ll.Timestamp.Add(time.Hour)
+	ll.Operators = ll.Operators[:len(ll.Operators)-1]
+	if second, err = json.Marshal(&ll); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, update := range []struct {
+		desc string
+		list []byte
+		want []LogChange
+	}{
+		{"first list", first, nil},
+		{"same list", first, nil},
+		{"changed list", second, []LogChange{
+			{Log: &Log{URL: "https://google1/"}, Old: UsableStatus, New: RetiredStatus},
+			{Log: &Log{URL: "https://third1/"}, Old: PendingStatus, New: UnknownStatus},
+		}},
+	} {
+		got = nil
+		list = update.list
+		if err := u.Update(ctx); err != nil {
+			t.Fatalf("%s: Update()=%v", update.desc, err)
+		}
+		if update.want == nil {
+			if len(got) != 0 {
+				t.Errorf("%s: subscriber called with %+v, want no calls", update.desc, got)
+			}
+			continue
+		}
+		if len(got) != 1 || len(got[0]) != len(update.want) {
+			t.Fatalf("%s: subscriber called with %+v, want one call with %d changes", update.desc, got, len(update.want))
+		}
+		for i, c := range got[0] {
+			want := update.want[i]
+			if c.Log.URL != want.Log.URL || c.Old != want.Old || c.New != want.New {
+				t.Errorf("%s: change %d is %s from %s to %s, want %s from %s to %s", update.desc, i, c.Log.URL, c.Old, c.New, want.Log.URL, want.Old, want.New)
+			}
+		}
+	}
+}
+
+func TestUpdaterSubscriberCallsUpdater(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var list []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/log_list.sig" {
+			w.Write(sign(t, key, list))
+			return
+		}
+		w.Write(list)
+	}))
+	defer ts.Close()
+	setList := func(timestamp string) {
+		mu.Lock()
+		defer mu.Unlock()
+		list, _ = testLogListJSON(t, timestamp)
+	}
+	u := NewUpdater(ts.URL+"/log_list.json", ts.URL+"/log_list.sig", &key.PublicKey, nil)
+	ctx := context.Background()
+
+	// The first subscriber, when first called, subscribes another and
+	// updates the list again, whose changes are delivered once it
+	// returns.
+	var calls []string
+	u.Subscribe(func([]LogChange) {
+		calls = append(calls, "first")
+		if len(calls) > 1 {
+			return
+		}
+		u.Subscribe(func([]LogChange) { calls = append(calls, "second") })
+		setList("2021-06-03T00:00:00Z")
+		if err := u.Update(ctx); err != nil {
+			t.Errorf("Update() from subscriber=%v", err)
+		}
+		if len(calls) != 1 {
+			t.Errorf("Update() from subscriber made calls %v before returning", calls)
+		}
+	})
+	setList("2021-06-01T00:00:00Z")
+	if err := u.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	setList("2021-06-02T00:00:00Z")
+
+	done := make(chan error, 1)
+	go func() { done <- u.Update(ctx) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Update()=%v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Update() deadlocked")
+	}
+	if want := []string{"first", "first", "second"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("subscribers called %v, want %v", calls, want)
+	}
+	if got := u.List().Timestamp; !got.Equal(time.Date(2021, 6, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("List() is from %s, want the list the subscriber fetched", got)
+	}
+}
+
+func TestVerifySignatureEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json := []byte(`{"operators": []}`)
+	sig := ed25519.Sign(priv, json)
+	if err := VerifySignature(pub, json, sig); err != nil {
+		t.Errorf("VerifySignature()=%v", err)
+	}
+	if err := VerifySignature(pub, []byte(`{}`), sig); err == nil {
+		t.Error("VerifySignature() succeeded for other JSON")
+	}
+}
@@ -0,0 +1,154 @@
+package merkle
+
+import "fmt"
+
+// CompactRange holds the root hashes of the perfect subtrees which make up a
+// range of leaves [begin, end) of a tree, from the leftmost to the rightmost,
+// which is all that is needed to keep appending leaves to it, to merge it with
+// the range which follows it, and, for a range starting at leaf zero, to
+// compute the root hash of the tree of its leaves.  A range of n leaves has at
+// most two subtrees of each size, so a CompactRange uses O(log n) memory.
+//
+// For a range starting at zero, the subtrees are one for each bit set in its
+// size, from the largest to the smallest.  Ranges which don't start at zero
+// let large ranges of a tree be hashed in pieces, e.g. in parallel or from
+// cached tiles, and merged together.
+type CompactRange struct {
+	hasher *TreeHasher
+	begin  uint64
+	end    uint64
+	hashes [][]byte
+}
+
+// NodeID identifies a node of a tree: the root of the perfect subtree of
+// 2^Level leaves starting at leaf Index*2^Level.
+type NodeID struct {
+	Level uint
+	Index uint64
+}
+
+// NewCompactRange returns a CompactRange for an empty tree which hashes with
+// hasher.
+func NewCompactRange(hasher *TreeHasher) *CompactRange {
+	return &CompactRange{hasher: hasher}
+}
+
+// NewCompactRangeAt returns an empty CompactRange starting at leaf begin,
+// which hashes with hasher.
+func NewCompactRangeAt(hasher *TreeHasher, begin uint64) *CompactRange {
+	return &CompactRange{hasher: hasher, begin: begin, end: begin}
+}
+
+// NewCompactRangeFromHashes returns a CompactRange for the tree of size size
+// whose perfect subtrees have the root hashes hashes, e.g. as returned by
+// Hashes, so that a tree can be resumed without its leaves.
+func NewCompactRangeFromHashes(hasher *TreeHasher, size uint64, hashes [][]byte) (*CompactRange, error) {
+	return NewCompactSubrange(hasher, 0, size, hashes)
+}
+
+// NewCompactSubrange returns a CompactRange for the leaves [begin, end) whose
+// perfect subtrees, those returned by Nodes, have the root hashes hashes.
+func NewCompactSubrange(hasher *TreeHasher, begin, end uint64, hashes [][]byte) (*CompactRange, error) {
+	if begin > end {
+		return nil, fmt.Errorf("merkle: range begin %d > end %d", begin, end)
+	}
+	if want := len(rangeNodes(begin, end)); len(hashes) != want {
+		return nil, fmt.Errorf("merkle: range [%d, %d) has %d perfect subtrees, got %d hashes", begin, end, want, len(hashes))
+	}
+	c := &CompactRange{hasher: hasher, begin: begin, end: end, hashes: make([][]byte, len(hashes))}
+	copy(c.hashes, hashes)
+	return c, nil
+}
+
+// rangeNodes returns the nodes of the perfect subtrees making up the leaves
+// [begin, end), from left to right.  Going from begin, each subtree is the
+// largest which starts there and doesn't go past end.
+func rangeNodes(begin, end uint64) []NodeID {
+	var nodes []NodeID
+	for begin < end {
+		level := uint(0)
+		for level < 63 && begin&(1<<level) == 0 && begin+(2<<level) <= end {
+			level++
+		}
+		nodes = append(nodes, NodeID{Level: level, Index: begin >> level})
+		begin += 1 << level
+	}
+	return nodes
+}
+
+// Begin returns the index of the first leaf in the range.
+func (c *CompactRange) Begin() uint64 {
+	return c.begin
+}
+
+// End returns the index of the leaf after the last in the range.
+func (c *CompactRange) End() uint64 {
+	return c.end
+}
+
+// Size returns the number of leaves in the range, which for a range starting
+// at zero is the size of the tree.
+func (c *CompactRange) Size() uint64 {
+	return c.end - c.begin
+}
+
+// Hashes returns the root hashes of the range's perfect subtrees, from left to
+// right, which for a range starting at zero is from the largest to the
+// smallest.
+func (c *CompactRange) Hashes() [][]byte {
+	hashes := make([][]byte, len(c.hashes))
+	copy(hashes, c.hashes)
+	return hashes
+}
+
+// Nodes returns the nodes whose hashes Hashes returns, e.g. to cache them.
+func (c *CompactRange) Nodes() []NodeID {
+	return rangeNodes(c.begin, c.end)
+}
+
+// Append adds the leaf with hash leafHash to the end of the range.
+func (c *CompactRange) Append(leafHash []byte) {
+	c.appendNode(0, leafHash)
+}
+
+// appendNode adds the perfect subtree of 2^level leaves starting at the end of
+// the range, which must be a multiple of its size, with root hash hash.
+func (c *CompactRange) appendNode(level uint, hash []byte) {
+	node := c.end >> level
+	c.end += 1 << level
+	// While the subtree is a right child whose sibling is in the range, the
+	// sibling is the last subtree added, and they merge.
+	for isRightChild(node) && (node-1)<<level >= c.begin {
+		n := len(c.hashes)
+		hash = c.hasher.HashChildren(c.hashes[n-1], hash)
+		c.hashes = c.hashes[:n-1]
+		node = parent(node)
+		level++
+	}
+	c.hashes = append(c.hashes, hash)
+}
+
+// Merge appends other, the range which immediately follows c, to c.
+func (c *CompactRange) Merge(other *CompactRange) error {
+	if other.begin != c.end {
+		return fmt.Errorf("merkle: can't merge range [%d, %d) onto [%d, %d)", other.begin, other.end, c.begin, c.end)
+	}
+	for i, node := range other.Nodes() {
+		c.appendNode(node.Level, other.hashes[i])
+	}
+	return nil
+}
+
+// Root returns the root hash of the tree of the range's leaves.  It is only
+// the root hash of a tree of a log if the range starts at zero; merge other
+// ranges onto one which does to get it.
+func (c *CompactRange) Root() []byte {
+	if len(c.hashes) == 0 {
+		return c.hasher.EmptyRoot()
+	}
+	root := c.hashes[len(c.hashes)-1]
+	for i := len(c.hashes) - 2; i >= 0; i-- {
+		root = c.hasher.HashChildren(c.hashes[i], root)
+	}
+	return root
+}
@@ -0,0 +1,111 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestCompactRange(t *testing.T) {
+	hasher := NewSHA256TreeHasher()
+	c := NewCompactRange(hasher)
+	if !bytes.Equal(c.Root(), hasher.EmptyRoot()) {
+		t.Errorf("Root() of empty range=%x, want the empty root", c.Root())
+	}
+	for i, leaf := range testLeaves {
+		c.Append(hasher.HashLeaf(leaf))
+		if !bytes.Equal(c.Root(), testRoots[i]) {
+			t.Errorf("Root() after %d leaves=%x, want %x", i+1, c.Root(), testRoots[i])
+		}
+		// There is one hash for each bit set in the size.
+		want := 0
+		for s := c.Size(); s > 0; s >>= 1 {
+			want += int(s & 1)
+		}
+		if got := len(c.Hashes()); got != want {
+			t.Errorf("%d leaves have %d hashes, want %d", i+1, got, want)
+		}
+	}
+	if c.Size() != uint64(len(testLeaves)) {
+		t.Errorf("Size()=%d, want %d", c.Size(), len(testLeaves))
+	}
+}
+
+func TestNewCompactRangeFromHashes(t *testing.T) {
+	hasher := NewSHA256TreeHasher()
+	c := NewCompactRange(hasher)
+	for _, leaf := range testLeaves[:5] {
+		c.Append(hasher.HashLeaf(leaf))
+	}
+	resumed, err := NewCompactRangeFromHashes(hasher, c.Size(), c.Hashes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, leaf := range testLeaves[5:] {
+		resumed.Append(hasher.HashLeaf(leaf))
+		if want := testRoots[5+i]; !bytes.Equal(resumed.Root(), want) {
+			t.Errorf("Root() of resumed range of size %d=%x, want %x", resumed.Size(), resumed.Root(), want)
+		}
+	}
+	if _, err := NewCompactRangeFromHashes(hasher, 5, c.Hashes()[:1]); err == nil {
+		t.Error("NewCompactRangeFromHashes(wrong number of hashes)=_,nil, want error")
+	}
+}
+
+func TestCompactRangeMerge(t *testing.T) {
+	hasher := NewSHA256TreeHasher()
+	tree := NewMerkleTree(hasher)
+	const size = 21
+	for i := 0; i < size; i++ {
+		tree.AddLeaf([]byte(fmt.Sprintf("leaf %d", i)))
+	}
+	leafRange := func(begin, end uint64) *CompactRange {
+		r := NewCompactRangeAt(hasher, begin)
+		for i := begin; i < end; i++ {
+			h, err := tree.LeafHash(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Append(h)
+		}
+		return r
+	}
+
+	for mid := uint64(0); mid <= size; mid++ {
+		for end := mid; end <= size; end++ {
+			r := leafRange(0, mid)
+			other := leafRange(mid, end)
+			// Each node's hash is the root hash of its subtree.
+			for i, node := range other.Nodes() {
+				want := tree.subtreeHash(node.Index<<node.Level, 1<<node.Level)
+				if got := other.Hashes()[i]; !bytes.Equal(got, want) {
+					t.Errorf("[%d, %d): hash of node %+v=%x, want %x", mid, end, node, got, want)
+				}
+			}
+			if err := r.Merge(other); err != nil {
+				t.Fatalf("Merge([%d, %d))=%v", mid, end, err)
+			}
+			want, err := tree.RootAtSnapshot(end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.End() != end || !bytes.Equal(r.Root(), want) {
+				t.Errorf("[0, %d)+[%d, %d): End()=%d, Root()=%x, want %d, %x", mid, mid, end, r.End(), r.Root(), end, want)
+			}
+		}
+	}
+
+	if err := leafRange(0, 3).Merge(leafRange(4, 5)); err == nil {
+		t.Error("Merge(range not following)=nil, want error")
+	}
+	r := leafRange(5, 11)
+	if _, err := NewCompactSubrange(hasher, 5, 11, r.Hashes()); err != nil {
+		t.Errorf("NewCompactSubrange(Hashes())=_,%v, want no error", err)
+	}
+	if _, err := NewCompactSubrange(hasher, 5, 11, r.Hashes()[1:]); err == nil {
+		t.Error("NewCompactSubrange(too few hashes)=_,nil, want error")
+	}
+	if _, err := NewCompactSubrange(hasher, 6, 5, nil); err == nil {
+		t.Error("NewCompactSubrange(begin > end)=_,nil, want error")
+	}
+}
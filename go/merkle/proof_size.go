@@ -0,0 +1,42 @@
+package merkle
+
+// InclusionProofSize returns the number of hashes in the inclusion proof for
+// the leaf at index leafIndex of the tree of size treeSize, which is useful
+// when a proof is fetched a few hashes at a time.  leafIndex must be less
+// than treeSize.
+func InclusionProofSize(leafIndex, treeSize uint64) int {
+	size := 0
+	for node, lastNode := leafIndex, treeSize-1; lastNode > 0; node, lastNode = parent(node), parent(lastNode) {
+		if isRightChild(node) || node < lastNode {
+			size++
+		}
+	}
+	return size
+}
+
+// ConsistencyProofSize returns the number of hashes in the consistency proof
+// between the trees of sizes snapshot1 and snapshot2, where snapshot1 is no
+// greater than snapshot2.
+func ConsistencyProofSize(snapshot1, snapshot2 uint64) int {
+	if snapshot1 == 0 || snapshot1 == snapshot2 {
+		return 0
+	}
+	// This follows VerifyConsistency.
+	node, lastNode := snapshot1-1, snapshot2-1
+	for isRightChild(node) {
+		node, lastNode = parent(node), parent(lastNode)
+	}
+	size := 0
+	if node > 0 {
+		size++
+	}
+	for ; node > 0; node, lastNode = parent(node), parent(lastNode) {
+		if isRightChild(node) || node < lastNode {
+			size++
+		}
+	}
+	for ; lastNode > 0; lastNode = parent(lastNode) {
+		size++
+	}
+	return size
+}
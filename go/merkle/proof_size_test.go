@@ -0,0 +1,27 @@
+package merkle
+
+import "testing"
+
+func TestInclusionProofSize(t *testing.T) {
+	for i, p := range inclusionProofs {
+		if got, want := InclusionProofSize(p.leafIndex, p.treeSize), len(p.proof); got != want {
+			t.Errorf("#%d: InclusionProofSize(%d, %d)=%d, want %d", i, p.leafIndex, p.treeSize, got, want)
+		}
+	}
+	if got := InclusionProofSize(0, 1); got != 0 {
+		t.Errorf("InclusionProofSize(0, 1)=%d, want 0", got)
+	}
+}
+
+func TestConsistencyProofSize(t *testing.T) {
+	for i, p := range consistencyProofs {
+		if got, want := ConsistencyProofSize(p.snapshot1, p.snapshot2), len(p.proof); got != want {
+			t.Errorf("#%d: ConsistencyProofSize(%d, %d)=%d, want %d", i, p.snapshot1, p.snapshot2, got, want)
+		}
+	}
+	for _, s := range [][2]uint64{{0, 5}, {5, 5}} {
+		if got := ConsistencyProofSize(s[0], s[1]); got != 0 {
+			t.Errorf("ConsistencyProofSize(%d, %d)=%d, want 0", s[0], s[1], got)
+		}
+	}
+}
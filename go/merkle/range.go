@@ -0,0 +1,156 @@
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// RangeVerifier checks that a contiguous range of leaves are the leaves at
+// those indices of a tree with a known root hash, taking the leaves one at a
+// time, e.g. as a log's entries are downloaded.  It needs the inclusion proofs
+// of the first and last leaves in the range, and holds O(log n) hashes
+// however long the range is.
+type RangeVerifier struct {
+	v          *Verifier
+	treeSize   uint64
+	root       []byte
+	start      uint64
+	compact    *CompactRange
+	last       []byte   // hash of the last leaf added
+	beforeLast [][]byte // compact range of the leaves before it
+}
+
+// leftHashes returns the hashes in proof, the inclusion proof of the leaf at
+// index leafIndex of the tree of size treeSize, which are of subtrees to the
+// left of the leaf, from the largest to the smallest.  These make up the
+// compact range of the leaves before it.
+func leftHashes(leafIndex, treeSize uint64, proof [][]byte) ([][]byte, error) {
+	var left [][]byte
+	node, lastNode := leafIndex, treeSize-1
+	for ; lastNode > 0; node, lastNode = parent(node), parent(lastNode) {
+		if !isRightChild(node) && node >= lastNode {
+			continue
+		}
+		if len(proof) == 0 {
+			return nil, fmt.Errorf("merkle: proof too short for leaf %d of tree size %d", leafIndex, treeSize)
+		}
+		if isRightChild(node) {
+			left = append([][]byte{proof[0]}, left...)
+		}
+		proof = proof[1:]
+	}
+	if len(proof) != 0 {
+		return nil, fmt.Errorf("merkle: proof too long for leaf %d of tree size %d", leafIndex, treeSize)
+	}
+	return left, nil
+}
+
+// NewRangeVerifier returns a RangeVerifier for leaves from index start of the
+// tree of size treeSize with root hash root.  startProof is the inclusion
+// proof of the leaf at start, which isn't needed if start is zero.  It is
+// only checked once the range is finished.
+func (v *Verifier) NewRangeVerifier(start, treeSize uint64, root []byte, startProof [][]byte) (*RangeVerifier, error) {
+	if start >= treeSize {
+		return nil, fmt.Errorf("merkle: leaf index %d is beyond tree size %d", start, treeSize)
+	}
+	var left [][]byte
+	if start > 0 {
+		var err error
+		if left, err = leftHashes(start, treeSize, startProof); err != nil {
+			return nil, err
+		}
+	}
+	compact, err := NewCompactRangeFromHashes(v.hasher, start, left)
+	if err != nil {
+		return nil, err
+	}
+	return &RangeVerifier{v: v, treeSize: treeSize, root: root, start: start, compact: compact}, nil
+}
+
+// Next returns the index of the next leaf to be added.
+func (r *RangeVerifier) Next() uint64 {
+	return r.compact.End()
+}
+
+// AddLeaf adds the leaf containing data to the range.
+func (r *RangeVerifier) AddLeaf(data []byte) error {
+	return r.AddLeafHash(r.v.hasher.HashLeaf(data))
+}
+
+// AddLeafHash adds the leaf with hash leafHash to the range.
+func (r *RangeVerifier) AddLeafHash(leafHash []byte) error {
+	if r.Next() >= r.treeSize {
+		return fmt.Errorf("merkle: leaf index %d is beyond tree size %d", r.Next(), r.treeSize)
+	}
+	r.beforeLast = r.compact.Hashes()
+	r.last = leafHash
+	r.compact.Append(leafHash)
+	return nil
+}
+
+// Finish checks that the leaves added are those in the tree, given
+// endProof, the inclusion proof of the last leaf added.  The proof may be nil
+// if the range ends at the end of the tree.  ErrProofMismatch is
+// returned if the leaves, or the proofs, don't match the tree's root hash.
+func (r *RangeVerifier) Finish(endProof [][]byte) error {
+	if r.Next() == r.start {
+		return errors.New("merkle: no leaves in range")
+	}
+	if r.Next() == r.treeSize && endProof == nil {
+		if !bytes.Equal(r.compact.Root(), r.root) {
+			return ErrProofMismatch
+		}
+		return nil
+	}
+	// The proof of the last leaf must be from the same tree as the leaves
+	// before it, so its hashes to the left of the leaf must be those
+	// computed from them.  The root hash then covers every leaf.
+	end := r.Next() - 1
+	left, err := leftHashes(end, r.treeSize, endProof)
+	if err != nil {
+		return err
+	}
+	if len(left) != len(r.beforeLast) {
+		return ErrProofMismatch
+	}
+	for i := range left {
+		if !bytes.Equal(left[i], r.beforeLast[i]) {
+			return ErrProofMismatch
+		}
+	}
+	return r.v.VerifyInclusion(end, r.treeSize, r.last, r.root, endProof)
+}
+
+// VerifyCompactRange checks that the leaves of r are those at its indices in
+// the tree of size treeSize with root hash root, so that a range can be hashed
+// in pieces, which are merged and checked at once.  startProof is the
+// inclusion proof of the leaf at r.Begin(), which isn't needed if it is zero,
+// and endProof is the consistency proof between the tree of size r.End() and
+// treeSize, which is empty if they are the same.
+func (v *Verifier) VerifyCompactRange(r *CompactRange, treeSize uint64, root []byte, startProof, endProof [][]byte) error {
+	if r.Size() == 0 {
+		return errors.New("merkle: no leaves in range")
+	}
+	if r.End() > treeSize {
+		return fmt.Errorf("merkle: range end %d is beyond tree size %d", r.End(), treeSize)
+	}
+	var left [][]byte
+	if r.Begin() > 0 {
+		var err error
+		if left, err = leftHashes(r.Begin(), treeSize, startProof); err != nil {
+			return err
+		}
+	}
+	// The hashes before the range needn't be checked: the root hash of the
+	// tree they make up with it is only consistent with root if they are
+	// those of the tree.
+	prefix, err := NewCompactRangeFromHashes(v.hasher, r.Begin(), left)
+	if err != nil {
+		return err
+	}
+	if err := prefix.Merge(r); err != nil {
+		return err
+	}
+	return v.VerifyConsistency(r.End(), treeSize, prefix.Root(), root, endProof)
+}
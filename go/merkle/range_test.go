@@ -0,0 +1,159 @@
+package merkle
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRangeVerifier(t *testing.T) {
+	hasher := NewSHA256TreeHasher()
+	v := NewVerifier(hasher)
+	tree := NewMerkleTree(hasher)
+	const size = 13
+	var leaves [][]byte
+	for i := 0; i < size; i++ {
+		leaves = append(leaves, []byte(fmt.Sprintf("leaf %d", i)))
+		tree.AddLeaf(leaves[i])
+	}
+	root, _ := tree.CurrentRoot()
+	proof := func(leaf uint64) [][]byte {
+		p, err := tree.PathToCurrentRoot(leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	for start := uint64(0); start < size; start++ {
+		for end := start; end < size; end++ {
+			var endProof [][]byte
+			if end < size-1 {
+				endProof = proof(end)
+			}
+			r, err := v.NewRangeVerifier(start, size, root, proof(start))
+			if err != nil {
+				t.Fatalf("NewRangeVerifier(%d)=_,%v", start, err)
+			}
+			for i := start; i <= end; i++ {
+				if err := r.AddLeaf(leaves[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := r.Finish(endProof); err != nil {
+				t.Errorf("Finish() for range [%d, %d]=%v, want nil", start, end, err)
+			}
+
+			// Changing any leaf in the range must be caught.
+			for changed := start; changed <= end; changed++ {
+				r, err := v.NewRangeVerifier(start, size, root, proof(start))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := start; i <= end; i++ {
+					leaf := leaves[i]
+					if i == changed {
+						leaf = []byte("tampered")
+					}
+					r.AddLeaf(leaf)
+				}
+				if err := r.Finish(endProof); err == nil {
+					t.Errorf("Finish() for range [%d, %d] with leaf %d changed=nil, want error", start, end, changed)
+				}
+			}
+		}
+	}
+}
+
+func TestRangeVerifierShiftedRange(t *testing.T) {
+	hasher := NewSHA256TreeHasher()
+	v := NewVerifier(hasher)
+	tree := NewMerkleTree(hasher)
+	for i := 0; i < 8; i++ {
+		tree.AddLeaf([]byte{byte(i)})
+	}
+	root, _ := tree.CurrentRoot()
+	// Leaves 3 to 5 presented as leaves 2 to 4, with their genuine proofs.
+	startProof, _ := tree.PathToCurrentRoot(3)
+	endProof, _ := tree.PathToCurrentRoot(5)
+	r, err := v.NewRangeVerifier(2, 8, root, startProof)
+	if err == nil {
+		for i := 3; i <= 5; i++ {
+			r.AddLeaf([]byte{byte(i)})
+		}
+		err = r.Finish(endProof)
+	}
+	if err == nil {
+		t.Error("RangeVerifier accepted leaves at the wrong indices")
+	}
+}
+
+func TestRangeVerifierErrors(t *testing.T) {
+	v := NewVerifier(NewSHA256TreeHasher())
+	if _, err := v.NewRangeVerifier(4, 4, nil, nil); err == nil {
+		t.Error("NewRangeVerifier(start beyond tree)=_,nil, want error")
+	}
+	if _, err := v.NewRangeVerifier(1, 4, nil, nil); err == nil {
+		t.Error("NewRangeVerifier(missing proof)=_,nil, want error")
+	}
+	r, err := v.NewRangeVerifier(0, 1, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Finish(nil); err == nil {
+		t.Error("Finish(empty range)=nil, want error")
+	}
+	r.AddLeaf(nil)
+	if err := r.AddLeaf(nil); err == nil {
+		t.Error("AddLeaf(beyond tree)=nil, want error")
+	}
+}
+
+func TestVerifyCompactRange(t *testing.T) {
+	hasher := NewSHA256TreeHasher()
+	v := NewVerifier(hasher)
+	tree := NewMerkleTree(hasher)
+	const size = 11
+	for i := 0; i < size; i++ {
+		tree.AddLeaf([]byte(fmt.Sprintf("leaf %d", i)))
+	}
+	root, _ := tree.CurrentRoot()
+
+	for begin := uint64(0); begin < size; begin++ {
+		for end := begin + 1; end <= size; end++ {
+			startProof, err := tree.PathToCurrentRoot(begin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			endProof, err := tree.SnapshotConsistency(end, size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := NewCompactRangeAt(hasher, begin)
+			for i := begin; i < end; i++ {
+				h, _ := tree.LeafHash(i)
+				r.Append(h)
+			}
+			if err := v.VerifyCompactRange(r, size, root, startProof, endProof); err != nil {
+				t.Errorf("VerifyCompactRange([%d, %d))=%v, want nil", begin, end, err)
+			}
+
+			for changed := begin; changed < end; changed++ {
+				r := NewCompactRangeAt(hasher, begin)
+				for i := begin; i < end; i++ {
+					h, _ := tree.LeafHash(i)
+					if i == changed {
+						h = hasher.HashLeaf([]byte("tampered"))
+					}
+					r.Append(h)
+				}
+				if err := v.VerifyCompactRange(r, size, root, startProof, endProof); err == nil {
+					t.Errorf("VerifyCompactRange([%d, %d)) with leaf %d changed=nil, want error", begin, end, changed)
+				}
+			}
+		}
+	}
+
+	if err := v.VerifyCompactRange(NewCompactRangeAt(hasher, 3), size, root, nil, nil); err == nil {
+		t.Error("VerifyCompactRange(empty range)=nil, want error")
+	}
+}
@@ -0,0 +1,107 @@
+package merkle
+
+import (
+	"fmt"
+	"sync"
+)
+
+// TileCache caches the root hashes of a tree's tiles, the perfect subtrees of
+// 2^height leaves starting at multiples of 2^height, so that ranges of the
+// tree which overlap those already hashed, e.g. as an auditor re-verifies
+// a log's entries against each new STH, only need the leaves of the tiles at
+// their ends hashing.  As a log's tree only grows, a tile's hash never
+// changes.  It is safe for concurrent use.
+type TileCache struct {
+	hasher *TreeHasher
+	height uint
+	mu     sync.Mutex
+	tiles  map[uint64][]byte // by tile index
+}
+
+// NewTileCache returns an empty TileCache for tiles of 2^height leaves, which
+// hashes with hasher.
+func NewTileCache(hasher *TreeHasher, height uint) *TileCache {
+	return &TileCache{hasher: hasher, height: height, tiles: make(map[uint64][]byte)}
+}
+
+// LeafHasher returns the hash of the leaf at index.
+type LeafHasher func(index uint64) ([]byte, error)
+
+// Range returns the CompactRange of the leaves [begin, end), taking the hashes
+// of whole tiles from the cache and calling leafHash for the leaves of the
+// rest.  The hashes of whole tiles which aren't cached are added to it, so if
+// the range goes on to fail verification they should be removed with Forget.
+func (t *TileCache) Range(begin, end uint64, leafHash LeafHasher) (*CompactRange, error) {
+	if begin > end {
+		return nil, fmt.Errorf("merkle: range begin %d > end %d", begin, end)
+	}
+	size := uint64(1) << t.height
+	r := NewCompactRangeAt(t.hasher, begin)
+	for r.End() < end {
+		tile := r.End() >> t.height
+		tileEnd := (tile + 1) << t.height
+		if r.End()&(size-1) == 0 && tileEnd <= end {
+			hash, err := t.tileHash(tile, leafHash)
+			if err != nil {
+				return nil, err
+			}
+			r.appendNode(t.height, hash)
+			continue
+		}
+		// Part of a tile, at one end of the range.
+		if tileEnd > end {
+			tileEnd = end
+		}
+		for i := r.End(); i < tileEnd; i++ {
+			hash, err := leafHash(i)
+			if err != nil {
+				return nil, err
+			}
+			r.Append(hash)
+		}
+	}
+	return r, nil
+}
+
+// tileHash returns the root hash of tile, hashing its leaves if it isn't
+// cached.
+func (t *TileCache) tileHash(tile uint64, leafHash LeafHasher) ([]byte, error) {
+	t.mu.Lock()
+	hash, ok := t.tiles[tile]
+	t.mu.Unlock()
+	if ok {
+		return hash, nil
+	}
+	r := NewCompactRangeAt(t.hasher, tile<<t.height)
+	for i := uint64(0); i < 1<<t.height; i++ {
+		h, err := leafHash(r.End())
+		if err != nil {
+			return nil, err
+		}
+		r.Append(h)
+	}
+	hash = r.hashes[0]
+	t.mu.Lock()
+	t.tiles[tile] = hash
+	t.mu.Unlock()
+	return hash, nil
+}
+
+// Forget removes the hashes of the tiles overlapping the leaves [begin, end)
+// from the cache.
+func (t *TileCache) Forget(begin, end uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for tile := range t.tiles {
+		if tile<<t.height < end && (tile+1)<<t.height > begin {
+			delete(t.tiles, tile)
+		}
+	}
+}
+
+// Len returns the number of tiles cached.
+func (t *TileCache) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.tiles)
+}
@@ -0,0 +1,63 @@
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTileCache(t *testing.T) {
+	hasher := NewSHA256TreeHasher()
+	tree := NewMerkleTree(hasher)
+	const size = 40
+	for i := 0; i < size; i++ {
+		tree.AddLeaf([]byte(fmt.Sprintf("leaf %d", i)))
+	}
+	hashed := 0
+	leafHash := func(i uint64) ([]byte, error) {
+		hashed++
+		return tree.LeafHash(i)
+	}
+	c := NewTileCache(hasher, 3)
+
+	for i, test := range []struct {
+		begin, end uint64
+		wantHashed int
+		wantTiles  int
+	}{
+		// Tiles [8, 16), [16, 24) and [24, 32) are cached.
+		{begin: 5, end: 35, wantHashed: 30, wantTiles: 3},
+		// Only the leaves outside them need hashing.
+		{begin: 0, end: 40, wantHashed: 16, wantTiles: 5},
+		{begin: 8, end: 32, wantHashed: 0, wantTiles: 5},
+		{begin: 10, end: 12, wantHashed: 2, wantTiles: 5},
+	} {
+		hashed = 0
+		r, err := c.Range(test.begin, test.end, leafHash)
+		if err != nil {
+			t.Errorf("#%d: Range(%d, %d)=_,%v", i, test.begin, test.end, err)
+			continue
+		}
+		if hashed != test.wantHashed || c.Len() != test.wantTiles {
+			t.Errorf("#%d: Range(%d, %d) hashed %d leaves, leaving %d tiles, want %d, %d", i, test.begin, test.end, hashed, c.Len(), test.wantHashed, test.wantTiles)
+		}
+		want := NewCompactRangeAt(hasher, test.begin)
+		for j := test.begin; j < test.end; j++ {
+			h, _ := tree.LeafHash(j)
+			want.Append(h)
+		}
+		if r.Begin() != test.begin || r.End() != test.end || !bytes.Equal(r.Root(), want.Root()) {
+			t.Errorf("#%d: Range(%d, %d)=[%d, %d) with root %x, want root %x", i, test.begin, test.end, r.Begin(), r.End(), r.Root(), want.Root())
+		}
+	}
+
+	c.Forget(15, 17)
+	if c.Len() != 3 {
+		t.Errorf("Forget(15, 17) left %d tiles, want 3", c.Len())
+	}
+	failed := errors.New("no leaf")
+	if _, err := c.Range(0, 40, func(uint64) ([]byte, error) { return nil, failed }); err != failed {
+		t.Errorf("Range(failing leaf hasher)=_,%v, want %v", err, failed)
+	}
+}
@@ -0,0 +1,181 @@
+package merkle
+
+import "fmt"
+
+// MerkleTree is an in-memory Merkle tree which can generate the inclusion
+// and consistency proofs which Verifier checks, e.g. for test logs or to
+// check a log's entries locally.  It has the same methods as the C++ tree
+// wrapped by the merkletree package, but leaves are indexed from zero, as
+// they are by Verifier.
+//
+// The tree keeps the hash of every perfect subtree, which is less than two
+// hashes per leaf, and no leaf data.  Use a CompactRange instead if only the
+// root hash is needed.
+type MerkleTree struct {
+	hasher *TreeHasher
+	// levels[k][i] is the root hash of the perfect subtree of 2^k leaves
+	// starting at leaf i*2^k.
+	levels  [][][]byte
+	compact *CompactRange
+}
+
+// NewMerkleTree returns an empty MerkleTree which hashes with hasher.
+func NewMerkleTree(hasher *TreeHasher) *MerkleTree {
+	return &MerkleTree{hasher: hasher, compact: NewCompactRange(hasher)}
+}
+
+// LeafCount returns the number of leaves in the tree.
+func (t *MerkleTree) LeafCount() uint64 {
+	return t.compact.Size()
+}
+
+// LevelCount returns the number of levels in the tree, counting the leaves
+// and the root.
+func (t *MerkleTree) LevelCount() uint64 {
+	n := t.LeafCount()
+	if n == 0 {
+		return 0
+	}
+	levels := uint64(1)
+	for ; n > 1; n = (n + 1) / 2 {
+		levels++
+	}
+	return levels
+}
+
+// AddLeaf adds the hash of leaf to the tree and returns its index.
+func (t *MerkleTree) AddLeaf(leaf []byte) uint64 {
+	return t.AddLeafHash(t.hasher.HashLeaf(leaf))
+}
+
+// AddLeafHash adds a leaf with hash hash to the tree and returns its index.
+func (t *MerkleTree) AddLeafHash(hash []byte) uint64 {
+	index := t.LeafCount()
+	t.compact.Append(hash)
+	for k := 0; ; k++ {
+		if k == len(t.levels) {
+			t.levels = append(t.levels, nil)
+		}
+		t.levels[k] = append(t.levels[k], hash)
+		n := len(t.levels[k])
+		if n%2 == 1 {
+			break
+		}
+		hash = t.hasher.HashChildren(t.levels[k][n-2], hash)
+	}
+	return index
+}
+
+// LeafHash returns the hash of the leaf at index leaf.
+func (t *MerkleTree) LeafHash(leaf uint64) ([]byte, error) {
+	if leaf >= t.LeafCount() {
+		return nil, fmt.Errorf("merkle: leaf index %d is beyond tree size %d", leaf, t.LeafCount())
+	}
+	return t.levels[0][leaf], nil
+}
+
+// CurrentRoot returns the root hash of the tree.  It never fails, but
+// returns an error to match the merkletree package.
+func (t *MerkleTree) CurrentRoot() ([]byte, error) {
+	return t.compact.Root(), nil
+}
+
+// RootAtSnapshot returns the root hash of the tree when it had snapshot
+// leaves.
+func (t *MerkleTree) RootAtSnapshot(snapshot uint64) ([]byte, error) {
+	if snapshot > t.LeafCount() {
+		return nil, fmt.Errorf("merkle: snapshot %d is beyond tree size %d", snapshot, t.LeafCount())
+	}
+	if snapshot == 0 {
+		return t.hasher.EmptyRoot(), nil
+	}
+	return t.subtreeHash(0, snapshot), nil
+}
+
+// PathToCurrentRoot returns the inclusion proof for the leaf at index leaf in
+// the current tree.
+func (t *MerkleTree) PathToCurrentRoot(leaf uint64) ([][]byte, error) {
+	return t.PathToRootAtSnapshot(leaf, t.LeafCount())
+}
+
+// PathToRootAtSnapshot returns the inclusion proof for the leaf at index leaf
+// in the tree when it had snapshot leaves (RFC6962 section 2.1.1).
+func (t *MerkleTree) PathToRootAtSnapshot(leaf, snapshot uint64) ([][]byte, error) {
+	if snapshot > t.LeafCount() {
+		return nil, fmt.Errorf("merkle: snapshot %d is beyond tree size %d", snapshot, t.LeafCount())
+	}
+	if leaf >= snapshot {
+		return nil, fmt.Errorf("merkle: leaf index %d is beyond snapshot %d", leaf, snapshot)
+	}
+	return t.inclusionPath(leaf, 0, snapshot), nil
+}
+
+// SnapshotConsistency returns the consistency proof between the tree when it
+// had snapshot1 leaves and when it had snapshot2 (RFC6962 section 2.1.2).
+func (t *MerkleTree) SnapshotConsistency(snapshot1, snapshot2 uint64) ([][]byte, error) {
+	if snapshot1 > snapshot2 {
+		return nil, fmt.Errorf("merkle: snapshot1 (%d) > snapshot2 (%d)", snapshot1, snapshot2)
+	}
+	if snapshot2 > t.LeafCount() {
+		return nil, fmt.Errorf("merkle: snapshot %d is beyond tree size %d", snapshot2, t.LeafCount())
+	}
+	if snapshot1 == 0 || snapshot1 == snapshot2 {
+		return nil, nil
+	}
+	return t.subproof(snapshot1, 0, snapshot2, true), nil
+}
+
+// split returns the largest power of two less than n, which must be at least
+// two.
+func split(n uint64) uint64 {
+	k := uint64(1)
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// subtreeHash returns the root hash of the subtree of size leaves starting at
+// leaf start.  Subtrees are those the RFC6962 hashing algorithm divides the
+// tree into, so if size is a power of two, start is a multiple of it and the
+// hash is stored.
+func (t *MerkleTree) subtreeHash(start, size uint64) []byte {
+	if size&(size-1) == 0 {
+		level := 0
+		for s := size; s > 1; s >>= 1 {
+			level++
+		}
+		return t.levels[level][start>>uint(level)]
+	}
+	k := split(size)
+	return t.hasher.HashChildren(t.subtreeHash(start, k), t.subtreeHash(start+k, size-k))
+}
+
+// inclusionPath returns PATH(leaf, D[start:start+size]) of RFC6962 section
+// 2.1.1.
+func (t *MerkleTree) inclusionPath(leaf, start, size uint64) [][]byte {
+	if size == 1 {
+		return nil
+	}
+	k := split(size)
+	if leaf < start+k {
+		return append(t.inclusionPath(leaf, start, k), t.subtreeHash(start+k, size-k))
+	}
+	return append(t.inclusionPath(leaf, start+k, size-k), t.subtreeHash(start, k))
+}
+
+// subproof returns SUBPROOF(m, D[start:start+size], complete) of RFC6962
+// section 2.1.2.
+func (t *MerkleTree) subproof(m, start, size uint64, complete bool) [][]byte {
+	if m == size {
+		if complete {
+			return nil
+		}
+		return [][]byte{t.subtreeHash(start, size)}
+	}
+	k := split(size)
+	if m <= k {
+		return append(t.subproof(m, start, k, complete), t.subtreeHash(start+k, size-k))
+	}
+	return append(t.subproof(m-k, start+k, size-k, false), t.subtreeHash(start, k))
+}
@@ -0,0 +1,55 @@
+// Package merkle is a pure Go implementation of the RFC6962 Merkle tree
+// hashing, proof generation and proof verification algorithms, for use by
+// clients which can't depend on the C++ library wrapped by the merkletree
+// package.
+package merkle
+
+import (
+	"crypto/sha256"
+	"hash"
+)
+
+// Domain separation prefixes for leaf and interior node hashes (RFC6962
+// section 2.1).
+const (
+	leafPrefix = 0
+	nodePrefix = 1
+)
+
+// TreeHasher computes the hashes of the leaves and interior nodes of a Merkle
+// tree.
+type TreeHasher struct {
+	newHash func() hash.Hash
+}
+
+// NewTreeHasher returns a TreeHasher which uses hashes returned by newHash.
+func NewTreeHasher(newHash func() hash.Hash) *TreeHasher {
+	return &TreeHasher{newHash: newHash}
+}
+
+// NewSHA256TreeHasher returns a TreeHasher which uses SHA-256, as CT logs do.
+func NewSHA256TreeHasher() *TreeHasher {
+	return NewTreeHasher(sha256.New)
+}
+
+// EmptyRoot returns the root hash of an empty tree.
+func (t *TreeHasher) EmptyRoot() []byte {
+	return t.newHash().Sum(nil)
+}
+
+// HashLeaf returns the hash of a leaf containing data.
+func (t *TreeHasher) HashLeaf(data []byte) []byte {
+	h := t.newHash()
+	h.Write([]byte{leafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// HashChildren returns the hash of an interior node with the given children.
+func (t *TreeHasher) HashChildren(left, right []byte) []byte {
+	h := t.newHash()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
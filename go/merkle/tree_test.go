@@ -0,0 +1,125 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func newTestTree(n int) *MerkleTree {
+	tree := NewMerkleTree(NewSHA256TreeHasher())
+	for _, leaf := range testLeaves[:n] {
+		tree.AddLeaf(leaf)
+	}
+	return tree
+}
+
+func TestMerkleTreeRoots(t *testing.T) {
+	tree := NewMerkleTree(NewSHA256TreeHasher())
+	if root, _ := tree.CurrentRoot(); !bytes.Equal(root, NewSHA256TreeHasher().EmptyRoot()) {
+		t.Errorf("CurrentRoot() of empty tree=%x, want the empty root", root)
+	}
+	for i, leaf := range testLeaves {
+		if index := tree.AddLeaf(leaf); index != uint64(i) {
+			t.Errorf("AddLeaf(leaf %d)=%d, want %d", i, index, i)
+		}
+		if root, err := tree.CurrentRoot(); err != nil || !bytes.Equal(root, testRoots[i]) {
+			t.Errorf("CurrentRoot() after %d leaves=%x,%v, want %x", i+1, root, err, testRoots[i])
+		}
+	}
+	for i := range testRoots {
+		if root, err := tree.RootAtSnapshot(uint64(i + 1)); err != nil || !bytes.Equal(root, testRoots[i]) {
+			t.Errorf("RootAtSnapshot(%d)=%x,%v, want %x", i+1, root, err, testRoots[i])
+		}
+	}
+	if _, err := tree.RootAtSnapshot(9); err == nil {
+		t.Error("RootAtSnapshot(9)=_,nil, want error")
+	}
+	if h, err := tree.LeafHash(3); err != nil || !bytes.Equal(h, NewSHA256TreeHasher().HashLeaf(testLeaves[3])) {
+		t.Errorf("LeafHash(3)=%x,%v, want the hash of leaf 3", h, err)
+	}
+	if _, err := tree.LeafHash(8); err == nil {
+		t.Error("LeafHash(8)=_,nil, want error")
+	}
+}
+
+func TestMerkleTreeLevelCount(t *testing.T) {
+	for n, want := range []uint64{0, 1, 2, 3, 3, 4, 4, 4, 4} {
+		if got := newTestTree(n).LevelCount(); got != want {
+			t.Errorf("LevelCount() of tree of size %d=%d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestMerkleTreeInclusionProofs(t *testing.T) {
+	tree := newTestTree(len(testLeaves))
+	for i, p := range inclusionProofs {
+		proof, err := tree.PathToRootAtSnapshot(p.leafIndex, p.treeSize)
+		if err != nil || !reflect.DeepEqual(proof, p.proof) {
+			t.Errorf("#%d: PathToRootAtSnapshot(%d, %d)=%x,%v, want %x", i, p.leafIndex, p.treeSize, proof, err, p.proof)
+		}
+	}
+	if _, err := tree.PathToRootAtSnapshot(5, 5); err == nil {
+		t.Error("PathToRootAtSnapshot(5, 5)=_,nil, want error")
+	}
+	if _, err := tree.PathToCurrentRoot(8); err == nil {
+		t.Error("PathToCurrentRoot(8)=_,nil, want error")
+	}
+}
+
+func TestMerkleTreeConsistencyProofs(t *testing.T) {
+	tree := newTestTree(len(testLeaves))
+	for i, p := range consistencyProofs {
+		proof, err := tree.SnapshotConsistency(p.snapshot1, p.snapshot2)
+		if err != nil || !reflect.DeepEqual(proof, p.proof) {
+			t.Errorf("#%d: SnapshotConsistency(%d, %d)=%x,%v, want %x", i, p.snapshot1, p.snapshot2, proof, err, p.proof)
+		}
+	}
+	for _, s := range [][2]uint64{{2, 1}, {1, 9}} {
+		if _, err := tree.SnapshotConsistency(s[0], s[1]); err == nil {
+			t.Errorf("SnapshotConsistency(%d, %d)=_,nil, want error", s[0], s[1])
+		}
+	}
+}
+
+// TestMerkleTreeProofsVerify checks every proof in a larger tree against the
+// Verifier.
+func TestMerkleTreeProofsVerify(t *testing.T) {
+	hasher := NewSHA256TreeHasher()
+	v := NewVerifier(hasher)
+	tree := NewMerkleTree(hasher)
+	const size = 37
+	for i := 0; i < size; i++ {
+		tree.AddLeaf([]byte(fmt.Sprintf("leaf %d", i)))
+	}
+	for snapshot := uint64(1); snapshot <= size; snapshot++ {
+		root, err := tree.RootAtSnapshot(snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for leaf := uint64(0); leaf < snapshot; leaf++ {
+			proof, err := tree.PathToRootAtSnapshot(leaf, snapshot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			leafHash, _ := tree.LeafHash(leaf)
+			if err := v.VerifyInclusion(leaf, snapshot, leafHash, root, proof); err != nil {
+				t.Errorf("VerifyInclusion(%d, %d)=%v, want nil", leaf, snapshot, err)
+			}
+		}
+		for snapshot2 := snapshot; snapshot2 <= size; snapshot2++ {
+			root2, err := tree.RootAtSnapshot(snapshot2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proof, err := tree.SnapshotConsistency(snapshot, snapshot2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := v.VerifyConsistency(snapshot, snapshot2, root, root2, proof); err != nil {
+				t.Errorf("VerifyConsistency(%d, %d)=%v, want nil", snapshot, snapshot2, err)
+			}
+		}
+	}
+}
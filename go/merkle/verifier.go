@@ -0,0 +1,237 @@
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Verifier verifies Merkle tree proofs.  It is a port of the C++
+// MerkleVerifier.
+type Verifier struct {
+	hasher *TreeHasher
+}
+
+// NewVerifier returns a Verifier which hashes with hasher.
+func NewVerifier(hasher *TreeHasher) *Verifier {
+	return &Verifier{hasher: hasher}
+}
+
+// ErrProofMismatch is returned when a proof is well formed, but doesn't
+// produce the expected root hashes.
+var ErrProofMismatch = errors.New("merkle: proof doesn't match root hash")
+
+func parent(node uint64) uint64 {
+	return node >> 1
+}
+
+func isRightChild(node uint64) bool {
+	return node&1 == 1
+}
+
+// HashSource supplies the hashes of a proof one at a time, in order, and
+// returns nil, nil once there are no more, so that a proof can be verified as
+// it is decoded without holding the whole of it in memory.
+type HashSource func() ([]byte, error)
+
+// SliceHashSource returns a HashSource for the hashes in proof.
+func SliceHashSource(proof [][]byte) HashSource {
+	return func() ([]byte, error) {
+		if len(proof) == 0 {
+			return nil, nil
+		}
+		h := proof[0]
+		proof = proof[1:]
+		return h, nil
+	}
+}
+
+// VerifyInclusion checks that proof shows that the leaf with hash leafHash is
+// at index leafIndex, counting from zero, of the tree of size treeSize with
+// root hash root (RFC6962 section 2.1.1).
+func (v *Verifier) VerifyInclusion(leafIndex, treeSize uint64, leafHash, root []byte, proof [][]byte) error {
+	return v.VerifyInclusionFrom(leafIndex, treeSize, leafHash, root, SliceHashSource(proof))
+}
+
+// VerifyInclusionFrom is like VerifyInclusion, but reads the proof from src.
+func (v *Verifier) VerifyInclusionFrom(leafIndex, treeSize uint64, leafHash, root []byte, src HashSource) error {
+	calculated, err := v.RootFromInclusionProofFrom(leafIndex, treeSize, leafHash, src)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(calculated, root) {
+		return ErrProofMismatch
+	}
+	return nil
+}
+
+// RootFromInclusionProof returns the root hash of the tree of size treeSize
+// in which the leaf with hash leafHash is at index leafIndex, given the
+// inclusion proof for the leaf.
+func (v *Verifier) RootFromInclusionProof(leafIndex, treeSize uint64, leafHash []byte, proof [][]byte) ([]byte, error) {
+	return v.RootFromInclusionProofFrom(leafIndex, treeSize, leafHash, SliceHashSource(proof))
+}
+
+// RootFromInclusionProofFrom is like RootFromInclusionProof, but reads the
+// proof from src.
+func (v *Verifier) RootFromInclusionProofFrom(leafIndex, treeSize uint64, leafHash []byte, src HashSource) ([]byte, error) {
+	if leafIndex >= treeSize {
+		return nil, fmt.Errorf("merkle: leaf index %d is beyond tree size %d", leafIndex, treeSize)
+	}
+	short := fmt.Errorf("merkle: proof too short for leaf %d of tree size %d", leafIndex, treeSize)
+	node := leafIndex
+	lastNode := treeSize - 1
+	nodeHash := leafHash
+	for lastNode > 0 {
+		if isRightChild(node) || node < lastNode {
+			sibling, err := src()
+			if err != nil {
+				return nil, err
+			}
+			if sibling == nil {
+				return nil, short
+			}
+			if isRightChild(node) {
+				nodeHash = v.hasher.HashChildren(sibling, nodeHash)
+			} else {
+				nodeHash = v.hasher.HashChildren(nodeHash, sibling)
+			}
+		}
+		// Else the sibling doesn't exist and the parent is a copy of
+		// the node.
+		node = parent(node)
+		lastNode = parent(lastNode)
+	}
+	if done, err := exhausted(src); err != nil {
+		return nil, err
+	} else if !done {
+		return nil, fmt.Errorf("merkle: proof too long for leaf %d of tree size %d", leafIndex, treeSize)
+	}
+	return nodeHash, nil
+}
+
+// exhausted reports whether src has no hashes left.
+func exhausted(src HashSource) (bool, error) {
+	h, err := src()
+	return h == nil, err
+}
+
+// VerifyConsistency checks that proof shows that the tree of size snapshot2
+// with root hash root2 is an append-only extension of the tree of size
+// snapshot1 with root hash root1 (RFC6962 section 2.1.2).
+func (v *Verifier) VerifyConsistency(snapshot1, snapshot2 uint64, root1, root2 []byte, proof [][]byte) error {
+	return v.VerifyConsistencyFrom(snapshot1, snapshot2, root1, root2, SliceHashSource(proof))
+}
+
+// VerifyConsistencyFrom is like VerifyConsistency, but reads the proof from
+// src.
+func (v *Verifier) VerifyConsistencyFrom(snapshot1, snapshot2 uint64, root1, root2 []byte, src HashSource) error {
+	switch {
+	case snapshot1 > snapshot2:
+		return fmt.Errorf("merkle: snapshot1 (%d) > snapshot2 (%d)", snapshot1, snapshot2)
+	case snapshot1 == snapshot2:
+		if done, err := exhausted(src); err != nil {
+			return err
+		} else if !done {
+			return fmt.Errorf("merkle: non-empty proof for equal snapshots")
+		}
+		if !bytes.Equal(root1, root2) {
+			return ErrProofMismatch
+		}
+		return nil
+	case snapshot1 == 0:
+		// Any tree is consistent with an empty one.
+		if done, err := exhausted(src); err != nil {
+			return err
+		} else if !done {
+			return fmt.Errorf("merkle: non-empty proof for snapshot 0")
+		}
+		return nil
+	}
+
+	// Now 0 < snapshot1 < snapshot2.
+	first, err := src()
+	if err != nil {
+		return err
+	}
+	if first == nil {
+		return errors.New("merkle: empty proof")
+	}
+	short := fmt.Errorf("merkle: proof too short for snapshots %d and %d", snapshot1, snapshot2)
+	next := func() ([]byte, error) {
+		if first != nil {
+			h := first
+			first = nil
+			return h, nil
+		}
+		h, err := src()
+		if err == nil && h == nil {
+			err = short
+		}
+		return h, err
+	}
+	node := snapshot1 - 1
+	lastNode := snapshot2 - 1
+
+	// Move up until the first mutable node.
+	for isRightChild(node) {
+		node = parent(node)
+		lastNode = parent(lastNode)
+	}
+
+	var node1Hash, node2Hash []byte
+	if node > 0 {
+		h, err := next()
+		if err != nil {
+			return err
+		}
+		node1Hash, node2Hash = h, h
+	} else {
+		// The tree at snapshot1 was balanced, so its root is the first
+		// node.
+		node1Hash, node2Hash = root1, root1
+	}
+	for node > 0 {
+		if isRightChild(node) {
+			sibling, err := next()
+			if err != nil {
+				return err
+			}
+			node1Hash = v.hasher.HashChildren(sibling, node1Hash)
+			node2Hash = v.hasher.HashChildren(sibling, node2Hash)
+		} else if node < lastNode {
+			// The sibling only exists in the later tree, and the
+			// parent in the earlier tree is a copy of the node.
+			sibling, err := next()
+			if err != nil {
+				return err
+			}
+			node2Hash = v.hasher.HashChildren(node2Hash, sibling)
+		}
+		// Else the sibling doesn't exist in either tree.
+		node = parent(node)
+		lastNode = parent(lastNode)
+	}
+	if !bytes.Equal(node1Hash, root1) {
+		return ErrProofMismatch
+	}
+
+	// Continue up to the root of the later tree.
+	for lastNode > 0 {
+		sibling, err := next()
+		if err != nil {
+			return err
+		}
+		node2Hash = v.hasher.HashChildren(node2Hash, sibling)
+		lastNode = parent(lastNode)
+	}
+	if done, err := exhausted(src); err != nil {
+		return err
+	} else if first != nil || !done {
+		return fmt.Errorf("merkle: proof too long for snapshots %d and %d", snapshot1, snapshot2)
+	}
+	if !bytes.Equal(node2Hash, root2) {
+		return ErrProofMismatch
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package merkle
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func mustDecode(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Root hashes of the trees built from the first 1 to 8 test leaves used by
+// the C++ MerkleTree tests.
+var testRoots = [][]byte{
+	mustDecode("6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d"),
+	mustDecode("fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125"),
+	mustDecode("aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77"),
+	mustDecode("d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7"),
+	mustDecode("4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4"),
+	mustDecode("76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef"),
+	mustDecode("ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c"),
+	mustDecode("5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328"),
+}
+
+func rootOfSize(n uint64) []byte {
+	return testRoots[n-1]
+}
+
+// The leaves of the test trees.
+var testLeaves = [][]byte{
+	{},
+	{0x00},
+	{0x10},
+	{0x20, 0x21},
+	{0x30, 0x31},
+	{0x40, 0x41, 0x42, 0x43},
+	{0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57},
+	{0x60, 0x61, 0x62, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6a, 0x6b, 0x6c, 0x6d, 0x6e, 0x6f},
+}
+
+var inclusionProofs = []struct {
+	leafIndex, treeSize uint64
+	proof               [][]byte
+}{
+	{0, 1, nil},
+	{0, 8, [][]byte{
+		mustDecode("96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7"),
+		mustDecode("5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e"),
+		mustDecode("6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4"),
+	}},
+	{5, 8, [][]byte{
+		mustDecode("bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b"),
+		mustDecode("ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0"),
+		mustDecode("d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7"),
+	}},
+	{2, 3, [][]byte{
+		mustDecode("fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125"),
+	}},
+	{1, 5, [][]byte{
+		mustDecode("6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d"),
+		mustDecode("5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e"),
+		mustDecode("bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b"),
+	}},
+}
+
+func TestVerifyInclusion(t *testing.T) {
+	h := NewSHA256TreeHasher()
+	v := NewVerifier(h)
+	for i, p := range inclusionProofs {
+		leafHash := h.HashLeaf(testLeaves[p.leafIndex])
+		root := rootOfSize(p.treeSize)
+		if err := v.VerifyInclusion(p.leafIndex, p.treeSize, leafHash, root, p.proof); err != nil {
+			t.Errorf("#%d: VerifyInclusion()=%v, want nil", i, err)
+		}
+
+		// The proof mustn't verify for other leaves or trees.
+		if err := v.VerifyInclusion(p.leafIndex, p.treeSize, h.HashLeaf([]byte("other")), root, p.proof); err == nil {
+			t.Errorf("#%d: VerifyInclusion(other leaf)=nil, want error", i)
+		}
+		if err := v.VerifyInclusion(p.leafIndex+1, p.treeSize, leafHash, root, p.proof); err == nil {
+			t.Errorf("#%d: VerifyInclusion(leafIndex+1)=nil, want error", i)
+		}
+		if p.treeSize < 8 {
+			if err := v.VerifyInclusion(p.leafIndex, p.treeSize+1, leafHash, rootOfSize(p.treeSize+1), p.proof); err == nil {
+				t.Errorf("#%d: VerifyInclusion(treeSize+1)=nil, want error", i)
+			}
+		}
+		if len(p.proof) > 0 {
+			if err := v.VerifyInclusion(p.leafIndex, p.treeSize, leafHash, root, p.proof[:len(p.proof)-1]); err == nil {
+				t.Errorf("#%d: VerifyInclusion(truncated proof)=nil, want error", i)
+			}
+		}
+		if err := v.VerifyInclusion(p.leafIndex, p.treeSize, leafHash, root, append(p.proof, root)); err == nil {
+			t.Errorf("#%d: VerifyInclusion(extended proof)=nil, want error", i)
+		}
+	}
+}
+
+var consistencyProofs = []struct {
+	snapshot1, snapshot2 uint64
+	proof                [][]byte
+}{
+	{1, 1, nil},
+	{1, 8, [][]byte{
+		mustDecode("96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7"),
+		mustDecode("5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e"),
+		mustDecode("6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4"),
+	}},
+	{6, 8, [][]byte{
+		mustDecode("0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a"),
+		mustDecode("ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0"),
+		mustDecode("d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7"),
+	}},
+	{2, 5, [][]byte{
+		mustDecode("5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e"),
+		mustDecode("bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b"),
+	}},
+}
+
+func TestVerifyConsistency(t *testing.T) {
+	v := NewVerifier(NewSHA256TreeHasher())
+	for i, p := range consistencyProofs {
+		root1, root2 := rootOfSize(p.snapshot1), rootOfSize(p.snapshot2)
+		if err := v.VerifyConsistency(p.snapshot1, p.snapshot2, root1, root2, p.proof); err != nil {
+			t.Errorf("#%d: VerifyConsistency()=%v, want nil", i, err)
+		}
+
+		// The proof mustn't verify for other trees.
+		if err := v.VerifyConsistency(p.snapshot1, p.snapshot2, root2, root1, p.proof); err == nil && p.snapshot1 != p.snapshot2 {
+			t.Errorf("#%d: VerifyConsistency(swapped roots)=nil, want error", i)
+		}
+		if err := v.VerifyConsistency(p.snapshot2, p.snapshot1, root2, root1, p.proof); err == nil && p.snapshot1 != p.snapshot2 {
+			t.Errorf("#%d: VerifyConsistency(swapped snapshots)=nil, want error", i)
+		}
+		if p.snapshot2 < 8 {
+			if err := v.VerifyConsistency(p.snapshot1, p.snapshot2+1, root1, rootOfSize(p.snapshot2+1), p.proof); err == nil {
+				t.Errorf("#%d: VerifyConsistency(snapshot2+1)=nil, want error", i)
+			}
+		}
+		for j := range p.proof {
+			// Tamper with each hash in turn.
+			proof := make([][]byte, len(p.proof))
+			copy(proof, p.proof)
+			proof[j] = mustDecode("00" + hex.EncodeToString(p.proof[j][1:]))
+			if err := v.VerifyConsistency(p.snapshot1, p.snapshot2, root1, root2, proof); err == nil {
+				t.Errorf("#%d: VerifyConsistency(proof with hash %d changed)=nil, want error", i, j)
+			}
+		}
+		if len(p.proof) > 0 {
+			if err := v.VerifyConsistency(p.snapshot1, p.snapshot2, root1, root2, p.proof[:len(p.proof)-1]); err == nil {
+				t.Errorf("#%d: VerifyConsistency(truncated proof)=nil, want error", i)
+			}
+		}
+		if err := v.VerifyConsistency(p.snapshot1, p.snapshot2, root1, root2, append(p.proof, root1)); err == nil {
+			t.Errorf("#%d: VerifyConsistency(extended proof)=nil, want error", i)
+		}
+	}
+
+	if err := v.VerifyConsistency(0, 5, nil, rootOfSize(5), nil); err != nil {
+		t.Errorf("VerifyConsistency(0, 5)=%v, want nil", err)
+	}
+}
+
+func TestTreeHasher(t *testing.T) {
+	h := NewSHA256TreeHasher()
+	if got, want := hex.EncodeToString(h.EmptyRoot()), "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"; got != want {
+		t.Errorf("EmptyRoot()=%s, want %s", got, want)
+	}
+	// The first test leaf is empty.
+	if got := h.HashLeaf(nil); string(got) != string(testRoots[0]) {
+		t.Errorf("HashLeaf(nil)=%x, want %x", got, testRoots[0])
+	}
+}
+
+// failingSource is a HashSource which returns the hashes of proof and then an
+// error.
+func failingSource(proof [][]byte) HashSource {
+	src := SliceHashSource(proof)
+	return func() ([]byte, error) {
+		h, err := src()
+		if h == nil && err == nil {
+			err = errors.New("read failed")
+		}
+		return h, err
+	}
+}
+
+func TestVerifyFromSourceErrors(t *testing.T) {
+	h := NewSHA256TreeHasher()
+	v := NewVerifier(h)
+	p := inclusionProofs[1]
+	leafHash := h.HashLeaf(testLeaves[p.leafIndex])
+	err := v.VerifyInclusionFrom(p.leafIndex, p.treeSize, leafHash, rootOfSize(p.treeSize), failingSource(p.proof[:1]))
+	if err == nil || err.Error() != "read failed" {
+		t.Errorf("VerifyInclusionFrom(failing source)=%v, want read failed", err)
+	}
+	c := consistencyProofs[1]
+	err = v.VerifyConsistencyFrom(c.snapshot1, c.snapshot2, rootOfSize(c.snapshot1), rootOfSize(c.snapshot2), failingSource(c.proof[:1]))
+	if err == nil || err.Error() != "read failed" {
+		t.Errorf("VerifyConsistencyFrom(failing source)=%v, want read failed", err)
+	}
+}
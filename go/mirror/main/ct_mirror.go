@@ -0,0 +1,101 @@
+// ct_mirror copies the entries of a source CT log into a destination log,
+// after checking them against the source log's STH, and records the SCT the
+// destination log issues for each source entry.  Interrupted runs resume from
+// the mappings recorded.
+package main
+
+import (
+	"crypto"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/keys"
+	"github.com/google/certificate-transparency/go/mirror"
+	"golang.org/x/net/context"
+)
+
+var sourceLogURI = flag.String("source_log_uri", "", "CT log base URI to copy entries from")
+var sourceKey = flag.String("source_public_key", "", "File containing the source log's public key in PEM, DER or base64 format")
+var destLogURI = flag.String("dest_log_uri", "", "CT log base URI to add entries to")
+var destKey = flag.String("dest_public_key", "", "File containing the destination log's public key in PEM, DER or base64 format, to verify its SCTs with")
+var mappingsFile = flag.String("mappings", "", "File recording the destination SCT of each source entry, one JSON object per line")
+var batchSize = flag.Int64("batch_size", mirror.DefaultBatchSize, "Number of source entries to fetch and verify at a time")
+var maxParallel = flag.Int("max_parallel", mirror.DefaultMaxParallel, "Maximum number of concurrent add-[pre-]chain requests; fewer are made while the destination log returns 429s")
+var follow = flag.Duration("follow", 0, "If set, keep mirroring new entries, checking the source log's STH this often")
+var quiet = flag.Bool("quiet", false, "Don't log each batch mirrored")
+
+// readKey returns the public key in the file at path, or nil if path is
+// empty.
+func readKey(path string) crypto.PublicKey {
+	if path == "" {
+		return nil
+	}
+	key, err := keys.LoadPublicKey(path)
+	if err != nil {
+		log.Fatalf("failed to read public key: %v", err)
+	}
+	return key
+}
+
+func main() {
+	flag.Parse()
+	if *sourceLogURI == "" || *sourceKey == "" || *destLogURI == "" || *mappingsFile == "" {
+		log.Fatal("--source_log_uri, --source_public_key, --dest_log_uri and --mappings are required")
+	}
+	source := client.LogInfo{URL: *sourceLogURI, PublicKey: readKey(*sourceKey)}
+	dest := client.LogInfo{URL: *destLogURI, PublicKey: readKey(*destKey)}
+	m, err := mirror.New(source, dest, *mappingsFile, mirror.Options{
+		BatchSize:   *batchSize,
+		MaxParallel: *maxParallel,
+		Quiet:       *quiet,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if next := m.Next(); next > 0 {
+		log.Printf("Resuming from entry %d", next)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		log.Print("Interrupted; finishing the submissions in flight")
+		cancel()
+	}()
+
+	failed := false
+	for {
+		res, err := m.Run(ctx)
+		if res != nil {
+			log.Printf("Mirrored tree size %d: %d entries submitted, %d failed", res.STH.TreeSize, res.Submitted, res.Failed)
+			failed = res.Failed > 0
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Mirroring failed: %v", err)
+			failed = true
+		}
+		if *follow <= 0 || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-time.After(*follow):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if err := m.Close(); err != nil {
+		log.Fatalf("failed to close %s: %v", *mappingsFile, err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,107 @@
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/google/certificate-transparency/go"
+)
+
+// Mapping records the SCT a destination log issued for an entry of the source
+// log.
+type Mapping struct {
+	// The index of the entry in the source log.
+	Index int64 `json:"index"`
+	// The SCT, as serialized by ct.SerializeSCT.
+	SCT []byte `json:"sct"`
+}
+
+// ParseSCT returns the SCT m records.
+func (m Mapping) ParseSCT() (*ct.SignedCertificateTimestamp, error) {
+	return ct.DeserializeSCT(bytes.NewReader(m.SCT))
+}
+
+// FileMappingStore keeps Mappings in a file, one JSON object per line,
+// appending each as it is saved, so that mirroring millions of entries
+// doesn't mean rewriting the file.  A line left partially written, by a
+// mirror which was killed, is discarded when the file is opened.
+type FileMappingStore struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenFileMappingStore opens the FileMappingStore in the file at path,
+// creating it if it doesn't exist, and calls fn, if non-nil, with each
+// Mapping already in it.
+func OpenFileMappingStore(path string, fn func(Mapping)) (*FileMappingStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	good, err := readMappings(f, fn)
+	if err == nil {
+		// Drop any partial line, and append after the last good one.
+		if err = f.Truncate(good); err == nil {
+			_, err = f.Seek(good, io.SeekStart)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &FileMappingStore{f: f}, nil
+}
+
+// readMappings calls fn with each Mapping in r, and returns the length of the
+// complete lines read.
+func readMappings(r io.Reader, fn func(Mapping)) (int64, error) {
+	br := bufio.NewReader(r)
+	var good int64
+	for line := 1; ; line++ {
+		b, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			// Either the file ends with a newline, or its last line
+			// was never finished.
+			return good, nil
+		}
+		if err != nil {
+			return good, err
+		}
+		var m Mapping
+		if err := json.Unmarshal(b, &m); err != nil {
+			return good, fmt.Errorf("line %d: %v", line, err)
+		}
+		if fn != nil {
+			fn(m)
+		}
+		good += int64(len(b))
+	}
+}
+
+// SaveMapping appends m to the file.
+func (s *FileMappingStore) SaveMapping(m Mapping) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(b, '\n'))
+	return err
+}
+
+// Close flushes the file to disk and closes it.
+func (s *FileMappingStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.f.Sync(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
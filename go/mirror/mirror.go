@@ -0,0 +1,219 @@
+// Package mirror copies the entries of one CT log into another, e.g. to
+// migrate a log's contents to a new log, or to keep a redundant copy of them.
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/preload"
+	"golang.org/x/net/context"
+)
+
+// Defaults for Options.
+const (
+	DefaultBatchSize   = 1000
+	DefaultMaxParallel = 8
+)
+
+// Options holds optional configuration for a Mirror.
+type Options struct {
+	// Number of source entries fetched, and verified against the source
+	// log's STH, at a time.  Zero means DefaultBatchSize.
+	BatchSize int64
+	// Maximum number of entries submitted to the destination log at once.
+	// Fewer are while the destination log returns 429s.  Zero means
+	// DefaultMaxParallel.
+	MaxParallel int
+	// Options for the LogClients used for the source and destination logs.
+	// If the destination log's public key is known, its SCTs are verified
+	// with it.
+	SourceClientOptions, DestClientOptions client.Options
+	// Don't log each batch mirrored.
+	Quiet bool
+}
+
+// Result summarises what a call to Mirror.Run did.
+type Result struct {
+	// The verified source STH whose tree was mirrored.
+	STH ct.SignedTreeHead
+	// Number of entries submitted to the destination log.
+	Submitted int64
+	// Number of entries which couldn't be submitted, and are tried again
+	// next time.
+	Failed int64
+}
+
+// Mirror submits the entries of a source log to a destination log, after
+// checking that they are those in the tree of the source log's STH, and
+// records the destination SCT for each source entry in a FileMappingStore.
+// Entries already recorded there aren't submitted again, so an interrupted
+// mirror resumes where it left off.
+type Mirror struct {
+	source   *client.LogClient
+	verifier *ct.SignatureVerifier
+	dest     *client.LogClient
+	store    *FileMappingStore
+	opts     Options
+
+	progress *preload.Progress
+	throttle *preload.Throttle
+}
+
+// New returns a Mirror from the log source, whose public key must be set, to
+// the log dest, which records Mappings in the file at mappingsPath.  The
+// Mirror must be Closed.
+func New(source, dest client.LogInfo, mappingsPath string, opts Options) (*Mirror, error) {
+	if source.PublicKey == nil {
+		return nil, fmt.Errorf("source log %s has no public key", source.URL)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.MaxParallel <= 0 {
+		opts.MaxParallel = DefaultMaxParallel
+	}
+	v, err := ct.NewSignatureVerifier(source.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("source log %s: %v", source.URL, err)
+	}
+	if dest.PublicKey != nil && opts.DestClientOptions.Verifier == nil {
+		if opts.DestClientOptions.Verifier, err = ct.NewSignatureVerifier(dest.PublicKey); err != nil {
+			return nil, fmt.Errorf("destination log %s: %v", dest.URL, err)
+		}
+	}
+	m := &Mirror{
+		source:   client.NewWithOptions(source.URL, opts.SourceClientOptions),
+		verifier: v,
+		dest:     client.NewWithOptions(dest.URL, opts.DestClientOptions),
+		opts:     opts,
+		progress: preload.NewProgress(source.URL, nil),
+		throttle: preload.NewThrottle(opts.MaxParallel),
+	}
+	if m.store, err = OpenFileMappingStore(mappingsPath, func(mp Mapping) { m.progress.MarkSubmitted(mp.Index) }); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Close closes the Mirror's FileMappingStore.
+func (m *Mirror) Close() error {
+	return m.store.Close()
+}
+
+// Next returns the index of the first source entry which hasn't been
+// mirrored.
+func (m *Mirror) Next() int64 {
+	return m.progress.Next()
+}
+
+// Run fetches and verifies the source log's STH, and mirrors the entries of
+// its tree which haven't been mirrored, until they have all been tried or ctx
+// is done.  Entries which fail to be submitted are logged, counted in the
+// Result, and tried again by the next Run.  Entries which can't be fetched,
+// or which aren't those in the STH's tree, stop the run with an error.
+func (m *Mirror) Run(ctx context.Context) (*Result, error) {
+	sth, err := m.source.GetSTHWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source STH: %v", err)
+	}
+	if err := m.verifier.VerifySTHSignature(*sth); err != nil {
+		return nil, fmt.Errorf("source STH: %v", err)
+	}
+	res := &Result{STH: *sth}
+	size := int64(sth.TreeSize)
+	for start := m.progress.Next(); start < size; start += m.opts.BatchSize {
+		end := start + m.opts.BatchSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		if err := m.mirrorBatch(ctx, start, end, sth, res); err != nil {
+			return res, err
+		}
+		if !m.opts.Quiet {
+			log.Printf("Mirrored entries [%d, %d] of %d: %d submitted, %d failed, %d in parallel", start, end, size, res.Submitted, res.Failed, m.throttle.Limit())
+		}
+	}
+	return res, nil
+}
+
+// mirrorBatch mirrors the entries [start, end], waiting for their submissions
+// to finish.
+func (m *Mirror) mirrorBatch(ctx context.Context, start, end int64, sth *ct.SignedTreeHead, res *Result) error {
+	var entries []ct.LogEntry
+	it := m.source.Entries(ctx, start, end)
+	for it.Next() {
+		entries = append(entries, *it.Entry())
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("failed to get entries [%d, %d]: %v", start, end, err)
+	}
+	if len(entries) == 0 {
+		return errors.New("log returned no entries")
+	}
+	if err := m.source.VerifyEntries(ctx, entries, *sth); err != nil {
+		return fmt.Errorf("source log: %v", err)
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := range entries {
+		e := &entries[i]
+		if m.progress.Submitted(e.Index) {
+			continue
+		}
+		if err := m.throttle.Acquire(ctx); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := m.submit(ctx, e)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("Failed to mirror entry %d: %v", e.Index, err)
+				res.Failed++
+				return
+			}
+			res.Submitted++
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// submit submits e to the destination log, and records its SCT.  The caller
+// must have acquired the throttle.
+func (m *Mirror) submit(ctx context.Context, e *ct.LogEntry) error {
+	var sct *ct.SignedCertificateTimestamp
+	var md *client.ResponseMetadata
+	var err error
+	switch e.Leaf.TimestampedEntry.EntryType {
+	case ct.X509LogEntryType:
+		chain := append([]ct.ASN1Cert{e.Leaf.TimestampedEntry.X509Entry}, e.Chain...)
+		sct, md, err = m.dest.AddChainWithMetadata(ctx, chain)
+	case ct.PrecertLogEntryType:
+		// The chain of a precertificate entry starts with the
+		// precertificate itself.
+		sct, md, err = m.dest.AddPreChainWithMetadata(ctx, e.Chain)
+	default:
+		err = fmt.Errorf("unknown entry type %v", e.Leaf.TimestampedEntry.EntryType)
+	}
+	m.throttle.Release(md != nil && md.Throttled > 0)
+	if err != nil {
+		return err
+	}
+	b, err := ct.SerializeSCT(*sct)
+	if err != nil {
+		return err
+	}
+	if err := m.store.SaveMapping(Mapping{Index: e.Index, SCT: b}); err != nil {
+		return err
+	}
+	m.progress.MarkSubmitted(e.Index)
+	return nil
+}
@@ -0,0 +1,184 @@
+package mirror
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/testlog"
+	"golang.org/x/net/context"
+)
+
+// addEntries adds n certificates, and a precertificate, issued by a new root
+// to l.
+func addEntries(t *testing.T, l *testlog.Log, n int) {
+	root := testcert.NewCA(t, "Test Root", nil)
+	key := testcert.NewKey(t)
+	for i := 0; i < n; i++ {
+		cert := testcert.Leaf(t, "leaf.example.com", key, root)
+		if _, err := l.AddChain([]ct.ASN1Cert{cert.Raw, root.Cert.Raw}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	precert, err := client.CreatePrecertificate(rand.Reader, testcert.LeafTemplate("leaf.example.com"), root.Cert, &key.PublicKey, root.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.AddPreChain([]ct.ASN1Cert{precert, root.Cert.Raw}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readMappingFile returns the Mappings in the file at path.
+func readMappingFile(t *testing.T, path string) map[int64]Mapping {
+	mappings := make(map[int64]Mapping)
+	s, err := OpenFileMappingStore(path, func(m Mapping) { mappings[m.Index] = m })
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	return mappings
+}
+
+func TestMirror(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mappings.json")
+
+	src, err := testlog.New(testlog.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := testlog.New(testlog.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	faultyDst := testlog.NewFaultyLog(dst, testlog.Faults{TooManyRequests: 3})
+	srcServer := httptest.NewServer(src)
+	defer srcServer.Close()
+	dstServer := httptest.NewServer(faultyDst)
+	defer dstServer.Close()
+	source := client.LogInfo{URL: srcServer.URL, PublicKey: src.PublicKey()}
+	dest := client.LogInfo{URL: dstServer.URL, PublicKey: dst.PublicKey()}
+	opts := Options{
+		BatchSize:         3,
+		MaxParallel:       4,
+		DestClientOptions: client.Options{Backoff: &client.BackoffPolicy{Initial: time.Millisecond, MaxRetries: 5}},
+		Quiet:             true,
+	}
+	ctx := context.Background()
+
+	addEntries(t, src, 6)
+	m, err := New(source, dest, path, opts)
+	if err != nil {
+		t.Fatalf("New()=_,%v", err)
+	}
+	res, err := m.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run()=_,%v", err)
+	}
+	if res.Submitted != 7 || res.Failed != 0 || res.STH.TreeSize != 7 {
+		t.Errorf("Run() submitted %d entries, with %d failures, of tree size %d, want 7, 0 and 7", res.Submitted, res.Failed, res.STH.TreeSize)
+	}
+	if left := faultyDst.Faults().TooManyRequests; left != 0 {
+		t.Errorf("%d 429s left after Run(), want 0", left)
+	}
+	if got := m.throttle.Limit(); got >= opts.MaxParallel {
+		t.Errorf("throttle limit after 429s=%d, want less than %d", got, opts.MaxParallel)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close()=%v", err)
+	}
+	if got := dst.TreeSize(); got != 7 {
+		t.Errorf("destination tree size %d, want 7", got)
+	}
+	mappings := readMappingFile(t, path)
+	if len(mappings) != 7 {
+		t.Errorf("got %d mappings, want 7", len(mappings))
+	}
+	for i, mp := range mappings {
+		sct, err := mp.ParseSCT()
+		if err != nil {
+			t.Errorf("mapping %d: ParseSCT()=_,%v", i, err)
+			continue
+		}
+		if sct.LogID != dst.LogID() {
+			t.Errorf("mapping %d has SCT from log %s, want destination log", i, sct.LogID.Base64String())
+		}
+	}
+
+	// A mirror killed while writing a mapping resumes from those it
+	// finished, and mirrors only the new entries.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"index": 7, "sct": "AA`)
+	f.Close()
+	addEntries(t, src, 2)
+	if m, err = New(source, dest, path, opts); err != nil {
+		t.Fatalf("New() after partial write=_,%v", err)
+	}
+	if got := m.Next(); got != 7 {
+		t.Errorf("Next() on resuming=%d, want 7", got)
+	}
+	if res, err = m.Run(ctx); err != nil {
+		t.Fatalf("Run() on resuming=_,%v", err)
+	}
+	if res.Submitted != 3 || res.Failed != 0 {
+		t.Errorf("Run() on resuming submitted %d entries, with %d failures, want 3 and 0", res.Submitted, res.Failed)
+	}
+	m.Close()
+	if got := len(readMappingFile(t, path)); got != 10 {
+		t.Errorf("got %d mappings after resuming, want 10", got)
+	}
+}
+
+func TestMirrorVerifiesEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := testlog.New(testlog.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addEntries(t, src, 4)
+	dst, err := testlog.New(testlog.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The source log's STHs are validly signed, but aren't of the tree
+	// its entries are from.
+	srcServer := httptest.NewServer(testlog.NewFaultyLog(src, testlog.Faults{InconsistentSTHs: true}))
+	defer srcServer.Close()
+	dstServer := httptest.NewServer(dst)
+	defer dstServer.Close()
+	m, err := New(client.LogInfo{URL: srcServer.URL, PublicKey: src.PublicKey()}, client.LogInfo{URL: dstServer.URL}, filepath.Join(dir, "mappings.json"), Options{Quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if _, err := m.Run(context.Background()); err == nil {
+		t.Error("Run() with inconsistent STH=_,nil, want error")
+	}
+	if got := dst.TreeSize(); got != 0 {
+		t.Errorf("destination tree size %d, want 0", got)
+	}
+
+	if _, err := New(client.LogInfo{URL: srcServer.URL}, client.LogInfo{URL: dstServer.URL}, filepath.Join(dir, "other.json"), Options{}); err == nil {
+		t.Error("New() for source without public key=_,nil, want error")
+	}
+}
@@ -0,0 +1,230 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/storage"
+	"golang.org/x/net/context"
+)
+
+// DefaultBackfillWorkers is how many entries a Backfill checks at once, unless
+// its options say otherwise.
+const DefaultBackfillWorkers = 10
+
+// DefaultBackfillBatchSize is how many entries a Backfill reads from its store
+// at a time, unless its options say otherwise.
+const DefaultBackfillBatchSize = 1000
+
+// BackfillOptions holds optional configuration for a Backfill.
+type BackfillOptions struct {
+	// How many entries are checked at once.  Zero means
+	// DefaultBackfillWorkers.
+	Workers int
+	// How many entries are read from the store at a time.  Zero means
+	// DefaultBackfillBatchSize.
+	BatchSize int
+	// Options for the LogClient used for each log.
+	ClientOptions client.Options
+}
+
+// backfillLog is a log whose SCTs a Backfill checks.
+type backfillLog struct {
+	info     client.LogInfo
+	client   *client.LogClient
+	verifier *ct.SignatureVerifier
+}
+
+// Backfill checks that logs have incorporated the entries of all the SCTs in
+// a storage.InclusionStore, and records what it finds there.  Where an
+// MMDAuditor checks SCTs as they are found, a Backfill checks those already
+// stored in bulk, e.g. those obtained before monitoring started.
+type Backfill struct {
+	logs  map[ct.SHA256Hash]*backfillLog
+	store storage.InclusionStore
+	opts  BackfillOptions
+}
+
+// NewBackfill returns a Backfill checking the entries in store of SCTs from
+// logs, whose public keys and MMDs must be set.
+func NewBackfill(logs []client.LogInfo, store storage.InclusionStore, opts BackfillOptions) (*Backfill, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultBackfillWorkers
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBackfillBatchSize
+	}
+	b := &Backfill{logs: make(map[ct.SHA256Hash]*backfillLog), store: store, opts: opts}
+	for _, l := range logs {
+		if l.PublicKey == nil {
+			return nil, fmt.Errorf("log %s has no public key", l.URL)
+		}
+		if l.MMD <= 0 {
+			return nil, fmt.Errorf("log %s has no MMD", l.URL)
+		}
+		v, err := ct.NewSignatureVerifier(l.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("log %s: %v", l.URL, err)
+		}
+		id, err := ct.KeyID(l.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("log %s: %v", l.URL, err)
+		}
+		b.logs[id] = &backfillLog{info: l, client: client.NewWithOptions(l.URL, opts.ClientOptions), verifier: v}
+	}
+	return b, nil
+}
+
+// BackfillStats counts the entries a Backfill checked, by what it found.
+type BackfillStats map[storage.InclusionStatus]int
+
+// latestSTH is the latest STH of a log, fetched and verified once per run of
+// a Backfill.
+type latestSTH struct {
+	once sync.Once
+	sth  *ct.SignedTreeHead
+	err  error
+}
+
+func (s *latestSTH) get(ctx context.Context, l *backfillLog) (*ct.SignedTreeHead, error) {
+	s.once.Do(func() {
+		if s.sth, s.err = l.client.GetSTHWithContext(ctx); s.err != nil {
+			s.err = fmt.Errorf("failed to get STH: %v", s.err)
+		} else if err := l.verifier.VerifySTHSignature(*s.sth); err != nil {
+			s.err = fmt.Errorf("invalid STH signature: %v", err)
+		}
+	})
+	return s.sth, s.err
+}
+
+// Run checks each entry in the store which hasn't been proven to be included,
+// with up to Workers at once, against its log's latest STH, which is fetched
+// and verified once per run, and records the storage.Inclusion it finds.  If
+// fn isn't nil it is called with each Inclusion recorded, from one goroutine
+// at a time.  Entries proven to be included aren't checked again, so an
+// interrupted run is resumed by running again.
+//
+// Run returns once every entry has been checked, or ctx is done, with the
+// first error which stopped it, from reading or writing the store.  Failures
+// to check entries, e.g. because their logs are unreachable, are recorded as
+// storage.CheckFailed.
+func (b *Backfill) Run(ctx context.Context, fn func(storage.Inclusion)) (BackfillStats, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sths := make(map[ct.SHA256Hash]*latestSTH)
+	for id := range b.logs {
+		sths[id] = &latestSTH{}
+	}
+
+	// Held to update the stats, report Inclusions and record the first
+	// error.
+	var mu sync.Mutex
+	stats := make(BackfillStats)
+	var firstErr error
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	entries := make(chan storage.SCTEntry)
+	var wg sync.WaitGroup
+	for i := 0; i < b.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range entries {
+				in := b.check(ctx, sths, e)
+				if ctx.Err() != nil {
+					// The check was abandoned.
+					continue
+				}
+				if err := b.store.StoreInclusion(in); err != nil {
+					fail(fmt.Errorf("failed to store inclusion: %v", err))
+					continue
+				}
+				mu.Lock()
+				stats[in.Status]++
+				if fn != nil {
+					fn(in)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var after *storage.EntryID
+read:
+	for {
+		page, err := b.store.UnprovenSCTEntries(after, b.opts.BatchSize)
+		if err != nil {
+			fail(fmt.Errorf("failed to read entries: %v", err))
+			break
+		}
+		for _, e := range page {
+			select {
+			case entries <- e:
+			case <-ctx.Done():
+				break read
+			}
+		}
+		if len(page) < b.opts.BatchSize {
+			break
+		}
+		after = &page[len(page)-1].EntryID
+	}
+	close(entries)
+	wg.Wait()
+	if firstErr != nil {
+		return stats, firstErr
+	}
+	return stats, ctx.Err()
+}
+
+// check checks that e's log has incorporated it into its latest STH.
+func (b *Backfill) check(ctx context.Context, sths map[ct.SHA256Hash]*latestSTH, e storage.SCTEntry) storage.Inclusion {
+	in := storage.Inclusion{EntryID: e.EntryID, Status: storage.CheckFailed, Checked: time.Now().UTC()}
+	l, ok := b.logs[e.LogID]
+	if !ok {
+		in.Error = fmt.Sprintf("SCT from unknown log ID %s", e.LogID.Base64String())
+		return in
+	}
+	entry := ct.LogEntry{Leaf: e.Leaf}
+	if err := l.verifier.VerifySCTSignature(e.SCT, entry); err != nil {
+		in.Error = fmt.Sprintf("invalid SCT signature: %v", err)
+		return in
+	}
+	sth, err := sths[e.LogID].get(ctx, l)
+	if err != nil {
+		in.Error = err.Error()
+		return in
+	}
+	in.TreeSize, in.STHTimestamp = sth.TreeSize, sth.Timestamp
+	proof, err := client.ProveInclusionWith(ctx, l.client, &entry, *sth)
+	if err == nil {
+		in.Status, in.LeafIndex = storage.Included, proof.LeafIndex
+		return in
+	}
+	in.Error = err.Error()
+	switch err := err.(type) {
+	case client.InclusionError:
+	case client.HTTPError:
+		if !notIncluded(err) {
+			return in
+		}
+	default:
+		return in
+	}
+	in.Status = storage.NotIncluded
+	if e.SCT.Timestamp+uint64(l.info.MMD/time.Millisecond) > sth.Timestamp {
+		// The log may yet incorporate it.
+		in.Status = storage.Pending
+	}
+	return in
+}
@@ -0,0 +1,92 @@
+// ct_backfill checks that logs have incorporated the entries of all the SCTs
+// recorded in a database, e.g. by ct_audit, by verifying a proof of each
+// entry's inclusion in its log's latest STH, and records the outcome for each
+// SCT in the database.  Entries already proven to be included aren't checked
+// again, so an interrupted run is resumed by running again.  It exits with
+// status 1 if any log has failed to incorporate an entry within its Maximum
+// Merge Delay.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/loglist"
+	"github.com/google/certificate-transparency/go/monitor"
+	"github.com/google/certificate-transparency/go/storage"
+	"golang.org/x/net/context"
+)
+
+var dbFile = flag.String("db", "", "SQLite3 database holding the SCT entries to check, and to record their inclusion in")
+var logListFile = flag.String("log_list", "", "File holding the JSON log list, giving the logs' URLs, keys and MMDs")
+var workers = flag.Int("workers", monitor.DefaultBackfillWorkers, "Number of entries checked concurrently")
+var batchSize = flag.Int("batch_size", monitor.DefaultBackfillBatchSize, "Number of entries read from the database at a time")
+var verbose = flag.Bool("verbose", false, "Log the outcome for every entry, not just those not included")
+
+func main() {
+	flag.Parse()
+	if *dbFile == "" || *logListFile == "" {
+		log.Fatal("Usage: ct_backfill --db=FILE --log_list=FILE [flags]")
+	}
+	data, err := ioutil.ReadFile(*logListFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ll, err := loglist.NewFromJSON(data)
+	if err != nil {
+		log.Fatalf("%s: %v", *logListFile, err)
+	}
+	// Frozen and retired logs must still have incorporated the entries
+	// they issued SCTs for.
+	var logs []client.LogInfo
+	for _, l := range ll.Logs() {
+		info, err := client.LogInfoFromList(l)
+		if err != nil {
+			log.Fatal(err)
+		}
+		logs = append(logs, info)
+	}
+	db, err := storage.NewSQLiteStore(*dbFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	b, err := monitor.NewBackfill(logs, db, monitor.BackfillOptions{Workers: *workers, BatchSize: *batchSize})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		log.Print("Interrupted; run again to resume")
+		cancel()
+	}()
+
+	stats, err := b.Run(ctx, func(in storage.Inclusion) {
+		switch {
+		case in.Status == storage.NotIncluded:
+			log.Printf("NOT INCLUDED: log %s entry %x: %s", in.LogID.Base64String(), in.LeafHash, in.Error)
+		case in.Status == storage.CheckFailed:
+			log.Printf("Failed to check log %s entry %x: %s", in.LogID.Base64String(), in.LeafHash, in.Error)
+		case *verbose:
+			log.Printf("%s: log %s entry %x, in tree of size %d", in.Status, in.LogID.Base64String(), in.LeafHash, in.TreeSize)
+		}
+	})
+	log.Printf("Checked %d entries: %d included, %d pending, %d not included, %d couldn't be checked",
+		stats[storage.Included]+stats[storage.Pending]+stats[storage.NotIncluded]+stats[storage.CheckFailed],
+		stats[storage.Included], stats[storage.Pending], stats[storage.NotIncluded], stats[storage.CheckFailed])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if stats[storage.NotIncluded] > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,229 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/storage"
+	"github.com/google/certificate-transparency/go/testlog"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// inclusionStore is a storage.InclusionStore which keeps entries in memory.
+type inclusionStore struct {
+	mu         sync.Mutex
+	entries    []storage.SCTEntry
+	inclusions map[storage.EntryID]storage.Inclusion
+	// If set, UnprovenSCTEntries fails once this many have been read.
+	failAfter int
+	read      int
+}
+
+func newInclusionStore() *inclusionStore {
+	return &inclusionStore{inclusions: make(map[storage.EntryID]storage.Inclusion)}
+}
+
+func idLess(a, b storage.EntryID) bool {
+	if c := bytes.Compare(a.LogID[:], b.LogID[:]); c != 0 {
+		return c < 0
+	}
+	return bytes.Compare(a.LeafHash[:], b.LeafHash[:]) < 0
+}
+
+func (s *inclusionStore) StoreSCTEntry(e storage.SCTEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.entries {
+		if existing.EntryID == e.EntryID {
+			return nil
+		}
+	}
+	s.entries = append(s.entries, e)
+	sort.Slice(s.entries, func(i, j int) bool { return idLess(s.entries[i].EntryID, s.entries[j].EntryID) })
+	return nil
+}
+
+func (s *inclusionStore) UnprovenSCTEntries(after *storage.EntryID, limit int) ([]storage.SCTEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var page []storage.SCTEntry
+	for _, e := range s.entries {
+		if len(page) == limit {
+			break
+		}
+		if after != nil && !idLess(*after, e.EntryID) || s.inclusions[e.EntryID].Status == storage.Included {
+			continue
+		}
+		if s.failAfter > 0 && s.read == s.failAfter {
+			return nil, errors.New("store failed")
+		}
+		s.read++
+		page = append(page, e)
+	}
+	return page, nil
+}
+
+func (s *inclusionStore) StoreInclusion(in storage.Inclusion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inclusions[in.EntryID] = in
+	return nil
+}
+
+func (s *inclusionStore) Inclusion(id storage.EntryID) (*storage.Inclusion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	in, ok := s.inclusions[id]
+	if !ok {
+		return nil, nil
+	}
+	return &in, nil
+}
+
+// storeEntry stores the entry of sct, for the certificate chain[0], in s.
+func storeEntry(t *testing.T, s storage.InclusionStore, sct ct.SignedCertificateTimestamp, chain []*x509.Certificate) storage.EntryID {
+	leaf := ct.MerkleTreeLeaf{
+		Version:  ct.V1,
+		LeafType: ct.TimestampedEntryLeafType,
+		TimestampedEntry: ct.TimestampedEntry{
+			Timestamp:  sct.Timestamp,
+			EntryType:  ct.X509LogEntryType,
+			X509Entry:  chain[0].Raw,
+			Extensions: sct.Extensions,
+		},
+	}
+	e, err := storage.NewSCTEntry(sct, leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StoreSCTEntry(*e); err != nil {
+		t.Fatal(err)
+	}
+	return e.EntryID
+}
+
+func TestBackfill(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	// As for TestMMDAuditor, the log also issues SCTs, from other
+	// instances, which it never incorporates.
+	l, err := testlog.New(testlog.Options{Key: key, Now: testlog.SteppingClock(start, time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost, err := testlog.New(testlog.Options{Key: key, Now: testlog.SteppingClock(start, time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	future, err := testlog.New(testlog.Options{Key: key, Now: testlog.SteppingClock(start.Add(24*time.Hour), time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherLog, err := testlog.New(testlog.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(l)
+	defer hs.Close()
+	info := client.LogInfo{URL: hs.URL, PublicKey: &key.PublicKey, MMD: time.Minute}
+
+	store := newInclusionStore()
+	want := make(map[storage.EntryID]storage.InclusionStatus)
+	for i := 0; i < 3; i++ {
+		chain, _ := testChain(t)
+		want[storeEntry(t, store, addChain(t, l, chain), chain)] = storage.Included
+	}
+	chain, _ := testChain(t)
+	want[storeEntry(t, store, addChain(t, lost, chain), chain)] = storage.NotIncluded
+	chain, _ = testChain(t)
+	want[storeEntry(t, store, addChain(t, future, chain), chain)] = storage.Pending
+	chain, _ = testChain(t)
+	want[storeEntry(t, store, addChain(t, otherLog, chain), chain)] = storage.CheckFailed
+	// An SCT stored with the wrong entry fails to verify.
+	other, _ := testChain(t)
+	want[storeEntry(t, store, addChain(t, l, chain), other)] = storage.CheckFailed
+
+	b, err := NewBackfill([]client.LogInfo{info}, store, BackfillOptions{Workers: 3, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reported []storage.Inclusion
+	stats, err := b.Run(context.Background(), func(in storage.Inclusion) { reported = append(reported, in) })
+	if err != nil {
+		t.Fatalf("Run()=_,%v", err)
+	}
+	if len(reported) != len(want) {
+		t.Errorf("Run() reported %d inclusions, want %d", len(reported), len(want))
+	}
+	if wantStats := (BackfillStats{storage.Included: 3, storage.NotIncluded: 1, storage.Pending: 1, storage.CheckFailed: 2}); len(stats) != len(wantStats) {
+		t.Errorf("Run()=%v, want %v", stats, wantStats)
+	} else {
+		for status, n := range wantStats {
+			if stats[status] != n {
+				t.Errorf("Run()=%v, want %v", stats, wantStats)
+			}
+		}
+	}
+	for id, status := range want {
+		in, err := store.Inclusion(id)
+		if err != nil || in == nil {
+			t.Errorf("Inclusion(%x)=%v,%v, want one recorded", id.LeafHash, in, err)
+			continue
+		}
+		if in.Status != status {
+			t.Errorf("entry %x is %s (%s), want %s", id.LeafHash, in.Status, in.Error, status)
+		}
+		if status != storage.CheckFailed && (in.TreeSize != 4 || in.STHTimestamp == 0) {
+			t.Errorf("entry %x was checked against STH of size %d, want 4", id.LeafHash, in.TreeSize)
+		}
+		if in.Checked.IsZero() {
+			t.Errorf("entry %x has no check time", id.LeafHash)
+		}
+	}
+
+	// Running again only checks the entries not proven to be included.
+	stats, err = b.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Run(again)=_,%v", err)
+	}
+	if stats[storage.Included] != 0 || stats[storage.NotIncluded] != 1 {
+		t.Errorf("Run(again)=%v, want only the unproven entries checked", stats)
+	}
+
+	// Failing to read the store stops the run.
+	store.failAfter, store.read = 2, 0
+	if _, err := b.Run(context.Background(), nil); err == nil {
+		t.Error("Run(failing store)=_,nil, want error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	store.failAfter = 0
+	if _, err := b.Run(ctx, nil); err != context.Canceled {
+		t.Errorf("Run(cancelled)=_,%v, want %v", err, context.Canceled)
+	}
+}
+
+func TestNewBackfillRequiresMMDs(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBackfill([]client.LogInfo{{URL: "https://log.example.com", PublicKey: &key.PublicKey}}, newInclusionStore(), BackfillOptions{}); err == nil {
+		t.Error("NewBackfill(log without MMD)=_,nil, want error")
+	}
+}
@@ -0,0 +1,371 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/keys"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// EvidenceVersion is the version of the Evidence format this package writes
+// and reads.
+const EvidenceVersion = 1
+
+// Violation is the kind of misbehaviour Evidence shows.
+type Violation string
+
+// Violations.
+const (
+	// STHs for the same tree size have different root hashes.
+	SplitView Violation = "split_view"
+	// A consistency proof between STHs for different tree sizes doesn't
+	// verify.
+	InconsistentTrees Violation = "inconsistent_trees"
+	// An SCT's entry isn't included in an STH from after the SCT's
+	// Maximum Merge Delay had passed.
+	MissedMMD Violation = "missed_mmd"
+)
+
+// EvidenceEntry is a log entry included in Evidence, as get-entries returns
+// it.
+type EvidenceEntry struct {
+	LeafInput []byte `json:"leaf_input"`
+	ExtraData []byte `json:"extra_data,omitempty"`
+}
+
+// EvidenceInclusionProof is an inclusion proof a log returned.
+type EvidenceInclusionProof struct {
+	LeafIndex int64    `json:"leaf_index"`
+	AuditPath [][]byte `json:"audit_path"`
+}
+
+// ReporterSignature is a signature over Evidence by whoever reported it, so
+// that where it came from can be checked too.
+type ReporterSignature struct {
+	// The DER SubjectPublicKeyInfo of the reporter's key.
+	PublicKey []byte             `json:"public_key"`
+	Signature ct.DigitallySigned `json:"signature"`
+}
+
+// Evidence is a self-contained record of a log's misbehaviour, for monitors
+// to exchange and archive.  Everything in it which the log signed is included
+// with its signature, so that anyone with the log's key can check it with
+// Verify.  It is serialized as JSON, with binary fields in base64.
+type Evidence struct {
+	Version   int           `json:"version"`
+	Violation Violation     `json:"violation"`
+	LogID     ct.SHA256Hash `json:"log_id"`
+	LogURL    string        `json:"log_url,omitempty"`
+	// The STHs which conflict, the smaller tree first.
+	STHs []ct.SignedTreeHead `json:"sths,omitempty"`
+	// The consistency proof the log returned between STHs, if any.
+	ConsistencyProof [][]byte `json:"consistency_proof,omitempty"`
+	// The TLS encoded SCTs involved, each for the entry at the same index
+	// of Entries.
+	SCTs    [][]byte        `json:"scts,omitempty"`
+	Entries []EvidenceEntry `json:"entries,omitempty"`
+	// The log's Maximum Merge Delay in ms, for MissedMMD evidence.
+	MMD uint64 `json:"mmd,omitempty"`
+	// The inclusion proof the log returned for the entry, if any, for
+	// MissedMMD evidence.
+	InclusionProof *EvidenceInclusionProof `json:"inclusion_proof,omitempty"`
+	// When the misbehaviour was detected.
+	Observed time.Time          `json:"observed"`
+	Reporter *ReporterSignature `json:"reporter,omitempty"`
+}
+
+// NewConsistencyEvidence returns Evidence that the STHs first and second of
+// the log with ID logID, which the log proved consistent with proof, if they
+// are of different sizes, are not views of the same tree.
+func NewConsistencyEvidence(logID ct.SHA256Hash, first, second ct.SignedTreeHead, proof [][]byte) *Evidence {
+	if first.TreeSize > second.TreeSize {
+		first, second = second, first
+	}
+	first.LogID, second.LogID = logID, logID
+	e := &Evidence{
+		Version:   EvidenceVersion,
+		Violation: InconsistentTrees,
+		LogID:     logID,
+		STHs:      []ct.SignedTreeHead{first, second},
+		Observed:  time.Now().UTC(),
+	}
+	if first.TreeSize == second.TreeSize {
+		e.Violation = SplitView
+	} else {
+		e.ConsistencyProof = proof
+	}
+	return e
+}
+
+// Evidence returns the Evidence of the split view a reports.
+func (a Alarm) Evidence() (*Evidence, error) {
+	if a.Log == nil {
+		return nil, errors.New("alarm has no log")
+	}
+	id, err := ct.KeyID(a.Log.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	e := NewConsistencyEvidence(id, a.First.STH, a.Second.STH, a.Proof)
+	e.LogURL = a.Log.URL
+	e.Observed = a.Second.Time.UTC()
+	return e, nil
+}
+
+// ParseEvidence parses JSON encoded Evidence.
+func ParseEvidence(b []byte) (*Evidence, error) {
+	var e Evidence
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+	if e.Version != EvidenceVersion {
+		return nil, fmt.Errorf("unsupported evidence version %d", e.Version)
+	}
+	return &e, nil
+}
+
+// signedData returns the data a ReporterSignature signs: the JSON encoding of
+// e without the signature.
+func (e *Evidence) signedData() ([]byte, error) {
+	unsigned := *e
+	unsigned.Reporter = nil
+	return json.Marshal(unsigned)
+}
+
+// Sign signs e as its reporter with key, replacing any existing signature.
+func (e *Evidence) Sign(key crypto.Signer) error {
+	signer, err := keys.NewSigner(key, nil)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return err
+	}
+	data, err := e.signedData()
+	if err != nil {
+		return err
+	}
+	sig, err := signer.Sign(data)
+	if err != nil {
+		return err
+	}
+	e.Reporter = &ReporterSignature{
+		PublicKey: der,
+		Signature: sig,
+	}
+	return nil
+}
+
+// Verify checks that e shows misbehaviour by the log with public key logKey:
+// that everything in it is validly signed by the log and that together they
+// show the violation.  If e has a reporter's signature, that is checked too.
+//
+// Proofs aren't signed, and a log can't sign that it doesn't have an entry,
+// so InconsistentTrees and MissedMMD evidence only shows what the reporter
+// says the log returned; Confirm checks it with the log.
+func (e *Evidence) Verify(logKey crypto.PublicKey) error {
+	if e.Version != EvidenceVersion {
+		return fmt.Errorf("unsupported evidence version %d", e.Version)
+	}
+	if id, err := ct.KeyID(logKey); err != nil {
+		return err
+	} else if id != e.LogID {
+		return fmt.Errorf("evidence is for log ID %s, not that of the key", e.LogID.Base64String())
+	}
+	v, err := ct.NewSignatureVerifier(logKey)
+	if err != nil {
+		return err
+	}
+	for i, sth := range e.STHs {
+		if err := v.VerifySTHSignature(sth); err != nil {
+			return fmt.Errorf("STH %d: %v", i, err)
+		}
+	}
+	if len(e.SCTs) != len(e.Entries) {
+		return fmt.Errorf("evidence has %d SCTs but %d entries", len(e.SCTs), len(e.Entries))
+	}
+	var scts []*ct.SignedCertificateTimestamp
+	for i, b := range e.SCTs {
+		sct, err := e.verifySCT(v, i, b)
+		if err != nil {
+			return err
+		}
+		scts = append(scts, sct)
+	}
+	if err := e.verifyViolation(scts); err != nil {
+		return err
+	}
+	if e.Reporter != nil {
+		return e.verifyReporter()
+	}
+	return nil
+}
+
+// verifySCT checks that the TLS encoded SCT b signs entry i, and returns it.
+func (e *Evidence) verifySCT(v *ct.SignatureVerifier, i int, b []byte) (*ct.SignedCertificateTimestamp, error) {
+	sct, err := ct.DeserializeSCT(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("SCT %d: %v", i, err)
+	}
+	if sct.LogID != e.LogID {
+		return nil, fmt.Errorf("SCT %d is from log ID %s", i, sct.LogID.Base64String())
+	}
+	entry, err := e.entry(i)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.VerifySCTSignature(*sct, *entry); err != nil {
+		return nil, fmt.Errorf("SCT %d: %v", i, err)
+	}
+	return sct, nil
+}
+
+// verifyViolation checks that e's contents, already checked to be signed by
+// the log, as are its SCTs scts, show its violation.
+func (e *Evidence) verifyViolation(scts []*ct.SignedCertificateTimestamp) error {
+	switch e.Violation {
+	case SplitView, InconsistentTrees:
+		if len(e.STHs) != 2 {
+			return fmt.Errorf("%s evidence has %d STHs, want 2", e.Violation, len(e.STHs))
+		}
+		first, second := e.STHs[0], e.STHs[1]
+		if e.Violation == SplitView {
+			if first.TreeSize != second.TreeSize || first.SHA256RootHash == second.SHA256RootHash {
+				return errors.New("STHs aren't for the same tree size with different root hashes")
+			}
+			return nil
+		}
+		if first.TreeSize >= second.TreeSize {
+			return errors.New("STHs aren't for increasing tree sizes")
+		}
+		src := staticProofs{consistency: e.ConsistencyProof}
+		if _, err := client.VerifyConsistencyWith(context.Background(), src, first, second); err == nil {
+			return errors.New("STHs are consistent")
+		}
+		return nil
+	case MissedMMD:
+		if len(e.STHs) != 1 || len(scts) != 1 {
+			return fmt.Errorf("%s evidence has %d STHs and %d SCTs, want 1 of each", e.Violation, len(e.STHs), len(scts))
+		}
+		if deadline := scts[0].Timestamp + e.MMD; e.STHs[0].Timestamp < deadline {
+			return fmt.Errorf("STH timestamp %d is before the SCT's deadline %d", e.STHs[0].Timestamp, deadline)
+		}
+		if e.InclusionProof == nil {
+			return nil
+		}
+		entry, err := e.entry(0)
+		if err != nil {
+			return err
+		}
+		src := staticProofs{inclusion: e.InclusionProof}
+		if _, err := client.ProveInclusionWith(context.Background(), src, entry, e.STHs[0]); err == nil {
+			return errors.New("the entry is included in the STH")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown violation %q", e.Violation)
+}
+
+// entry returns Entries[i] as a LogEntry.
+func (e *Evidence) entry(i int) (*ct.LogEntry, error) {
+	leaf, err := ct.ReadMerkleTreeLeaf(bytes.NewReader(e.Entries[i].LeafInput))
+	if err != nil {
+		return nil, fmt.Errorf("entry %d: %v", i, err)
+	}
+	return &ct.LogEntry{Leaf: *leaf}, nil
+}
+
+func (e *Evidence) verifyReporter() error {
+	pk, err := x509.ParsePKIXPublicKey(e.Reporter.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid reporter key: %v", err)
+	}
+	v, err := ct.NewSignatureVerifier(pk)
+	if err != nil {
+		return err
+	}
+	data, err := e.signedData()
+	if err != nil {
+		return err
+	}
+	if err := v.VerifySignature(data, e.Reporter.Signature); err != nil {
+		return fmt.Errorf("reporter signature: %v", err)
+	}
+	return nil
+}
+
+// Confirm checks the parts of e which aren't signed with the log, via src,
+// which is typically the log's LogClient.  It returns nil if the log's
+// answers still show the violation.  e should already have been checked with
+// Verify.
+func (e *Evidence) Confirm(ctx context.Context, src client.ProofSource) error {
+	switch e.Violation {
+	case SplitView:
+		// The signatures on the STHs are all the proof needed.
+		return nil
+	case InconsistentTrees:
+		if len(e.STHs) != 2 {
+			return fmt.Errorf("%s evidence has %d STHs, want 2", e.Violation, len(e.STHs))
+		}
+		_, err := client.VerifyConsistencyWith(ctx, src, e.STHs[0], e.STHs[1])
+		if err == nil {
+			return errors.New("the log proved the STHs consistent")
+		}
+		if _, ok := err.(client.ConsistencyError); ok {
+			return nil
+		}
+		return err
+	case MissedMMD:
+		if len(e.STHs) != 1 || len(e.Entries) != 1 {
+			return fmt.Errorf("%s evidence has %d STHs and %d entries, want 1 of each", e.Violation, len(e.STHs), len(e.Entries))
+		}
+		entry, err := e.entry(0)
+		if err != nil {
+			return err
+		}
+		_, err = client.ProveInclusionWith(ctx, src, entry, e.STHs[0])
+		switch err := err.(type) {
+		case nil:
+			return errors.New("the log proved the entry included")
+		case client.InclusionError:
+			return nil
+		case client.HTTPError:
+			if notIncluded(err) {
+				return nil
+			}
+		}
+		return err
+	}
+	return fmt.Errorf("unknown violation %q", e.Violation)
+}
+
+// staticProofs is a ProofSource which returns proofs already fetched.
+type staticProofs struct {
+	consistency [][]byte
+	inclusion   *EvidenceInclusionProof
+}
+
+func (p staticProofs) GetConsistencyProof(ctx context.Context, first, second uint64) ([][]byte, error) {
+	return p.consistency, nil
+}
+
+func (p staticProofs) GetProofByHash(ctx context.Context, hash []byte, treeSize uint64) (*client.InclusionProof, error) {
+	if p.inclusion == nil {
+		return nil, errors.New("no inclusion proof")
+	}
+	return &client.InclusionProof{
+		LeafIndex: p.inclusion.LeafIndex,
+		TreeSize:  treeSize,
+		LeafHash:  hash,
+		AuditPath: p.inclusion.AuditPath,
+	}, nil
+}
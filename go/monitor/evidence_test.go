@@ -0,0 +1,148 @@
+package monitor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/testlog"
+	"golang.org/x/net/context"
+)
+
+func TestEvidence(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporterKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := testlog.New(testlog.Options{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork, err := testlog.New(testlog.Options{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := testlog.New(testlog.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(l)
+	defer hs.Close()
+	lc := client.New(hs.URL)
+	ctx := context.Background()
+
+	addCerts(t, l, 2)
+	sth2 := mustSTH(t, l)
+	addCerts(t, l, 3)
+	sth5 := mustSTH(t, l)
+	addCerts(t, fork, 1)
+	fork1 := mustSTH(t, fork)
+	addCerts(t, fork, 4)
+	fork5 := mustSTH(t, fork)
+	proof12, err := lc.GetConsistencyProof(ctx, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof25, err := lc.GetConsistencyProof(ctx, 2, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		first, second ct.SignedTreeHead
+		proof         [][]byte
+		want          Violation
+		wantValid     bool
+		wantConfirmed bool
+	}{
+		{first: sth5, second: fork5, want: SplitView, wantValid: true, wantConfirmed: true},
+		{first: sth2, second: fork1, proof: proof12, want: InconsistentTrees, wantValid: true, wantConfirmed: true},
+		{first: sth2, second: sth5, proof: proof25, want: InconsistentTrees},
+		{first: sth5, second: sth5, want: SplitView, wantConfirmed: true},
+		{first: sth2, second: mustSTH(t, other), want: InconsistentTrees},
+	} {
+		e := NewConsistencyEvidence(l.LogID(), test.first, test.second, test.proof)
+		if e.Violation != test.want {
+			t.Errorf("#%d: evidence of %s, want %s", i, e.Violation, test.want)
+			continue
+		}
+		if err := e.Verify(&key.PublicKey); (err == nil) != test.wantValid {
+			t.Errorf("#%d: Verify()=%v, want valid %v", i, err, test.wantValid)
+		}
+		if err := e.Confirm(ctx, lc); (err == nil) != test.wantConfirmed {
+			t.Errorf("#%d: Confirm()=%v, want confirmed %v", i, err, test.wantConfirmed)
+		}
+		if !test.wantValid {
+			continue
+		}
+		if err := e.Verify(other.PublicKey()); err == nil {
+			t.Errorf("#%d: Verify(other log's key)=nil, want error", i)
+		}
+
+		// Signed evidence survives being exchanged, but not tampering.
+		if err := e.Sign(reporterKey); err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseEvidence(b)
+		if err != nil {
+			t.Fatalf("#%d: ParseEvidence()=_,%v", i, err)
+		}
+		if err := parsed.Verify(&key.PublicKey); err != nil {
+			t.Errorf("#%d: Verify(parsed)=%v", i, err)
+		}
+		parsed.LogURL = "https://evil.example.com"
+		if err := parsed.Verify(&key.PublicKey); err == nil {
+			t.Errorf("#%d: Verify(tampered)=nil, want error", i)
+		}
+	}
+
+	if _, err := ParseEvidence([]byte(`{"version":2}`)); err == nil {
+		t.Error("ParseEvidence(version 2)=_,nil, want error")
+	}
+}
+
+func TestAlarmEvidence(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := testlog.New(testlog.Options{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork, err := testlog.New(testlog.Options{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addCerts(t, l, 1)
+	addCerts(t, fork, 1)
+	a := Alarm{
+		Type:   RootsDiffer,
+		Log:    &client.LogInfo{URL: "https://log.example.com", PublicKey: &key.PublicKey},
+		First:  Observation{Source: "direct", STH: mustSTH(t, l)},
+		Second: Observation{Source: "gossip", STH: mustSTH(t, fork)},
+	}
+	e, err := a.Evidence()
+	if err != nil {
+		t.Fatalf("Evidence()=_,%v", err)
+	}
+	if e.Violation != SplitView || e.LogID != l.LogID() || e.LogURL != a.Log.URL {
+		t.Errorf("Evidence()=%+v, want split view evidence for %s", e, a.Log.URL)
+	}
+	if err := e.Verify(&key.PublicKey); err != nil {
+		t.Errorf("Verify()=%v", err)
+	}
+}
@@ -0,0 +1,346 @@
+// ct_monitor follows a set of CT logs: it checks that each log's STHs are
+// properly signed and consistent, scans the new entries of each for
+// certificates for watched domains, and sends alerts about both to webhooks,
+// Slack, email and syslog.  It is configured by a JSON file, e.g.
+//
+//	{
+//	  "logs": [{"url": "https://ct.googleapis.com/pilot", "key": "MFkw...", "mmd": "24h"}],
+//	  "poll_interval": "1m",
+//	  "sth_store": "/var/lib/ct-monitor/sths.json",
+//	  "checkpoints": "/var/lib/ct-monitor/checkpoints.json",
+//	  "watchlist": ["example.com", "*.example.org"],
+//	  "alerts": {
+//	    "webhook_url": "https://hooks.example.com/ct",
+//	    "slack_url": "https://hooks.slack.com/services/...",
+//	    "email": {"smtp_addr": "localhost:25", "from": "ct@example.com", "to": ["secops@example.com"]},
+//	    "syslog": {"tag": "ct-monitor"},
+//	    "rate": 0.1, "burst": 10
+//	  }
+//	}
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"log/syslog"
+	"net/smtp"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/alerts"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/monitor"
+	"github.com/google/certificate-transparency/go/scanner"
+	"github.com/google/certificate-transparency/go/storage"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+var configFile = flag.String("config", "", "JSON file configuring the logs to monitor and where to send alerts")
+
+// duration is a time.Duration which is written in JSON as a string such as
+// "24h".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+type logConfig struct {
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	// The log's public key, as base64 DER, as in log lists.
+	Key string   `json:"key"`
+	MMD duration `json:"mmd"`
+}
+
+type emailConfig struct {
+	// The SMTP server to send mail through, as host:port.
+	SMTPAddr string   `json:"smtp_addr"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+type syslogConfig struct {
+	// As for syslog.Dial; if both are empty, the local syslog daemon is
+	// used.
+	Network string `json:"network"`
+	Addr    string `json:"addr"`
+	Tag     string `json:"tag"`
+}
+
+type alertsConfig struct {
+	WebhookURL string `json:"webhook_url"`
+	// A Slack-compatible incoming webhook.
+	SlackURL string        `json:"slack_url"`
+	Email    *emailConfig  `json:"email"`
+	Syslog   *syslogConfig `json:"syslog"`
+	// The least severe alerts sent: "info", "warning" or "critical".
+	MinSeverity alerts.Severity `json:"min_severity"`
+	// If positive, the number of alerts per second sent to each
+	// destination, in bursts of up to burst; critical alerts are always
+	// sent.
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+type config struct {
+	Logs []logConfig `json:"logs"`
+	// How often each log's STH is fetched.
+	PollInterval duration `json:"poll_interval"`
+	// JSON files to keep the latest verified STH of each log, and how far
+	// each log has been scanned, in.  If unset, monitoring starts afresh,
+	// from the logs' current trees, each time.
+	STHStore    string `json:"sth_store"`
+	Checkpoints string `json:"checkpoints"`
+	// An SQLite3 database to keep every verified STH, and the consistency
+	// proofs between them, in, instead of sth_store.
+	Database string `json:"database"`
+	// Domains to alert on certificates for, as for scanner.Watchlist.  If
+	// empty, the logs' entries aren't scanned.
+	Watchlist []string     `json:"watchlist"`
+	Alerts    alertsConfig `json:"alerts"`
+}
+
+func loadConfig(path string) (*config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid config in %s: %v", path, err)
+	}
+	if len(cfg.Logs) == 0 {
+		return nil, fmt.Errorf("no logs configured in %s", path)
+	}
+	return &cfg, nil
+}
+
+// logInfos returns the LogInfos of the configured logs.
+func (cfg *config) logInfos() ([]client.LogInfo, error) {
+	var infos []client.LogInfo
+	for _, l := range cfg.Logs {
+		der, err := base64.StdEncoding.DecodeString(l.Key)
+		if err != nil {
+			return nil, fmt.Errorf("log %s: invalid key: %v", l.URL, err)
+		}
+		key, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("log %s: invalid key: %v", l.URL, err)
+		}
+		infos = append(infos, client.LogInfo{
+			Description: l.Description,
+			URL:         strings.TrimSuffix(l.URL, "/"),
+			PublicKey:   key,
+			MMD:         time.Duration(l.MMD),
+		})
+	}
+	return infos, nil
+}
+
+// syslogSink is an alerts.Sink which writes alerts to syslog.
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func (s syslogSink) Send(ctx context.Context, a *alerts.Alert) error {
+	msg := a.String()
+	if a.Details != "" {
+		msg += ": " + a.Details
+	}
+	switch a.Severity {
+	case alerts.Critical:
+		return s.w.Crit(msg)
+	case alerts.Warning:
+		return s.w.Warning(msg)
+	}
+	return s.w.Info(msg)
+}
+
+func newDispatcher(cfg alertsConfig) (*alerts.Dispatcher, error) {
+	d := alerts.NewDispatcher()
+	opts := alerts.SinkOptions{MinSeverity: cfg.MinSeverity, Rate: cfg.Rate, Burst: cfg.Burst}
+	if cfg.WebhookURL != "" {
+		d.AddSink(&alerts.WebhookSink{URL: cfg.WebhookURL}, opts)
+	}
+	if cfg.SlackURL != "" {
+		d.AddSink(&alerts.SlackSink{URL: cfg.SlackURL}, opts)
+	}
+	if cfg.Email != nil {
+		if cfg.Email.SMTPAddr == "" || cfg.Email.From == "" || len(cfg.Email.To) == 0 {
+			return nil, errors.New("email alerts need smtp_addr, from and to")
+		}
+		s := &alerts.SMTPSink{Addr: cfg.Email.SMTPAddr, From: cfg.Email.From, To: cfg.Email.To}
+		if cfg.Email.Username != "" {
+			host := cfg.Email.SMTPAddr
+			if i := strings.LastIndex(host, ":"); i >= 0 {
+				host = host[:i]
+			}
+			s.Auth = smtp.PlainAuth("", cfg.Email.Username, cfg.Email.Password, host)
+		}
+		d.AddSink(s, opts)
+	}
+	if cfg.Syslog != nil {
+		tag := cfg.Syslog.Tag
+		if tag == "" {
+			tag = "ct-monitor"
+		}
+		w, err := syslog.Dial(cfg.Syslog.Network, cfg.Syslog.Addr, syslog.LOG_WARNING|syslog.LOG_DAEMON, tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %v", err)
+		}
+		// Syslog is local, so isn't worth retrying or rate limiting.
+		d.AddSink(syslogSink{w: w}, alerts.SinkOptions{MinSeverity: cfg.MinSeverity, MaxAttempts: 1})
+	}
+	return d, nil
+}
+
+// alertEvents alerts on the Events from the STHFollower which show that a
+// log has misbehaved, or can't be followed, until events is closed.
+func alertEvents(ctx context.Context, events <-chan monitor.Event, d *alerts.Dispatcher) {
+	for ev := range events {
+		if ev.Type == monitor.STHUpdated {
+			log.Printf("%s: verified STH for tree size %d", ev.Log.URL, ev.STH.TreeSize)
+			continue
+		}
+		d.Send(ctx, alerts.FromEvent(ev))
+	}
+}
+
+// scanLog follows the log's entries, alerting on those the watchlist matches,
+// until ctx is done.
+func scanLog(ctx context.Context, info client.LogInfo, w *scanner.Watchlist, cfg *config, checkpoints scanner.CheckpointStore, d *alerts.Dispatcher) error {
+	opts := scanner.ScannerOptions{
+		EntryMatcher: w,
+		BatchSize:    1000,
+		NumWorkers:   2,
+		Quiet:        true,
+		Checkpoints:  checkpoints,
+		PollInterval: time.Duration(cfg.PollInterval),
+		MMD:          info.MMD,
+	}
+	if checkpoints == nil {
+		// Without checkpoints, only new entries are of interest.
+		sth, err := client.New(info.URL).GetSTHWithContext(ctx)
+		if err != nil {
+			return err
+		}
+		opts.StartIndex = int64(sth.TreeSize)
+	}
+	found := func(e *ct.LogEntry) {
+		for _, alert := range w.Alerts(e) {
+			d.Send(ctx, alerts.FromWatchlistAlert(info.URL, alert))
+		}
+	}
+	s := scanner.NewScanner(client.New(info.URL), opts)
+	return s.Follow(ctx, found, found)
+}
+
+func main() {
+	flag.Parse()
+	if *configFile == "" {
+		log.Fatal("--config is required")
+	}
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logs, err := cfg.logInfos()
+	if err != nil {
+		log.Fatal(err)
+	}
+	dispatcher, err := newDispatcher(cfg.Alerts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	followerOpts := monitor.STHFollowerOptions{
+		Interval:          time.Duration(cfg.PollInterval),
+		VerifyConsistency: true,
+	}
+	switch {
+	case cfg.STHStore != "" && cfg.Database != "":
+		log.Fatal("At most one of sth_store and database may be configured")
+	case cfg.STHStore != "":
+		if followerOpts.Store, err = monitor.NewFileSTHStore(cfg.STHStore); err != nil {
+			log.Fatal(err)
+		}
+	case cfg.Database != "":
+		db, err := storage.NewSQLiteStore(cfg.Database)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+		followerOpts.Store, followerOpts.Proofs = db, db
+	}
+	events := make(chan monitor.Event)
+	follower, err := monitor.NewSTHFollower(logs, events, followerOpts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var watchlist *scanner.Watchlist
+	if len(cfg.Watchlist) > 0 {
+		if watchlist, err = scanner.NewWatchlist(cfg.Watchlist, scanner.WatchlistOptions{}); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var checkpoints scanner.CheckpointStore
+	if cfg.Checkpoints != "" {
+		if checkpoints, err = scanner.NewFileCheckpointStore(cfg.Checkpoints); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		log.Print("Shutting down")
+		cancel()
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		alertEvents(ctx, events, dispatcher)
+	}()
+	if watchlist != nil {
+		for _, l := range logs {
+			wg.Add(1)
+			go func(l client.LogInfo) {
+				defer wg.Done()
+				if err := scanLog(ctx, l, watchlist, cfg, checkpoints, dispatcher); err != nil && ctx.Err() == nil {
+					dispatcher.Send(ctx, &alerts.Alert{Severity: alerts.Warning, Title: "Stopped scanning log", Details: err.Error(), Log: l.URL})
+				}
+			}(l)
+		}
+	}
+	log.Printf("Monitoring %d logs", len(logs))
+	follower.Run(ctx)
+	close(events)
+	wg.Wait()
+}
@@ -0,0 +1,315 @@
+package monitor
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/merkle"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// MMDViolation reports an SCT whose entry a log hasn't incorporated into its
+// tree within its Maximum Merge Delay.
+type MMDViolation struct {
+	Log *client.LogInfo
+	SCT ct.SignedCertificateTimestamp
+	// The entry the SCT was issued for.
+	Leaf ct.MerkleTreeLeaf
+	// The log's STH, from after the SCT's deadline, which doesn't include
+	// the entry.
+	STH ct.SignedTreeHead
+	// The inclusion proof the log returned, which doesn't verify, or nil
+	// if it returned none.
+	Proof *client.InclusionProof
+	Err   error
+}
+
+// Evidence returns the Evidence of the violation v reports.
+func (v MMDViolation) Evidence() (*Evidence, error) {
+	if v.Log == nil {
+		return nil, errors.New("violation has no log")
+	}
+	id, err := ct.KeyID(v.Log.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sct, err := ct.SerializeSCT(v.SCT)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := ct.SerializeMerkleTreeLeaf(v.Leaf)
+	if err != nil {
+		return nil, err
+	}
+	sth := v.STH
+	sth.LogID = id
+	e := &Evidence{
+		Version:   EvidenceVersion,
+		Violation: MissedMMD,
+		LogID:     id,
+		LogURL:    v.Log.URL,
+		STHs:      []ct.SignedTreeHead{sth},
+		SCTs:      [][]byte{sct},
+		Entries:   []EvidenceEntry{{LeafInput: leaf}},
+		MMD:       uint64(v.Log.MMD / time.Millisecond),
+		Observed:  time.Now().UTC(),
+	}
+	if v.Proof != nil {
+		e.InclusionProof = &EvidenceInclusionProof{LeafIndex: v.Proof.LeafIndex, AuditPath: v.Proof.AuditPath}
+	}
+	return e, nil
+}
+
+// MMDAuditorOptions holds optional configuration for an MMDAuditor.
+type MMDAuditorOptions struct {
+	// How often Run checks the SCTs tracked.  Zero means
+	// DefaultPollInterval.
+	Interval time.Duration
+	// Options for the LogClient used for each log.
+	ClientOptions client.Options
+}
+
+// trackedSCT is an SCT an MMDAuditor is waiting to see incorporated.
+type trackedSCT struct {
+	sct      ct.SignedCertificateTimestamp
+	entry    ct.LogEntry
+	deadline uint64 // In ms since the epoch.
+}
+
+// mmdLog is a log whose SCTs an MMDAuditor tracks.
+type mmdLog struct {
+	info     client.LogInfo
+	client   *client.LogClient
+	verifier *ct.SignatureVerifier
+	mu       sync.Mutex
+	// The SCTs not yet seen incorporated, by the hashes of their leaves.
+	pending map[[sha256.Size]byte]*trackedSCT
+}
+
+// MMDAuditor tracks SCTs, e.g. found by scanning or received as SCT feedback,
+// and checks that their logs incorporate their entries into their trees within
+// their Maximum Merge Delays.  Once an SCT's deadline has passed, the auditor
+// asks for a proof that its entry is included in the log's latest STH, and
+// reports an MMDViolation if there isn't one.
+type MMDAuditor struct {
+	logs       map[ct.SHA256Hash]*mmdLog
+	violations chan<- MMDViolation
+	opts       MMDAuditorOptions
+}
+
+// NewMMDAuditor returns an MMDAuditor for the SCTs of logs, whose public keys
+// and MMDs must be set, which sends MMDViolations to violations.  The
+// violations must be read, or the auditor stalls.
+func NewMMDAuditor(logs []client.LogInfo, violations chan<- MMDViolation, opts MMDAuditorOptions) (*MMDAuditor, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultPollInterval
+	}
+	a := &MMDAuditor{logs: make(map[ct.SHA256Hash]*mmdLog), violations: violations, opts: opts}
+	for _, l := range logs {
+		if l.PublicKey == nil {
+			return nil, fmt.Errorf("log %s has no public key", l.URL)
+		}
+		if l.MMD <= 0 {
+			return nil, fmt.Errorf("log %s has no MMD", l.URL)
+		}
+		v, err := ct.NewSignatureVerifier(l.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("log %s: %v", l.URL, err)
+		}
+		id, err := ct.KeyID(l.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("log %s: %v", l.URL, err)
+		}
+		a.logs[id] = &mmdLog{
+			info:     l,
+			client:   client.NewWithOptions(l.URL, opts.ClientOptions),
+			verifier: v,
+			pending:  make(map[[sha256.Size]byte]*trackedSCT),
+		}
+	}
+	return a, nil
+}
+
+// Track starts tracking sct, which must be validly signed by a known log over
+// the entry leaf, as it is when it comes from scanning the log.
+func (a *MMDAuditor) Track(sct ct.SignedCertificateTimestamp, leaf ct.MerkleTreeLeaf) error {
+	l, ok := a.logs[sct.LogID]
+	if !ok {
+		return fmt.Errorf("SCT from unknown log ID %s", sct.LogID.Base64String())
+	}
+	entry := ct.LogEntry{Leaf: leaf}
+	if err := l.verifier.VerifySCTSignature(sct, entry); err != nil {
+		return err
+	}
+	return l.track(sct, entry)
+}
+
+// TrackChain starts tracking sct, which must be validly signed by a known log
+// for chain, e.g. as received as SCT feedback.  The SCT may be for the chain's
+// leaf certificate or, if it was embedded in it, for the precertificate the
+// leaf was issued from, in which case the chain must include the issuer.
+func (a *MMDAuditor) TrackChain(sct ct.SignedCertificateTimestamp, chain []*x509.Certificate) error {
+	l, ok := a.logs[sct.LogID]
+	if !ok {
+		return fmt.Errorf("SCT from unknown log ID %s", sct.LogID.Base64String())
+	}
+	if len(chain) == 0 {
+		return errors.New("empty chain")
+	}
+	entry := ct.LogEntry{
+		Leaf: ct.MerkleTreeLeaf{
+			Version:  ct.V1,
+			LeafType: ct.TimestampedEntryLeafType,
+			TimestampedEntry: ct.TimestampedEntry{
+				Timestamp:  sct.Timestamp,
+				EntryType:  ct.X509LogEntryType,
+				X509Entry:  chain[0].Raw,
+				Extensions: sct.Extensions,
+			},
+		},
+	}
+	err := l.verifier.VerifySCTSignature(sct, entry)
+	if err != nil && len(chain) > 1 {
+		tbs, tbsErr := x509.BuildPrecertTBS(chain[0].RawTBSCertificate)
+		if tbsErr != nil {
+			return err
+		}
+		te := &entry.Leaf.TimestampedEntry
+		te.EntryType = ct.PrecertLogEntryType
+		te.X509Entry = nil
+		te.PrecertEntry = ct.PreCert{
+			IssuerKeyHash:  sha256.Sum256(chain[1].RawSubjectPublicKeyInfo),
+			TBSCertificate: tbs,
+		}
+		err = l.verifier.VerifySCTSignature(sct, entry)
+	}
+	if err != nil {
+		return err
+	}
+	return l.track(sct, entry)
+}
+
+func (l *mmdLog) track(sct ct.SignedCertificateTimestamp, entry ct.LogEntry) error {
+	leaf, err := ct.SerializeMerkleTreeLeaf(entry.Leaf)
+	if err != nil {
+		return err
+	}
+	var hash [sha256.Size]byte
+	copy(hash[:], merkle.NewSHA256TreeHasher().HashLeaf(leaf))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.pending[hash]; !ok {
+		l.pending[hash] = &trackedSCT{
+			sct:      sct,
+			entry:    entry,
+			deadline: sct.Timestamp + uint64(l.info.MMD/time.Millisecond),
+		}
+	}
+	return nil
+}
+
+// Pending returns the number of SCTs tracked whose entries haven't been seen
+// incorporated yet.
+func (a *MMDAuditor) Pending() int {
+	n := 0
+	for _, l := range a.logs {
+		l.mu.Lock()
+		n += len(l.pending)
+		l.mu.Unlock()
+	}
+	return n
+}
+
+// Run checks the SCTs tracked each interval, starting straight away, until
+// ctx is done, and then returns ctx's error.
+func (a *MMDAuditor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(a.opts.Interval)
+	defer ticker.Stop()
+	for {
+		a.Check(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Check fetches the latest STH of each log with SCTs whose deadlines it
+// passes, and checks that their entries are included in it.  SCTs whose
+// entries are included are no longer tracked; nor are those reported as
+// MMDViolations.  It returns the first error which stopped SCTs being
+// checked; they are checked again next time.
+func (a *MMDAuditor) Check(ctx context.Context) error {
+	var firstErr error
+	for _, l := range a.logs {
+		if err := a.check(ctx, l); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("log %s: %v", l.info.URL, err)
+		}
+	}
+	return firstErr
+}
+
+func (a *MMDAuditor) check(ctx context.Context, l *mmdLog) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) == 0 {
+		return nil
+	}
+	sth, err := l.client.GetSTHWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	if err := l.verifier.VerifySTHSignature(*sth); err != nil {
+		return err
+	}
+	var firstErr error
+	for hash, t := range l.pending {
+		if t.deadline > sth.Timestamp {
+			// The log may yet incorporate it.
+			continue
+		}
+		proof, err := client.ProveInclusionWith(ctx, l.client, &t.entry, *sth)
+		if err == nil {
+			delete(l.pending, hash)
+			continue
+		}
+		v := MMDViolation{Log: &l.info, SCT: t.sct, Leaf: t.entry.Leaf, STH: *sth, Proof: proof, Err: err}
+		switch err := err.(type) {
+		case client.InclusionError:
+			v.Proof = err.Proof
+		case client.HTTPError:
+			if !notIncluded(err) {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+		default:
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delete(l.pending, hash)
+		select {
+		case a.violations <- v:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return firstErr
+}
+
+// notIncluded reports whether err is the log saying it has no such entry,
+// rather than failing to answer.
+func notIncluded(err client.HTTPError) bool {
+	return err.StatusCode == http.StatusBadRequest || err.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,154 @@
+package monitor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/testlog"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// testChain returns the chain of a certificate issued by a new root, and the
+// precertificate the certificate could have been issued from.
+func testChain(t *testing.T) (chain []*x509.Certificate, precert []byte) {
+	ca := testcert.NewCA(t, "Test Root", nil)
+	tmpl := testcert.LeafTemplate("leaf.example.com")
+	key := testcert.NewKey(t)
+	cert := testcert.Issue(t, tmpl, key, ca)
+	precert, err := client.CreatePrecertificate(rand.Reader, tmpl, ca.Cert, &key.PublicKey, ca.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*x509.Certificate{cert, ca.Cert}, precert
+}
+
+func addChain(t *testing.T, l *testlog.Log, chain []*x509.Certificate) ct.SignedCertificateTimestamp {
+	sct, err := l.AddChain([]ct.ASN1Cert{chain[0].Raw, chain[1].Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *sct
+}
+
+func TestMMDAuditor(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	// The log incorporates what it issues SCTs for straight away, but it
+	// also issues SCTs, from other instances, which it never incorporates.
+	l, err := testlog.New(testlog.Options{Key: key, Now: testlog.SteppingClock(start, time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost, err := testlog.New(testlog.Options{Key: key, Now: testlog.SteppingClock(start, time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	future, err := testlog.New(testlog.Options{Key: key, Now: testlog.SteppingClock(start.Add(24*time.Hour), time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(l)
+	defer hs.Close()
+	info := client.LogInfo{URL: hs.URL, PublicKey: &key.PublicKey, MMD: time.Minute}
+
+	violations := make(chan MMDViolation, 2)
+	a, err := NewMMDAuditor([]client.LogInfo{info}, violations, MMDAuditorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	chain, precert := testChain(t)
+	precertSCT, err := l.AddPreChain([]ct.ASN1Cert{precert, chain[1].Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An SCT embedded in the certificate is for the precertificate.
+	if err := a.TrackChain(*precertSCT, chain); err != nil {
+		t.Errorf("TrackChain(precertificate SCT)=%v", err)
+	}
+	lostChain, _ := testChain(t)
+	lostSCT := addChain(t, lost, lostChain)
+	if err := a.TrackChain(lostSCT, lostChain); err != nil {
+		t.Errorf("TrackChain(lost SCT)=%v", err)
+	}
+	futureChain, _ := testChain(t)
+	if err := a.TrackChain(addChain(t, future, futureChain), futureChain); err != nil {
+		t.Errorf("TrackChain(future SCT)=%v", err)
+	}
+	if err := a.TrackChain(lostSCT, chain); err == nil {
+		t.Error("TrackChain(SCT for other chain)=nil, want error")
+	}
+	otherLog, err := testlog.New(testlog.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.TrackChain(addChain(t, otherLog, chain), chain); err == nil {
+		t.Error("TrackChain(SCT from unknown log)=nil, want error")
+	}
+	if got := a.Pending(); got != 3 {
+		t.Errorf("Pending()=%d, want 3", got)
+	}
+
+	if err := a.Check(ctx); err != nil {
+		t.Errorf("Check()=%v", err)
+	}
+	if got := a.Pending(); got != 1 {
+		t.Errorf("Pending() after Check()=%d, want 1", got)
+	}
+	var v MMDViolation
+	select {
+	case v = <-violations:
+	default:
+		t.Fatal("Check() reported no violations")
+	}
+	select {
+	case extra := <-violations:
+		t.Errorf("Check() reported violation for SCT with timestamp %d too", extra.SCT.Timestamp)
+	default:
+	}
+	if v.SCT.Timestamp != lostSCT.Timestamp || v.Proof != nil {
+		t.Errorf("Check() reported violation for SCT with timestamp %d and proof %v, want the lost SCT's %d and no proof", v.SCT.Timestamp, v.Proof, lostSCT.Timestamp)
+	}
+
+	e, err := v.Evidence()
+	if err != nil {
+		t.Fatalf("Evidence()=_,%v", err)
+	}
+	if err := e.Verify(&key.PublicKey); err != nil {
+		t.Errorf("Verify()=%v", err)
+	}
+	lc := client.New(hs.URL)
+	if err := e.Confirm(ctx, lc); err != nil {
+		t.Errorf("Confirm()=%v", err)
+	}
+	// The evidence isn't confirmed once the log incorporates the entry,
+	// when it issues its own SCT for it.
+	v.SCT = addChain(t, l, lostChain)
+	v.Leaf.TimestampedEntry.Timestamp = v.SCT.Timestamp
+	sth, err := l.STH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.STH = *sth
+	if e, err = v.Evidence(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Verify(&key.PublicKey); err != nil {
+		t.Errorf("Verify(incorporated)=%v", err)
+	}
+	if err := e.Confirm(ctx, lc); err == nil {
+		t.Error("Confirm(incorporated)=nil, want error")
+	}
+}
@@ -0,0 +1,259 @@
+package monitor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"golang.org/x/net/context"
+)
+
+// DefaultMaxViews is how many views of each log a SplitViewDetector keeps,
+// unless its options say otherwise.
+const DefaultMaxViews = 1000
+
+// AlarmType is the kind of split view an Alarm reports.
+type AlarmType int
+
+// Alarm types.
+const (
+	// Two STHs for the same tree size have different root hashes.
+	RootsDiffer AlarmType = iota
+	// The log's consistency proof between two STHs doesn't verify.
+	ProofInvalid
+)
+
+var alarmTypeStrings = map[AlarmType]string{
+	RootsDiffer:  "RootsDiffer",
+	ProofInvalid: "ProofInvalid",
+}
+
+func (t AlarmType) String() string {
+	if s, ok := alarmTypeStrings[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("AlarmType %d", t)
+}
+
+// Observation is an STH as seen from one vantage point.
+type Observation struct {
+	// Where the STH came from, e.g. "direct", "follower" or the URL of
+	// a gossip point.
+	Source string
+	STH    ct.SignedTreeHead
+	// When the STH was observed.
+	Time time.Time
+}
+
+// Alarm is raised by a SplitViewDetector when a log has presented views of
+// its tree which can't both be right.  First and Second are both validly
+// signed by the log, so together with Proof they are evidence that it has
+// misbehaved.
+type Alarm struct {
+	Type AlarmType
+	Log  *client.LogInfo
+	// The views which conflict, the smaller tree first.
+	First, Second Observation
+	// The consistency proof between First and Second the log returned,
+	// for ProofInvalid alarms.
+	Proof [][]byte
+	Err   error
+}
+
+// SplitViewOptions holds optional configuration for a SplitViewDetector.
+type SplitViewOptions struct {
+	// How many distinct views of each log are kept to compare new STHs
+	// with.  Zero means DefaultMaxViews.
+	MaxViews int
+	// Options for the LogClient used to fetch proofs from each log.
+	ClientOptions client.Options
+}
+
+// auditedLog is a log whose views a SplitViewDetector compares.
+type auditedLog struct {
+	info     client.LogInfo
+	client   *client.LogClient
+	verifier *ct.SignatureVerifier
+	mu       sync.Mutex
+	// The distinct views seen, by increasing tree size.  Each is
+	// consistent with the next, so all of them are consistent.
+	views []Observation
+}
+
+// SplitViewDetector checks that the STHs of a set of logs seen from different
+// vantage points, e.g. polled directly, from an STHFollower's Events or from
+// gossip, are all views of the same append-only tree.  When they aren't, the
+// log has presented a split view, and the detector raises an Alarm.
+//
+// Rather than checking a consistency proof between every pair of STHs, the
+// detector keeps the views it has verified in order of tree size and checks
+// each new STH against its neighbours: consistency is transitive, so that
+// suffices to show the new STH is consistent with all of them.
+type SplitViewDetector struct {
+	logs   []*auditedLog
+	byID   map[ct.SHA256Hash]*auditedLog
+	alarms chan<- Alarm
+	opts   SplitViewOptions
+}
+
+// NewSplitViewDetector returns a SplitViewDetector which compares the views of
+// logs, whose public keys must be set, and sends Alarms to alarms.  The alarms
+// must be read, or the detector stalls.
+func NewSplitViewDetector(logs []client.LogInfo, alarms chan<- Alarm, opts SplitViewOptions) (*SplitViewDetector, error) {
+	if opts.MaxViews <= 0 {
+		opts.MaxViews = DefaultMaxViews
+	}
+	d := &SplitViewDetector{byID: make(map[ct.SHA256Hash]*auditedLog), alarms: alarms, opts: opts}
+	for _, l := range logs {
+		if l.PublicKey == nil {
+			return nil, fmt.Errorf("log %s has no public key", l.URL)
+		}
+		v, err := ct.NewSignatureVerifier(l.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("log %s: %v", l.URL, err)
+		}
+		id, err := ct.KeyID(l.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("log %s: %v", l.URL, err)
+		}
+		a := &auditedLog{
+			info:     l,
+			client:   client.NewWithOptions(l.URL, opts.ClientOptions),
+			verifier: v,
+		}
+		d.logs = append(d.logs, a)
+		d.byID[id] = a
+	}
+	return d, nil
+}
+
+// Observe checks sth, seen from source, against the other views of its log,
+// which is identified by the STH's LogID, and raises an Alarm if they
+// conflict.  An error is returned if the STH isn't validly signed by a known
+// log, or if it couldn't be checked; it isn't kept in that case, so it should
+// be observed again later.
+func (d *SplitViewDetector) Observe(ctx context.Context, source string, sth ct.SignedTreeHead) error {
+	l, ok := d.byID[sth.LogID]
+	if !ok {
+		return fmt.Errorf("STH from unknown log ID %s", sth.LogID.Base64String())
+	}
+	return d.observe(ctx, l, Observation{Source: source, STH: sth, Time: time.Now()})
+}
+
+// PollLogs fetches the STH of every log directly, and observes them with the
+// source "direct".  It returns the first error encountered.
+func (d *SplitViewDetector) PollLogs(ctx context.Context) error {
+	var firstErr error
+	for _, l := range d.logs {
+		sth, err := l.client.GetSTHWithContext(ctx)
+		if err == nil {
+			err = d.observe(ctx, l, Observation{Source: "direct", STH: *sth, Time: time.Now()})
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("log %s: %v", l.info.URL, err)
+		}
+	}
+	return firstErr
+}
+
+// WatchEvents observes the STHs of the STHUpdated events from an STHFollower,
+// with the source "follower", until events is closed or ctx is done.  Events
+// for logs the detector doesn't know are ignored.
+func (d *SplitViewDetector) WatchEvents(ctx context.Context, events <-chan Event) error {
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if ev.Type != STHUpdated || ev.STH == nil || ev.Log == nil {
+				continue
+			}
+			for _, l := range d.logs {
+				if l.info.URL == ev.Log.URL {
+					d.observe(ctx, l, Observation{Source: "follower", STH: *ev.STH, Time: time.Now()})
+				}
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Views returns the distinct, mutually consistent views of the log with ID
+// logID which the detector has verified, by increasing tree size.
+func (d *SplitViewDetector) Views(logID ct.SHA256Hash) []Observation {
+	l, ok := d.byID[logID]
+	if !ok {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Observation(nil), l.views...)
+}
+
+func (d *SplitViewDetector) observe(ctx context.Context, l *auditedLog, obs Observation) error {
+	if err := l.verifier.VerifySTHSignature(obs.STH); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	size := obs.STH.TreeSize
+	i := sort.Search(len(l.views), func(i int) bool { return l.views[i].STH.TreeSize >= size })
+	if i < len(l.views) && l.views[i].STH.TreeSize == size {
+		if bytes.Equal(l.views[i].STH.SHA256RootHash[:], obs.STH.SHA256RootHash[:]) {
+			// The same view as one already seen.
+			return nil
+		}
+		d.raise(ctx, Alarm{
+			Type:   RootsDiffer,
+			Log:    &l.info,
+			First:  l.views[i],
+			Second: obs,
+			Err:    errors.New("STHs for the same tree size have different root hashes"),
+		})
+		return nil
+	}
+	var neighbours []Observation
+	if i > 0 {
+		neighbours = append(neighbours, l.views[i-1])
+	}
+	if i < len(l.views) {
+		neighbours = append(neighbours, l.views[i])
+	}
+	for _, n := range neighbours {
+		if _, err := l.client.VerifyConsistency(ctx, n.STH, obs.STH); err != nil {
+			cerr, ok := err.(client.ConsistencyError)
+			if !ok {
+				return err
+			}
+			first, second := n, obs
+			if first.STH.TreeSize > second.STH.TreeSize {
+				first, second = second, first
+			}
+			d.raise(ctx, Alarm{Type: ProofInvalid, Log: &l.info, First: first, Second: second, Proof: cerr.Proof, Err: cerr.Err})
+			return nil
+		}
+	}
+	l.views = append(l.views, Observation{})
+	copy(l.views[i+1:], l.views[i:])
+	l.views[i] = obs
+	if len(l.views) > d.opts.MaxViews {
+		// Dropping any view leaves the rest consistent with their
+		// neighbours; the smallest trees are the least interesting.
+		l.views = l.views[1:]
+	}
+	return nil
+}
+
+func (d *SplitViewDetector) raise(ctx context.Context, a Alarm) {
+	select {
+	case d.alarms <- a:
+	case <-ctx.Done():
+	}
+}
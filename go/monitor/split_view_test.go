@@ -0,0 +1,149 @@
+package monitor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/testlog"
+	"golang.org/x/net/context"
+)
+
+// addCerts adds n self-signed certificates to l.
+func addCerts(t *testing.T, l *testlog.Log, n int) {
+	key := testcert.NewKey(t)
+	for i := 0; i < n; i++ {
+		der := testcert.Leaf(t, "test.example.com", key, nil).Raw
+		if _, err := l.AddChain([]ct.ASN1Cert{der}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func mustSTH(t *testing.T, l *testlog.Log) ct.SignedTreeHead {
+	sth, err := l.STH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *sth
+}
+
+func TestSplitViewDetector(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The log shows one view of its tree to the detector, and another,
+	// from fork, to some of the vantage points.
+	l, err := testlog.New(testlog.Options{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork, err := testlog.New(testlog.Options{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := testlog.New(testlog.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(l)
+	defer hs.Close()
+
+	addCerts(t, l, 2)
+	sth2 := mustSTH(t, l)
+	addCerts(t, l, 3)
+	sth5 := mustSTH(t, l)
+	addCerts(t, fork, 1)
+	fork1 := mustSTH(t, fork)
+	addCerts(t, fork, 4)
+	fork5 := mustSTH(t, fork)
+	forged := sth5
+	forged.TreeSize = 6
+
+	alarms := make(chan Alarm, 1)
+	d, err := NewSplitViewDetector([]client.LogInfo{{URL: hs.URL, PublicKey: &key.PublicKey}}, alarms, SplitViewOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := d.PollLogs(ctx); err != nil {
+		t.Fatalf("PollLogs()=%v", err)
+	}
+
+	for i, test := range []struct {
+		sth     ct.SignedTreeHead
+		wantErr bool
+		want    AlarmType // -1 if no alarm is wanted.
+		// The tree sizes of the conflicting views.
+		wantSizes [2]uint64
+	}{
+		{sth: sth2, want: -1},
+		{sth: sth5, want: -1},
+		{sth: fork5, want: RootsDiffer, wantSizes: [2]uint64{5, 5}},
+		{sth: fork1, want: ProofInvalid, wantSizes: [2]uint64{1, 2}},
+		{sth: mustSTH(t, other), wantErr: true, want: -1},
+		{sth: forged, wantErr: true, want: -1},
+	} {
+		err := d.Observe(ctx, "gossip", test.sth)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("#%d: Observe()=%v, want error %v", i, err, test.wantErr)
+		}
+		select {
+		case a := <-alarms:
+			if a.Type != test.want {
+				t.Errorf("#%d: got %s alarm (%v), want %s", i, a.Type, a.Err, test.want)
+			}
+			if got := [2]uint64{a.First.STH.TreeSize, a.Second.STH.TreeSize}; got != test.wantSizes {
+				t.Errorf("#%d: alarm is for tree sizes %v, want %v", i, got, test.wantSizes)
+			}
+			if a.Second.Source != "gossip" {
+				t.Errorf("#%d: alarm's second view came from %q, want gossip", i, a.Second.Source)
+			}
+			if a.Type == ProofInvalid && len(a.Proof) == 0 {
+				t.Errorf("#%d: ProofInvalid alarm has no proof", i)
+			}
+		default:
+			if test.want != -1 {
+				t.Errorf("#%d: got no alarm, want %s", i, test.want)
+			}
+		}
+	}
+
+	views := d.Views(l.LogID())
+	if len(views) != 2 || views[0].STH.TreeSize != 2 || views[1].STH.TreeSize != 5 {
+		t.Errorf("Views() returned %d views, want those of trees of size 2 and 5", len(views))
+	}
+}
+
+func TestSplitViewDetectorMaxViews(t *testing.T) {
+	l, err := testlog.New(testlog.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(l)
+	defer hs.Close()
+	d, err := NewSplitViewDetector([]client.LogInfo{{URL: hs.URL, PublicKey: l.PublicKey()}}, make(chan Alarm), SplitViewOptions{MaxViews: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan Event, 3)
+	for i := 0; i < 3; i++ {
+		addCerts(t, l, 1)
+		sth := mustSTH(t, l)
+		events <- Event{Type: STHUpdated, Log: &client.LogInfo{URL: hs.URL}, STH: &sth}
+	}
+	close(events)
+	if err := d.WatchEvents(context.Background(), events); err != nil {
+		t.Fatalf("WatchEvents()=%v", err)
+	}
+	views := d.Views(l.LogID())
+	if len(views) != 2 || views[0].STH.TreeSize != 2 || views[0].Source != "follower" {
+		t.Errorf("Views()=%+v, want the follower's views of trees of size 2 and 3", views)
+	}
+}
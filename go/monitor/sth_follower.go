@@ -0,0 +1,258 @@
+// Package monitor contains building blocks for monitoring CT logs.
+package monitor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/storage"
+	"golang.org/x/net/context"
+)
+
+// DefaultPollInterval is how often an STHFollower polls each log, unless its
+// options say otherwise.
+const DefaultPollInterval = time.Minute
+
+// EventType is the kind of thing an Event reports.
+type EventType int
+
+// Event types.  All but STHUpdated and the failures to fetch or store STHs are
+// evidence that the log has misbehaved.
+const (
+	// A new STH was verified and stored.
+	STHUpdated EventType = iota
+	// The log's STH couldn't be fetched, or its consistency proof couldn't
+	// be fetched.
+	FetchFailed
+	// The STH's signature doesn't verify with the log's key.
+	InvalidSignature
+	// The STH is older than the latest verified STH.
+	TimestampRegressed
+	// The STH is newer than the latest verified STH, but its tree is
+	// smaller.
+	TreeShrank
+	// The STH is for a tree of the same size as the latest verified STH,
+	// or has the same timestamp, but they differ.
+	RootMismatch
+	// The log's consistency proof doesn't show that the STH is an
+	// extension of the latest verified STH.
+	Inconsistent
+	// The verified STH, or the proof of its consistency, couldn't be
+	// stored.
+	StoreFailed
+)
+
+var eventTypeStrings = map[EventType]string{
+	STHUpdated:         "STHUpdated",
+	FetchFailed:        "FetchFailed",
+	InvalidSignature:   "InvalidSignature",
+	TimestampRegressed: "TimestampRegressed",
+	TreeShrank:         "TreeShrank",
+	RootMismatch:       "RootMismatch",
+	Inconsistent:       "Inconsistent",
+	StoreFailed:        "StoreFailed",
+}
+
+func (t EventType) String() string {
+	if s, ok := eventTypeStrings[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("EventType %d", t)
+}
+
+// Event is emitted by an STHFollower each time it updates a log's STH, or
+// fails to.
+type Event struct {
+	Type EventType
+	Log  *client.LogInfo
+	// The STH the log returned, or nil if none was fetched.
+	STH *ct.SignedTreeHead
+	// The latest verified STH before STH was fetched, or nil if there was
+	// none.
+	Previous *ct.SignedTreeHead
+	Err      error
+}
+
+// STHFollowerOptions holds optional configuration for an STHFollower.
+type STHFollowerOptions struct {
+	// How often each log is polled.  Zero means DefaultPollInterval.
+	Interval time.Duration
+	// Where the latest verified STH of each log is kept.  If nil, STHs are
+	// kept in memory.
+	Store STHStore
+	// If set, a consistency proof between each new STH and the latest
+	// verified STH is fetched from the log and checked.
+	VerifyConsistency bool
+	// If set, the consistency proofs checked are kept in Proofs, as
+	// evidence of how the logs' trees have grown.
+	Proofs storage.ProofStore
+	// Options for the LogClient used for each log.
+	ClientOptions client.Options
+}
+
+// followedLog is a log which an STHFollower follows.
+type followedLog struct {
+	info     client.LogInfo
+	client   *client.LogClient
+	verifier *ct.SignatureVerifier
+	// Held while the log is polled, so that its polls don't race.
+	mu sync.Mutex
+}
+
+// STHFollower periodically fetches the STHs of a set of logs, and checks that
+// each new STH is properly signed and consistent with the latest one it
+// verified, which it persists to an STHStore.  It reports what it finds as
+// Events.
+type STHFollower struct {
+	logs   []*followedLog
+	events chan<- Event
+	opts   STHFollowerOptions
+}
+
+// NewSTHFollower returns an STHFollower which follows logs, whose public keys
+// must be set, and sends Events to events.  The events must be read, or the
+// follower stalls.
+func NewSTHFollower(logs []client.LogInfo, events chan<- Event, opts STHFollowerOptions) (*STHFollower, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultPollInterval
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemorySTHStore()
+	}
+	f := &STHFollower{events: events, opts: opts}
+	for _, l := range logs {
+		if l.PublicKey == nil {
+			return nil, fmt.Errorf("log %s has no public key", l.URL)
+		}
+		v, err := ct.NewSignatureVerifier(l.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("log %s: %v", l.URL, err)
+		}
+		f.logs = append(f.logs, &followedLog{
+			info:     l,
+			client:   client.NewWithOptions(l.URL, opts.ClientOptions),
+			verifier: v,
+		})
+	}
+	return f, nil
+}
+
+// Run polls every log each interval, starting straight away, until ctx is
+// done, and then returns ctx's error.
+func (f *STHFollower) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, l := range f.logs {
+		wg.Add(1)
+		go func(l *followedLog) {
+			defer wg.Done()
+			ticker := time.NewTicker(f.opts.Interval)
+			defer ticker.Stop()
+			for {
+				f.poll(ctx, l)
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(l)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// Poll polls every log once, and returns once they have all been polled and
+// their Events sent.
+func (f *STHFollower) Poll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, l := range f.logs {
+		wg.Add(1)
+		go func(l *followedLog) {
+			defer wg.Done()
+			f.poll(ctx, l)
+		}(l)
+	}
+	wg.Wait()
+}
+
+func (f *STHFollower) poll(ctx context.Context, l *followedLog) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ev := f.update(ctx, l); ev != nil {
+		ev.Log = &l.info
+		select {
+		case f.events <- *ev:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// update fetches and checks the log's STH, and stores it if it is new and
+// valid.  It returns the Event to report, if there is one.
+func (f *STHFollower) update(ctx context.Context, l *followedLog) *Event {
+	prev, err := f.opts.Store.LatestSTH(l.info.URL)
+	if err != nil {
+		return &Event{Type: FetchFailed, Err: fmt.Errorf("failed to load latest STH: %v", err)}
+	}
+	sth, err := l.client.GetSTHWithContext(ctx)
+	if err != nil {
+		return &Event{Type: FetchFailed, Previous: prev, Err: err}
+	}
+	ev := &Event{STH: sth, Previous: prev}
+	if err := l.verifier.VerifySTHSignature(*sth); err != nil {
+		ev.Type, ev.Err = InvalidSignature, err
+		return ev
+	}
+
+	if prev != nil {
+		sameRoot := bytes.Equal(sth.SHA256RootHash[:], prev.SHA256RootHash[:])
+		switch {
+		case sth.Timestamp == prev.Timestamp && sth.TreeSize == prev.TreeSize && sameRoot:
+			// The log hasn't produced a new STH.
+			return nil
+		case sth.Timestamp < prev.Timestamp:
+			ev.Type = TimestampRegressed
+			ev.Err = fmt.Errorf("STH timestamp %d is before %d", sth.Timestamp, prev.Timestamp)
+			return ev
+		case sth.TreeSize < prev.TreeSize:
+			ev.Type = TreeShrank
+			ev.Err = fmt.Errorf("tree size %d is smaller than %d", sth.TreeSize, prev.TreeSize)
+			return ev
+		case sth.TreeSize == prev.TreeSize && !sameRoot:
+			ev.Type, ev.Err = RootMismatch, errors.New("STHs for the same tree size have different root hashes")
+			return ev
+		case sth.Timestamp == prev.Timestamp:
+			ev.Type, ev.Err = RootMismatch, errors.New("different STHs have the same timestamp")
+			return ev
+		}
+		if f.opts.VerifyConsistency {
+			proof, err := l.client.VerifyConsistency(ctx, *prev, *sth)
+			if err != nil {
+				ev.Type, ev.Err = FetchFailed, err
+				if _, ok := err.(client.ConsistencyError); ok {
+					ev.Type = Inconsistent
+				}
+				return ev
+			}
+			if f.opts.Proofs != nil {
+				p := storage.ConsistencyProof{LogURL: l.info.URL, ConsistencyProof: *proof, FirstHash: prev.SHA256RootHash, SecondHash: sth.SHA256RootHash}
+				if err := f.opts.Proofs.StoreConsistencyProof(p); err != nil {
+					ev.Type, ev.Err = StoreFailed, err
+					return ev
+				}
+			}
+		}
+	}
+
+	if err := f.opts.Store.StoreSTH(l.info.URL, *sth); err != nil {
+		ev.Type, ev.Err = StoreFailed, err
+		return ev
+	}
+	ev.Type = STHUpdated
+	return ev
+}
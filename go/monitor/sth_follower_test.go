@@ -0,0 +1,229 @@
+package monitor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/storage"
+	"golang.org/x/net/context"
+)
+
+// signSTH returns an STH signed by key.
+func signSTH(t *testing.T, key *ecdsa.PrivateKey, size, timestamp uint64, root byte) ct.SignedTreeHead {
+	sth := ct.SignedTreeHead{Version: ct.V1, TreeSize: size, Timestamp: timestamp}
+	sth.SHA256RootHash[0] = root
+	input, err := ct.SerializeSTHSignatureInput(sth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256(input)
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sth.TreeHeadSignature = ct.DigitallySigned{
+		HashAlgorithm:      ct.SHA256,
+		SignatureAlgorithm: ct.ECDSA,
+		Signature:          sig,
+	}
+	return sth
+}
+
+// fakeSTHLog is a log which serves whatever STH it is told to, and an
+// invalid consistency proof.
+type fakeSTHLog struct {
+	mu  sync.Mutex
+	sth *ct.SignedTreeHead // If nil, get-sth fails.
+}
+
+func (l *fakeSTHLog) set(sth *ct.SignedTreeHead) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sth = sth
+}
+
+func (l *fakeSTHLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case r.URL.Path == client.GetSTHConsistencyPath:
+		w.Write([]byte(`{"consistency":["AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="]}`))
+	case r.URL.Path == client.GetSTHPath && l.sth != nil:
+		json.NewEncoder(w).Encode(l.sth)
+	default:
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}
+}
+
+// proofStore is a storage.ProofStore which keeps the proofs stored in a
+// slice.
+type proofStore struct {
+	mu     sync.Mutex
+	proofs []storage.ConsistencyProof
+}
+
+func (s *proofStore) StoreConsistencyProof(p storage.ConsistencyProof) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.proofs = append(s.proofs, p)
+	return nil
+}
+
+func (s *proofStore) ConsistencyProof(logURL string, first, second uint64) (*storage.ConsistencyProof, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.proofs {
+		if p.LogURL == logURL && p.FirstSize == first && p.SecondSize == second {
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+func TestSTHFollower(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := signSTH(t, key, 10, 1000, 1)
+	second := signSTH(t, key, 12, 2000, 2)
+
+	tests := []struct {
+		sth         *ct.SignedTreeHead
+		consistency bool
+		want        EventType // -1 if no event is wanted.
+		wantLatest  *ct.SignedTreeHead
+	}{
+		{sth: nil, want: FetchFailed},
+		{sth: &first, want: STHUpdated, wantLatest: &first},
+		{sth: &first, want: -1, wantLatest: &first},
+		{sth: &second, want: STHUpdated, wantLatest: &second},
+		{sth: sthPtr(signSTH(t, key, 11, 3000, 3)), want: TreeShrank, wantLatest: &second},
+		{sth: sthPtr(signSTH(t, key, 13, 1500, 3)), want: TimestampRegressed, wantLatest: &second},
+		{sth: sthPtr(signSTH(t, key, 12, 4000, 3)), want: RootMismatch, wantLatest: &second},
+		{sth: sthPtr(signSTH(t, key, 13, 2000, 3)), want: RootMismatch, wantLatest: &second},
+		{sth: sthPtr(signSTH(t, otherKey, 13, 5000, 3)), want: InvalidSignature, wantLatest: &second},
+		{sth: sthPtr(signSTH(t, key, 13, 5000, 3)), consistency: true, want: Inconsistent, wantLatest: &second},
+		// The same root over the same tree is consistent without a proof.
+		{sth: sthPtr(signSTH(t, key, 12, 5000, 2)), consistency: true, want: STHUpdated},
+	}
+
+	log := &fakeSTHLog{}
+	hs := httptest.NewServer(log)
+	defer hs.Close()
+	store := NewMemorySTHStore()
+	proofs := &proofStore{}
+	events := make(chan Event, 1)
+	for i, test := range tests {
+		f, err := NewSTHFollower([]client.LogInfo{{URL: hs.URL, PublicKey: &key.PublicKey}}, events, STHFollowerOptions{
+			Store:             store,
+			VerifyConsistency: test.consistency,
+			Proofs:            proofs,
+			ClientOptions:     client.Options{Backoff: &client.BackoffPolicy{MaxRetries: 1}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.set(test.sth)
+		f.Poll(context.Background())
+		select {
+		case ev := <-events:
+			if ev.Type != test.want {
+				t.Errorf("#%d: got %s event (%v), want %s", i, ev.Type, ev.Err, test.want)
+			}
+			if ev.Log == nil || ev.Log.URL != hs.URL {
+				t.Errorf("#%d: got event for log %+v, want %s", i, ev.Log, hs.URL)
+			}
+		default:
+			if test.want != -1 {
+				t.Errorf("#%d: got no event, want %s", i, test.want)
+			}
+		}
+		latest, err := store.LatestSTH(hs.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := test.wantLatest
+		if want == nil {
+			want = test.sth
+		}
+		switch {
+		case want == nil:
+			if latest != nil {
+				t.Errorf("#%d: latest STH is %+v, want none", i, latest)
+			}
+		case latest == nil || latest.TreeSize != want.TreeSize || latest.Timestamp != want.Timestamp:
+			t.Errorf("#%d: latest STH is %+v, want %+v", i, latest, want)
+		}
+	}
+	// Only the last STH's consistency was verified.
+	if len(proofs.proofs) != 1 {
+		t.Fatalf("got %d consistency proofs stored, want 1", len(proofs.proofs))
+	}
+	if p := proofs.proofs[0]; p.LogURL != hs.URL || p.FirstSize != 12 || p.SecondSize != 12 || p.FirstHash != second.SHA256RootHash || p.SecondHash != second.SHA256RootHash {
+		t.Errorf("got consistency proof %+v, want one between trees of size 12", p)
+	}
+}
+
+func sthPtr(sth ct.SignedTreeHead) *ct.SignedTreeHead {
+	return &sth
+}
+
+func TestSTHFollowerRun(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := &fakeSTHLog{}
+	log.set(sthPtr(signSTH(t, key, 10, 1000, 1)))
+	hs := httptest.NewServer(log)
+	defer hs.Close()
+
+	events := make(chan Event)
+	f, err := NewSTHFollower([]client.LogInfo{{URL: hs.URL, PublicKey: &key.PublicKey}}, events, STHFollowerOptions{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- f.Run(ctx)
+	}()
+	if ev := <-events; ev.Type != STHUpdated {
+		t.Errorf("got %s event, want STHUpdated", ev.Type)
+	}
+	log.set(sthPtr(signSTH(t, key, 11, 2000, 2)))
+	if ev := <-events; ev.Type != STHUpdated || ev.STH.TreeSize != 11 {
+		t.Errorf("got %s event for %+v, want STHUpdated for tree size 11", ev.Type, ev.STH)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run()=%v, want %v", err, context.Canceled)
+	}
+}
+
+func TestNewSTHFollowerRequiresKeys(t *testing.T) {
+	if _, err := NewSTHFollower([]client.LogInfo{{URL: "http://example.com"}}, nil, STHFollowerOptions{}); err == nil {
+		t.Error("NewSTHFollower(log without key)=_,nil, want error")
+	}
+}
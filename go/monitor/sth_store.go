@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/certificate-transparency/go"
+)
+
+// STHStore persists the latest verified STH of each log an STHFollower
+// follows, so that a restarted follower carries on checking the logs'
+// consistency from where it left off.  Logs are identified by their URLs.
+// Implementations must be safe for concurrent use.
+type STHStore interface {
+	// LatestSTH returns the STH last stored for the log, or nil if none
+	// has been.
+	LatestSTH(logURL string) (*ct.SignedTreeHead, error)
+	// StoreSTH records sth as the latest STH of the log.
+	StoreSTH(logURL string, sth ct.SignedTreeHead) error
+}
+
+// MemorySTHStore is an STHStore which keeps STHs in memory, so they are lost
+// when the process exits.
+type MemorySTHStore struct {
+	mu   sync.Mutex
+	sths map[string]ct.SignedTreeHead
+}
+
+// NewMemorySTHStore returns an empty MemorySTHStore.
+func NewMemorySTHStore() *MemorySTHStore {
+	return &MemorySTHStore{sths: make(map[string]ct.SignedTreeHead)}
+}
+
+// LatestSTH implements STHStore.
+func (s *MemorySTHStore) LatestSTH(logURL string) (*ct.SignedTreeHead, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sth, ok := s.sths[logURL]
+	if !ok {
+		return nil, nil
+	}
+	return &sth, nil
+}
+
+// StoreSTH implements STHStore.
+func (s *MemorySTHStore) StoreSTH(logURL string, sth ct.SignedTreeHead) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sths[logURL] = sth
+	return nil
+}
+
+// FileSTHStore is an STHStore which keeps STHs in a JSON file, mapping log
+// URLs to their STHs.  The file is rewritten atomically by renaming a
+// temporary file over it, so it is never left partially written.
+type FileSTHStore struct {
+	path string
+
+	mu   sync.Mutex
+	sths map[string]ct.SignedTreeHead
+}
+
+// NewFileSTHStore returns a FileSTHStore which keeps its STHs in the file at
+// path, loading any already there.  The file needn't exist.
+func NewFileSTHStore(path string) (*FileSTHStore, error) {
+	s := &FileSTHStore{path: path, sths: make(map[string]ct.SignedTreeHead)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.sths); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LatestSTH implements STHStore.
+func (s *FileSTHStore) LatestSTH(logURL string) (*ct.SignedTreeHead, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sth, ok := s.sths[logURL]
+	if !ok {
+		return nil, nil
+	}
+	return &sth, nil
+}
+
+// StoreSTH implements STHStore.
+func (s *FileSTHStore) StoreSTH(logURL string, sth ct.SignedTreeHead) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, had := s.sths[logURL]
+	s.sths[logURL] = sth
+	if err := s.write(); err != nil {
+		// Keep memory consistent with the file.
+		if had {
+			s.sths[logURL] = old
+		} else {
+			delete(s.sths, logURL)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *FileSTHStore) write() error {
+	data, err := json.MarshalIndent(s.sths, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
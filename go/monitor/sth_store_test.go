@@ -0,0 +1,57 @@
+package monitor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileSTHStore(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "sthstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sths.json")
+
+	s, err := NewFileSTHStore(path)
+	if err != nil {
+		t.Fatalf("NewFileSTHStore()=_,%v", err)
+	}
+	if sth, err := s.LatestSTH("http://log"); sth != nil || err != nil {
+		t.Errorf("LatestSTH()=%v,%v, want nil,nil", sth, err)
+	}
+	sth := signSTH(t, key, 10, 1000, 1)
+	if err := s.StoreSTH("http://log", sth); err != nil {
+		t.Fatalf("StoreSTH()=%v", err)
+	}
+
+	// The STH survives reopening the store.
+	s, err = NewFileSTHStore(path)
+	if err != nil {
+		t.Fatalf("NewFileSTHStore()=_,%v", err)
+	}
+	got, err := s.LatestSTH("http://log")
+	if err != nil {
+		t.Fatalf("LatestSTH()=_,%v", err)
+	}
+	if got == nil || !reflect.DeepEqual(*got, sth) {
+		t.Errorf("LatestSTH()=%+v, want %+v", got, sth)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileSTHStore(path); err == nil {
+		t.Error("NewFileSTHStore(garbage)=_,nil, want error")
+	}
+}
@@ -8,18 +8,18 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"regexp"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/chains"
 	"github.com/google/certificate-transparency/go/client"
 	"github.com/google/certificate-transparency/go/preload"
 	"github.com/google/certificate-transparency/go/scanner"
-)
-
-const (
-	// A regex which cannot match any input
-	MatchesNothingRegex = "a^"
+	"golang.org/x/net/context"
 )
 
 var sourceLogUri = flag.String("source_log_uri", "http://ct.googleapis.com/aviator", "CT log base URI to fetch entries from")
@@ -27,24 +27,22 @@ var targetLogUri = flag.String("target_log_uri", "http://example.com/ct", "CT lo
 var batchSize = flag.Int("batch_size", 1000, "Max number of entries to request at per call to get-entries")
 var numWorkers = flag.Int("num_workers", 2, "Number of concurrent matchers")
 var parallelFetch = flag.Int("parallel_fetch", 2, "Number of concurrent GetEntries fetches")
-var parallelSubmit = flag.Int("parallel_submit", 2, "Number of concurrent add-[pre]-chain requests")
+var parallelSubmit = flag.Int("parallel_submit", 2, "Maximum number of concurrent add-[pre]-chain requests; fewer are made while the target log returns 429s")
 var startIndex = flag.Int64("start_index", 0, "Log index to start scanning at")
 var quiet = flag.Bool("quiet", false, "Don't print out extra logging messages, only matches.")
 var sctInputFile = flag.String("sct_file", "", "File to save SCTs & leaf data to")
 var precertsOnly = flag.Bool("precerts_only", false, "Only match precerts")
+var stateFile = flag.String("state_file", "", "File to keep which entries have been submitted to each target log in, so that interrupted preloads resume")
+var saveInterval = flag.Duration("save_interval", 30*time.Second, "How often to save the state to --state_file")
+var canonicalizeChains = flag.Bool("canonicalize_chains", false, "Submit chains deduplicated and ordered from the leaf to the root, rather than as the source log returned them")
 
 func createMatcher() (scanner.Matcher, error) {
-	// Make a "match everything" regex matcher
-	precertRegex := regexp.MustCompile(".*")
-	var certRegex *regexp.Regexp
-	if *precertsOnly {
-		certRegex = regexp.MustCompile(MatchesNothingRegex)
-	} else {
-		certRegex = precertRegex
-	}
+	// Make a "match everything" regex matcher.  Certificates are matched
+	// even with --precerts_only, so that they are recorded as done with.
+	everything := regexp.MustCompile(".*")
 	return scanner.MatchSubjectRegex{
-		CertificateSubjectRegex:    certRegex,
-		PrecertificateSubjectRegex: precertRegex}, nil
+		CertificateSubjectRegex:    everything,
+		PrecertificateSubjectRegex: everything}, nil
 }
 
 func recordSct(addedCerts chan<- *preload.AddedCert, certDer ct.ASN1Cert, sct *ct.SignedCertificateTimestamp) {
@@ -68,15 +66,15 @@ func recordFailure(addedCerts chan<- *preload.AddedCert, certDer ct.ASN1Cert, ad
 func sctWriterJob(addedCerts <-chan *preload.AddedCert, sctWriter io.Writer, wg *sync.WaitGroup) {
 	encoder := gob.NewEncoder(sctWriter)
 
-    numAdded := 0
-    numFailed := 0
+	numAdded := 0
+	numFailed := 0
 
 	for c := range addedCerts {
-      if c.AddedOk {
-        numAdded++
-      } else {
-        numFailed++
-      }
+		if c.AddedOk {
+			numAdded++
+		} else {
+			numFailed++
+		}
 		if encoder != nil {
 			err := encoder.Encode(c)
 			if err != nil {
@@ -84,53 +82,136 @@ func sctWriterJob(addedCerts <-chan *preload.AddedCert, sctWriter io.Writer, wg
 			}
 		}
 	}
-    log.Printf("Added %d certs, %d failed, total: %d\n", numAdded, numFailed, numAdded+numFailed)
+	log.Printf("Added %d certs, %d failed, total: %d\n", numAdded, numFailed, numAdded+numFailed)
 	wg.Done()
 }
 
-func certSubmitterJob(addedCerts chan<- *preload.AddedCert, log_client *client.LogClient, certs <-chan *ct.LogEntry,
-	wg *sync.WaitGroup) {
-	for c := range certs {
-		chain := make([]ct.ASN1Cert, len(c.Chain)+1)
-		chain[0] = c.X509Cert.Raw
-		copy(chain[1:], c.Chain)
-		sct, err := log_client.AddChain(chain)
-		if err != nil {
-			log.Printf("failed to add chain with CN %s: %v\n", c.X509Cert.Subject.CommonName, err)
-			recordFailure(addedCerts, chain[0], err)
-			continue
-		}
-		recordSct(addedCerts, chain[0], sct)
-		if !*quiet {
-			log.Printf("Added chain for CN '%s', SCT: %s\n", c.X509Cert.Subject.CommonName, sct)
+// submitter submits entries to the target log, recording their SCTs and
+// which entries have been submitted.
+type submitter struct {
+	ctx        context.Context
+	logClient  *client.LogClient
+	throttle   *preload.Throttle
+	progress   *preload.Progress
+	addedCerts chan<- *preload.AddedCert
+}
+
+// submit submits chain, for the source log entry at index, unless ctx is done.
+func (s *submitter) submit(index int64, chain []ct.ASN1Cert, precert bool, cn string) {
+	if *canonicalizeChains {
+		chain = canonicalize(index, chain)
+	}
+	if err := s.throttle.Acquire(s.ctx); err != nil {
+		return
+	}
+	var sct *ct.SignedCertificateTimestamp
+	var md *client.ResponseMetadata
+	var err error
+	if precert {
+		sct, md, err = s.logClient.AddPreChainWithMetadata(s.ctx, chain)
+	} else {
+		sct, md, err = s.logClient.AddChainWithMetadata(s.ctx, chain)
+	}
+	s.throttle.Release(md != nil && md.Throttled > 0)
+	if s.ctx.Err() != nil {
+		// Interrupted; the entry is submitted again on resuming.
+		return
+	}
+	if err != nil {
+		log.Printf("failed to add chain for entry %d with CN %s: %v\n", index, cn, err)
+		recordFailure(s.addedCerts, chain[0], err)
+		return
+	}
+	recordSct(s.addedCerts, chain[0], sct)
+	s.progress.MarkSubmitted(index)
+	if !*quiet {
+		log.Printf("Added chain for entry %d with CN '%s', SCT: %s\n", index, cn, sct)
+	}
+}
+
+// canonicalize returns chain as chains.Canonicalize leaves it, or unchanged if
+// it can't be parsed.
+func canonicalize(index int64, chain []ct.ASN1Cert) []ct.ASN1Cert {
+	certs, err := chains.Parse(chain)
+	if err != nil {
+		log.Printf("failed to parse chain for entry %d, submitting it as is: %v\n", index, err)
+		return chain
+	}
+	return chains.Raw(chains.Canonicalize(certs))
+}
+
+func (s *submitter) certSubmitterJob(certs <-chan *ct.LogEntry, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case c, ok := <-certs:
+			if !ok {
+				return
+			}
+			chain := make([]ct.ASN1Cert, len(c.Chain)+1)
+			chain[0] = c.X509Cert.Raw
+			copy(chain[1:], c.Chain)
+			s.submit(c.Index, chain, false, c.X509Cert.Subject.CommonName)
+		case <-s.ctx.Done():
+			return
 		}
 	}
-	wg.Done()
 }
 
-func precertSubmitterJob(addedCerts chan<- *preload.AddedCert, log_client *client.LogClient,
-	precerts <-chan *ct.LogEntry,
-	wg *sync.WaitGroup) {
-	for c := range precerts {
-		sct, err := log_client.AddPreChain(c.Chain)
-		if err != nil {
-			log.Printf("failed to add pre-chain with CN %s: %v", c.Precert.TBSCertificate.Subject.CommonName, err)
-			recordFailure(addedCerts, c.Chain[0], err)
-			continue
+func (s *submitter) precertSubmitterJob(precerts <-chan *ct.LogEntry, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case c, ok := <-precerts:
+			if !ok {
+				return
+			}
+			s.submit(c.Index, c.Chain, true, c.Precert.TBSCertificate.Subject.CommonName)
+		case <-s.ctx.Done():
+			return
 		}
-		recordSct(addedCerts, c.Chain[0], sct)
-		if !*quiet {
-			log.Printf("Added precert chain for CN '%s', SCT: %s\n", c.Precert.TBSCertificate.Subject.CommonName, sct)
+	}
+}
+
+// saveStateJob saves the preload's state every saveInterval until done is
+// closed.
+func saveStateJob(store *preload.FileStateStore, progress *preload.Progress, done <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(*saveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := store.SaveState(*targetLogUri, progress.State()); err != nil {
+				log.Printf("failed to save state to %s: %v", *stateFile, err)
+			}
+		case <-done:
+			return
 		}
 	}
-	wg.Done()
 }
 
 func main() {
 	flag.Parse()
-	var sctFileWriter io.Writer
+	var store *preload.FileStateStore
+	var state *preload.LogState
 	var err error
+	if *stateFile != "" {
+		if store, err = preload.NewFileStateStore(*stateFile); err != nil {
+			log.Fatal(err)
+		}
+		state = store.LoadState(*targetLogUri)
+		if state != nil && state.SourceLogURL != *sourceLogUri {
+			log.Fatalf("%s has the state of preloading %s from %s, not %s", *stateFile, *targetLogUri, state.SourceLogURL, *sourceLogUri)
+		}
+	}
+	var sctFileWriter io.Writer
 	if *sctInputFile != "" {
+		if _, err := os.Stat(*sctInputFile); err == nil && state != nil {
+			// Overwriting it would lose the SCTs of the entries which
+			// aren't submitted again.
+			log.Fatalf("%s exists; resumed preloads need a new --sct_file", *sctInputFile)
+		}
 		sctFileWriter, err = os.Create(*sctInputFile)
 		if err != nil {
 			log.Fatal(err)
@@ -140,12 +221,13 @@ func main() {
 	}
 
 	sctWriter := zlib.NewWriter(sctFileWriter)
-	defer func() {
-		err := sctWriter.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-	}()
+
+	progress := preload.NewProgress(*sourceLogUri, state)
+	start := *startIndex
+	if next := progress.Next(); next > start {
+		log.Printf("Resuming from entry %d", next)
+		start = next
+	}
 
 	fetchLogClient := client.New(*sourceLogUri)
 	matcher, err := createMatcher()
@@ -158,7 +240,7 @@ func main() {
 		BatchSize:     *batchSize,
 		NumWorkers:    *numWorkers,
 		ParallelFetch: *parallelFetch,
-		StartIndex:    *startIndex,
+		StartIndex:    start,
 		Quiet:         *quiet,
 	}
 	scanner := scanner.NewScanner(fetchLogClient, opts)
@@ -171,27 +253,83 @@ func main() {
 	sctWriterWG.Add(1)
 	go sctWriterJob(addedCerts, sctWriter, &sctWriterWG)
 
-	submitLogClient := client.New(*targetLogUri)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &submitter{
+		ctx:        ctx,
+		logClient:  client.New(*targetLogUri),
+		throttle:   preload.NewThrottle(*parallelSubmit),
+		progress:   progress,
+		addedCerts: addedCerts,
+	}
 
 	var submitterWG sync.WaitGroup
 	for w := 0; w < *parallelSubmit; w++ {
 		submitterWG.Add(2)
-		go certSubmitterJob(addedCerts, submitLogClient, certs, &submitterWG)
-		go precertSubmitterJob(addedCerts, submitLogClient, precerts, &submitterWG)
+		go s.certSubmitterJob(certs, &submitterWG)
+		go s.precertSubmitterJob(precerts, &submitterWG)
+	}
+
+	stopSaving := make(chan struct{})
+	var saverWG sync.WaitGroup
+	if store != nil {
+		saverWG.Add(1)
+		go saveStateJob(store, progress, stopSaving, &saverWG)
+	}
+
+	// finish waits for the submissions in flight, records their SCTs and
+	// saves the state.  It runs once, when the scan completes or the
+	// preload is interrupted.
+	var finishOnce sync.Once
+	finish := func() {
+		finishOnce.Do(func() {
+			submitterWG.Wait()
+			close(addedCerts)
+			sctWriterWG.Wait()
+			if err := sctWriter.Close(); err != nil {
+				log.Fatal(err)
+			}
+			close(stopSaving)
+			saverWG.Wait()
+			if store != nil {
+				if err := store.SaveState(*targetLogUri, progress.State()); err != nil {
+					log.Fatalf("failed to save state to %s: %v", *stateFile, err)
+				}
+			}
+		})
 	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		log.Print("Interrupted; saving state")
+		cancel()
+		finish()
+		os.Exit(1)
+	}()
 
 	addChainFunc := func(entry *ct.LogEntry) {
+		if progress.Submitted(entry.Index) {
+			return
+		}
+		if *precertsOnly {
+			// Nothing to submit.
+			progress.MarkSubmitted(entry.Index)
+			return
+		}
 		certs <- entry
 	}
 	addPreChainFunc := func(entry *ct.LogEntry) {
-		precerts <- entry
+		if !progress.Submitted(entry.Index) {
+			precerts <- entry
+		}
 	}
 
-	scanner.Scan(addChainFunc, addPreChainFunc)
+	if err := scanner.Scan(addChainFunc, addPreChainFunc); err != nil {
+		log.Printf("Scan failed: %v", err)
+	}
 
 	close(certs)
 	close(precerts)
-	submitterWG.Wait()
-	close(addedCerts)
-	sctWriterWG.Wait()
+	finish()
 }
@@ -0,0 +1,178 @@
+package preload
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Range is the range of source log entry indices [Start, End).
+type Range struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// LogState records how far preloading a target log from a source log has got.
+type LogState struct {
+	SourceLogURL string `json:"source_log_url"`
+	// The source entries already submitted to the target log, as sorted,
+	// disjoint and non-adjacent ranges.
+	Submitted []Range `json:"submitted"`
+}
+
+// Progress tracks which entries of a source log have been submitted to a
+// target log.  Entries are submitted in parallel, so they complete out of
+// order, and some fail, so the entries submitted are kept as ranges, which
+// stay few however long the preload runs.  A Progress is safe for concurrent
+// use.
+type Progress struct {
+	mu     sync.Mutex
+	source string
+	ranges []Range
+}
+
+// NewProgress returns a Progress for preloading from the log at sourceURL,
+// starting from state, which may be nil if nothing has been submitted yet.
+func NewProgress(sourceURL string, state *LogState) *Progress {
+	p := &Progress{source: sourceURL}
+	if state != nil {
+		p.ranges = append(p.ranges, state.Submitted...)
+	}
+	return p
+}
+
+// find returns the index of the first range which ends after index.
+func (p *Progress) find(index int64) int {
+	return sort.Search(len(p.ranges), func(i int) bool { return p.ranges[i].End > index })
+}
+
+// Submitted reports whether the entry at index has been submitted.
+func (p *Progress) Submitted(index int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := p.find(index)
+	return i < len(p.ranges) && p.ranges[i].Start <= index
+}
+
+// MarkSubmitted records that the entry at index has been submitted.
+func (p *Progress) MarkSubmitted(index int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := p.find(index)
+	if i < len(p.ranges) && p.ranges[i].Start <= index {
+		return
+	}
+	switch {
+	case i > 0 && p.ranges[i-1].End == index && i < len(p.ranges) && p.ranges[i].Start == index+1:
+		// The entry fills the gap between two ranges.
+		p.ranges[i-1].End = p.ranges[i].End
+		p.ranges = append(p.ranges[:i], p.ranges[i+1:]...)
+	case i > 0 && p.ranges[i-1].End == index:
+		p.ranges[i-1].End++
+	case i < len(p.ranges) && p.ranges[i].Start == index+1:
+		p.ranges[i].Start--
+	default:
+		p.ranges = append(p.ranges, Range{})
+		copy(p.ranges[i+1:], p.ranges[i:])
+		p.ranges[i] = Range{Start: index, End: index + 1}
+	}
+}
+
+// Next returns the index of the first entry which hasn't been submitted, from
+// which a preload should resume.
+func (p *Progress) Next() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.ranges) > 0 && p.ranges[0].Start == 0 {
+		return p.ranges[0].End
+	}
+	return 0
+}
+
+// State returns the current state of the preload, to be saved.
+func (p *Progress) State() LogState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return LogState{SourceLogURL: p.source, Submitted: append([]Range(nil), p.ranges...)}
+}
+
+// FileStateStore keeps the LogStates of preloads in a JSON file, mapping
+// target log URLs to their states.  The file is rewritten atomically by
+// renaming a temporary file over it, so it is never left partially written.
+type FileStateStore struct {
+	path string
+
+	mu     sync.Mutex
+	states map[string]LogState
+}
+
+// NewFileStateStore returns a FileStateStore which keeps its states in the
+// file at path, loading any already there.  The file needn't exist.
+func NewFileStateStore(path string) (*FileStateStore, error) {
+	s := &FileStateStore{path: path, states: make(map[string]LogState)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.states); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadState returns the state of the preload to the log at targetURL, or nil
+// if there is none.
+func (s *FileStateStore) LoadState(targetURL string) *LogState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.states[targetURL]
+	if !ok {
+		return nil
+	}
+	return &st
+}
+
+// SaveState saves the state of the preload to the log at targetURL.
+func (s *FileStateStore) SaveState(targetURL string, st LogState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, had := s.states[targetURL]
+	s.states[targetURL] = st
+	if err := s.write(); err != nil {
+		// Keep memory consistent with the file.
+		if had {
+			s.states[targetURL] = old
+		} else {
+			delete(s.states, targetURL)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *FileStateStore) write() error {
+	data, err := json.MarshalIndent(s.states, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,88 @@
+package preload
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	tests := []struct {
+		mark       []int64
+		wantRanges []Range
+		wantNext   int64
+	}{
+		{mark: nil, wantRanges: nil, wantNext: 0},
+		{mark: []int64{0, 1, 2}, wantRanges: []Range{{0, 3}}, wantNext: 3},
+		{mark: []int64{2, 1, 0}, wantRanges: []Range{{0, 3}}, wantNext: 3},
+		{mark: []int64{5, 3}, wantRanges: []Range{{3, 4}, {5, 6}}, wantNext: 0},
+		// Filling the gap merges the ranges either side.
+		{mark: []int64{5, 3, 4}, wantRanges: []Range{{3, 6}}, wantNext: 0},
+		{mark: []int64{1, 0, 0, 9, 3, 2, 8}, wantRanges: []Range{{0, 4}, {8, 10}}, wantNext: 4},
+	}
+	for i, test := range tests {
+		p := NewProgress("https://source.example.com", nil)
+		for _, index := range test.mark {
+			p.MarkSubmitted(index)
+		}
+		st := p.State()
+		if !reflect.DeepEqual(st.Submitted, test.wantRanges) {
+			t.Errorf("#%d: after marking %v, got ranges %v, want %v", i, test.mark, st.Submitted, test.wantRanges)
+		}
+		if got := p.Next(); got != test.wantNext {
+			t.Errorf("#%d: after marking %v, Next()=%d, want %d", i, test.mark, got, test.wantNext)
+		}
+		for _, index := range test.mark {
+			if !p.Submitted(index) {
+				t.Errorf("#%d: Submitted(%d)=false after marking it", i, index)
+			}
+		}
+		if p.Submitted(100) {
+			t.Errorf("#%d: Submitted(100)=true, want false", i)
+		}
+		// Progress resumes from its saved state.
+		resumed := NewProgress(st.SourceLogURL, &st)
+		if got := resumed.State(); !reflect.DeepEqual(got, st) {
+			t.Errorf("#%d: resumed state %v, want %v", i, got, st)
+		}
+	}
+}
+
+func TestFileStateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "preload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	s, err := NewFileStateStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStateStore(missing file)=_,%v", err)
+	}
+	if st := s.LoadState("https://target.example.com"); st != nil {
+		t.Errorf("LoadState() from empty store=%v, want nil", st)
+	}
+	want := LogState{SourceLogURL: "https://source.example.com", Submitted: []Range{{0, 10}, {12, 20}}}
+	if err := s.SaveState("https://target.example.com", want); err != nil {
+		t.Fatalf("SaveState()=%v", err)
+	}
+	if s, err = NewFileStateStore(path); err != nil {
+		t.Fatalf("NewFileStateStore()=_,%v", err)
+	}
+	if got := s.LoadState("https://target.example.com"); got == nil || !reflect.DeepEqual(*got, want) {
+		t.Errorf("LoadState() after reopening=%v, want %v", got, want)
+	}
+	if st := s.LoadState("https://other.example.com"); st != nil {
+		t.Errorf("LoadState(other log)=%v, want nil", st)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStateStore(path); err == nil {
+		t.Error("NewFileStateStore(corrupt file)=_,nil, want error")
+	}
+}
@@ -0,0 +1,78 @@
+package preload
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// Throttle bounds the number of submissions in flight to a log, adapting the
+// bound to how hard the log pushes back: each time a submission is throttled
+// (answered with a 429) the bound is halved, and each time as many
+// submissions as the bound succeed without being throttled it goes up by one,
+// up to its maximum.  A Throttle is safe for concurrent use.
+type Throttle struct {
+	max int
+
+	mu        sync.Mutex
+	limit     int
+	inFlight  int
+	successes int
+	// Closed, and replaced, whenever a submission finishes.
+	wake chan struct{}
+}
+
+// NewThrottle returns a Throttle which allows up to max submissions in
+// flight, starting with max.
+func NewThrottle(max int) *Throttle {
+	if max < 1 {
+		max = 1
+	}
+	return &Throttle{max: max, limit: max, wake: make(chan struct{})}
+}
+
+// Acquire blocks until another submission may be made, or ctx is done.  Each
+// successful Acquire must be followed by a Release.
+func (t *Throttle) Acquire(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		if t.inFlight < t.limit {
+			t.inFlight++
+			t.mu.Unlock()
+			return nil
+		}
+		wake := t.wake
+		t.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release records that a submission has finished, and whether the log
+// throttled it.
+func (t *Throttle) Release(throttled bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inFlight--
+	if throttled {
+		t.successes = 0
+		if t.limit /= 2; t.limit < 1 {
+			t.limit = 1
+		}
+	} else if t.successes++; t.successes >= t.limit && t.limit < t.max {
+		t.successes = 0
+		t.limit++
+	}
+	close(t.wake)
+	t.wake = make(chan struct{})
+}
+
+// Limit returns the current bound on the number of submissions in flight.
+func (t *Throttle) Limit() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
@@ -0,0 +1,65 @@
+package preload
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestThrottle(t *testing.T) {
+	th := NewThrottle(4)
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		if err := th.Acquire(ctx); err != nil {
+			t.Fatalf("Acquire() #%d=%v", i, err)
+		}
+	}
+	// A fifth submission waits for one to finish.
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := th.Acquire(short); err == nil {
+		t.Fatal("Acquire() beyond limit=nil, want error")
+	}
+	acquired := make(chan error)
+	go func() { acquired <- th.Acquire(ctx) }()
+	th.Release(false)
+	if err := <-acquired; err != nil {
+		t.Fatalf("Acquire() after Release()=%v", err)
+	}
+
+	tests := []struct {
+		throttled bool
+		wantLimit int
+	}{
+		{throttled: true, wantLimit: 2},
+		{throttled: true, wantLimit: 1},
+		{throttled: true, wantLimit: 1},
+		// The limit goes up by one after that many successes.
+		{throttled: false, wantLimit: 2},
+		{throttled: false, wantLimit: 2},
+		{throttled: false, wantLimit: 3},
+		{throttled: false, wantLimit: 3},
+		{throttled: false, wantLimit: 3},
+		{throttled: false, wantLimit: 4},
+		// But never beyond the maximum.
+		{throttled: false, wantLimit: 4},
+		{throttled: false, wantLimit: 4},
+		{throttled: false, wantLimit: 4},
+		{throttled: false, wantLimit: 4},
+	}
+	// Release the submissions still in flight, and then acquire each
+	// one before releasing it.
+	for i := 0; i < 4; i++ {
+		th.Release(false)
+	}
+	for i, test := range tests {
+		if err := th.Acquire(ctx); err != nil {
+			t.Fatalf("#%d: Acquire()=%v", i, err)
+		}
+		th.Release(test.throttled)
+		if got := th.Limit(); got != test.wantLimit {
+			t.Errorf("#%d: Limit() after Release(%t)=%d, want %d", i, test.throttled, got, test.wantLimit)
+		}
+	}
+}
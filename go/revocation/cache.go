@@ -0,0 +1,63 @@
+package revocation
+
+import (
+	"container/list"
+	"time"
+)
+
+// cache holds up to a fixed number of values until they expire, evicting the
+// least recently used once it is full.  It isn't safe for concurrent use.
+type cache struct {
+	capacity int
+	// The entries, most recently used first, and the elements of the list
+	// holding them by key.
+	order list.List
+	byKey map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+func newCache(capacity int) *cache {
+	return &cache{capacity: capacity, byKey: make(map[string]*list.Element)}
+}
+
+// get returns the value cached under |key|, unless it has expired by |now|,
+// in which case it is evicted.
+func (c *cache) get(key string, now time.Time) (interface{}, bool) {
+	e, ok := c.byKey[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if !now.Before(entry.expires) {
+		c.remove(e)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return entry.value, true
+}
+
+// put caches |value| under |key| until |expires|, evicting the least recently
+// used value if the cache is full.
+func (c *cache) put(key string, value interface{}, expires time.Time) {
+	if e, ok := c.byKey[key]; ok {
+		c.remove(e)
+	}
+	c.byKey[key] = c.order.PushFront(&cacheEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *cache) remove(e *list.Element) {
+	delete(c.byKey, e.Value.(*cacheEntry).key)
+	c.order.Remove(e)
+}
+
+func (c *cache) len() int {
+	return c.order.Len()
+}
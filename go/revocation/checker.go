@@ -0,0 +1,280 @@
+package revocation
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+const (
+	// DefaultMaxCacheAge is how long an HTTPChecker caches OCSP responses
+	// and CRLs for at most, if its options don't say.
+	DefaultMaxCacheAge = time.Hour
+	// DefaultMaxCachedOCSP and DefaultMaxCachedCRLs are how many OCSP
+	// responses and CRLs an HTTPChecker caches at most, if its options
+	// don't say.
+	DefaultMaxCachedOCSP = 100000
+	DefaultMaxCachedCRLs = 16
+	// DefaultTimeout is the timeout of the HTTP client an HTTPChecker
+	// uses if its options don't give one.
+	DefaultTimeout = 30 * time.Second
+	// The largest OCSP response and CRL an HTTPChecker fetches.  CRLs
+	// are parsed as they are read, so can be larger, but are cached once
+	// parsed, so not without limit.
+	maxOCSPResponseSize = 1 << 20
+	maxCRLSize          = 64 << 20
+)
+
+// HTTPCheckerOptions holds optional configuration for an HTTPChecker.
+type HTTPCheckerOptions struct {
+	// Client used to fetch OCSP responses and CRLs; if nil, a client
+	// with DefaultTimeout is used.
+	Client *http.Client
+	// OCSP responses and CRLs are cached until their next update, but
+	// for at most MaxCacheAge.  If zero, DefaultMaxCacheAge is used.
+	MaxCacheAge time.Duration
+	// The most OCSP responses and CRLs cached, beyond which the least
+	// recently used are evicted.  If zero, DefaultMaxCachedOCSP and
+	// DefaultMaxCachedCRLs are used.
+	MaxCachedOCSP, MaxCachedCRLs int
+	// Don't ask OCSP responders, or don't fetch CRLs.
+	DisableOCSP, DisableCRL bool
+}
+
+// HTTPChecker is a Checker which asks certificates' OCSP responders for their
+// status, and falls back to fetching their CRLs if that fails.  The issuer
+// must have signed each response and CRL, either itself or, for OCSP, through
+// a delegated responder.  Responses and CRLs are cached, so that checking
+// many certificates from the same issuer fetches its CRL once.  Expired and
+// least recently used entries are evicted, so the caches stay bounded.
+//
+// CRLs whose Issuing Distribution Point excludes a certificate aren't used for
+// it, and indirect CRLs aren't supported.  A complete CRL is updated by its
+// delta CRLs, if one of them can be fetched.
+type HTTPChecker struct {
+	opts HTTPCheckerOptions
+	now  func() time.Time
+
+	mu   sync.Mutex
+	ocsp *cache
+	crls *cache
+}
+
+// NewHTTPChecker returns an HTTPChecker configured by |opts|.
+func NewHTTPChecker(opts HTTPCheckerOptions) *HTTPChecker {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: DefaultTimeout}
+	}
+	if opts.MaxCacheAge == 0 {
+		opts.MaxCacheAge = DefaultMaxCacheAge
+	}
+	if opts.MaxCachedOCSP <= 0 {
+		opts.MaxCachedOCSP = DefaultMaxCachedOCSP
+	}
+	if opts.MaxCachedCRLs <= 0 {
+		opts.MaxCachedCRLs = DefaultMaxCachedCRLs
+	}
+	return &HTTPChecker{
+		opts: opts,
+		now:  time.Now,
+		ocsp: newCache(opts.MaxCachedOCSP),
+		crls: newCache(opts.MaxCachedCRLs),
+	}
+}
+
+// expiry returns when something fetched at |now| which is current until
+// |nextUpdate|, or the zero time if unknown, drops out of the cache.
+func (c *HTTPChecker) expiry(now, nextUpdate time.Time) time.Time {
+	expires := now.Add(c.opts.MaxCacheAge)
+	if !nextUpdate.IsZero() && nextUpdate.Before(expires) {
+		expires = nextUpdate
+	}
+	return expires
+}
+
+// Check implements Checker.
+func (c *HTTPChecker) Check(ctx context.Context, cert, issuer *x509.Certificate) Status {
+	var errs []string
+	if !c.opts.DisableOCSP {
+		for _, server := range cert.OCSPServer {
+			s, err := c.checkOCSP(ctx, server, cert, issuer)
+			if err == nil {
+				return s
+			}
+			errs = append(errs, fmt.Sprintf("%s: %s", server, err))
+		}
+	}
+	if !c.opts.DisableCRL {
+		for _, url := range cert.CRLDistributionPoints {
+			if !isHTTPURL(url) {
+				continue
+			}
+			s, err := c.checkCRL(ctx, url, cert, issuer)
+			if err == nil {
+				return s
+			}
+			errs = append(errs, fmt.Sprintf("%s: %s", url, err))
+		}
+	}
+	if len(errs) == 0 {
+		return Status{Error: "no OCSP responder or CRL to check"}
+	}
+	return Status{Error: strings.Join(errs, "; ")}
+}
+
+func (c *HTTPChecker) checkOCSP(ctx context.Context, server string, cert, issuer *x509.Certificate) (Status, error) {
+	id, err := NewOCSPCertID(cert, issuer)
+	if err != nil {
+		return Status{}, err
+	}
+	key := fmt.Sprintf("%s %x %x %s", server, id.IssuerNameHash, id.IssuerKeyHash, cert.SerialNumber)
+	now := c.now()
+	c.mu.Lock()
+	cached, ok := c.ocsp.get(key, now)
+	c.mu.Unlock()
+	if ok {
+		return cached.(Status), nil
+	}
+
+	req, err := newOCSPRequest(id)
+	if err != nil {
+		return Status{}, err
+	}
+	body, err := c.fetch(ctx, server, req)
+	if err != nil {
+		return Status{}, err
+	}
+	result, err := parseOCSPResponse(body, cert, issuer, now)
+	if err != nil {
+		return Status{}, err
+	}
+	result.status.Source = server
+	c.mu.Lock()
+	c.ocsp.put(key, result.status, c.expiry(now, result.nextUpdate))
+	c.mu.Unlock()
+	return result.status, nil
+}
+
+func (c *HTTPChecker) checkCRL(ctx context.Context, url string, cert, issuer *x509.Certificate) (Status, error) {
+	complete, err := c.getCRL(ctx, url, issuer)
+	if err != nil {
+		return Status{}, err
+	}
+	s, err := complete.status(cert)
+	if err != nil {
+		return Status{}, err
+	}
+	// The first delta CRL which can be fetched and applied updates the
+	// status; if there isn't one, the complete CRL's is the latest known.
+	for _, deltaURL := range complete.exts.FreshestCRL {
+		if !isHTTPURL(deltaURL) {
+			continue
+		}
+		delta, err := c.getCRL(ctx, deltaURL, issuer)
+		if err == nil {
+			err = complete.checkDelta(delta)
+		}
+		if err != nil {
+			continue
+		}
+		if ds, ok := delta.deltaStatus(cert); ok {
+			return ds, nil
+		}
+		break
+	}
+	return s, nil
+}
+
+// getCRL returns the CRL at |url|, checked against |issuer|, from the cache
+// if it is there.
+func (c *HTTPChecker) getCRL(ctx context.Context, url string, issuer *x509.Certificate) (*crl, error) {
+	now := c.now()
+	c.mu.Lock()
+	cached, ok := c.crls.get(url, now)
+	c.mu.Unlock()
+	// The same URL could serve the CRLs of different issuers, so only
+	// trust a cached CRL which was checked against this issuer.
+	if ok && bytes.Equal(cached.(*crl).issuer, issuer.Raw) {
+		return cached.(*crl), nil
+	}
+
+	body, err := c.open(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	list, err := readCRL(&limitedReader{r: body, n: maxCRLSize}, url, issuer, now)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.crls.put(url, list, c.expiry(now, list.nextUpdate))
+	c.mu.Unlock()
+	return list, nil
+}
+
+// open POSTs the OCSP request |ocspReq| to |url|, or GETs |url| if it is nil,
+// and returns the body of the response, which the caller must close.
+func (c *HTTPChecker) open(ctx context.Context, url string, ocspReq []byte) (io.ReadCloser, error) {
+	var resp *http.Response
+	var err error
+	if ocspReq != nil {
+		resp, err = ctxhttp.Post(ctx, c.opts.Client, url, "application/ocsp-request", bytes.NewReader(ocspReq))
+	} else {
+		resp, err = ctxhttp.Get(ctx, c.opts.Client, url)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("got status %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// fetch is open, but reads the whole body, which OCSP responses are small
+// enough for.
+func (c *HTTPChecker) fetch(ctx context.Context, url string, ocspReq []byte) ([]byte, error) {
+	body, err := c.open(ctx, url, ocspReq)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(&limitedReader{r: body, n: maxOCSPResponseSize})
+}
+
+// limitedReader reads from |r|, failing once it has read more than |n| bytes.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errors.New("response too large")
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errors.New("response too large")
+	}
+	return n, err
+}
+
+func isHTTPURL(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
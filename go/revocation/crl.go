@@ -0,0 +1,155 @@
+package revocation
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// The CRL entry extension giving the reason a certificate was revoked (RFC
+// 5280 section 5.3.1).
+var oidCRLReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// crlEntry is a certificate listed by a CRL.
+type crlEntry struct {
+	revokedAt time.Time
+	reason    Reason
+}
+
+// crl is a read and verified CRL, indexed by serial number.  Only what is
+// needed of each entry is kept, as CRLs can list millions of certificates.
+type crl struct {
+	// The URL it was fetched from, and the DER of the issuer it was
+	// verified against.
+	url        string
+	issuer     []byte
+	revoked    map[string]crlEntry
+	nextUpdate time.Time
+	exts       *x509.CRLExtensions
+}
+
+// readCRL reads the CRL fetched from |url| from |r|, checking that |issuer|
+// signed it and that it is current.  The CRL is parsed as it is read, so it
+// needn't be held in memory.
+func readCRL(r io.Reader, url string, issuer *x509.Certificate, now time.Time) (*crl, error) {
+	cr, err := x509.NewCRLReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if now.Before(cr.ThisUpdate) {
+		return nil, fmt.Errorf("CRL isn't valid until %s", cr.ThisUpdate)
+	}
+	if cr.HasExpired(now) {
+		return nil, fmt.Errorf("CRL expired at %s", cr.NextUpdate)
+	}
+	c := &crl{url: url, issuer: issuer.Raw, revoked: make(map[string]crlEntry), nextUpdate: cr.NextUpdate}
+	for {
+		rc, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		e := crlEntry{revokedAt: rc.RevocationTime}
+		if reason, ok := crlReason(rc.Extensions); ok {
+			e.reason = reason
+		}
+		c.revoked[serialKey(rc.SerialNumber)] = e
+	}
+	if err := cr.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("CRL isn't signed by the issuer: %v", err)
+	}
+	if c.exts, err = x509.ParseCRLExtensions(cr.Extensions); err != nil {
+		return nil, err
+	}
+	if idp := c.exts.IssuingDistributionPoint; idp != nil && idp.IndirectCRL {
+		return nil, errors.New("indirect CRLs aren't supported")
+	}
+	return c, nil
+}
+
+// serialKey returns the key of the serial number |n| in a crl's map, which is
+// more compact than its decimal string.
+func serialKey(n *big.Int) string {
+	if n.Sign() < 0 {
+		return "-" + string(n.Bytes())
+	}
+	return string(n.Bytes())
+}
+
+func crlReason(exts []pkix.Extension) (Reason, bool) {
+	for _, e := range exts {
+		if !e.Id.Equal(oidCRLReasonCode) {
+			continue
+		}
+		var reason asn1.Enumerated
+		if _, err := asn1.Unmarshal(e.Value, &reason); err != nil {
+			return 0, false
+		}
+		return Reason(reason), true
+	}
+	return 0, false
+}
+
+// covers reports whether the CRL's scope includes |cert|.
+func (c *crl) covers(cert *x509.Certificate) bool {
+	idp := c.exts.IssuingDistributionPoint
+	return idp == nil || idp.Covers(cert)
+}
+
+// status returns the status the CRL gives |cert|, which it is the complete
+// CRL of the issuer of.  It fails if the CRL's scope doesn't include |cert|,
+// or only includes some reasons for revoking it, and |cert| isn't listed.
+func (c *crl) status(cert *x509.Certificate) (Status, error) {
+	if c.exts.BaseCRLNumber != nil {
+		return Status{}, errors.New("CRL is a delta CRL")
+	}
+	if !c.covers(cert) {
+		return Status{}, errors.New("CRL doesn't cover the certificate")
+	}
+	if e, ok := c.revoked[serialKey(cert.SerialNumber)]; ok {
+		return Status{State: Revoked, Reason: e.reason, RevokedAt: e.revokedAt, Source: c.url}, nil
+	}
+	if idp := c.exts.IssuingDistributionPoint; idp != nil && idp.OnlySomeReasons.BitLength > 0 {
+		return Status{}, errors.New("CRL only covers some revocation reasons")
+	}
+	return Status{State: Good, Source: c.url}, nil
+}
+
+// checkDelta checks that |delta| is a delta CRL which can be applied to the
+// complete CRL |c| (RFC 5280 section 5.2.4).
+func (c *crl) checkDelta(delta *crl) error {
+	base := delta.exts.BaseCRLNumber
+	switch {
+	case base == nil:
+		return errors.New("CRL isn't a delta CRL")
+	case c.exts.Number == nil:
+		return errors.New("complete CRL has no number")
+	case base.Cmp(c.exts.Number) > 0:
+		return fmt.Errorf("delta CRL updates CRL %s, which is later than the complete CRL %s", base, c.exts.Number)
+	}
+	return nil
+}
+
+// deltaStatus returns the status which the delta CRL |c| gives |cert|, if it
+// lists it: Revoked, or Good if the certificate was taken off hold.
+func (c *crl) deltaStatus(cert *x509.Certificate) (Status, bool) {
+	if !c.covers(cert) {
+		return Status{}, false
+	}
+	e, ok := c.revoked[serialKey(cert.SerialNumber)]
+	switch {
+	case !ok:
+		return Status{}, false
+	case e.reason == RemoveFromCRL:
+		return Status{State: Good, Source: c.url}, true
+	}
+	return Status{State: Revoked, Reason: e.reason, RevokedAt: e.revokedAt, Source: c.url}, true
+}
@@ -0,0 +1,259 @@
+package revocation
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+var (
+	oidSHA1              = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidOCSPBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+)
+
+// OCSPCertID is the CertID by which OCSP requests and responses identify a
+// certificate (RFC 6960 section 4.1.1).
+type OCSPCertID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+// The hashes which CertIDs can use.
+var certIDHashes = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{oidSHA1, crypto.SHA1},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, crypto.SHA256},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}, crypto.SHA384},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}, crypto.SHA512},
+}
+
+// Other OCSP structures from RFC 6960 section 4.
+type ocspRequestEntry struct {
+	Cert OCSPCertID
+}
+
+type ocspTBSRequest struct {
+	RequestList []ocspRequestEntry
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspResponse struct {
+	Status        asn1.Enumerated
+	ResponseBytes ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Raw                asn1.RawContent
+	Version            int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID        asn1.RawValue
+	ProducedAt         time.Time
+	Responses          []ocspSingleResponse
+	ResponseExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspSingleResponse struct {
+	CertID           OCSPCertID
+	Good             asn1.Flag       `asn1:"tag:0,optional"`
+	Revoked          ocspRevokedInfo `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag       `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time
+	NextUpdate       time.Time        `asn1:"explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// issuerKey returns the bits of issuer's public key, without the algorithm
+// and BIT STRING framing of its SubjectPublicKeyInfo, which CertIDs hash.
+func issuerKey(issuer *x509.Certificate) ([]byte, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, fmt.Errorf("failed to parse issuer's public key: %v", err)
+	}
+	return spki.PublicKey.RightAlign(), nil
+}
+
+// NewOCSPCertID returns the CertID identifying |cert|, issued by |issuer|,
+// using SHA-1, the hash which every responder supports.
+func NewOCSPCertID(cert, issuer *x509.Certificate) (OCSPCertID, error) {
+	key, err := issuerKey(issuer)
+	if err != nil {
+		return OCSPCertID{}, err
+	}
+	nameHash := sha1.Sum(issuer.RawSubject)
+	keyHash := sha1.Sum(key)
+	return OCSPCertID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidSHA1,
+			Parameters: asn1.RawValue{Tag: 5 /* ASN.1 NULL */},
+		},
+		IssuerNameHash: nameHash[:],
+		IssuerKeyHash:  keyHash[:],
+		SerialNumber:   cert.SerialNumber,
+	}, nil
+}
+
+// newOCSPRequest returns the DER encoding of an OCSP request for |id|.
+func newOCSPRequest(id OCSPCertID) ([]byte, error) {
+	return asn1.Marshal(ocspRequest{TBSRequest: ocspTBSRequest{RequestList: []ocspRequestEntry{{Cert: id}}}})
+}
+
+// Identifies reports whether |id| is a CertID of |cert|, issued by |issuer|,
+// with any of the hashes responders use.  A CertID whose hash isn't known
+// identifies no certificate.
+func (id *OCSPCertID) Identifies(cert, issuer *x509.Certificate) (bool, error) {
+	if id.SerialNumber == nil || cert.SerialNumber == nil || id.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		return false, nil
+	}
+	var h crypto.Hash
+	for _, c := range certIDHashes {
+		if id.HashAlgorithm.Algorithm.Equal(c.oid) {
+			h = c.hash
+		}
+	}
+	if h == 0 || !h.Available() {
+		return false, nil
+	}
+	key, err := issuerKey(issuer)
+	if err != nil {
+		return false, err
+	}
+	nameHash, keyHash := h.New(), h.New()
+	nameHash.Write(issuer.RawSubject)
+	keyHash.Write(key)
+	return bytes.Equal(id.IssuerNameHash, nameHash.Sum(nil)) && bytes.Equal(id.IssuerKeyHash, keyHash.Sum(nil)), nil
+}
+
+// ocspResult is the status a verified OCSP response gives a certificate, and
+// until when it can be relied on, which is the zero time if the responder
+// didn't say.
+type ocspResult struct {
+	status     Status
+	nextUpdate time.Time
+}
+
+// parseOCSPResponse returns the status of |cert|, issued by |issuer|, in the
+// DER encoded OCSP response |der|, after checking that |issuer| or a
+// responder it delegated to signed it.
+func parseOCSPResponse(der []byte, cert, issuer *x509.Certificate, now time.Time) (*ocspResult, error) {
+	var resp ocspResponse
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("trailing data after OCSP response")
+	}
+	if resp.Status != 0 {
+		return nil, fmt.Errorf("OCSP response has status %d", resp.Status)
+	}
+	if !resp.ResponseBytes.ResponseType.Equal(oidOCSPBasicResponse) {
+		return nil, fmt.Errorf("OCSP response type %v is not basic", resp.ResponseBytes.ResponseType)
+	}
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(resp.ResponseBytes.Response, &basic); err != nil {
+		return nil, err
+	}
+	if err := checkOCSPSignature(&basic, issuer); err != nil {
+		return nil, err
+	}
+
+	for _, r := range basic.TBSResponseData.Responses {
+		if ok, err := r.CertID.Identifies(cert, issuer); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		if now.Before(r.ThisUpdate) {
+			return nil, fmt.Errorf("OCSP response isn't valid until %s", r.ThisUpdate)
+		}
+		if !r.NextUpdate.IsZero() && now.After(r.NextUpdate) {
+			return nil, fmt.Errorf("OCSP response expired at %s", r.NextUpdate)
+		}
+		result := &ocspResult{nextUpdate: r.NextUpdate}
+		switch {
+		case bool(r.Good):
+			result.status.State = Good
+		case bool(r.Unknown):
+			result.status.Error = "OCSP responder doesn't know the certificate"
+		default:
+			result.status.State = Revoked
+			result.status.RevokedAt = r.Revoked.RevocationTime
+			result.status.Reason = Reason(r.Revoked.Reason)
+		}
+		return result, nil
+	}
+	return nil, errors.New("OCSP response doesn't cover the certificate")
+}
+
+// VerifyOCSPResponse checks that the DER encoded OCSP response |der| is a
+// current response from |issuer|, or a responder it delegated to, which gives
+// the status of |cert|, whatever that is.  It is an sctverify.OCSPVerifier, for
+// checking stapled OCSP responses before trusting the SCTs in them.
+func VerifyOCSPResponse(der []byte, cert, issuer *x509.Certificate) error {
+	_, err := parseOCSPResponse(der, cert, issuer, time.Now())
+	return err
+}
+
+// checkOCSPSignature checks that |basic| was signed by |issuer|, or by a
+// certificate included in it which |issuer| issued for OCSP signing.
+func checkOCSPSignature(basic *ocspBasicResponse, issuer *x509.Certificate) error {
+	alg := x509.SignatureAlgorithmFromOID(basic.SignatureAlgorithm.Algorithm)
+	signed, sig := basic.TBSResponseData.Raw, basic.Signature.RightAlign()
+	if issuer.CheckSignature(alg, signed, sig) == nil {
+		return nil
+	}
+	for _, raw := range basic.Certificates {
+		responder, err := x509.ParseCertificate(raw.FullBytes)
+		if x509.IsFatal(err) {
+			continue
+		}
+		if !hasOCSPSigning(responder) || responder.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+		if responder.CheckSignature(alg, signed, sig) == nil {
+			return nil
+		}
+	}
+	return errors.New("OCSP response isn't signed by the issuer or a responder it authorized")
+}
+
+func hasOCSPSigning(c *x509.Certificate) bool {
+	for _, usage := range c.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageOCSPSigning {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+// Package revocation finds out whether certificates have been revoked, from
+// their issuers' OCSP responders and CRLs, so that monitors can tell the
+// misissued certificates which have already been dealt with from those which
+// are still in use.  Checking is done by a Checker, which callers such as the
+// scanner and fixchain take optionally, rather than doing it themselves.
+package revocation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// State is whether a certificate has been revoked.
+type State int
+
+const (
+	// Unknown means the revocation status couldn't be found out, e.g.
+	// because the certificate has no OCSP responder or CRL, or because
+	// they couldn't be fetched.
+	Unknown State = iota
+	// Good means the certificate's issuer says it hasn't been revoked.
+	Good
+	// Revoked means the certificate's issuer says it has been revoked.
+	Revoked
+)
+
+var stateNames = []string{"unknown", "good", "revoked"}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+	return stateNames[s]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *State) UnmarshalText(text []byte) error {
+	for i, name := range stateNames {
+		if name == string(text) {
+			*s = State(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown revocation state %q", text)
+}
+
+// Reason is the reason a certificate was revoked, a CRLReason (RFC 5280
+// section 5.3.1).
+type Reason int
+
+// The CRLReasons.  7 isn't used.
+const (
+	Unspecified          Reason = 0
+	KeyCompromise        Reason = 1
+	CACompromise         Reason = 2
+	AffiliationChanged   Reason = 3
+	Superseded           Reason = 4
+	CessationOfOperation Reason = 5
+	CertificateHold      Reason = 6
+	RemoveFromCRL        Reason = 8
+	PrivilegeWithdrawn   Reason = 9
+	AACompromise         Reason = 10
+)
+
+var reasonNames = map[Reason]string{
+	Unspecified:          "unspecified",
+	KeyCompromise:        "keyCompromise",
+	CACompromise:         "cACompromise",
+	AffiliationChanged:   "affiliationChanged",
+	Superseded:           "superseded",
+	CessationOfOperation: "cessationOfOperation",
+	CertificateHold:      "certificateHold",
+	RemoveFromCRL:        "removeFromCRL",
+	PrivilegeWithdrawn:   "privilegeWithdrawn",
+	AACompromise:         "aACompromise",
+}
+
+func (r Reason) String() string {
+	if name, ok := reasonNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("Reason(%d)", int(r))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (r Reason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (r *Reason) UnmarshalText(text []byte) error {
+	for reason, name := range reasonNames {
+		if name == string(text) {
+			*r = reason
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown revocation reason %q", text)
+}
+
+// Status is the revocation status of a certificate.
+type Status struct {
+	State State `json:"state"`
+	// If the certificate is Revoked, when and why.  The Reason is
+	// Unspecified if the issuer didn't give one.
+	Reason    Reason    `json:"reason,omitempty"`
+	RevokedAt time.Time `json:"revoked_at,omitempty"`
+	// The URL of the OCSP responder or CRL the status is from.
+	Source string `json:"source,omitempty"`
+	// Why the State is Unknown, if it is.
+	Error string `json:"error,omitempty"`
+}
+
+func (s Status) String() string {
+	switch s.State {
+	case Revoked:
+		return fmt.Sprintf("revoked (%s) at %s, according to %s", s.Reason, s.RevokedAt.Format(time.RFC3339), s.Source)
+	case Good:
+		return fmt.Sprintf("good, according to %s", s.Source)
+	}
+	if s.Error != "" {
+		return "unknown: " + s.Error
+	}
+	return "unknown"
+}
+
+// Checker finds out the revocation status of certificates.  Implementations
+// must be safe for concurrent use.
+type Checker interface {
+	// Check returns the revocation status of |cert|, which |issuer|
+	// issued.  Failures to find out are reported as Unknown statuses.
+	Check(ctx context.Context, cert, issuer *x509.Certificate) Status
+}
+
+// CheckChain returns the revocation status of each certificate in |chain|,
+// which runs from a leaf to a root, but the last, which has no issuer in the
+// chain, using |c|.
+func CheckChain(ctx context.Context, c Checker, chain []*x509.Certificate) []Status {
+	if len(chain) < 2 {
+		return nil
+	}
+	statuses := make([]Status, len(chain)-1)
+	for i := range statuses {
+		statuses[i] = c.Check(ctx, chain[i], chain[i+1])
+	}
+	return statuses
+}
+
+// Worst returns the most significant of |statuses|: the first Revoked one if
+// there is one, otherwise the first Unknown one if there is one, otherwise a
+// Good one.  It returns an Unknown Status if |statuses| is empty.
+func Worst(statuses []Status) Status {
+	var worst *Status
+	for i := range statuses {
+		s := &statuses[i]
+		switch {
+		case s.State == Revoked:
+			return *s
+		case worst == nil, s.State == Unknown && worst.State == Good:
+			worst = s
+		}
+	}
+	if worst == nil {
+		return Status{}
+	}
+	return *worst
+}
@@ -0,0 +1,551 @@
+package revocation
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+	"golang.org/x/net/context"
+)
+
+var (
+	now                 = time.Now().Truncate(time.Second)
+	oidSHA256WithRSA    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	serialKeyCompromise = big.NewInt(100)
+)
+
+// Structures for building OCSP responses, in which the certificate status
+// CHOICE is a RawValue.
+type testSingleResponse struct {
+	CertID     OCSPCertID
+	Status     asn1.RawValue
+	ThisUpdate time.Time
+	NextUpdate time.Time `asn1:"explicit,tag:0,optional"`
+}
+
+type testResponseData struct {
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time
+	Responses   []testSingleResponse
+}
+
+type testBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+// newCA returns a self-signed CA with common name |cn| and an RSA key, as the
+// test OCSP responses and CRLs are signed with SHA256WithRSA.
+func newCA(t *testing.T, cn string) *testcert.CA {
+	key := testcert.NewRSAKey(t)
+	return &testcert.CA{Cert: testcert.Issue(t, testcert.Template(cn, true), key, nil), Key: key}
+}
+
+// newOCSPResponse returns an OCSP response from |ca| giving the status |status|
+// to |cert|, signed by |signer|, which is included in the response if it
+// isn't |ca|.
+func newOCSPResponse(t *testing.T, ca *testcert.CA, cert *x509.Certificate, status asn1.RawValue, signer *testcert.CA) []byte {
+	id, err := NewOCSPCertID(cert, ca.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbs, err := asn1.Marshal(testResponseData{
+		ResponderID: asn1.RawValue{Class: 2, Tag: 1, IsCompound: true, Bytes: signer.Cert.RawSubject},
+		ProducedAt:  now,
+		Responses: []testSingleResponse{{
+			CertID:     id,
+			Status:     status,
+			ThisUpdate: now.Add(-time.Minute),
+			NextUpdate: now.Add(time.Hour),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(tbs)
+	sig, err := signer.Key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	basic := testBasicResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSA},
+		Signature:          asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)},
+	}
+	if signer != ca {
+		basic.Certificates = []asn1.RawValue{{FullBytes: signer.Cert.Raw}}
+	}
+	basicDER, err := asn1.Marshal(basic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(ocspResponse{ResponseBytes: ocspResponseBytes{ResponseType: oidOCSPBasicResponse, Response: basicDER}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+var ocspGood = asn1.RawValue{Class: 2, Tag: 0}
+
+func ocspRevoked(t *testing.T, at time.Time, reason Reason) asn1.RawValue {
+	tm, err := asn1.Marshal(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := asn1.Marshal(asn1.Enumerated(reason))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = asn1.Marshal(asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return asn1.RawValue{Class: 2, Tag: 1, IsCompound: true, Bytes: append(tm, r...)}
+}
+
+// server serves fixed bodies at paths, counting requests.
+type server struct {
+	*httptest.Server
+	bodies   map[string][]byte
+	requests int32
+}
+
+func newServer() *server {
+	s := &server{bodies: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+		if r.Method == "POST" {
+			if _, err := ioutil.ReadAll(r.Body); err != nil || r.Header.Get("Content-Type") != "application/ocsp-request" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+		}
+		body, ok := s.bodies[r.URL.Path]
+		if !ok {
+			http.Error(w, "not found", http.StatusInternalServerError)
+			return
+		}
+		w.Write(body)
+	}))
+	return s
+}
+
+func TestHTTPCheckerOCSP(t *testing.T) {
+	ca, other := newCA(t, "CA"), newCA(t, "Other CA")
+	responderKey := testcert.NewRSAKey(t)
+	responder := &testcert.CA{Cert: testcert.Issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "CA OCSP Responder"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}, responderKey, ca), Key: responderKey}
+	s := newServer()
+	defer s.Close()
+
+	for i, test := range []struct {
+		signer *testcert.CA
+		status asn1.RawValue
+		want   Status
+	}{
+		{ca, ocspGood, Status{State: Good}},
+		{ca, ocspRevoked(t, now.Add(-time.Minute), KeyCompromise), Status{State: Revoked, Reason: KeyCompromise, RevokedAt: now.Add(-time.Minute)}},
+		{ca, asn1.RawValue{Class: 2, Tag: 2}, Status{}},
+		{responder, ocspGood, Status{State: Good}},
+		{other, ocspGood, Status{}},
+	} {
+		path := fmt.Sprintf("/ocsp%d", i)
+		cert := testcert.Issue(t, &x509.Certificate{
+			SerialNumber: big.NewInt(int64(10 + i)),
+			Subject:      pkix.Name{CommonName: "leaf"},
+			OCSPServer:   []string{s.URL + path},
+		}, testcert.NewKey(t), ca)
+		s.bodies[path] = newOCSPResponse(t, ca, cert, test.status, test.signer)
+
+		c := NewHTTPChecker(HTTPCheckerOptions{})
+		got := c.Check(context.Background(), cert, ca.Cert)
+		if got.State != test.want.State || got.Reason != test.want.Reason || !got.RevokedAt.Equal(test.want.RevokedAt) {
+			t.Errorf("#%d: Check()=%v, want %v", i, got, test.want)
+		}
+		if test.want.State == Unknown {
+			if got.Error == "" {
+				t.Errorf("#%d: Check()=%v, want an error", i, got)
+			}
+			continue
+		}
+		if got.Source != s.URL+path {
+			t.Errorf("#%d: Check() source=%q, want %q", i, got.Source, s.URL+path)
+		}
+		// The response is cached.
+		before := atomic.LoadInt32(&s.requests)
+		if again := c.Check(context.Background(), cert, ca.Cert); again.State != got.State {
+			t.Errorf("#%d: second Check()=%v, want %v", i, again, got)
+		}
+		if after := atomic.LoadInt32(&s.requests); after != before {
+			t.Errorf("#%d: second Check() made %d requests, want none", i, after-before)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := newCache(2)
+	c.put("a", 1, now.Add(time.Hour))
+	c.put("b", 2, now.Add(time.Minute))
+	// Using a makes b the least recently used, so c evicts it.
+	if v, ok := c.get("a", now); !ok || v != 1 {
+		t.Errorf("get(a)=%v,%t, want 1,true", v, ok)
+	}
+	c.put("c", 3, now.Add(time.Hour))
+	if v, ok := c.get("b", now); ok {
+		t.Errorf("get(b)=%v,true after eviction", v)
+	}
+	if c.len() != 2 {
+		t.Errorf("len()=%d, want the capacity of 2", c.len())
+	}
+	c.put("a", 4, now.Add(time.Minute))
+	if v, ok := c.get("a", now); !ok || v != 4 {
+		t.Errorf("get(a)=%v,%t after replacing it, want 4,true", v, ok)
+	}
+	// Expired values are evicted when they are looked up.
+	if v, ok := c.get("a", now.Add(time.Minute)); ok {
+		t.Errorf("get(a)=%v,true once expired", v)
+	}
+	if c.len() != 1 {
+		t.Errorf("len()=%d, want 1 once a expired", c.len())
+	}
+}
+
+func TestVerifyOCSPResponse(t *testing.T) {
+	ca, other := newCA(t, "CA"), newCA(t, "Other CA")
+	cert := testcert.Issue(t, &x509.Certificate{SerialNumber: big.NewInt(10), Subject: pkix.Name{CommonName: "leaf"}}, testcert.NewKey(t), ca)
+	otherCert := testcert.Issue(t, &x509.Certificate{SerialNumber: big.NewInt(11), Subject: pkix.Name{CommonName: "leaf"}}, testcert.NewKey(t), ca)
+	revoked := ocspRevoked(t, now.Add(-time.Minute), KeyCompromise)
+	for i, test := range []struct {
+		der []byte
+		ok  bool
+	}{
+		{newOCSPResponse(t, ca, cert, ocspGood, ca), true},
+		{newOCSPResponse(t, ca, cert, revoked, ca), true},
+		{newOCSPResponse(t, ca, cert, ocspGood, other), false},
+		{newOCSPResponse(t, ca, otherCert, ocspGood, ca), false},
+		{[]byte("garbage"), false},
+	} {
+		if err := VerifyOCSPResponse(test.der, cert, ca.Cert); (err == nil) != test.ok {
+			t.Errorf("#%d: VerifyOCSPResponse()=%v, want ok=%v", i, err, test.ok)
+		}
+	}
+}
+
+func TestHTTPCheckerCRL(t *testing.T) {
+	ca := newCA(t, "CA")
+	reasonExt, err := asn1.Marshal(asn1.Enumerated(KeyCompromise))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlDER, err := ca.Cert.CreateCRL(rand.Reader, ca.Key, []pkix.RevokedCertificate{
+		{SerialNumber: serialKeyCompromise, RevocationTime: now.Add(-time.Minute), Extensions: []pkix.Extension{{Id: oidCRLReasonCode, Value: reasonExt}}},
+		{SerialNumber: big.NewInt(101), RevocationTime: now.Add(-time.Minute)},
+	}, now.Add(-time.Minute), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer()
+	defer s.Close()
+	s.bodies["/ca.crl"] = crlDER
+
+	c := NewHTTPChecker(HTTPCheckerOptions{})
+	for i, test := range []struct {
+		serial *big.Int
+		want   Status
+	}{
+		{serialKeyCompromise, Status{State: Revoked, Reason: KeyCompromise}},
+		{big.NewInt(101), Status{State: Revoked, Reason: Unspecified}},
+		{big.NewInt(102), Status{State: Good}},
+	} {
+		cert := testcert.Issue(t, &x509.Certificate{
+			SerialNumber: test.serial,
+			Subject:      pkix.Name{CommonName: "leaf"},
+			// The OCSP responder fails, so the CRL is used.
+			OCSPServer:            []string{s.URL + "/ocsp"},
+			CRLDistributionPoints: []string{"ldap://example.com/ca.crl", s.URL + "/ca.crl"},
+		}, testcert.NewKey(t), ca)
+		got := c.Check(context.Background(), cert, ca.Cert)
+		if got.State != test.want.State || got.Reason != test.want.Reason || got.Source != s.URL+"/ca.crl" {
+			t.Errorf("#%d: Check()=%+v, want %v from the CRL", i, got, test.want)
+		}
+	}
+	// One OCSP request for each certificate, and one for the CRL.
+	if got := atomic.LoadInt32(&s.requests); got != 4 {
+		t.Errorf("made %d requests, want 4", got)
+	}
+
+	// A CRL signed by another CA isn't trusted, even when cached.
+	other := newCA(t, "Other CA")
+	cert := testcert.Issue(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(103),
+		Subject:               pkix.Name{CommonName: "leaf"},
+		CRLDistributionPoints: []string{s.URL + "/ca.crl"},
+	}, testcert.NewKey(t), other)
+	if got := c.Check(context.Background(), cert, other.Cert); got.State != Unknown || got.Error == "" {
+		t.Errorf("Check(CRL of another issuer)=%+v, want unknown", got)
+	}
+
+	if got := c.Check(context.Background(), &x509.Certificate{SerialNumber: big.NewInt(1)}, ca.Cert); got.State != Unknown || got.Error == "" {
+		t.Errorf("Check(no URLs)=%+v, want unknown", got)
+	}
+}
+
+// Structures for building the CRL extensions which say what CRLs cover.
+type testDistributionPointName struct {
+	FullName asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type testIDP struct {
+	DistributionPoint     testDistributionPointName `asn1:"optional,tag:0"`
+	OnlyContainsUserCerts bool                      `asn1:"optional,tag:1"`
+	OnlyContainsCACerts   bool                      `asn1:"optional,tag:2"`
+	OnlySomeReasons       asn1.BitString            `asn1:"optional,tag:3"`
+	IndirectCRL           bool                      `asn1:"optional,tag:4"`
+}
+
+type testDistributionPoint struct {
+	DistributionPoint testDistributionPointName `asn1:"optional,tag:0"`
+}
+
+func uriName(uri string) testDistributionPointName {
+	return testDistributionPointName{asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: append([]byte{0x86, byte(len(uri))}, uri...)}}
+}
+
+func extension(t *testing.T, id asn1.ObjectIdentifier, critical bool, value interface{}) pkix.Extension {
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: id, Critical: critical, Value: der}
+}
+
+func crlNumber(t *testing.T, n int64) pkix.Extension {
+	return extension(t, asn1.ObjectIdentifier{2, 5, 29, 20}, false, big.NewInt(n))
+}
+
+func deltaCRLIndicator(t *testing.T, n int64) pkix.Extension {
+	return extension(t, asn1.ObjectIdentifier{2, 5, 29, 27}, true, big.NewInt(n))
+}
+
+func freshestCRL(t *testing.T, uri string) pkix.Extension {
+	return extension(t, asn1.ObjectIdentifier{2, 5, 29, 46}, false, []testDistributionPoint{{uriName(uri)}})
+}
+
+func issuingDistributionPoint(t *testing.T, idp testIDP) pkix.Extension {
+	return extension(t, asn1.ObjectIdentifier{2, 5, 29, 28}, true, idp)
+}
+
+// revokedFor returns the CRL entry of |serial|, revoked for |reason|.
+func revokedFor(t *testing.T, serial int64, reason Reason) pkix.RevokedCertificate {
+	return pkix.RevokedCertificate{
+		SerialNumber:   big.NewInt(serial),
+		RevocationTime: now.Add(-time.Minute).UTC(),
+		Extensions:     []pkix.Extension{extension(t, oidCRLReasonCode, false, asn1.Enumerated(reason))},
+	}
+}
+
+// newCRL returns a CRL from |ca| revoking |revoked|, with extensions |exts|,
+// which CreateCRL can't add.
+func newCRL(t *testing.T, ca *testcert.CA, revoked []pkix.RevokedCertificate, exts ...pkix.Extension) []byte {
+	alg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1.RawValue{Tag: 5}}
+	tbs := pkix.TBSCertificateList{
+		Version:             1,
+		Signature:           alg,
+		Issuer:              ca.Cert.Subject.ToRDNSequence(),
+		ThisUpdate:          now.Add(-time.Minute).UTC(),
+		NextUpdate:          now.Add(time.Hour).UTC(),
+		RevokedCertificates: revoked,
+		Extensions:          exts,
+	}
+	der, err := asn1.Marshal(tbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(der)
+	sig, err := ca.Key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbs.Raw = der
+	if der, err = asn1.Marshal(pkix.CertificateList{
+		TBSCertList:        tbs,
+		SignatureAlgorithm: alg,
+		SignatureValue:     asn1.BitString{Bytes: sig, BitLength: len(sig) * 8},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestHTTPCheckerDeltaCRL(t *testing.T) {
+	ca := newCA(t, "CA")
+	s := newServer()
+	defer s.Close()
+	s.bodies["/ca.crl"] = newCRL(t, ca, []pkix.RevokedCertificate{
+		revokedFor(t, 100, KeyCompromise),
+		revokedFor(t, 101, CertificateHold),
+	}, crlNumber(t, 5), freshestCRL(t, s.URL+"/delta.crl"))
+
+	leaf := func(serial int64) *x509.Certificate {
+		return testcert.Issue(t, &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: "leaf"},
+			CRLDistributionPoints: []string{s.URL + "/ca.crl"},
+		}, testcert.NewKey(t), ca)
+	}
+	certs := []*x509.Certificate{leaf(100), leaf(101), leaf(102), leaf(103)}
+	for _, test := range []struct {
+		desc  string
+		delta []byte
+		want  []Status
+	}{
+		{
+			desc: "no delta CRL",
+			want: []Status{{State: Revoked, Reason: KeyCompromise, Source: "/ca.crl"}, {State: Revoked, Reason: CertificateHold, Source: "/ca.crl"}, {State: Good, Source: "/ca.crl"}, {State: Good, Source: "/ca.crl"}},
+		},
+		{
+			desc: "delta CRL",
+			delta: newCRL(t, ca, []pkix.RevokedCertificate{
+				revokedFor(t, 101, RemoveFromCRL),
+				revokedFor(t, 102, Superseded),
+			}, crlNumber(t, 6), deltaCRLIndicator(t, 5)),
+			want: []Status{{State: Revoked, Reason: KeyCompromise, Source: "/ca.crl"}, {State: Good, Source: "/delta.crl"}, {State: Revoked, Reason: Superseded, Source: "/delta.crl"}, {State: Good, Source: "/ca.crl"}},
+		},
+		{
+			desc:  "delta CRL of a later CRL",
+			delta: newCRL(t, ca, []pkix.RevokedCertificate{revokedFor(t, 102, Superseded)}, crlNumber(t, 8), deltaCRLIndicator(t, 7)),
+			want:  []Status{{State: Revoked, Reason: KeyCompromise, Source: "/ca.crl"}, {State: Revoked, Reason: CertificateHold, Source: "/ca.crl"}, {State: Good, Source: "/ca.crl"}, {State: Good, Source: "/ca.crl"}},
+		},
+		{
+			desc:  "complete CRL as delta CRL",
+			delta: newCRL(t, ca, []pkix.RevokedCertificate{revokedFor(t, 102, Superseded)}, crlNumber(t, 6)),
+			want:  []Status{{State: Revoked, Reason: KeyCompromise, Source: "/ca.crl"}, {State: Revoked, Reason: CertificateHold, Source: "/ca.crl"}, {State: Good, Source: "/ca.crl"}, {State: Good, Source: "/ca.crl"}},
+		},
+	} {
+		delete(s.bodies, "/delta.crl")
+		if test.delta != nil {
+			s.bodies["/delta.crl"] = test.delta
+		}
+		c := NewHTTPChecker(HTTPCheckerOptions{})
+		for i, cert := range certs {
+			got, want := c.Check(context.Background(), cert, ca.Cert), test.want[i]
+			if got.State != want.State || got.Reason != want.Reason || got.Source != s.URL+want.Source {
+				t.Errorf("%s: Check(serial %s)=%+v, want %v from %s", test.desc, cert.SerialNumber, got, want, want.Source)
+			}
+		}
+	}
+
+	// A delta CRL can't be used as a complete CRL.
+	s.bodies["/delta.crl"] = newCRL(t, ca, nil, crlNumber(t, 6), deltaCRLIndicator(t, 5))
+	cert := testcert.Issue(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(104),
+		Subject:               pkix.Name{CommonName: "leaf"},
+		CRLDistributionPoints: []string{s.URL + "/delta.crl"},
+	}, testcert.NewKey(t), ca)
+	if got := NewHTTPChecker(HTTPCheckerOptions{}).Check(context.Background(), cert, ca.Cert); got.State != Unknown || got.Error == "" {
+		t.Errorf("Check(delta CRL as distribution point)=%+v, want unknown", got)
+	}
+}
+
+func TestHTTPCheckerCRLScope(t *testing.T) {
+	ca := newCA(t, "CA")
+	s := newServer()
+	defer s.Close()
+	revoked := []pkix.RevokedCertificate{revokedFor(t, 100, KeyCompromise)}
+	// Only keyCompromise.
+	someReasons := asn1.BitString{Bytes: []byte{0x40}, BitLength: 2}
+	for i, test := range []struct {
+		idp    testIDP
+		serial int64
+		want   State
+	}{
+		{testIDP{OnlyContainsUserCerts: true}, 101, Good},
+		{testIDP{OnlyContainsCACerts: true}, 101, Unknown},
+		{testIDP{DistributionPoint: uriName(s.URL + "/ca.crl")}, 101, Good},
+		{testIDP{DistributionPoint: uriName(s.URL + "/other.crl")}, 101, Unknown},
+		{testIDP{OnlySomeReasons: someReasons}, 100, Revoked},
+		{testIDP{OnlySomeReasons: someReasons}, 101, Unknown},
+		{testIDP{IndirectCRL: true}, 100, Unknown},
+	} {
+		s.bodies["/ca.crl"] = newCRL(t, ca, revoked, issuingDistributionPoint(t, test.idp))
+		cert := testcert.Issue(t, &x509.Certificate{
+			SerialNumber:          big.NewInt(test.serial),
+			Subject:               pkix.Name{CommonName: "leaf"},
+			CRLDistributionPoints: []string{s.URL + "/ca.crl"},
+		}, testcert.NewKey(t), ca)
+		got := NewHTTPChecker(HTTPCheckerOptions{}).Check(context.Background(), cert, ca.Cert)
+		if got.State != test.want || (test.want == Unknown && got.Error == "") {
+			t.Errorf("#%d: Check()=%+v, want %s", i, got, test.want)
+		}
+	}
+}
+
+type fixedChecker map[string]Status
+
+func (f fixedChecker) Check(ctx context.Context, cert, issuer *x509.Certificate) Status {
+	return f[cert.Subject.CommonName]
+}
+
+func TestCheckChain(t *testing.T) {
+	chain := []*x509.Certificate{
+		{Subject: pkix.Name{CommonName: "leaf"}},
+		{Subject: pkix.Name{CommonName: "intermediate"}},
+		{Subject: pkix.Name{CommonName: "root"}},
+	}
+	c := fixedChecker{"leaf": {State: Good}, "intermediate": {State: Revoked, Reason: CACompromise}, "root": {State: Revoked}}
+	statuses := CheckChain(context.Background(), c, chain)
+	if len(statuses) != 2 || statuses[0].State != Good || statuses[1].Reason != CACompromise {
+		t.Errorf("CheckChain()=%v, want the leaf's and intermediate's statuses", statuses)
+	}
+	if got := Worst(statuses); got.State != Revoked {
+		t.Errorf("Worst(%v)=%v, want revoked", statuses, got)
+	}
+	if got := Worst([]Status{{State: Good}, {State: Unknown, Error: "x"}}); got.Error != "x" {
+		t.Errorf("Worst(good, unknown)=%v, want unknown", got)
+	}
+	if got := Worst(nil); got.State != Unknown {
+		t.Errorf("Worst(nil)=%v, want unknown", got)
+	}
+	if got := CheckChain(context.Background(), c, chain[2:]); got != nil {
+		t.Errorf("CheckChain(root)=%v, want nil", got)
+	}
+}
+
+func TestStatusJSON(t *testing.T) {
+	s := Status{State: Revoked, Reason: KeyCompromise, RevokedAt: now.UTC(), Source: "http://crl.example.com/"}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Status
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal(%s)=%v", data, err)
+	}
+	if got.State != s.State || got.Reason != s.Reason || !got.RevokedAt.Equal(s.RevokedAt) || got.Source != s.Source {
+		t.Errorf("JSON round trip of %+v gave %+v", s, got)
+	}
+	var m map[string]interface{}
+	json.Unmarshal(data, &m)
+	if m["state"] != "revoked" || m["reason"] != "keyCompromise" {
+		t.Errorf("json.Marshal(%+v)=%s, want named state and reason", s, data)
+	}
+}
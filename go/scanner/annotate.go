@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/revocation"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// An Annotator adds to the Record of a matched entry what the entry doesn't
+// say itself, such as the revocation status of its certificate.
+type Annotator func(entry *ct.LogEntry, r *Record)
+
+// AnnotatingSink returns a RecordSink which runs |annotators| in order on the
+// Record of each entry written to it, before writing the Record to |sink|.
+// Records written to it directly are passed on as they are, except by
+// LogFoundFunc, which has their entries to annotate them from.
+func AnnotatingSink(sink RecordSink, annotators ...Annotator) RecordSink {
+	return &annotatingSink{sink: sink, annotators: annotators}
+}
+
+type annotatingSink struct {
+	sink       RecordSink
+	annotators []Annotator
+}
+
+func (s *annotatingSink) Write(entry *ct.LogEntry) error {
+	return s.writeEntryRecord(entry, NewRecord(entry))
+}
+
+func (s *annotatingSink) WriteRecord(r Record) error {
+	return s.sink.WriteRecord(r)
+}
+
+func (s *annotatingSink) writeEntryRecord(entry *ct.LogEntry, r Record) error {
+	for _, a := range s.annotators {
+		a(entry, &r)
+	}
+	return s.sink.WriteRecord(r)
+}
+
+func (s *annotatingSink) Close() error {
+	return s.sink.Close()
+}
+
+// writeEntryRecord writes |r|, the Record of |entry|, to |sink|, annotating it
+// first if |sink| is an AnnotatingSink.
+func writeEntryRecord(sink RecordSink, entry *ct.LogEntry, r Record) error {
+	if s, ok := sink.(*annotatingSink); ok {
+		return s.writeEntryRecord(entry, r)
+	}
+	return sink.WriteRecord(r)
+}
+
+// RevocationAnnotator returns an Annotator which sets the Revocation of
+// Records to the status of their entries' certificates, found out with
+// |checker|.  That of a precertificate is the status of the certificate
+// issued from it, which has the same serial number.
+func RevocationAnnotator(ctx context.Context, checker revocation.Checker) Annotator {
+	return func(entry *ct.LogEntry, r *Record) {
+		var s revocation.Status
+		issuer, err := entryIssuer(entry)
+		switch {
+		case err != nil:
+			s.Error = "failed to parse issuer: " + err.Error()
+		case issuer == nil:
+			s.Error = "log entry has no issuer"
+		case entry.Certificate() == nil:
+			s.Error = "log entry isn't parsed"
+		default:
+			s = checker.Check(ctx, entry.Certificate(), issuer)
+		}
+		r.Revocation = &s
+	}
+}
+
+// entryIssuer returns the issuer of the certificate of |entry| from its chain,
+// or nil if the chain doesn't have it.  A precertificate's chain starts with
+// the precertificate itself, and may then have a Precertificate Signing
+// Certificate before the issuer (RFC6962 section 3.1).
+func entryIssuer(entry *ct.LogEntry) (*x509.Certificate, error) {
+	chain := entry.Chain
+	if entry.IsPrecert() {
+		if len(chain) == 0 {
+			return nil, nil
+		}
+		chain = chain[1:]
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	issuer, err := x509.ParseCertificate(chain[0])
+	if x509.IsFatal(err) {
+		return nil, err
+	}
+	if !entry.IsPrecert() || !isPrecertSigning(issuer) {
+		return issuer, nil
+	}
+	if len(chain) < 2 {
+		return nil, nil
+	}
+	issuer, err = x509.ParseCertificate(chain[1])
+	if x509.IsFatal(err) {
+		return nil, err
+	}
+	return issuer, nil
+}
+
+func isPrecertSigning(c *x509.Certificate) bool {
+	for _, eku := range c.UnknownExtKeyUsage {
+		if eku.Equal(x509.OIDExtKeyUsageCTPrecertSigning) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/loglist"
+	"github.com/google/certificate-transparency/go/revocation"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// annotateTestCert returns the DER of a self-signed CA certificate with
+// common name |cn| and, if set, the extended key usage |eku|.
+func annotateTestCert(t *testing.T, cn string, eku asn1.ObjectIdentifier) []byte {
+	template := testcert.Template(cn, true)
+	if eku != nil {
+		template.UnknownExtKeyUsage = []asn1.ObjectIdentifier{eku}
+	}
+	return testcert.Issue(t, template, testcert.NewKey(t), nil).Raw
+}
+
+// issuerChecker reports certificates as revoked by the issuer they are
+// checked against, as the Source.
+type issuerChecker struct{}
+
+func (issuerChecker) Check(ctx context.Context, cert, issuer *x509.Certificate) revocation.Status {
+	return revocation.Status{State: revocation.Revoked, Reason: revocation.KeyCompromise, Source: issuer.Subject.CommonName}
+}
+
+func TestRevocationAnnotator(t *testing.T) {
+	ca := annotateTestCert(t, "Example CA", nil)
+	signer := annotateTestCert(t, "Example Precert Signer", x509.OIDExtKeyUsageCTPrecertSigning)
+	precert := func(chain ...ct.ASN1Cert) *ct.LogEntry {
+		return &ct.LogEntry{Precert: &ct.Precertificate{TBSCertificate: *sinkEntry(1).X509Cert}, Chain: chain}
+	}
+	for _, test := range []struct {
+		desc   string
+		entry  *ct.LogEntry
+		issuer string
+	}{
+		{"cert", &ct.LogEntry{X509Cert: sinkEntry(1).X509Cert, Chain: []ct.ASN1Cert{ca}}, "Example CA"},
+		{"precert", precert([]byte{4}, ca), "Example CA"},
+		{"precert signer", precert([]byte{4}, signer, ca), "Example CA"},
+		{"cert issued by precert signer", &ct.LogEntry{X509Cert: sinkEntry(1).X509Cert, Chain: []ct.ASN1Cert{signer}}, "Example Precert Signer"},
+		{"no chain", sinkEntry(1), ""},
+		{"precert without issuer", precert([]byte{4}), ""},
+		{"precert signer without issuer", precert([]byte{4}, signer), ""},
+		{"unparsable issuer", &ct.LogEntry{X509Cert: sinkEntry(1).X509Cert, Chain: []ct.ASN1Cert{{1, 2, 3}}}, ""},
+	} {
+		r := NewRecord(test.entry)
+		RevocationAnnotator(context.Background(), issuerChecker{})(test.entry, &r)
+		s := r.Revocation
+		switch {
+		case s == nil:
+			t.Errorf("%s: no revocation status", test.desc)
+		case test.issuer == "" && (s.State != revocation.Unknown || s.Error == ""):
+			t.Errorf("%s: got status %v, want unknown with error", test.desc, s)
+		case test.issuer != "" && (s.State != revocation.Revoked || s.Source != test.issuer):
+			t.Errorf("%s: got status %v, want revoked according to %s", test.desc, s, test.issuer)
+		}
+	}
+}
+
+func TestAnnotatingSink(t *testing.T) {
+	var got []Record
+	annotate := func(entry *ct.LogEntry, r *Record) { r.SubjectCN += " (annotated)" }
+	sink := AnnotatingSink(&recordingSink{records: &got}, annotate, annotate)
+	if err := sink.Write(sinkEntry(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.WriteRecord(NewRecord(sinkEntry(2))); err != nil {
+		t.Fatal(err)
+	}
+	LogFoundFunc(sink)(&loglist.Log{URL: "ct.example.com/"}, sinkEntry(3))
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"www.example.com (annotated) (annotated)",
+		"www.example.com",
+		"www.example.com (annotated) (annotated)",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("sink wrote %d records, want %d", len(got), len(want))
+	}
+	for i, r := range got {
+		if r.SubjectCN != want[i] {
+			t.Errorf("record %d has SubjectCN %q, want %q", i, r.SubjectCN, want[i])
+		}
+	}
+}
@@ -0,0 +1,489 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"golang.org/x/net/context"
+)
+
+// An archive holds a contiguous range of a log's entries, compactly and so
+// that any entry can be read without reading the others.  It is laid out as:
+//
+//	"CTARCHV1"
+//	block...
+//	info
+//	index
+//	trailer
+//
+// Each block is a gzip stream of consecutive entries, each of which is its
+// serialized MerkleTreeLeaf and the certificates of its chain (for
+// precertificates, starting with the precertificate itself), as:
+//
+//	uint32 leaf length, leaf
+//	uint32 number of certificates
+//	uint32 certificate length, certificate...
+//
+// info is the JSON encoding of the ArchiveInfo.  The index has 28 bytes per
+// block: the uint64 index of its first entry, the uint32 number of entries
+// in it, and its uint64 offset and length in the file.  The 32 byte trailer
+// holds the uint64 offsets of the info and index, the uint64 number of
+// blocks, and the magic again.  Integers are big-endian.
+const archiveMagic = "CTARCHV1"
+
+// DefaultArchiveBlockSize is the number of entries in each block of an
+// archive, unless the ArchiveOptions say otherwise.
+const DefaultArchiveBlockSize = 1000
+
+const (
+	archiveIndexEntrySize = 28
+	archiveTrailerSize    = 32
+)
+
+// ArchiveInfo describes the entries in an archive.
+type ArchiveInfo struct {
+	// The URL of the log the entries are from.
+	LogURL string `json:"log_url"`
+	// The STH of the tree the entries were exported from, if known.
+	STH *ct.SignedTreeHead `json:"sth,omitempty"`
+	// The indices of the first and last entries in the archive.
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// ArchiveOptions holds optional configuration for an ArchiveWriter.
+type ArchiveOptions struct {
+	// Number of entries in each block.  Larger blocks compress better, but
+	// reading a single entry means decompressing its whole block.  Zero
+	// means DefaultArchiveBlockSize.
+	BlockSize int
+}
+
+// archiveBlock is an entry of an archive's index.
+type archiveBlock struct {
+	start  int64
+	count  int64
+	offset int64
+	length int64
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ArchiveWriter writes consecutive entries of a log to an archive.
+type ArchiveWriter struct {
+	w         *countingWriter
+	closer    io.Closer
+	blockSize int
+	info      ArchiveInfo
+
+	// The number of entries written, and the blocks written so far.
+	written int64
+	blocks  []archiveBlock
+	// The block being written, and the number of entries in it.
+	block  *gzip.Writer
+	inThis int64
+}
+
+// NewArchiveWriter returns an ArchiveWriter which writes to |w| the entries
+// described by |info|, starting with the entry at info.Start.  info.End is
+// filled in from the entries written.  Closing the ArchiveWriter closes |w|
+// if it is an io.Closer.
+func NewArchiveWriter(w io.Writer, info ArchiveInfo, opts ArchiveOptions) (*ArchiveWriter, error) {
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = DefaultArchiveBlockSize
+	}
+	a := &ArchiveWriter{w: &countingWriter{w: w}, blockSize: opts.BlockSize, info: info}
+	if c, ok := w.(io.Closer); ok {
+		a.closer = c
+	}
+	if _, err := io.WriteString(a.w, archiveMagic); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Write appends |entry| to the archive.  Entries must be written in order,
+// without gaps.
+func (a *ArchiveWriter) Write(entry *ct.LogEntry) error {
+	if want := a.info.Start + a.written; entry.Index != want {
+		return fmt.Errorf("got entry %d, want entry %d", entry.Index, want)
+	}
+	leaf, err := ct.SerializeMerkleTreeLeaf(entry.Leaf)
+	if err != nil {
+		return fmt.Errorf("failed to serialize entry %d: %v", entry.Index, err)
+	}
+	if a.block == nil {
+		a.blocks = append(a.blocks, archiveBlock{start: entry.Index, offset: a.w.n})
+		a.block = gzip.NewWriter(a.w)
+		a.inThis = 0
+	}
+	buf := appendUint32(nil, uint32(len(leaf)))
+	buf = append(buf, leaf...)
+	buf = appendUint32(buf, uint32(len(entry.Chain)))
+	for _, c := range entry.Chain {
+		buf = appendUint32(buf, uint32(len(c)))
+		buf = append(buf, c...)
+	}
+	if _, err := a.block.Write(buf); err != nil {
+		return err
+	}
+	a.written++
+	a.inThis++
+	if a.inThis >= int64(a.blockSize) {
+		return a.endBlock()
+	}
+	return nil
+}
+
+// endBlock finishes the block being written, if there is one.
+func (a *ArchiveWriter) endBlock() error {
+	if a.block == nil {
+		return nil
+	}
+	if err := a.block.Close(); err != nil {
+		return err
+	}
+	b := &a.blocks[len(a.blocks)-1]
+	b.count = a.inThis
+	b.length = a.w.n - b.offset
+	a.block = nil
+	return nil
+}
+
+// Close finishes the archive, writing its info and index, and returns the
+// ArchiveInfo written.
+func (a *ArchiveWriter) Close() (*ArchiveInfo, error) {
+	if err := a.endBlock(); err != nil {
+		return nil, err
+	}
+	info := a.info
+	info.End = info.Start + a.written - 1
+	infoOffset := a.w.n
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.w.Write(data); err != nil {
+		return nil, err
+	}
+	indexOffset := a.w.n
+	index := make([]byte, 0, len(a.blocks)*archiveIndexEntrySize+archiveTrailerSize)
+	for _, b := range a.blocks {
+		index = appendUint64(index, uint64(b.start))
+		index = appendUint32(index, uint32(b.count))
+		index = appendUint64(index, uint64(b.offset))
+		index = appendUint64(index, uint64(b.length))
+	}
+	index = appendUint64(index, uint64(infoOffset))
+	index = appendUint64(index, uint64(indexOffset))
+	index = appendUint64(index, uint64(len(a.blocks)))
+	index = append(index, archiveMagic...)
+	if _, err := a.w.Write(index); err != nil {
+		return nil, err
+	}
+	if a.closer != nil {
+		if err := a.closer.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return &info, nil
+}
+
+func appendUint32(b []byte, n uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], n)
+	return append(b, buf[:]...)
+}
+
+func appendUint64(b []byte, n uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	return append(b, buf[:]...)
+}
+
+// ErrNotInArchive is returned when reading entries which aren't in an
+// archive.
+var ErrNotInArchive = errors.New("entry isn't in the archive")
+
+// ArchiveReader reads entries from an archive.  It is safe for concurrent
+// use.
+type ArchiveReader struct {
+	r      io.ReaderAt
+	info   ArchiveInfo
+	blocks []archiveBlock
+
+	// The most recently read block, which sequential reads reuse.
+	mu        sync.Mutex
+	cached    int
+	cachedEnt []ct.LogEntry
+}
+
+// OpenArchive reads the info and index of the archive of |size| bytes in |r|,
+// and returns a reader for its entries.
+func OpenArchive(r io.ReaderAt, size int64) (*ArchiveReader, error) {
+	if size < int64(len(archiveMagic))+archiveTrailerSize {
+		return nil, errors.New("archive is too short")
+	}
+	magic := make([]byte, len(archiveMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return nil, err
+	}
+	trailer := make([]byte, archiveTrailerSize)
+	if _, err := r.ReadAt(trailer, size-archiveTrailerSize); err != nil {
+		return nil, err
+	}
+	if string(magic) != archiveMagic || string(trailer[24:]) != archiveMagic {
+		return nil, errors.New("not an archive")
+	}
+	infoOffset := int64(binary.BigEndian.Uint64(trailer))
+	indexOffset := int64(binary.BigEndian.Uint64(trailer[8:]))
+	numBlocks := int64(binary.BigEndian.Uint64(trailer[16:]))
+	indexEnd := size - archiveTrailerSize
+	if infoOffset < int64(len(archiveMagic)) || indexOffset < infoOffset ||
+		numBlocks < 0 || numBlocks > (indexEnd-indexOffset)/archiveIndexEntrySize ||
+		indexOffset+numBlocks*archiveIndexEntrySize != indexEnd {
+		return nil, errors.New("archive trailer is corrupt")
+	}
+
+	info := make([]byte, indexOffset-infoOffset)
+	if _, err := r.ReadAt(info, infoOffset); err != nil {
+		return nil, err
+	}
+	a := &ArchiveReader{r: r, cached: -1}
+	if err := json.Unmarshal(info, &a.info); err != nil {
+		return nil, fmt.Errorf("failed to parse archive info: %v", err)
+	}
+	index := make([]byte, numBlocks*archiveIndexEntrySize)
+	if _, err := r.ReadAt(index, indexOffset); err != nil {
+		return nil, err
+	}
+	next := a.info.Start
+	for ; len(index) > 0; index = index[archiveIndexEntrySize:] {
+		b := archiveBlock{
+			start:  int64(binary.BigEndian.Uint64(index)),
+			count:  int64(binary.BigEndian.Uint32(index[8:])),
+			offset: int64(binary.BigEndian.Uint64(index[12:])),
+			length: int64(binary.BigEndian.Uint64(index[20:])),
+		}
+		if b.start != next || b.count == 0 || b.offset < int64(len(archiveMagic)) || b.offset+b.length > infoOffset {
+			return nil, errors.New("archive index is corrupt")
+		}
+		next += b.count
+		a.blocks = append(a.blocks, b)
+	}
+	if next != a.info.End+1 {
+		return nil, fmt.Errorf("archive index covers entries up to %d, but info says %d", next-1, a.info.End)
+	}
+	return a, nil
+}
+
+// Info returns the description of the entries in the archive.
+func (a *ArchiveReader) Info() ArchiveInfo {
+	return a.info
+}
+
+// readBlock returns the entries of the |i|th block.
+func (a *ArchiveReader) readBlock(i int) ([]ct.LogEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cached == i {
+		return a.cachedEnt, nil
+	}
+	b := a.blocks[i]
+	zr, err := gzip.NewReader(io.NewSectionReader(a.r, b.offset, b.length))
+	if err != nil {
+		return nil, fmt.Errorf("block %d: %v", i, err)
+	}
+	r := bufio.NewReader(zr)
+	entries := make([]ct.LogEntry, b.count)
+	for j := range entries {
+		if err := readArchiveEntry(r, &entries[j]); err != nil {
+			return nil, fmt.Errorf("entry %d: %v", b.start+int64(j), err)
+		}
+		entries[j].Index = b.start + int64(j)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("block %d has trailing data", i)
+	}
+	a.cached, a.cachedEnt = i, entries
+	return entries, nil
+}
+
+func readArchiveEntry(r io.Reader, entry *ct.LogEntry) error {
+	leaf, err := readArchiveBytes(r)
+	if err != nil {
+		return err
+	}
+	// Parse from a Buffer, as client.LogClient.GetEntries does, so that
+	// empty extensions are read the same way.
+	l, err := ct.ReadMerkleTreeLeaf(bytes.NewBuffer(leaf))
+	if err != nil {
+		return err
+	}
+	entry.Leaf = *l
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return err
+	}
+	// As client.LogClient.GetEntries does, represent an empty chain as an
+	// empty slice rather than nil.
+	entry.Chain = []ct.ASN1Cert{}
+	for i := uint32(0); i < n; i++ {
+		c, err := readArchiveBytes(r)
+		if err != nil {
+			return err
+		}
+		entry.Chain = append(entry.Chain, c)
+	}
+	return nil
+}
+
+// readArchiveBytes reads a uint32 length prefixed byte string.
+func readArchiveBytes(r io.Reader) ([]byte, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	// Read through a LimitReader rather than into a buffer of length n, so
+	// that a corrupt length doesn't make us allocate more than the data
+	// really holds.
+	b, err := ioutil.ReadAll(io.LimitReader(r, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != int(n) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b, nil
+}
+
+// Entries returns the entries from |start| to |end| inclusive, which must
+// all be in the archive, as client.LogClient.GetEntries would.  Their
+// X509Cert and Precert aren't parsed.
+func (a *ArchiveReader) Entries(start, end int64) ([]ct.LogEntry, error) {
+	if start > end || start < a.info.Start || end > a.info.End {
+		return nil, ErrNotInArchive
+	}
+	i := sort.Search(len(a.blocks), func(i int) bool {
+		b := a.blocks[i]
+		return b.start+b.count > start
+	})
+	var entries []ct.LogEntry
+	for ; i < len(a.blocks) && a.blocks[i].start <= end; i++ {
+		block, err := a.readBlock(i)
+		if err != nil {
+			return nil, err
+		}
+		b := a.blocks[i]
+		from, to := int64(0), b.count
+		if start > b.start {
+			from = start - b.start
+		}
+		if end < b.start+b.count-1 {
+			to = end - b.start + 1
+		}
+		entries = append(entries, block[from:to]...)
+	}
+	return entries, nil
+}
+
+// Entry returns the entry at |index|, which must be in the archive.
+func (a *ArchiveReader) Entry(index int64) (*ct.LogEntry, error) {
+	entries, err := a.Entries(index, index)
+	if err != nil {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// ExportOptions holds optional configuration for Export.
+type ExportOptions struct {
+	ArchiveOptions
+	// Maximum number of entries to request per call to get-entries.  Zero
+	// means DefaultExportBatchSize.
+	BatchSize int
+}
+
+// DefaultExportBatchSize is the number of entries Export requests at a time,
+// unless the ExportOptions say otherwise.
+const DefaultExportBatchSize = 1000
+
+// Export downloads the entries of the log at |logClient| from |start| to
+// |end| inclusive, and writes them to an archive in |w|, which is closed
+// afterwards, whether or not the export succeeds, if it is an io.Closer.  If end is negative, entries are
+// exported up to the end of the log's current tree.  The ArchiveInfo written
+// is returned.
+func Export(ctx context.Context, logClient *client.LogClient, start, end int64, w io.Writer, opts ExportOptions) (*ArchiveInfo, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultExportBatchSize
+	}
+	info, err := export(ctx, logClient, start, end, w, opts)
+	if err != nil {
+		if c, ok := w.(io.Closer); ok {
+			c.Close()
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
+func export(ctx context.Context, logClient *client.LogClient, start, end int64, w io.Writer, opts ExportOptions) (*ArchiveInfo, error) {
+	sth, err := logClient.GetSTHWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if end < 0 {
+		end = int64(sth.TreeSize) - 1
+	}
+	if start < 0 || start > end || end >= int64(sth.TreeSize) {
+		return nil, fmt.Errorf("range [%d, %d] isn't in the log's tree of size %d", start, end, sth.TreeSize)
+	}
+	a, err := NewArchiveWriter(w, ArchiveInfo{LogURL: logClient.URI(), STH: sth, Start: start}, opts.ArchiveOptions)
+	if err != nil {
+		return nil, err
+	}
+	for next := start; next <= end; {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		batchEnd := next + int64(opts.BatchSize) - 1
+		if batchEnd > end {
+			batchEnd = end
+		}
+		entries, err := logClient.GetEntries(next, batchEnd)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 || int64(len(entries)) > batchEnd-next+1 {
+			return nil, fmt.Errorf("log returned %d entries for range [%d, %d]", len(entries), next, batchEnd)
+		}
+		for i := range entries {
+			if err := a.Write(&entries[i]); err != nil {
+				return nil, err
+			}
+		}
+		next += int64(len(entries))
+	}
+	return a.Close()
+}
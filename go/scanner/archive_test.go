@@ -0,0 +1,146 @@
+package scanner
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"golang.org/x/net/context"
+)
+
+// fourEntries returns the parsed entries of FourEntries.
+func fourEntries(t *testing.T) []ct.LogEntry {
+	ts := httptest.NewServer(newGrowingLog(t, 4))
+	defer ts.Close()
+	entries, err := client.New(ts.URL).GetEntries(0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	entries := fourEntries(t)
+	for _, blockSize := range []int{1, 3, 4, 10} {
+		var buf bytes.Buffer
+		w, err := NewArchiveWriter(&buf, ArchiveInfo{LogURL: "https://log.example.com", Start: 0}, ArchiveOptions{BlockSize: blockSize})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range entries {
+			if err := w.Write(&entries[i]); err != nil {
+				t.Fatalf("block size %d: Write(%d)=%v", blockSize, i, err)
+			}
+		}
+		info, err := w.Close()
+		if err != nil {
+			t.Fatalf("block size %d: Close()=%v", blockSize, err)
+		}
+		if info.End != 3 {
+			t.Errorf("block size %d: Close() info.End=%d, want 3", blockSize, info.End)
+		}
+
+		r, err := OpenArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("block size %d: OpenArchive()=%v", blockSize, err)
+		}
+		if got := r.Info(); !reflect.DeepEqual(got, *info) {
+			t.Errorf("block size %d: Info()=%+v, want %+v", blockSize, got, *info)
+		}
+		for i, tc := range []struct{ start, end int64 }{{0, 3}, {1, 2}, {3, 3}, {2, 3}, {0, 0}} {
+			got, err := r.Entries(tc.start, tc.end)
+			if err != nil {
+				t.Errorf("block size %d: #%d: Entries(%d, %d)=%v", blockSize, i, tc.start, tc.end, err)
+				continue
+			}
+			if want := entries[tc.start : tc.end+1]; !reflect.DeepEqual(got, want) {
+				t.Errorf("block size %d: #%d: Entries(%d, %d)=%+v, want %+v", blockSize, i, tc.start, tc.end, got, want)
+			}
+		}
+		if _, err := r.Entry(4); err != ErrNotInArchive {
+			t.Errorf("block size %d: Entry(4)=%v, want ErrNotInArchive", blockSize, err)
+		}
+	}
+}
+
+func TestArchiveWriterRejectsGaps(t *testing.T) {
+	entries := fourEntries(t)
+	w, err := NewArchiveWriter(&bytes.Buffer{}, ArchiveInfo{Start: 1}, ArchiveOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&entries[0]); err == nil {
+		t.Errorf("Write(entry 0) to archive starting at 1 succeeded")
+	}
+	if err := w.Write(&entries[1]); err != nil {
+		t.Errorf("Write(entry 1)=%v", err)
+	}
+	if err := w.Write(&entries[3]); err == nil {
+		t.Errorf("Write(entry 3) after entry 1 succeeded")
+	}
+}
+
+func TestOpenArchiveRejectsCorruptArchives(t *testing.T) {
+	entries := fourEntries(t)
+	var buf bytes.Buffer
+	w, err := NewArchiveWriter(&buf, ArchiveInfo{}, ArchiveOptions{BlockSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range entries {
+		w.Write(&entries[i])
+	}
+	if _, err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	good := buf.Bytes()
+	trailer := len(good) - archiveTrailerSize
+	for i, corrupt := range []func([]byte) []byte{
+		func(b []byte) []byte { return b[:10] },
+		func(b []byte) []byte { b[0] = 'X'; return b },
+		func(b []byte) []byte { b[len(b)-1] = 'X'; return b },
+		// Index offset past the end of the file.
+		func(b []byte) []byte { b[trailer+8] = 0xff; return b },
+		// Second block claims to start at the wrong index.
+		func(b []byte) []byte { b[trailer-archiveIndexEntrySize+7]++; return b },
+		// Truncated in the middle.
+		func(b []byte) []byte { return append(b[:20], b[len(b)-archiveTrailerSize:]...) },
+	} {
+		b := corrupt(append([]byte(nil), good...))
+		if _, err := OpenArchive(bytes.NewReader(b), int64(len(b))); err == nil {
+			t.Errorf("#%d: OpenArchive(corrupt archive) succeeded", i)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	entries := fourEntries(t)
+	ts := httptest.NewServer(newGrowingLog(t, 4))
+	defer ts.Close()
+	var buf bytes.Buffer
+	info, err := Export(context.Background(), client.New(ts.URL), 1, -1, &buf, ExportOptions{BatchSize: 2, ArchiveOptions: ArchiveOptions{BlockSize: 2}})
+	if err != nil {
+		t.Fatalf("Export()=%v", err)
+	}
+	if info.Start != 1 || info.End != 3 || info.STH.TreeSize != 4 || info.LogURL != ts.URL {
+		t.Errorf("Export()=%+v, want entries 1 to 3 of tree of size 4 of %s", info, ts.URL)
+	}
+	r, err := OpenArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("OpenArchive()=%v", err)
+	}
+	got, err := r.Entries(1, 3)
+	if err != nil {
+		t.Fatalf("Entries(1, 3)=%v", err)
+	}
+	if !reflect.DeepEqual(got, entries[1:]) {
+		t.Errorf("Entries(1, 3)=%+v, want %+v", got, entries[1:])
+	}
+
+	if _, err := Export(context.Background(), client.New(ts.URL), 2, 4, &bytes.Buffer{}, ExportOptions{}); err == nil {
+		t.Errorf("Export(2, 4) of tree of size 4 succeeded")
+	}
+}
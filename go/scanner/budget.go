@@ -0,0 +1,79 @@
+package scanner
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Budget limits the rate at which entries are fetched from logs, using a
+// token bucket of entries.  A Budget may be shared by several Scanners, e.g.
+// those run by a MultiScanner, to keep their combined bandwidth within a
+// limit; it's measured in entries, which make up nearly all of each
+// get-entries response.
+type Budget struct {
+	rate  float64 // Entries per second
+	burst float64 // Maximum number of entries fetched at once
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewBudget returns a Budget which allows |entriesPerSecond| entries to be
+// fetched per second, in bursts of up to |burst| entries.  If
+// entriesPerSecond is not positive NewBudget returns nil, and a nil Budget
+// allows every fetch immediately.
+func NewBudget(entriesPerSecond float64, burst int) *Budget {
+	if entriesPerSecond <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Budget{
+		rate:   entriesPerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes |n| entries from the bucket, and returns how long the caller
+// must wait before fetching them.
+func (b *Budget) reserve(n int64, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	// Tokens can go negative, which reserves them for callers which are
+	// already waiting, and lets batches larger than the burst through.
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// wait blocks until |n| entries may be fetched, or ctx is cancelled.
+func (b *Budget) wait(ctx context.Context, n int64) error {
+	if b == nil {
+		return nil
+	}
+	d := b.reserve(n, time.Now())
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
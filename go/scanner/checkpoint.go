@@ -0,0 +1,175 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Checkpoint records how far a scan of a log has got.
+type Checkpoint struct {
+	// Index of the first entry which hasn't been processed.  Every entry
+	// before it has been.
+	NextIndex int64 `json:"next_index"`
+	// Hash of the configuration of the matcher the entries were processed
+	// with.  A scan with a different matcher doesn't resume from the
+	// checkpoint, as the new matcher may match entries the old one didn't.
+	MatcherHash string `json:"matcher_hash"`
+}
+
+// CheckpointStore persists the Checkpoints of scans, so that a scan which is
+// interrupted can be resumed without rescanning the log from the start.
+// Scans are identified by the URLs of the logs they scan.  Implementations
+// must be safe for concurrent use.
+type CheckpointStore interface {
+	// LoadCheckpoint returns the checkpoint last saved for the log, or nil
+	// if none has been.
+	LoadCheckpoint(logURL string) (*Checkpoint, error)
+	// SaveCheckpoint records cp as the checkpoint of the log.
+	SaveCheckpoint(logURL string, cp Checkpoint) error
+}
+
+// FileCheckpointStore is a CheckpointStore which keeps checkpoints in a JSON
+// file, mapping log URLs to their checkpoints.  The file is rewritten
+// atomically by renaming a temporary file over it, so it is never left
+// partially written.
+type FileCheckpointStore struct {
+	path string
+
+	mu          sync.Mutex
+	checkpoints map[string]Checkpoint
+}
+
+// NewFileCheckpointStore returns a FileCheckpointStore which keeps its
+// checkpoints in the file at path, loading any already there.  The file
+// needn't exist.
+func NewFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	s := &FileCheckpointStore{path: path, checkpoints: make(map[string]Checkpoint)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.checkpoints); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadCheckpoint implements CheckpointStore.
+func (s *FileCheckpointStore) LoadCheckpoint(logURL string) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, ok := s.checkpoints[logURL]
+	if !ok {
+		return nil, nil
+	}
+	return &cp, nil
+}
+
+// SaveCheckpoint implements CheckpointStore.
+func (s *FileCheckpointStore) SaveCheckpoint(logURL string, cp Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, had := s.checkpoints[logURL]
+	s.checkpoints[logURL] = cp
+	if err := s.write(); err != nil {
+		// Keep memory consistent with the file.
+		if had {
+			s.checkpoints[logURL] = old
+		} else {
+			delete(s.checkpoints, logURL)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *FileCheckpointStore) write() error {
+	data, err := json.MarshalIndent(s.checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// matcherHash returns a hash of the configuration of the scan's matcher, for
+// its checkpoints.  The configuration is taken to be the matcher's type and
+// fields, along with whether only precerts are matched.
+func matcherHash(opts *ScannerOptions) string {
+	m := interface{}(opts.Matcher)
+	if opts.EntryMatcher != nil {
+		m = opts.EntryMatcher
+	}
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s precertOnly=%t", describeMatcher(m), opts.PrecertOnly)))
+	return hex.EncodeToString(h[:])
+}
+
+// progress tracks which of a scan's ranges have been processed, so that the
+// scan's checkpoint can be advanced past every range before the first one
+// which hasn't, however the ranges' entries are interleaved between the
+// workers.
+type progress struct {
+	store  CheckpointStore
+	logURL string
+	hash   string
+
+	mu     sync.Mutex
+	ranges []fetchRange
+	// Number of entries of each range which haven't been processed.
+	remaining []int64
+	// Index of the first range which hasn't been processed.
+	next int
+	// The first error saving a checkpoint.
+	err error
+}
+
+func newProgress(store CheckpointStore, logURL, hash string, ranges []fetchRange) *progress {
+	p := &progress{store: store, logURL: logURL, hash: hash, ranges: ranges}
+	for _, r := range ranges {
+		p.remaining = append(p.remaining, r.end-r.start+1)
+	}
+	return p
+}
+
+// processed records that an entry of the range with index rng has been
+// processed, and saves a checkpoint if that completes the earliest range
+// still outstanding.
+func (p *progress) processed(rng int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.remaining[rng]--
+	if rng != p.next || p.remaining[rng] > 0 {
+		return
+	}
+	for p.next < len(p.ranges) && p.remaining[p.next] == 0 {
+		p.next++
+	}
+	cp := Checkpoint{NextIndex: p.ranges[p.next-1].end + 1, MatcherHash: p.hash}
+	if err := p.store.SaveCheckpoint(p.logURL, cp); err != nil && p.err == nil {
+		p.err = err
+	}
+}
@@ -0,0 +1,76 @@
+package scanner
+
+import (
+	"database/sql"
+	"errors"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const checkpointSchema = `
+        CREATE TABLE IF NOT EXISTS checkpoints (
+                log_url         STRING NOT NULL PRIMARY KEY,
+                next_index      INTEGER NOT NULL,
+                matcher_hash    STRING NOT NULL
+        );`
+
+const selectCheckpoint = `SELECT next_index, matcher_hash FROM checkpoints WHERE log_url = $1;`
+const upsertCheckpoint = `INSERT OR REPLACE INTO checkpoints(log_url, next_index, matcher_hash) VALUES ($1, $2, $3);`
+
+// SQLiteCheckpointStore is a CheckpointStore which keeps checkpoints in an
+// SQLite3 database, e.g. one shared with other tools' state.
+type SQLiteCheckpointStore struct {
+	db               *sql.DB
+	selectCheckpoint *sql.Stmt
+	upsertCheckpoint *sql.Stmt
+}
+
+// NewSQLiteCheckpointStore opens the SQLite3 database at dbPath, creating it
+// and its checkpoints table if they don't exist.
+func NewSQLiteCheckpointStore(dbPath string) (*SQLiteCheckpointStore, error) {
+	if len(dbPath) == 0 {
+		return nil, errors.New("empty database file name")
+	}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLiteCheckpointStore{db: db}
+	if _, err := db.Exec(checkpointSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if s.selectCheckpoint, err = db.Prepare(selectCheckpoint); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if s.upsertCheckpoint, err = db.Prepare(upsertCheckpoint); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the underlying database.
+func (s *SQLiteCheckpointStore) Close() error {
+	return s.db.Close()
+}
+
+// LoadCheckpoint implements CheckpointStore.
+func (s *SQLiteCheckpointStore) LoadCheckpoint(logURL string) (*Checkpoint, error) {
+	var cp Checkpoint
+	err := s.selectCheckpoint.QueryRow(logURL).Scan(&cp.NextIndex, &cp.MatcherHash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// SaveCheckpoint implements CheckpointStore.
+func (s *SQLiteCheckpointStore) SaveCheckpoint(logURL string, cp Checkpoint) error {
+	_, err := s.upsertCheckpoint.Exec(logURL, cp.NextIndex, cp.MatcherHash)
+	return err
+}
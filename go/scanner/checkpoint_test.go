@@ -0,0 +1,167 @@
+package scanner
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+)
+
+func testCheckpointStore(t *testing.T, s CheckpointStore) {
+	if cp, err := s.LoadCheckpoint("a"); cp != nil || err != nil {
+		t.Fatalf("LoadCheckpoint(empty)=%+v,%v, want nil,nil", cp, err)
+	}
+	for _, cp := range []Checkpoint{{10, "x"}, {20, "y"}} {
+		if err := s.SaveCheckpoint("a", cp); err != nil {
+			t.Fatalf("SaveCheckpoint(%+v)=%v", cp, err)
+		}
+		got, err := s.LoadCheckpoint("a")
+		if err != nil || got == nil || *got != cp {
+			t.Errorf("LoadCheckpoint()=%+v,%v, want %+v", got, err, cp)
+		}
+	}
+	if cp, err := s.LoadCheckpoint("b"); cp != nil || err != nil {
+		t.Errorf("LoadCheckpoint(other log)=%+v,%v, want nil,nil", cp, err)
+	}
+}
+
+func TestFileCheckpointStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoints.json")
+	s, err := NewFileCheckpointStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckpointStore(t, s)
+
+	// The checkpoints survive a restart.
+	s, err = NewFileCheckpointStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp, err := s.LoadCheckpoint("a"); err != nil || cp == nil || cp.NextIndex != 20 {
+		t.Errorf("LoadCheckpoint() after reload=%+v,%v, want index 20", cp, err)
+	}
+}
+
+func TestSQLiteCheckpointStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewSQLiteCheckpointStore(filepath.Join(dir, "checkpoints.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testCheckpointStore(t, s)
+}
+
+func TestProgressSavesContiguousPrefix(t *testing.T) {
+	store, err := NewFileCheckpointStore(filepath.Join(os.TempDir(), "unused"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.path = "/dev/null/unwritable"
+	mem := &memCheckpointStore{cps: make(map[string]Checkpoint)}
+	p := newProgress(mem, "log", "h", []fetchRange{{start: 0, end: 1, id: 0}, {start: 2, end: 3, id: 1}, {start: 4, end: 4, id: 2}})
+	for i, tc := range []struct {
+		rng  int
+		want int64 // -1 means no checkpoint
+	}{
+		{1, -1}, {1, -1}, {0, -1}, {2, -1}, {0, 5},
+	} {
+		p.processed(tc.rng)
+		cp, _ := mem.LoadCheckpoint("log")
+		switch {
+		case tc.want < 0 && cp != nil:
+			t.Errorf("#%d: got checkpoint %+v, want none", i, cp)
+		case tc.want >= 0 && (cp == nil || cp.NextIndex != tc.want):
+			t.Errorf("#%d: got checkpoint %+v, want index %d", i, cp, tc.want)
+		}
+	}
+
+	// Failures to save are recorded.
+	p = newProgress(store, "log", "h", []fetchRange{{start: 0, end: 0, id: 0}})
+	p.processed(0)
+	if p.err == nil {
+		t.Error("processed() with unwritable store didn't record an error")
+	}
+}
+
+type memCheckpointStore struct {
+	mu  sync.Mutex
+	cps map[string]Checkpoint
+}
+
+func (m *memCheckpointStore) LoadCheckpoint(logURL string) (*Checkpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp, ok := m.cps[logURL]
+	if !ok {
+		return nil, nil
+	}
+	return &cp, nil
+}
+
+func (m *memCheckpointStore) SaveCheckpoint(logURL string, cp Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cps[logURL] = cp
+	return nil
+}
+
+func TestScanResumesFromCheckpoint(t *testing.T) {
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ct/v1/get-sth":
+			w.Write([]byte(FourEntrySTH))
+		case "/ct/v1/get-entries":
+			atomic.AddInt32(&fetches, 1)
+			w.Write([]byte(FourEntries))
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	store := &memCheckpointStore{cps: make(map[string]Checkpoint)}
+	scan := func(m Matcher) int {
+		opts := ScannerOptions{Matcher: m, BatchSize: 10, NumWorkers: 1, ParallelFetch: 1, Quiet: true, Checkpoints: store}
+		var matches int32
+		found := func(*ct.LogEntry) { atomic.AddInt32(&matches, 1) }
+		if err := NewScanner(client.New(ts.URL), opts).Scan(found, found); err != nil {
+			t.Fatal(err)
+		}
+		return int(matches)
+	}
+
+	if got := scan(&MatchAll{}); got != 4 {
+		t.Errorf("first scan matched %d entries, want 4", got)
+	}
+	if cp := store.cps[ts.URL]; cp.NextIndex != 4 {
+		t.Errorf("checkpoint after first scan=%+v, want index 4", cp)
+	}
+	if got := scan(&MatchAll{}); got != 0 || fetches != 1 {
+		t.Errorf("resumed scan matched %d entries after %d fetches, want 0 after 1", got, fetches)
+	}
+	// A different matcher rescans the log.
+	m := &MatchSubjectRegex{regexp.MustCompile(".*\\.google\\.com"), regexp.MustCompile(".*")}
+	if got := scan(m); got != 1 || fetches != 2 {
+		t.Errorf("scan with new matcher matched %d entries after %d fetches, want 1 after 2", got, fetches)
+	}
+}
@@ -0,0 +1,164 @@
+package scanner
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/sctverify"
+)
+
+// DedupMode is how a Deduper reports a precertificate and its certificate.
+type DedupMode int
+
+const (
+	// The first entry of each pair found is reported straight away, and
+	// the second isn't reported at all.
+	DedupFirstWins DedupMode = iota
+	// The first entry of each pair found is held until the second is
+	// found, and then the two are reported together.  Entries whose pair
+	// isn't found are reported on their own when the Deduper is flushed, or
+	// when they are the oldest held and the Deduper is full.
+	DedupMerge
+)
+
+// DefaultDedupCapacity is the number of issuances a Deduper remembers, unless
+// it is told otherwise.
+const DefaultDedupCapacity = 1000000
+
+// Issuance is a certificate and the precertificate it was issued from, which
+// a Deduper reports as one event.  Either entry may be nil, if it hasn't been
+// found.
+type Issuance struct {
+	// SHA-256 hash of the TBSCertificate the entries share, without the
+	// poison and embedded SCT extensions.
+	TBSHash [sha256.Size]byte
+	Cert    *ct.LogEntry
+	Precert *ct.LogEntry
+}
+
+// Deduper correlates the certificates and precertificates found by a scan,
+// so that each certificate issued is reported once however many of its
+// certificate and precertificate are logged.  A certificate is correlated
+// with its precertificate by their TBSCertificates, which are the same once
+// the certificate's embedded SCTs are removed, as logs remove the poison from
+// precertificates' (RFC6962 section 3.2).
+//
+// Its Add method can be passed to Scan or Follow for both kinds of entry.  A
+// Deduper remembers a bounded number of issuances, so pairs logged far apart
+// may be missed.  Entries logged more than once are reported once.
+type Deduper struct {
+	mode     DedupMode
+	capacity int
+	found    func(*Issuance)
+
+	mu sync.Mutex
+	// The issuances remembered, oldest first, and the elements of the list
+	// holding them by hash.
+	order  list.List
+	byHash map[[sha256.Size]byte]*list.Element
+}
+
+// NewDeduper returns a Deduper in the given mode which reports issuances to
+// |found|, remembering up to |capacity| of them, or DefaultDedupCapacity if
+// it is zero.  |found| is called with the Deduper's lock held, so issuances
+// are reported one at a time.
+func NewDeduper(mode DedupMode, capacity int, found func(*Issuance)) *Deduper {
+	if capacity <= 0 {
+		capacity = DefaultDedupCapacity
+	}
+	return &Deduper{mode: mode, capacity: capacity, found: found, byHash: make(map[[sha256.Size]byte]*list.Element)}
+}
+
+// tbsHash returns the hash which pairs |entry| with its counterpart.
+func tbsHash(entry *ct.LogEntry) ([sha256.Size]byte, error) {
+	switch {
+	case entry.Precert != nil:
+		return sha256.Sum256(entry.Leaf.TimestampedEntry.PrecertEntry.TBSCertificate), nil
+	case entry.X509Cert != nil:
+		tbs, err := sctverify.PrecertificateTBS(entry.X509Cert)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		return sha256.Sum256(tbs), nil
+	}
+	return [sha256.Size]byte{}, fmt.Errorf("entry %d has neither a certificate nor a precertificate", entry.Index)
+}
+
+// Add adds an entry found by a scan, whose X509Cert or Precert is set.
+// Entries which can't be correlated are reported on their own straight away.
+func (d *Deduper) Add(entry *ct.LogEntry) {
+	hash, err := tbsHash(entry)
+	if err != nil {
+		log.Printf("Failed to correlate entry %d: %s", entry.Index, err)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.found(issuanceOf(hash, entry))
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if elem, ok := d.byHash[hash]; ok {
+		iss := elem.Value.(*Issuance)
+		if (entry.Precert != nil && iss.Precert != nil) || (entry.Precert == nil && iss.Cert != nil) {
+			// Logged again.
+			return
+		}
+		if entry.Precert != nil {
+			iss.Precert = entry
+		} else {
+			iss.Cert = entry
+		}
+		if d.mode == DedupMerge {
+			d.found(iss)
+		}
+		// The pair is complete, so nothing more is wanted of it but to
+		// ignore entries logged again.
+		d.order.MoveToBack(elem)
+		return
+	}
+
+	iss := issuanceOf(hash, entry)
+	if d.mode == DedupFirstWins {
+		d.found(iss)
+	}
+	d.byHash[hash] = d.order.PushBack(iss)
+	for d.order.Len() > d.capacity {
+		d.evict(d.order.Front())
+	}
+}
+
+func issuanceOf(hash [sha256.Size]byte, entry *ct.LogEntry) *Issuance {
+	iss := &Issuance{TBSHash: hash}
+	if entry.Precert != nil {
+		iss.Precert = entry
+	} else {
+		iss.Cert = entry
+	}
+	return iss
+}
+
+// evict forgets an issuance, reporting it first if it is only half found and
+// being held.
+func (d *Deduper) evict(elem *list.Element) {
+	iss := elem.Value.(*Issuance)
+	if d.mode == DedupMerge && (iss.Cert == nil || iss.Precert == nil) {
+		d.found(iss)
+	}
+	d.order.Remove(elem)
+	delete(d.byHash, iss.TBSHash)
+}
+
+// Flush reports the entries which are being held for their pair, e.g. once
+// a scan completes, and forgets every issuance.
+func (d *Deduper) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for d.order.Len() > 0 {
+		d.evict(d.order.Front())
+	}
+}
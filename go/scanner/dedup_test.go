@@ -0,0 +1,88 @@
+package scanner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// issuancePair returns the entries of a certificate with embedded SCTs, with
+// index |index|, and of its precertificate, with index |index|+1.
+func issuancePair(t *testing.T, key *ecdsa.PrivateKey, serial int64, index int64) (cert, precert *ct.LogEntry) {
+	template := testcert.LeafTemplate("www.example.com")
+	template.SerialNumber = big.NewInt(serial)
+	// The precertificate's TBSCertificate, as logged, is the certificate's
+	// without the SCTs.
+	tbs := testcert.Issue(t, template, key, nil)
+	sctList, err := asn1.Marshal([]byte{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}, Value: sctList}}
+	c := testcert.Issue(t, template, key, nil)
+
+	cert = &ct.LogEntry{Index: index, X509Cert: c}
+	precert = &ct.LogEntry{Index: index + 1, Precert: &ct.Precertificate{TBSCertificate: *tbs}}
+	precert.Leaf.TimestampedEntry.PrecertEntry.TBSCertificate = tbs.RawTBSCertificate
+	return cert, precert
+}
+
+// reported summarises an Issuance as the indices of its certificate and
+// precertificate entries, or -1 for those missing.
+func reported(iss *Issuance) [2]int64 {
+	r := [2]int64{-1, -1}
+	if iss.Cert != nil {
+		r[0] = iss.Cert.Index
+	}
+	if iss.Precert != nil {
+		r[1] = iss.Precert.Index
+	}
+	return r
+}
+
+func TestDeduper(t *testing.T) {
+	key := testcert.NewKey(t)
+	cert1, precert1 := issuancePair(t, key, 1, 10)
+	cert2, precert2 := issuancePair(t, key, 2, 20)
+	cert3, _ := issuancePair(t, key, 3, 30)
+	_, precert4 := issuancePair(t, key, 4, 40)
+	entries := []*ct.LogEntry{precert1, cert2, cert1, cert3, precert1, precert2, precert4}
+
+	for _, test := range []struct {
+		mode     DedupMode
+		capacity int
+		want     [][2]int64
+	}{
+		{DedupFirstWins, 0, [][2]int64{{-1, 11}, {20, -1}, {30, -1}, {-1, 41}}},
+		{DedupMerge, 0, [][2]int64{{10, 11}, {20, 21}, {30, -1}, {-1, 41}}},
+		// Once issuances 1 and 2 are forgotten, their entries are
+		// reported again.
+		{DedupFirstWins, 1, [][2]int64{{-1, 11}, {20, -1}, {10, -1}, {30, -1}, {-1, 11}, {-1, 21}, {-1, 41}}},
+		{DedupMerge, 1, [][2]int64{{-1, 11}, {20, -1}, {10, -1}, {30, -1}, {-1, 11}, {-1, 21}, {-1, 41}}},
+	} {
+		var got [][2]int64
+		d := NewDeduper(test.mode, test.capacity, func(iss *Issuance) { got = append(got, reported(iss)) })
+		for _, e := range entries {
+			d.Add(e)
+		}
+		d.Flush()
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("mode %d, capacity %d: reported %v, want %v", test.mode, test.capacity, got, test.want)
+		}
+	}
+}
+
+func TestDeduperReportsUncorrelatedEntries(t *testing.T) {
+	var got []*Issuance
+	d := NewDeduper(DedupMerge, 0, func(iss *Issuance) { got = append(got, iss) })
+	d.Add(&ct.LogEntry{Index: 5})
+	if len(got) != 1 || got[0].Cert == nil || got[0].Cert.Index != 5 {
+		t.Errorf("Deduper reported %+v for an entry without a certificate, want it on its own", got)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/scanner"
+	"golang.org/x/net/context"
+)
+
+var logURI = flag.String("log_uri", "http://ct.googleapis.com/aviator", "CT log base URI")
+var output = flag.String("output", "", "File to write the archive to")
+var start = flag.Int64("start", 0, "Index of the first entry to export")
+var end = flag.Int64("end", -1, "Index of the last entry to export; -1 means the last entry in the log's current tree")
+var batchSize = flag.Int("batch_size", scanner.DefaultExportBatchSize, "Max number of entries to request per call to get-entries")
+var blockSize = flag.Int("block_size", scanner.DefaultArchiveBlockSize, "Number of entries in each compressed block of the archive")
+
+func main() {
+	flag.Parse()
+	if *output == "" {
+		log.Fatal("Must specify --output")
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	info, err := scanner.Export(context.Background(), client.New(*logURI), *start, *end, f, scanner.ExportOptions{
+		ArchiveOptions: scanner.ArchiveOptions{BlockSize: *blockSize},
+		BatchSize:      *batchSize,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Exported entries %d to %d of %s, from tree of size %d", info.Start, info.End, info.LogURL, info.STH.TreeSize)
+}
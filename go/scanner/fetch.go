@@ -0,0 +1,273 @@
+package scanner
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/merkle"
+	"golang.org/x/net/context"
+)
+
+// DefaultFetchRetryDelay is how long the scanner waits before retrying a range
+// of entries the first time fetching it fails, unless the ScannerOptions say
+// otherwise.  The delay doubles with each further failure, up to
+// maxFetchRetryDelay.
+const DefaultFetchRetryDelay = time.Second
+
+const maxFetchRetryDelay = time.Minute
+
+// FailedRange is a range of entries which the scanner gave up fetching.
+type FailedRange struct {
+	// Indices of the first and last entries which weren't fetched.
+	Start, End int64
+	// Why the last attempt to fetch them failed.
+	Err error
+}
+
+// FetchError is returned by Scan and Follow when some ranges of entries
+// couldn't be fetched, or failed verification, within MaxFetchAttempts.  The
+// rest of the entries were still scanned.
+type FetchError struct {
+	Ranges []FailedRange
+}
+
+func (e FetchError) Error() string {
+	var ranges []string
+	for _, r := range e.Ranges {
+		ranges = append(ranges, fmt.Sprintf("[%d, %d]: %v", r.Start, r.End, r.Err))
+	}
+	return fmt.Sprintf("failed to fetch %d ranges of entries: %s", len(e.Ranges), strings.Join(ranges, "; "))
+}
+
+// fetchRange represents a range of certs to fetch from a CT log
+type fetchRange struct {
+	start int64
+	end   int64
+	// The index of the range in the scan
+	id int
+	// Number of times fetching the range has failed
+	failures int
+}
+
+// fetchQueue holds the ranges still to be fetched in a scan.  Any fetcher can
+// take any range, so a range which fails is retried by whichever fetcher is
+// free once its retry delay has passed, while the other ranges carry on being
+// fetched.
+type fetchQueue struct {
+	ranges chan fetchRange
+	// Counts the ranges which haven't been fetched or given up on.
+	pending sync.WaitGroup
+
+	mu     sync.Mutex
+	failed []FailedRange
+}
+
+func newFetchQueue(ranges []fetchRange) *fetchQueue {
+	// Each range is only ever in the channel once, so sends never block.
+	q := &fetchQueue{ranges: make(chan fetchRange, len(ranges))}
+	q.pending.Add(len(ranges))
+	for _, r := range ranges {
+		q.ranges <- r
+	}
+	go func() {
+		q.pending.Wait()
+		close(q.ranges)
+	}()
+	return q
+}
+
+// done records that the range has been fetched.
+func (q *fetchQueue) done() {
+	q.pending.Done()
+}
+
+// retry puts the range back in the queue once |delay| has passed, or
+// straight away once |ctx| is done, so that it is given up on promptly.
+func (q *fetchQueue) retry(ctx context.Context, r fetchRange, delay time.Duration) {
+	go func() {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+		}
+		q.ranges <- r
+	}()
+}
+
+// fail records that the range has been given up on.
+func (q *fetchQueue) fail(r fetchRange, err error) {
+	q.mu.Lock()
+	q.failed = append(q.failed, FailedRange{Start: r.start, End: r.end, Err: err})
+	q.mu.Unlock()
+	q.pending.Done()
+}
+
+// Returns how long to wait before retrying a range which has failed
+// |failures| times.
+func (s *Scanner) retryDelay(failures int) time.Duration {
+	delay := s.opts.FetchRetryDelay
+	if delay <= 0 {
+		delay = DefaultFetchRetryDelay
+	}
+	for i := 1; i < failures && delay < maxFetchRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxFetchRetryDelay {
+		delay = maxFetchRetryDelay
+	}
+	return delay
+}
+
+// Worker function for fetcher jobs.
+// Takes cert ranges to fetch from |q|, and if the fetch is successful
+// sends the individual LeafInputs out (as MatcherJobs) into the |entries|
+// channel for the matchers to chew on.
+// Failed ranges are put back in |q| to be retried, until they have failed
+// MaxFetchAttempts times, or |ctx| is done.
+// Returns once |q| is empty and every range has been fetched or given up on.
+func (s *Scanner) fetcherJob(ctx context.Context, id int, q *fetchQueue, sth *ct.SignedTreeHead, entries chan<- matcherJob, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for r := range q.ranges {
+		err := s.fetchRange(ctx, &r, sth, entries)
+		if err == nil {
+			q.done()
+			continue
+		}
+		r.failures++
+		atomic.AddInt64(&s.stats.fetchErrors, 1)
+		s.Log(fmt.Sprintf("Problem fetching entries [%d, %d] from log (attempt %d): %s", r.start, r.end, r.failures, err.Error()))
+		if ctx.Err() != nil || (s.opts.MaxFetchAttempts > 0 && r.failures >= s.opts.MaxFetchAttempts) {
+			atomic.AddInt64(&s.stats.failedBatches, 1)
+			q.fail(r, err)
+			continue
+		}
+		q.retry(ctx, r, s.retryDelay(r.failures))
+	}
+	s.Log(fmt.Sprintf("Fetcher %d finished", id))
+}
+
+// Fetches the entries in |r|, verifies them, and sends them out into the
+// |entries| channel, advancing the start of |r| past each one sent.  Logs may
+// return fewer entries than requested, so this keeps asking for the rest until
+// all are fetched or an attempt fails.
+func (s *Scanner) fetchRange(ctx context.Context, r *fetchRange, sth *ct.SignedTreeHead, entries chan<- matcherJob) error {
+	for r.start <= r.end {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.opts.Budget.wait(ctx, r.end-r.start+1); err != nil {
+			return err
+		}
+		start := time.Now()
+		logEntries, err := s.logClient.GetEntries(r.start, r.end)
+		if err != nil {
+			return err
+		}
+		if len(logEntries) == 0 {
+			return fmt.Errorf("log returned no entries")
+		}
+		if int64(len(logEntries)) > r.end-r.start+1 {
+			return fmt.Errorf("log returned %d entries, more than the %d requested", len(logEntries), r.end-r.start+1)
+		}
+		for i := range logEntries {
+			logEntries[i].Index = r.start + int64(i)
+		}
+		if err := s.verifyEntries(ctx, logEntries, sth); err != nil {
+			return err
+		}
+		atomic.AddInt64(&s.stats.batchesFetched, 1)
+		atomic.AddInt64(&s.stats.entriesFetched, int64(len(logEntries)))
+		atomic.AddInt64(&s.stats.batchLatency, int64(time.Since(start)))
+		for _, logEntry := range logEntries {
+			entries <- matcherJob{logEntry, r.start, r.id}
+			r.start++
+		}
+	}
+	return nil
+}
+
+// Proves the inclusion of ProofsPerBatch entries of |logEntries|, chosen at
+// random, in the tree of |sth|, and of all of them if VerifyBatches is set, to
+// check that the log returned the entries in its tree, at the right indices.
+func (s *Scanner) verifyEntries(ctx context.Context, logEntries []ct.LogEntry, sth *ct.SignedTreeHead) error {
+	if s.opts.VerifyBatches {
+		if err := s.verifyBatch(ctx, logEntries, sth); err != nil {
+			return err
+		}
+	}
+	n := s.opts.ProofsPerBatch
+	if n > len(logEntries) {
+		n = len(logEntries)
+	}
+	for _, i := range rand.Perm(len(logEntries))[:n] {
+		e := &logEntries[i]
+		proof, err := s.logClient.ProveInclusion(ctx, e, *sth)
+		if err != nil {
+			return fmt.Errorf("failed to prove inclusion of entry %d: %v", e.Index, err)
+		}
+		if proof.LeafIndex != e.Index {
+			return fmt.Errorf("entry returned at index %d is at index %d of the tree", e.Index, proof.LeafIndex)
+		}
+	}
+	return nil
+}
+
+// Checks that |logEntries|, which are consecutive, are the entries at their
+// indices in the tree of |sth|, using the inclusion proofs of the first and
+// last of them.
+func (s *Scanner) verifyBatch(ctx context.Context, logEntries []ct.LogEntry, sth *ct.SignedTreeHead) error {
+	hasher := merkle.NewSHA256TreeHasher()
+	hashes := make([][]byte, len(logEntries))
+	for i := range logEntries {
+		leaf, err := ct.SerializeMerkleTreeLeaf(logEntries[i].Leaf)
+		if err != nil {
+			return fmt.Errorf("failed to serialize entry %d: %v", logEntries[i].Index, err)
+		}
+		hashes[i] = hasher.HashLeaf(leaf)
+	}
+	// proof returns the inclusion proof of the entry with hash |hash|,
+	// which was returned at index |index|.
+	proof := func(index int64, hash []byte) ([][]byte, error) {
+		p, err := s.logClient.GetProofByHash(ctx, hash, sth.TreeSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get inclusion proof of entry %d: %v", index, err)
+		}
+		if p.LeafIndex != index {
+			return nil, fmt.Errorf("entry returned at index %d is at index %d of the tree", index, p.LeafIndex)
+		}
+		return p.AuditPath, nil
+	}
+
+	first, last := logEntries[0].Index, logEntries[len(logEntries)-1].Index
+	var startProof, endProof [][]byte
+	var err error
+	if first > 0 {
+		if startProof, err = proof(first, hashes[0]); err != nil {
+			return err
+		}
+	}
+	if uint64(last) < sth.TreeSize-1 {
+		if endProof, err = proof(last, hashes[len(hashes)-1]); err != nil {
+			return err
+		}
+	}
+	v, err := merkle.NewVerifier(hasher).NewRangeVerifier(uint64(first), sth.TreeSize, sth.SHA256RootHash[:], startProof)
+	if err != nil {
+		return fmt.Errorf("failed to verify entries [%d, %d]: %v", first, last, err)
+	}
+	for _, h := range hashes {
+		if err := v.AddLeafHash(h); err != nil {
+			return fmt.Errorf("failed to verify entries [%d, %d]: %v", first, last, err)
+		}
+	}
+	if err := v.Finish(endProof); err != nil {
+		return fmt.Errorf("entries [%d, %d] are not those in the tree: %v", first, last, err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package scanner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/merkle"
+)
+
+// faultyLog is a four entry log whose get-entries requests for particular
+// start indices fail, and which can serve proofs of its entries' inclusion.
+type faultyLog struct {
+	*growingLog
+	hashes [][]byte // Leaf hashes
+
+	mu sync.Mutex
+	// Number of requests for entries from each start index which fail, or
+	// -1 if they all do.
+	failures map[int]int
+	// If set, the entry after each one requested is returned in its place.
+	shift bool
+	// If set, entry 1 is returned in place of entry 2.
+	tamper bool
+}
+
+func newFaultyLog(t *testing.T) *faultyLog {
+	l := &faultyLog{growingLog: newGrowingLog(t, 4), failures: make(map[int]int)}
+	hasher := merkle.NewSHA256TreeHasher()
+	for _, raw := range l.entries {
+		var e struct {
+			LeafInput string `json:"leaf_input"`
+		}
+		if err := json.Unmarshal(raw, &e); err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := base64.StdEncoding.DecodeString(e.LeafInput)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.hashes = append(l.hashes, hasher.HashLeaf(leaf))
+	}
+	root := hasher.HashChildren(l.node(0), l.node(1))
+	l.root = base64.StdEncoding.EncodeToString(root)
+	return l
+}
+
+// node returns the hash of the pair of leaves |i|*2 and |i|*2+1.
+func (l *faultyLog) node(i int) []byte {
+	return merkle.NewSHA256TreeHasher().HashChildren(l.hashes[i*2], l.hashes[i*2+1])
+}
+
+func (l *faultyLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/ct/v1/get-entries":
+		start, _ := strconv.Atoi(r.FormValue("start"))
+		l.mu.Lock()
+		n := l.failures[start]
+		if n > 0 {
+			l.failures[start]--
+		}
+		shift, tamper := l.shift, l.tamper
+		l.mu.Unlock()
+		if n != 0 {
+			http.Error(w, "injected failure", http.StatusInternalServerError)
+			return
+		}
+		if tamper {
+			end, _ := strconv.Atoi(r.FormValue("end"))
+			entries := append([]json.RawMessage(nil), l.entries[start:end+1]...)
+			if start <= 2 && 2 <= end {
+				entries[2-start] = l.entries[1]
+			}
+			json.NewEncoder(w).Encode(struct {
+				Entries []json.RawMessage `json:"entries"`
+			}{entries})
+			return
+		}
+		if shift {
+			r.Form.Set("start", strconv.Itoa((start+1)%4))
+			r.Form.Set("end", strconv.Itoa((start+1)%4))
+		}
+	case "/ct/v1/get-proof-by-hash":
+		hash, _ := base64.StdEncoding.DecodeString(r.FormValue("hash"))
+		for i, h := range l.hashes {
+			if reflect.DeepEqual(h, hash) {
+				path := []string{
+					base64.StdEncoding.EncodeToString(l.hashes[i^1]),
+					base64.StdEncoding.EncodeToString(l.node(1 - i/2)),
+				}
+				fmt.Fprintf(w, `{"leaf_index":%d,"audit_path":["%s","%s"]}`, i, path[0], path[1])
+				return
+			}
+		}
+		http.Error(w, "unknown hash", http.StatusBadRequest)
+		return
+	}
+	l.growingLog.ServeHTTP(w, r)
+}
+
+func scanFaultyLog(t *testing.T, l *faultyLog, opts ScannerOptions) ([]int64, error) {
+	ts := httptest.NewServer(l)
+	defer ts.Close()
+	opts.Matcher = &MatchAll{}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = 1
+	}
+	opts.NumWorkers = 1
+	opts.ParallelFetch = 2
+	opts.FetchRetryDelay = time.Millisecond
+	opts.Quiet = true
+	// Make the client's own retries fail fast, so the scanner's are tested.
+	lc := client.NewWithOptions(ts.URL, client.Options{Backoff: &client.BackoffPolicy{Initial: time.Millisecond, MaxRetries: 1}})
+
+	var mu sync.Mutex
+	var found []int64
+	f := func(e *ct.LogEntry) {
+		mu.Lock()
+		defer mu.Unlock()
+		found = append(found, e.Index)
+	}
+	err := NewScanner(lc, opts).Scan(f, f)
+	sort.Sort(int64Slice(found))
+	return found, err
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+
+func TestScanRetriesFailedRanges(t *testing.T) {
+	l := newFaultyLog(t)
+	l.failures[1] = 3
+	l.failures[3] = 1
+	found, err := scanFaultyLog(t, l, ScannerOptions{MaxFetchAttempts: 5})
+	if err != nil {
+		t.Fatalf("Scan()=%v", err)
+	}
+	if want := []int64{0, 1, 2, 3}; !reflect.DeepEqual(found, want) {
+		t.Errorf("Scan() found entries %v, want %v", found, want)
+	}
+}
+
+func TestScanGivesUpOnFailingRanges(t *testing.T) {
+	l := newFaultyLog(t)
+	l.failures[2] = -1
+	found, err := scanFaultyLog(t, l, ScannerOptions{MaxFetchAttempts: 3})
+	if want := []int64{0, 1, 3}; !reflect.DeepEqual(found, want) {
+		t.Errorf("Scan() found entries %v, want %v", found, want)
+	}
+	fe, ok := err.(FetchError)
+	if !ok {
+		t.Fatalf("Scan()=%v, want FetchError", err)
+	}
+	if len(fe.Ranges) != 1 || fe.Ranges[0].Start != 2 || fe.Ranges[0].End != 2 {
+		t.Errorf("Scan() failed ranges %+v, want [2, 2]", fe.Ranges)
+	}
+}
+
+func TestScanVerifiesInclusion(t *testing.T) {
+	l := newFaultyLog(t)
+	found, err := scanFaultyLog(t, l, ScannerOptions{MaxFetchAttempts: 2, ProofsPerBatch: 1})
+	if err != nil {
+		t.Fatalf("Scan()=%v", err)
+	}
+	if want := []int64{0, 1, 2, 3}; !reflect.DeepEqual(found, want) {
+		t.Errorf("Scan() found entries %v, want %v", found, want)
+	}
+
+	// Entries which are in the tree, but not at the indices they were
+	// returned for, fail verification.
+	l.shift = true
+	found, err = scanFaultyLog(t, l, ScannerOptions{MaxFetchAttempts: 2, ProofsPerBatch: 1})
+	if len(found) != 0 {
+		t.Errorf("Scan() of misordered log found entries %v", found)
+	}
+	if fe, ok := err.(FetchError); !ok || len(fe.Ranges) != 4 {
+		t.Errorf("Scan() of misordered log=%v, want FetchError of 4 ranges", err)
+	}
+}
+
+func TestScanVerifiesBatches(t *testing.T) {
+	for _, batchSize := range []int{1, 2, 3, 4} {
+		l := newFaultyLog(t)
+		found, err := scanFaultyLog(t, l, ScannerOptions{MaxFetchAttempts: 2, BatchSize: batchSize, VerifyBatches: true})
+		if err != nil {
+			t.Errorf("BatchSize %d: Scan()=%v", batchSize, err)
+		} else if want := []int64{0, 1, 2, 3}; !reflect.DeepEqual(found, want) {
+			t.Errorf("BatchSize %d: Scan() found entries %v, want %v", batchSize, found, want)
+		}
+	}
+
+	// A batch of the whole tree is checked against its root hash without
+	// any proofs, so an entry replaced within it is caught.
+	l := newFaultyLog(t)
+	l.tamper = true
+	found, err := scanFaultyLog(t, l, ScannerOptions{MaxFetchAttempts: 2, BatchSize: 4, VerifyBatches: true})
+	if len(found) != 0 {
+		t.Errorf("Scan() of tampered log found entries %v", found)
+	}
+	if fe, ok := err.(FetchError); !ok || len(fe.Ranges) != 1 {
+		t.Errorf("Scan() of tampered log=%v, want FetchError of 1 range", err)
+	}
+
+	// With smaller batches, only that containing the replaced entry fails.
+	found, err = scanFaultyLog(t, l, ScannerOptions{MaxFetchAttempts: 2, BatchSize: 2, VerifyBatches: true})
+	if want := []int64{0, 1}; !reflect.DeepEqual(found, want) {
+		t.Errorf("Scan() of tampered log found entries %v, want %v", found, want)
+	}
+	if fe, ok := err.(FetchError); !ok || len(fe.Ranges) != 1 || fe.Ranges[0].Start != 2 {
+		t.Errorf("Scan() of tampered log=%v, want FetchError of range [2, 3]", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	s := NewScanner(nil, ScannerOptions{FetchRetryDelay: 10 * time.Second})
+	for _, test := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{40, time.Minute},
+	} {
+		if got := s.retryDelay(test.failures); got != test.want {
+			t.Errorf("retryDelay(%d)=%s, want %s", test.failures, got, test.want)
+		}
+	}
+}
@@ -3,13 +3,22 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/big"
+	"net/http"
+	"os"
 	"regexp"
+	"time"
 
 	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/analytics"
 	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/lint"
+	"github.com/google/certificate-transparency/go/loglist"
+	"github.com/google/certificate-transparency/go/revocation"
 	"github.com/google/certificate-transparency/go/scanner"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -26,6 +35,28 @@ var numWorkers = flag.Int("num_workers", 2, "Number of concurrent matchers")
 var parallelFetch = flag.Int("parallel_fetch", 2, "Number of concurrent GetEntries fetches")
 var startIndex = flag.Int64("start_index", 0, "Log index to start scanning at")
 var quiet = flag.Bool("quiet", false, "Don't print out extra logging messages, only matches.")
+var checkpointFile = flag.String("checkpoint_file", "", "JSON file to save the scan's progress in and resume it from")
+var follow = flag.Bool("follow", false, "Keep scanning new entries as they are added to the log")
+var pollInterval = flag.Duration("poll_interval", scanner.DefaultPollInterval, "How often to poll the log's STH when following it")
+var mmd = flag.Duration("mmd", 24*time.Hour, "The log's Maximum Merge Delay, for warning when its STH is stale when following it")
+var watchlistFile = flag.String("watchlist", "", "File listing domains to alert on certificates for, one per line; overrides the other matching flags")
+var dedup = flag.String("dedup", "", "Report each certificate and its precertificate once: \"first\" reports whichever is found first, \"merge\" reports the certificate if it is found")
+var outputJSONL = flag.String("output_jsonl", "", "File to write matches to as JSON lines")
+var outputCSV = flag.String("output_csv", "", "File to write matches to as CSV")
+var outputDB = flag.String("output_db", "", "SQLite database to write matches to")
+var webhookURL = flag.String("webhook_url", "", "URL to POST batches of matches to")
+var checkpointDB = flag.String("checkpoint_db", "", "SQLite database to save the scan's progress in and resume it from")
+var logListFile = flag.String("log_list", "", "JSON log list; if set, every qualified, usable or read-only log in it is scanned instead of -log_uri")
+var entriesPerSecond = flag.Float64("entries_per_second", 0, "Maximum rate at which to fetch entries from all the logs together, if -log_list is set")
+var parseErrorsFile = flag.String("parse_errors", "", "File to write entries which fail to parse to as JSON lines, with their raw bytes")
+var lintFlag = flag.Bool("lint", false, "Match certificates which break any of the lint package's rules, logging what is wrong with them; overrides the other matching flags")
+var lintSeverity = flag.String("lint_min_severity", "notice", "The least severe lint findings to match: \"notice\", \"warning\" or \"error\"")
+var lintOutput = flag.String("lint_output", "", "File to write lint findings to as JSON lines")
+var statsJSON = flag.String("stats_json", "", "File to export issuance statistics of the matches to as JSON")
+var statsCSV = flag.String("stats_csv", "", "File to export issuance statistics of the matches to as CSV")
+var statsInterval = flag.Duration("stats_interval", time.Minute, "How often to export issuance statistics, if -stats_json or -stats_csv is set")
+var checkRevocation = flag.Bool("check_revocation", false, "Check the revocation status of matched certificates with OCSP and CRLs, and add it to their output")
+var metricsAddr = flag.String("metrics_addr", "", "Address to serve Prometheus metrics on at /metrics, e.g. :8080")
 
 // Prints out a short bit of info about |cert|, found at |index| in the
 // specified log
@@ -40,6 +71,49 @@ func logPrecertInfo(entry *ct.LogEntry) {
 		entry.Precert.TBSCertificate.Subject.CommonName, entry.Precert.TBSCertificate.Issuer.CommonName)
 }
 
+// Returns a function printing the alerts |watchlist| raises for an entry.
+func logAlerts(watchlist *scanner.Watchlist) func(*ct.LogEntry) {
+	return func(entry *ct.LogEntry) {
+		for _, a := range watchlist.Alerts(entry) {
+			log.Printf("Alert: %s", a)
+		}
+	}
+}
+
+// Returns a function printing the findings |linter| has for an entry, and
+// writing them to |w| if it is non-nil.
+func logFindings(linter *lint.Linter, w *lint.FindingWriter) func(*ct.LogEntry) {
+	return func(entry *ct.LogEntry) {
+		findings := linter.Findings(entry)
+		for _, f := range findings {
+			log.Printf("Finding: %s", f)
+		}
+		if w != nil {
+			if err := w.Write(findings); err != nil {
+				log.Printf("Failed to write findings of entry %d: %s", entry.Index, err)
+			}
+		}
+	}
+}
+
+// Returns a Linter configured by flags, and a FindingWriter for its findings
+// if -lint_output is set.
+func createLinterFromFlags() (*lint.Linter, *lint.FindingWriter, error) {
+	var opts lint.LinterOptions
+	if err := opts.MinSeverity.UnmarshalText([]byte(*lintSeverity)); err != nil {
+		return nil, nil, err
+	}
+	var w *lint.FindingWriter
+	if *lintOutput != "" {
+		f, err := os.Create(*lintOutput)
+		if err != nil {
+			return nil, nil, err
+		}
+		w = lint.NewFindingWriter(f)
+	}
+	return lint.NewLinter(opts), w, nil
+}
+
 func createMatcherFromFlags() (scanner.Matcher, error) {
 	if *serialNumber != "" {
 		log.Printf("Using SerialNumber matcher on %s", *serialNumber)
@@ -65,6 +139,89 @@ func createMatcherFromFlags() (scanner.Matcher, error) {
 	}
 }
 
+// Returns a Sink writing to each of the outputs given by flags, or nil if
+// there are none.
+func createSinkFromFlags() (scanner.Sink, error) {
+	var sinks []scanner.Sink
+	if *outputJSONL != "" {
+		f, err := os.Create(*outputJSONL)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, scanner.NewJSONLinesSink(f))
+	}
+	if *outputCSV != "" {
+		f, err := os.Create(*outputCSV)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, scanner.NewCSVSink(f))
+	}
+	if *outputDB != "" {
+		s, err := scanner.NewSQLiteSink(*outputDB, *logUri)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if *webhookURL != "" {
+		sinks = append(sinks, scanner.NewWebhookSink(*webhookURL, scanner.WebhookOptions{}))
+	}
+	if *statsJSON != "" || *statsCSV != "" {
+		sinks = append(sinks, analytics.NewAggregator(analytics.Options{
+			JSONFile:       *statsJSON,
+			CSVFile:        *statsCSV,
+			ExportInterval: *statsInterval,
+		}))
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	sink := scanner.MultiSink(sinks...)
+	if *checkRevocation {
+		checker := revocation.NewHTTPChecker(revocation.HTTPCheckerOptions{})
+		sink = scanner.AnnotatingSink(sink.(scanner.RecordSink), scanner.RevocationAnnotator(context.Background(), checker))
+	}
+	return sink, nil
+}
+
+// Scans every scannable log in the log list in |path|, writing matches to
+// |sink| if it is non-nil, and logging them otherwise.
+func scanLogList(path string, opts scanner.ScannerOptions, sink scanner.Sink) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	ll, err := loglist.NewFromJSON(data)
+	if err != nil {
+		return err
+	}
+	logs := scanner.ScannableLogs(ll)
+	log.Printf("Scanning %d logs", len(logs))
+	m := scanner.NewMultiScanner(logs, scanner.MultiScannerOptions{
+		ScannerOptions:   opts,
+		EntriesPerSecond: *entriesPerSecond,
+		Follow:           *follow,
+	})
+	found := func(l *loglist.Log, e *ct.LogEntry) {
+		log.Printf("Interesting entry at index %d of %s", e.Index, scanner.LogURL(l))
+	}
+	if sink != nil {
+		rs, ok := sink.(scanner.RecordSink)
+		if !ok {
+			return fmt.Errorf("%T can't record which log entries are from", sink)
+		}
+		found = scanner.LogFoundFunc(rs)
+	}
+	err = m.Run(context.Background(), found)
+	for url, summary := range m.ParseErrorSummaries() {
+		if summary.Unparsable > 0 || summary.NonFatal > 0 {
+			log.Printf("Parse errors in %s: %s", url, summary)
+		}
+	}
+	return err
+}
+
 func main() {
 	flag.Parse()
 	logClient := client.New(*logUri)
@@ -80,7 +237,131 @@ func main() {
 		ParallelFetch: *parallelFetch,
 		StartIndex:    *startIndex,
 		Quiet:         *quiet,
+		PollInterval:  *pollInterval,
+		MMD:           *mmd,
+	}
+	if *parseErrorsFile != "" {
+		f, err := os.Create(*parseErrorsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pw := scanner.NewParseErrorWriter(f)
+		defer pw.Close()
+		opts.ParseErrors = func(pe *scanner.ParseError) {
+			if err := pw.Write(pe); err != nil {
+				log.Printf("Failed to write parse error of entry %d: %s", pe.Index, err)
+			}
+		}
+	}
+	switch {
+	case *checkpointFile != "":
+		opts.Checkpoints, err = scanner.NewFileCheckpointStore(*checkpointFile)
+	case *checkpointDB != "":
+		opts.Checkpoints, err = scanner.NewSQLiteCheckpointStore(*checkpointDB)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	foundCert, foundPrecert := logCertInfo, logPrecertInfo
+	if *watchlistFile != "" {
+		f, err := os.Open(*watchlistFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		watchlist, err := scanner.LoadWatchlist(f, scanner.WatchlistOptions{})
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.EntryMatcher = watchlist
+		foundCert = logAlerts(watchlist)
+		foundPrecert = foundCert
+	}
+	if *lintFlag {
+		if *watchlistFile != "" {
+			log.Fatal("-lint and -watchlist can't both be set")
+		}
+		linter, w, err := createLinterFromFlags()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if w != nil {
+			defer w.Close()
+		}
+		opts.EntryMatcher = linter
+		foundCert = logFindings(linter, w)
+		foundPrecert = foundCert
+	}
+	if *logListFile != "" {
+		sink, err := createSinkFromFlags()
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = scanLogList(*logListFile, opts, sink)
+		if sink != nil {
+			if closeErr := sink.Close(); closeErr != nil {
+				log.Printf("Failed to close output: %s", closeErr)
+			}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	sink, err := createSinkFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if sink != nil {
+		write := scanner.FoundFunc(sink)
+		logCert, logPrecert := foundCert, foundPrecert
+		foundCert = func(e *ct.LogEntry) {
+			logCert(e)
+			write(e)
+		}
+		foundPrecert = func(e *ct.LogEntry) {
+			logPrecert(e)
+			write(e)
+		}
+	}
+	var deduper *scanner.Deduper
+	if *dedup != "" {
+		modes := map[string]scanner.DedupMode{"first": scanner.DedupFirstWins, "merge": scanner.DedupMerge}
+		mode, ok := modes[*dedup]
+		if !ok {
+			log.Fatalf("Invalid dedup mode %q", *dedup)
+		}
+		report, reportPrecert := foundCert, foundPrecert
+		deduper = scanner.NewDeduper(mode, 0, func(iss *scanner.Issuance) {
+			if iss.Cert != nil {
+				report(iss.Cert)
+			} else {
+				reportPrecert(iss.Precert)
+			}
+		})
+		foundCert, foundPrecert = deduper.Add, deduper.Add
+	}
+	s := scanner.NewScanner(logClient, opts)
+	if *metricsAddr != "" {
+		http.Handle("/metrics", scanner.NewPrometheusHandler(s, "scanner"))
+		go func() {
+			log.Fatal(http.ListenAndServe(*metricsAddr, nil))
+		}()
+	}
+	if *follow {
+		err = s.Follow(context.Background(), foundCert, foundPrecert)
+	} else {
+		err = s.Scan(foundCert, foundPrecert)
+	}
+	if deduper != nil {
+		deduper.Flush()
+	}
+	if sink != nil {
+		if closeErr := sink.Close(); closeErr != nil {
+			log.Printf("Failed to close output: %s", closeErr)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
 	}
-	scanner := scanner.NewScanner(logClient, opts)
-	scanner.Scan(logCertInfo, logPrecertInfo)
 }
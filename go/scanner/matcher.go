@@ -0,0 +1,212 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/google/certificate-transparency/go"
+)
+
+// EntryMatcher is a more general alternative to Matcher, which sees the whole
+// of each entry, including its index, timestamp and chain, so that rules can
+// depend on more than the certificate.  EntryMatchers can be combined with
+// And, Or and Not.
+type EntryMatcher interface {
+	// EntryMatches is called by the scanner for each entry found in the
+	// log, with the entry's X509Cert set if it is a certificate, or its
+	// Precert set if it is a precertificate.  The implementation should
+	// return |true| if the entry is interesting, and |false| otherwise.
+	EntryMatches(*ct.LogEntry) bool
+}
+
+// FromMatcher returns an EntryMatcher which matches the entries whose
+// certificates or precertificates |m| matches.
+func FromMatcher(m Matcher) EntryMatcher {
+	return matcherAdapter{m}
+}
+
+type matcherAdapter struct {
+	Matcher Matcher
+}
+
+func (m matcherAdapter) EntryMatches(e *ct.LogEntry) bool {
+	if e.Precert != nil {
+		return m.Matcher.PrecertificateMatches(e.Precert)
+	}
+	return e.X509Cert != nil && m.Matcher.CertificateMatches(e.X509Cert)
+}
+
+func (m matcherAdapter) String() string {
+	return fmt.Sprintf("FromMatcher(%s)", describeMatcher(m.Matcher))
+}
+
+type andMatcher []EntryMatcher
+
+// And returns an EntryMatcher which matches the entries which all of |ms|
+// match.  With no arguments it matches every entry.
+func And(ms ...EntryMatcher) EntryMatcher {
+	return andMatcher(ms)
+}
+
+func (ms andMatcher) EntryMatches(e *ct.LogEntry) bool {
+	for _, m := range ms {
+		if !m.EntryMatches(e) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ms andMatcher) String() string {
+	return describeMatchers("And", ms)
+}
+
+type orMatcher []EntryMatcher
+
+// Or returns an EntryMatcher which matches the entries which any of |ms|
+// match.  With no arguments it matches no entries.
+func Or(ms ...EntryMatcher) EntryMatcher {
+	return orMatcher(ms)
+}
+
+func (ms orMatcher) EntryMatches(e *ct.LogEntry) bool {
+	for _, m := range ms {
+		if m.EntryMatches(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ms orMatcher) String() string {
+	return describeMatchers("Or", ms)
+}
+
+type notMatcher struct {
+	m EntryMatcher
+}
+
+// Not returns an EntryMatcher which matches the entries which |m| doesn't.
+func Not(m EntryMatcher) EntryMatcher {
+	return notMatcher{m}
+}
+
+func (m notMatcher) EntryMatches(e *ct.LogEntry) bool {
+	return !m.m.EntryMatches(e)
+}
+
+func (m notMatcher) String() string {
+	return describeMatchers("Not", []EntryMatcher{m.m})
+}
+
+// describeMatcher returns a description of the type and configuration of a
+// matcher, from which the hash of the configuration for checkpoints is made.
+func describeMatcher(m interface{}) string {
+	return fmt.Sprintf("%T %+v", m, m)
+}
+
+func describeMatchers(op string, ms []EntryMatcher) string {
+	var descs []string
+	for _, m := range ms {
+		descs = append(descs, describeMatcher(m))
+	}
+	return fmt.Sprintf("%s(%s)", op, strings.Join(descs, ", "))
+}
+
+// MatchSANRegex is an EntryMatcher which matches the certificates and
+// precertificates with a Subject Alternative Name matching |Regex|.  DNS
+// names, email addresses, IP addresses, URIs and the values of otherNames
+// which are strings, e.g. SRVNames and UPNs, are all tested, but the Subject
+// Common Name isn't.
+type MatchSANRegex struct {
+	Regex *regexp.Regexp
+}
+
+func (m MatchSANRegex) EntryMatches(e *ct.LogEntry) bool {
+	c := e.Certificate()
+	if c == nil {
+		return false
+	}
+	for _, name := range c.DNSNames {
+		if m.Regex.MatchString(name) {
+			return true
+		}
+	}
+	for _, email := range c.EmailAddresses {
+		if m.Regex.MatchString(email) {
+			return true
+		}
+	}
+	for _, ip := range c.IPAddresses {
+		if m.Regex.MatchString(ip.String()) {
+			return true
+		}
+	}
+	for _, uri := range c.URIs {
+		if m.Regex.MatchString(uri) {
+			return true
+		}
+	}
+	for _, n := range c.OtherNames {
+		if s, ok := n.StringValue(); ok && m.Regex.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchIssuerKeyHash is an EntryMatcher which matches the certificates and
+// precertificates issued by any of the keys whose SHA-256 hashes (of the
+// DER SubjectPublicKeyInfo, as in a precertificate entry's issuer_key_hash)
+// are in |KeyHashes|.  The issuer of a certificate is taken from its entry's
+// chain, so certificates whose entries have no chain don't match.
+type MatchIssuerKeyHash struct {
+	KeyHashes [][sha256.Size]byte
+}
+
+func (m MatchIssuerKeyHash) EntryMatches(e *ct.LogEntry) bool {
+	hash, err := e.IssuerKeyHash()
+	if err != nil {
+		return false
+	}
+	for _, h := range m.KeyHashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchSerialNumbers is an EntryMatcher which matches the certificates and
+// precertificates with any of the serial numbers in |SerialNumbers|.
+type MatchSerialNumbers struct {
+	SerialNumbers []*big.Int
+}
+
+func (m MatchSerialNumbers) EntryMatches(e *ct.LogEntry) bool {
+	c := e.Certificate()
+	if c == nil || c.SerialNumber == nil {
+		return false
+	}
+	for _, sn := range m.SerialNumbers {
+		if c.SerialNumber.Cmp(sn) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchTimestamp is an EntryMatcher which matches the entries logged between
+// |After| and |Before|, in milliseconds since the epoch.  Zero means no bound.
+type MatchTimestamp struct {
+	After  uint64
+	Before uint64
+}
+
+func (m MatchTimestamp) EntryMatches(e *ct.LogEntry) bool {
+	ts := e.Leaf.TimestampedEntry.Timestamp
+	return (m.After == 0 || ts > m.After) && (m.Before == 0 || ts < m.Before)
+}
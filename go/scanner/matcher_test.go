@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"math/big"
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+func certEntry(sn int64, names ...string) *ct.LogEntry {
+	e := &ct.LogEntry{X509Cert: &x509.Certificate{SerialNumber: big.NewInt(sn), DNSNames: names}}
+	e.Leaf.TimestampedEntry.Timestamp = uint64(sn)
+	return e
+}
+
+func precertEntry(sn int64, keyHash byte, names ...string) *ct.LogEntry {
+	e := &ct.LogEntry{Precert: &ct.Precertificate{TBSCertificate: x509.Certificate{SerialNumber: big.NewInt(sn), DNSNames: names}}}
+	e.Precert.IssuerKeyHash[0] = keyHash
+	e.Leaf.TimestampedEntry.Timestamp = uint64(sn)
+	return e
+}
+
+func TestEntryMatchers(t *testing.T) {
+	example := MatchSANRegex{regexp.MustCompile(`\.example\.com$`)}
+	var keyHash [sha256.Size]byte
+	keyHash[0] = 7
+	ipCert := certEntry(5)
+	ipCert.X509Cert.IPAddresses = []net.IP{net.ParseIP("10.0.0.1")}
+	srvCert := certEntry(6)
+	srvCert.X509Cert.OtherNames = []x509.OtherName{{TypeID: x509.OIDOtherNameSRVName, Value: asn1.RawValue{Tag: 22, Bytes: []byte("_xmpp-server.example.com")}}}
+	uriCert := certEntry(7)
+	uriCert.X509Cert.URIs = []string{"https://www.example.com"}
+
+	for i, test := range []struct {
+		m     EntryMatcher
+		entry *ct.LogEntry
+		want  bool
+	}{
+		{example, certEntry(1, "www.example.com"), true},
+		{example, certEntry(1, "www.example.org", "mail.example.com"), true},
+		{example, certEntry(1, "www.example.org"), false},
+		{example, precertEntry(1, 0, "www.example.com"), true},
+		{example, &ct.LogEntry{}, false},
+		{MatchSANRegex{regexp.MustCompile(`^10\.`)}, ipCert, true},
+		{example, srvCert, true},
+		{example, uriCert, true},
+		{MatchSerialNumbers{[]*big.Int{big.NewInt(2), big.NewInt(3)}}, certEntry(3), true},
+		{MatchSerialNumbers{[]*big.Int{big.NewInt(2), big.NewInt(3)}}, precertEntry(2, 0), true},
+		{MatchSerialNumbers{[]*big.Int{big.NewInt(2), big.NewInt(3)}}, certEntry(4), false},
+		{MatchIssuerKeyHash{[][sha256.Size]byte{keyHash}}, precertEntry(1, 7), true},
+		{MatchIssuerKeyHash{[][sha256.Size]byte{keyHash}}, precertEntry(1, 8), false},
+		// Certificate entries without chains have no known issuer.
+		{MatchIssuerKeyHash{[][sha256.Size]byte{keyHash}}, certEntry(1), false},
+		{MatchTimestamp{After: 2, Before: 4}, certEntry(3), true},
+		{MatchTimestamp{After: 2, Before: 4}, certEntry(4), false},
+		{MatchTimestamp{After: 2}, certEntry(400), true},
+		{FromMatcher(MatchAll{}), certEntry(1), true},
+		{FromMatcher(MatchNone{}), precertEntry(1, 0), false},
+		{FromMatcher(MatchSerialNumber{*big.NewInt(1)}), precertEntry(1, 0), true},
+		{And(example, MatchTimestamp{Before: 2}), certEntry(1, "a.example.com"), true},
+		{And(example, MatchTimestamp{Before: 2}), certEntry(3, "a.example.com"), false},
+		{And(), certEntry(1), true},
+		{Or(example, MatchTimestamp{Before: 2}), certEntry(3, "a.example.com"), true},
+		{Or(example, MatchTimestamp{Before: 2}), certEntry(3, "a.example.org"), false},
+		{Or(), certEntry(1), false},
+		{Not(example), certEntry(1, "a.example.org"), true},
+		{And(example, Not(MatchSANRegex{regexp.MustCompile(`^www\.`)})), certEntry(1, "www.example.com"), false},
+	} {
+		if got := test.m.EntryMatches(test.entry); got != test.want {
+			t.Errorf("#%d: %s.EntryMatches()=%v, want %v", i, describeMatcher(test.m), got, test.want)
+		}
+	}
+}
+
+func TestMatchIssuerKeyHashCertificate(t *testing.T) {
+	issuer := testcert.NewCA(t, "Issuer", nil).Cert
+	e := certEntry(1)
+	e.Chain = []ct.ASN1Cert{issuer.Raw}
+	m := MatchIssuerKeyHash{[][sha256.Size]byte{sha256.Sum256(issuer.RawSubjectPublicKeyInfo)}}
+	if !m.EntryMatches(e) {
+		t.Error("MatchIssuerKeyHash didn't match certificate issued by key")
+	}
+	e.Chain = []ct.ASN1Cert{[]byte("not a certificate")}
+	if m.EntryMatches(e) {
+		t.Error("MatchIssuerKeyHash matched certificate with unparsable issuer")
+	}
+}
+
+func TestMatcherHashIsStable(t *testing.T) {
+	newOpts := func(re string) *ScannerOptions {
+		return &ScannerOptions{EntryMatcher: Or(
+			And(MatchSANRegex{regexp.MustCompile(re)}, Not(MatchTimestamp{Before: 5})),
+			&MatchSerialNumbers{[]*big.Int{big.NewInt(1)}})}
+	}
+	if a, b := matcherHash(newOpts("a")), matcherHash(newOpts("a")); a != b {
+		t.Errorf("matcherHash() of equal matchers differ: %s, %s", a, b)
+	}
+	if a, b := matcherHash(newOpts("a")), matcherHash(newOpts("b")); a == b {
+		t.Errorf("matcherHash() of different matchers are the same: %s", a)
+	}
+}
@@ -0,0 +1,179 @@
+package scanner
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/loglist"
+	"golang.org/x/net/context"
+)
+
+// MultiScannerOptions holds configuration for a MultiScanner.
+type MultiScannerOptions struct {
+	// Options for the Scanner of each log.  Checkpoints, if set, holds the
+	// checkpoints of all the logs, which are kept separately by log URL.
+	// MMD is overridden by the MMD of each log in the log list.  Budget is
+	// overridden by the options below.
+	ScannerOptions
+
+	// Maximum rate, in entries per second, at which entries are fetched
+	// from all the logs together.  Zero means no limit.
+	EntriesPerSecond float64
+	// Maximum number of entries fetched at once, above the rate.  Zero
+	// means BatchSize.
+	Burst int
+
+	// If set, the logs are followed as they grow, until the context is
+	// cancelled, rather than scanned once.
+	Follow bool
+
+	// Returns the client for the log at |url|.  If nil, client.New is used.
+	NewClient func(url string) *client.LogClient
+}
+
+// MultiScanner runs Scanners over a set of logs concurrently, merging the
+// entries they match into a single stream.
+type MultiScanner struct {
+	logs     []*loglist.Log
+	scanners []*Scanner
+	opts     MultiScannerOptions
+}
+
+// MultiScanError is the error returned by MultiScanner.Run when scanning some
+// of the logs failed.  The entries the scans of the other logs matched have
+// still been reported.
+type MultiScanError struct {
+	// The errors scanning each log which failed, by log URL.
+	Errors map[string]error
+}
+
+func (e MultiScanError) Error() string {
+	urls := make([]string, 0, len(e.Errors))
+	for u := range e.Errors {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	msgs := make([]string, len(urls))
+	for i, u := range urls {
+		msgs[i] = fmt.Sprintf("%s: %v", u, e.Errors[u])
+	}
+	return fmt.Sprintf("failed to scan %d logs: %s", len(urls), strings.Join(msgs, "; "))
+}
+
+// ScannableLogs returns the logs in |ll| which are worth scanning: those which
+// are qualified, usable or read-only.
+func ScannableLogs(ll *loglist.LogList) []*loglist.Log {
+	var logs []*loglist.Log
+	for _, l := range ll.Logs() {
+		switch status, _ := l.Status(); status {
+		case loglist.QualifiedStatus, loglist.UsableStatus, loglist.ReadOnlyStatus:
+			logs = append(logs, l)
+		}
+	}
+	return logs
+}
+
+// LogURL returns the base URL of the API of |l|, whose URL in the log list may
+// lack a scheme or have a trailing slash.
+func LogURL(l *loglist.Log) string {
+	u := strings.TrimSuffix(l.URL, "/")
+	if !strings.Contains(u, "://") {
+		u = "https://" + u
+	}
+	return u
+}
+
+// NewMultiScanner returns a MultiScanner which scans |logs|.
+func NewMultiScanner(logs []*loglist.Log, opts MultiScannerOptions) *MultiScanner {
+	if opts.NewClient == nil {
+		opts.NewClient = client.New
+	}
+	burst := opts.Burst
+	if burst <= 0 {
+		burst = opts.BatchSize
+	}
+	budget := NewBudget(opts.EntriesPerSecond, burst)
+	m := &MultiScanner{logs: logs, opts: opts}
+	for _, l := range logs {
+		so := opts.ScannerOptions
+		so.Budget = budget
+		if l.MMD > 0 {
+			so.MMD = l.MMDDuration()
+		}
+		m.scanners = append(m.scanners, NewScanner(opts.NewClient(LogURL(l)), so))
+	}
+	return m
+}
+
+// Run scans all the logs concurrently, calling |found| for each matching
+// entry with the log it is from.  |found| is called concurrently, so must be
+// safe for concurrent use.  If opts.Follow is set, Run returns once ctx is
+// cancelled; otherwise it returns once every log has been scanned to its
+// current size.  If any of the scans fail, a MultiScanError is returned.
+func (m *MultiScanner) Run(ctx context.Context, found func(*loglist.Log, *ct.LogEntry)) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(m.scanners))
+	for i, s := range m.scanners {
+		wg.Add(1)
+		go func(i int, l *loglist.Log, s *Scanner) {
+			defer wg.Done()
+			f := func(e *ct.LogEntry) { found(l, e) }
+			if m.opts.Follow {
+				errs[i] = s.Follow(ctx, f, f)
+			} else {
+				errs[i] = s.Scan(f, f)
+			}
+		}(i, m.logs[i], s)
+	}
+	wg.Wait()
+
+	e := MultiScanError{Errors: make(map[string]error)}
+	for i, err := range errs {
+		// Following is expected to be stopped by ctx.
+		if err != nil && !(m.opts.Follow && err == ctx.Err()) {
+			e.Errors[LogURL(m.logs[i])] = err
+		}
+	}
+	if len(e.Errors) > 0 {
+		return e
+	}
+	return nil
+}
+
+// Stats returns the Stats of the scan of each log, by log URL.
+func (m *MultiScanner) Stats() map[string]Stats {
+	stats := make(map[string]Stats, len(m.scanners))
+	for i, s := range m.scanners {
+		stats[LogURL(m.logs[i])] = s.Stats()
+	}
+	return stats
+}
+
+// ParseErrorSummaries returns the summary of the parse errors encountered
+// scanning each log, by log URL.
+func (m *MultiScanner) ParseErrorSummaries() map[string]ParseErrorSummary {
+	summaries := make(map[string]ParseErrorSummary, len(m.scanners))
+	for i, s := range m.scanners {
+		summaries[LogURL(m.logs[i])] = s.ParseErrorSummary()
+	}
+	return summaries
+}
+
+// LogFoundFunc returns a function which writes the entries it is called with
+// to |sink|, with the URL and ID of the log they are from, for passing to
+// MultiScanner.Run.  The Records are annotated if |sink| is an
+// AnnotatingSink.  Errors writing entries are logged.
+func LogFoundFunc(sink RecordSink) func(*loglist.Log, *ct.LogEntry) {
+	return func(l *loglist.Log, entry *ct.LogEntry) {
+		r := NewRecord(entry)
+		r.Log, r.LogID = LogURL(l), l.LogID
+		if err := writeEntryRecord(sink, entry, r); err != nil {
+			log.Printf("Failed to write entry %d of %s: %s", entry.Index, r.Log, err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package scanner
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/loglist"
+	"golang.org/x/net/context"
+)
+
+func TestScannableLogs(t *testing.T) {
+	ll := &loglist.LogList{Operators: []*loglist.Operator{{Logs: []*loglist.Log{
+		{URL: "qualified", State: &loglist.LogStates{Qualified: &loglist.LogState{}}},
+		{URL: "usable", State: &loglist.LogStates{Usable: &loglist.LogState{}}},
+		{URL: "pending", State: &loglist.LogStates{Pending: &loglist.LogState{}}},
+		{URL: "readonly", State: &loglist.LogStates{ReadOnly: &loglist.ReadOnlyLogState{}}},
+		{URL: "retired", State: &loglist.LogStates{Retired: &loglist.LogState{}}},
+		{URL: "unknown"},
+	}}}}
+	var got []string
+	for _, l := range ScannableLogs(ll) {
+		got = append(got, l.URL)
+	}
+	if want := []string{"qualified", "usable", "readonly"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ScannableLogs()=%v, want %v", got, want)
+	}
+}
+
+func TestLogURL(t *testing.T) {
+	for i, tc := range []struct{ url, want string }{
+		{"https://ct.example.com/logs/2020/", "https://ct.example.com/logs/2020"},
+		{"ct.example.com/pilot", "https://ct.example.com/pilot"},
+		{"http://localhost:1234", "http://localhost:1234"},
+	} {
+		if got := LogURL(&loglist.Log{URL: tc.url}); got != tc.want {
+			t.Errorf("#%d: LogURL(%q)=%q, want %q", i, tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	now := time.Now()
+	b := NewBudget(10, 5)
+	b.last = now
+	for i, tc := range []struct {
+		n     int64
+		after time.Duration
+		want  time.Duration
+	}{
+		{3, 0, 0},
+		{2, 0, 0},
+		// The bucket is empty, so these wait for it to refill.
+		{1, 0, 100 * time.Millisecond},
+		{10, 0, 1100 * time.Millisecond},
+		{1, 2 * time.Second, 0},
+	} {
+		now = now.Add(tc.after)
+		if got := b.reserve(tc.n, now); got != tc.want {
+			t.Errorf("#%d: reserve(%d)=%v, want %v", i, tc.n, got, tc.want)
+		}
+	}
+	if NewBudget(0, 5) != nil {
+		t.Errorf("NewBudget(0, 5) is a limit, want nil")
+	}
+	if err := (*Budget)(nil).wait(context.Background(), 1000); err != nil {
+		t.Errorf("nil Budget wait()=%v", err)
+	}
+}
+
+type multiScanResult struct {
+	log   string
+	index int64
+}
+
+func runMultiScanner(t *testing.T, logs []*loglist.Log, opts MultiScannerOptions) ([]multiScanResult, error) {
+	opts.Matcher = &MatchAll{}
+	opts.BatchSize = 1
+	opts.NumWorkers = 1
+	opts.ParallelFetch = 1
+	opts.Quiet = true
+	m := NewMultiScanner(logs, opts)
+	var mu sync.Mutex
+	var found []multiScanResult
+	err := m.Run(context.Background(), func(l *loglist.Log, e *ct.LogEntry) {
+		mu.Lock()
+		defer mu.Unlock()
+		found = append(found, multiScanResult{l.Description, e.Index})
+	})
+	sort.Sort(multiScanResults(found))
+	return found, err
+}
+
+type multiScanResults []multiScanResult
+
+func (s multiScanResults) Len() int      { return len(s) }
+func (s multiScanResults) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s multiScanResults) Less(i, j int) bool {
+	if s[i].log != s[j].log {
+		return s[i].log < s[j].log
+	}
+	return s[i].index < s[j].index
+}
+
+func TestMultiScanner(t *testing.T) {
+	a := httptest.NewServer(newGrowingLog(t, 3))
+	defer a.Close()
+	b := httptest.NewServer(newGrowingLog(t, 2))
+	defer b.Close()
+	logs := []*loglist.Log{
+		{Description: "a", URL: a.URL + "/", LogID: []byte{1}},
+		{Description: "b", URL: b.URL, LogID: []byte{2}},
+	}
+	cps := &memCheckpointStore{cps: make(map[string]Checkpoint)}
+	opts := MultiScannerOptions{EntriesPerSecond: 1000}
+	opts.Checkpoints = cps
+
+	found, err := runMultiScanner(t, logs, opts)
+	if err != nil {
+		t.Fatalf("Run()=%v", err)
+	}
+	want := []multiScanResult{{"a", 0}, {"a", 1}, {"a", 2}, {"b", 0}, {"b", 1}}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("Run() found %v, want %v", found, want)
+	}
+	for _, tc := range []struct {
+		url  string
+		want int64
+	}{{a.URL, 3}, {b.URL, 2}} {
+		if cp := cps.cps[tc.url]; cp.NextIndex != tc.want {
+			t.Errorf("checkpoint of %s=%+v, want NextIndex %d", tc.url, cp, tc.want)
+		}
+	}
+
+	// Rescanning resumes each log from its checkpoint.
+	found, err = runMultiScanner(t, logs, opts)
+	if err != nil || len(found) > 0 {
+		t.Errorf("Run() again found %v, %v, want nothing", found, err)
+	}
+}
+
+func TestMultiScannerReportsFailedLogs(t *testing.T) {
+	a := httptest.NewServer(newGrowingLog(t, 2))
+	defer a.Close()
+	b := httptest.NewServer(newGrowingLog(t, 2))
+	b.Close()
+	logs := []*loglist.Log{{Description: "a", URL: a.URL}, {Description: "b", URL: b.URL}}
+
+	found, err := runMultiScanner(t, logs, MultiScannerOptions{})
+	if want := []multiScanResult{{"a", 0}, {"a", 1}}; !reflect.DeepEqual(found, want) {
+		t.Errorf("Run() found %v, want %v", found, want)
+	}
+	me, ok := err.(MultiScanError)
+	if !ok {
+		t.Fatalf("Run()=%v, want MultiScanError", err)
+	}
+	if _, ok := me.Errors[b.URL]; !ok || len(me.Errors) != 1 {
+		t.Errorf("Run() errors %v, want one for %s", me.Errors, b.URL)
+	}
+}
+
+func TestLogFoundFunc(t *testing.T) {
+	var got []Record
+	sink := &recordingSink{records: &got}
+	LogFoundFunc(sink)(&loglist.Log{URL: "ct.example.com/", LogID: []byte{1, 2}}, sinkEntry(7))
+	if len(got) != 1 {
+		t.Fatalf("LogFoundFunc wrote %d records, want 1", len(got))
+	}
+	if r := got[0]; r.Index != 7 || r.Log != "https://ct.example.com" || !reflect.DeepEqual(r.LogID, []byte{1, 2}) {
+		t.Errorf("LogFoundFunc wrote %+v, want index 7 of https://ct.example.com", r)
+	}
+}
+
+type recordingSink struct {
+	records *[]Record
+}
+
+func (s *recordingSink) Write(entry *ct.LogEntry) error { return s.WriteRecord(NewRecord(entry)) }
+func (s *recordingSink) WriteRecord(r Record) error {
+	*s.records = append(*s.records, r)
+	return nil
+}
+func (s *recordingSink) Close() error { return nil }
@@ -0,0 +1,184 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// ParseError describes an entry whose certificate or precertificate couldn't
+// be parsed, or parsed with non-fatal errors.
+type ParseError struct {
+	Index     int64           `json:"index"`
+	EntryType ct.LogEntryType `json:"entry_type"`
+	// The bytes which were parsed: the certificate of an X.509 entry, or the
+	// TBSCertificate of a precertificate entry.
+	Raw []byte `json:"raw"`
+	// Whether the entry couldn't be parsed at all.  If not, the entry was
+	// still matched against.
+	Fatal bool `json:"fatal"`
+	// The errors, of which there may be several if they aren't fatal.
+	Errors []string `json:"errors"`
+}
+
+// newParseError returns the ParseError describing |err|, the error from
+// parsing |raw| in entry |index|.
+func newParseError(err error, entryType ct.LogEntryType, index int64, raw []byte) *ParseError {
+	pe := &ParseError{Index: index, EntryType: entryType, Raw: raw}
+	if nfe, ok := err.(x509.NonFatalErrors); ok {
+		for _, e := range nfe.Errors {
+			pe.Errors = append(pe.Errors, e.Error())
+		}
+	} else {
+		pe.Fatal = true
+		pe.Errors = []string{err.Error()}
+	}
+	return pe
+}
+
+// ParseErrorWriter writes ParseErrors to a writer as JSON, one per line.
+type ParseErrorWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewParseErrorWriter returns a ParseErrorWriter which writes to |w|.
+// Closing it closes |w| if it is an io.Closer.
+func NewParseErrorWriter(w io.Writer) *ParseErrorWriter {
+	return &ParseErrorWriter{w: w, enc: json.NewEncoder(w)}
+}
+
+// Write writes |pe|.  It is safe for concurrent use.
+func (p *ParseErrorWriter) Write(pe *ParseError) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.enc.Encode(pe)
+}
+
+// Close closes the underlying writer if it is an io.Closer.
+func (p *ParseErrorWriter) Close() error {
+	if c, ok := p.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// ParseErrorKind counts the occurrences of one kind of parse error.
+type ParseErrorKind struct {
+	// The error's message, without the details of the particular
+	// occurrence, e.g. "asn1: structure error: tags don't match".
+	Kind  string
+	Count int64
+	// The index of the first entry found with the error.
+	Example int64
+}
+
+// ParseErrorSummary summarises the parse errors a scan of a log encountered.
+type ParseErrorSummary struct {
+	// Number of entries which couldn't be parsed, and which parsed with
+	// non-fatal errors.
+	Unparsable int64
+	NonFatal   int64
+	// The kinds of error found, most frequent first.  An entry with several
+	// non-fatal errors counts towards the kind of each of them.
+	Kinds []ParseErrorKind
+}
+
+func (s ParseErrorSummary) String() string {
+	lines := []string{fmt.Sprintf("%d unparsable entries, %d with non-fatal errors", s.Unparsable, s.NonFatal)}
+	for _, k := range s.Kinds {
+		lines = append(lines, fmt.Sprintf("  %d x %s (e.g. index %d)", k.Count, k.Kind, k.Example))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseErrorCounts accumulates a ParseErrorSummary.
+type parseErrorCounts struct {
+	mu         sync.Mutex
+	unparsable int64
+	nonFatal   int64
+	kinds      map[string]*ParseErrorKind
+}
+
+func (c *parseErrorCounts) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unparsable, c.nonFatal, c.kinds = 0, 0, nil
+}
+
+func (c *parseErrorCounts) add(pe *ParseError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pe.Fatal {
+		c.unparsable++
+	} else {
+		c.nonFatal++
+	}
+	if c.kinds == nil {
+		c.kinds = make(map[string]*ParseErrorKind)
+	}
+	for _, e := range pe.Errors {
+		kind := parseErrorKind(e)
+		k, ok := c.kinds[kind]
+		if !ok {
+			k = &ParseErrorKind{Kind: kind, Example: pe.Index}
+			c.kinds[kind] = k
+		}
+		k.Count++
+		if pe.Index < k.Example {
+			k.Example = pe.Index
+		}
+	}
+}
+
+func (c *parseErrorCounts) summary() ParseErrorSummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := ParseErrorSummary{Unparsable: c.unparsable, NonFatal: c.nonFatal}
+	for _, k := range c.kinds {
+		s.Kinds = append(s.Kinds, *k)
+	}
+	sort.Sort(byCount(s.Kinds))
+	return s
+}
+
+type byCount []ParseErrorKind
+
+func (b byCount) Len() int      { return len(b) }
+func (b byCount) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byCount) Less(i, j int) bool {
+	if b[i].Count != b[j].Count {
+		return b[i].Count > b[j].Count
+	}
+	return b[i].Kind < b[j].Kind
+}
+
+var digitsRegex = regexp.MustCompile(`\b[0-9]+\b`)
+
+// parseErrorKind strips the details of a particular occurrence from an error
+// message, i.e. anything after a parenthesis, quote, brace or " : ", and any
+// numbers which aren't part of a word like "x509", so that occurrences of the
+// same error can be counted together.
+func parseErrorKind(msg string) string {
+	for _, sep := range []string{" (", " : ", "\"", "{"} {
+		if i := strings.Index(msg, sep); i >= 0 {
+			msg = msg[:i]
+		}
+	}
+	msg = strings.TrimRight(strings.TrimSpace(msg), ":")
+	return digitsRegex.ReplaceAllString(msg, "N")
+}
+
+// ParseErrorSummary returns a summary of the parse errors encountered by the
+// Scanner's current or last scan.
+func (s *Scanner) ParseErrorSummary() ParseErrorSummary {
+	return s.parseErrors.summary()
+}
@@ -0,0 +1,139 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+func TestParseErrorKind(t *testing.T) {
+	for i, tc := range []struct{ msg, want string }{
+		{"asn1: structure error: tags don't match (16 vs {class:0 tag:2}) {optional:false}", "asn1: structure error: tags don't match"},
+		{"x509: certificate contained IP address of length 5 : [1 2 3 4 5]", "x509: certificate contained IP address of length N"},
+		{`x509: cannot parse dnsName "a b"`, "x509: cannot parse dnsName"},
+		{"x509: negative serial number", "x509: negative serial number"},
+		{"asn1: syntax error: data truncated", "asn1: syntax error: data truncated"},
+	} {
+		if got := parseErrorKind(tc.msg); got != tc.want {
+			t.Errorf("#%d: parseErrorKind(%q)=%q, want %q", i, tc.msg, got, tc.want)
+		}
+	}
+}
+
+// negativeSerialCert returns a certificate which parses with a non-fatal error.
+func negativeSerialCert(t *testing.T) []byte {
+	template := testcert.Template("www.example.com", false)
+	template.SerialNumber = big.NewInt(-1)
+	der := testcert.Issue(t, template, testcert.NewKey(t), nil).Raw
+	if _, err := x509.ParseCertificate(der); err == nil {
+		t.Fatal("certificate with negative serial number parsed without errors")
+	}
+	return der
+}
+
+func TestScannerReportsParseErrors(t *testing.T) {
+	nonFatal := negativeSerialCert(t)
+	entry := func(index int64, entryType ct.LogEntryType, raw []byte) ct.LogEntry {
+		e := ct.LogEntry{Index: index}
+		e.Leaf.TimestampedEntry.EntryType = entryType
+		if entryType == ct.X509LogEntryType {
+			e.Leaf.TimestampedEntry.X509Entry = raw
+		} else {
+			e.Leaf.TimestampedEntry.PrecertEntry.TBSCertificate = raw
+		}
+		return e
+	}
+	cert, err := x509.ParseCertificate(nonFatal)
+	if _, ok := err.(x509.NonFatalErrors); !ok {
+		t.Fatalf("ParseCertificate()=%v, want NonFatalErrors", err)
+	}
+	entries := []ct.LogEntry{
+		entry(0, ct.X509LogEntryType, []byte("garbage")),
+		entry(1, ct.X509LogEntryType, nonFatal),
+		entry(2, ct.X509LogEntryType, []byte("more garbage")),
+		// A well-formed TBSCertificate, but no precertificate in the chain.
+		entry(3, ct.PrecertLogEntryType, cert.RawTBSCertificate),
+	}
+
+	var mu sync.Mutex
+	var got []*ParseError
+	s := NewScanner(nil, ScannerOptions{
+		Matcher: &MatchAll{},
+		Quiet:   true,
+		ParseErrors: func(pe *ParseError) {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, pe)
+		},
+	})
+	var found []int64
+	f := func(e *ct.LogEntry) { found = append(found, e.Index) }
+	for _, e := range entries {
+		s.processEntry(e, f, f)
+	}
+
+	if want := []int64{1}; !reflect.DeepEqual(found, want) {
+		t.Errorf("found entries %v, want %v", found, want)
+	}
+	if len(got) != 4 {
+		t.Fatalf("got %d ParseErrors, want 4", len(got))
+	}
+	for i, want := range []struct {
+		fatal bool
+		raw   []byte
+	}{
+		{true, []byte("garbage")},
+		{false, nonFatal},
+		{true, []byte("more garbage")},
+		{true, cert.RawTBSCertificate},
+	} {
+		if pe := got[i]; pe.Index != int64(i) || pe.Fatal != want.fatal || !bytes.Equal(pe.Raw, want.raw) || len(pe.Errors) == 0 {
+			t.Errorf("#%d: got ParseError %+v, want index %d, fatal=%t", i, pe, i, want.fatal)
+		}
+	}
+
+	summary := s.ParseErrorSummary()
+	if summary.Unparsable != 3 || summary.NonFatal != 1 {
+		t.Errorf("ParseErrorSummary()=%+v, want 3 unparsable and 1 with non-fatal errors", summary)
+	}
+	var kinds []string
+	for _, k := range summary.Kinds {
+		kinds = append(kinds, k.Kind)
+	}
+	// The two garbage entries fail the same way, so come first.
+	if len(summary.Kinds) != 3 || summary.Kinds[0].Count != 2 || summary.Kinds[0].Example != 0 {
+		t.Errorf("ParseErrorSummary() kinds=%+v, want 3 kinds, the first occurring twice from index 0", summary.Kinds)
+	}
+	for _, want := range []string{"x509: negative serial number", "precertificate entry has no chain"} {
+		ok := false
+		for _, k := range kinds {
+			ok = ok || k == want
+		}
+		if !ok {
+			t.Errorf("ParseErrorSummary() kinds=%v, want to include %q", kinds, want)
+		}
+	}
+}
+
+func TestParseErrorWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewParseErrorWriter(&buf)
+	want := &ParseError{Index: 5, EntryType: ct.PrecertLogEntryType, Raw: []byte{1, 2}, Fatal: true, Errors: []string{"bad"}}
+	if err := w.Write(want); err != nil {
+		t.Fatal(err)
+	}
+	var got ParseError
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("wrote %+v, want %+v", got, want)
+	}
+}
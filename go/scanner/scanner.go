@@ -1,7 +1,6 @@
 package scanner
 
 import (
-	"container/list"
 	"fmt"
 	"log"
 	"math/big"
@@ -13,6 +12,7 @@ import (
 	"github.com/google/certificate-transparency/go"
 	"github.com/google/certificate-transparency/go/client"
 	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
 )
 
 // Clients wishing to implement their own Matchers should implement this interface:
@@ -101,6 +101,9 @@ type ScannerOptions struct {
 	// Certificate found during scanning.
 	Matcher Matcher
 
+	// Matcher for whole entries, which is used instead of Matcher if set.
+	EntryMatcher EntryMatcher
+
 	// Match precerts only (Matcher still applies to precerts)
 	PrecertOnly bool
 
@@ -113,13 +116,62 @@ type ScannerOptions struct {
 	// Number of concurrent fethers to run
 	ParallelFetch int
 
+	// Number of times fetching a batch of entries may fail before the
+	// scanner gives up on it, and Scan returns a FetchError once the rest
+	// have been scanned.  Zero means batches are retried indefinitely.
+	MaxFetchAttempts int
+
+	// How long to wait before retrying a batch the first time fetching it
+	// fails.  Zero means DefaultFetchRetryDelay.
+	FetchRetryDelay time.Duration
+
+	// Number of entries of each batch fetched, chosen at random, whose
+	// inclusion in the tree is proved before the batch is matched.  A
+	// batch whose proofs fail is retried as if fetching it had failed.
+	ProofsPerBatch int
+
+	// If set, every entry of each batch fetched is checked to be in the
+	// tree, at its index, from the inclusion proofs of just the first and
+	// last entries, so that a log can't return entries which aren't in
+	// its tree.  A batch which fails is retried as if fetching it had
+	// failed.
+	VerifyBatches bool
+
+	// If set, entries are only fetched as fast as the Budget allows, which
+	// may be shared with other Scanners.
+	Budget *Budget
+
 	// Log entry index to start fetching & matching at
 	StartIndex int64
 
 	// Don't print any status messages to stdout
 	Quiet bool
+
+	// If set, the scan resumes from the checkpoint saved for the log, if
+	// there is one later than StartIndex which was saved by a scan with the
+	// same matcher configuration, and saves a checkpoint each time a batch
+	// of entries has been processed.
+	Checkpoints CheckpointStore
+
+	// If set, this is called with each entry whose certificate or
+	// precertificate couldn't be parsed, or parsed with non-fatal errors,
+	// rather than the entry just being counted and skipped.  It must be
+	// safe for concurrent use.
+	ParseErrors func(*ParseError)
+
+	// How often Follow polls the Log's STH once it has caught up.  Zero
+	// means DefaultPollInterval.
+	PollInterval time.Duration
+
+	// The Log's Maximum Merge Delay.  If set, Follow warns when the Log's
+	// latest STH is older than this.
+	MMD time.Duration
 }
 
+// DefaultPollInterval is how often Follow polls the Log's STH, unless the
+// ScannerOptions say otherwise.
+const DefaultPollInterval = time.Minute
+
 // Creates a new ScannerOptions struct with sensible defaults
 func DefaultScannerOptions() *ScannerOptions {
 	return &ScannerOptions{
@@ -135,20 +187,16 @@ func DefaultScannerOptions() *ScannerOptions {
 
 // Scanner is a tool to scan all the entries in a CT Log.
 type Scanner struct {
+	// Statistics of the current or last scan.  First, so that its atomic
+	// counters are 64-bit aligned on 32-bit platforms.
+	stats       scanStats
+	parseErrors parseErrorCounts
+
 	// Client used to talk to the CT log instance
 	logClient *client.LogClient
 
 	// Configuration options for this Scanner instance
 	opts ScannerOptions
-
-	// Counter of the number of certificates scanned
-	certsProcessed int64
-
-	// Counter of the number of precertificates encountered during the scan.
-	precertsSeen int64
-
-	unparsableEntries         int64
-	entriesWithNonFatalErrors int64
 }
 
 // matcherJob represents the context for an individual matcher job.
@@ -157,120 +205,102 @@ type matcherJob struct {
 	entry ct.LogEntry
 	// The index of the entry containing the LeafInput in the log
 	index int64
-}
-
-// fetchRange represents a range of certs to fetch from a CT log
-type fetchRange struct {
-	start int64
-	end   int64
+	// The index of the range the entry was fetched in
+	rng int
 }
 
 // Takes the error returned by either x509.ParseCertificate() or
-// x509.ParseTBSCertificate() and determines if it's non-fatal or otherwise.
+// x509.ParseTBSCertificate() on |raw| and determines if it's non-fatal or
+// otherwise.
 // In the case of non-fatal errors, the error will be logged,
 // entriesWithNonFatalErrors will be incremented, and the return value will be
 // nil.
 // Fatal errors will be logged, unparsableEntires will be incremented, and the
 // fatal error itself will be returned.
+// Either way the error is counted in the ParseErrorSummary, and passed to the
+// ParseErrors option if it is set.
 // When |err| is nil, this method does nothing.
-func (s *Scanner) handleParseEntryError(err error, entryType ct.LogEntryType, index int64) error {
+func (s *Scanner) handleParseEntryError(err error, entryType ct.LogEntryType, index int64, raw []byte) error {
 	if err == nil {
 		// No error to handle
 		return nil
 	}
+	pe := newParseError(err, entryType, index, raw)
+	s.parseErrors.add(pe)
+	if s.opts.ParseErrors != nil {
+		s.opts.ParseErrors(pe)
+	}
 	switch err.(type) {
 	case x509.NonFatalErrors:
-		s.entriesWithNonFatalErrors++
+		atomic.AddInt64(&s.stats.entriesWithNonFatalErrors, 1)
 		// We'll make a note, but continue.
 		s.Log(fmt.Sprintf("Non-fatal error in %+v at index %d: %s", entryType, index, err.Error()))
 	default:
-		s.unparsableEntries++
+		atomic.AddInt64(&s.stats.unparsableEntries, 1)
 		s.Log(fmt.Sprintf("Failed to parse in %+v at index %d : %s", entryType, index, err.Error()))
 		return err
 	}
 	return nil
 }
 
+// Returns whether the configured matcher matches |entry|, whose X509Cert or
+// Precert has been set.
+func (s *Scanner) entryMatches(entry *ct.LogEntry) bool {
+	if s.opts.EntryMatcher != nil {
+		return s.opts.EntryMatcher.EntryMatches(entry)
+	}
+	if entry.Precert != nil {
+		return s.opts.Matcher.PrecertificateMatches(entry.Precert)
+	}
+	return s.opts.Matcher.CertificateMatches(entry.X509Cert)
+}
+
 // Processes the given |entry| in the specified log.
 func (s *Scanner) processEntry(entry ct.LogEntry, foundCert func(*ct.LogEntry), foundPrecert func(*ct.LogEntry)) {
-	atomic.AddInt64(&s.certsProcessed, 1)
-	switch entry.Leaf.TimestampedEntry.EntryType {
+	atomic.AddInt64(&s.stats.certsProcessed, 1)
+	te := &entry.Leaf.TimestampedEntry
+	var raw []byte
+	switch te.EntryType {
 	case ct.X509LogEntryType:
 		if s.opts.PrecertOnly {
 			// Only interested in precerts and this is an X.509 cert, early-out.
 			return
 		}
-		cert, err := x509.ParseCertificate(entry.Leaf.TimestampedEntry.X509Entry)
-		if err = s.handleParseEntryError(err, entry.Leaf.TimestampedEntry.EntryType, entry.Index); err != nil {
-			// We hit an unparseable entry, already logged inside handleParseEntryError()
-			return
-		}
-		if s.opts.Matcher.CertificateMatches(cert) {
-			entry.X509Cert = cert
-			foundCert(&entry)
-		}
+		raw = te.X509Entry
 	case ct.PrecertLogEntryType:
-		c, err := x509.ParseTBSCertificate(entry.Leaf.TimestampedEntry.PrecertEntry.TBSCertificate)
-		if err = s.handleParseEntryError(err, entry.Leaf.TimestampedEntry.EntryType, entry.Index); err != nil {
-			// We hit an unparseable entry, already logged inside handleParseEntryError()
-			return
-		}
-		precert := &ct.Precertificate{
-			Raw:            entry.Chain[0],
-			TBSCertificate: *c,
-			IssuerKeyHash:  entry.Leaf.TimestampedEntry.PrecertEntry.IssuerKeyHash}
-		if s.opts.Matcher.PrecertificateMatches(precert) {
-			entry.Precert = precert
+		raw = te.PrecertEntry.TBSCertificate
+	default:
+		return
+	}
+	if err := s.handleParseEntryError(entry.Parse(), te.EntryType, entry.Index, raw); err != nil {
+		// We hit an unparseable entry, already logged inside handleParseEntryError()
+		return
+	}
+	if s.entryMatches(&entry) {
+		atomic.AddInt64(&s.stats.matches, 1)
+		if entry.IsPrecert() {
 			foundPrecert(&entry)
+		} else {
+			foundCert(&entry)
 		}
-		s.precertsSeen++
+	}
+	if entry.IsPrecert() {
+		atomic.AddInt64(&s.stats.precertsSeen, 1)
 	}
 }
 
 // Worker function to match certs.
 // Accepts MatcherJobs over the |entries| channel, and processes them.
 // Returns true over the |done| channel when the |entries| channel is closed.
-func (s *Scanner) matcherJob(id int, entries <-chan matcherJob, foundCert func(*ct.LogEntry), foundPrecert func(*ct.LogEntry), wg *sync.WaitGroup) {
+func (s *Scanner) matcherJob(id int, entries <-chan matcherJob, foundCert func(*ct.LogEntry), foundPrecert func(*ct.LogEntry), p *progress, wg *sync.WaitGroup) {
 	for e := range entries {
 		s.processEntry(e.entry, foundCert, foundPrecert)
+		p.processed(e.rng)
 	}
 	s.Log(fmt.Sprintf("Matcher %d finished", id))
 	wg.Done()
 }
 
-// Worker function for fetcher jobs.
-// Accepts cert ranges to fetch over the |ranges| channel, and if the fetch is
-// successful sends the individual LeafInputs out (as MatcherJobs) into the
-// |entries| channel for the matchers to chew on.
-// Will retry failed attempts to retrieve ranges indefinitely.
-// Sends true over the |done| channel when the |ranges| channel is closed.
-func (s *Scanner) fetcherJob(id int, ranges <-chan fetchRange, entries chan<- matcherJob, wg *sync.WaitGroup) {
-	for r := range ranges {
-		success := false
-		// TODO(alcutter): give up after a while:
-		for !success {
-			logEntries, err := s.logClient.GetEntries(r.start, r.end)
-			if err != nil {
-				s.Log(fmt.Sprintf("Problem fetching from log: %s", err.Error()))
-				continue
-			}
-			for _, logEntry := range logEntries {
-				logEntry.Index = r.start
-				entries <- matcherJob{logEntry, r.start}
-				r.start++
-			}
-			if r.start > r.end {
-				// Only complete if we actually got all the leaves we were
-				// expecting -- Logs MAY return fewer than the number of
-				// leaves requested.
-				success = true
-			}
-		}
-	}
-	s.Log(fmt.Sprintf("Fetcher %d finished", id))
-	wg.Done()
-}
-
 // Returns the smaller of |a| and |b|
 func min(a int64, b int64) int64 {
 	if a < b {
@@ -311,7 +341,7 @@ func humanTime(seconds int) string {
 	return s
 }
 
-func (s Scanner) Log(msg string) {
+func (s *Scanner) Log(msg string) {
 	if !s.opts.Quiet {
 		log.Print(msg)
 	}
@@ -327,10 +357,6 @@ func (s Scanner) Log(msg string) {
 func (s *Scanner) Scan(foundCert func(*ct.LogEntry),
 	foundPrecert func(*ct.LogEntry)) error {
 	s.Log("Starting up...\n")
-	s.certsProcessed = 0
-	s.precertsSeen = 0
-	s.unparsableEntries = 0
-	s.entriesWithNonFatalErrors = 0
 
 	latestSth, err := s.logClient.GetSTH()
 	if err != nil {
@@ -338,50 +364,169 @@ func (s *Scanner) Scan(foundCert func(*ct.LogEntry),
 	}
 	s.Log(fmt.Sprintf("Got STH with %d certs", latestSth.TreeSize))
 
+	startIndex, hash, err := s.startIndex()
+	if err != nil {
+		return err
+	}
+	s.resetStats(startIndex)
+	defer s.stopStats()
+	return s.scanRange(context.Background(), startIndex, latestSth, hash, foundCert, foundPrecert)
+}
+
+// Follows the Log: scans it as Scan does, and then polls its STH every
+// PollInterval, scanning the new entries each time the tree grows, until
+// |ctx| is done.  Each time it catches up it reports how far behind the Log's
+// latest STH is, warning if that is more than the Log's MMD.
+//
+// This method blocks until |ctx| is done, saving a checkpoint fails, or some
+// entries can't be fetched (see MaxFetchAttempts), and then returns the
+// error.  Once |ctx| is done no more entries are fetched, but those already
+// fetched are matched before this method returns.
+func (s *Scanner) Follow(ctx context.Context, foundCert func(*ct.LogEntry),
+	foundPrecert func(*ct.LogEntry)) error {
+	s.Log("Starting up...\n")
+
+	next, hash, err := s.startIndex()
+	if err != nil {
+		return err
+	}
+	s.resetStats(next)
+	defer s.stopStats()
+	interval := s.opts.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		sth, err := s.logClient.GetSTHWithContext(ctx)
+		if err != nil {
+			s.Log(fmt.Sprintf("Problem fetching STH from log: %s", err.Error()))
+		} else {
+			if size := int64(sth.TreeSize); size > next {
+				s.Log(fmt.Sprintf("Got STH with %d certs", sth.TreeSize))
+				if err := s.scanRange(ctx, next, sth, hash, foundCert, foundPrecert); err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					return err
+				}
+				next = size
+			}
+			s.reportLag(sth, time.Now())
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// reportLag logs how old the Log's latest STH, which the Scanner has caught up
+// with, was at |now|.  STHs older than the Log's MMD are a sign that the Log
+// isn't incorporating new entries, so are warned about.
+func (s *Scanner) reportLag(sth *ct.SignedTreeHead, now time.Time) {
+	age := now.Sub(time.Unix(0, int64(sth.Timestamp)*int64(time.Millisecond)))
+	if s.opts.MMD > 0 && age > s.opts.MMD {
+		// Always logged, as monitors need to know.
+		log.Printf("Warning: caught up to index %d, but the latest STH is %s old, more than the log's MMD of %s",
+			sth.TreeSize, age, s.opts.MMD)
+		return
+	}
+	s.Log(fmt.Sprintf("Caught up to index %d, the latest STH is %s old", sth.TreeSize, age))
+}
+
+// Returns the index the scan should start from, which is StartIndex unless
+// there is a later checkpoint to resume from, and the hash of the matcher's
+// configuration to save checkpoints with.
+func (s *Scanner) startIndex() (int64, string, error) {
+	startIndex := s.opts.StartIndex
+	if s.opts.Checkpoints == nil {
+		return startIndex, "", nil
+	}
+	hash := matcherHash(&s.opts)
+	cp, err := s.opts.Checkpoints.LoadCheckpoint(s.logClient.URI())
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to load checkpoint: %v", err)
+	}
+	switch {
+	case cp == nil:
+	case cp.MatcherHash != hash:
+		s.Log("Matcher has changed since the checkpoint was saved, not resuming from it")
+	case cp.NextIndex > startIndex:
+		s.Log(fmt.Sprintf("Resuming from checkpoint at index %d", cp.NextIndex))
+		startIndex = cp.NextIndex
+	}
+	return startIndex, hash, nil
+}
+
+// Scans the entries of the Log from |startIndex| up to, but not including,
+// the size of the tree of |sth|, blocking until they have all been matched.
+func (s *Scanner) scanRange(ctx context.Context, startIndex int64, sth *ct.SignedTreeHead, hash string,
+	foundCert func(*ct.LogEntry), foundPrecert func(*ct.LogEntry)) error {
+	treeSize := int64(sth.TreeSize)
 	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	done := make(chan struct{})
+	defer close(done)
 	startTime := time.Now()
-	fetches := make(chan fetchRange, 1000)
+	s.setTreeSize(treeSize)
+	before := s.Stats()
 	jobs := make(chan matcherJob, 100000)
 	go func() {
-		for range ticker.C {
-			throughput := float64(s.certsProcessed) / time.Since(startTime).Seconds()
-			remainingCerts := int64(latestSth.TreeSize) - int64(s.opts.StartIndex) - s.certsProcessed
-			remainingSeconds := int(float64(remainingCerts) / throughput)
-			remainingString := humanTime(remainingSeconds)
-			s.Log(fmt.Sprintf("Processed: %d certs (to index %d). Throughput: %3.2f ETA: %s\n", s.certsProcessed,
-				s.opts.StartIndex+int64(s.certsProcessed), throughput, remainingString))
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			st := s.Stats()
+			s.Log(fmt.Sprintf("Processed: %d certs (to index %d). Throughput: %3.2f (fetching %3.2f) ETA: %s\n",
+				st.EntriesProcessed, st.StartIndex+st.EntriesProcessed, st.MatchRate, st.FetchRate,
+				humanTime(int(st.ETA.Seconds()))))
 		}
 	}()
 
-	var ranges list.List
-	for start := s.opts.StartIndex; start < int64(latestSth.TreeSize); {
-		end := min(start+int64(s.opts.BatchSize), int64(latestSth.TreeSize)) - 1
-		ranges.PushBack(fetchRange{start, end})
+	var ranges []fetchRange
+	for start := startIndex; start < treeSize; {
+		end := min(start+int64(s.opts.BatchSize), treeSize) - 1
+		ranges = append(ranges, fetchRange{start: start, end: end, id: len(ranges)})
 		start = end + 1
 	}
+	var p *progress
+	if s.opts.Checkpoints != nil {
+		p = newProgress(s.opts.Checkpoints, s.logClient.URI(), hash, ranges)
+	}
 	var fetcherWG sync.WaitGroup
 	var matcherWG sync.WaitGroup
 	// Start matcher workers
 	for w := 0; w < s.opts.NumWorkers; w++ {
 		matcherWG.Add(1)
-		go s.matcherJob(w, jobs, foundCert, foundPrecert, &matcherWG)
+		go s.matcherJob(w, jobs, foundCert, foundPrecert, p, &matcherWG)
 	}
 	// Start fetcher workers
+	q := newFetchQueue(ranges)
 	for w := 0; w < s.opts.ParallelFetch; w++ {
 		fetcherWG.Add(1)
-		go s.fetcherJob(w, fetches, jobs, &fetcherWG)
-	}
-	for r := ranges.Front(); r != nil; r = r.Next() {
-		fetches <- r.Value.(fetchRange)
+		go s.fetcherJob(ctx, w, q, sth, jobs, &fetcherWG)
 	}
-	close(fetches)
 	fetcherWG.Wait()
 	close(jobs)
 	matcherWG.Wait()
 
-	s.Log(fmt.Sprintf("Completed %d certs in %s", s.certsProcessed, humanTime(int(time.Since(startTime).Seconds()))))
-	s.Log(fmt.Sprintf("Saw %d precerts", s.precertsSeen))
-	s.Log(fmt.Sprintf("%d unparsable entries, %d non-fatal errors", s.unparsableEntries, s.entriesWithNonFatalErrors))
+	st := s.Stats()
+	s.Log(fmt.Sprintf("Completed %d certs in %s", st.EntriesProcessed-before.EntriesProcessed,
+		humanTime(int(time.Since(startTime).Seconds()))))
+	s.Log(fmt.Sprintf("Saw %d precerts", st.PrecertsSeen))
+	s.Log(s.ParseErrorSummary().String())
+	s.Log(fmt.Sprintf("Fetched %d batches, mean latency %s, with %d errors", st.BatchesFetched, st.MeanBatchLatency, st.FetchErrors))
+	if p != nil && p.err != nil {
+		return fmt.Errorf("failed to save checkpoint: %v", p.err)
+	}
+	if len(q.failed) > 0 {
+		return FetchError{Ranges: q.failed}
+	}
 	return nil
 }
 
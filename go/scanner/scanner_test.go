@@ -2,15 +2,21 @@ package scanner
 
 import (
 	"container/list"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/certificate-transparency/go"
 	"github.com/google/certificate-transparency/go/client"
 	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
 )
 
 func CertMatchesRegex(r *regexp.Regexp, cert *x509.Certificate) bool {
@@ -239,3 +245,97 @@ func TestDefaultScannerOptions(t *testing.T) {
 		t.Fatal("Expected Quiet to be false.")
 	}
 }
+
+// growingLog serves the entries of FourEntries, of which only the first
+// |size| are in its tree.
+type growingLog struct {
+	entries []json.RawMessage
+	mu      sync.Mutex
+	size    int
+	// The root hash in the log's STHs, which is made up unless it is set.
+	root string
+}
+
+func newGrowingLog(t *testing.T, size int) *growingLog {
+	var resp struct{ Entries []json.RawMessage }
+	if err := json.Unmarshal([]byte(FourEntries), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return &growingLog{entries: resp.Entries, size: size, root: "0JBu0CkZnKXc1niEndDaqqgCRHucCfVt1/WBAXs/5T8="}
+}
+
+func (l *growingLog) setSize(size int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.size = size
+}
+
+func (l *growingLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch r.URL.Path {
+	case "/ct/v1/get-sth":
+		fmt.Fprintf(w, `{"tree_size":%d,"timestamp":%d,"sha256_root_hash":"%s","tree_head_signature":"AAAACXNpZ25hdHVyZQ=="}`,
+			l.size, time.Now().UnixNano()/int64(time.Millisecond), l.root)
+	case "/ct/v1/get-entries":
+		start, err1 := strconv.Atoi(r.FormValue("start"))
+		end, err2 := strconv.Atoi(r.FormValue("end"))
+		if err1 != nil || err2 != nil || start > end || end >= l.size {
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			Entries []json.RawMessage `json:"entries"`
+		}{l.entries[start : end+1]})
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func TestScannerFollow(t *testing.T) {
+	l := newGrowingLog(t, 2)
+	ts := httptest.NewServer(l)
+	defer ts.Close()
+
+	opts := ScannerOptions{
+		Matcher:       &MatchAll{},
+		BatchSize:     10,
+		NumWorkers:    1,
+		ParallelFetch: 1,
+		Quiet:         true,
+		PollInterval:  10 * time.Millisecond,
+		MMD:           time.Hour,
+	}
+	scanner := NewScanner(client.New(ts.URL), opts)
+
+	found := make(chan int64, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		f := func(e *ct.LogEntry) { found <- e.Index }
+		errs <- scanner.Follow(ctx, f, f)
+	}()
+
+	for want := int64(0); want < 4; want++ {
+		select {
+		case got := <-found:
+			if got != want {
+				t.Fatalf("Follow found entry %d, want %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Follow didn't find entry %d", want)
+		}
+		if want == 1 {
+			l.setSize(4)
+		}
+	}
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Follow()=%v, want %v", err, context.Canceled)
+	}
+	select {
+	case got := <-found:
+		t.Errorf("Follow found unexpected entry %d", got)
+	default:
+	}
+}
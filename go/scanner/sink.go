@@ -0,0 +1,424 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/dnsnames"
+	"github.com/google/certificate-transparency/go/revocation"
+)
+
+// Sink receives the entries a scan matches, e.g. to write them out.  Sinks
+// must be safe for concurrent use, as the scanner's matchers call them
+// concurrently.
+type Sink interface {
+	// Write records a matched entry, whose X509Cert or Precert is set.
+	Write(entry *ct.LogEntry) error
+	// Close flushes any entries which haven't been recorded yet, and
+	// releases the sink's resources.
+	Close() error
+}
+
+// RecordSink is a Sink to which Records can be written directly, which lets
+// callers fill in fields which entries don't determine, such as the log the
+// entry is from.  All the Sinks in this package are RecordSinks.
+type RecordSink interface {
+	Sink
+	// WriteRecord records the Record of a matched entry.
+	WriteRecord(r Record) error
+}
+
+// FoundFunc returns a function which writes the entries it is called with to
+// |sink|, for passing to Scan or Follow.  Errors writing entries are logged.
+func FoundFunc(sink Sink) func(*ct.LogEntry) {
+	return func(entry *ct.LogEntry) {
+		if err := sink.Write(entry); err != nil {
+			log.Printf("Failed to write entry %d: %s", entry.Index, err)
+		}
+	}
+}
+
+// Record is the description of a matched entry which sinks write.
+type Record struct {
+	Index     int64  `json:"index"`
+	Timestamp uint64 `json:"timestamp"`
+	// "x509" or "precert".
+	EntryType string `json:"entry_type"`
+	// The DER of the certificate or precertificate.
+	DER          []byte   `json:"der"`
+	SerialNumber string   `json:"serial_number"`
+	SubjectCN    string   `json:"subject_cn"`
+	DNSNames     []string `json:"dns_names,omitempty"`
+	// The normalized, distinct domain names of the Subject CN and DNSNames.
+	Domains   []string  `json:"domains,omitempty"`
+	IssuerCN  string    `json:"issuer_cn"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	// The URL and ID of the log the entry is from, if the sink's caller
+	// sets them, e.g. when merging the entries of several logs.
+	Log   string `json:"log,omitempty"`
+	LogID []byte `json:"log_id,omitempty"`
+	// The revocation status of the certificate, if a RevocationAnnotator
+	// annotated the Record.
+	Revocation *revocation.Status `json:"revocation,omitempty"`
+}
+
+// NewRecord returns the Record describing |entry|, whose X509Cert or Precert
+// must be set.
+func NewRecord(entry *ct.LogEntry) Record {
+	r := Record{
+		Index:     entry.Index,
+		Timestamp: entry.Leaf.TimestampedEntry.Timestamp,
+	}
+	if c := entry.Certificate(); c != nil {
+		r.EntryType = "x509"
+		if entry.IsPrecert() {
+			r.EntryType = "precert"
+		}
+		r.DER = entry.RawCertificate()
+		if c.SerialNumber != nil {
+			r.SerialNumber = c.SerialNumber.String()
+		}
+		r.SubjectCN = c.Subject.CommonName
+		r.DNSNames = c.DNSNames
+		r.Domains = dnsnames.Names(c)
+		r.IssuerCN = c.Issuer.CommonName
+		r.NotBefore = c.NotBefore
+		r.NotAfter = c.NotAfter
+	}
+	return r
+}
+
+// JSONLinesSink is a Sink which writes entries' Records to a writer as JSON,
+// one per line.
+type JSONLinesSink struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewJSONLinesSink returns a JSONLinesSink which writes to |w|.  Closing the
+// sink closes |w| if it is an io.Closer.
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w, enc: json.NewEncoder(w)}
+}
+
+// Write implements Sink.
+func (s *JSONLinesSink) Write(entry *ct.LogEntry) error {
+	return s.WriteRecord(NewRecord(entry))
+}
+
+// WriteRecord implements RecordSink.
+func (s *JSONLinesSink) WriteRecord(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(r)
+}
+
+// Close implements Sink.
+func (s *JSONLinesSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// CSVColumns are the columns of the CSV written by a CSVSink, in order.
+// Lists of DNS names are separated by spaces, times are in RFC 3339 format,
+// and DER and log IDs are base64 encoded.
+var CSVColumns = []string{"index", "timestamp", "entry_type", "serial_number", "subject_cn", "dns_names", "issuer_cn", "not_before", "not_after", "der", "log", "log_id"}
+
+// CSVSink is a Sink which writes entries' Records to a writer as CSV, after
+// a header line of the CSVColumns.
+type CSVSink struct {
+	mu sync.Mutex
+	w  io.Writer
+	cw *csv.Writer
+	// Whether the header line has been written.
+	started bool
+}
+
+// NewCSVSink returns a CSVSink which writes to |w|.  Closing the sink closes
+// |w| if it is an io.Closer.
+func NewCSVSink(w io.Writer) *CSVSink {
+	return &CSVSink{w: w, cw: csv.NewWriter(w)}
+}
+
+// Write implements Sink.
+func (s *CSVSink) Write(entry *ct.LogEntry) error {
+	return s.WriteRecord(NewRecord(entry))
+}
+
+// WriteRecord implements RecordSink.
+func (s *CSVSink) WriteRecord(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		if err := s.cw.Write(CSVColumns); err != nil {
+			return err
+		}
+		s.started = true
+	}
+	var logID string
+	if len(r.LogID) > 0 {
+		logID = base64.StdEncoding.EncodeToString(r.LogID)
+	}
+	return s.cw.Write([]string{
+		strconv.FormatInt(r.Index, 10),
+		strconv.FormatUint(r.Timestamp, 10),
+		r.EntryType,
+		r.SerialNumber,
+		r.SubjectCN,
+		strings.Join(r.DNSNames, " "),
+		r.IssuerCN,
+		r.NotBefore.Format(time.RFC3339),
+		r.NotAfter.Format(time.RFC3339),
+		base64.StdEncoding.EncodeToString(r.DER),
+		r.Log,
+		logID,
+	})
+}
+
+// Close implements Sink.
+func (s *CSVSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cw.Flush()
+	if err := s.cw.Error(); err != nil {
+		return err
+	}
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Defaults for WebhookOptions.
+const (
+	DefaultWebhookBatchSize     = 100
+	DefaultWebhookFlushInterval = 10 * time.Second
+	DefaultWebhookMaxAttempts   = 5
+	DefaultWebhookRetryDelay    = time.Second
+)
+
+// WebhookOptions holds optional configuration for a WebhookSink.
+type WebhookOptions struct {
+	// Maximum number of Records in each request.  Zero means
+	// DefaultWebhookBatchSize.
+	BatchSize int
+	// How long Records may wait for a batch to fill up before they are
+	// sent anyway.  Zero means DefaultWebhookFlushInterval.
+	FlushInterval time.Duration
+	// Number of times each request is attempted before its Records are
+	// dropped.  Zero means DefaultWebhookMaxAttempts.
+	MaxAttempts int
+	// Delay before retrying a failed request, which doubles with each
+	// attempt.  Zero means DefaultWebhookRetryDelay.
+	RetryDelay time.Duration
+	// The HTTP client to make requests with.  If nil, http.DefaultClient is
+	// used.
+	HTTPClient *http.Client
+}
+
+// WebhookRequest is the JSON body of the requests a WebhookSink POSTs.
+type WebhookRequest struct {
+	Entries []Record `json:"entries"`
+}
+
+// WebhookSink is a Sink which POSTs entries' Records to a URL in batches, as
+// WebhookRequests.  Requests which fail, or which are answered with a status
+// other than 2xx, are retried.  Batches are sent one at a time, so a slow
+// webhook slows down the scan rather than the sink's memory use growing.
+type WebhookSink struct {
+	url  string
+	opts WebhookOptions
+
+	mu      sync.Mutex
+	pending []Record
+	batches chan []Record
+	done    chan struct{}
+	// The number of Records which have been dropped, and the last error.
+	dropped int
+	err     error
+}
+
+// NewWebhookSink returns a WebhookSink which POSTs to |url|.
+func NewWebhookSink(url string, opts WebhookOptions) *WebhookSink {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultWebhookBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultWebhookFlushInterval
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultWebhookMaxAttempts
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultWebhookRetryDelay
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	s := &WebhookSink{
+		url:     url,
+		opts:    opts,
+		batches: make(chan []Record),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write implements Sink.  It blocks while a full batch waits to be sent.
+func (s *WebhookSink) Write(entry *ct.LogEntry) error {
+	return s.WriteRecord(NewRecord(entry))
+}
+
+// WriteRecord implements RecordSink.  It blocks while a full batch waits to
+// be sent.
+func (s *WebhookSink) WriteRecord(r Record) error {
+	s.mu.Lock()
+	s.pending = append(s.pending, r)
+	var batch []Record
+	if len(s.pending) >= s.opts.BatchSize {
+		batch, s.pending = s.pending, nil
+	}
+	s.mu.Unlock()
+	if batch != nil {
+		s.batches <- batch
+	}
+	return nil
+}
+
+// Close implements Sink.  It sends the Records which are waiting, and returns
+// an error if any Records were dropped.
+func (s *WebhookSink) Close() error {
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	if len(batch) > 0 {
+		s.batches <- batch
+	}
+	close(s.batches)
+	<-s.done
+	if s.dropped > 0 {
+		return fmt.Errorf("dropped %d entries: %v", s.dropped, s.err)
+	}
+	return nil
+}
+
+// run sends batches until the sink is closed, and flushes the pending
+// Records each FlushInterval.
+func (s *WebhookSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		var batch []Record
+		select {
+		case b, ok := <-s.batches:
+			if !ok {
+				return
+			}
+			batch = b
+		case <-ticker.C:
+			s.mu.Lock()
+			batch, s.pending = s.pending, nil
+			s.mu.Unlock()
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		if err := s.send(batch); err != nil {
+			log.Printf("Failed to send %d entries to webhook: %s", len(batch), err)
+			s.dropped += len(batch)
+			s.err = err
+		}
+	}
+}
+
+// send POSTs a batch, retrying up to MaxAttempts times.
+func (s *WebhookSink) send(batch []Record) error {
+	body, err := json.Marshal(WebhookRequest{Entries: batch})
+	if err != nil {
+		return err
+	}
+	delay := s.opts.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err = s.post(body)
+		if err == nil || attempt >= s.opts.MaxAttempts {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (s *WebhookSink) post(body []byte) error {
+	resp, err := s.opts.HTTPClient.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got HTTP Status %s", resp.Status)
+	}
+	return nil
+}
+
+// MultiSink returns a Sink which writes entries to all of |sinks|.  It is a
+// RecordSink, but writing Records to it fails for any of |sinks| which aren't
+// RecordSinks.
+func MultiSink(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+type multiSink []Sink
+
+func (m multiSink) Write(entry *ct.LogEntry) error {
+	var firstErr error
+	for _, s := range m {
+		if err := s.Write(entry); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m multiSink) WriteRecord(r Record) error {
+	var firstErr error
+	for _, s := range m {
+		var err error
+		if rs, ok := s.(RecordSink); ok {
+			err = rs.WriteRecord(r)
+		} else {
+			err = fmt.Errorf("%T can't write Records", s)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m multiSink) Close() error {
+	var firstErr error
+	for _, s := range m {
+		if err := s.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,84 @@
+package scanner
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/google/certificate-transparency/go"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sinkSchema = `
+        CREATE TABLE IF NOT EXISTS matches (
+                log             STRING NOT NULL,
+                idx             INTEGER NOT NULL,
+                timestamp       INTEGER NOT NULL,
+                entry_type      STRING NOT NULL,
+                der             BYTES NOT NULL,
+                serial_number   STRING NOT NULL,
+                subject_cn      STRING NOT NULL,
+                dns_names       STRING NOT NULL,
+                issuer_cn       STRING NOT NULL,
+                not_before      INTEGER NOT NULL,
+                not_after       INTEGER NOT NULL,
+                PRIMARY KEY (log, idx)
+        );`
+
+const upsertMatch = `INSERT OR REPLACE INTO matches(log, idx, timestamp, entry_type, der, serial_number, subject_cn, dns_names, issuer_cn, not_before, not_after)
+                         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`
+
+// SQLiteSink is a Sink which writes entries' Records to the matches table of
+// an SQLite3 database, keyed by log and index, so that rescanning a log
+// doesn't duplicate rows.  DNS names are separated by spaces, and times are
+// in seconds since the epoch.  Records which name the log they are from are
+// recorded as being from it.
+type SQLiteSink struct {
+	db          *sql.DB
+	logURL      string
+	upsertMatch *sql.Stmt
+}
+
+// NewSQLiteSink opens the SQLite3 database at dbPath, creating it and its
+// matches table if they don't exist, and returns a sink which records
+// entries as being from the log at logURL.
+func NewSQLiteSink(dbPath, logURL string) (*SQLiteSink, error) {
+	if len(dbPath) == 0 {
+		return nil, errors.New("empty database file name")
+	}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sinkSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	stmt, err := db.Prepare(upsertMatch)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteSink{db: db, logURL: logURL, upsertMatch: stmt}, nil
+}
+
+// Write implements Sink.
+func (s *SQLiteSink) Write(entry *ct.LogEntry) error {
+	return s.WriteRecord(NewRecord(entry))
+}
+
+// WriteRecord implements RecordSink.
+func (s *SQLiteSink) WriteRecord(r Record) error {
+	logURL := r.Log
+	if logURL == "" {
+		logURL = s.logURL
+	}
+	_, err := s.upsertMatch.Exec(logURL, r.Index, int64(r.Timestamp), r.EntryType, r.DER, r.SerialNumber,
+		r.SubjectCN, strings.Join(r.DNSNames, " "), r.IssuerCN, r.NotBefore.Unix(), r.NotAfter.Unix())
+	return err
+}
+
+// Close implements Sink.
+func (s *SQLiteSink) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,249 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+func sinkEntry(index int64) *ct.LogEntry {
+	e := &ct.LogEntry{
+		Index: index,
+		X509Cert: &x509.Certificate{
+			Raw:          []byte{1, 2, 3},
+			SerialNumber: big.NewInt(index),
+			Subject:      pkix.Name{CommonName: "www.example.com"},
+			Issuer:       pkix.Name{CommonName: "Example CA"},
+			DNSNames:     []string{"www.example.com", "example.com"},
+			NotBefore:    time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+			NotAfter:     time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	e.Leaf.TimestampedEntry.Timestamp = 1000 + uint64(index)
+	return e
+}
+
+func TestNewRecord(t *testing.T) {
+	want := Record{
+		Index:        3,
+		Timestamp:    1003,
+		EntryType:    "x509",
+		DER:          []byte{1, 2, 3},
+		SerialNumber: "3",
+		SubjectCN:    "www.example.com",
+		DNSNames:     []string{"www.example.com", "example.com"},
+		Domains:      []string{"www.example.com", "example.com"},
+		IssuerCN:     "Example CA",
+		NotBefore:    time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if got := NewRecord(sinkEntry(3)); !reflect.DeepEqual(got, want) {
+		t.Errorf("NewRecord()=%+v, want %+v", got, want)
+	}
+
+	e := &ct.LogEntry{Precert: &ct.Precertificate{Raw: []byte{4}, TBSCertificate: *sinkEntry(1).X509Cert}}
+	if got := NewRecord(e); got.EntryType != "precert" || !bytes.Equal(got.DER, []byte{4}) || got.SubjectCN != "www.example.com" {
+		t.Errorf("NewRecord(precert)=%+v", got)
+	}
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewJSONLinesSink(&buf)
+	for i := int64(0); i < 2; i++ {
+		if err := s.Write(sinkEntry(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(&buf)
+	for i := int64(0); i < 2; i++ {
+		var r Record
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if want := NewRecord(sinkEntry(i)); !reflect.DeepEqual(r, want) {
+			t.Errorf("#%d: got %+v, want %+v", i, r, want)
+		}
+	}
+	if dec.More() {
+		t.Error("Unexpected extra records")
+	}
+}
+
+func TestCSVSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewCSVSink(&buf)
+	for i := int64(0); i < 2; i++ {
+		if err := s.Write(sinkEntry(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		CSVColumns,
+		{"0", "1000", "x509", "0", "www.example.com", "www.example.com example.com", "Example CA", "2000-01-01T00:00:00Z", "2040-01-01T00:00:00Z", "AQID", "", ""},
+		{"1", "1001", "x509", "1", "www.example.com", "www.example.com example.com", "Example CA", "2000-01-01T00:00:00Z", "2040-01-01T00:00:00Z", "AQID", "", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("CSV=%v, want %v", rows, want)
+	}
+}
+
+func TestSQLiteSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewSQLiteSink(filepath.Join(dir, "matches.db"), "https://log.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// Writing an entry twice replaces it.
+	for _, i := range []int64{0, 1, 1} {
+		if err := s.Write(sinkEntry(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM matches WHERE log = $1", "https://log.example.com").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d rows, want 2", n)
+	}
+}
+
+// webhook records the requests it receives, failing the first |failures|.
+type webhook struct {
+	mu       sync.Mutex
+	failures int
+	requests []WebhookRequest
+}
+
+func (h *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failures > 0 {
+		h.failures--
+		http.Error(w, "injected failure", http.StatusServiceUnavailable)
+		return
+	}
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.requests = append(h.requests, req)
+}
+
+func (h *webhook) indices() [][]int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var batches [][]int64
+	for _, req := range h.requests {
+		var batch []int64
+		for _, r := range req.Entries {
+			batch = append(batch, r.Index)
+		}
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+func TestWebhookSinkBatchesAndRetries(t *testing.T) {
+	h := &webhook{failures: 2}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	s := NewWebhookSink(ts.URL, WebhookOptions{BatchSize: 2, FlushInterval: time.Hour, RetryDelay: time.Millisecond})
+	for i := int64(0); i < 5; i++ {
+		if err := s.Write(sinkEntry(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close()=%v", err)
+	}
+	if got, want := h.indices(), [][]int64{{0, 1}, {2, 3}, {4}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("webhook got batches %v, want %v", got, want)
+	}
+}
+
+func TestWebhookSinkFlushesAndDrops(t *testing.T) {
+	h := &webhook{}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	s := NewWebhookSink(ts.URL, WebhookOptions{FlushInterval: 10 * time.Millisecond, MaxAttempts: 2, RetryDelay: time.Millisecond})
+	s.Write(sinkEntry(0))
+	for deadline := time.Now().Add(5 * time.Second); len(h.indices()) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("webhook sink didn't flush its pending entry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	h.mu.Lock()
+	h.failures = 2
+	h.mu.Unlock()
+	s.Write(sinkEntry(1))
+	if err := s.Close(); err == nil {
+		t.Error("Close() after failing to send an entry=nil, want error")
+	}
+	if got, want := h.indices(), [][]int64{{0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("webhook got batches %v, want %v", got, want)
+	}
+}
+
+// countingSink counts its writes, failing them if err is set.
+type countingSink struct {
+	writes, closes int
+	err            error
+}
+
+func (c *countingSink) Write(*ct.LogEntry) error {
+	c.writes++
+	return c.err
+}
+
+func (c *countingSink) Close() error {
+	c.closes++
+	return c.err
+}
+
+func TestMultiSink(t *testing.T) {
+	a, b := &countingSink{err: os.ErrInvalid}, &countingSink{}
+	m := MultiSink(a, b)
+	if err := m.Write(sinkEntry(0)); err != os.ErrInvalid {
+		t.Errorf("Write()=%v, want %v", err, os.ErrInvalid)
+	}
+	if err := m.Close(); err != os.ErrInvalid {
+		t.Errorf("Close()=%v, want %v", err, os.ErrInvalid)
+	}
+	if a.writes != 1 || b.writes != 1 || a.closes != 1 || b.closes != 1 {
+		t.Errorf("MultiSink didn't write to and close every sink: %+v, %+v", a, b)
+	}
+}
@@ -0,0 +1,188 @@
+package scanner
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats describes the progress of a Scanner's current or last scan, counting
+// from when Scan or Follow was called.
+type Stats struct {
+	// How long the scan has been running for, or ran for.
+	Elapsed time.Duration
+	// Index the scan started at, and the size of the tree it is scanning
+	// up to, which grows as Follow finds new entries.
+	StartIndex int64
+	TreeSize   int64
+
+	// Number of entries and batches of entries fetched from the log.
+	EntriesFetched int64
+	BatchesFetched int64
+	// Number of attempts to fetch a batch which failed, including
+	// verification failures, and number of batches given up on.
+	FetchErrors   int64
+	FailedBatches int64
+	// Mean time taken to fetch a batch, excluding failed attempts.
+	MeanBatchLatency time.Duration
+
+	// Number of entries matched against, and number which matched.
+	EntriesProcessed int64
+	Matches          int64
+	PrecertsSeen     int64
+	// Number of entries which couldn't be parsed, and which parsed with
+	// non-fatal errors.
+	UnparsableEntries int64
+	NonFatalErrors    int64
+
+	// Entries fetched and processed per second.
+	FetchRate float64
+	MatchRate float64
+	// Estimated time until every entry up to TreeSize has been processed,
+	// at the current MatchRate, or zero if it can't be estimated.
+	ETA time.Duration
+}
+
+// scanStats holds the counters from which Stats are calculated.  The counters
+// are updated atomically, so that workers don't contend for a lock, and so
+// must stay at the start of the struct, which must be at the start of
+// Scanner, to be 64-bit aligned on 32-bit platforms.
+type scanStats struct {
+	certsProcessed            int64
+	precertsSeen              int64
+	unparsableEntries         int64
+	entriesWithNonFatalErrors int64
+	matches                   int64
+	entriesFetched            int64
+	batchesFetched            int64
+	batchLatency              int64 // Total, in nanoseconds
+	fetchErrors               int64
+	failedBatches             int64
+
+	mu         sync.Mutex
+	start      time.Time
+	end        time.Time // Zero while the scan is running
+	startIndex int64
+	treeSize   int64
+}
+
+// resetStats starts counting the statistics of a new scan from |startIndex|.
+func (s *Scanner) resetStats(startIndex int64) {
+	st := &s.stats
+	for _, c := range []*int64{&st.certsProcessed, &st.precertsSeen, &st.unparsableEntries,
+		&st.entriesWithNonFatalErrors, &st.matches, &st.entriesFetched, &st.batchesFetched,
+		&st.batchLatency, &st.fetchErrors, &st.failedBatches} {
+		atomic.StoreInt64(c, 0)
+	}
+	s.parseErrors.reset()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.start = time.Now()
+	st.end = time.Time{}
+	st.startIndex = startIndex
+	st.treeSize = startIndex
+}
+
+// setTreeSize records the size of the tree being scanned up to.
+func (s *Scanner) setTreeSize(treeSize int64) {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	s.stats.treeSize = treeSize
+}
+
+// stopStats records that the scan has finished.
+func (s *Scanner) stopStats() {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	s.stats.end = time.Now()
+}
+
+// Stats returns the statistics of the Scanner's current or last scan.  It may
+// be called while the scan is running.
+func (s *Scanner) Stats() Stats {
+	st := &s.stats
+	r := Stats{
+		EntriesFetched:    atomic.LoadInt64(&st.entriesFetched),
+		BatchesFetched:    atomic.LoadInt64(&st.batchesFetched),
+		FetchErrors:       atomic.LoadInt64(&st.fetchErrors),
+		FailedBatches:     atomic.LoadInt64(&st.failedBatches),
+		EntriesProcessed:  atomic.LoadInt64(&st.certsProcessed),
+		Matches:           atomic.LoadInt64(&st.matches),
+		PrecertsSeen:      atomic.LoadInt64(&st.precertsSeen),
+		UnparsableEntries: atomic.LoadInt64(&st.unparsableEntries),
+		NonFatalErrors:    atomic.LoadInt64(&st.entriesWithNonFatalErrors),
+	}
+	if r.BatchesFetched > 0 {
+		r.MeanBatchLatency = time.Duration(atomic.LoadInt64(&st.batchLatency) / r.BatchesFetched)
+	}
+	st.mu.Lock()
+	r.StartIndex, r.TreeSize = st.startIndex, st.treeSize
+	if !st.start.IsZero() {
+		end := st.end
+		if end.IsZero() {
+			end = time.Now()
+		}
+		r.Elapsed = end.Sub(st.start)
+	}
+	st.mu.Unlock()
+	if secs := r.Elapsed.Seconds(); secs > 0 {
+		r.FetchRate = float64(r.EntriesFetched) / secs
+		r.MatchRate = float64(r.EntriesProcessed) / secs
+	}
+	if remaining := r.TreeSize - r.StartIndex - r.EntriesProcessed; remaining > 0 && r.MatchRate > 0 {
+		r.ETA = time.Duration(float64(remaining) / r.MatchRate * float64(time.Second))
+	}
+	return r
+}
+
+// prometheusHandler serves a Scanner's Stats.
+type prometheusHandler struct {
+	s         *Scanner
+	namespace string
+}
+
+// NewPrometheusHandler returns a handler which serves the Stats of |s| in the
+// Prometheus text exposition format, e.g. at /metrics.  Metric names are
+// prefixed with |namespace|, e.g. "scanner".
+func NewPrometheusHandler(s *Scanner, namespace string) http.Handler {
+	return prometheusHandler{s: s, namespace: namespace}
+}
+
+func (h prometheusHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	st := h.s.Stats()
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, c := range []struct {
+		name string
+		v    int64
+	}{
+		{"entries_fetched", st.EntriesFetched},
+		{"batches_fetched", st.BatchesFetched},
+		{"fetch_errors", st.FetchErrors},
+		{"failed_batches", st.FailedBatches},
+		{"entries_processed", st.EntriesProcessed},
+		{"matches", st.Matches},
+		{"precerts_seen", st.PrecertsSeen},
+		{"unparsable_entries", st.UnparsableEntries},
+		{"non_fatal_errors", st.NonFatalErrors},
+	} {
+		n := h.namespace + "_" + c.name + "_total"
+		fmt.Fprintf(rw, "# TYPE %s counter\n%s %d\n", n, n, c.v)
+	}
+	for _, g := range []struct {
+		name string
+		v    float64
+	}{
+		{"start_index", float64(st.StartIndex)},
+		{"tree_size", float64(st.TreeSize)},
+		{"elapsed_seconds", st.Elapsed.Seconds()},
+		{"mean_batch_latency_seconds", st.MeanBatchLatency.Seconds()},
+		{"fetch_rate", st.FetchRate},
+		{"match_rate", st.MatchRate},
+		{"eta_seconds", st.ETA.Seconds()},
+	} {
+		n := h.namespace + "_" + g.name
+		fmt.Fprintf(rw, "# TYPE %s gauge\n%s %g\n", n, n, g.v)
+	}
+}
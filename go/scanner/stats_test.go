@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+)
+
+func TestScanStats(t *testing.T) {
+	l := newFaultyLog(t)
+	l.failures[1] = 2
+	l.failures[2] = -1
+	ts := httptest.NewServer(l)
+	defer ts.Close()
+	opts := ScannerOptions{
+		Matcher:          &MatchAll{},
+		BatchSize:        1,
+		NumWorkers:       1,
+		ParallelFetch:    2,
+		MaxFetchAttempts: 3,
+		FetchRetryDelay:  time.Millisecond,
+		Quiet:            true,
+	}
+	lc := client.NewWithOptions(ts.URL, client.Options{Backoff: &client.BackoffPolicy{Initial: time.Millisecond, MaxRetries: 1}})
+	s := NewScanner(lc, opts)
+	f := func(*ct.LogEntry) {}
+	if _, ok := s.Scan(f, f).(FetchError); !ok {
+		t.Fatalf("Scan() didn't return FetchError")
+	}
+
+	st := s.Stats()
+	for _, c := range []struct {
+		name      string
+		got, want int64
+	}{
+		{"StartIndex", st.StartIndex, 0},
+		{"TreeSize", st.TreeSize, 4},
+		{"EntriesFetched", st.EntriesFetched, 3},
+		{"BatchesFetched", st.BatchesFetched, 3},
+		{"FetchErrors", st.FetchErrors, 5},
+		{"FailedBatches", st.FailedBatches, 1},
+		{"EntriesProcessed", st.EntriesProcessed, 3},
+		{"Matches", st.Matches, 3},
+	} {
+		if c.got != c.want {
+			t.Errorf("Stats().%s=%d, want %d", c.name, c.got, c.want)
+		}
+	}
+	if st.Elapsed <= 0 || st.MeanBatchLatency <= 0 || st.FetchRate <= 0 || st.MatchRate <= 0 {
+		t.Errorf("Stats()=%+v, want positive durations and rates", st)
+	}
+	// One entry was never processed, so there is still time to go.
+	if st.ETA <= 0 {
+		t.Errorf("Stats().ETA=%v, want positive", st.ETA)
+	}
+	// The scan has finished, so its stats shouldn't change.
+	time.Sleep(10 * time.Millisecond)
+	if got := s.Stats(); got.Elapsed != st.Elapsed {
+		t.Errorf("Stats().Elapsed changed from %v to %v after Scan() returned", st.Elapsed, got.Elapsed)
+	}
+}
+
+func TestStatsETA(t *testing.T) {
+	var s Scanner
+	s.resetStats(100)
+	s.setTreeSize(400)
+	if st := s.Stats(); st.ETA != 0 {
+		t.Errorf("Stats().ETA=%v with nothing processed, want 0", st.ETA)
+	}
+	s.stats.mu.Lock()
+	s.stats.start = time.Now().Add(-10 * time.Second)
+	s.stats.end = s.stats.start.Add(10 * time.Second)
+	s.stats.mu.Unlock()
+	s.stats.certsProcessed = 100
+
+	st := s.Stats()
+	if st.MatchRate != 10 {
+		t.Errorf("Stats().MatchRate=%v, want 10", st.MatchRate)
+	}
+	if want := 20 * time.Second; st.ETA != want {
+		t.Errorf("Stats().ETA=%v, want %v", st.ETA, want)
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	var s Scanner
+	s.resetStats(0)
+	s.setTreeSize(10)
+	s.stats.matches = 3
+	rw := httptest.NewRecorder()
+	NewPrometheusHandler(&s, "ctscan").ServeHTTP(rw, httptest.NewRequest("GET", "/metrics", nil))
+	if got, want := rw.Header().Get("Content-Type"), "text/plain; version=0.0.4"; got != want {
+		t.Errorf("Content-Type=%q, want %q", got, want)
+	}
+	body := rw.Body.String()
+	for _, want := range []string{
+		"# TYPE ctscan_matches_total counter\nctscan_matches_total 3\n",
+		"# TYPE ctscan_tree_size gauge\nctscan_tree_size 10\n",
+		"# TYPE ctscan_eta_seconds gauge\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics=%q, want to contain %q", body, want)
+		}
+	}
+}
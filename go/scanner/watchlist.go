@@ -0,0 +1,198 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http/cookiejar"
+	"sort"
+	"strings"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/dnsnames"
+)
+
+// WatchlistOptions holds optional configuration for a Watchlist.
+type WatchlistOptions struct {
+	// If set, a name also matches a domain on the watchlist if they have
+	// the same registrable domain, i.e. the same label below their public
+	// suffix, so that watching example.co.uk catches login.example.co.uk
+	// and watching example.github.io doesn't catch other.github.io.
+	// golang.org/x/net/publicsuffix.List is the usual choice.
+	PublicSuffixList cookiejar.PublicSuffixList
+}
+
+// Alert reports that a certificate or precertificate has a name matching a
+// domain on a Watchlist.
+type Alert struct {
+	Entry *ct.LogEntry
+	// The name in the certificate, from its Subject Alternative Names or
+	// Common Name, as it appears there.
+	Name string
+	// The domain on the watchlist, as it appears there.
+	Watched string
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("entry %d has name %s, matching watched domain %s", a.Entry.Index, a.Name, a.Watched)
+}
+
+// Watchlist is an EntryMatcher which matches the certificates and
+// precertificates with names on a list of domains.  Names and domains are
+// compared in lower case, with internationalized labels in Punycode, so
+// domains may be listed in either form.
+//
+// A domain such as www.example.com on the list matches that name, and
+// wildcard names which cover it, such as *.example.com.  A domain such as
+// *.example.com on the list matches every name below example.com, including
+// wildcards, but not example.com itself.
+type Watchlist struct {
+	opts WatchlistOptions
+	// Each maps the normalized forms of domains on the list to the domains
+	// as they were listed.
+	exact     map[string]string
+	wildcards map[string]string // Keyed without the "*."
+	// The exactly listed domains, by their parent domains, for matching
+	// wildcard names.
+	byParent map[string][]string
+	// The registrable domains of all the domains on the list, if there is a
+	// public suffix list.
+	registrable map[string]string
+}
+
+// NewWatchlist returns a Watchlist of |domains|.
+func NewWatchlist(domains []string, opts WatchlistOptions) (*Watchlist, error) {
+	w := &Watchlist{
+		opts:        opts,
+		exact:       make(map[string]string),
+		wildcards:   make(map[string]string),
+		byParent:    make(map[string][]string),
+		registrable: make(map[string]string),
+	}
+	for _, d := range domains {
+		norm, err := dnsnames.Normalize(d)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(norm, "*.") {
+			w.wildcards[norm[2:]] = d
+		} else if strings.Contains(norm, "*") {
+			return nil, fmt.Errorf("wildcard not in first label of %q", d)
+		} else {
+			w.exact[norm] = d
+			if i := strings.IndexByte(norm, '.'); i >= 0 {
+				w.byParent[norm[i+1:]] = append(w.byParent[norm[i+1:]], d)
+			}
+		}
+		if r := w.registrableDomain(norm); r != "" {
+			w.registrable[r] = d
+		}
+	}
+	return w, nil
+}
+
+// LoadWatchlist reads a Watchlist from |r|, which lists one domain per line.
+// Blank lines, and anything after a "#", are ignored.
+func LoadWatchlist(r io.Reader, opts WatchlistOptions) (*Watchlist, error) {
+	var domains []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			domains = append(domains, line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return NewWatchlist(domains, opts)
+}
+
+// registrableDomain returns the registrable domain of a normalized name, or
+// "" if there is no public suffix list, or the name is a public suffix.
+func (w *Watchlist) registrableDomain(name string) string {
+	if w.opts.PublicSuffixList == nil {
+		return ""
+	}
+	d, err := dnsnames.RegistrableDomain(name, w.opts.PublicSuffixList)
+	if err != nil {
+		return ""
+	}
+	return d
+}
+
+// matches returns the watched domains which a normalized name matches.
+func (w *Watchlist) matches(name string) []string {
+	var watched []string
+	if d, ok := w.exact[name]; ok {
+		watched = append(watched, d)
+	}
+	// Names below a listed wildcard.
+	for parent := name; ; {
+		i := strings.IndexByte(parent, '.')
+		if i < 0 {
+			break
+		}
+		parent = parent[i+1:]
+		if d, ok := w.wildcards[parent]; ok {
+			watched = append(watched, d)
+		}
+	}
+	// Wildcard names covering listed domains.
+	if strings.HasPrefix(name, "*.") {
+		watched = append(watched, w.byParent[name[2:]]...)
+	}
+	if r := w.registrableDomain(name); r != "" {
+		if d, ok := w.registrable[r]; ok {
+			watched = append(watched, d)
+		}
+	}
+	return watched
+}
+
+// Alerts returns an Alert for each pair of a name of |entry|'s certificate or
+// precertificate and a watched domain which it matches.
+func (w *Watchlist) Alerts(entry *ct.LogEntry) []Alert {
+	c := entry.Certificate()
+	if c == nil {
+		return nil
+	}
+	var alerts []Alert
+	seen := make(map[[2]string]bool)
+	names := append([]string{c.Subject.CommonName}, c.DNSNames...)
+	for _, name := range names {
+		norm, err := dnsnames.Normalize(name)
+		if err != nil {
+			// Not a domain name, e.g. a Common Name which is
+			// something else.
+			continue
+		}
+		for _, d := range w.matches(norm) {
+			if key := [2]string{norm, d}; !seen[key] {
+				seen[key] = true
+				alerts = append(alerts, Alert{Entry: entry, Name: name, Watched: d})
+			}
+		}
+	}
+	return alerts
+}
+
+// EntryMatches implements EntryMatcher.
+func (w *Watchlist) EntryMatches(entry *ct.LogEntry) bool {
+	return len(w.Alerts(entry)) > 0
+}
+
+func (w *Watchlist) String() string {
+	var domains []string
+	for _, d := range w.exact {
+		domains = append(domains, d)
+	}
+	for _, d := range w.wildcards {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+	return fmt.Sprintf("Watchlist(%s, registrable=%t)", strings.Join(domains, " "), w.opts.PublicSuffixList != nil)
+}
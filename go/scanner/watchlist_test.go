@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// fakePSL is a public suffix list of the suffixes in it.
+type fakePSL map[string]bool
+
+func (l fakePSL) PublicSuffix(domain string) string {
+	for d := domain; ; {
+		if l[d] {
+			return d
+		}
+		i := strings.IndexByte(d, '.')
+		if i < 0 {
+			return d
+		}
+		d = d[i+1:]
+	}
+}
+
+func (l fakePSL) String() string { return "fake" }
+
+func watchEntry(cn string, names ...string) *ct.LogEntry {
+	return &ct.LogEntry{X509Cert: &x509.Certificate{Subject: pkix.Name{CommonName: cn}, DNSNames: names}}
+}
+
+func TestWatchlistAlerts(t *testing.T) {
+	const list = `
+# Our domains
+www.example.com
+*.example.org  # Everything under example.org
+bücher.example
+`
+	w, err := LoadWatchlist(strings.NewReader(list), WatchlistOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range []struct {
+		entry *ct.LogEntry
+		want  [][2]string // Name and watched domain of each alert
+	}{
+		{watchEntry("www.example.com"), [][2]string{{"www.example.com", "www.example.com"}}},
+		{watchEntry("Example Inc", "WWW.Example.com."), [][2]string{{"WWW.Example.com.", "www.example.com"}}},
+		{watchEntry("", "example.com", "mail.example.com"), nil},
+		// Wildcards covering watched names.
+		{watchEntry("", "*.example.com"), [][2]string{{"*.example.com", "www.example.com"}}},
+		{watchEntry("", "*.com"), nil},
+		// Names under watched wildcards.
+		{watchEntry("", "a.b.example.org", "*.example.org"), [][2]string{{"a.b.example.org", "*.example.org"}, {"*.example.org", "*.example.org"}}},
+		{watchEntry("", "example.org"), nil},
+		{watchEntry("", "xn--bcher-kva.example"), [][2]string{{"xn--bcher-kva.example", "bücher.example"}}},
+		// Duplicate names alert once.
+		{watchEntry("www.example.com", "www.example.com"), [][2]string{{"www.example.com", "www.example.com"}}},
+		{&ct.LogEntry{}, nil},
+	} {
+		var got [][2]string
+		for _, a := range w.Alerts(test.entry) {
+			got = append(got, [2]string{a.Name, a.Watched})
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("#%d: Alerts()=%v, want %v", i, got, test.want)
+		}
+		if w.EntryMatches(test.entry) != (len(test.want) > 0) {
+			t.Errorf("#%d: EntryMatches()=%v, want %v", i, !(len(test.want) > 0), len(test.want) > 0)
+		}
+	}
+}
+
+func TestWatchlistRegistrableDomains(t *testing.T) {
+	psl := fakePSL{"com": true, "uk": true, "co.uk": true, "github.io": true}
+	w, err := NewWatchlist([]string{"example.co.uk", "example.github.io"}, WatchlistOptions{PublicSuffixList: psl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range []struct {
+		name string
+		want bool
+	}{
+		{"example.co.uk", true},
+		{"login.example.co.uk", true},
+		{"*.login.example.co.uk", true},
+		{"other.co.uk", false},
+		{"co.uk", false},
+		{"a.example.github.io", true},
+		{"other.github.io", false},
+	} {
+		if got := w.EntryMatches(watchEntry("", test.name)); got != test.want {
+			t.Errorf("#%d: EntryMatches(%s)=%v, want %v", i, test.name, got, test.want)
+		}
+	}
+}
+
+func TestNewWatchlistErrors(t *testing.T) {
+	for _, domains := range [][]string{{"a.*.example.com"}, {"bad domain"}, {"."}} {
+		if _, err := NewWatchlist(domains, WatchlistOptions{}); err == nil {
+			t.Errorf("NewWatchlist(%q)=_,nil, want error", domains)
+		}
+	}
+}
+
+func TestWatchlistDescriptionIsStable(t *testing.T) {
+	domains := []string{"a.example.com", "b.example.com", "*.c.example.com", "d.example.com"}
+	w1, _ := NewWatchlist(domains, WatchlistOptions{})
+	w2, _ := NewWatchlist([]string{domains[3], domains[2], domains[1], domains[0]}, WatchlistOptions{})
+	if a, b := matcherHash(&ScannerOptions{EntryMatcher: w1}), matcherHash(&ScannerOptions{EntryMatcher: w2}); a != b {
+		t.Errorf("matcherHash() of the same watchlist differ: %s, %s", a, b)
+	}
+}
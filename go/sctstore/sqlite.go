@@ -0,0 +1,101 @@
+package sctstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+
+	"github.com/google/certificate-transparency/go"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sctSchema = `
+        CREATE TABLE IF NOT EXISTS scts (
+                cert_sha256     BYTES NOT NULL,
+                log_id          BYTES NOT NULL,
+                timestamp       INTEGER NOT NULL,
+                sct             BYTES NOT NULL,
+                log_url         STRING NOT NULL,
+                source          STRING NOT NULL,
+                PRIMARY KEY (cert_sha256, log_id)
+        );`
+
+const insertSCT = `INSERT OR IGNORE INTO scts(cert_sha256, log_id, timestamp, sct, log_url, source) VALUES ($1, $2, $3, $4, $5, $6);`
+const selectSCTs = `SELECT sct, log_url, source FROM scts WHERE cert_sha256 = $1 ORDER BY timestamp;`
+
+// SQLiteStore is a Store which keeps Records in the scts table of an SQLite3
+// database, e.g. one shared with other tools' state.  The table's primary
+// key, of certificate hash and log ID, indexes it by certificate.
+type SQLiteStore struct {
+	db         *sql.DB
+	insertSCT  *sql.Stmt
+	selectSCTs *sql.Stmt
+}
+
+// NewSQLiteStore opens the SQLite3 database at dbPath, creating it and its
+// scts table if they don't exist.
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	if len(dbPath) == 0 {
+		return nil, errors.New("empty database file name")
+	}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLiteStore{db: db}
+	if _, err := db.Exec(sctSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if s.insertSCT, err = db.Prepare(insertSCT); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if s.selectSCTs, err = db.Prepare(selectSCTs); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close implements Store.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Put implements Store.
+func (s *SQLiteStore) Put(r Record) error {
+	b, err := ct.SerializeSCT(r.SCT)
+	if err != nil {
+		return err
+	}
+	_, err = s.insertSCT.Exec(r.CertSHA256[:], r.SCT.LogID[:], int64(r.SCT.Timestamp), b, r.LogURL, string(r.Source))
+	return err
+}
+
+// Get implements Store.
+func (s *SQLiteStore) Get(certSHA256 [sha256.Size]byte) ([]Record, error) {
+	rows, err := s.selectSCTs.Query(certSHA256[:])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []Record
+	for rows.Next() {
+		var b []byte
+		var source string
+		r := Record{CertSHA256: certSHA256}
+		if err := rows.Scan(&b, &r.LogURL, &source); err != nil {
+			return nil, err
+		}
+		sct, err := ct.DeserializeSCT(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		r.SCT = *sct
+		r.Source = Source(source)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,194 @@
+// Package sctstore keeps the SCTs obtained for certificates, from submitting
+// them to logs or from finding them embedded in certificates while scanning,
+// so that tools can ask which logs they already have SCTs from for a
+// certificate.
+package sctstore
+
+import (
+	"crypto/sha256"
+	"sort"
+	"sync"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/sctverify"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// Source is how an SCT was obtained.
+type Source string
+
+// SCT sources.
+const (
+	// The SCT was returned by the log when the certificate, or its
+	// precertificate, was submitted to it.
+	FromSubmission Source = "submission"
+	// The SCT was embedded in a certificate found by scanning a log.
+	FromScan Source = "scan"
+)
+
+// Record is an SCT stored for a certificate.
+type Record struct {
+	// The SHA-256 hash of the DER certificate, or precertificate, the SCT
+	// is for, as CertHash returns.
+	CertSHA256 [sha256.Size]byte
+	SCT        ct.SignedCertificateTimestamp
+	// The URL of the log which issued the SCT, if known.
+	LogURL string
+	Source Source
+}
+
+// CertHash returns the SHA-256 hash of der, by which Records are keyed.
+func CertHash(der []byte) [sha256.Size]byte {
+	return sha256.Sum256(der)
+}
+
+// Store keeps Records, keyed by certificate hash and log ID.  Implementations
+// must be safe for concurrent use.
+type Store interface {
+	// Put stores r, unless there's already a Record for its certificate
+	// from its SCT's log, which is kept.
+	Put(r Record) error
+	// Get returns the Records for the certificate with hash certSHA256,
+	// ordered by their SCTs' timestamps.
+	Get(certSHA256 [sha256.Size]byte) ([]Record, error)
+	Close() error
+}
+
+// LogIDs returns the IDs of the logs with SCTs in s for the certificate with
+// hash certSHA256.
+func LogIDs(s Store, certSHA256 [sha256.Size]byte) ([]ct.SHA256Hash, error) {
+	records, err := s.Get(certSHA256)
+	if err != nil {
+		return nil, err
+	}
+	var ids []ct.SHA256Hash
+	for _, r := range records {
+		ids = append(ids, r.SCT.LogID)
+	}
+	return ids, nil
+}
+
+// PutSubmission stores the SCTs that submitting the certificate, or
+// precertificate, der to logs obtained.
+func PutSubmission(s Store, der []byte, scts []client.LoggedSCT) error {
+	hash := CertHash(der)
+	for _, l := range scts {
+		r := Record{CertSHA256: hash, SCT: *l.SCT, Source: FromSubmission}
+		if l.Log != nil {
+			r.LogURL = l.Log.URL
+		}
+		if err := s.Put(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutEmbedded stores the SCTs embedded in cert, e.g. as found by scanning a
+// log.  The SCTs are for the precertificate cert was issued from, but are
+// stored under cert's own hash, since that's what they are delivered with.
+func PutEmbedded(s Store, cert *x509.Certificate) error {
+	scts, err := sctverify.EmbeddedSCTs(cert)
+	if err != nil {
+		return err
+	}
+	hash := CertHash(cert.Raw)
+	for _, sct := range scts {
+		if err := s.Put(Record{CertSHA256: hash, SCT: sct, Source: FromScan}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MultiLog is a client.MultiLog which stores the SCTs it obtains, including
+// those from submissions which failed to satisfy its quorum.
+type MultiLog struct {
+	*client.MultiLog
+	store Store
+}
+
+// NewMultiLog returns a MultiLog which submits with m and stores the SCTs in
+// s.
+func NewMultiLog(m *client.MultiLog, s Store) *MultiLog {
+	return &MultiLog{MultiLog: m, store: s}
+}
+
+// AddChain is client.MultiLog.AddChain, storing the SCTs obtained for the
+// chain's leaf.  Failing to store them fails the submission.
+func (m *MultiLog) AddChain(ctx context.Context, chain []ct.ASN1Cert) ([]client.LoggedSCT, error) {
+	scts, err := m.MultiLog.AddChain(ctx, chain)
+	return m.put(chain, scts, err)
+}
+
+// AddPreChain is client.MultiLog.AddPreChain, storing the SCTs obtained for
+// the precertificate.
+func (m *MultiLog) AddPreChain(ctx context.Context, chain []ct.ASN1Cert) ([]client.LoggedSCT, error) {
+	scts, err := m.MultiLog.AddPreChain(ctx, chain)
+	return m.put(chain, scts, err)
+}
+
+func (m *MultiLog) put(chain []ct.ASN1Cert, scts []client.LoggedSCT, err error) ([]client.LoggedSCT, error) {
+	if len(chain) == 0 {
+		return scts, err
+	}
+	obtained := scts
+	if qe, ok := err.(client.QuorumError); ok {
+		obtained = qe.SCTs
+	}
+	if putErr := PutSubmission(m.store, chain[0], obtained); putErr != nil && err == nil {
+		return scts, putErr
+	}
+	return scts, err
+}
+
+// MemoryStore is a Store which keeps Records in memory.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[[sha256.Size]byte]map[ct.SHA256Hash]Record
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[[sha256.Size]byte]map[ct.SHA256Hash]Record)}
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byLog, ok := s.records[r.CertSHA256]
+	if !ok {
+		byLog = make(map[ct.SHA256Hash]Record)
+		s.records[r.CertSHA256] = byLog
+	}
+	if _, ok := byLog[r.SCT.LogID]; !ok {
+		byLog[r.SCT.LogID] = r
+	}
+	return nil
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(certSHA256 [sha256.Size]byte) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var records []Record
+	for _, r := range s.records[certSHA256] {
+		records = append(records, r)
+	}
+	sort.Sort(byTimestamp(records))
+	return records, nil
+}
+
+// Close implements Store.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+type byTimestamp []Record
+
+func (b byTimestamp) Len() int           { return len(b) }
+func (b byTimestamp) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byTimestamp) Less(i, j int) bool { return b[i].SCT.Timestamp < b[j].SCT.Timestamp }
@@ -0,0 +1,211 @@
+package sctstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"database/sql"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/testlog"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+	"golang.org/x/net/context"
+)
+
+// testCerts returns a root, and a template and key for certificates issued
+// by it.
+func testCerts(t *testing.T) (*testcert.CA, *x509.Certificate, *ecdsa.PrivateKey) {
+	return testcert.NewCA(t, "Test Root", nil), testcert.LeafTemplate("leaf.example.com"), testcert.NewKey(t)
+}
+
+func testSCT(t *testing.T, l *testlog.Log) ct.SignedCertificateTimestamp {
+	root, tmpl, key := testCerts(t)
+	der := testcert.Issue(t, tmpl, key, root).Raw
+	sct, err := l.AddChain([]ct.ASN1Cert{der, root.Cert.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *sct
+}
+
+// sqliteAvailable reports whether the SQLite3 driver is usable, which it
+// isn't in builds without cgo.
+func sqliteAvailable() bool {
+	for _, d := range sql.Drivers() {
+		if d == "sqlite3" {
+			return true
+		}
+	}
+	return false
+}
+
+func testStores(t *testing.T, dir string) map[string]Store {
+	stores := map[string]Store{"MemoryStore": NewMemoryStore()}
+	if !sqliteAvailable() {
+		t.Log("SQLite3 driver unavailable; not testing SQLiteStore")
+		return stores
+	}
+	s, err := NewSQLiteStore(filepath.Join(dir, "scts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores["SQLiteStore"] = s
+	return stores
+}
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sctstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	var logs []*testlog.Log
+	for i := 0; i < 2; i++ {
+		// The second log's SCTs are the earlier ones.
+		l, err := testlog.New(testlog.Options{Now: testlog.SteppingClock(start.Add(time.Duration(1-i)*time.Hour), time.Minute)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, l)
+	}
+	cert, other := CertHash([]byte("cert")), CertHash([]byte("other"))
+	first := Record{CertSHA256: cert, SCT: testSCT(t, logs[0]), LogURL: "https://log0.example.com", Source: FromSubmission}
+	second := Record{CertSHA256: cert, SCT: testSCT(t, logs[1]), Source: FromScan}
+	replacement := Record{CertSHA256: cert, SCT: testSCT(t, logs[0]), LogURL: "https://log0.example.com", Source: FromScan}
+
+	for name, s := range testStores(t, dir) {
+		for _, r := range []Record{first, second, replacement} {
+			if err := s.Put(r); err != nil {
+				t.Errorf("%s: Put()=%v", name, err)
+			}
+		}
+		got, err := s.Get(cert)
+		if err != nil {
+			t.Errorf("%s: Get()=_,%v", name, err)
+			continue
+		}
+		if want := []Record{second, first}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Get()=%+v, want %+v", name, got, want)
+		}
+		ids, err := LogIDs(s, cert)
+		if err != nil {
+			t.Errorf("%s: LogIDs()=_,%v", name, err)
+		}
+		if want := []ct.SHA256Hash{logs[1].LogID(), logs[0].LogID()}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("%s: LogIDs()=%v, want %v", name, ids, want)
+		}
+		if got, err := s.Get(other); err != nil || len(got) != 0 {
+			t.Errorf("%s: Get(other cert)=%v,%v, want no records", name, got, err)
+		}
+		if err := s.Close(); err != nil {
+			t.Errorf("%s: Close()=%v", name, err)
+		}
+	}
+
+	// The SQLiteStore persists its records.
+	if !sqliteAvailable() {
+		return
+	}
+	s, err := NewSQLiteStore(filepath.Join(dir, "scts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got, err := s.Get(cert); err != nil || len(got) != 2 {
+		t.Errorf("Get() after reopening=%v,%v, want 2 records", got, err)
+	}
+}
+
+func TestPutEmbedded(t *testing.T) {
+	l, err := testlog.New(testlog.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, tmpl, key := testCerts(t)
+	precert, err := client.CreatePrecertificate(rand.Reader, tmpl, root.Cert, &key.PublicKey, root.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct, err := l.AddPreChain([]ct.ASN1Cert{precert, root.Cert.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := ct.SerializeSCTList([]ct.SignedCertificateTimestamp{*sct})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := x509.NewSCTListExtension(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.ExtraExtensions = []pkix.Extension{ext}
+	cert := testcert.Issue(t, tmpl, key, root)
+	der := cert.Raw
+
+	s := NewMemoryStore()
+	if err := PutEmbedded(s, cert); err != nil {
+		t.Fatalf("PutEmbedded()=%v", err)
+	}
+	if err := PutEmbedded(s, root.Cert); err != nil {
+		t.Errorf("PutEmbedded(cert without SCTs)=%v", err)
+	}
+	got, err := s.Get(CertHash(der))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].SCT.LogID != l.LogID() || got[0].Source != FromScan {
+		t.Errorf("Get()=%+v, want the embedded SCT from a scan", got)
+	}
+}
+
+func TestMultiLog(t *testing.T) {
+	var logs []client.LogInfo
+	var ids []ct.SHA256Hash
+	for i := 0; i < 2; i++ {
+		l, err := testlog.New(testlog.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hs := httptest.NewServer(l)
+		defer hs.Close()
+		logs = append(logs, client.LogInfo{URL: hs.URL, PublicKey: l.PublicKey()})
+		ids = append(ids, l.LogID())
+	}
+	ml, err := client.NewMultiLog(logs, client.MultiLogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewMemoryStore()
+	m := NewMultiLog(ml, s)
+	root, tmpl, key := testCerts(t)
+	der := testcert.Issue(t, tmpl, key, root).Raw
+	scts, err := m.AddChain(context.Background(), []ct.ASN1Cert{der, root.Cert.Raw})
+	if err != nil {
+		t.Fatalf("AddChain()=_,%v", err)
+	}
+	got, err := s.Get(CertHash(der))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(scts) || len(got) != 2 {
+		t.Fatalf("stored %d SCTs, want the %d obtained", len(got), len(scts))
+	}
+	for _, r := range got {
+		if r.Source != FromSubmission || r.LogURL == "" {
+			t.Errorf("stored %+v, want a submission with its log's URL", r)
+		}
+		if r.SCT.LogID != ids[0] && r.SCT.LogID != ids[1] {
+			t.Errorf("stored SCT from unknown log %s", r.SCT.LogID.Base64String())
+		}
+	}
+}
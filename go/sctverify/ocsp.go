@@ -0,0 +1,167 @@
+package sctverify
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/revocation"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+var (
+	oidOCSPBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidOCSPSCTList       = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 5}
+)
+
+// OCSP structures from RFC 6960 section 4.2.1.  Only the parts needed to
+// find the single responses are included.
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspResponse struct {
+	Status        asn1.Enumerated
+	ResponseBytes ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+// OCSPSCTs returns the SCTs in the DER encoded OCSP response, such as one
+// stapled in a TLS handshake.  SCTs are carried in an extension of each of
+// the response's SingleResponses; the SCTs in all of them are returned.  The
+// response's signature isn't checked, and an unsuccessful response has no
+// SCTs.  CertOCSPSCTs returns only those for a given certificate.
+func OCSPSCTs(der []byte) ([]ct.SignedCertificateTimestamp, error) {
+	responses, err := ocspSingleResponses(der)
+	if err != nil {
+		return nil, err
+	}
+	var scts []ct.SignedCertificateTimestamp
+	for _, r := range responses {
+		scts = append(scts, r.scts...)
+	}
+	return scts, nil
+}
+
+// OCSPVerifier checks the DER encoded OCSP response |der| before the SCTs in
+// it are used for |cert|, which |issuer| issued, e.g. that it is current and
+// that the issuer signed it.  revocation.VerifyOCSPResponse is one.
+type OCSPVerifier func(der []byte, cert, issuer *x509.Certificate) error
+
+// CertOCSPSCTs returns the SCTs in the DER encoded OCSP response which are
+// for cert, which issuer issued: those in the SingleResponse whose CertID
+// identifies cert (RFC6962 section 3.3).  If verify is non-nil, it is called
+// on the response first, and its error, if any, is returned instead of the
+// SCTs.  Like OCSPSCTs, it returns no SCTs for an unsuccessful response.
+func CertOCSPSCTs(der []byte, cert, issuer *x509.Certificate, verify OCSPVerifier) ([]ct.SignedCertificateTimestamp, error) {
+	responses, err := ocspSingleResponses(der)
+	if err != nil || len(responses) == 0 {
+		return nil, err
+	}
+	if verify != nil {
+		if err := verify(der, cert, issuer); err != nil {
+			return nil, fmt.Errorf("OCSP response doesn't verify: %v", err)
+		}
+	}
+	var scts []ct.SignedCertificateTimestamp
+	for _, r := range responses {
+		ok, err := r.certID.Identifies(cert, issuer)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			scts = append(scts, r.scts...)
+		}
+	}
+	return scts, nil
+}
+
+// ocspSingleResponse is a SingleResponse of an OCSP response, and the SCTs its
+// extensions carry.
+type ocspSingleResponse struct {
+	certID revocation.OCSPCertID
+	scts   []ct.SignedCertificateTimestamp
+}
+
+// ocspSingleResponses returns the SingleResponses of the DER encoded OCSP
+// response, or none if it is unsuccessful.
+func ocspSingleResponses(der []byte) ([]ocspSingleResponse, error) {
+	var resp ocspResponse
+	if _, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status != 0 {
+		return nil, nil
+	}
+	if !resp.ResponseBytes.ResponseType.Equal(oidOCSPBasicResponse) {
+		return nil, errors.New("OCSP response isn't a basic response")
+	}
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(resp.ResponseBytes.Response, &basic); err != nil {
+		return nil, err
+	}
+
+	// ResponseData is walked element by element, as its optional tagged
+	// fields can't be matched by the asn1 package.  Its responses are the
+	// only universal SEQUENCE in it.
+	fields, err := asn1.ReadElements(basic.TBSResponseData.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	var responses []asn1.RawValue
+	for _, f := range fields {
+		if f.Class == asn1.ClassUniversal && f.Tag == asn1.TagSequence {
+			if responses, err = asn1.ReadElements(f.Bytes); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	var singles []ocspSingleResponse
+	for _, r := range responses {
+		fields, err := asn1.ReadElements(r.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			return nil, errors.New("empty SingleResponse")
+		}
+		var single ocspSingleResponse
+		if _, err := asn1.Unmarshal(fields[0].FullBytes, &single.certID); err != nil {
+			return nil, fmt.Errorf("malformed CertID: %v", err)
+		}
+		// certID, certStatus and thisUpdate are followed by the optional
+		// nextUpdate [0] and singleExtensions [1].
+		for i, f := range fields {
+			if i < 3 || f.Class != asn1.ClassContextSpecific || f.Tag != 1 {
+				continue
+			}
+			var exts []pkix.Extension
+			if _, err := asn1.Unmarshal(f.Bytes, &exts); err != nil {
+				return nil, err
+			}
+			for _, e := range exts {
+				if !e.Id.Equal(oidOCSPSCTList) {
+					continue
+				}
+				s, err := ParseSCTListExtension(e.Value)
+				if err != nil {
+					return nil, err
+				}
+				single.scts = append(single.scts, s...)
+			}
+		}
+		singles = append(singles, single)
+	}
+	return singles, nil
+}
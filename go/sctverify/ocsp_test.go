@@ -0,0 +1,214 @@
+package sctverify
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/loglist"
+	"github.com/google/certificate-transparency/go/revocation"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// raw returns the DER of an element with the given class and tag, and the
+// concatenated contents.
+func raw(t *testing.T, class, tag int, compound bool, contents ...[]byte) []byte {
+	var b []byte
+	for _, c := range contents {
+		b = append(b, c...)
+	}
+	return mustMarshal(t, asn1.RawValue{Class: class, Tag: tag, IsCompound: compound, Bytes: b})
+}
+
+// ocspResponseWithSCTs returns an OCSP response with a SingleResponse
+// carrying each of the SCT lists, or no extensions if a list is nil.
+func ocspResponseWithSCTs(t *testing.T, lists ...[]ct.SignedCertificateTimestamp) []byte {
+	dummy := revocation.OCSPCertID{
+		HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}},
+		IssuerNameHash: make([]byte, 20),
+		IssuerKeyHash:  make([]byte, 20),
+		SerialNumber:   big.NewInt(1),
+	}
+	ids := make([]revocation.OCSPCertID, len(lists))
+	for i := range ids {
+		ids[i] = dummy
+	}
+	return ocspResponseFor(t, ids, lists)
+}
+
+// ocspResponseFor returns an OCSP response with a SingleResponse for each of
+// the CertIDs, carrying the corresponding SCT list.
+func ocspResponseFor(t *testing.T, ids []revocation.OCSPCertID, lists [][]ct.SignedCertificateTimestamp) []byte {
+	good := raw(t, asn1.ClassContextSpecific, 0, false)
+	when := raw(t, asn1.ClassUniversal, 24, false, []byte("20160301000000Z"))
+
+	var responses [][]byte
+	for i, scts := range lists {
+		certID := mustMarshal(t, ids[i])
+		// The revoked status is [1] too.
+		single := [][]byte{certID, good, when, raw(t, asn1.ClassContextSpecific, 0, true, when)}
+		if scts != nil {
+			list, err := ct.SerializeSCTList(scts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			exts := mustMarshal(t, []pkix.Extension{
+				{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}, Value: []byte{0x04, 0x00}},
+				{Id: oidOCSPSCTList, Value: mustMarshal(t, list)},
+			})
+			single = append(single, raw(t, asn1.ClassContextSpecific, 1, true, exts))
+		}
+		responses = append(responses, raw(t, asn1.ClassUniversal, asn1.TagSequence, true, single...))
+	}
+	tbs := raw(t, asn1.ClassUniversal, asn1.TagSequence, true,
+		raw(t, asn1.ClassContextSpecific, 2, true, mustMarshal(t, make([]byte, 20))),
+		when,
+		raw(t, asn1.ClassUniversal, asn1.TagSequence, true, responses...))
+	basic := raw(t, asn1.ClassUniversal, asn1.TagSequence, true,
+		tbs,
+		mustMarshal(t, pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}}),
+		mustMarshal(t, asn1.BitString{Bytes: []byte("sig"), BitLength: 24}))
+	return mustMarshal(t, ocspResponse{
+		ResponseBytes: ocspResponseBytes{ResponseType: oidOCSPBasicResponse, Response: basic},
+	})
+}
+
+func TestOCSPSCTs(t *testing.T) {
+	s := setup(t)
+	other := s.tlsSCT
+	other.Timestamp++
+	tests := []struct {
+		der  []byte
+		want int
+	}{
+		{ocspResponseWithSCTs(t, []ct.SignedCertificateTimestamp{s.tlsSCT}), 1},
+		{ocspResponseWithSCTs(t, []ct.SignedCertificateTimestamp{s.tlsSCT, other}, nil, []ct.SignedCertificateTimestamp{other}), 3},
+		{ocspResponseWithSCTs(t, nil), 0},
+		// tryLater
+		{mustMarshal(t, struct{ Status asn1.Enumerated }{3}), 0},
+	}
+	for i, test := range tests {
+		scts, err := OCSPSCTs(test.der)
+		if err != nil {
+			t.Errorf("#%d: OCSPSCTs()=_,%v", i, err)
+			continue
+		}
+		if len(scts) != test.want {
+			t.Errorf("#%d: got %d SCTs, want %d", i, len(scts), test.want)
+		}
+	}
+
+	scts, err := OCSPSCTs(ocspResponseWithSCTs(t, []ct.SignedCertificateTimestamp{s.tlsSCT}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct := scts[0]
+	s.log.State = states(loglist.UsableStatus, sctTime)
+	results := VerifySCTs(s.cert, []*x509.Certificate{s.issuer}, []DeliveredSCT{{SCT: &sct, Source: OCSPResponse}}, s.list, sctTime)
+	if results[0].Err != nil {
+		t.Errorf("SCT from OCSP response doesn't verify: %v", results[0].Err)
+	}
+
+	if _, err := OCSPSCTs([]byte("garbage")); err == nil {
+		t.Error("OCSPSCTs(garbage)=_,nil, want error")
+	}
+}
+
+// certIDFor returns the CertID of |cert|, issued by |issuer|, using the hash
+// |h|, which is identified by |oid|.
+func certIDFor(t *testing.T, cert, issuer *x509.Certificate, oid asn1.ObjectIdentifier, h crypto.Hash) revocation.OCSPCertID {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		t.Fatal(err)
+	}
+	nameHash, keyHash := h.New(), h.New()
+	nameHash.Write(issuer.RawSubject)
+	keyHash.Write(spki.PublicKey.RightAlign())
+	return revocation.OCSPCertID{
+		HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: oid},
+		IssuerNameHash: nameHash.Sum(nil),
+		IssuerKeyHash:  keyHash.Sum(nil),
+		SerialNumber:   cert.SerialNumber,
+	}
+}
+
+func TestCertOCSPSCTs(t *testing.T) {
+	s := setup(t)
+	other := s.tlsSCT
+	other.Timestamp++
+	sha1ID := certIDFor(t, s.cert, s.issuer, asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, crypto.SHA1)
+	sha256ID := certIDFor(t, s.cert, s.issuer, asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, crypto.SHA256)
+	otherSerial := sha1ID
+	otherSerial.SerialNumber = big.NewInt(3)
+	otherIssuer := certIDFor(t, s.cert, s.cert, asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, crypto.SHA1)
+	unknownHash := sha1ID
+	unknownHash.HashAlgorithm.Algorithm = asn1.ObjectIdentifier{1, 2, 3}
+
+	for i, test := range []struct {
+		ids  []revocation.OCSPCertID
+		want int
+	}{
+		{[]revocation.OCSPCertID{sha1ID}, 1},
+		{[]revocation.OCSPCertID{sha256ID}, 1},
+		{[]revocation.OCSPCertID{otherSerial, sha1ID}, 1},
+		{[]revocation.OCSPCertID{otherSerial}, 0},
+		{[]revocation.OCSPCertID{otherIssuer}, 0},
+		{[]revocation.OCSPCertID{unknownHash}, 0},
+	} {
+		lists := make([][]ct.SignedCertificateTimestamp, len(test.ids))
+		for j, id := range test.ids {
+			lists[j] = []ct.SignedCertificateTimestamp{other}
+			if reflect.DeepEqual(id, sha1ID) || reflect.DeepEqual(id, sha256ID) {
+				lists[j] = []ct.SignedCertificateTimestamp{s.tlsSCT}
+			}
+		}
+		scts, err := CertOCSPSCTs(ocspResponseFor(t, test.ids, lists), s.cert, s.issuer, nil)
+		if err != nil {
+			t.Errorf("#%d: CertOCSPSCTs()=_,%v", i, err)
+			continue
+		}
+		if len(scts) != test.want {
+			t.Errorf("#%d: got %d SCTs, want %d", i, len(scts), test.want)
+		}
+		for _, sct := range scts {
+			if sct.Timestamp != s.tlsSCT.Timestamp {
+				t.Errorf("#%d: got the SCT of another certificate", i)
+			}
+		}
+	}
+
+	der := ocspResponseFor(t, []revocation.OCSPCertID{sha1ID}, [][]ct.SignedCertificateTimestamp{{s.tlsSCT}})
+	var called bool
+	verify := func(gotDER []byte, cert, issuer *x509.Certificate) error {
+		called = true
+		if !bytes.Equal(gotDER, der) || cert != s.cert || issuer != s.issuer {
+			t.Error("verifier called with the wrong arguments")
+		}
+		return errors.New("bad signature")
+	}
+	if scts, err := CertOCSPSCTs(der, s.cert, s.issuer, verify); err == nil || len(scts) != 0 || !called {
+		t.Errorf("CertOCSPSCTs(failing verifier)=%d SCTs,%v, want error", len(scts), err)
+	}
+	called = false
+	tryLater := mustMarshal(t, struct{ Status asn1.Enumerated }{3})
+	if scts, err := CertOCSPSCTs(tryLater, s.cert, s.issuer, verify); err != nil || len(scts) != 0 || called {
+		t.Errorf("CertOCSPSCTs(tryLater)=%d SCTs,%v, want none without verifying", len(scts), err)
+	}
+}
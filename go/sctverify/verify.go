@@ -0,0 +1,219 @@
+// Package sctverify verifies the SCTs served with a certificate, however
+// they were delivered, against a list of known logs.
+package sctverify
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/loglist"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// Source is how an SCT was delivered with a certificate (RFC6962 section
+// 3.3).
+type Source int
+
+// SCT sources.
+const (
+	// In the signed_certificate_timestamp TLS extension.
+	TLSExtension Source = iota
+	// In an extension of a stapled OCSP response.
+	OCSPResponse
+	// In an extension of the certificate itself.
+	Embedded
+)
+
+func (s Source) String() string {
+	switch s {
+	case TLSExtension:
+		return "TLS extension"
+	case OCSPResponse:
+		return "OCSP response"
+	case Embedded:
+		return "embedded"
+	}
+	return fmt.Sprintf("Source %d", s)
+}
+
+// DeliveredSCT is an SCT and how it was delivered.
+type DeliveredSCT struct {
+	SCT    *ct.SignedCertificateTimestamp
+	Source Source
+}
+
+// Result is the outcome of verifying a single SCT.
+type Result struct {
+	DeliveredSCT
+	// The log which issued the SCT, or nil if it isn't in the list.
+	Log *loglist.Log
+	// The entry the SCT's signature is over, which the log must
+	// incorporate, or nil if the signature wasn't verified.
+	Leaf *ct.MerkleTreeLeaf
+	// Why the SCT isn't valid, or nil if it is.
+	Err error
+}
+
+// Errors in Results.
+var (
+	ErrUnknownLog      = errors.New("SCT is from a log which isn't in the list")
+	ErrFutureTimestamp = errors.New("SCT timestamp is in the future")
+	ErrNoIssuer        = errors.New("issuer is needed to verify embedded SCTs")
+)
+
+// LogStatusError is the error in Results for SCTs from logs whose state means
+// they can't be relied on.
+type LogStatusError struct {
+	Status loglist.Status
+	Since  time.Time
+	// Set if the log was frozen or retired too soon after issuing the SCT
+	// for it to be guaranteed to have incorporated the entry, i.e. less
+	// than its Maximum Merge Delay later.
+	WithinMMD bool
+}
+
+func (e LogStatusError) Error() string {
+	if e.WithinMMD {
+		return fmt.Sprintf("SCT was issued within the MMD of the log becoming %s at %s", e.Status, e.Since)
+	}
+	return fmt.Sprintf("log is %s", e.Status)
+}
+
+// ParseSCTListExtension parses the value of the X.509 or OCSP extension which
+// carries SCTs, which is a DER OCTET STRING containing a
+// SignedCertificateTimestampList.
+func ParseSCTListExtension(value []byte) ([]ct.SignedCertificateTimestamp, error) {
+	list, err := x509.ParseSCTListExtension(value)
+	if err != nil {
+		return nil, err
+	}
+	return ct.DeserializeSCTList(list)
+}
+
+// EmbeddedSCTs returns the SCTs embedded in cert, if there are any.
+func EmbeddedSCTs(cert *x509.Certificate) ([]ct.SignedCertificateTimestamp, error) {
+	list, err := cert.SCTList()
+	if err != nil || list == nil {
+		return nil, err
+	}
+	return ct.DeserializeSCTList(list)
+}
+
+// VerifySCTs verifies the SCTs delivered with cert, and those embedded in it,
+// as of the time at, and returns the outcome for each: first for scts, in
+// order, then for the embedded SCTs.  chain holds the rest of cert's chain,
+// starting with its issuer, which is needed to verify embedded SCTs.
+//
+// An SCT is valid if it is from a log in ll, its signature verifies, its
+// timestamp isn't after at, and the log is qualified or usable, or has since
+// been frozen or retired at least its Maximum Merge Delay after issuing the
+// SCT.  Whether a set of valid SCTs is enough for the certificate is a matter
+// of policy, e.g. see LogList.CheckChromePolicy.
+func VerifySCTs(cert *x509.Certificate, chain []*x509.Certificate, scts []DeliveredSCT, ll *loglist.LogList, at time.Time) []Result {
+	results := make([]Result, 0, len(scts))
+	for _, s := range scts {
+		results = append(results, verifySCT(cert, chain, s, ll, at))
+	}
+	embedded, err := EmbeddedSCTs(cert)
+	if err != nil {
+		results = append(results, Result{
+			DeliveredSCT: DeliveredSCT{Source: Embedded},
+			Err:          fmt.Errorf("failed to parse embedded SCTs: %v", err),
+		})
+	}
+	for i := range embedded {
+		results = append(results, verifySCT(cert, chain, DeliveredSCT{SCT: &embedded[i], Source: Embedded}, ll, at))
+	}
+	return results
+}
+
+func verifySCT(cert *x509.Certificate, chain []*x509.Certificate, s DeliveredSCT, ll *loglist.LogList, at time.Time) Result {
+	r := Result{DeliveredSCT: s, Log: ll.FindLogByID(s.SCT.LogID)}
+	if r.Log == nil {
+		r.Err = ErrUnknownLog
+		return r
+	}
+	entry, err := logEntry(cert, chain, s)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	key, err := r.Log.PublicKey()
+	if err != nil {
+		r.Err = fmt.Errorf("failed to parse log's key: %v", err)
+		return r
+	}
+	v, err := ct.NewSignatureVerifier(key)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	if err := v.VerifySCTSignature(*s.SCT, *entry); err != nil {
+		r.Err = err
+		return r
+	}
+	r.Leaf = &entry.Leaf
+
+	sctTime := ct.TimestampToTime(s.SCT.Timestamp)
+	if sctTime.After(at) {
+		r.Err = ErrFutureTimestamp
+		return r
+	}
+	switch status, since := r.Log.Status(); status {
+	case loglist.QualifiedStatus, loglist.UsableStatus:
+	case loglist.ReadOnlyStatus, loglist.RetiredStatus:
+		if sctTime.Add(r.Log.MMDDuration()).After(since) {
+			r.Err = LogStatusError{Status: status, Since: since, WithinMMD: true}
+		}
+	default:
+		r.Err = LogStatusError{Status: status, Since: since}
+	}
+	return r
+}
+
+// logEntry returns the entry which s signs.  Embedded SCTs sign the
+// precertificate which the certificate was created from; the others sign the
+// certificate itself.
+func logEntry(cert *x509.Certificate, chain []*x509.Certificate, s DeliveredSCT) (*ct.LogEntry, error) {
+	entry := &ct.LogEntry{
+		Leaf: ct.MerkleTreeLeaf{
+			Version:  ct.V1,
+			LeafType: ct.TimestampedEntryLeafType,
+			TimestampedEntry: ct.TimestampedEntry{
+				Timestamp:  s.SCT.Timestamp,
+				Extensions: s.SCT.Extensions,
+			},
+		},
+	}
+	te := &entry.Leaf.TimestampedEntry
+	if s.Source != Embedded {
+		te.EntryType = ct.X509LogEntryType
+		te.X509Entry = cert.Raw
+		return entry, nil
+	}
+	if len(chain) == 0 {
+		return nil, ErrNoIssuer
+	}
+	tbs, err := PrecertificateTBS(cert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconstruct precertificate: %v", err)
+	}
+	te.EntryType = ct.PrecertLogEntryType
+	te.PrecertEntry = ct.PreCert{
+		IssuerKeyHash:  sha256.Sum256(chain[0].RawSubjectPublicKeyInfo),
+		TBSCertificate: tbs,
+	}
+	return entry, nil
+}
+
+// PrecertificateTBS returns the TBSCertificate of the precertificate which
+// cert was issued from, as a log would have logged it in a precertificate
+// entry: cert's TBSCertificate without its embedded SCT list, if it has one.
+// It can be compared with the TBSCertificates of precertificate entries to
+// find the precertificate of a certificate.
+func PrecertificateTBS(cert *x509.Certificate) ([]byte, error) {
+	return x509.BuildPrecertTBS(cert.RawTBSCertificate)
+}
@@ -0,0 +1,237 @@
+package sctverify
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/loglist"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// sctTime is when the test SCTs are issued.
+var sctTime = time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func timestamp(t time.Time) uint64 {
+	return uint64(t.UnixNano() / int64(time.Millisecond))
+}
+
+// signSCT returns an SCT for entry, issued at sctTime by the log with key.
+func signSCT(t *testing.T, key *ecdsa.PrivateKey, entry ct.LogEntry) ct.SignedCertificateTimestamp {
+	spki, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct := ct.SignedCertificateTimestamp{
+		SCTVersion: ct.V1,
+		LogID:      sha256.Sum256(spki),
+		Timestamp:  timestamp(sctTime),
+	}
+	entry.Leaf.TimestampedEntry.Timestamp = sct.Timestamp
+	input, err := ct.SerializeSCTSignatureInput(sct, entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256(input)
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct.Signature = ct.DigitallySigned{HashAlgorithm: ct.SHA256, SignatureAlgorithm: ct.ECDSA, Signature: sig}
+	return sct
+}
+
+func entryFor(entryType ct.LogEntryType, cert []byte, precert ct.PreCert) ct.LogEntry {
+	return ct.LogEntry{Leaf: ct.MerkleTreeLeaf{
+		Version:  ct.V1,
+		LeafType: ct.TimestampedEntryLeafType,
+		TimestampedEntry: ct.TimestampedEntry{
+			EntryType:    entryType,
+			X509Entry:    cert,
+			PrecertEntry: precert,
+		},
+	}}
+}
+
+type testSetup struct {
+	issuer *x509.Certificate
+	cert   *x509.Certificate // With an embedded SCT.
+	// The TBSCertificate of cert's precertificate.
+	precertTBS []byte
+	tlsSCT     ct.SignedCertificateTimestamp
+	log        *loglist.Log
+	list       *loglist.LogList
+	otherKey   *ecdsa.PrivateKey // Of a log which isn't in the list.
+}
+
+func setup(t *testing.T) *testSetup {
+	ca, key, logKey := testcert.NewCA(t, "Test CA", nil), testcert.NewKey(t), testcert.NewKey(t)
+	issuer := ca.Cert
+
+	// The precertificate's TBSCertificate is that of the certificate
+	// without the SCT extension.
+	tmpl := testcert.LeafTemplate("leaf.example.com")
+	tmpl.NotBefore = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	tmpl.NotAfter = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	unembedded := testcert.Issue(t, tmpl, key, ca)
+	precertSCT := signSCT(t, logKey, entryFor(ct.PrecertLogEntryType, nil, ct.PreCert{
+		IssuerKeyHash:  sha256.Sum256(issuer.RawSubjectPublicKeyInfo),
+		TBSCertificate: unembedded.RawTBSCertificate,
+	}))
+	list, err := ct.SerializeSCTList([]ct.SignedCertificateTimestamp{precertSCT})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := x509.NewSCTListExtension(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.ExtraExtensions = []pkix.Extension{ext}
+	cert := testcert.Issue(t, tmpl, key, ca)
+
+	spki, err := x509.MarshalPKIXPublicKey(&logKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := sha256.Sum256(spki)
+	log := &loglist.Log{LogID: id[:], Key: spki, MMD: 86400}
+	return &testSetup{
+		issuer:     issuer,
+		cert:       cert,
+		precertTBS: unembedded.RawTBSCertificate,
+		tlsSCT:     signSCT(t, logKey, entryFor(ct.X509LogEntryType, cert.Raw, ct.PreCert{})),
+		log:        log,
+		list:       &loglist.LogList{Operators: []*loglist.Operator{{Name: "Test", Logs: []*loglist.Log{log}}}},
+		otherKey:   testcert.NewKey(t),
+	}
+}
+
+func states(status loglist.Status, since time.Time) *loglist.LogStates {
+	s := loglist.LogState{Timestamp: since}
+	switch status {
+	case loglist.PendingStatus:
+		return &loglist.LogStates{Pending: &s}
+	case loglist.QualifiedStatus:
+		return &loglist.LogStates{Qualified: &s}
+	case loglist.ReadOnlyStatus:
+		return &loglist.LogStates{ReadOnly: &loglist.ReadOnlyLogState{LogState: s}}
+	case loglist.RetiredStatus:
+		return &loglist.LogStates{Retired: &s}
+	}
+	return &loglist.LogStates{Usable: &s}
+}
+
+func TestVerifySCTs(t *testing.T) {
+	s := setup(t)
+	badSig := s.tlsSCT
+	badSig.Timestamp++
+	unknown := signSCT(t, s.otherKey, entryFor(ct.X509LogEntryType, s.cert.Raw, ct.PreCert{}))
+	embedded, err := EmbeddedSCTs(s.cert)
+	if err != nil || len(embedded) != 1 {
+		t.Fatalf("EmbeddedSCTs()=%v,%v, want one SCT", embedded, err)
+	}
+
+	tests := []struct {
+		desc    string
+		sct     ct.SignedCertificateTimestamp
+		source  Source
+		chain   []*x509.Certificate
+		status  loglist.Status
+		since   time.Time
+		at      time.Time
+		wantErr bool
+	}{
+		{desc: "TLS", sct: s.tlsSCT, source: TLSExtension},
+		{desc: "OCSP", sct: s.tlsSCT, source: OCSPResponse},
+		{desc: "embedded", sct: embedded[0], source: Embedded, chain: []*x509.Certificate{s.issuer}},
+		{desc: "embedded without issuer", sct: embedded[0], source: Embedded, wantErr: true},
+		{desc: "embedded as TLS", sct: embedded[0], source: TLSExtension, wantErr: true},
+		{desc: "TLS as embedded", sct: s.tlsSCT, source: Embedded, chain: []*x509.Certificate{s.issuer}, wantErr: true},
+		{desc: "bad signature", sct: badSig, source: TLSExtension, wantErr: true},
+		{desc: "unknown log", sct: unknown, source: TLSExtension, wantErr: true},
+		{desc: "future", sct: s.tlsSCT, source: TLSExtension, at: sctTime.Add(-time.Second), wantErr: true},
+		{desc: "qualified", sct: s.tlsSCT, source: TLSExtension, status: loglist.QualifiedStatus},
+		{desc: "pending", sct: s.tlsSCT, source: TLSExtension, status: loglist.PendingStatus, wantErr: true},
+		{desc: "retired long after", sct: s.tlsSCT, source: TLSExtension, status: loglist.RetiredStatus, since: sctTime.Add(48 * time.Hour)},
+		{desc: "retired within MMD", sct: s.tlsSCT, source: TLSExtension, status: loglist.RetiredStatus, since: sctTime.Add(time.Hour), wantErr: true},
+		{desc: "frozen within MMD", sct: s.tlsSCT, source: TLSExtension, status: loglist.ReadOnlyStatus, since: sctTime.Add(time.Hour), wantErr: true},
+		{desc: "retired before", sct: s.tlsSCT, source: TLSExtension, status: loglist.RetiredStatus, since: sctTime.Add(-time.Hour), wantErr: true},
+	}
+	for _, test := range tests {
+		s.log.State = states(test.status, test.since)
+		at := test.at
+		if at.IsZero() {
+			at = sctTime.Add(time.Hour)
+		}
+		sct := test.sct
+		// Only the SCTs passed are verified, as the certificate has
+		// an embedded SCT which is verified too.
+		results := VerifySCTs(s.cert, test.chain, []DeliveredSCT{{SCT: &sct, Source: test.source}}, s.list, at)
+		if len(results) != 2 {
+			t.Errorf("%s: got %d results, want 2", test.desc, len(results))
+			continue
+		}
+		r := results[0]
+		if r.SCT != &sct || r.Source != test.source {
+			t.Errorf("%s: got result for %v from %s", test.desc, r.SCT, r.Source)
+		}
+		if gotErr := r.Err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: got error %v, want error %t", test.desc, r.Err, test.wantErr)
+		}
+		wantType := ct.X509LogEntryType
+		if test.source == Embedded {
+			wantType = ct.PrecertLogEntryType
+		}
+		if !test.wantErr && (r.Leaf == nil || r.Leaf.TimestampedEntry.EntryType != wantType) {
+			t.Errorf("%s: got leaf %+v, want %s entry", test.desc, r.Leaf, wantType)
+		}
+		if results[1].Source != Embedded {
+			t.Errorf("%s: second result is from %s, want embedded", test.desc, results[1].Source)
+		}
+	}
+}
+
+func TestVerifySCTsErrors(t *testing.T) {
+	s := setup(t)
+	s.log.State = states(loglist.RetiredStatus, sctTime.Add(time.Hour))
+	unknown := signSCT(t, s.otherKey, entryFor(ct.X509LogEntryType, s.cert.Raw, ct.PreCert{}))
+	results := VerifySCTs(s.cert, nil, []DeliveredSCT{{SCT: &unknown}, {SCT: &s.tlsSCT}}, s.list, sctTime.Add(time.Hour))
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if results[0].Err != ErrUnknownLog || results[0].Log != nil {
+		t.Errorf("got error %v from log %v, want ErrUnknownLog", results[0].Err, results[0].Log)
+	}
+	if err, ok := results[1].Err.(LogStatusError); !ok || !err.WithinMMD || err.Status != loglist.RetiredStatus {
+		t.Errorf("got error %v, want LogStatusError within MMD", results[1].Err)
+	}
+	if results[1].Log != s.log {
+		t.Errorf("got log %v, want %v", results[1].Log, s.log)
+	}
+	if results[2].Err != ErrNoIssuer {
+		t.Errorf("got error %v for embedded SCT, want ErrNoIssuer", results[2].Err)
+	}
+}
+
+func TestPrecertificateTBS(t *testing.T) {
+	s := setup(t)
+	tbs, err := PrecertificateTBS(s.issuer)
+	if err != nil || !bytes.Equal(tbs, s.issuer.RawTBSCertificate) {
+		t.Errorf("PrecertificateTBS(certificate without SCTs)=%x,%v, want its TBSCertificate", tbs, err)
+	}
+	if tbs, err := PrecertificateTBS(s.cert); err != nil || !bytes.Equal(tbs, s.precertTBS) {
+		t.Errorf("PrecertificateTBS(certificate with SCTs)=%x,%v, want %x", tbs, err, s.precertTBS)
+	}
+}
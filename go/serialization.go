@@ -3,11 +3,12 @@ package ct
 import (
 	"bytes"
 	"container/list"
-	"crypto"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+
+	"github.com/google/certificate-transparency/go/tls"
 )
 
 // Variable size structure prefix-header byte lengths
@@ -17,6 +18,10 @@ const (
 	ExtensionsLengthBytes       = 2
 	CertificateChainLengthBytes = 3
 	SignatureLengthBytes        = 2
+	// The lengths of SignedCertificateTimestampLists and of the SCTs in
+	// them (RFC6962 section 3.3).
+	SCTListLengthBytes = 2
+	SCTLengthBytes     = 2
 )
 
 // Max lengths
@@ -80,6 +85,11 @@ func readVarBytes(r io.Reader, numLenBytes int) ([]byte, error) {
 		return nil, err
 	}
 	data := make([]byte, l)
+	if l == 0 {
+		// Reading nothing from an exhausted reader would fail with
+		// io.EOF, e.g. for the empty chain of an entry for a root.
+		return data, nil
+	}
 	n, err := r.Read(data)
 	if err != nil {
 		return nil, err
@@ -123,30 +133,7 @@ func readASN1CertList(r io.Reader, totalLenBytes int, elementLenBytes int) ([]AS
 // RFC section 3.4 for details on the format.
 // Returns a non-nil error if there was a problem.
 func ReadTimestampedEntryInto(r io.Reader, t *TimestampedEntry) error {
-	var err error
-	if err = binary.Read(r, binary.BigEndian, &t.Timestamp); err != nil {
-		return err
-	}
-	if err = binary.Read(r, binary.BigEndian, &t.EntryType); err != nil {
-		return err
-	}
-	switch t.EntryType {
-	case X509LogEntryType:
-		if t.X509Entry, err = readVarBytes(r, CertificateLengthBytes); err != nil {
-			return err
-		}
-	case PrecertLogEntryType:
-		if err := binary.Read(r, binary.BigEndian, &t.PrecertEntry.IssuerKeyHash); err != nil {
-			return err
-		}
-		if t.PrecertEntry.TBSCertificate, err = readVarBytes(r, PreCertificateLengthBytes); err != nil {
-			return err
-		}
-	default:
-		return fmt.Errorf("unknown EntryType: %d", t.EntryType)
-	}
-	t.Extensions, err = readVarBytes(r, ExtensionsLengthBytes)
-	return nil
+	return tls.NewDecoder(r).Decode(t)
 }
 
 // ReadMerkleTreeLeaf parses the byte-stream representation of a MerkleTreeLeaf
@@ -157,22 +144,32 @@ func ReadTimestampedEntryInto(r io.Reader, t *TimestampedEntry) error {
 // problem
 func ReadMerkleTreeLeaf(r io.Reader) (*MerkleTreeLeaf, error) {
 	var m MerkleTreeLeaf
-	if err := binary.Read(r, binary.BigEndian, &m.Version); err != nil {
-		return nil, err
-	}
+	err := tls.NewDecoder(r).Decode(&m)
+	// The rest of a leaf of another version can't be parsed as a V1 leaf.
 	if m.Version != V1 {
 		return nil, fmt.Errorf("unknown Version %d", m.Version)
 	}
-	if err := binary.Read(r, binary.BigEndian, &m.LeafType); err != nil {
+	if err != nil {
 		return nil, err
 	}
+	return &m, nil
+}
+
+// SerializeMerkleTreeLeaf returns the byte-stream representation of |m|, as
+// hashed to form the leaf hash of the entry it represents.
+// See RFC section 3.4 for details on the format.
+// Returns a non-nil error if there was a problem.
+func SerializeMerkleTreeLeaf(m MerkleTreeLeaf) ([]byte, error) {
+	if m.Version != V1 {
+		return nil, fmt.Errorf("unknown Version %d", m.Version)
+	}
 	if m.LeafType != TimestampedEntryLeafType {
 		return nil, fmt.Errorf("unknown LeafType %d", m.LeafType)
 	}
-	if err := ReadTimestampedEntryInto(r, &m.TimestampedEntry); err != nil {
+	if err := checkTimestampedEntryFormat(m.TimestampedEntry); err != nil {
 		return nil, err
 	}
-	return &m, nil
+	return tls.Marshal(m)
 }
 
 // UnmarshalX509ChainArray unmarshalls the contents of the "chain:" entry in a
@@ -205,50 +202,16 @@ func UnmarshalPrecertChainArray(b []byte) ([]ASN1Cert, error) {
 
 // UnmarshalDigitallySigned reconstructs a DigitallySigned structure from a Reader
 func UnmarshalDigitallySigned(r io.Reader) (*DigitallySigned, error) {
-	var h byte
-	if err := binary.Read(r, binary.BigEndian, &h); err != nil {
-		return nil, fmt.Errorf("failed to read HashAlgorithm: %v", err)
-	}
-
-	var s byte
-	if err := binary.Read(r, binary.BigEndian, &s); err != nil {
-		return nil, fmt.Errorf("failed to read SignatureAlgorithm: %v", err)
-	}
-
-	sig, err := readVarBytes(r, SignatureLengthBytes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read Signature bytes: %v", err)
-	}
-
-	return &DigitallySigned{
-		HashAlgorithm:      HashAlgorithm(h),
-		SignatureAlgorithm: SignatureAlgorithm(s),
-		Signature:          sig,
-	}, nil
-}
-
-func marshalDigitallySignedHere(ds DigitallySigned, here []byte) ([]byte, error) {
-	sigLen := len(ds.Signature)
-	dsOutLen := 2 + SignatureLengthBytes + sigLen
-	if here == nil {
-		here = make([]byte, dsOutLen)
-	}
-	if len(here) < dsOutLen {
-		return nil, ErrNotEnoughBuffer
+	var ds DigitallySigned
+	if err := tls.NewDecoder(r).Decode(&ds); err != nil {
+		return nil, err
 	}
-	here = here[0:dsOutLen]
-
-	here[0] = byte(ds.HashAlgorithm)
-	here[1] = byte(ds.SignatureAlgorithm)
-	binary.BigEndian.PutUint16(here[2:4], uint16(sigLen))
-	copy(here[4:], ds.Signature)
-
-	return here, nil
+	return &ds, nil
 }
 
 // MarshalDigitallySigned marshalls a DigitallySigned structure into a byte array
 func MarshalDigitallySigned(ds DigitallySigned) ([]byte, error) {
-	return marshalDigitallySignedHere(ds, nil)
+	return tls.Marshal(ds)
 }
 
 func checkCertificateFormat(cert ASN1Cert) error {
@@ -268,65 +231,43 @@ func checkExtensionsFormat(ext CTExtensions) error {
 	return nil
 }
 
-func serializeV1CertSCTSignatureInput(timestamp uint64, cert ASN1Cert, ext CTExtensions) ([]byte, error) {
-	if err := checkCertificateFormat(cert); err != nil {
-		return nil, err
-	}
-	if err := checkExtensionsFormat(ext); err != nil {
-		return nil, err
-	}
-	var buf bytes.Buffer
-	if err := binary.Write(&buf, binary.BigEndian, V1); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(&buf, binary.BigEndian, CertificateTimestampSignatureType); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(&buf, binary.BigEndian, timestamp); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(&buf, binary.BigEndian, X509LogEntryType); err != nil {
-		return nil, err
-	}
-	if err := writeVarBytes(&buf, cert, CertificateLengthBytes); err != nil {
-		return nil, err
-	}
-	if err := writeVarBytes(&buf, ext, ExtensionsLengthBytes); err != nil {
-		return nil, err
+// checkTimestampedEntryFormat checks the certificate and extensions of |t|,
+// so that it can be serialized.
+func checkTimestampedEntryFormat(t TimestampedEntry) error {
+	switch t.EntryType {
+	case X509LogEntryType:
+		if err := checkCertificateFormat(t.X509Entry); err != nil {
+			return err
+		}
+	case PrecertLogEntryType:
+		if err := checkCertificateFormat(t.PrecertEntry.TBSCertificate); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown EntryType: %d", t.EntryType)
 	}
-	return buf.Bytes(), nil
+	return checkExtensionsFormat(t.Extensions)
 }
 
-func serializeV1PrecertSCTSignatureInput(timestamp uint64, issuerKeyHash [issuerKeyHashLength]byte, tbs []byte, ext CTExtensions) ([]byte, error) {
-	if err := checkCertificateFormat(tbs); err != nil {
-		return nil, err
-	}
-	if err := checkExtensionsFormat(ext); err != nil {
-		return nil, err
-	}
-	var buf bytes.Buffer
-	if err := binary.Write(&buf, binary.BigEndian, V1); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(&buf, binary.BigEndian, CertificateTimestampSignatureType); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(&buf, binary.BigEndian, timestamp); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(&buf, binary.BigEndian, PrecertLogEntryType); err != nil {
-		return nil, err
-	}
-	if _, err := buf.Write(issuerKeyHash[:]); err != nil {
-		return nil, err
-	}
-	if err := writeVarBytes(&buf, tbs, CertificateLengthBytes); err != nil {
-		return nil, err
-	}
-	if err := writeVarBytes(&buf, ext, ExtensionsLengthBytes); err != nil {
+// certificateTimestamp is the input to an SCT's signature (see RFC section
+// 3.2): the SCT's version and what it is for, then the entry it is for, with
+// the SCT's timestamp.
+type certificateTimestamp struct {
+	SCTVersion    Version
+	SignatureType SignatureType
+	Entry         TimestampedEntry
+}
+
+func serializeV1SCTSignatureInputForEntry(timestamp uint64, t TimestampedEntry) ([]byte, error) {
+	t.Timestamp = timestamp
+	if err := checkTimestampedEntryFormat(t); err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return tls.Marshal(certificateTimestamp{
+		SCTVersion:    V1,
+		SignatureType: CertificateTimestampSignatureType,
+		Entry:         t,
+	})
 }
 
 func serializeV1SCTSignatureInput(sct SignedCertificateTimestamp, entry LogEntry) ([]byte, error) {
@@ -337,12 +278,8 @@ func serializeV1SCTSignatureInput(sct SignedCertificateTimestamp, entry LogEntry
 		return nil, fmt.Errorf("Unsupported leaf type %s", entry.Leaf.LeafType)
 	}
 	switch entry.Leaf.TimestampedEntry.EntryType {
-	case X509LogEntryType:
-		return serializeV1CertSCTSignatureInput(sct.Timestamp, entry.Leaf.TimestampedEntry.X509Entry, entry.Leaf.TimestampedEntry.Extensions)
-	case PrecertLogEntryType:
-		return serializeV1PrecertSCTSignatureInput(sct.Timestamp, entry.Leaf.TimestampedEntry.PrecertEntry.IssuerKeyHash,
-			entry.Leaf.TimestampedEntry.PrecertEntry.TBSCertificate,
-			entry.Leaf.TimestampedEntry.Extensions)
+	case X509LogEntryType, PrecertLogEntryType:
+		return serializeV1SCTSignatureInputForEntry(sct.Timestamp, entry.Leaf.TimestampedEntry)
 	default:
 		return nil, fmt.Errorf("unknown TimestampedEntryLeafType %s", entry.Leaf.TimestampedEntry.EntryType)
 	}
@@ -375,43 +312,20 @@ func serializeV1SCTHere(sct SignedCertificateTimestamp, here []byte) ([]byte, er
 	if sct.SCTVersion != V1 {
 		return nil, ErrInvalidVersion
 	}
-	sctLen, err := sct.SerializedLength()
+	if err := checkExtensionsFormat(sct.Extensions); err != nil {
+		return nil, err
+	}
+	b, err := tls.Marshal(sct)
 	if err != nil {
 		return nil, err
 	}
 	if here == nil {
-		here = make([]byte, sctLen)
+		return b, nil
 	}
-	if len(here) < sctLen {
+	if len(here) < len(b) {
 		return nil, ErrNotEnoughBuffer
 	}
-	if err := checkExtensionsFormat(sct.Extensions); err != nil {
-		return nil, err
-	}
-
-	here = here[0:sctLen]
-
-	// Write Version
-	here[0] = byte(sct.SCTVersion)
-
-	// Write LogID
-	copy(here[1:33], sct.LogID[:])
-
-	// Write Timestamp
-	binary.BigEndian.PutUint64(here[33:41], sct.Timestamp)
-
-	// Write Extensions
-	extLen := len(sct.Extensions)
-	binary.BigEndian.PutUint16(here[41:43], uint16(extLen))
-	n := 43 + extLen
-	copy(here[43:n], sct.Extensions)
-
-	// Write Signature
-	_, err = marshalDigitallySignedHere(sct.Signature, here[n:])
-	if err != nil {
-		return nil, err
-	}
-	return here, nil
+	return here[:copy(here, b)], nil
 }
 
 // SerializeSCTHere serializes the passed in sct into the format specified
@@ -437,67 +351,93 @@ func SerializeSCT(sct SignedCertificateTimestamp) ([]byte, error) {
 	return SerializeSCTHere(sct, nil)
 }
 
-func deserializeSCTV1(r io.Reader, sct *SignedCertificateTimestamp) error {
-	if err := binary.Read(r, binary.BigEndian, &sct.LogID); err != nil {
-		return err
-	}
-	if err := binary.Read(r, binary.BigEndian, &sct.Timestamp); err != nil {
-		return err
+// DeserializeSCT reads a SignedCertificateTimestamp in the format specified
+// by RFC6962 section 3.2 from |r|.
+func DeserializeSCT(r io.Reader) (*SignedCertificateTimestamp, error) {
+	var sct SignedCertificateTimestamp
+	err := tls.NewDecoder(r).Decode(&sct)
+	// The rest of an SCT of another version can't be parsed as a V1 SCT.
+	if sct.SCTVersion != V1 {
+		return nil, fmt.Errorf("unknown SCT version %d", sct.SCTVersion)
 	}
-	ext, err := readVarBytes(r, ExtensionsLengthBytes)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	sct.Extensions = ext
-	ds, err := UnmarshalDigitallySigned(r)
-	if err != nil {
-		return err
+	return &sct, nil
+}
+
+// serializedSCT and sctList are the SerializedSCT and
+// SignedCertificateTimestampList structures of RFC6962 section 3.3.
+type serializedSCT struct {
+	Val []byte `tls:"minlen:1,maxlen:65535"`
+}
+
+type sctList struct {
+	SCTList []serializedSCT `tls:"minlen:1,maxlen:65535"`
+}
+
+// SerializeSCTList serializes the passed in scts as a
+// SignedCertificateTimestampList (see RFC6962 section 3.3), as carried in the
+// TLS extension, and inside the OCTET STRINGs of the X.509 and OCSP
+// extensions.
+func SerializeSCTList(scts []SignedCertificateTimestamp) ([]byte, error) {
+	var list sctList
+	for _, sct := range scts {
+		b, err := SerializeSCT(sct)
+		if err != nil {
+			return nil, err
+		}
+		list.SCTList = append(list.SCTList, serializedSCT{Val: b})
 	}
-	sct.Signature = *ds
-	return nil
+	return tls.Marshal(list)
 }
 
-func DeserializeSCT(r io.Reader) (*SignedCertificateTimestamp, error) {
-	var sct SignedCertificateTimestamp
-	if err := binary.Read(r, binary.BigEndian, &sct.SCTVersion); err != nil {
+// DeserializeSCTList parses a SignedCertificateTimestampList (see RFC6962
+// section 3.3).
+func DeserializeSCTList(b []byte) ([]SignedCertificateTimestamp, error) {
+	var list sctList
+	rest, err := tls.Unmarshal(b, &list)
+	if err != nil {
 		return nil, err
 	}
-	switch sct.SCTVersion {
-	case V1:
-		return &sct, deserializeSCTV1(r, &sct)
-	default:
-		return nil, fmt.Errorf("unknown SCT version %d", sct.SCTVersion)
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d trailing bytes after SCT list", len(rest))
 	}
+	var scts []SignedCertificateTimestamp
+	for _, s := range list.SCTList {
+		r := bytes.NewReader(s.Val)
+		sct, err := DeserializeSCT(r)
+		if err != nil {
+			return nil, err
+		}
+		if r.Len() > 0 {
+			return nil, fmt.Errorf("%d trailing bytes after SCT", r.Len())
+		}
+		scts = append(scts, *sct)
+	}
+	return scts, nil
+}
+
+// treeHeadSignature is the input to an STH's signature (see RFC section 3.5).
+type treeHeadSignature struct {
+	Version        Version
+	SignatureType  SignatureType
+	Timestamp      uint64
+	TreeSize       uint64
+	SHA256RootHash SHA256Hash
 }
 
 func serializeV1STHSignatureInput(sth SignedTreeHead) ([]byte, error) {
 	if sth.Version != V1 {
 		return nil, fmt.Errorf("invalid STH version %d", sth.Version)
 	}
-	if sth.TreeSize < 0 {
-		return nil, fmt.Errorf("invalid tree size %d", sth.TreeSize)
-	}
-	if len(sth.SHA256RootHash) != crypto.SHA256.Size() {
-		return nil, fmt.Errorf("invalid TreeHash length, got %d expected %d", len(sth.SHA256RootHash), crypto.SHA256.Size())
-	}
-
-	var buf bytes.Buffer
-	if err := binary.Write(&buf, binary.BigEndian, V1); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(&buf, binary.BigEndian, TreeHashSignatureType); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(&buf, binary.BigEndian, sth.Timestamp); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(&buf, binary.BigEndian, sth.TreeSize); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(&buf, binary.BigEndian, sth.SHA256RootHash); err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
+	return tls.Marshal(treeHeadSignature{
+		Version:        V1,
+		SignatureType:  TreeHashSignatureType,
+		Timestamp:      sth.Timestamp,
+		TreeSize:       sth.TreeSize,
+		SHA256RootHash: sth.SHA256RootHash,
+	})
 }
 
 // SerializeSTHSignatureInput serializes the passed in sth into the correct
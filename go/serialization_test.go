@@ -118,6 +118,17 @@ func TestReadVarBytesShortRead(t *testing.T) {
 	}
 }
 
+func TestUnmarshalX509ChainArrayEmpty(t *testing.T) {
+	// The chain of an entry for a root certificate has no certificates.
+	chain, err := UnmarshalX509ChainArray([]byte{0, 0, 0})
+	if err != nil {
+		t.Fatalf("UnmarshalX509ChainArray(empty chain)=_,%v", err)
+	}
+	if len(chain) != 0 {
+		t.Errorf("UnmarshalX509ChainArray(empty chain)=%v, want no certificates", chain)
+	}
+}
+
 func TestReadTimestampedEntryIntoChecksEntryType(t *testing.T) {
 	buffer := []byte{0, 1, 2, 3, 4, 5, 6, 7, 0x45, 0x45}
 	var tse TimestampedEntry
@@ -375,6 +386,42 @@ func TestSerializeV1STHSignatureKAT(t *testing.T) {
 	}
 }
 
+func TestSerializeMerkleTreeLeafKAT(t *testing.T) {
+	// A MerkleTreeLeaf is serialized in the same way as the signature input
+	// of an SCT for the same entry, as TimestampedEntryLeafType and
+	// CertificateTimestampSignatureType are both zero.
+	for i, test := range []struct {
+		entry LogEntry
+		want  []byte
+	}{
+		{defaultCertificateLogEntry(), defaultCertificateSCTSignatureInput(t)},
+		{defaultPrecertLogEntry(), defaultPrecertSCTSignatureInput(t)},
+	} {
+		b, err := SerializeMerkleTreeLeaf(test.entry.Leaf)
+		if err != nil {
+			t.Fatalf("#%d: Failed to serialize MerkleTreeLeaf: %v", i, err)
+		}
+		if !bytes.Equal(test.want, b) {
+			t.Errorf("#%d: Serialized MerkleTreeLeaf incorrect, expected %v, got %v", i, test.want, b)
+		}
+		leaf, err := ReadMerkleTreeLeaf(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("#%d: Failed to read MerkleTreeLeaf: %v", i, err)
+		}
+		if b, err = SerializeMerkleTreeLeaf(*leaf); err != nil || !bytes.Equal(test.want, b) {
+			t.Errorf("#%d: MerkleTreeLeaf didn't round trip: got %v, %v", i, b, err)
+		}
+	}
+}
+
+func TestSerializeMerkleTreeLeafChecksEntryType(t *testing.T) {
+	leaf := defaultCertificateLogEntry().Leaf
+	leaf.TimestampedEntry.EntryType = LogEntryType(3)
+	if _, err := SerializeMerkleTreeLeaf(leaf); err == nil {
+		t.Fatal("Serialized MerkleTreeLeaf with unknown EntryType")
+	}
+}
+
 func TestMarshalDigitallySigned(t *testing.T) {
 	b, err := MarshalDigitallySigned(
 		DigitallySigned{
@@ -443,3 +490,80 @@ func TestDeserializeSCT(t *testing.T) {
 	}
 	assert.Equal(t, defaultSCT(), *sct)
 }
+
+func TestSerializeSCTList(t *testing.T) {
+	b, err := SerializeSCTList([]SignedCertificateTimestamp{defaultSCT(), defaultSCT()})
+	if err != nil {
+		t.Fatalf("Failed to serialize SCT list: %v", err)
+	}
+	// list length, 2 bytes, then each SCT prefixed with its length, 2 bytes
+	expected := mustDehex(t, "0074"+"0038"+defaultSCTHexString+"0038"+defaultSCTHexString)
+	if bytes.Compare(expected, b) != 0 {
+		t.Fatalf("Serialized SCT list differs from expected KA. Expected:\n%v\nGot:\n%v", expected, b)
+	}
+}
+
+func TestDeserializeSCTList(t *testing.T) {
+	scts, err := DeserializeSCTList(mustDehex(t, "0074"+"0038"+defaultSCTHexString+"0038"+defaultSCTHexString))
+	if err != nil {
+		t.Fatalf("Failed to deserialize SCT list: %v", err)
+	}
+	assert.Equal(t, []SignedCertificateTimestamp{defaultSCT(), defaultSCT()}, scts)
+
+	for _, bad := range []string{
+		"",
+		"0074" + "0038" + defaultSCTHexString,
+		"003a" + "0038" + defaultSCTHexString + "00",
+		"003b" + "0039" + defaultSCTHexString + "00",
+		"003a" + "0038" + defaultSCTHexString + "0000",
+	} {
+		if _, err := DeserializeSCTList(mustDehex(t, bad)); err == nil {
+			t.Errorf("DeserializeSCTList(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+// FuzzReadMerkleTreeLeaf checks that any leaf which can be read serializes to
+// the same bytes, as its leaf hash depends on.
+func FuzzReadMerkleTreeLeaf(f *testing.F) {
+	for _, e := range []LogEntry{defaultCertificateLogEntry(), defaultPrecertLogEntry()} {
+		b, err := SerializeMerkleTreeLeaf(e.Leaf)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bytes.NewReader(data)
+		leaf, err := ReadMerkleTreeLeaf(r)
+		if err != nil {
+			return
+		}
+		b, err := SerializeMerkleTreeLeaf(*leaf)
+		if err != nil {
+			t.Fatalf("SerializeMerkleTreeLeaf(ReadMerkleTreeLeaf(%x))=_,%v, want no error", data, err)
+		}
+		if want := data[:len(data)-r.Len()]; !bytes.Equal(b, want) {
+			t.Errorf("SerializeMerkleTreeLeaf(ReadMerkleTreeLeaf(%x))=%x, want %x", data, b, want)
+		}
+	})
+}
+
+// FuzzDeserializeSCTList checks that any SCT list which can be parsed
+// serializes to the same bytes.
+func FuzzDeserializeSCTList(f *testing.F) {
+	f.Add([]byte("\x00\x74\x00\x38" + string(mustDehex(f, defaultSCTHexString)) + "\x00\x38" + string(mustDehex(f, defaultSCTHexString))))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		scts, err := DeserializeSCTList(data)
+		if err != nil {
+			return
+		}
+		b, err := SerializeSCTList(scts)
+		if err != nil {
+			t.Fatalf("SerializeSCTList(DeserializeSCTList(%x))=_,%v, want no error", data, err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Errorf("SerializeSCTList(DeserializeSCTList(%x))=%x, want %x", data, b, data)
+		}
+	})
+}
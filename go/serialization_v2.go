@@ -0,0 +1,80 @@
+package ct
+
+import (
+	"fmt"
+
+	"github.com/google/certificate-transparency/go/tls"
+)
+
+// SerializeTransItem returns the TLS encoding of |t|, as sent by v2 logs
+// (RFC9162 section 4.4).
+func SerializeTransItem(t TransItem) ([]byte, error) {
+	return tls.Marshal(t)
+}
+
+// DeserializeTransItem parses the TLS encoded TransItem in |b|, which must
+// hold nothing else.
+func DeserializeTransItem(b []byte) (*TransItem, error) {
+	var t TransItem
+	rest, err := tls.Unmarshal(b, &t)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%d bytes of trailing data after TransItem", len(rest))
+	}
+	return &t, nil
+}
+
+// DeserializeTransItemOfType is like DeserializeTransItem, but also fails if
+// the TransItem isn't one of |types|.
+func DeserializeTransItemOfType(b []byte, types ...VersionedTransType) (*TransItem, error) {
+	t, err := DeserializeTransItem(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, want := range types {
+		if t.VersionedType == want {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("got TransItem of type %v, want one of %v", t.VersionedType, types)
+}
+
+// EntryTransItemForSCTV2 returns the TransItem holding the entry which the
+// v2 SCT |sct| signs, given the TBSCertificate and issuer key hash of the
+// certificate or precertificate it was issued for.  The SCT's timestamp and
+// extensions are part of the entry.
+func EntryTransItemForSCTV2(sct TransItem, tbs, issuerKeyHash []byte) (*TransItem, error) {
+	s := sct.SCT()
+	if s == nil {
+		return nil, fmt.Errorf("TransItem of type %v is not an SCT", sct.VersionedType)
+	}
+	entry := TimestampedCertificateEntryDataV2{
+		Timestamp:      s.Timestamp,
+		IssuerKeyHash:  issuerKeyHash,
+		TBSCertificate: tbs,
+		SCTExtensions:  s.SCTExtensions,
+	}
+	t := &TransItem{VersionedType: X509EntryV2Type, X509Entry: entry}
+	if sct.VersionedType == PrecertSCTV2Type {
+		t = &TransItem{VersionedType: PrecertEntryV2Type, PrecertEntry: entry}
+	}
+	return t, nil
+}
+
+// SerializeSCTV2SignatureInput returns the data a v2 log signs for an SCT
+// over |entry|, which is the entry's TransItem encoding (RFC9162 section
+// 4.8).
+func SerializeSCTV2SignatureInput(entry TransItem) ([]byte, error) {
+	if entry.Entry() == nil {
+		return nil, fmt.Errorf("TransItem of type %v is not an entry", entry.VersionedType)
+	}
+	return SerializeTransItem(entry)
+}
+
+// SerializeSTHV2SignatureInput returns the data a v2 log signs for a tree
+// head, which is the tree head's TLS encoding (RFC9162 section 4.10).
+func SerializeSTHV2SignatureInput(sth SignedTreeHeadDataV2) ([]byte, error) {
+	return tls.Marshal(sth.TreeHead)
+}
@@ -0,0 +1,183 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	v2TestLogID    = "2b0601" // 1.3.6.1
+	v2TestRootHash = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+)
+
+func v2TestSTH(t *testing.T) TransItem {
+	return TransItem{
+		VersionedType: SignedTreeHeadV2Type,
+		SignedTreeHead: SignedTreeHeadDataV2{
+			LogID: mustDehex(t, v2TestLogID),
+			TreeHead: TreeHeadDataV2{
+				Timestamp:     0x0102,
+				TreeSize:      7,
+				RootHash:      NodeHashV2{Value: mustDehex(t, v2TestRootHash)},
+				STHExtensions: []ExtensionV2{},
+			},
+			Signature: []byte{0xaa, 0xbb},
+		},
+	}
+}
+
+func TestTransItemRoundTrip(t *testing.T) {
+	for i, tc := range []struct {
+		item    TransItem
+		encoded string
+	}{
+		{
+			item: v2TestSTH(t),
+			encoded: "0005" + "03" + v2TestLogID + "0000000000000102" + "0000000000000007" +
+				"20" + v2TestRootHash + "0000" + "0002aabb",
+		},
+		{
+			item: TransItem{
+				VersionedType: PrecertSCTV2Type,
+				PrecertSCT: SignedCertificateTimestampDataV2{
+					LogID:         mustDehex(t, v2TestLogID),
+					Timestamp:     3,
+					SCTExtensions: []ExtensionV2{{ExtensionType: 1, ExtensionData: []byte{0xcc}}},
+					Signature:     []byte{0xdd},
+				},
+			},
+			encoded: "0004" + "03" + v2TestLogID + "0000000000000003" + "0005" + "0001" + "0001cc" + "0001dd",
+		},
+		{
+			item: TransItem{
+				VersionedType: InclusionProofV2Type,
+				InclusionProof: InclusionProofDataV2{
+					LogID:         mustDehex(t, v2TestLogID),
+					TreeSize:      2,
+					LeafIndex:     1,
+					InclusionPath: []NodeHashV2{{Value: mustDehex(t, v2TestRootHash)}},
+				},
+			},
+			encoded: "0007" + "03" + v2TestLogID + "0000000000000002" + "0000000000000001" + "0021" + "20" + v2TestRootHash,
+		},
+	} {
+		b, err := SerializeTransItem(tc.item)
+		if err != nil {
+			t.Errorf("#%d: SerializeTransItem()=_,%v, want no error", i, err)
+			continue
+		}
+		if want := mustDehex(t, tc.encoded); !bytes.Equal(b, want) {
+			t.Errorf("#%d: SerializeTransItem()=%x, want %x", i, b, want)
+		}
+		got, err := DeserializeTransItem(b)
+		if err != nil {
+			t.Errorf("#%d: DeserializeTransItem(%x)=_,%v, want no error", i, b, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tc.item) {
+			t.Errorf("#%d: DeserializeTransItem(%x)=%+v, want %+v", i, b, *got, tc.item)
+		}
+	}
+}
+
+func TestDeserializeTransItemErrors(t *testing.T) {
+	sth, err := SerializeTransItem(v2TestSTH(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tc := range []struct {
+		b     []byte
+		types []VersionedTransType
+		want  string
+	}{
+		{b: append(sth, 0), want: "trailing data"},
+		{b: sth[:len(sth)-1], want: "unexpected EOF"},
+		{b: mustDehex(t, "0008"), want: "unknown VersionedType 8"},
+		{b: sth, types: []VersionedTransType{X509SCTV2Type}, want: "want one of [X509SCTV2]"},
+	} {
+		var err error
+		if tc.types != nil {
+			_, err = DeserializeTransItemOfType(tc.b, tc.types...)
+		} else {
+			_, err = DeserializeTransItem(tc.b)
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("#%d: DeserializeTransItem(%x)=_,%v, want error containing %q", i, tc.b, err, tc.want)
+		}
+	}
+}
+
+func v2Sign(t *testing.T, key *ecdsa.PrivateKey, data []byte) []byte {
+	hash := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestVerifyV2Signatures(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := mustCreateSignatureVerifier(t, &key.PublicKey)
+
+	sth := v2TestSTH(t).SignedTreeHead
+	data, err := SerializeSTHV2SignatureInput(sth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sth.Signature = v2Sign(t, key, data)
+	if err := v.VerifySTHV2Signature(sth); err != nil {
+		t.Errorf("VerifySTHV2Signature()=%v, want no error", err)
+	}
+	sth.TreeHead.TreeSize++
+	if err := v.VerifySTHV2Signature(sth); err == nil {
+		t.Error("VerifySTHV2Signature(modified tree head)=nil, want error")
+	}
+
+	sct := TransItem{
+		VersionedType: X509SCTV2Type,
+		X509SCT: SignedCertificateTimestampDataV2{
+			LogID:         mustDehex(t, v2TestLogID),
+			Timestamp:     sigTestSCTTimestamp,
+			SCTExtensions: []ExtensionV2{},
+		},
+	}
+	issuerKeyHash := make([]byte, sha256.Size)
+	entry, err := EntryTransItemForSCTV2(sct, mustDehex(t, sigTestDERCertString), issuerKeyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.VersionedType != X509EntryV2Type || entry.X509Entry.Timestamp != sigTestSCTTimestamp {
+		t.Fatalf("EntryTransItemForSCTV2()=%+v, want X509 entry with the SCT's timestamp", entry)
+	}
+	data, err = SerializeSCTV2SignatureInput(*entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct.X509SCT.Signature = v2Sign(t, key, data)
+	if err := v.VerifySCTV2Signature(sct.X509SCT, *entry); err != nil {
+		t.Errorf("VerifySCTV2Signature()=%v, want no error", err)
+	}
+	entry.X509Entry.Timestamp++
+	if err := v.VerifySCTV2Signature(sct.X509SCT, *entry); err == nil {
+		t.Error("VerifySCTV2Signature(modified entry)=nil, want error")
+	}
+	if err := v.VerifySCTV2Signature(sct.X509SCT, sct); err == nil {
+		t.Error("VerifySCTV2Signature(SCT as entry)=nil, want error")
+	}
+}
@@ -3,6 +3,7 @@ package ct
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -29,13 +30,41 @@ func PublicKeyFromPEM(b []byte) (crypto.PublicKey, SHA256Hash, []byte, error) {
 	return k, sha256.Sum256(p.Bytes), rest, err
 }
 
-// SignatureVerifier can verify signatures on SCTs and STHs
-type SignatureVerifier struct {
-	pubKey crypto.PublicKey
+// KeyID returns the ID of the log whose public key is pk: the SHA-256 hash of
+// its DER encoded SubjectPublicKeyInfo.
+func KeyID(pk crypto.PublicKey) (SHA256Hash, error) {
+	der, err := x509.MarshalPKIXPublicKey(pk)
+	if err != nil {
+		return SHA256Hash{}, err
+	}
+	return sha256.Sum256(der), nil
 }
 
-// NewSignatureVerifier creates a new SignatureVerifier using the passed in PublicKey.
-func NewSignatureVerifier(pk crypto.PublicKey) (*SignatureVerifier, error) {
+// SignatureAlgorithmForKey returns the algorithm signatures by pk are made
+// with: RSA PKCS#1 v1.5 or ECDSA, each over a SHA-256 hash, or Ed25519.
+func SignatureAlgorithmForKey(pk crypto.PublicKey) (SignatureAlgorithm, error) {
+	switch pk.(type) {
+	case *rsa.PublicKey:
+		return RSA, nil
+	case *ecdsa.PublicKey:
+		return ECDSA, nil
+	case ed25519.PublicKey:
+		return Ed25519, nil
+	}
+	return Anonymous, fmt.Errorf("Unsupported public key type %T", pk)
+}
+
+// LogVerifier verifies signatures made with a log's public key, for any of
+// the algorithms which appear in log lists.  The key must be RSA, of at least
+// 2048 bits, ECDSA on the P-256 curve (RFC6962 section 2.1.4), or Ed25519.
+type LogVerifier struct {
+	pubKey    crypto.PublicKey
+	keyID     SHA256Hash
+	algorithm SignatureAlgorithm
+}
+
+// NewLogVerifier returns a LogVerifier for the public key pk.
+func NewLogVerifier(pk crypto.PublicKey) (*LogVerifier, error) {
 	switch pkType := pk.(type) {
 	case *rsa.PublicKey:
 		if pkType.N.BitLen() < 2048 {
@@ -55,47 +84,95 @@ func NewSignatureVerifier(pk crypto.PublicKey) (*SignatureVerifier, error) {
 			log.Printf("WARNING: %v", e)
 
 		}
+	case ed25519.PublicKey:
+		if len(pkType) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("public key is Ed25519 with %d bytes, not %d", len(pkType), ed25519.PublicKeySize)
+		}
 	default:
 		return nil, fmt.Errorf("Unsupported public key type %v", pkType)
 	}
+	algorithm, err := SignatureAlgorithmForKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := KeyID(pk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %v", err)
+	}
+	return &LogVerifier{pubKey: pk, keyID: keyID, algorithm: algorithm}, nil
+}
 
-	return &SignatureVerifier{
-		pubKey: pk,
-	}, nil
+// NewLogVerifierFromDER returns a LogVerifier for the public key in the DER
+// encoded SubjectPublicKeyInfo spki, as logs are described in log lists.
+func NewLogVerifierFromDER(spki []byte) (*LogVerifier, error) {
+	pk, err := PublicKeyFromDER(spki)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	return NewLogVerifier(pk)
 }
 
-// verifySignature verifies that the passed in signature over data was created by our PublicKey.
-// Currently, only SHA256 is supported as a HashAlgorithm, and only ECDSA and RSA signatures are supported.
-func (s SignatureVerifier) verifySignature(data []byte, sig DigitallySigned) error {
-	if sig.HashAlgorithm != SHA256 {
+// PublicKey returns the key signatures are verified with.
+func (v *LogVerifier) PublicKey() crypto.PublicKey {
+	return v.pubKey
+}
+
+// KeyID returns the ID of the log whose key it is.
+func (v *LogVerifier) KeyID() SHA256Hash {
+	return v.keyID
+}
+
+// SignatureAlgorithm returns the algorithm the key signs with.
+func (v *LogVerifier) SignatureAlgorithm() SignatureAlgorithm {
+	return v.algorithm
+}
+
+// Verify verifies that sig is a signature by the key over data.  RSA and
+// ECDSA signatures must be over a SHA-256 hash of data, and Ed25519
+// signatures, which sign data itself, must have the Intrinsic hash algorithm
+// (RFC8422 section 5.1.3).
+func (v *LogVerifier) Verify(data []byte, sig DigitallySigned) error {
+	want := SHA256
+	if sig.SignatureAlgorithm == Ed25519 {
+		want = Intrinsic
+	}
+	if sig.HashAlgorithm != want {
 		return fmt.Errorf("unsupported HashAlgorithm in signature: %v", sig.HashAlgorithm)
 	}
+	return v.verify(data, sig.SignatureAlgorithm, sig.Signature)
+}
 
-	hasherType := crypto.SHA256
-	hasher := hasherType.New()
-	if _, err := hasher.Write(data); err != nil {
-		return fmt.Errorf("failed to write to hasher: %v", err)
-	}
-	hash := hasher.Sum([]byte{})
+// VerifyImplicit verifies that signature is a signature by the key over data,
+// for signatures which don't say which algorithm they use, which is instead
+// fixed by the key, such as those of v2 logs (RFC9162 section 2.1.4) and of
+// log lists.
+func (v *LogVerifier) VerifyImplicit(data, signature []byte) error {
+	return v.verify(data, v.algorithm, signature)
+}
 
-	switch sig.SignatureAlgorithm {
+// verify verifies that |signature| is a signature by the key, using
+// |algorithm|, over |data|, or the SHA-256 hash of |data| for algorithms
+// other than Ed25519.
+func (v *LogVerifier) verify(data []byte, algorithm SignatureAlgorithm, signature []byte) error {
+	hash := sha256.Sum256(data)
+	switch algorithm {
 	case RSA:
-		rsaKey, ok := s.pubKey.(*rsa.PublicKey)
+		rsaKey, ok := v.pubKey.(*rsa.PublicKey)
 		if !ok {
-			return fmt.Errorf("cannot verify RSA signature with %T key", s.pubKey)
+			return fmt.Errorf("cannot verify RSA signature with %T key", v.pubKey)
 		}
-		if err := rsa.VerifyPKCS1v15(rsaKey, hasherType, hash, sig.Signature); err != nil {
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, hash[:], signature); err != nil {
 			return fmt.Errorf("failed to verify rsa signature: %v", err)
 		}
 	case ECDSA:
-		ecdsaKey, ok := s.pubKey.(*ecdsa.PublicKey)
+		ecdsaKey, ok := v.pubKey.(*ecdsa.PublicKey)
 		if !ok {
-			return fmt.Errorf("cannot verify ECDSA signature with %T key", s.pubKey)
+			return fmt.Errorf("cannot verify ECDSA signature with %T key", v.pubKey)
 		}
 		var ecdsaSig struct {
 			R, S *big.Int
 		}
-		rest, err := asn1.Unmarshal(sig.Signature, &ecdsaSig)
+		rest, err := asn1.Unmarshal(signature, &ecdsaSig)
 		if err != nil {
 			return fmt.Errorf("failed to unmarshal ECDSA signature: %v", err)
 		}
@@ -103,15 +180,59 @@ func (s SignatureVerifier) verifySignature(data []byte, sig DigitallySigned) err
 			log.Printf("Garbage following signature %v", rest)
 		}
 
-		if !ecdsa.Verify(ecdsaKey, hash, ecdsaSig.R, ecdsaSig.S) {
+		if !ecdsa.Verify(ecdsaKey, hash[:], ecdsaSig.R, ecdsaSig.S) {
 			return errors.New("failed to verify ecdsa signature")
 		}
+	case Ed25519:
+		edKey, ok := v.pubKey.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("cannot verify Ed25519 signature with %T key", v.pubKey)
+		}
+		if !ed25519.Verify(edKey, data, signature) {
+			return errors.New("failed to verify ed25519 signature")
+		}
 	default:
-		return fmt.Errorf("unsupported signature type %v", sig.SignatureAlgorithm)
+		return fmt.Errorf("unsupported signature type %v", algorithm)
 	}
 	return nil
 }
 
+// PublicKeyFromDER parses a DER encoded SubjectPublicKeyInfo, such as a log's
+// key in a log list.
+func PublicKeyFromDER(der []byte) (crypto.PublicKey, error) {
+	return x509.ParsePKIXPublicKey(der)
+}
+
+// SignatureVerifier can verify signatures on SCTs and STHs
+type SignatureVerifier struct {
+	v *LogVerifier
+}
+
+// NewSignatureVerifier creates a new SignatureVerifier using the passed in PublicKey.
+func NewSignatureVerifier(pk crypto.PublicKey) (*SignatureVerifier, error) {
+	v, err := NewLogVerifier(pk)
+	if err != nil {
+		return nil, err
+	}
+	return &SignatureVerifier{v: v}, nil
+}
+
+// LogVerifier returns the LogVerifier which verifies the signatures.
+func (s SignatureVerifier) LogVerifier() *LogVerifier {
+	return s.v
+}
+
+// verifySignature verifies that the passed in signature over data was created by our PublicKey.
+func (s SignatureVerifier) verifySignature(data []byte, sig DigitallySigned) error {
+	return s.v.Verify(data, sig)
+}
+
+// VerifySignature verifies that sig is a signature by our PublicKey over
+// data, for signed structures other than SCTs and STHs.
+func (s SignatureVerifier) VerifySignature(data []byte, sig DigitallySigned) error {
+	return s.v.Verify(data, sig)
+}
+
 // VerifySCTSignature verifies that the SCT's signature is valid for the given LogEntry
 func (s SignatureVerifier) VerifySCTSignature(sct SignedCertificateTimestamp, entry LogEntry) error {
 	sctData, err := SerializeSCTSignatureInput(sct, entry)
@@ -129,3 +250,31 @@ func (s SignatureVerifier) VerifySTHSignature(sth SignedTreeHead) error {
 	}
 	return s.verifySignature(sthData, sth.TreeHeadSignature)
 }
+
+// verifyV2Signature verifies a v2 log's signature over |data|.  V2
+// signatures don't say which algorithm they use, which is instead fixed by
+// the log's key: ECDSA keys sign with ECDSA and SHA-256, RSA keys with PKCS#1
+// v1.5 and SHA-256 (RFC9162 section 2.1.4), and Ed25519 keys with Ed25519.
+func (s SignatureVerifier) verifyV2Signature(data, signature []byte) error {
+	return s.v.VerifyImplicit(data, signature)
+}
+
+// VerifySCTV2Signature verifies that the v2 SCT |sct|'s signature is valid
+// for |entry|, the TransItem holding the entry the SCT was issued for (see
+// EntryTransItemForSCTV2).
+func (s SignatureVerifier) VerifySCTV2Signature(sct SignedCertificateTimestampDataV2, entry TransItem) error {
+	data, err := SerializeSCTV2SignatureInput(entry)
+	if err != nil {
+		return err
+	}
+	return s.verifyV2Signature(data, sct.Signature)
+}
+
+// VerifySTHV2Signature verifies that the v2 STH's signature is valid.
+func (s SignatureVerifier) VerifySTHV2Signature(sth SignedTreeHeadDataV2) error {
+	data, err := SerializeSTHV2SignatureInput(sth)
+	if err != nil {
+		return err
+	}
+	return s.verifyV2Signature(data, sth.Signature)
+}
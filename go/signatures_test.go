@@ -5,9 +5,12 @@ import (
 	"crypto"
 	"crypto/dsa"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/hex"
 	mrand "math/rand"
 	"testing"
@@ -130,7 +133,7 @@ const (
 	sigTestKeyIDRSA = "b853f84c71a7aa5f23905ba5340f183af927c330c7ce590ba1524981c4ec4358"
 )
 
-func mustDehex(t *testing.T, h string) []byte {
+func mustDehex(t testing.TB, h string) []byte {
 	r, err := hex.DecodeString(h)
 	if err != nil {
 		t.Fatalf("Failed to decode hex string (%s): %v", h, err)
@@ -461,3 +464,107 @@ func TestWillAllowNonCompliantRSAKeyWithOverride(t *testing.T) {
 		t.Fatalf("Incorrectly disallowed 1024 bit RSA key with override set: %v", err)
 	}
 }
+
+func TestLogVerifierEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to marshal Ed25519 key: %v", err)
+	}
+	v, err := NewLogVerifierFromDER(der)
+	if err != nil {
+		t.Fatalf("NewLogVerifierFromDER()=_,%v", err)
+	}
+	if v.KeyID() != sha256.Sum256(der) {
+		t.Errorf("KeyID()=%x, want the SHA-256 hash of the SubjectPublicKeyInfo", v.KeyID())
+	}
+	if v.SignatureAlgorithm() != Ed25519 {
+		t.Errorf("SignatureAlgorithm()=%v, want Ed25519", v.SignatureAlgorithm())
+	}
+
+	data := []byte("data")
+	sig := DigitallySigned{HashAlgorithm: Intrinsic, SignatureAlgorithm: Ed25519, Signature: ed25519.Sign(priv, data)}
+	if err := v.Verify(data, sig); err != nil {
+		t.Errorf("Verify()=%v", err)
+	}
+	if err := v.VerifyImplicit(data, sig.Signature); err != nil {
+		t.Errorf("VerifyImplicit()=%v", err)
+	}
+	if err := v.Verify([]byte("other data"), sig); err == nil {
+		t.Error("Verify() succeeded for other data")
+	}
+	withHash := sig
+	withHash.HashAlgorithm = SHA256
+	if err := v.Verify(data, withHash); err == nil {
+		t.Error("Verify() succeeded for an Ed25519 signature with a SHA-256 hash")
+	}
+	asECDSA := sig
+	asECDSA.HashAlgorithm, asECDSA.SignatureAlgorithm = SHA256, ECDSA
+	if err := v.Verify(data, asECDSA); err == nil {
+		t.Error("Verify() succeeded for an ECDSA signature with an Ed25519 key")
+	}
+
+	sv, err := NewSignatureVerifier(pub)
+	if err != nil {
+		t.Fatalf("NewSignatureVerifier()=_,%v", err)
+	}
+	sth := SignedTreeHead{Version: V1, TreeSize: 5, Timestamp: 1234}
+	input, err := SerializeSTHSignatureInput(sth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sth.TreeHeadSignature = DigitallySigned{HashAlgorithm: Intrinsic, SignatureAlgorithm: Ed25519, Signature: ed25519.Sign(priv, input)}
+	if err := sv.VerifySTHSignature(sth); err != nil {
+		t.Errorf("VerifySTHSignature()=%v", err)
+	}
+}
+
+func TestLogVerifierKeyID(t *testing.T) {
+	for _, pemKey := range []string{sigTestEC256PublicKeyPEM, sigTestRSAPublicKeyPEM} {
+		pk, id, _, err := PublicKeyFromPEM([]byte(pemKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := KeyID(pk)
+		if err != nil || got != id {
+			t.Errorf("KeyID()=%x,%v, want %x", got, err, id)
+		}
+		v, err := NewLogVerifier(pk)
+		if err != nil {
+			t.Fatalf("NewLogVerifier()=_,%v", err)
+		}
+		if v.KeyID() != id || v.PublicKey() != pk {
+			t.Errorf("got verifier for key %v with ID %x, want %v with ID %x", v.PublicKey(), v.KeyID(), pk, id)
+		}
+	}
+}
+
+func TestSignatureAlgorithmForKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key     crypto.PublicKey
+		want    SignatureAlgorithm
+		wantErr bool
+	}{
+		{&ecKey.PublicKey, ECDSA, false},
+		{sigTestRSAPublicKey(t), RSA, false},
+		{edKey, Ed25519, false},
+		{ecKey, Anonymous, true},
+	}
+	for i, test := range tests {
+		got, err := SignatureAlgorithmForKey(test.key)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("#%d: SignatureAlgorithmForKey()=%v,%v, want %v (error: %t)", i, got, err, test.want, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const migrationsSchema = `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+                schema          STRING NOT NULL,
+                version         INTEGER NOT NULL,
+                description     STRING NOT NULL,
+                applied         INTEGER NOT NULL,
+                PRIMARY KEY (schema, version)
+        );`
+
+const selectSchemaVersion = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations WHERE schema = $1;`
+const insertMigration = `INSERT INTO schema_migrations(schema, version, description, applied) VALUES ($1, $2, $3, $4);`
+
+// Migration is a step in the evolution of a schema: SQL statements changing
+// the tables of a database from one version of the schema to the next.
+type Migration struct {
+	Description string
+	SQL         string
+}
+
+// SchemaTooNewError is returned by Migrate for a database whose schema has
+// been migrated past the latest version known, by newer code.
+type SchemaTooNewError struct {
+	Schema  string
+	Version int
+	Latest  int
+}
+
+func (e SchemaTooNewError) Error() string {
+	return fmt.Sprintf("schema %s is at version %d, newer than the latest known, %d", e.Schema, e.Version, e.Latest)
+}
+
+// Migrate brings the schema named schema in db up to date, by applying those
+// of migrations which haven't been applied yet, in order.  migrations[i]
+// brings the schema to version i+1, so once released a migration mustn't
+// change; the schema can only evolve by appending new ones.  The versions
+// applied are recorded in db's schema_migrations table, in the same
+// transaction as the migrations themselves, so a migration which fails
+// leaves the database as it was, and processes migrating the same database at
+// once don't both apply a migration.
+func Migrate(db *sql.DB, schema string, migrations []Migration) error {
+	if _, err := db.Exec(migrationsSchema); err != nil {
+		return err
+	}
+	for {
+		done, err := migrateOnce(db, schema, migrations)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// migrateOnce applies the next of migrations which the schema needs, if any,
+// and reports whether the schema is up to date.
+func migrateOnce(db *sql.DB, schema string, migrations []Migration) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var version int
+	if err := tx.QueryRow(selectSchemaVersion, schema).Scan(&version); err != nil {
+		return false, err
+	}
+	if version > len(migrations) {
+		return false, SchemaTooNewError{Schema: schema, Version: version, Latest: len(migrations)}
+	}
+	if version == len(migrations) {
+		return true, nil
+	}
+	m := migrations[version]
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return false, fmt.Errorf("migrating schema %s to version %d (%s): %v", schema, version+1, m.Description, err)
+	}
+	if _, err := tx.Exec(insertMigration, schema, version+1, m.Description, time.Now().Unix()); err != nil {
+		return false, err
+	}
+	return false, tx.Commit()
+}
+
+// SchemaVersion returns the version of the schema named schema in db, as
+// recorded by Migrate, or zero if it has never been migrated.
+func SchemaVersion(db *sql.DB, schema string) (int, error) {
+	if _, err := db.Exec(migrationsSchema); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRow(selectSchemaVersion, schema).Scan(&version)
+	return version, err
+}
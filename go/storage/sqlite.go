@@ -0,0 +1,417 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/sctstore"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// migrations are the SQLite schema's, in order.
+var migrations = []Migration{
+	{"Create the STH, SCT, consistency proof and audit result tables", `
+        CREATE TABLE IF NOT EXISTS log_sths (
+                log_url         STRING NOT NULL,
+                version         INTEGER NOT NULL,
+                tree_size       INTEGER NOT NULL,
+                timestamp       INTEGER NOT NULL,
+                root_hash       BYTES NOT NULL,
+                signature       BYTES NOT NULL,
+                log_id          BYTES NOT NULL,
+                PRIMARY KEY (log_url, timestamp, tree_size, root_hash)
+        );
+
+        CREATE TABLE IF NOT EXISTS cert_scts (
+                cert_sha256     BYTES NOT NULL,
+                log_id          BYTES NOT NULL,
+                timestamp       INTEGER NOT NULL,
+                sct             BYTES NOT NULL,
+                log_url         STRING NOT NULL,
+                source          STRING NOT NULL,
+                PRIMARY KEY (cert_sha256, log_id)
+        );
+
+        CREATE TABLE IF NOT EXISTS consistency_proofs (
+                log_url         STRING NOT NULL,
+                first_size      INTEGER NOT NULL,
+                second_size     INTEGER NOT NULL,
+                first_hash      BYTES NOT NULL,
+                second_hash     BYTES NOT NULL,
+                proof           BYTES NOT NULL,
+                PRIMARY KEY (log_url, first_size, second_size)
+        );
+
+        CREATE TABLE IF NOT EXISTS audit_results (
+                host            STRING NOT NULL,
+                time            INTEGER NOT NULL,
+                error           STRING NOT NULL,
+                policies        STRING NOT NULL,
+                PRIMARY KEY (host, time)
+        );`},
+	{"Create the SCT entry and inclusion tables", `
+        CREATE TABLE IF NOT EXISTS sct_entries (
+                log_id          BYTES NOT NULL,
+                leaf_hash       BYTES NOT NULL,
+                sct             BYTES NOT NULL,
+                leaf            BYTES NOT NULL,
+                PRIMARY KEY (log_id, leaf_hash)
+        );
+
+        CREATE TABLE IF NOT EXISTS sct_inclusions (
+                log_id          BYTES NOT NULL,
+                leaf_hash       BYTES NOT NULL,
+                status          STRING NOT NULL,
+                checked         INTEGER NOT NULL,
+                tree_size       INTEGER NOT NULL,
+                sth_timestamp   INTEGER NOT NULL,
+                leaf_index      INTEGER NOT NULL,
+                error           STRING NOT NULL,
+                PRIMARY KEY (log_id, leaf_hash)
+        );`},
+}
+
+const insertSTH = `INSERT OR IGNORE INTO log_sths(log_url, version, tree_size, timestamp, root_hash, signature, log_id) VALUES ($1, $2, $3, $4, $5, $6, $7);`
+const selectLatestSTH = `SELECT version, tree_size, timestamp, root_hash, signature, log_id FROM log_sths WHERE log_url = $1 ORDER BY timestamp DESC, tree_size DESC LIMIT 1;`
+const selectSTHs = `SELECT version, tree_size, timestamp, root_hash, signature, log_id FROM log_sths WHERE log_url = $1 ORDER BY timestamp, tree_size;`
+
+const insertSCT = `INSERT OR IGNORE INTO cert_scts(cert_sha256, log_id, timestamp, sct, log_url, source) VALUES ($1, $2, $3, $4, $5, $6);`
+const selectSCTs = `SELECT sct, log_url, source FROM cert_scts WHERE cert_sha256 = $1 ORDER BY timestamp;`
+
+const insertProof = `INSERT OR IGNORE INTO consistency_proofs(log_url, first_size, second_size, first_hash, second_hash, proof) VALUES ($1, $2, $3, $4, $5, $6);`
+const selectProof = `SELECT first_hash, second_hash, proof FROM consistency_proofs WHERE log_url = $1 AND first_size = $2 AND second_size = $3;`
+
+const insertSCTEntry = `INSERT OR IGNORE INTO sct_entries(log_id, leaf_hash, sct, leaf) VALUES ($1, $2, $3, $4);`
+
+// Select at most $1 of the entries not proven to be included, in order of
+// ID; or for the latter, at most $3 of those after the entry with ID ($1, $2).
+const selectUnprovenEntries = `SELECT e.log_id, e.leaf_hash, e.sct, e.leaf FROM sct_entries e
+                                  LEFT JOIN sct_inclusions i ON i.log_id = e.log_id AND i.leaf_hash = e.leaf_hash
+                                  WHERE i.status IS NULL OR i.status != 'included'
+                                  ORDER BY e.log_id, e.leaf_hash LIMIT $1;`
+const selectUnprovenEntriesAfter = `SELECT e.log_id, e.leaf_hash, e.sct, e.leaf FROM sct_entries e
+                                       LEFT JOIN sct_inclusions i ON i.log_id = e.log_id AND i.leaf_hash = e.leaf_hash
+                                       WHERE (i.status IS NULL OR i.status != 'included') AND (e.log_id > $1 OR (e.log_id = $1 AND e.leaf_hash > $2))
+                                       ORDER BY e.log_id, e.leaf_hash LIMIT $3;`
+
+const upsertInclusion = `INSERT OR REPLACE INTO sct_inclusions(log_id, leaf_hash, status, checked, tree_size, sth_timestamp, leaf_index, error) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+const selectInclusion = `SELECT status, checked, tree_size, sth_timestamp, leaf_index, error FROM sct_inclusions WHERE log_id = $1 AND leaf_hash = $2;`
+
+const upsertAuditResult = `INSERT OR REPLACE INTO audit_results(host, time, error, policies) VALUES ($1, $2, $3, $4);`
+const selectAuditResults = `SELECT time, error, policies FROM audit_results WHERE host = $1 ORDER BY time;`
+
+// SQLiteStore is a Store which keeps everything in an SQLite3 database, which
+// may be shared with other tools' tables.  Its schema is migrated to the
+// latest version when it is opened.
+type SQLiteStore struct {
+	db                 *sql.DB
+	insertSTH          *sql.Stmt
+	selectLatestSTH    *sql.Stmt
+	selectSTHs         *sql.Stmt
+	insertSCT          *sql.Stmt
+	selectSCTs         *sql.Stmt
+	insertProof        *sql.Stmt
+	selectProof        *sql.Stmt
+	upsertAuditResult  *sql.Stmt
+	selectAuditResults *sql.Stmt
+
+	insertSCTEntry             *sql.Stmt
+	selectUnprovenEntries      *sql.Stmt
+	selectUnprovenEntriesAfter *sql.Stmt
+	upsertInclusion            *sql.Stmt
+	selectInclusion            *sql.Stmt
+}
+
+// NewSQLiteStore opens the SQLite3 database at dbPath, creating it if it
+// doesn't exist, and migrates its schema.
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	if len(dbPath) == 0 {
+		return nil, errors.New("empty database file name")
+	}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLiteStore{db: db}
+	if err := Migrate(db, "storage", migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, p := range []struct {
+		stmt **sql.Stmt
+		sql  string
+	}{
+		{&s.insertSTH, insertSTH},
+		{&s.selectLatestSTH, selectLatestSTH},
+		{&s.selectSTHs, selectSTHs},
+		{&s.insertSCT, insertSCT},
+		{&s.selectSCTs, selectSCTs},
+		{&s.insertProof, insertProof},
+		{&s.selectProof, selectProof},
+		{&s.upsertAuditResult, upsertAuditResult},
+		{&s.selectAuditResults, selectAuditResults},
+		{&s.insertSCTEntry, insertSCTEntry},
+		{&s.selectUnprovenEntries, selectUnprovenEntries},
+		{&s.selectUnprovenEntriesAfter, selectUnprovenEntriesAfter},
+		{&s.upsertInclusion, upsertInclusion},
+		{&s.selectInclusion, selectInclusion},
+	} {
+		if *p.stmt, err = db.Prepare(p.sql); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Close implements sctstore.Store.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// StoreSTH implements STHStore.
+func (s *SQLiteStore) StoreSTH(logURL string, sth ct.SignedTreeHead) error {
+	sig, err := ct.MarshalDigitallySigned(sth.TreeHeadSignature)
+	if err != nil {
+		return err
+	}
+	_, err = s.insertSTH.Exec(logURL, int(sth.Version), int64(sth.TreeSize), int64(sth.Timestamp), sth.SHA256RootHash[:], sig, sth.LogID[:])
+	return err
+}
+
+// scanner is a row: an *sql.Row or *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSTH(row scanner) (*ct.SignedTreeHead, error) {
+	var version int
+	var size, timestamp int64
+	var root, sig, logID []byte
+	if err := row.Scan(&version, &size, &timestamp, &root, &sig, &logID); err != nil {
+		return nil, err
+	}
+	ds, err := ct.UnmarshalDigitallySigned(bytes.NewReader(sig))
+	if err != nil {
+		return nil, err
+	}
+	sth := &ct.SignedTreeHead{Version: ct.Version(version), TreeSize: uint64(size), Timestamp: uint64(timestamp), TreeHeadSignature: *ds}
+	copy(sth.SHA256RootHash[:], root)
+	copy(sth.LogID[:], logID)
+	return sth, nil
+}
+
+// LatestSTH implements STHStore.
+func (s *SQLiteStore) LatestSTH(logURL string) (*ct.SignedTreeHead, error) {
+	sth, err := scanSTH(s.selectLatestSTH.QueryRow(logURL))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sth, err
+}
+
+// STHs implements STHStore.
+func (s *SQLiteStore) STHs(logURL string) ([]ct.SignedTreeHead, error) {
+	rows, err := s.selectSTHs.Query(logURL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sths []ct.SignedTreeHead
+	for rows.Next() {
+		sth, err := scanSTH(rows)
+		if err != nil {
+			return nil, err
+		}
+		sths = append(sths, *sth)
+	}
+	return sths, rows.Err()
+}
+
+// Put implements sctstore.Store.
+func (s *SQLiteStore) Put(r sctstore.Record) error {
+	b, err := ct.SerializeSCT(r.SCT)
+	if err != nil {
+		return err
+	}
+	_, err = s.insertSCT.Exec(r.CertSHA256[:], r.SCT.LogID[:], int64(r.SCT.Timestamp), b, r.LogURL, string(r.Source))
+	return err
+}
+
+// Get implements sctstore.Store.
+func (s *SQLiteStore) Get(certSHA256 [sha256.Size]byte) ([]sctstore.Record, error) {
+	rows, err := s.selectSCTs.Query(certSHA256[:])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []sctstore.Record
+	for rows.Next() {
+		var b []byte
+		var source string
+		r := sctstore.Record{CertSHA256: certSHA256}
+		if err := rows.Scan(&b, &r.LogURL, &source); err != nil {
+			return nil, err
+		}
+		sct, err := ct.DeserializeSCT(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		r.SCT = *sct
+		r.Source = sctstore.Source(source)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// StoreConsistencyProof implements ProofStore.  The proof's nodes are stored
+// concatenated, so must all be SHA-256 hashes.
+func (s *SQLiteStore) StoreConsistencyProof(p ConsistencyProof) error {
+	var proof []byte
+	for _, node := range p.Proof {
+		if len(node) != sha256.Size {
+			return fmt.Errorf("consistency proof node is %d bytes, not %d", len(node), sha256.Size)
+		}
+		proof = append(proof, node...)
+	}
+	_, err := s.insertProof.Exec(p.LogURL, int64(p.FirstSize), int64(p.SecondSize), p.FirstHash[:], p.SecondHash[:], proof)
+	return err
+}
+
+// ConsistencyProof implements ProofStore.
+func (s *SQLiteStore) ConsistencyProof(logURL string, first, second uint64) (*ConsistencyProof, error) {
+	var firstHash, secondHash, proof []byte
+	err := s.selectProof.QueryRow(logURL, int64(first), int64(second)).Scan(&firstHash, &secondHash, &proof)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(proof)%sha256.Size != 0 {
+		return nil, fmt.Errorf("stored consistency proof is %d bytes, not a multiple of %d", len(proof), sha256.Size)
+	}
+	p := &ConsistencyProof{LogURL: logURL}
+	p.FirstSize, p.SecondSize = first, second
+	copy(p.FirstHash[:], firstHash)
+	copy(p.SecondHash[:], secondHash)
+	for ; len(proof) > 0; proof = proof[sha256.Size:] {
+		p.Proof = append(p.Proof, proof[:sha256.Size])
+	}
+	return p, nil
+}
+
+// StoreAuditResult implements AuditStore.
+func (s *SQLiteStore) StoreAuditResult(r AuditResult) error {
+	policies, err := json.Marshal(r.Policies)
+	if err != nil {
+		return err
+	}
+	_, err = s.upsertAuditResult.Exec(r.Host, r.Time.UnixNano(), r.Error, string(policies))
+	return err
+}
+
+// AuditResults implements AuditStore.  The results' times are in UTC.
+func (s *SQLiteStore) AuditResults(host string) ([]AuditResult, error) {
+	rows, err := s.selectAuditResults.Query(host)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []AuditResult
+	for rows.Next() {
+		var t int64
+		var policies string
+		r := AuditResult{Host: host}
+		if err := rows.Scan(&t, &r.Error, &policies); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(policies), &r.Policies); err != nil {
+			return nil, err
+		}
+		r.Time = time.Unix(0, t).UTC()
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// StoreSCTEntry implements InclusionStore.
+func (s *SQLiteStore) StoreSCTEntry(e SCTEntry) error {
+	sct, err := ct.SerializeSCT(e.SCT)
+	if err != nil {
+		return err
+	}
+	leaf, err := ct.SerializeMerkleTreeLeaf(e.Leaf)
+	if err != nil {
+		return err
+	}
+	_, err = s.insertSCTEntry.Exec(e.LogID[:], e.LeafHash[:], sct, leaf)
+	return err
+}
+
+// UnprovenSCTEntries implements InclusionStore.
+func (s *SQLiteStore) UnprovenSCTEntries(after *EntryID, limit int) ([]SCTEntry, error) {
+	var rows *sql.Rows
+	var err error
+	if after == nil {
+		rows, err = s.selectUnprovenEntries.Query(limit)
+	} else {
+		rows, err = s.selectUnprovenEntriesAfter.Query(after.LogID[:], after.LeafHash[:], limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []SCTEntry
+	for rows.Next() {
+		var logID, leafHash, sctData, leafData []byte
+		if err := rows.Scan(&logID, &leafHash, &sctData, &leafData); err != nil {
+			return nil, err
+		}
+		var e SCTEntry
+		copy(e.LogID[:], logID)
+		copy(e.LeafHash[:], leafHash)
+		sct, err := ct.DeserializeSCT(bytes.NewReader(sctData))
+		if err != nil {
+			return nil, err
+		}
+		e.SCT = *sct
+		leaf, err := ct.ReadMerkleTreeLeaf(bytes.NewReader(leafData))
+		if err != nil {
+			return nil, err
+		}
+		e.Leaf = *leaf
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// StoreInclusion implements InclusionStore.
+func (s *SQLiteStore) StoreInclusion(in Inclusion) error {
+	_, err := s.upsertInclusion.Exec(in.LogID[:], in.LeafHash[:], string(in.Status), in.Checked.UnixNano(), int64(in.TreeSize), int64(in.STHTimestamp), in.LeafIndex, in.Error)
+	return err
+}
+
+// Inclusion implements InclusionStore.  The time checked is in UTC.
+func (s *SQLiteStore) Inclusion(id EntryID) (*Inclusion, error) {
+	in := &Inclusion{EntryID: id}
+	var status string
+	var checked, size, timestamp int64
+	err := s.selectInclusion.QueryRow(id.LogID[:], id.LeafHash[:]).Scan(&status, &checked, &size, &timestamp, &in.LeafIndex, &in.Error)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	in.Status = InclusionStatus(status)
+	in.Checked = time.Unix(0, checked).UTC()
+	in.TreeSize, in.STHTimestamp = uint64(size), uint64(timestamp)
+	return in, nil
+}
@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/sctstore"
+)
+
+// sqliteAvailable reports whether the SQLite3 driver is usable, which it
+// isn't in builds without cgo.
+func sqliteAvailable() bool {
+	for _, d := range sql.Drivers() {
+		if d == "sqlite3" {
+			return true
+		}
+	}
+	return false
+}
+
+// tempDB returns the path of a database file in a new temporary directory,
+// and a function removing the directory.  The test is skipped if SQLite3
+// isn't available.
+func tempDB(t *testing.T) (string, func()) {
+	if !sqliteAvailable() {
+		t.Skip("SQLite3 driver unavailable")
+	}
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "ct.db"), func() { os.RemoveAll(dir) }
+}
+
+func TestMigrate(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ms := []Migration{
+		{"Create things", `CREATE TABLE things (name STRING NOT NULL);`},
+		{"Add thing sizes", `ALTER TABLE things ADD COLUMN size INTEGER NOT NULL DEFAULT 0;`},
+	}
+	if err := Migrate(db, "things", ms[:1]); err != nil {
+		t.Fatalf("Migrate(version 1)=%v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO things(name) VALUES ('a');`); err != nil {
+		t.Fatal(err)
+	}
+	// Migrating again applies only the new migration, keeping the data.
+	for i := 0; i < 2; i++ {
+		if err := Migrate(db, "things", ms); err != nil {
+			t.Fatalf("Migrate(version 2)=%v", err)
+		}
+	}
+	var size int
+	if err := db.QueryRow(`SELECT size FROM things WHERE name = 'a';`).Scan(&size); err != nil {
+		t.Errorf("migrated table has no size: %v", err)
+	}
+	if v, err := SchemaVersion(db, "things"); err != nil || v != 2 {
+		t.Errorf("SchemaVersion()=%d,%v, want 2", v, err)
+	}
+	if v, err := SchemaVersion(db, "other"); err != nil || v != 0 {
+		t.Errorf("SchemaVersion(unmigrated)=%d,%v, want 0", v, err)
+	}
+
+	// Older code can't use the migrated schema.
+	if err, ok := Migrate(db, "things", ms[:1]).(SchemaTooNewError); !ok || err.Version != 2 || err.Latest != 1 {
+		t.Errorf("Migrate(older migrations)=%v, want SchemaTooNewError", err)
+	}
+
+	// A failed migration is rolled back, and not recorded as applied.
+	bad := append(ms, Migration{"Break things", `CREATE TABLE more_things (name STRING); CREATE TABLE things (name STRING);`})
+	if err := Migrate(db, "things", bad); err == nil {
+		t.Error("Migrate(failing migration)=nil, want error")
+	}
+	if v, err := SchemaVersion(db, "things"); err != nil || v != 2 {
+		t.Errorf("SchemaVersion() after failed migration=%d,%v, want 2", v, err)
+	}
+	if _, err := db.Exec(`SELECT * FROM more_things;`); err == nil {
+		t.Error("failed migration's table exists")
+	}
+}
+
+func testSCT(logID byte, timestamp uint64) ct.SignedCertificateTimestamp {
+	sct := ct.SignedCertificateTimestamp{
+		SCTVersion: ct.V1,
+		Timestamp:  timestamp,
+		Extensions: ct.CTExtensions{},
+		Signature:  ct.DigitallySigned{HashAlgorithm: ct.SHA256, SignatureAlgorithm: ct.ECDSA, Signature: []byte("sig")},
+	}
+	sct.LogID[0] = logID
+	return sct
+}
+
+func testSTH(size, timestamp uint64, root byte) ct.SignedTreeHead {
+	sth := ct.SignedTreeHead{
+		Version:           ct.V1,
+		TreeSize:          size,
+		Timestamp:         timestamp,
+		TreeHeadSignature: ct.DigitallySigned{HashAlgorithm: ct.SHA256, SignatureAlgorithm: ct.ECDSA, Signature: []byte("sig")},
+	}
+	sth.SHA256RootHash[0] = root
+	sth.LogID[0] = 1
+	return sth
+}
+
+func TestSQLiteStore(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+	var s Store
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore()=_,%v", err)
+	}
+
+	const logURL = "https://log.example.com/"
+	first, second := testSTH(10, 1000, 1), testSTH(12, 2000, 2)
+	if sth, err := s.LatestSTH(logURL); err != nil || sth != nil {
+		t.Errorf("LatestSTH(empty)=%v,%v, want nil", sth, err)
+	}
+	for _, sth := range []ct.SignedTreeHead{second, first, second} {
+		if err := s.StoreSTH(logURL, sth); err != nil {
+			t.Errorf("StoreSTH()=%v", err)
+		}
+	}
+	if sth, err := s.LatestSTH(logURL); err != nil || !reflect.DeepEqual(sth, &second) {
+		t.Errorf("LatestSTH()=%+v,%v, want %+v", sth, err, second)
+	}
+	if sths, err := s.STHs(logURL); err != nil || !reflect.DeepEqual(sths, []ct.SignedTreeHead{first, second}) {
+		t.Errorf("STHs()=%+v,%v, want %+v", sths, err, []ct.SignedTreeHead{first, second})
+	}
+
+	cert := sctstore.CertHash([]byte("cert"))
+	early := sctstore.Record{CertSHA256: cert, SCT: testSCT(2, 1000), Source: sctstore.FromScan}
+	late := sctstore.Record{CertSHA256: cert, SCT: testSCT(1, 2000), LogURL: logURL, Source: sctstore.FromSubmission}
+	for _, r := range []sctstore.Record{late, early} {
+		if err := s.Put(r); err != nil {
+			t.Errorf("Put()=%v", err)
+		}
+	}
+	if got, err := s.Get(cert); err != nil || !reflect.DeepEqual(got, []sctstore.Record{early, late}) {
+		t.Errorf("Get()=%+v,%v, want %+v", got, err, []sctstore.Record{early, late})
+	}
+
+	proof := ConsistencyProof{
+		LogURL:           logURL,
+		ConsistencyProof: client.ConsistencyProof{FirstSize: 10, SecondSize: 12, Proof: [][]byte{make([]byte, 32), make([]byte, 32)}},
+		FirstHash:        first.SHA256RootHash,
+		SecondHash:       second.SHA256RootHash,
+	}
+	proof.Proof[1][0] = 1
+	if err := s.StoreConsistencyProof(proof); err != nil {
+		t.Errorf("StoreConsistencyProof()=%v", err)
+	}
+	if got, err := s.ConsistencyProof(logURL, 10, 12); err != nil || !reflect.DeepEqual(got, &proof) {
+		t.Errorf("ConsistencyProof()=%+v,%v, want %+v", got, err, proof)
+	}
+	if got, err := s.ConsistencyProof(logURL, 10, 11); err != nil || got != nil {
+		t.Errorf("ConsistencyProof(unknown sizes)=%+v,%v, want nil", got, err)
+	}
+	bad := proof
+	bad.Proof = [][]byte{[]byte("short")}
+	if err := s.StoreConsistencyProof(bad); err == nil {
+		t.Error("StoreConsistencyProof(short node)=nil, want error")
+	}
+
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	results := []AuditResult{
+		{Host: "a.example.com", Time: start, Policies: map[string]string{"chrome": "", "apple": "too few SCTs"}},
+		{Host: "a.example.com", Time: start.Add(time.Hour), Error: "connection refused"},
+	}
+	for _, r := range []AuditResult{results[1], results[0], {Host: "b.example.com", Time: start}} {
+		if err := s.StoreAuditResult(r); err != nil {
+			t.Errorf("StoreAuditResult()=%v", err)
+		}
+	}
+	if got, err := s.AuditResults("a.example.com"); err != nil || !reflect.DeepEqual(got, results) {
+		t.Errorf("AuditResults()=%+v,%v, want %+v", got, err, results)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening the database keeps what was stored.
+	if s, err = NewSQLiteStore(path); err != nil {
+		t.Fatalf("NewSQLiteStore(again)=_,%v", err)
+	}
+	defer s.Close()
+	if sth, err := s.LatestSTH(logURL); err != nil || !reflect.DeepEqual(sth, &second) {
+		t.Errorf("LatestSTH() after reopening=%+v,%v, want %+v", sth, err, second)
+	}
+}
+
+func TestSQLiteInclusionStore(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore()=_,%v", err)
+	}
+	defer s.Close()
+
+	var entries []SCTEntry
+	for _, logID := range []byte{2, 1} {
+		for _, cert := range []string{"a", "b"} {
+			sct := testSCT(logID, 1000)
+			leaf := ct.MerkleTreeLeaf{
+				Version:  ct.V1,
+				LeafType: ct.TimestampedEntryLeafType,
+				TimestampedEntry: ct.TimestampedEntry{
+					Timestamp:  sct.Timestamp,
+					EntryType:  ct.X509LogEntryType,
+					X509Entry:  ct.ASN1Cert(cert),
+					Extensions: ct.CTExtensions{},
+				},
+			}
+			e, err := NewSCTEntry(sct, leaf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.StoreSCTEntry(*e); err != nil {
+				t.Errorf("StoreSCTEntry()=%v", err)
+			}
+			entries = append(entries, *e)
+		}
+	}
+	// Storing an entry again doesn't duplicate it.
+	if err := s.StoreSCTEntry(entries[0]); err != nil {
+		t.Errorf("StoreSCTEntry(again)=%v", err)
+	}
+
+	// Reads the unproven entries in pages of two.
+	unproven := func() map[EntryID]bool {
+		got := make(map[EntryID]bool)
+		var after *EntryID
+		for {
+			page, err := s.UnprovenSCTEntries(after, 2)
+			if err != nil {
+				t.Fatalf("UnprovenSCTEntries()=_,%v", err)
+			}
+			for _, e := range page {
+				if after != nil && e.LogID[0] < after.LogID[0] {
+					t.Errorf("entry %x returned after %x", e.LogID, after.LogID)
+				}
+				got[e.EntryID] = true
+			}
+			if len(page) < 2 {
+				return got
+			}
+			after = &page[len(page)-1].EntryID
+		}
+	}
+	if got := unproven(); len(got) != len(entries) {
+		t.Errorf("got %d unproven entries, want %d", len(got), len(entries))
+	}
+	page, err := s.UnprovenSCTEntries(nil, 1)
+	if err != nil || len(page) != 1 || page[0].LogID != entries[2].LogID || page[0].SCT.Timestamp != 1000 {
+		t.Errorf("UnprovenSCTEntries(first)=%+v,%v, want an entry of log 1", page, err)
+	}
+
+	checked := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	included := Inclusion{EntryID: entries[0].EntryID, Status: Included, Checked: checked, TreeSize: 10, STHTimestamp: 2000, LeafIndex: 3}
+	pending := Inclusion{EntryID: entries[1].EntryID, Status: Pending, Checked: checked, TreeSize: 10, STHTimestamp: 2000, Error: "not found"}
+	for _, in := range []Inclusion{pending, included} {
+		if err := s.StoreInclusion(in); err != nil {
+			t.Errorf("StoreInclusion()=%v", err)
+		}
+	}
+	if got, err := s.Inclusion(included.EntryID); err != nil || !reflect.DeepEqual(got, &included) {
+		t.Errorf("Inclusion()=%+v,%v, want %+v", got, err, included)
+	}
+	if got, err := s.Inclusion(entries[2].EntryID); err != nil || got != nil {
+		t.Errorf("Inclusion(unchecked)=%+v,%v, want nil", got, err)
+	}
+	// Entries proven to be included aren't returned again.
+	got := unproven()
+	if len(got) != len(entries)-1 || got[included.EntryID] || !got[pending.EntryID] {
+		t.Errorf("got unproven entries %v, want all but %v", got, included.EntryID)
+	}
+}
@@ -0,0 +1,176 @@
+// Package storage persists what CT monitors, auditors and gossipers verify:
+// logs' STHs, the SCTs obtained for certificates, the consistency proofs
+// between logs' tree heads, and the results of auditing hosts for CT
+// compliance.  Its SQLite schema is versioned and brought up to date by
+// Migrate whenever a database is opened; other packages keeping their own
+// tables in SQLite can use Migrate for their schemas too.
+package storage
+
+import (
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/merkle"
+	"github.com/google/certificate-transparency/go/sctstore"
+)
+
+// STHStore keeps the verified STHs of logs, which are identified by their
+// URLs.  It satisfies monitor.STHStore.  Implementations must be safe for
+// concurrent use.
+type STHStore interface {
+	// StoreSTH records sth as an STH of the log, unless it already is.
+	StoreSTH(logURL string, sth ct.SignedTreeHead) error
+	// LatestSTH returns the STH stored for the log with the latest
+	// timestamp, or nil if none has been stored.
+	LatestSTH(logURL string) (*ct.SignedTreeHead, error)
+	// STHs returns all the STHs stored for the log, ordered by timestamp.
+	STHs(logURL string) ([]ct.SignedTreeHead, error)
+}
+
+// ConsistencyProof is a verified proof that a log's tree of size FirstSize,
+// with root hash FirstHash, is a prefix of its tree of size SecondSize, with
+// root hash SecondHash.
+type ConsistencyProof struct {
+	LogURL string
+	client.ConsistencyProof
+	FirstHash, SecondHash ct.SHA256Hash
+}
+
+// ProofStore keeps verified consistency proofs, as evidence of how logs'
+// trees have grown.  Implementations must be safe for concurrent use.
+type ProofStore interface {
+	// StoreConsistencyProof records p, unless a proof between the same
+	// trees of the log already is.
+	StoreConsistencyProof(p ConsistencyProof) error
+	// ConsistencyProof returns the proof stored between the log's trees
+	// of sizes first and second, or nil if there is none.
+	ConsistencyProof(logURL string, first, second uint64) (*ConsistencyProof, error)
+}
+
+// AuditResult is the outcome of auditing a host for CT compliance, as
+// ctpolicy.Audit does.
+type AuditResult struct {
+	Host string
+	Time time.Time
+	// Why the host couldn't be probed, or "" if it was.
+	Error string
+	// The names of the policies checked, each mapped to why the host
+	// doesn't satisfy it, or to "" if it does.
+	Policies map[string]string
+}
+
+// Satisfied reports whether the host was probed and satisfied every policy
+// checked.
+func (r AuditResult) Satisfied() bool {
+	if r.Error != "" {
+		return false
+	}
+	for _, reason := range r.Policies {
+		if reason != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// AuditStore keeps the results of audits, so that hosts' compliance can be
+// followed over time.  Implementations must be safe for concurrent use.
+type AuditStore interface {
+	// StoreAuditResult records r, replacing any result for the same host
+	// at the same time.
+	StoreAuditResult(r AuditResult) error
+	// AuditResults returns the results stored for host, oldest first.
+	AuditResults(host string) ([]AuditResult, error)
+}
+
+// EntryID identifies an entry of a log by the log's ID and the hash of the
+// entry's leaf in its tree.
+type EntryID struct {
+	LogID    ct.SHA256Hash
+	LeafHash ct.SHA256Hash
+}
+
+// SCTEntry is an SCT, with the entry it was issued for, which the log must
+// incorporate into its tree within its Maximum Merge Delay.
+type SCTEntry struct {
+	EntryID
+	SCT  ct.SignedCertificateTimestamp
+	Leaf ct.MerkleTreeLeaf
+}
+
+// NewSCTEntry returns the SCTEntry of sct, for leaf, identified by the hash
+// of leaf.
+func NewSCTEntry(sct ct.SignedCertificateTimestamp, leaf ct.MerkleTreeLeaf) (*SCTEntry, error) {
+	input, err := ct.SerializeMerkleTreeLeaf(leaf)
+	if err != nil {
+		return nil, err
+	}
+	e := &SCTEntry{SCT: sct, Leaf: leaf}
+	e.LogID = sct.LogID
+	copy(e.LeafHash[:], merkle.NewSHA256TreeHasher().HashLeaf(input))
+	return e, nil
+}
+
+// InclusionStatus is what checking that a log has incorporated an SCT's
+// entry found.
+type InclusionStatus string
+
+// Inclusion statuses.
+const (
+	// The entry is proven to be included in a verified STH of the log.
+	Included InclusionStatus = "included"
+	// The entry isn't included in the log's STH, but the log's MMD hadn't
+	// passed since the SCT was issued when the STH was.
+	Pending InclusionStatus = "pending"
+	// The entry isn't included in the log's STH, from more than the log's
+	// MMD after the SCT was issued, so the log has misbehaved.
+	NotIncluded InclusionStatus = "not_included"
+	// The entry couldn't be checked, e.g. as the log couldn't be reached.
+	CheckFailed InclusionStatus = "check_failed"
+)
+
+// Inclusion is the outcome of checking that a log has incorporated an SCT's
+// entry.
+type Inclusion struct {
+	EntryID
+	Status InclusionStatus
+	// When the entry was checked.
+	Checked time.Time
+	// The size and timestamp of the STH the entry was checked against, if
+	// one was fetched.
+	TreeSize     uint64
+	STHTimestamp uint64
+	// The index of the entry in the tree, if it is Included.
+	LeafIndex int64
+	// Why the entry isn't Included, if it isn't.
+	Error string
+}
+
+// InclusionStore keeps SCTs' entries, and whether their logs have been found
+// to incorporate them, so that every SCT obtained can be checked.
+// Implementations must be safe for concurrent use.
+type InclusionStore interface {
+	// StoreSCTEntry records e, unless its entry already is.
+	StoreSCTEntry(e SCTEntry) error
+	// UnprovenSCTEntries returns up to limit of the entries stored which
+	// haven't been found Included, ordered by ID: log ID, then leaf hash.
+	// They start after the entry with ID after, or at the first if after
+	// is nil.
+	UnprovenSCTEntries(after *EntryID, limit int) ([]SCTEntry, error)
+	// StoreInclusion records in, replacing what was recorded for its
+	// entry.
+	StoreInclusion(in Inclusion) error
+	// Inclusion returns what was recorded for the entry with ID id, or
+	// nil if its inclusion hasn't been checked.
+	Inclusion(id EntryID) (*Inclusion, error)
+}
+
+// Store keeps all of the above, with SCTs kept as an sctstore.Store does.
+type Store interface {
+	STHStore
+	ProofStore
+	AuditStore
+	InclusionStore
+	sctstore.Store
+}
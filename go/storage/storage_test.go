@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestAuditResultSatisfied(t *testing.T) {
+	for _, test := range []struct {
+		r    AuditResult
+		want bool
+	}{
+		{AuditResult{Host: "a.example.com"}, true},
+		{AuditResult{Host: "a.example.com", Policies: map[string]string{"chrome": "", "apple": ""}}, true},
+		{AuditResult{Host: "a.example.com", Policies: map[string]string{"chrome": "", "apple": "too few SCTs"}}, false},
+		{AuditResult{Host: "a.example.com", Error: "connection refused"}, false},
+	} {
+		if got := test.r.Satisfied(); got != test.want {
+			t.Errorf("%+v.Satisfied()=%v, want %v", test.r, got, test.want)
+		}
+	}
+}
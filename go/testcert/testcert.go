@@ -0,0 +1,132 @@
+// Package testcert issues certificates for tests, from templates and freshly
+// generated keys, so that tests can build whatever hierarchy of CAs they
+// need instead of embedding fixed certificates.
+package testcert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// Validity period given to certificates whose templates don't have one.
+var (
+	DefaultNotBefore = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	DefaultNotAfter  = time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// CA is a certificate and its private key, which can issue other
+// certificates.
+type CA struct {
+	Cert *x509.Certificate
+	// Key is an *ecdsa.PrivateKey or an *rsa.PrivateKey, the types which
+	// x509.CreateCertificate can sign with.
+	Key crypto.Signer
+}
+
+// NewKey returns a new P-256 key.
+func NewKey(t testing.TB) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// NewRSAKey returns a new RSA key, of the smallest size allowed so that tests
+// stay fast.
+func NewRSAKey(t testing.TB) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// Template returns a template for a certificate with common name cn, a
+// random serial number and the default validity period, so that it can also
+// be used to create the matching precertificate.  If isCA is set, it is a CA
+// certificate which can sign certificates and CRLs, with no limit on the
+// length of the paths below it.
+func Template(cn string, isCA bool) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber:          newSerial(),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             DefaultNotBefore,
+		NotAfter:              DefaultNotAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		tmpl.MaxPathLen = -1
+	}
+	return tmpl
+}
+
+// newSerial returns a random positive serial number, so that certificates
+// from different templates are distinct.
+func newSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 63))
+	if err != nil {
+		panic(err)
+	}
+	return serial.Add(serial, big.NewInt(1))
+}
+
+// Issue returns the certificate which ca issues from tmpl for key, or which
+// key self-signs if ca is nil.  tmpl isn't modified.  If it has no serial
+// number a random one is used, and if it has no validity period
+// DefaultNotBefore to DefaultNotAfter is used.
+func Issue(t testing.TB, tmpl *x509.Certificate, key crypto.Signer, ca *CA) *x509.Certificate {
+	c := *tmpl
+	if c.SerialNumber == nil {
+		c.SerialNumber = newSerial()
+	}
+	if c.NotBefore.IsZero() {
+		c.NotBefore = DefaultNotBefore
+	}
+	if c.NotAfter.IsZero() {
+		c.NotAfter = DefaultNotAfter
+	}
+	parent, parentKey := &c, key
+	if ca != nil {
+		parent, parentKey = ca.Cert, ca.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &c, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if x509.IsFatal(err) {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// LeafTemplate returns a template for a certificate for the DNS name name.
+func LeafTemplate(name string) *x509.Certificate {
+	tmpl := Template(name, false)
+	tmpl.DNSNames = []string{name}
+	return tmpl
+}
+
+// Leaf returns a certificate for key, issued by ca, for the DNS name name.
+func Leaf(t testing.TB, name string, key crypto.Signer, ca *CA) *x509.Certificate {
+	return Issue(t, LeafTemplate(name), key, ca)
+}
+
+// NewCA returns a CA with common name cn and a new P-256 key, issued by
+// parent, or self-signed if parent is nil.
+func NewCA(t testing.TB, cn string, parent *CA) *CA {
+	key := NewKey(t)
+	return &CA{Cert: Issue(t, Template(cn, true), key, parent), Key: key}
+}
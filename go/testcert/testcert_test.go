@@ -0,0 +1,43 @@
+package testcert
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+func TestIssue(t *testing.T) {
+	for _, key := range []crypto.Signer{NewKey(t), NewRSAKey(t)} {
+		root := &CA{Cert: Issue(t, Template("Root", true), key, nil), Key: key}
+		if err := root.Cert.CheckSignatureFrom(root.Cert); err != nil {
+			t.Errorf("%T root isn't self-signed: %v", key, err)
+		}
+		inter := NewCA(t, "Intermediate", root)
+		tmpl := &x509.Certificate{Subject: pkix.Name{CommonName: "leaf.example.com"}}
+		leaf := Issue(t, tmpl, NewKey(t), inter)
+		if err := inter.Cert.CheckSignatureFrom(root.Cert); err != nil {
+			t.Errorf("%T root didn't sign intermediate: %v", key, err)
+		}
+		if err := leaf.CheckSignatureFrom(inter.Cert); err != nil {
+			t.Errorf("Intermediate didn't sign leaf: %v", err)
+		}
+		if tmpl.SerialNumber != nil || !tmpl.NotBefore.IsZero() {
+			t.Error("Issue() modified the template")
+		}
+		if leaf.SerialNumber.Cmp(inter.Cert.SerialNumber) == 0 {
+			t.Errorf("Leaf and intermediate have the same serial number %v", leaf.SerialNumber)
+		}
+		if !leaf.NotBefore.Equal(DefaultNotBefore) || !leaf.NotAfter.Equal(DefaultNotAfter) {
+			t.Errorf("Leaf is valid from %s to %s, want the default validity", leaf.NotBefore, leaf.NotAfter)
+		}
+		if leaf.IsCA || !inter.Cert.IsCA {
+			t.Errorf("Leaf IsCA=%t, intermediate IsCA=%t", leaf.IsCA, inter.Cert.IsCA)
+		}
+		named := Leaf(t, "www.example.com", NewKey(t), inter)
+		if len(named.DNSNames) != 1 || named.DNSNames[0] != "www.example.com" || named.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			t.Errorf("Leaf() returned certificate for %v with serial %v", named.DNSNames, named.SerialNumber)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package testlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Faults are the ways a FaultyLog misbehaves.  Those which apply to a number
+// of requests are counted down as they are injected, in the order the
+// requests arrive, so that tests can script exactly which requests fail.
+type Faults struct {
+	// Paths are the API paths, such as "/ct/v1/get-sth", whose requests
+	// the faults apply to.  If empty, they apply to all requests.
+	Paths []string
+	// Latency is added to each response.
+	Latency time.Duration
+	// TooManyRequests is the number of requests answered with a 429
+	// status, with a Retry-After header of RetryAfter, in whole seconds.
+	TooManyRequests int
+	RetryAfter      time.Duration
+	// ServerErrors is the number of requests answered with a 500 status.
+	ServerErrors int
+	// Truncated is the number of responses whose bodies are cut short.
+	Truncated int
+	// If set, the signatures of the SCTs and STHs returned are invalid.
+	BadSignatures bool
+	// If set, get-sth returns STHs, validly signed, of a tree which isn't
+	// consistent with the log's.
+	InconsistentSTHs bool
+}
+
+// applies reports whether f applies to requests for path.
+func (f *Faults) applies(path string) bool {
+	if len(f.Paths) == 0 {
+		return true
+	}
+	for _, p := range f.Paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// FaultyLog is a Log whose API injects Faults, for testing how clients cope
+// with logs which are overloaded or misbehave.  It is an http.Handler, e.g.
+// for an httptest.Server.
+type FaultyLog struct {
+	*Log
+	mu     sync.Mutex
+	faults Faults
+}
+
+// NewFaultyLog returns a FaultyLog serving the API of l with faults.
+func NewFaultyLog(l *Log, faults Faults) *FaultyLog {
+	return &FaultyLog{Log: l, faults: faults}
+}
+
+// SetFaults replaces the faults injected.
+func (f *FaultyLog) SetFaults(faults Faults) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = faults
+}
+
+// Faults returns the faults still to be injected.
+func (f *FaultyLog) Faults() Faults {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.faults
+}
+
+// take decrements *n, returning whether it was positive.
+func take(n *int) bool {
+	if *n <= 0 {
+		return false
+	}
+	*n--
+	return true
+}
+
+// ServeHTTP serves the log's API with faults injected.
+func (f *FaultyLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	if !f.faults.applies(r.URL.Path) {
+		f.mu.Unlock()
+		f.Log.ServeHTTP(w, r)
+		return
+	}
+	faults := f.faults
+	tooMany := take(&f.faults.TooManyRequests)
+	serverError := !tooMany && take(&f.faults.ServerErrors)
+	truncate := !tooMany && !serverError && take(&f.faults.Truncated)
+	f.mu.Unlock()
+
+	time.Sleep(faults.Latency)
+	if tooMany {
+		w.Header().Set("Retry-After", strconv.Itoa(int(faults.RetryAfter/time.Second)))
+		http.Error(w, "too many requests", 429)
+		return
+	}
+	if serverError {
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+
+	rec := httptest.NewRecorder()
+	if faults.InconsistentSTHs && r.URL.Path == "/ct/v1/get-sth" {
+		f.serveForkedSTH(rec)
+	} else {
+		f.Log.ServeHTTP(rec, r)
+	}
+	body := rec.Body.Bytes()
+	if faults.BadSignatures && rec.Code == http.StatusOK {
+		body = corruptSignatures(body)
+	}
+	if truncate {
+		body = body[:len(body)/2]
+	}
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	w.Write(body)
+}
+
+// serveForkedSTH writes a get-sth response for an STH whose root hash isn't
+// that of the log's tree.
+func (f *FaultyLog) serveForkedSTH(w http.ResponseWriter) {
+	sth, err := f.STH()
+	if err == nil {
+		sth.SHA256RootHash = sha256.Sum256(sth.SHA256RootHash[:])
+		err = f.signSTH(sth)
+	}
+	var resp interface{}
+	if err == nil {
+		resp, err = sthResponse(sth)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// corruptSignatures returns the JSON response body with the last byte of any
+// SCT or STH signature in it changed.
+func corruptSignatures(body []byte) []byte {
+	var resp map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&resp); err != nil {
+		return body
+	}
+	for _, key := range []string{"signature", "tree_head_signature"} {
+		encoded, ok := resp[key].(string)
+		if !ok {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(sig) == 0 {
+			continue
+		}
+		sig[len(sig)-1] ^= 1
+		resp[key] = base64.StdEncoding.EncodeToString(sig)
+	}
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(resp); err != nil {
+		return body
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,105 @@
+package testlog
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"golang.org/x/net/context"
+)
+
+func TestFaultyLog(t *testing.T) {
+	root, cert, _ := testChains(t)
+	l, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewFaultyLog(l, Faults{})
+	hs := httptest.NewServer(f)
+	defer hs.Close()
+	verifier, err := ct.NewSignatureVerifier(l.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc := client.NewWithOptions(hs.URL, client.Options{
+		Verifier: verifier,
+		Backoff:  &client.BackoffPolicy{Initial: time.Millisecond, MaxRetries: 3},
+	})
+	ctx := context.Background()
+	chain := []ct.ASN1Cert{cert, root.Raw}
+
+	// Throttled and failed requests are retried.
+	f.SetFaults(Faults{TooManyRequests: 2, ServerErrors: 1})
+	_, md, err := lc.AddChainWithMetadata(ctx, chain)
+	if err != nil {
+		t.Fatalf("AddChain() with 3 faults=_,%v", err)
+	}
+	if md.Retries != 3 {
+		t.Errorf("AddChain() with 3 faults retried %d times, want 3", md.Retries)
+	}
+	if md.Throttled != 2 {
+		t.Errorf("AddChain() with 2 429s was throttled %d times, want 2", md.Throttled)
+	}
+	f.SetFaults(Faults{TooManyRequests: 4})
+	if _, err := lc.AddChain(chain); err == nil {
+		t.Error("AddChain() with 4 faults=_,nil, want error")
+	}
+	if left := f.Faults().TooManyRequests; left != 0 {
+		t.Errorf("%d 429s left after AddChain(), want 0", left)
+	}
+
+	// Faults only apply to their paths.
+	f.SetFaults(Faults{Paths: []string{"/ct/v1/get-sth"}, Truncated: 1})
+	if _, err := lc.AddChain(chain); err != nil {
+		t.Errorf("AddChain() with get-sth faults=_,%v", err)
+	}
+	if _, err := lc.GetSTH(); err == nil {
+		t.Error("GetSTH() of truncated response=_,nil, want error")
+	}
+	sth1, err := lc.GetSTH()
+	if err != nil {
+		t.Fatalf("GetSTH()=_,%v", err)
+	}
+
+	f.SetFaults(Faults{BadSignatures: true})
+	if _, err := lc.AddChain(chain); err == nil {
+		t.Error("AddChain() with bad signatures=_,nil, want error")
+	} else if _, ok := err.(client.VerificationError); !ok {
+		t.Errorf("AddChain() with bad signatures=_,%v, want VerificationError", err)
+	}
+	sth, err := lc.GetSTH()
+	if err != nil {
+		t.Fatalf("GetSTH()=_,%v", err)
+	}
+	if err := verifier.VerifySTHSignature(*sth); err == nil {
+		t.Error("VerifySTHSignature() with bad signatures=nil, want error")
+	}
+
+	f.SetFaults(Faults{InconsistentSTHs: true})
+	if _, err := l.AddChain([]ct.ASN1Cert{root.Raw}); err != nil {
+		t.Fatal(err)
+	}
+	sth2, err := lc.GetSTH()
+	if err != nil {
+		t.Fatalf("GetSTH()=_,%v", err)
+	}
+	if err := verifier.VerifySTHSignature(*sth2); err != nil {
+		t.Errorf("VerifySTHSignature() of inconsistent STH=%v, want nil", err)
+	}
+	if _, err := lc.VerifyConsistency(ctx, *sth1, *sth2); err == nil {
+		t.Error("VerifyConsistency() with inconsistent STH=_,nil, want error")
+	} else if _, ok := err.(client.ConsistencyError); !ok {
+		t.Errorf("VerifyConsistency() with inconsistent STH=_,%v, want ConsistencyError", err)
+	}
+
+	f.SetFaults(Faults{Latency: 50 * time.Millisecond})
+	start := time.Now()
+	if _, err := lc.GetSTH(); err != nil {
+		t.Fatalf("GetSTH()=_,%v", err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("GetSTH() with 50ms latency took %v", d)
+	}
+}
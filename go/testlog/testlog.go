@@ -0,0 +1,522 @@
+// Package testlog provides an in-process CT log, serving the RFC6962 API from
+// an in-memory Merkle tree, for integration tests of clients, scanners and
+// fixers.  Entries are added to the tree as soon as they are submitted, so
+// the log's maximum merge delay is zero.  A FaultyLog wraps a Log to inject
+// faults into its API, to test how clients cope with misbehaving logs.
+package testlog
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/keys"
+	"github.com/google/certificate-transparency/go/merkle"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// Options configures a Log.
+type Options struct {
+	// Key signs the log's SCTs and STHs.  If nil, a P-256 key is
+	// generated.
+	Key crypto.Signer
+	// Signer, if set, signs the log's SCTs and STHs instead of Key, e.g.
+	// with a key held in an HSM.
+	Signer keys.Signer
+	// Rand is the source of randomness for signing.  If nil, crypto/rand
+	// is used.
+	Rand io.Reader
+	// Now returns the time of each SCT and STH, so that tests can have
+	// deterministic timestamps; see SteppingClock.  If nil, time.Now is
+	// used.
+	Now func() time.Time
+	// Roots are the certificates which the log accepts chains to.  If
+	// empty, any chain whose certificates sign each other is accepted.
+	Roots []*x509.Certificate
+	// MaxGetEntries is the most entries a get-entries response has, so
+	// that clients' handling of short responses can be tested.  Zero
+	// means no limit.
+	MaxGetEntries int
+}
+
+// SteppingClock returns a clock, for Options.Now, which starts at start and
+// advances by step each time it is read.
+func SteppingClock(start time.Time, step time.Duration) func() time.Time {
+	var mu sync.Mutex
+	next := start
+	return func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		t := next
+		next = next.Add(step)
+		return t
+	}
+}
+
+// entry is an entry of the log, as get-entries returns it.
+type entry struct {
+	leafInput []byte
+	extraData []byte
+}
+
+// Log is an in-process CT log, which serves the RFC6962 API as an
+// http.Handler, e.g. from an httptest.Server.  It is safe for concurrent use.
+type Log struct {
+	opts   Options
+	signer keys.Signer
+
+	mu      sync.Mutex
+	tree    *merkle.MerkleTree
+	entries []entry
+	indices map[string]uint64 // by leaf hash
+	// The SCTs issued, by leaf identity, so that resubmissions get the
+	// same SCT.
+	scts map[[sha256.Size]byte]*ct.SignedCertificateTimestamp
+}
+
+// New returns an empty Log configured by opts.
+func New(opts Options) (*Log, error) {
+	if opts.Key == nil && opts.Signer == nil {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		opts.Key = key
+	}
+	if opts.Rand == nil {
+		opts.Rand = rand.Reader
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	l := &Log{
+		opts:    opts,
+		tree:    merkle.NewMerkleTree(merkle.NewSHA256TreeHasher()),
+		indices: make(map[string]uint64),
+		scts:    make(map[[sha256.Size]byte]*ct.SignedCertificateTimestamp),
+	}
+	l.signer = opts.Signer
+	if l.signer == nil {
+		var err error
+		if l.signer, err = keys.NewSigner(opts.Key, opts.Rand); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// PublicKey returns the public key the log signs with.
+func (l *Log) PublicKey() crypto.PublicKey {
+	return l.signer.Public()
+}
+
+// LogID returns the log's ID, the SHA-256 hash of its public key.
+func (l *Log) LogID() ct.SHA256Hash {
+	return l.signer.KeyID()
+}
+
+// TreeSize returns the number of entries in the log.
+func (l *Log) TreeSize() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.tree.LeafCount()
+}
+
+func (l *Log) sign(data []byte) (ct.DigitallySigned, error) {
+	return l.signer.Sign(data)
+}
+
+func (l *Log) timestamp() uint64 {
+	return uint64(l.opts.Now().UnixNano() / int64(time.Millisecond))
+}
+
+// The TLS encodings of the extra data of entries.
+type asn1Cert struct {
+	Data []byte `tls:"minlen:1,maxlen:16777215"`
+}
+
+type certificateChain struct {
+	Chain []asn1Cert `tls:"minlen:0,maxlen:16777215"`
+}
+
+type precertChainEntry struct {
+	PreCertificate asn1Cert
+	Chain          []asn1Cert `tls:"minlen:0,maxlen:16777215"`
+}
+
+// checkChain parses chain, checks that each certificate is signed by the next
+// and that it ends at one of the log's roots, and returns it with the root
+// appended if it wasn't included.
+func (l *Log) checkChain(chain []ct.ASN1Cert) ([]*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("empty chain")
+	}
+	var certs []*x509.Certificate
+	for i, der := range chain {
+		cert, err := x509.ParseCertificate(der)
+		if x509.IsFatal(err) {
+			return nil, fmt.Errorf("failed to parse certificate %d: %v", i, err)
+		}
+		if i > 0 {
+			if err := certs[i-1].CheckSignatureFrom(cert); err != nil {
+				return nil, fmt.Errorf("certificate %d isn't signed by the next: %v", i-1, err)
+			}
+		}
+		certs = append(certs, cert)
+	}
+	if len(l.opts.Roots) == 0 {
+		return certs, nil
+	}
+	last := certs[len(certs)-1]
+	for _, root := range l.opts.Roots {
+		if last.Equal(root) {
+			return certs, nil
+		}
+	}
+	for _, root := range l.opts.Roots {
+		if last.CheckSignatureFrom(root) == nil {
+			return append(certs, root), nil
+		}
+	}
+	return nil, errors.New("chain doesn't end at an accepted root")
+}
+
+// add adds chain to the log, as a certificate chain or, if precert is set, a
+// precertificate chain, and returns the SCT for it.
+func (l *Log) add(chain []ct.ASN1Cert, precert bool) (*ct.SignedCertificateTimestamp, error) {
+	certs, err := l.checkChain(chain)
+	if err != nil {
+		return nil, err
+	}
+	var rest []asn1Cert
+	for _, cert := range certs[1:] {
+		rest = append(rest, asn1Cert{cert.Raw})
+	}
+	var te ct.TimestampedEntry
+	var extraData []byte
+	if precert {
+		if !certs[0].IsPrecertificate() {
+			return nil, errors.New("first certificate isn't a precertificate")
+		}
+		if len(certs) < 2 {
+			return nil, errors.New("precertificate chain has no issuer")
+		}
+		tbs, err := x509.BuildPrecertTBS(certs[0].RawTBSCertificate)
+		if err != nil {
+			return nil, err
+		}
+		te.EntryType = ct.PrecertLogEntryType
+		te.PrecertEntry = ct.PreCert{
+			IssuerKeyHash:  sha256.Sum256(certs[1].RawSubjectPublicKeyInfo),
+			TBSCertificate: tbs,
+		}
+		extraData, err = tls.Marshal(precertChainEntry{PreCertificate: asn1Cert{certs[0].Raw}, Chain: rest})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if certs[0].IsPrecertificate() {
+			return nil, errors.New("first certificate is a precertificate")
+		}
+		te.EntryType = ct.X509LogEntryType
+		te.X509Entry = ct.ASN1Cert(certs[0].Raw)
+		extraData, err = tls.Marshal(certificateChain{rest})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// An entry's identity is its TimestampedEntry without the timestamp.
+	identity, err := tls.Marshal(te)
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(identity)
+	if sct, ok := l.scts[key]; ok {
+		return sct, nil
+	}
+
+	te.Timestamp = l.timestamp()
+	leaf := ct.MerkleTreeLeaf{Version: ct.V1, LeafType: ct.TimestampedEntryLeafType, TimestampedEntry: te}
+	sct := &ct.SignedCertificateTimestamp{SCTVersion: ct.V1, LogID: l.signer.KeyID(), Timestamp: te.Timestamp}
+	input, err := ct.SerializeSCTSignatureInput(*sct, ct.LogEntry{Leaf: leaf})
+	if err != nil {
+		return nil, err
+	}
+	if sct.Signature, err = l.sign(input); err != nil {
+		return nil, err
+	}
+	leafInput, err := ct.SerializeMerkleTreeLeaf(leaf)
+	if err != nil {
+		return nil, err
+	}
+	index := l.tree.AddLeaf(leafInput)
+	leafHash, err := l.tree.LeafHash(index)
+	if err != nil {
+		return nil, err
+	}
+	l.indices[string(leafHash)] = index
+	l.entries = append(l.entries, entry{leafInput: leafInput, extraData: extraData})
+	l.scts[key] = sct
+	return sct, nil
+}
+
+// AddChain adds the certificate chain to the log, as add-chain does, and
+// returns its SCT.
+func (l *Log) AddChain(chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	return l.add(chain, false)
+}
+
+// AddPreChain adds the precertificate chain to the log, as add-pre-chain
+// does, and returns its SCT.
+func (l *Log) AddPreChain(chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	return l.add(chain, true)
+}
+
+// STH returns a new STH for the log's current tree.
+func (l *Log) STH() (*ct.SignedTreeHead, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	root, err := l.tree.CurrentRoot()
+	if err != nil {
+		return nil, err
+	}
+	sth := &ct.SignedTreeHead{
+		Version:   ct.V1,
+		TreeSize:  l.tree.LeafCount(),
+		Timestamp: l.timestamp(),
+		LogID:     l.signer.KeyID(),
+	}
+	copy(sth.SHA256RootHash[:], root)
+	if err := l.signSTH(sth); err != nil {
+		return nil, err
+	}
+	return sth, nil
+}
+
+func (l *Log) signSTH(sth *ct.SignedTreeHead) error {
+	input, err := ct.SerializeSTHSignatureInput(*sth)
+	if err != nil {
+		return err
+	}
+	sth.TreeHeadSignature, err = l.sign(input)
+	return err
+}
+
+// httpError is an error which is reported to the client with its status.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e httpError) Error() string { return e.err.Error() }
+
+func badRequest(format string, args ...interface{}) error {
+	return httpError{http.StatusBadRequest, fmt.Errorf(format, args...)}
+}
+
+func encode(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func encodeAll(hashes [][]byte) []string {
+	encoded := make([]string, len(hashes))
+	for i, h := range hashes {
+		encoded[i] = encode(h)
+	}
+	return encoded
+}
+
+// uintParam returns the value of the unsigned integer parameter name of r.
+func uintParam(r *http.Request, name string) (uint64, error) {
+	v, err := strconv.ParseUint(r.FormValue(name), 10, 64)
+	if err != nil {
+		return 0, badRequest("bad %s parameter %q", name, r.FormValue(name))
+	}
+	return v, nil
+}
+
+func (l *Log) handleAdd(r *http.Request, precert bool) (interface{}, error) {
+	if r.Method != "POST" {
+		return nil, httpError{http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method)}
+	}
+	var req struct {
+		Chain [][]byte `json:"chain"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, badRequest("failed to parse request: %v", err)
+	}
+	chain := make([]ct.ASN1Cert, len(req.Chain))
+	for i, der := range req.Chain {
+		chain[i] = der
+	}
+	sct, err := l.add(chain, precert)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	sig, err := ct.MarshalDigitallySigned(sct.Signature)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"sct_version": sct.SCTVersion,
+		"id":          encode(sct.LogID[:]),
+		"timestamp":   sct.Timestamp,
+		"extensions":  encode(sct.Extensions),
+		"signature":   encode(sig),
+	}, nil
+}
+
+func (l *Log) handleGetSTH(r *http.Request) (interface{}, error) {
+	sth, err := l.STH()
+	if err != nil {
+		return nil, err
+	}
+	return sthResponse(sth)
+}
+
+func sthResponse(sth *ct.SignedTreeHead) (interface{}, error) {
+	sig, err := ct.MarshalDigitallySigned(sth.TreeHeadSignature)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"tree_size":           sth.TreeSize,
+		"timestamp":           sth.Timestamp,
+		"sha256_root_hash":    encode(sth.SHA256RootHash[:]),
+		"tree_head_signature": encode(sig),
+	}, nil
+}
+
+func (l *Log) handleGetEntries(r *http.Request) (interface{}, error) {
+	start, err := uintParam(r, "start")
+	if err != nil {
+		return nil, err
+	}
+	end, err := uintParam(r, "end")
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	size := uint64(len(l.entries))
+	if start > end || start >= size {
+		return nil, badRequest("bad range [%d, %d] for tree size %d", start, end, size)
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if max := uint64(l.opts.MaxGetEntries); max > 0 && end-start+1 > max {
+		end = start + max - 1
+	}
+	type leafEntry struct {
+		LeafInput string `json:"leaf_input"`
+		ExtraData string `json:"extra_data"`
+	}
+	var entries []leafEntry
+	for _, e := range l.entries[start : end+1] {
+		entries = append(entries, leafEntry{encode(e.leafInput), encode(e.extraData)})
+	}
+	return map[string]interface{}{"entries": entries}, nil
+}
+
+func (l *Log) handleGetProofByHash(r *http.Request) (interface{}, error) {
+	hash, err := base64.StdEncoding.DecodeString(r.FormValue("hash"))
+	if err != nil {
+		return nil, badRequest("bad hash parameter: %v", err)
+	}
+	treeSize, err := uintParam(r, "tree_size")
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if treeSize > l.tree.LeafCount() {
+		return nil, badRequest("tree size %d is beyond the log's %d", treeSize, l.tree.LeafCount())
+	}
+	index, ok := l.indices[string(hash)]
+	if !ok || index >= treeSize {
+		return nil, badRequest("no entry with that hash in the tree of size %d", treeSize)
+	}
+	path, err := l.tree.PathToRootAtSnapshot(index, treeSize)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"leaf_index": index, "audit_path": encodeAll(path)}, nil
+}
+
+func (l *Log) handleGetSTHConsistency(r *http.Request) (interface{}, error) {
+	first, err := uintParam(r, "first")
+	if err != nil {
+		return nil, err
+	}
+	second, err := uintParam(r, "second")
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	proof, err := l.tree.SnapshotConsistency(first, second)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	return map[string]interface{}{"consistency": encodeAll(proof)}, nil
+}
+
+func (l *Log) handleGetRoots(r *http.Request) (interface{}, error) {
+	roots := make([]string, len(l.opts.Roots))
+	for i, root := range l.opts.Roots {
+		roots[i] = encode(root.Raw)
+	}
+	return map[string]interface{}{"certificates": roots}, nil
+}
+
+// ServeHTTP serves the log's API.
+func (l *Log) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var resp interface{}
+	var err error
+	switch r.URL.Path {
+	case "/ct/v1/add-chain":
+		resp, err = l.handleAdd(r, false)
+	case "/ct/v1/add-pre-chain":
+		resp, err = l.handleAdd(r, true)
+	case "/ct/v1/get-sth":
+		resp, err = l.handleGetSTH(r)
+	case "/ct/v1/get-entries":
+		resp, err = l.handleGetEntries(r)
+	case "/ct/v1/get-proof-by-hash":
+		resp, err = l.handleGetProofByHash(r)
+	case "/ct/v1/get-sth-consistency":
+		resp, err = l.handleGetSTHConsistency(r)
+	case "/ct/v1/get-roots":
+		resp, err = l.handleGetRoots(r)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if he, ok := err.(httpError); ok {
+			status = he.status
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
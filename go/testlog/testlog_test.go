@@ -0,0 +1,194 @@
+package testlog
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/keys"
+	"github.com/google/certificate-transparency/go/testcert"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// testChains returns a root, a certificate it issued and a precertificate for
+// the same certificate.
+func testChains(t *testing.T) (root *x509.Certificate, cert, precert []byte) {
+	ca := testcert.NewCA(t, "Test Root", nil)
+	tmpl := testcert.LeafTemplate("leaf.example.com")
+	key := testcert.NewKey(t)
+	precert, err := client.CreatePrecertificate(rand.Reader, tmpl, ca.Cert, &key.PublicKey, ca.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca.Cert, testcert.Issue(t, tmpl, key, ca).Raw, precert
+}
+
+func TestLog(t *testing.T) {
+	root, cert, precert := testChains(t)
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	l, err := New(Options{Roots: []*x509.Certificate{root}, Now: SteppingClock(start, time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(l)
+	defer hs.Close()
+	verifier, err := ct.NewSignatureVerifier(l.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc := client.NewWithOptions(hs.URL, client.Options{Verifier: verifier})
+	ctx := context.Background()
+	ms := uint64(start.UnixNano() / int64(time.Millisecond))
+
+	sct, err := lc.AddChain([]ct.ASN1Cert{cert, root.Raw})
+	if err != nil {
+		t.Fatalf("AddChain()=_,%v", err)
+	}
+	if sct.Timestamp != ms || sct.LogID != l.LogID() {
+		t.Errorf("AddChain() returned SCT with timestamp %d and log ID %x, want %d, %x", sct.Timestamp, sct.LogID, ms, l.LogID())
+	}
+	sth1, err := l.STH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A resubmission gets the same SCT, even without the root.
+	if sct, err := lc.AddChain([]ct.ASN1Cert{cert}); err != nil || sct.Timestamp != ms {
+		t.Errorf("AddChain(again)=%v,%v, want SCT with timestamp %d", sct, err, ms)
+	}
+	if _, err := lc.AddPreChain([]ct.ASN1Cert{precert, root.Raw}); err != nil {
+		t.Fatalf("AddPreChain()=_,%v", err)
+	}
+	if _, err := lc.AddChain([]ct.ASN1Cert{precert, root.Raw}); err == nil {
+		t.Error("AddChain(precertificate)=_,nil, want error")
+	}
+	otherRoot, otherCert, _ := testChains(t)
+	if _, err := lc.AddChain([]ct.ASN1Cert{otherCert, otherRoot.Raw}); err == nil {
+		t.Error("AddChain(chain to other root)=_,nil, want error")
+	}
+	if l.TreeSize() != 2 {
+		t.Errorf("TreeSize()=%d, want 2", l.TreeSize())
+	}
+
+	sth2, err := lc.GetSTHWithContext(ctx)
+	if err != nil {
+		t.Fatalf("GetSTH()=_,%v", err)
+	}
+	if err := verifier.VerifySTHSignature(*sth2); err != nil {
+		t.Errorf("VerifySTHSignature()=%v", err)
+	}
+	if sth2.TreeSize != 2 {
+		t.Errorf("GetSTH() returned tree size %d, want 2", sth2.TreeSize)
+	}
+	if _, err := lc.VerifyConsistency(ctx, *sth1, *sth2); err != nil {
+		t.Errorf("VerifyConsistency()=_,%v", err)
+	}
+
+	entries, err := lc.GetEntries(0, 1)
+	if err != nil {
+		t.Fatalf("GetEntries()=_,%v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("GetEntries() returned %d entries, want 2", len(entries))
+	}
+	for i, want := range []ct.LogEntryType{ct.X509LogEntryType, ct.PrecertLogEntryType} {
+		e := &entries[i]
+		if got := e.Leaf.TimestampedEntry.EntryType; got != want {
+			t.Errorf("entry %d has type %v, want %v", i, got, want)
+		}
+		// A precertificate's chain starts with the precertificate.
+		if len(e.Chain) != i+1 || !root.Equal(mustParse(t, e.Chain[i])) {
+			t.Errorf("entry %d has chain of %d certificates, want it to end at the root", i, len(e.Chain))
+		}
+		e.Index = int64(i)
+		if proof, err := lc.ProveInclusion(ctx, e, *sth2); err != nil {
+			t.Errorf("ProveInclusion(entry %d)=_,%v", i, err)
+		} else if proof.LeafIndex != int64(i) {
+			t.Errorf("ProveInclusion(entry %d) proved leaf %d", i, proof.LeafIndex)
+		}
+	}
+	roots, err := lc.GetAcceptedRoots(ctx)
+	if err != nil || len(roots) != 1 {
+		t.Errorf("GetAcceptedRoots()=%v,%v, want the root", roots, err)
+	}
+}
+
+func mustParse(t *testing.T, der []byte) *x509.Certificate {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestMaxGetEntries(t *testing.T) {
+	root, cert, precert := testChains(t)
+	l, err := New(Options{MaxGetEntries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(l)
+	defer hs.Close()
+	lc := client.New(hs.URL)
+	if _, err := lc.AddChain([]ct.ASN1Cert{cert, root.Raw}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lc.AddPreChain([]ct.ASN1Cert{precert, root.Raw}); err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range []struct {
+		start, end int64
+		want       int
+	}{
+		{0, 1, 1},
+		{1, 5, 1},
+		{2, 2, 0},
+	} {
+		entries, err := lc.GetEntries(test.start, test.end)
+		if test.want == 0 {
+			if err == nil {
+				t.Errorf("#%d: GetEntries(%d, %d)=_,nil, want error", i, test.start, test.end)
+			}
+			continue
+		}
+		if err != nil || len(entries) != test.want {
+			t.Errorf("#%d: GetEntries(%d, %d) returned %d entries, %v, want %d", i, test.start, test.end, len(entries), err, test.want)
+		}
+	}
+}
+
+func TestEd25519Signer(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := keys.NewSigner(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := New(Options{Signer: signer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.LogID() != signer.KeyID() {
+		t.Errorf("LogID()=%x, want the signer's key ID %x", l.LogID(), signer.KeyID())
+	}
+	verifier, err := ct.NewSignatureVerifier(l.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, cert, _ := testChains(t)
+	hs := httptest.NewServer(l)
+	defer hs.Close()
+	lc := client.NewWithOptions(hs.URL, client.Options{Verifier: verifier})
+	if _, err := lc.AddChain([]ct.ASN1Cert{cert, root.Raw}); err != nil {
+		t.Fatalf("AddChain()=_,%v", err)
+	}
+	if _, err := lc.GetSTH(); err != nil {
+		t.Fatalf("GetSTH()=_,%v", err)
+	}
+}
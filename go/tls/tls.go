@@ -0,0 +1,400 @@
+// Package tls encodes and decodes structures in the TLS presentation language
+// (RFC 5246 section 4), which RFC 6962 specifies CT's structures in.  The
+// encoding of a Go value follows its type, with struct tags supplying what
+// the type can't:
+//
+//   - Unsigned integers are encoded big-endian in their size: a uint8 in one
+//     byte, a uint16 in two, and so on.  Types based on them, such as enums,
+//     are encoded in the same way.
+//   - Arrays are fixed-length vectors, encoded as their elements.
+//   - Slices are variable-length vectors, which must be tagged with the
+//     limits of their encoded length in bytes, as `tls:"minlen:1,maxlen:255"`.
+//     The length is prefixed in as few bytes as can hold maxlen.  The
+//     elements of a slice can't have tags, so a vector of vectors is a slice
+//     of structs holding them.
+//   - Structs are encoded as their exported fields, in order.  A field tagged
+//     `tls:"selector:Type,val:1"` is a variant, which is only present if the
+//     earlier field Type has the value 1.  A value of Type which matches none
+//     of its variants is an error.
+//
+// Other types aren't supported.  Adding a structure is a matter of declaring
+// it with the right tags.
+package tls
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A StructuralError suggests that a Go value can't be encoded, or decoded
+// into, because of its type or tags, or because it breaks their limits.
+type StructuralError struct {
+	Msg string
+}
+
+func (e StructuralError) Error() string { return "tls: structure error: " + e.Msg }
+
+// A SyntaxError suggests that the data being decoded isn't a valid encoding
+// of the value it is being decoded into.
+type SyntaxError struct {
+	Msg string
+}
+
+func (e SyntaxError) Error() string { return "tls: syntax error: " + e.Msg }
+
+// fieldParams are the settings from a field's tls tag.
+type fieldParams struct {
+	// Limits of the encoded length of a slice, and whether they were set.
+	minLen, maxLen uint64
+	hasLen         bool
+	// The field selecting between variants, and the value for which this
+	// variant is present.
+	selector string
+	val      uint64
+}
+
+func parseFieldParams(tag string) (fieldParams, error) {
+	var p fieldParams
+	if tag == "" {
+		return p, nil
+	}
+	var hasMin, hasVal bool
+	for _, part := range strings.Split(tag, ",") {
+		kv := strings.SplitN(part, ":", 2)
+		if len(kv) != 2 {
+			return p, fmt.Errorf("malformed tag part %q", part)
+		}
+		if kv[0] == "selector" {
+			p.selector = kv[1]
+			continue
+		}
+		n, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			return p, fmt.Errorf("malformed tag part %q", part)
+		}
+		switch kv[0] {
+		case "minlen":
+			p.minLen, hasMin = n, true
+		case "maxlen":
+			p.maxLen, p.hasLen = n, true
+		case "val":
+			p.val, hasVal = n, true
+		default:
+			return p, fmt.Errorf("unknown tag part %q", part)
+		}
+	}
+	switch {
+	case hasMin && !p.hasLen:
+		return p, fmt.Errorf("minlen without maxlen in %q", tag)
+	case p.minLen > p.maxLen:
+		return p, fmt.Errorf("minlen greater than maxlen in %q", tag)
+	case p.selector != "" && !hasVal, p.selector == "" && hasVal:
+		return p, fmt.Errorf("selector and val must be given together in %q", tag)
+	}
+	return p, nil
+}
+
+// lenBytes returns how many bytes are needed to hold |maxLen|.
+func lenBytes(maxLen uint64) int {
+	n := 1
+	for maxLen > 0xff {
+		maxLen >>= 8
+		n++
+	}
+	return n
+}
+
+// fieldInfo describes an exported struct field.
+type fieldInfo struct {
+	index  int
+	name   string
+	params fieldParams
+	// The index of the field's selector, if it is a variant.
+	selectorIndex int
+}
+
+// structInfo describes how a struct type is encoded.
+type structInfo struct {
+	fields []fieldInfo
+	// The values which each selector has variants for.
+	variants map[string]map[uint64]bool
+}
+
+var structInfos sync.Map // reflect.Type -> *structInfo
+
+func getStructInfo(t reflect.Type) (*structInfo, error) {
+	if info, ok := structInfos.Load(t); ok {
+		return info.(*structInfo), nil
+	}
+	info := &structInfo{variants: make(map[string]map[uint64]bool)}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		params, err := parseFieldParams(sf.Tag.Get("tls"))
+		if err != nil {
+			return nil, StructuralError{fmt.Sprintf("%s.%s: %v", t, sf.Name, err)}
+		}
+		f := fieldInfo{index: i, name: sf.Name, params: params}
+		if params.selector != "" {
+			sel, ok := t.FieldByName(params.selector)
+			if !ok || len(sel.Index) != 1 || sel.Index[0] >= i || !isUint(sel.Type.Kind()) {
+				return nil, StructuralError{fmt.Sprintf("%s.%s: selector %s isn't an earlier unsigned integer field", t, sf.Name, params.selector)}
+			}
+			f.selectorIndex = sel.Index[0]
+			if info.variants[params.selector] == nil {
+				info.variants[params.selector] = make(map[uint64]bool)
+			}
+			info.variants[params.selector][params.val] = true
+		}
+		info.fields = append(info.fields, f)
+	}
+	structInfos.Store(t, info)
+	return info, nil
+}
+
+func isUint(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// present reports whether the field |f| of the struct |v| is present: it
+// isn't a variant, or it is the one selected.  If no variant is selected,
+// |bad| makes the error.
+func (info *structInfo) present(v reflect.Value, f *fieldInfo, bad func(string) error) (bool, error) {
+	if f.params.selector == "" {
+		return true, nil
+	}
+	s := v.Field(f.selectorIndex).Uint()
+	if !info.variants[f.params.selector][s] {
+		return false, bad(fmt.Sprintf("%s: unknown %s %d", v.Type(), f.params.selector, s))
+	}
+	return s == f.params.val, nil
+}
+
+// Marshal returns the TLS encoding of |val|.
+func Marshal(val interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	v := reflect.ValueOf(val)
+	if !v.IsValid() {
+		return nil, StructuralError{"can't marshal nil"}
+	}
+	if err := marshalValue(&buf, v, fieldParams{}, v.Type().String()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeUint(buf *bytes.Buffer, value uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		buf.WriteByte(byte(value >> uint(8*i)))
+	}
+}
+
+func marshalValue(buf *bytes.Buffer, v reflect.Value, params fieldParams, name string) error {
+	switch k := v.Kind(); k {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		writeUint(buf, v.Uint(), int(v.Type().Size()))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := marshalValue(buf, v.Index(i), fieldParams{}, name); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if !params.hasLen {
+			return StructuralError{name + ": slice has no maxlen"}
+		}
+		var content bytes.Buffer
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			content.Write(v.Bytes())
+		} else {
+			for i := 0; i < v.Len(); i++ {
+				if err := marshalValue(&content, v.Index(i), fieldParams{}, name); err != nil {
+					return err
+				}
+			}
+		}
+		if l := uint64(content.Len()); l < params.minLen || l > params.maxLen {
+			return StructuralError{fmt.Sprintf("%s: length %d not in range [%d, %d]", name, l, params.minLen, params.maxLen)}
+		}
+		writeUint(buf, uint64(content.Len()), lenBytes(params.maxLen))
+		buf.Write(content.Bytes())
+	case reflect.Struct:
+		info, err := getStructInfo(v.Type())
+		if err != nil {
+			return err
+		}
+		for i := range info.fields {
+			f := &info.fields[i]
+			ok, err := info.present(v, f, func(msg string) error { return StructuralError{msg} })
+			if err != nil {
+				return err
+			}
+			if ok {
+				if err := marshalValue(buf, v.Field(f.index), f.params, name+"."+f.name); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return StructuralError{fmt.Sprintf("%s: unsupported type %s", name, v.Type())}
+	}
+	return nil
+}
+
+// A Decoder decodes values from a stream, reading only as much of it as each
+// value needs.
+type Decoder struct {
+	r io.Reader
+}
+
+// NewDecoder returns a Decoder reading from |r|.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode decodes the next value from the stream into |val|, which must be a
+// non-nil pointer.  If the stream ends before the value does, the error is
+// io.EOF if nothing was read, and io.ErrUnexpectedEOF otherwise.
+func (d *Decoder) Decode(val interface{}) error {
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return StructuralError{fmt.Sprintf("can't decode into non-pointer %T", val)}
+	}
+	cr := &countingReader{r: d.r}
+	err := unmarshalValue(cr, v.Elem(), fieldParams{}, v.Elem().Type().String())
+	if err == io.EOF && cr.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Unmarshal decodes the TLS encoded |b| into |val|, which must be a non-nil
+// pointer, and returns the bytes after its encoding.
+func Unmarshal(b []byte, val interface{}) ([]byte, error) {
+	r := bytes.NewReader(b)
+	if err := NewDecoder(r).Decode(val); err != nil {
+		return nil, err
+	}
+	return b[len(b)-r.Len():], nil
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// readFull reads exactly len(b) bytes, returning io.EOF only if there were
+// none to read.
+func readFull(r io.Reader, b []byte) error {
+	_, err := io.ReadFull(r, b)
+	return err
+}
+
+func readUint(r io.Reader, size int) (uint64, error) {
+	var b [8]byte
+	if err := readFull(r, b[:size]); err != nil {
+		return 0, err
+	}
+	var value uint64
+	for _, c := range b[:size] {
+		value = value<<8 | uint64(c)
+	}
+	return value, nil
+}
+
+func unmarshalValue(r io.Reader, v reflect.Value, params fieldParams, name string) error {
+	switch k := v.Kind(); k {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err := readUint(r, int(v.Type().Size()))
+		if err != nil {
+			return err
+		}
+		v.SetUint(value)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			if err := readFull(r, b); err != nil {
+				return err
+			}
+			reflect.Copy(v, reflect.ValueOf(b))
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := unmarshalValue(r, v.Index(i), fieldParams{}, name); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if !params.hasLen {
+			return StructuralError{name + ": slice has no maxlen"}
+		}
+		l, err := readUint(r, lenBytes(params.maxLen))
+		if err != nil {
+			return err
+		}
+		if l < params.minLen || l > params.maxLen {
+			return SyntaxError{fmt.Sprintf("%s: length %d not in range [%d, %d]", name, l, params.minLen, params.maxLen)}
+		}
+		content := make([]byte, l)
+		if err := readFull(r, content); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(content)
+			return nil
+		}
+		elems := reflect.MakeSlice(v.Type(), 0, 0)
+		for cr := bytes.NewReader(content); cr.Len() > 0; {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := unmarshalValue(cr, elem, fieldParams{}, name); err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					err = SyntaxError{name + ": truncated element"}
+				}
+				return err
+			}
+			elems = reflect.Append(elems, elem)
+		}
+		v.Set(elems)
+	case reflect.Struct:
+		info, err := getStructInfo(v.Type())
+		if err != nil {
+			return err
+		}
+		for i := range info.fields {
+			f := &info.fields[i]
+			ok, err := info.present(v, f, func(msg string) error { return SyntaxError{msg} })
+			if err != nil {
+				return err
+			}
+			if ok {
+				if err := unmarshalValue(r, v.Field(f.index), f.params, name+"."+f.name); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return StructuralError{fmt.Sprintf("%s: unsupported type %s", name, v.Type())}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package tls
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testEnum uint16
+
+type testInner struct {
+	Val []byte `tls:"minlen:1,maxlen:255"`
+}
+
+type testStruct struct {
+	A     uint8
+	B     uint16
+	C     uint32
+	D     uint64
+	Fixed [3]byte
+	Var   []byte `tls:"minlen:0,maxlen:65535"`
+	Type  testEnum
+	One   uint8       `tls:"selector:Type,val:1"`
+	Two   testInner   `tls:"selector:Type,val:2"`
+	List  []testInner `tls:"minlen:0,maxlen:16777215"`
+	// Unexported fields aren't encoded.
+	ignored int
+}
+
+func mustDehex(t *testing.T, h string) []byte {
+	b, err := hex.DecodeString(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	for i, tc := range []struct {
+		val     interface{}
+		encoded string
+	}{
+		{val: uint8(1), encoded: "01"},
+		{val: uint16(0x0102), encoded: "0102"},
+		{val: uint32(0x01020304), encoded: "01020304"},
+		{val: uint64(0x0102030405060708), encoded: "0102030405060708"},
+		{val: testEnum(7), encoded: "0007"},
+		{val: [2]uint16{1, 2}, encoded: "00010002"},
+		{val: testInner{Val: []byte("abc")}, encoded: "03616263"},
+		{
+			val: testStruct{
+				A: 1, B: 2, C: 3, D: 4,
+				Fixed: [3]byte{'x', 'y', 'z'},
+				Var:   []byte{},
+				Type:  1,
+				One:   5,
+				List:  []testInner{},
+			},
+			encoded: "01" + "0002" + "00000003" + "0000000000000004" + "78797a" + "0000" + "0001" + "05" + "000000",
+		},
+		{
+			val: testStruct{
+				Var:  []byte("hi"),
+				Type: 2,
+				Two:  testInner{Val: []byte{0xff}},
+				List: []testInner{{Val: []byte{1}}, {Val: []byte{2, 3}}},
+			},
+			encoded: "00" + "0000" + "00000000" + "0000000000000000" + "000000" + "00026869" + "0002" + "01ff" + "000005" + "0101" + "020203",
+		},
+	} {
+		b, err := Marshal(tc.val)
+		if err != nil {
+			t.Errorf("#%d: Marshal(%+v)=_,%v, want no error", i, tc.val, err)
+			continue
+		}
+		if want := mustDehex(t, tc.encoded); !bytes.Equal(b, want) {
+			t.Errorf("#%d: Marshal(%+v)=%x, want %x", i, tc.val, b, want)
+		}
+		got := reflect.New(reflect.TypeOf(tc.val))
+		rest, err := Unmarshal(append(b, 0x42), got.Interface())
+		if err != nil {
+			t.Errorf("#%d: Unmarshal(%x)=_,%v, want no error", i, b, err)
+			continue
+		}
+		if !bytes.Equal(rest, []byte{0x42}) {
+			t.Errorf("#%d: Unmarshal(%x) left %x, want 42", i, b, rest)
+		}
+		if !reflect.DeepEqual(got.Elem().Interface(), tc.val) {
+			t.Errorf("#%d: Unmarshal(%x)=%+v, want %+v", i, b, got.Elem().Interface(), tc.val)
+		}
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	for i, tc := range []struct {
+		val  interface{}
+		want string
+	}{
+		{val: nil, want: "can't marshal nil"},
+		{val: "string", want: "unsupported type string"},
+		{val: int32(1), want: "unsupported type int32"},
+		{val: struct{ S []byte }{}, want: "slice has no maxlen"},
+		{val: testInner{}, want: "length 0 not in range [1, 255]"},
+		{val: testInner{Val: make([]byte, 256)}, want: "length 256 not in range [1, 255]"},
+		{val: testStruct{Type: 3}, want: "unknown Type 3"},
+		{val: struct {
+			V []byte `tls:"maxlen"`
+		}{}, want: "malformed tag part"},
+		{val: struct {
+			V []byte `tls:"minlen:2,maxlen:1"`
+		}{}, want: "minlen greater than maxlen"},
+		{val: struct {
+			V uint8 `tls:"val:1"`
+		}{}, want: "selector and val must be given together"},
+		{val: struct {
+			V uint8 `tls:"selector:T,val:1"`
+			T uint8
+		}{}, want: "isn't an earlier unsigned integer field"},
+	} {
+		if _, err := Marshal(tc.val); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("#%d: Marshal(%+v)=_,%v, want error containing %q", i, tc.val, err, tc.want)
+		} else if _, ok := err.(StructuralError); !ok {
+			t.Errorf("#%d: Marshal(%+v) returned %T, want StructuralError", i, tc.val, err)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for i, tc := range []struct {
+		encoded string
+		want    error
+	}{
+		{encoded: "", want: io.EOF},
+		{encoded: "01", want: io.ErrUnexpectedEOF},
+		{encoded: "0100020000000300000000000000047879", want: io.ErrUnexpectedEOF},
+		{encoded: "01000200000003000000000000000478797a0002aa", want: io.ErrUnexpectedEOF},
+		{
+			encoded: "0000000000000000000000000000000000000000" + "0003",
+			want:    SyntaxError{"tls.testStruct: unknown Type 3"},
+		},
+		{
+			encoded: "0000000000000000000000000000000000000000" + "0002" + "00",
+			want:    SyntaxError{"tls.testStruct.Two.Val: length 0 not in range [1, 255]"},
+		},
+		{
+			encoded: "0000000000000000000000000000000000000000" + "0001" + "05" + "000002" + "0201",
+			want:    SyntaxError{"tls.testStruct.List: truncated element"},
+		},
+	} {
+		var s testStruct
+		if _, err := Unmarshal(mustDehex(t, tc.encoded), &s); err != tc.want {
+			t.Errorf("#%d: Unmarshal(%s)=_,%v, want %v", i, tc.encoded, err, tc.want)
+		}
+	}
+
+	var s testStruct
+	if _, err := Unmarshal(nil, s); err == nil {
+		t.Error("Unmarshal(non-pointer)=_,nil, want error")
+	}
+}
+
+func TestDecoderReadsOnlyValue(t *testing.T) {
+	r := bytes.NewReader(mustDehex(t, "03616263"+"0164"+"ff"))
+	d := NewDecoder(r)
+	var a, b testInner
+	if err := d.Decode(&a); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Decode(&b); err != nil {
+		t.Fatal(err)
+	}
+	if string(a.Val) != "abc" || string(b.Val) != "d" || r.Len() != 1 {
+		t.Errorf("Decode() read %q, %q, leaving %d bytes, want abc, d, leaving 1", a.Val, b.Val, r.Len())
+	}
+}
+
+// FuzzUnmarshal checks that anything which decodes re-encodes to the same
+// bytes.
+func FuzzUnmarshal(f *testing.F) {
+	for _, seed := range []string{
+		"01000200000003000000000000000478797a0000000105000000",
+		"000000000000000000000000000000000000000000026869000201ff0000050101020203",
+		"0000000000000000000000000000000000000000000300",
+	} {
+		b, err := hex.DecodeString(seed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var s testStruct
+		rest, err := Unmarshal(data, &s)
+		if err != nil {
+			return
+		}
+		b, err := Marshal(s)
+		if err != nil {
+			t.Fatalf("Marshal(Unmarshal(%x))=_,%v, want no error", data, err)
+		}
+		if want := data[:len(data)-len(rest)]; !bytes.Equal(b, want) {
+			t.Errorf("Marshal(Unmarshal(%x))=%x, want %x", data, b, want)
+		}
+	})
+}
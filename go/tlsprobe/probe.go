@@ -0,0 +1,178 @@
+// Package tlsprobe connects to TLS servers and records the certificate chains
+// and SCTs they serve, so that they can be checked for CT compliance.
+package tlsprobe
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/sctverify"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// DefaultTimeout is how long a probe may take, unless its options or context
+// say otherwise.
+const DefaultTimeout = 30 * time.Second
+
+// Options holds optional configuration for Probe.
+type Options struct {
+	// Name sent in the SNI extension.  If empty, the host part of the
+	// address is sent.
+	ServerName string
+	// Timeout for connecting and completing the handshake.  Zero means
+	// DefaultTimeout.
+	Timeout time.Duration
+	// The TLS configuration to use, whose ServerName is overridden.  If
+	// nil, the chain isn't verified, so that chains which don't verify
+	// can be recorded too.
+	TLSConfig *tls.Config
+	// If set, the stapled OCSP response is checked with VerifyOCSP, e.g.
+	// revocation.VerifyOCSPResponse, and its SCTs are only used if it
+	// verifies.  The leaf's issuer must be in the chain to verify it.
+	VerifyOCSP sctverify.OCSPVerifier
+}
+
+// Result is what a server served in a TLS handshake.
+type Result struct {
+	// The chain the server served, leaf first.
+	Chain []*x509.Certificate
+	// The SCTs in the signed_certificate_timestamp TLS extension, followed
+	// by those in the stapled OCSP response for the leaf.  SCTs embedded in
+	// the leaf aren't included; sctverify.VerifySCTs finds those itself.
+	SCTs []sctverify.DeliveredSCT
+	// The stapled OCSP response, if there was one.
+	OCSPResponse []byte
+	// Why any of the SCTs or the OCSP response couldn't be parsed.  The
+	// SCTs which could be parsed are still returned.
+	ParseErrors []error
+}
+
+// Probe makes a TLS connection to addr, which is a host:port, and returns
+// what the server served in the handshake.  The connection is closed once
+// the handshake is complete.  An error is returned if the handshake fails or
+// the leaf can't be parsed.
+func Probe(ctx context.Context, addr string, opts Options) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	config := &tls.Config{InsecureSkipVerify: true}
+	if opts.TLSConfig != nil {
+		config = opts.TLSConfig.Clone()
+	}
+	config.ServerName = opts.ServerName
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		config.ServerName = host
+	}
+
+	rawConn, err := (&net.Dialer{Deadline: deadline}).Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer rawConn.Close()
+	rawConn.SetDeadline(deadline)
+	// Abandon the handshake if the context is cancelled.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			rawConn.Close()
+		case <-done:
+		}
+	}()
+
+	conn := tls.Client(rawConn, config)
+	if err := conn.Handshake(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return newResult(conn.ConnectionState(), opts.VerifyOCSP)
+}
+
+// newResult extracts the chain and SCTs from the state of a connection,
+// checking the stapled OCSP response with |verifyOCSP| if it is set.
+func newResult(state tls.ConnectionState, verifyOCSP sctverify.OCSPVerifier) (*Result, error) {
+	var r Result
+	for i, c := range state.PeerCertificates {
+		cert, err := x509.ParseCertificate(c.Raw)
+		if _, ok := err.(x509.NonFatalErrors); err != nil && !ok {
+			if i == 0 {
+				return nil, fmt.Errorf("failed to parse leaf: %v", err)
+			}
+			r.ParseErrors = append(r.ParseErrors, fmt.Errorf("failed to parse certificate %d of chain: %v", i, err))
+			continue
+		}
+		r.Chain = append(r.Chain, cert)
+	}
+	if len(r.Chain) == 0 {
+		return nil, fmt.Errorf("server served no certificates")
+	}
+
+	for i, b := range state.SignedCertificateTimestamps {
+		rd := bytes.NewReader(b)
+		sct, err := ct.DeserializeSCT(rd)
+		if err == nil && rd.Len() > 0 {
+			err = fmt.Errorf("%d trailing bytes", rd.Len())
+		}
+		if err != nil {
+			r.ParseErrors = append(r.ParseErrors, fmt.Errorf("failed to parse SCT %d of TLS extension: %v", i, err))
+			continue
+		}
+		r.SCTs = append(r.SCTs, sctverify.DeliveredSCT{SCT: sct, Source: sctverify.TLSExtension})
+	}
+
+	if len(state.OCSPResponse) > 0 {
+		r.OCSPResponse = state.OCSPResponse
+		// The response is only known to be for the leaf if its issuer
+		// is served too; otherwise all the SCTs in it are used.
+		var scts []ct.SignedCertificateTimestamp
+		var err error
+		switch issuer := leafIssuer(r.Chain); {
+		case issuer != nil:
+			scts, err = sctverify.CertOCSPSCTs(state.OCSPResponse, r.Chain[0], issuer, verifyOCSP)
+		case verifyOCSP != nil:
+			err = errors.New("the leaf's issuer isn't in the chain to verify it against")
+		default:
+			scts, err = sctverify.OCSPSCTs(state.OCSPResponse)
+		}
+		if err != nil {
+			r.ParseErrors = append(r.ParseErrors, fmt.Errorf("failed to parse stapled OCSP response: %v", err))
+		}
+		for i := range scts {
+			r.SCTs = append(r.SCTs, sctverify.DeliveredSCT{SCT: &scts[i], Source: sctverify.OCSPResponse})
+		}
+	}
+	return &r, nil
+}
+
+// leafIssuer returns the certificate in |chain| which issued its leaf, or nil
+// if none did.
+func leafIssuer(chain []*x509.Certificate) *x509.Certificate {
+	for _, c := range chain[1:] {
+		if chain[0].CheckSignatureFrom(c) == nil {
+			return c
+		}
+	}
+	return nil
+}
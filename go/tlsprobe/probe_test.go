@@ -0,0 +1,88 @@
+package tlsprobe
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/sctverify"
+	"github.com/google/certificate-transparency/go/testcert"
+	"golang.org/x/net/context"
+)
+
+func testSCT(timestamp uint64) ct.SignedCertificateTimestamp {
+	return ct.SignedCertificateTimestamp{
+		SCTVersion: ct.V1,
+		Timestamp:  timestamp,
+		Signature:  ct.DigitallySigned{HashAlgorithm: ct.SHA256, SignatureAlgorithm: ct.ECDSA, Signature: []byte("sig")},
+	}
+}
+
+// startServer starts a TLS server which serves a self-signed certificate
+// with the given SCTs and OCSP staple.
+func startServer(t *testing.T, scts []ct.SignedCertificateTimestamp, staple []byte) (*httptest.Server, []byte) {
+	key := testcert.NewKey(t)
+	der := testcert.Leaf(t, "leaf.example.com", key, nil).Raw
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, OCSPStaple: staple}
+	for _, sct := range scts {
+		b, err := ct.SerializeSCT(sct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert.SignedCertificateTimestamps = append(cert.SignedCertificateTimestamps, b)
+	}
+	hs := httptest.NewUnstartedServer(http.NotFoundHandler())
+	hs.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	hs.StartTLS()
+	return hs, der
+}
+
+func TestProbe(t *testing.T) {
+	scts := []ct.SignedCertificateTimestamp{testSCT(1), testSCT(2)}
+	hs, der := startServer(t, scts, []byte("garbage"))
+	defer hs.Close()
+
+	r, err := Probe(context.Background(), strings.TrimPrefix(hs.URL, "https://"), Options{ServerName: "leaf.example.com"})
+	if err != nil {
+		t.Fatalf("Probe()=_,%v", err)
+	}
+	if len(r.Chain) != 1 || string(r.Chain[0].Raw) != string(der) {
+		t.Errorf("got chain %v, want the served certificate", r.Chain)
+	}
+	if len(r.SCTs) != len(scts) {
+		t.Fatalf("got %d SCTs, want %d", len(r.SCTs), len(scts))
+	}
+	for i, s := range r.SCTs {
+		if s.Source != sctverify.TLSExtension || s.SCT.Timestamp != scts[i].Timestamp {
+			t.Errorf("#%d: got SCT with timestamp %d from %s, want %d from TLS extension", i, s.SCT.Timestamp, s.Source, scts[i].Timestamp)
+		}
+	}
+	if string(r.OCSPResponse) != "garbage" {
+		t.Errorf("got OCSP response %q, want %q", r.OCSPResponse, "garbage")
+	}
+	if len(r.ParseErrors) != 1 {
+		t.Errorf("got parse errors %v, want one for the OCSP response", r.ParseErrors)
+	}
+}
+
+func TestProbeFails(t *testing.T) {
+	hs, _ := startServer(t, nil, nil)
+	addr := strings.TrimPrefix(hs.URL, "https://")
+
+	// The server's certificate doesn't verify.
+	if _, err := Probe(context.Background(), addr, Options{TLSConfig: &tls.Config{}}); err == nil {
+		t.Error("Probe(verifying)=_,nil, want error")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Probe(ctx, addr, Options{}); err == nil {
+		t.Error("Probe(cancelled)=_,nil, want error")
+	}
+	hs.Close()
+	if _, err := Probe(context.Background(), addr, Options{}); err == nil {
+		t.Error("Probe(closed server)=_,nil, want error")
+	}
+}
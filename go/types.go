@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/google/certificate-transparency/go/x509"
 )
@@ -64,14 +65,19 @@ func (v Version) String() string {
 	switch v {
 	case V1:
 		return "V1"
+	case V2:
+		return "V2"
 	default:
 		return fmt.Sprintf("UnknownVersion(%d)", v)
 	}
 }
 
-// CT Version constants, see section 3.2 of the RFC.
+// CT Version constants, see section 3.2 of the RFC.  V2 is RFC6962-bis,
+// whose structures have no version field of their own; the version is part of
+// each TransItem's type instead (see types_v2.go).
 const (
 	V1 Version = 0
+	V2 Version = 1
 )
 
 // SignatureType differentiates STH signatures from SCT signatures, see RFC
@@ -102,7 +108,7 @@ type ASN1Cert []byte
 // PreCert represents a Precertificate (section 3.2)
 type PreCert struct {
 	IssuerKeyHash  [issuerKeyHashLength]byte
-	TBSCertificate []byte
+	TBSCertificate []byte `tls:"minlen:1,maxlen:16777215"`
 }
 
 // CTExtensions is a representation of the raw bytes of any CtExtension
@@ -134,6 +140,9 @@ const (
 	SHA256 HashAlgorithm = 4
 	SHA384 HashAlgorithm = 5
 	SHA512 HashAlgorithm = 6
+	// Signature algorithms which sign messages themselves, such as
+	// Ed25519, use the Intrinsic hash algorithm (RFC8422 section 5.1.3).
+	Intrinsic HashAlgorithm = 8
 )
 
 func (h HashAlgorithm) String() string {
@@ -152,6 +161,8 @@ func (h HashAlgorithm) String() string {
 		return "SHA384"
 	case SHA512:
 		return "SHA512"
+	case Intrinsic:
+		return "Intrinsic"
 	default:
 		return fmt.Sprintf("UNKNOWN(%d)", h)
 	}
@@ -166,6 +177,7 @@ const (
 	RSA       SignatureAlgorithm = 1
 	DSA       SignatureAlgorithm = 2
 	ECDSA     SignatureAlgorithm = 3
+	Ed25519   SignatureAlgorithm = 7
 )
 
 func (s SignatureAlgorithm) String() string {
@@ -178,6 +190,8 @@ func (s SignatureAlgorithm) String() string {
 		return "DSA"
 	case ECDSA:
 		return "ECDSA"
+	case Ed25519:
+		return "Ed25519"
 	default:
 		return fmt.Sprintf("UNKNOWN(%d)", s)
 	}
@@ -187,7 +201,7 @@ func (s SignatureAlgorithm) String() string {
 type DigitallySigned struct {
 	HashAlgorithm      HashAlgorithm
 	SignatureAlgorithm SignatureAlgorithm
-	Signature          []byte
+	Signature          []byte `tls:"minlen:0,maxlen:65535"`
 }
 
 // FromBase64String populates the DigitallySigned structure from the base64 data passed in.
@@ -287,6 +301,12 @@ type SignedTreeHead struct {
 	LogID             SHA256Hash      `json:"log_id"`              // The SHA256 hash of the log's public key
 }
 
+// TimestampToTime converts a CT timestamp, in milliseconds since the epoch, to
+// a time.
+func TimestampToTime(ts uint64) time.Time {
+	return time.Unix(int64(ts/1000), int64(ts%1000)*int64(time.Millisecond))
+}
+
 // SignedCertificateTimestamp represents the structure returned by the
 // add-chain and add-pre-chain methods after base64 decoding. (see RFC sections
 // 3.2 ,4.1 and 4.2)
@@ -295,7 +315,7 @@ type SignedCertificateTimestamp struct {
 	LogID      SHA256Hash // the SHA-256 hash of the log's public key, calculated over
 	// the DER encoding of the key represented as SubjectPublicKeyInfo.
 	Timestamp  uint64          // Timestamp (in ms since unix epoc) at which the SCT was issued
-	Extensions CTExtensions    // For future extensions to the protocol
+	Extensions CTExtensions    `tls:"minlen:0,maxlen:65535"` // For future extensions to the protocol
 	Signature  DigitallySigned // The Log's signature for this SCT
 }
 
@@ -308,13 +328,14 @@ func (s SignedCertificateTimestamp) String() string {
 }
 
 // TimestampedEntry is part of the MerkleTreeLeaf structure.
-// See RFC section 3.4
+// See RFC section 3.4.  The tls tags of this and the other structures give
+// their TLS encodings, as used by the tls package.
 type TimestampedEntry struct {
 	Timestamp    uint64
 	EntryType    LogEntryType
-	X509Entry    ASN1Cert
-	PrecertEntry PreCert
-	Extensions   CTExtensions
+	X509Entry    ASN1Cert     `tls:"selector:EntryType,val:0,minlen:1,maxlen:16777215"`
+	PrecertEntry PreCert      `tls:"selector:EntryType,val:1"`
+	Extensions   CTExtensions `tls:"minlen:0,maxlen:65535"`
 }
 
 // MerkleTreeLeaf represents the deserialized sructure of the hash input for the
@@ -322,7 +343,7 @@ type TimestampedEntry struct {
 type MerkleTreeLeaf struct {
 	Version          Version          // the version of the protocol to which the MerkleTreeLeaf corresponds
 	LeafType         MerkleLeafType   // The type of the leaf input, currently only TimestampedEntry can exist
-	TimestampedEntry TimestampedEntry // The entry data itself
+	TimestampedEntry TimestampedEntry `tls:"selector:LeafType,val:0"` // The entry data itself
 }
 
 // Precertificate represents the parsed CT Precertificate structure.
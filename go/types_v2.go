@@ -0,0 +1,153 @@
+package ct
+
+import "fmt"
+
+///////////////////////////////////////////////////////////////////////////////
+// The following structures represent those outlined in RFC6962-bis (CT v2),
+// as published in RFC9162.  V2 logs exchange everything as TransItems, whose
+// TLS encodings are given by the tls tags.
+///////////////////////////////////////////////////////////////////////////////
+
+// VersionedTransType represents the VersionedTransType enum from section
+// 4.4 of RFC9162.
+type VersionedTransType uint16
+
+// VersionedTransType constants, see section 4.4 of RFC9162.
+const (
+	X509EntryV2Type        VersionedTransType = 1
+	PrecertEntryV2Type     VersionedTransType = 2
+	X509SCTV2Type          VersionedTransType = 3
+	PrecertSCTV2Type       VersionedTransType = 4
+	SignedTreeHeadV2Type   VersionedTransType = 5
+	ConsistencyProofV2Type VersionedTransType = 6
+	InclusionProofV2Type   VersionedTransType = 7
+)
+
+func (t VersionedTransType) String() string {
+	switch t {
+	case X509EntryV2Type:
+		return "X509EntryV2"
+	case PrecertEntryV2Type:
+		return "PrecertEntryV2"
+	case X509SCTV2Type:
+		return "X509SCTV2"
+	case PrecertSCTV2Type:
+		return "PrecertSCTV2"
+	case SignedTreeHeadV2Type:
+		return "SignedTreeHeadV2"
+	case ConsistencyProofV2Type:
+		return "ConsistencyProofV2"
+	case InclusionProofV2Type:
+		return "InclusionProofV2"
+	default:
+		return fmt.Sprintf("UnknownVersionedTransType(%d)", t)
+	}
+}
+
+// LogIDV2 is the DER encoding of a v2 log's OID, without the ASN.1 tag and
+// length (section 4.4).
+type LogIDV2 []byte
+
+// ExtensionV2 is an SCT or STH extension (section 4.5).
+type ExtensionV2 struct {
+	ExtensionType uint16
+	ExtensionData []byte `tls:"minlen:0,maxlen:65535"`
+}
+
+// NodeHashV2 is a hash of a node of a v2 log's Merkle tree (section 4.7).
+type NodeHashV2 struct {
+	Value []byte `tls:"minlen:32,maxlen:255"`
+}
+
+// TimestampedCertificateEntryDataV2 is the entry a v2 log adds to its tree
+// for a certificate or precertificate, and over which it signs SCTs (section
+// 4.7).  For a certificate, TBSCertificate is its TBSCertificate; for a
+// precertificate, it is the TBSCertificate with the poison extension
+// removed.
+type TimestampedCertificateEntryDataV2 struct {
+	Timestamp      uint64
+	IssuerKeyHash  []byte        `tls:"minlen:32,maxlen:255"`
+	TBSCertificate []byte        `tls:"minlen:1,maxlen:16777215"`
+	SCTExtensions  []ExtensionV2 `tls:"minlen:0,maxlen:65535"`
+}
+
+// SignedCertificateTimestampDataV2 is a v2 SCT (section 4.8).  Signature is
+// over the TransItem holding the TimestampedCertificateEntryDataV2 for the
+// certificate.
+type SignedCertificateTimestampDataV2 struct {
+	LogID         LogIDV2 `tls:"minlen:2,maxlen:127"`
+	Timestamp     uint64
+	SCTExtensions []ExtensionV2 `tls:"minlen:0,maxlen:65535"`
+	Signature     []byte        `tls:"minlen:1,maxlen:65535"`
+}
+
+// TreeHeadDataV2 is a v2 tree head, as signed by the log (section 4.9).
+type TreeHeadDataV2 struct {
+	Timestamp     uint64
+	TreeSize      uint64
+	RootHash      NodeHashV2
+	STHExtensions []ExtensionV2 `tls:"minlen:0,maxlen:65535"`
+}
+
+// SignedTreeHeadDataV2 is a v2 signed tree head (section 4.10).  Signature
+// is over TreeHead.
+type SignedTreeHeadDataV2 struct {
+	LogID     LogIDV2 `tls:"minlen:2,maxlen:127"`
+	TreeHead  TreeHeadDataV2
+	Signature []byte `tls:"minlen:1,maxlen:65535"`
+}
+
+// ConsistencyProofDataV2 is a proof that the tree of size TreeSize2 is an
+// append-only extension of the tree of size TreeSize1 (section 4.11).
+type ConsistencyProofDataV2 struct {
+	LogID           LogIDV2 `tls:"minlen:2,maxlen:127"`
+	TreeSize1       uint64
+	TreeSize2       uint64
+	ConsistencyPath []NodeHashV2 `tls:"minlen:0,maxlen:65535"`
+}
+
+// InclusionProofDataV2 is a proof that the leaf at LeafIndex is included in
+// the tree of size TreeSize (section 4.12).
+type InclusionProofDataV2 struct {
+	LogID         LogIDV2 `tls:"minlen:2,maxlen:127"`
+	TreeSize      uint64
+	LeafIndex     uint64
+	InclusionPath []NodeHashV2 `tls:"minlen:0,maxlen:65535"`
+}
+
+// TransItem is the container for every structure a v2 log produces (section
+// 4.4).  Only the field selected by VersionedType is meaningful.
+type TransItem struct {
+	VersionedType    VersionedTransType
+	X509Entry        TimestampedCertificateEntryDataV2 `tls:"selector:VersionedType,val:1"`
+	PrecertEntry     TimestampedCertificateEntryDataV2 `tls:"selector:VersionedType,val:2"`
+	X509SCT          SignedCertificateTimestampDataV2  `tls:"selector:VersionedType,val:3"`
+	PrecertSCT       SignedCertificateTimestampDataV2  `tls:"selector:VersionedType,val:4"`
+	SignedTreeHead   SignedTreeHeadDataV2              `tls:"selector:VersionedType,val:5"`
+	ConsistencyProof ConsistencyProofDataV2            `tls:"selector:VersionedType,val:6"`
+	InclusionProof   InclusionProofDataV2              `tls:"selector:VersionedType,val:7"`
+}
+
+// SCT returns the SCT held by an X509SCTV2Type or PrecertSCTV2Type TransItem,
+// or nil if it holds something else.
+func (t *TransItem) SCT() *SignedCertificateTimestampDataV2 {
+	switch t.VersionedType {
+	case X509SCTV2Type:
+		return &t.X509SCT
+	case PrecertSCTV2Type:
+		return &t.PrecertSCT
+	}
+	return nil
+}
+
+// Entry returns the entry held by an X509EntryV2Type or PrecertEntryV2Type
+// TransItem, or nil if it holds something else.
+func (t *TransItem) Entry() *TimestampedCertificateEntryDataV2 {
+	switch t.VersionedType {
+	case X509EntryV2Type:
+		return &t.X509Entry
+	case PrecertEntryV2Type:
+		return &t.PrecertEntry
+	}
+	return nil
+}
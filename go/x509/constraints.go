@@ -0,0 +1,294 @@
+package x509
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/google/certificate-transparency/go/asn1"
+)
+
+// This file holds the parsing, creation and evaluation of name constraints
+// (RFC 5280 section 4.2.1.10).  Verify only checks PermittedDNSDomains, and
+// stops at the first name it doesn't allow; CheckNameConstraints checks every
+// kind of constraint and reports everything which violates them, for
+// monitoring what CAs issue.
+
+// The tags of the types of GeneralName (RFC 5280 section 4.2.1.6) which name
+// constraints can be evaluated for.
+const (
+	nameTagRFC822Name = 1
+	nameTagDNSName    = 2
+	nameTagURI        = 6
+	nameTagIPAddress  = 7
+)
+
+// parseNameConstraints fills in the name constraints of |out| from |value|,
+// the value of a name constraints extension.  It returns whether there were
+// any constraints besides permitted DNS domains, which Verify doesn't
+// enforce.
+func parseNameConstraints(out *Certificate, value []byte) (bool, error) {
+	var constraints nameConstraints
+	if _, err := asn1.Unmarshal(value, &constraints); err != nil {
+		return false, err
+	}
+	unenforced := len(constraints.Excluded) > 0
+	for _, subtree := range constraints.Permitted {
+		base := subtree.Base
+		if base.Class != 2 || len(base.Bytes) == 0 {
+			unenforced = true
+			continue
+		}
+		switch base.Tag {
+		case nameTagDNSName:
+			out.PermittedDNSDomains = append(out.PermittedDNSDomains, string(base.Bytes))
+			continue
+		case nameTagRFC822Name:
+			out.PermittedEmailAddresses = append(out.PermittedEmailAddresses, string(base.Bytes))
+		case nameTagURI:
+			out.PermittedURIDomains = append(out.PermittedURIDomains, string(base.Bytes))
+		case nameTagIPAddress:
+			ipNet, err := parseIPRange(base.Bytes)
+			if err != nil {
+				return false, err
+			}
+			out.PermittedIPRanges = append(out.PermittedIPRanges, ipNet)
+		}
+		unenforced = true
+	}
+	for _, subtree := range constraints.Excluded {
+		base := subtree.Base
+		if base.Class != 2 || len(base.Bytes) == 0 {
+			continue
+		}
+		switch base.Tag {
+		case nameTagDNSName:
+			out.ExcludedDNSDomains = append(out.ExcludedDNSDomains, string(base.Bytes))
+		case nameTagRFC822Name:
+			out.ExcludedEmailAddresses = append(out.ExcludedEmailAddresses, string(base.Bytes))
+		case nameTagURI:
+			out.ExcludedURIDomains = append(out.ExcludedURIDomains, string(base.Bytes))
+		case nameTagIPAddress:
+			ipNet, err := parseIPRange(base.Bytes)
+			if err != nil {
+				return false, err
+			}
+			out.ExcludedIPRanges = append(out.ExcludedIPRanges, ipNet)
+		}
+	}
+	return unenforced, nil
+}
+
+// parseIPRange parses an iPAddress name constraint: an address followed by a
+// mask of the same length.
+func parseIPRange(b []byte) (*net.IPNet, error) {
+	switch len(b) {
+	case 2 * net.IPv4len, 2 * net.IPv6len:
+	default:
+		return nil, fmt.Errorf("x509: IP address name constraint of length %d", len(b))
+	}
+	n := len(b) / 2
+	ipNet := &net.IPNet{IP: net.IP(b[:n]), Mask: net.IPMask(b[n:])}
+	if ones, bits := ipNet.Mask.Size(); ones == 0 && bits == 0 {
+		return nil, errors.New("x509: IP address name constraint with non-contiguous mask")
+	}
+	return ipNet, nil
+}
+
+// hasNameConstraints reports whether |template| has any name constraints.
+func hasNameConstraints(template *Certificate) bool {
+	return len(template.PermittedDNSDomains) > 0 || len(template.ExcludedDNSDomains) > 0 ||
+		len(template.PermittedEmailAddresses) > 0 || len(template.ExcludedEmailAddresses) > 0 ||
+		len(template.PermittedIPRanges) > 0 || len(template.ExcludedIPRanges) > 0 ||
+		len(template.PermittedURIDomains) > 0 || len(template.ExcludedURIDomains) > 0
+}
+
+// marshalNameConstraints returns the value of the name constraints extension
+// for the name constraints of |template|.
+func marshalNameConstraints(template *Certificate) ([]byte, error) {
+	subtrees := func(dnsDomains, emailAddresses []string, ipRanges []*net.IPNet, uriDomains []string) []generalSubtree {
+		var out []generalSubtree
+		add := func(tag int, b []byte) {
+			out = append(out, generalSubtree{Base: asn1.RawValue{Class: 2, Tag: tag, Bytes: b}})
+		}
+		for _, d := range dnsDomains {
+			add(nameTagDNSName, []byte(d))
+		}
+		for _, e := range emailAddresses {
+			add(nameTagRFC822Name, []byte(e))
+		}
+		for _, r := range ipRanges {
+			// If possible, IPv4 ranges are encoded in 4 bytes.
+			ip, mask := r.IP.To4(), r.Mask
+			if ip == nil || len(mask) != net.IPv4len {
+				ip, mask = r.IP.To16(), r.Mask
+			}
+			add(nameTagIPAddress, append(append([]byte{}, ip...), mask...))
+		}
+		for _, u := range uriDomains {
+			add(nameTagURI, []byte(u))
+		}
+		return out
+	}
+	return asn1.Marshal(nameConstraints{
+		Permitted: subtrees(template.PermittedDNSDomains, template.PermittedEmailAddresses, template.PermittedIPRanges, template.PermittedURIDomains),
+		Excluded:  subtrees(template.ExcludedDNSDomains, template.ExcludedEmailAddresses, template.ExcludedIPRanges, template.ExcludedURIDomains),
+	})
+}
+
+// NameConstraintViolation describes a subject alternative name of a
+// certificate which the name constraints of a CA certificate above it in its
+// chain don't allow.
+type NameConstraintViolation struct {
+	// The certificate with the name, and the CA certificate with the
+	// constraints.
+	Cert, CA *Certificate
+	// The type of the name: "dNSName", "rfc822Name", "iPAddress" or
+	// "uniformResourceIdentifier".
+	Type string
+	Name string
+	// The excluded subtree which the name is in, or "" if the name isn't in
+	// any of the permitted subtrees of its type.
+	Excluded string
+}
+
+func (v NameConstraintViolation) Error() string {
+	if v.Excluded != "" {
+		return fmt.Sprintf("x509: %s %q of %q is excluded by %q in the name constraints of %q", v.Type, v.Name, v.Cert.Subject.CommonName, v.Excluded, v.CA.Subject.CommonName)
+	}
+	return fmt.Sprintf("x509: %s %q of %q is not permitted by the name constraints of %q", v.Type, v.Name, v.Cert.Subject.CommonName, v.CA.Subject.CommonName)
+}
+
+// CheckNameConstraints evaluates the name constraints of the certificates in
+// |chain|, which runs from |leaf|'s issuer towards a root, and returns every
+// violation of them: each subject alternative name of a certificate below a
+// CA in the chain which the CA's constraints exclude, or which is of a type
+// the CA permits some names of, but isn't one of them.  As RFC 5280 says,
+// self-issued intermediates aren't held to the constraints of the CAs above
+// them.  Only DNS, email, IP address and URI names are checked; names in the
+// subject aren't.  The chain isn't otherwise verified.
+func CheckNameConstraints(leaf *Certificate, chain []*Certificate) []NameConstraintViolation {
+	certs := append([]*Certificate{leaf}, chain...)
+	var violations []NameConstraintViolation
+	for i := 1; i < len(certs); i++ {
+		ca := certs[i]
+		if !hasNameConstraints(ca) {
+			continue
+		}
+		for j, c := range certs[:i] {
+			if j > 0 && bytes.Equal(c.RawSubject, c.RawIssuer) {
+				continue
+			}
+			violations = append(violations, checkNames(c, ca)...)
+		}
+	}
+	return violations
+}
+
+// checkNames returns the names of |c| which violate the constraints of |ca|.
+func checkNames(c, ca *Certificate) []NameConstraintViolation {
+	var violations []NameConstraintViolation
+	check := func(typ, name string, permitted, excluded []string, match func(name, constraint string) bool) {
+		for _, e := range excluded {
+			if match(name, e) {
+				violations = append(violations, NameConstraintViolation{Cert: c, CA: ca, Type: typ, Name: name, Excluded: e})
+				return
+			}
+		}
+		if len(permitted) == 0 {
+			return
+		}
+		for _, p := range permitted {
+			if match(name, p) {
+				return
+			}
+		}
+		violations = append(violations, NameConstraintViolation{Cert: c, CA: ca, Type: typ, Name: name})
+	}
+
+	for _, name := range c.DNSNames {
+		check("dNSName", name, ca.PermittedDNSDomains, ca.ExcludedDNSDomains, matchDomainConstraint)
+	}
+	for _, name := range c.EmailAddresses {
+		check("rfc822Name", name, ca.PermittedEmailAddresses, ca.ExcludedEmailAddresses, matchEmailConstraint)
+	}
+	if len(c.IPAddresses) > 0 {
+		permitted, excluded := ipRangeStrings(ca.PermittedIPRanges), ipRangeStrings(ca.ExcludedIPRanges)
+		for _, ip := range c.IPAddresses {
+			check("iPAddress", ip.String(), permitted, excluded, matchIPConstraint)
+		}
+	}
+	for _, name := range c.URIs {
+		check("uniformResourceIdentifier", name, ca.PermittedURIDomains, ca.ExcludedURIDomains, matchURIConstraint)
+	}
+	return violations
+}
+
+func ipRangeStrings(ranges []*net.IPNet) []string {
+	var s []string
+	for _, r := range ranges {
+		s = append(s, r.String())
+	}
+	return s
+}
+
+// matchDomainConstraint reports whether |domain| is within the DNS name
+// constraint |constraint|: it is the constraint or a subdomain of it, or only
+// a subdomain of it if the constraint starts with a period.
+func matchDomainConstraint(domain, constraint string) bool {
+	domain, constraint = toLowerCaseASCII(domain), toLowerCaseASCII(constraint)
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(domain, constraint)
+	}
+	return domain == constraint || strings.HasSuffix(domain, "."+constraint)
+}
+
+// matchHostConstraint reports whether |host| is within the host part of an
+// email or URI name constraint: it is the host given, or any subdomain of a
+// domain starting with a period.
+func matchHostConstraint(host, constraint string) bool {
+	host, constraint = toLowerCaseASCII(host), toLowerCaseASCII(constraint)
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(host, constraint)
+	}
+	return host == constraint
+}
+
+// matchEmailConstraint reports whether |email| is within the rfc822Name
+// constraint |constraint|, which is a particular mailbox, or all the mailboxes
+// on a host or in a domain.
+func matchEmailConstraint(email, constraint string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	local, host := email[:at], email[at+1:]
+	if i := strings.LastIndex(constraint, "@"); i >= 0 {
+		return local == constraint[:i] && matchHostConstraint(host, constraint[i+1:])
+	}
+	return matchHostConstraint(host, constraint)
+}
+
+// matchIPConstraint reports whether the IP address |ip| is in the range
+// |constraint|, both as strings.
+func matchIPConstraint(ip, constraint string) bool {
+	_, ipNet, err := net.ParseCIDR(constraint)
+	return err == nil && ipNet.Contains(net.ParseIP(ip))
+}
+
+// matchURIConstraint reports whether the host of |uri| is within the
+// uniformResourceIdentifier constraint |constraint|.
+func matchURIConstraint(uri, constraint string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	host := u.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host != "" && matchHostConstraint(host, constraint)
+}
@@ -0,0 +1,231 @@
+package x509
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+func mustParseCIDR(t *testing.T, s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ipNet
+}
+
+// constrainedChain creates certificates from |templates|, each issued by the
+// next, with the last self-signed, and returns them parsed.
+func constrainedChain(t *testing.T, templates ...*Certificate) []*Certificate {
+	keys := make([]*ecdsa.PrivateKey, len(templates))
+	for i := range keys {
+		var err error
+		if keys[i], err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			t.Fatal(err)
+		}
+	}
+	certs := make([]*Certificate, len(templates))
+	for i := len(templates) - 1; i >= 0; i-- {
+		tmpl := *templates[i]
+		tmpl.SerialNumber = big.NewInt(int64(i + 1))
+		tmpl.NotBefore = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		tmpl.NotAfter = time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)
+		parent, parentKey := &tmpl, keys[i]
+		if i < len(templates)-1 {
+			parent, parentKey = certs[i+1], keys[i+1]
+		}
+		der, err := CreateCertificate(rand.Reader, &tmpl, parent, &keys[i].PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if certs[i], err = ParseCertificate(der); IsFatal(err) {
+			t.Fatal(err)
+		}
+	}
+	return certs
+}
+
+func TestNameConstraintsRoundTrip(t *testing.T) {
+	tmpl := &Certificate{
+		Subject:                 pkix.Name{CommonName: "Constrained CA"},
+		BasicConstraintsValid:   true,
+		IsCA:                    true,
+		PermittedDNSDomains:     []string{"example.com"},
+		ExcludedDNSDomains:      []string{"secret.example.com"},
+		PermittedEmailAddresses: []string{".example.com"},
+		ExcludedEmailAddresses:  []string{"ceo@example.com"},
+		PermittedIPRanges:       []*net.IPNet{mustParseCIDR(t, "10.0.0.0/8"), mustParseCIDR(t, "2001:db8::/32")},
+		ExcludedIPRanges:        []*net.IPNet{mustParseCIDR(t, "10.1.0.0/16")},
+		PermittedURIDomains:     []string{".example.com"},
+		ExcludedURIDomains:      []string{"www.example.com"},
+		URIs:                    []string{"https://www.example.com/ca"},
+	}
+	cert := constrainedChain(t, tmpl)[0]
+	for _, f := range []string{
+		"PermittedDNSDomains", "ExcludedDNSDomains",
+		"PermittedEmailAddresses", "ExcludedEmailAddresses",
+		"PermittedIPRanges", "ExcludedIPRanges",
+		"PermittedURIDomains", "ExcludedURIDomains",
+		"URIs",
+	} {
+		got := reflect.ValueOf(cert).Elem().FieldByName(f).Interface()
+		want := reflect.ValueOf(tmpl).Elem().FieldByName(f).Interface()
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s=%v, want %v", f, got, want)
+		}
+	}
+}
+
+func TestNameConstraintsCritical(t *testing.T) {
+	// Constraints other than permitted DNS domains aren't enforced by
+	// Verify, so can't be marked critical without an error.
+	for i, tc := range []struct {
+		tmpl      Certificate
+		wantError bool
+	}{
+		{tmpl: Certificate{PermittedDNSDomains: []string{"example.com"}}},
+		{tmpl: Certificate{ExcludedDNSDomains: []string{"example.com"}}, wantError: true},
+		{tmpl: Certificate{PermittedIPRanges: []*net.IPNet{mustParseCIDR(t, "10.0.0.0/8")}}, wantError: true},
+	} {
+		tc.tmpl.Subject = pkix.Name{CommonName: "Constrained CA"}
+		tc.tmpl.PermittedDNSDomainsCritical = true
+		_, err := ParseCertificate(constrainedChain(t, &tc.tmpl)[0].Raw)
+		want := error(nil)
+		if tc.wantError {
+			want = NonFatalErrors{Errors: []error{UnhandledCriticalExtension{oidExtensionNameConstraints}}}
+		}
+		if !reflect.DeepEqual(err, want) {
+			t.Errorf("#%d: ParseCertificate()=_,%v, want %v", i, err, want)
+		}
+	}
+}
+
+func TestCheckNameConstraints(t *testing.T) {
+	root := &Certificate{Subject: pkix.Name{CommonName: "Root"}, BasicConstraintsValid: true, IsCA: true}
+	ca := &Certificate{
+		Subject:                 pkix.Name{CommonName: "CA"},
+		BasicConstraintsValid:   true,
+		IsCA:                    true,
+		PermittedDNSDomains:     []string{"example.com", ".example.org"},
+		ExcludedDNSDomains:      []string{"secret.example.com"},
+		PermittedEmailAddresses: []string{"example.com", "admin@example.net"},
+		ExcludedEmailAddresses:  []string{"ceo@example.com"},
+		PermittedIPRanges:       []*net.IPNet{mustParseCIDR(t, "10.0.0.0/8")},
+		ExcludedIPRanges:        []*net.IPNet{mustParseCIDR(t, "10.1.0.0/16")},
+		PermittedURIDomains:     []string{".example.com"},
+		ExcludedURIDomains:      []string{"private.example.com"},
+	}
+	for i, tc := range []struct {
+		leaf Certificate
+		want []NameConstraintViolation
+	}{
+		{
+			leaf: Certificate{
+				DNSNames:       []string{"example.com", "www.Example.COM", "www.example.org"},
+				EmailAddresses: []string{"anyone@example.com", "admin@EXAMPLE.net"},
+				IPAddresses:    []net.IP{net.ParseIP("10.2.3.4")},
+				URIs:           []string{"https://www.example.com:8443/", "ldap://ldap.example.com/o=Example"},
+			},
+		},
+		{
+			leaf: Certificate{
+				DNSNames:       []string{"example.org", "www.example.net", "www.secret.example.com"},
+				EmailAddresses: []string{"ceo@example.com", "someone@www.example.com", "user@example.net", "not-an-address"},
+				IPAddresses:    []net.IP{net.ParseIP("10.1.2.3"), net.ParseIP("192.168.0.1"), net.ParseIP("2001:db8::1")},
+				URIs:           []string{"https://private.example.com/", "https://example.com/", "urn:isbn:0451450523"},
+			},
+			want: []NameConstraintViolation{
+				{Type: "dNSName", Name: "example.org"},
+				{Type: "dNSName", Name: "www.example.net"},
+				{Type: "dNSName", Name: "www.secret.example.com", Excluded: "secret.example.com"},
+				{Type: "rfc822Name", Name: "ceo@example.com", Excluded: "ceo@example.com"},
+				{Type: "rfc822Name", Name: "someone@www.example.com"},
+				{Type: "rfc822Name", Name: "user@example.net"},
+				{Type: "rfc822Name", Name: "not-an-address"},
+				{Type: "iPAddress", Name: "10.1.2.3", Excluded: "10.1.0.0/16"},
+				{Type: "iPAddress", Name: "192.168.0.1"},
+				{Type: "iPAddress", Name: "2001:db8::1"},
+				{Type: "uniformResourceIdentifier", Name: "https://private.example.com/", Excluded: "private.example.com"},
+				{Type: "uniformResourceIdentifier", Name: "https://example.com/"},
+				{Type: "uniformResourceIdentifier", Name: "urn:isbn:0451450523"},
+			},
+		},
+	} {
+		tc.leaf.Subject = pkix.Name{CommonName: "Leaf"}
+		chain := constrainedChain(t, &tc.leaf, ca, root)
+		for j := range tc.want {
+			tc.want[j].Cert, tc.want[j].CA = chain[0], chain[1]
+		}
+		if got := CheckNameConstraints(chain[0], chain[1:]); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("#%d: CheckNameConstraints()=%v, want %v", i, got, tc.want)
+		}
+	}
+}
+
+func TestCheckNameConstraintsAlongChain(t *testing.T) {
+	root := &Certificate{
+		Subject:               pkix.Name{CommonName: "Root"},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		PermittedDNSDomains:   []string{"example.com"},
+	}
+	// The intermediate's own names are constrained too...
+	intermediate := &Certificate{
+		Subject:               pkix.Name{CommonName: "Intermediate"},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"ca.example.net"},
+		ExcludedDNSDomains:    []string{"www.example.com"},
+	}
+	leaf := &Certificate{Subject: pkix.Name{CommonName: "Leaf"}, DNSNames: []string{"www.example.com"}}
+	chain := constrainedChain(t, leaf, intermediate, root)
+	want := []NameConstraintViolation{
+		{Cert: chain[0], CA: chain[1], Type: "dNSName", Name: "www.example.com", Excluded: "www.example.com"},
+		{Cert: chain[1], CA: chain[2], Type: "dNSName", Name: "ca.example.net"},
+	}
+	if got := CheckNameConstraints(chain[0], chain[1:]); !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckNameConstraints()=%v, want %v", got, want)
+	}
+	if got := CheckNameConstraints(chain[0], nil); len(got) != 0 {
+		t.Errorf("CheckNameConstraints(no chain)=%v, want none", got)
+	}
+
+	// ...unless it is self-issued, i.e. its subject and issuer are the same,
+	// though its constraints still apply to the leaf.
+	intermediate.Subject = root.Subject
+	chain = constrainedChain(t, leaf, intermediate, root)
+	want = []NameConstraintViolation{
+		{Cert: chain[0], CA: chain[1], Type: "dNSName", Name: "www.example.com", Excluded: "www.example.com"},
+	}
+	if got := CheckNameConstraints(chain[0], chain[1:]); !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckNameConstraints(self-issued intermediate)=%v, want %v", got, want)
+	}
+}
+
+func TestNameConstraintViolationError(t *testing.T) {
+	cert, ca := &Certificate{Subject: pkix.Name{CommonName: "Leaf"}}, &Certificate{Subject: pkix.Name{CommonName: "CA"}}
+	for i, tc := range []struct {
+		v    NameConstraintViolation
+		want string
+	}{
+		{
+			v:    NameConstraintViolation{Cert: cert, CA: ca, Type: "dNSName", Name: "www.example.com"},
+			want: `x509: dNSName "www.example.com" of "Leaf" is not permitted by the name constraints of "CA"`,
+		},
+		{
+			v:    NameConstraintViolation{Cert: cert, CA: ca, Type: "iPAddress", Name: "10.1.2.3", Excluded: "10.0.0.0/8"},
+			want: `x509: iPAddress "10.1.2.3" of "Leaf" is excluded by "10.0.0.0/8" in the name constraints of "CA"`,
+		},
+	} {
+		if got := tc.v.Error(); got != tc.want {
+			t.Errorf("#%d: Error()=%q, want %q", i, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,607 @@
+package x509
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// This file extends the CRL support of crypto/x509 with the extensions which
+// say what a CRL covers, including delta CRLs (RFC 5280 section 5.2), and with
+// a CRLReader, which parses CRLs as they are read, so that CRLs of millions of
+// entries can be checked without holding them in memory.
+
+var (
+	oidExtensionCRLNumber                = asn1.ObjectIdentifier{2, 5, 29, 20}
+	oidExtensionDeltaCRLIndicator        = asn1.ObjectIdentifier{2, 5, 29, 27}
+	oidExtensionIssuingDistributionPoint = asn1.ObjectIdentifier{2, 5, 29, 28}
+	oidExtensionFreshestCRL              = asn1.ObjectIdentifier{2, 5, 29, 46}
+	oidExtensionAuthorityKeyIdentifier   = asn1.ObjectIdentifier{2, 5, 29, 35}
+)
+
+// CRLExtensions are the extensions of a CRL which say what it covers.
+type CRLExtensions struct {
+	// The number of the CRL, which increases with each CRL its issuer
+	// issues for the same scope, or nil if it has none.
+	Number *big.Int
+	// If the CRL is a delta CRL, the number of the complete CRL which it
+	// updates, which it must be applied to; nil otherwise.
+	BaseCRLNumber *big.Int
+	// The scope of the CRL, or nil if it covers all the certificates its
+	// issuer issues.
+	IssuingDistributionPoint *IssuingDistributionPoint
+	// The URLs of the delta CRLs which update the CRL.
+	FreshestCRL []string
+}
+
+// IssuingDistributionPoint is the scope of a CRL (RFC 5280 section 5.2.5).
+type IssuingDistributionPoint struct {
+	// The URIs of the distribution point the CRL is for, if it is named
+	// with URIs.
+	DistributionPoint []string
+	// If set, the CRL only covers end entity certificates, CA
+	// certificates, or attribute certificates.
+	OnlyContainsUserCerts      bool
+	OnlyContainsCACerts        bool
+	OnlyContainsAttributeCerts bool
+	// If non-empty, the CRL only covers revocations for the CRLReasons
+	// whose bits are set, in the order of RFC 5280 section 4.2.1.13.
+	OnlySomeReasons asn1.BitString
+	// If set, the CRL may list certificates of other issuers than its own.
+	IndirectCRL bool
+}
+
+// RFC 5280, 5.2.5
+type issuingDistributionPoint struct {
+	DistributionPoint          distributionPointName `asn1:"optional,tag:0"`
+	OnlyContainsUserCerts      bool                  `asn1:"optional,tag:1"`
+	OnlyContainsCACerts        bool                  `asn1:"optional,tag:2"`
+	OnlySomeReasons            asn1.BitString        `asn1:"optional,tag:3"`
+	IndirectCRL                bool                  `asn1:"optional,tag:4"`
+	OnlyContainsAttributeCerts bool                  `asn1:"optional,tag:5"`
+}
+
+// Covers reports whether a CRL with this scope is the one to check |c|
+// against: whether it covers the kind of certificate c is, and, if both name
+// their distribution points with URIs, whether they name the same one (RFC
+// 5280 section 6.3.3).  It doesn't take OnlySomeReasons or IndirectCRL into
+// account.
+func (idp *IssuingDistributionPoint) Covers(c *Certificate) bool {
+	isCA := c.BasicConstraintsValid && c.IsCA
+	switch {
+	case idp.OnlyContainsAttributeCerts,
+		idp.OnlyContainsUserCerts && isCA,
+		idp.OnlyContainsCACerts && !isCA:
+		return false
+	}
+	if len(idp.DistributionPoint) == 0 || len(c.CRLDistributionPoints) == 0 {
+		return true
+	}
+	for _, name := range idp.DistributionPoint {
+		for _, dp := range c.CRLDistributionPoints {
+			if name == dp {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseCRLExtensions parses the extensions of a CRL, which are in its
+// TBSCertList or its CRLReader, and returns an UnhandledCriticalExtension error
+// if any it doesn't understand are critical, as the CRL mustn't then be used.
+func ParseCRLExtensions(exts []pkix.Extension) (*CRLExtensions, error) {
+	out := &CRLExtensions{}
+	for _, e := range exts {
+		switch {
+		case e.Id.Equal(oidExtensionCRLNumber):
+			n, err := parseCRLNumber(e.Value)
+			if err != nil {
+				return nil, fmt.Errorf("x509: malformed CRL number: %v", err)
+			}
+			out.Number = n
+		case e.Id.Equal(oidExtensionDeltaCRLIndicator):
+			n, err := parseCRLNumber(e.Value)
+			if err != nil {
+				return nil, fmt.Errorf("x509: malformed delta CRL indicator: %v", err)
+			}
+			out.BaseCRLNumber = n
+		case e.Id.Equal(oidExtensionIssuingDistributionPoint):
+			idp, err := parseIssuingDistributionPoint(e.Value)
+			if err != nil {
+				return nil, fmt.Errorf("x509: malformed issuing distribution point: %v", err)
+			}
+			out.IssuingDistributionPoint = idp
+		case e.Id.Equal(oidExtensionFreshestCRL):
+			var dps []distributionPoint
+			if err := unmarshalAll(e.Value, &dps); err != nil {
+				return nil, fmt.Errorf("x509: malformed freshest CRL: %v", err)
+			}
+			for _, dp := range dps {
+				uris, err := distributionPointURIs(dp.DistributionPoint)
+				if err != nil {
+					return nil, fmt.Errorf("x509: malformed freshest CRL: %v", err)
+				}
+				out.FreshestCRL = append(out.FreshestCRL, uris...)
+			}
+		case e.Id.Equal(oidExtensionAuthorityKeyIdentifier):
+		default:
+			if e.Critical {
+				return nil, UnhandledCriticalExtension{e.Id}
+			}
+		}
+	}
+	return out, nil
+}
+
+func parseCRLNumber(der []byte) (*big.Int, error) {
+	n := new(big.Int)
+	if err := unmarshalAll(der, &n); err != nil {
+		return nil, err
+	}
+	if n.Sign() < 0 {
+		return nil, errors.New("negative CRL number")
+	}
+	return n, nil
+}
+
+func parseIssuingDistributionPoint(der []byte) (*IssuingDistributionPoint, error) {
+	var idp issuingDistributionPoint
+	if err := unmarshalAll(der, &idp); err != nil {
+		return nil, err
+	}
+	uris, err := distributionPointURIs(idp.DistributionPoint)
+	if err != nil {
+		return nil, err
+	}
+	return &IssuingDistributionPoint{
+		DistributionPoint:          uris,
+		OnlyContainsUserCerts:      idp.OnlyContainsUserCerts,
+		OnlyContainsCACerts:        idp.OnlyContainsCACerts,
+		OnlyContainsAttributeCerts: idp.OnlyContainsAttributeCerts,
+		OnlySomeReasons:            idp.OnlySomeReasons,
+		IndirectCRL:                idp.IndirectCRL,
+	}, nil
+}
+
+// distributionPointURIs returns the URIs among the full name of |name|.
+func distributionPointURIs(name distributionPointName) ([]string, error) {
+	var uris []string
+	for rest := name.FullName.Bytes; len(rest) > 0; {
+		var n asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &n); err != nil {
+			return nil, err
+		}
+		if n.Class == asn1.ClassContextSpecific && n.Tag == tagURI {
+			uris = append(uris, string(n.Bytes))
+		}
+	}
+	return uris, nil
+}
+
+// unmarshalAll is asn1.Unmarshal, which fails if there is data after the
+// value.
+func unmarshalAll(der []byte, val interface{}) error {
+	rest, err := asn1.Unmarshal(der, val)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New("trailing data")
+	}
+	return nil
+}
+
+// The GeneralName tag of a URI.
+const tagURI = 6
+
+// maxCRLElementSize is the largest element of a CRL, such as a revoked
+// certificate or the extensions, which a CRLReader reads.
+const maxCRLElementSize = 1 << 20
+
+// derHeader is the identifier and length octets of a DER element.
+type derHeader struct {
+	class, tag int
+	compound   bool
+	length     int64
+	raw        []byte
+}
+
+func (h derHeader) is(class, tag int, compound bool) bool {
+	return h.class == class && h.tag == tag && h.compound == compound
+}
+
+// CRLReader parses a DER encoded CRL as it reads it, a revoked certificate at
+// a time, so that large CRLs can be checked without holding them in memory.
+// The fields of the TBSCertList before the revoked certificates are set by
+// NewCRLReader, and those after them once Next has returned io.EOF, when the
+// CRL's signature can be checked with CheckSignatureFrom.
+type CRLReader struct {
+	Version    int
+	Signature  pkix.AlgorithmIdentifier
+	Issuer     pkix.RDNSequence
+	RawIssuer  []byte
+	ThisUpdate time.Time
+	// The zero time if the CRL doesn't say.
+	NextUpdate time.Time
+
+	// Set once Next has returned io.EOF.
+	Extensions         []pkix.Extension
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+
+	in *bufio.Reader
+	// Where the bytes of the TBSCertList go as they are read: a buffer
+	// until the algorithm it is signed with is known, and then its hash.
+	tbs      io.Writer
+	tbsHash  hash.Hash
+	hashErr  error
+	digest   []byte
+	hashType crypto.Hash
+	// The bytes of the CertificateList, TBSCertList and list of revoked
+	// certificates left to read.
+	certListLeft, tbsLeft, revokedLeft int64
+	// The header of the element after the revoked certificates, if it has
+	// been read.
+	pending *derHeader
+	done    bool
+	err     error
+}
+
+// NewCRLReader returns a CRLReader which reads a DER encoded CRL from |r|.  It
+// reads the CRL up to its first revoked certificate.
+func NewCRLReader(r io.Reader) (*CRLReader, error) {
+	cr := &CRLReader{in: bufio.NewReader(r), tbs: new(bytes.Buffer)}
+	if err := cr.readStart(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (r *CRLReader) readStart() error {
+	h, err := r.readHeader()
+	if err != nil {
+		return err
+	}
+	if !h.is(asn1.ClassUniversal, asn1.TagSequence, true) {
+		return errors.New("x509: CRL isn't a SEQUENCE")
+	}
+	r.certListLeft = h.length
+	if h, err = r.readHeader(); err != nil {
+		return err
+	}
+	if !h.is(asn1.ClassUniversal, asn1.TagSequence, true) {
+		return errors.New("x509: TBSCertList isn't a SEQUENCE")
+	}
+	if err := r.consume(&r.certListLeft, int64(len(h.raw))+h.length); err != nil {
+		return err
+	}
+	r.tbs.Write(h.raw)
+	r.tbsLeft = h.length
+
+	el, err := r.readTBSElement()
+	if err != nil {
+		return err
+	}
+	if len(el) > 0 && el[0] == asn1.TagInteger {
+		if err := unmarshalAll(el, &r.Version); err != nil {
+			return fmt.Errorf("x509: malformed CRL version: %v", err)
+		}
+		if el, err = r.readTBSElement(); err != nil {
+			return err
+		}
+	}
+	if err := unmarshalAll(el, &r.Signature); err != nil {
+		return fmt.Errorf("x509: malformed CRL signature algorithm: %v", err)
+	}
+	r.startHash()
+	if r.RawIssuer, err = r.readTBSElement(); err != nil {
+		return err
+	}
+	if err := unmarshalAll(r.RawIssuer, &r.Issuer); err != nil {
+		return fmt.Errorf("x509: malformed CRL issuer: %v", err)
+	}
+	if el, err = r.readTBSElement(); err != nil {
+		return err
+	}
+	if err := unmarshalAll(el, &r.ThisUpdate); err != nil {
+		return fmt.Errorf("x509: malformed CRL thisUpdate: %v", err)
+	}
+
+	if r.tbsLeft == 0 {
+		return nil
+	}
+	if h, err = r.readTBSHeader(); err != nil {
+		return err
+	}
+	if h.is(asn1.ClassUniversal, tagUTCTime, false) || h.is(asn1.ClassUniversal, tagGeneralizedTime, false) {
+		content, err := r.readTBSContent(h)
+		if err != nil {
+			return err
+		}
+		if err := unmarshalAll(append(h.raw, content...), &r.NextUpdate); err != nil {
+			return fmt.Errorf("x509: malformed CRL nextUpdate: %v", err)
+		}
+		if r.tbsLeft == 0 {
+			return nil
+		}
+		if h, err = r.readTBSHeader(); err != nil {
+			return err
+		}
+	}
+	if h.is(asn1.ClassUniversal, asn1.TagSequence, true) {
+		r.revokedLeft = h.length
+		return nil
+	}
+	r.pending = &h
+	return nil
+}
+
+// startHash starts hashing the TBSCertList with the hash of its signature
+// algorithm, once it is known.  If the hash isn't supported, the signature
+// can't be checked, but the CRL can still be read.
+func (r *CRLReader) startHash() {
+	h, err := signatureHash(getSignatureAlgorithmFromOID(r.Signature.Algorithm))
+	if err != nil {
+		r.hashErr = err
+		r.tbs = ioutil.Discard
+		return
+	}
+	r.hashType = h
+	r.tbsHash = h.New()
+	r.tbsHash.Write(r.tbs.(*bytes.Buffer).Bytes())
+	r.tbs = r.tbsHash
+}
+
+// Next returns the next revoked certificate listed by the CRL, or io.EOF once
+// there are no more and the rest of the CRL has been read.  Errors are
+// sticky.
+func (r *CRLReader) Next() (*pkix.RevokedCertificate, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.revokedLeft > 0 {
+		rc, err := r.readRevoked()
+		if err != nil {
+			r.err = err
+			return nil, err
+		}
+		return rc, nil
+	}
+	if r.done {
+		return nil, io.EOF
+	}
+	if err := r.readEnd(); err != nil {
+		r.err = err
+		return nil, err
+	}
+	r.done = true
+	return nil, io.EOF
+}
+
+func (r *CRLReader) readRevoked() (*pkix.RevokedCertificate, error) {
+	h, err := r.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.consume(&r.revokedLeft, int64(len(h.raw))+h.length); err != nil {
+		return nil, err
+	}
+	r.tbs.Write(h.raw)
+	content, err := r.readTBSContent(h)
+	if err != nil {
+		return nil, err
+	}
+	var rc pkix.RevokedCertificate
+	if err := unmarshalAll(append(h.raw, content...), &rc); err != nil {
+		return nil, fmt.Errorf("x509: malformed revoked certificate: %v", err)
+	}
+	return &rc, nil
+}
+
+// readEnd reads the rest of the CRL after its revoked certificates.
+func (r *CRLReader) readEnd() error {
+	if r.pending == nil && r.tbsLeft > 0 {
+		h, err := r.readTBSHeader()
+		if err != nil {
+			return err
+		}
+		r.pending = &h
+	}
+	if h := r.pending; h != nil {
+		if !h.is(asn1.ClassContextSpecific, 0, true) {
+			return fmt.Errorf("x509: unexpected element in TBSCertList with tag %d", h.tag)
+		}
+		content, err := r.readTBSContent(*h)
+		if err != nil {
+			return err
+		}
+		if err := unmarshalAll(content, &r.Extensions); err != nil {
+			return fmt.Errorf("x509: malformed CRL extensions: %v", err)
+		}
+	}
+	if r.tbsLeft != 0 {
+		return errors.New("x509: trailing data in TBSCertList")
+	}
+	if r.tbsHash != nil {
+		r.digest = r.tbsHash.Sum(nil)
+	}
+
+	el, err := r.readCertListElement()
+	if err != nil {
+		return err
+	}
+	if err := unmarshalAll(el, &r.SignatureAlgorithm); err != nil {
+		return fmt.Errorf("x509: malformed CRL signature algorithm: %v", err)
+	}
+	if el, err = r.readCertListElement(); err != nil {
+		return err
+	}
+	if err := unmarshalAll(el, &r.SignatureValue); err != nil {
+		return fmt.Errorf("x509: malformed CRL signature: %v", err)
+	}
+	if r.certListLeft != 0 {
+		return errors.New("x509: trailing data in CRL")
+	}
+	return nil
+}
+
+// HasExpired reports whether now is past the NextUpdate of the CRL, if it has
+// one.
+func (r *CRLReader) HasExpired(now time.Time) bool {
+	return !r.NextUpdate.IsZero() && now.After(r.NextUpdate)
+}
+
+// CheckSignatureFrom checks that |issuer| signed the CRL, which must have been
+// read to the end.
+func (r *CRLReader) CheckSignatureFrom(issuer *Certificate) error {
+	if !r.done {
+		return errors.New("x509: CRL hasn't been read to the end")
+	}
+	if !r.Signature.Algorithm.Equal(r.SignatureAlgorithm.Algorithm) {
+		return errors.New("x509: CRL signature algorithm doesn't match that of its TBSCertList")
+	}
+	if r.hashErr != nil {
+		return r.hashErr
+	}
+	return issuer.checkDigestSignature(r.hashType, r.digest, r.SignatureValue.RightAlign())
+}
+
+// readHeader reads the header of the next element, which must have a
+// definite length.
+func (r *CRLReader) readHeader() (derHeader, error) {
+	var h derHeader
+	b, err := r.in.ReadByte()
+	if err != nil {
+		return h, truncated(err)
+	}
+	h.raw = append(h.raw, b)
+	h.class, h.tag, h.compound = int(b>>6), int(b&0x1f), b&0x20 != 0
+	if h.tag == 0x1f {
+		return h, errors.New("x509: unexpected high tag number in CRL")
+	}
+	if b, err = r.in.ReadByte(); err != nil {
+		return h, truncated(err)
+	}
+	h.raw = append(h.raw, b)
+	if b < 0x80 {
+		h.length = int64(b)
+		return h, nil
+	}
+	n := int(b & 0x7f)
+	if n == 0 {
+		return h, errors.New("x509: indefinite length in CRL")
+	}
+	if n > 7 {
+		return h, errors.New("x509: element of CRL too long")
+	}
+	for i := 0; i < n; i++ {
+		if b, err = r.in.ReadByte(); err != nil {
+			return h, truncated(err)
+		}
+		if i == 0 && b == 0 {
+			return h, errors.New("x509: non-minimal length in CRL")
+		}
+		h.raw = append(h.raw, b)
+		h.length = h.length<<8 | int64(b)
+	}
+	if h.length < 0x80 {
+		return h, errors.New("x509: non-minimal length in CRL")
+	}
+	return h, nil
+}
+
+// readContent reads the content of the element with header |h|.
+func (r *CRLReader) readContent(h derHeader) ([]byte, error) {
+	if h.length > maxCRLElementSize {
+		return nil, fmt.Errorf("x509: element of CRL is larger than %d bytes", maxCRLElementSize)
+	}
+	content := make([]byte, h.length)
+	if _, err := io.ReadFull(r.in, content); err != nil {
+		return nil, truncated(err)
+	}
+	return content, nil
+}
+
+// consume deducts |n| bytes from |*left|, the bytes left in an element, and
+// fails if it doesn't hold them.
+func (r *CRLReader) consume(left *int64, n int64) error {
+	if n > *left {
+		return errors.New("x509: element of CRL overruns its parent")
+	}
+	*left -= n
+	return nil
+}
+
+func (r *CRLReader) readTBSHeader() (derHeader, error) {
+	if r.tbsLeft == 0 {
+		return derHeader{}, errors.New("x509: truncated TBSCertList")
+	}
+	h, err := r.readHeader()
+	if err != nil {
+		return h, err
+	}
+	if err := r.consume(&r.tbsLeft, int64(len(h.raw))+h.length); err != nil {
+		return h, err
+	}
+	r.tbs.Write(h.raw)
+	return h, nil
+}
+
+func (r *CRLReader) readTBSContent(h derHeader) ([]byte, error) {
+	content, err := r.readContent(h)
+	if err != nil {
+		return nil, err
+	}
+	r.tbs.Write(content)
+	return content, nil
+}
+
+// readTBSElement reads the next element of the TBSCertList, header and
+// content.
+func (r *CRLReader) readTBSElement() ([]byte, error) {
+	h, err := r.readTBSHeader()
+	if err != nil {
+		return nil, err
+	}
+	content, err := r.readTBSContent(h)
+	if err != nil {
+		return nil, err
+	}
+	return append(h.raw, content...), nil
+}
+
+// readCertListElement reads the next element of the CertificateList after
+// its TBSCertList.
+func (r *CRLReader) readCertListElement() ([]byte, error) {
+	h, err := r.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.consume(&r.certListLeft, int64(len(h.raw))+h.length); err != nil {
+		return nil, err
+	}
+	content, err := r.readContent(h)
+	if err != nil {
+		return nil, err
+	}
+	return append(h.raw, content...), nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.New("x509: truncated CRL")
+	}
+	return err
+}
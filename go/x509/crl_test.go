@@ -0,0 +1,299 @@
+package x509
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// crlTestIssuer returns a self-signed CA certificate and its key, for signing
+// CRLs.
+func crlTestIssuer(t *testing.T) (*Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CRL Issuer"},
+		NotBefore:             time.Unix(0, 0),
+		NotAfter:              time.Unix(1<<31-1, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              KeyUsageCRLSign,
+	}
+	der, err := CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, key
+}
+
+// createTestCRL returns a CRL revoking |revoked|, with extensions |exts|,
+// signed with ECDSA with SHA-256 by |issuer|.
+func createTestCRL(t *testing.T, issuer *Certificate, key *ecdsa.PrivateKey, revoked []pkix.RevokedCertificate, exts []pkix.Extension) []byte {
+	alg := pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA256}
+	tbs := pkix.TBSCertificateList{
+		Version:             1,
+		Signature:           alg,
+		Issuer:              issuer.Subject.ToRDNSequence(),
+		ThisUpdate:          time.Unix(1000, 0).UTC(),
+		NextUpdate:          time.Unix(10000, 0).UTC(),
+		RevokedCertificates: revoked,
+		Extensions:          exts,
+	}
+	tbsDER, err := asn1.Marshal(tbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(tbsDER)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := asn1.Marshal(ecdsaSignature{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbs.Raw = tbsDER
+	der, err := asn1.Marshal(pkix.CertificateList{
+		TBSCertList:        tbs,
+		SignatureAlgorithm: alg,
+		SignatureValue:     asn1.BitString{Bytes: sig, BitLength: len(sig) * 8},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func crlNumberExtension(t *testing.T, id asn1.ObjectIdentifier, n int64, critical bool) pkix.Extension {
+	value, err := asn1.Marshal(big.NewInt(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: id, Critical: critical, Value: value}
+}
+
+func uriDistributionPoint(uri string) distributionPointName {
+	return distributionPointName{FullName: asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        0,
+		IsCompound: true,
+		Bytes:      append([]byte{0x80 | tagURI, byte(len(uri))}, uri...),
+	}}
+}
+
+// readCRL reads all of the CRL |der| with a CRLReader.
+func readCRL(der []byte) (*CRLReader, []pkix.RevokedCertificate, error) {
+	r, err := NewCRLReader(bytes.NewReader(der))
+	if err != nil {
+		return nil, nil, err
+	}
+	var revoked []pkix.RevokedCertificate
+	for {
+		rc, err := r.Next()
+		if err == io.EOF {
+			return r, revoked, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		revoked = append(revoked, *rc)
+	}
+}
+
+func TestCRLReaderMatchesParseDERCRL(t *testing.T) {
+	der := fromBase64(derCRLBase64)
+	want, err := ParseDERCRL(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, revoked, err := readCRL(der)
+	if err != nil {
+		t.Fatalf("reading CRL: %v", err)
+	}
+	tbs := want.TBSCertList
+	if r.Version != tbs.Version || !r.ThisUpdate.Equal(tbs.ThisUpdate) || !r.NextUpdate.Equal(tbs.NextUpdate) {
+		t.Errorf("got version %d, thisUpdate %s, nextUpdate %s, want %d, %s, %s", r.Version, r.ThisUpdate, r.NextUpdate, tbs.Version, tbs.ThisUpdate, tbs.NextUpdate)
+	}
+	if !reflect.DeepEqual(r.Issuer, tbs.Issuer) {
+		t.Errorf("got issuer %v, want %v", r.Issuer, tbs.Issuer)
+	}
+	if len(revoked) != len(tbs.RevokedCertificates) {
+		t.Fatalf("got %d revoked certificates, want %d", len(revoked), len(tbs.RevokedCertificates))
+	}
+	for i, rc := range revoked {
+		if w := tbs.RevokedCertificates[i]; rc.SerialNumber.Cmp(w.SerialNumber) != 0 || !rc.RevocationTime.Equal(w.RevocationTime) {
+			t.Errorf("revoked certificate %d is %v, want %v", i, rc, w)
+		}
+	}
+	if !reflect.DeepEqual(r.Extensions, tbs.Extensions) {
+		t.Errorf("got extensions %v, want %v", r.Extensions, tbs.Extensions)
+	}
+	if !reflect.DeepEqual(r.SignatureValue, want.SignatureValue) {
+		t.Error("got a different signature")
+	}
+	if r.HasExpired(time.Unix(1302517272, 0)) {
+		t.Error("CRL has expired (but shouldn't have)")
+	}
+}
+
+func TestCRLReaderSignature(t *testing.T) {
+	issuer, key := crlTestIssuer(t)
+	other, _ := crlTestIssuer(t)
+	var revoked []pkix.RevokedCertificate
+	for i := 0; i < 2000; i++ {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: big.NewInt(int64(i) << 40), RevocationTime: time.Unix(int64(500+i), 0).UTC()})
+	}
+	der := createTestCRL(t, issuer, key, revoked, []pkix.Extension{crlNumberExtension(t, oidExtensionCRLNumber, 7, false)})
+
+	r, got, err := readCRL(der)
+	if err != nil {
+		t.Fatalf("reading CRL: %v", err)
+	}
+	if len(got) != len(revoked) || got[1999].SerialNumber.Cmp(revoked[1999].SerialNumber) != 0 {
+		t.Errorf("got %d revoked certificates, want %d", len(got), len(revoked))
+	}
+	if err := r.CheckSignatureFrom(issuer); err != nil {
+		t.Errorf("CheckSignatureFrom(issuer)=%v, want no error", err)
+	}
+	if err := r.CheckSignatureFrom(other); err == nil {
+		t.Error("CheckSignatureFrom(other issuer)=nil, want error")
+	}
+	exts, err := ParseCRLExtensions(r.Extensions)
+	if err != nil || exts.Number == nil || exts.Number.Int64() != 7 {
+		t.Errorf("ParseCRLExtensions()=%+v,%v, want number 7", exts, err)
+	}
+
+	// Change the serial number of the last entry.
+	i := bytes.LastIndex(der, revoked[1999].SerialNumber.Bytes())
+	tampered := append([]byte{}, der...)
+	tampered[i]++
+	if r, _, err = readCRL(tampered); err != nil {
+		t.Fatalf("reading tampered CRL: %v", err)
+	}
+	if err := r.CheckSignatureFrom(issuer); err == nil {
+		t.Error("CheckSignatureFrom(issuer) of tampered CRL=nil, want error")
+	}
+
+	r, err = NewCRLReader(bytes.NewReader(der))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CheckSignatureFrom(issuer); err == nil {
+		t.Error("CheckSignatureFrom() before the end of the CRL=nil, want error")
+	}
+}
+
+func TestCRLReaderErrors(t *testing.T) {
+	issuer, key := crlTestIssuer(t)
+	revoked := []pkix.RevokedCertificate{{SerialNumber: big.NewInt(1), RevocationTime: time.Unix(500, 0).UTC()}}
+	der := createTestCRL(t, issuer, key, revoked, nil)
+	empty := createTestCRL(t, issuer, key, nil, nil)
+	if r, got, err := readCRL(empty); err != nil || len(got) != 0 || r.CheckSignatureFrom(issuer) != nil {
+		t.Errorf("reading CRL without revoked certificates: got %d, %v", len(got), err)
+	}
+
+	for _, test := range []struct {
+		desc string
+		der  []byte
+		want string
+	}{
+		{"empty", nil, "truncated"},
+		{"truncated", der[:len(der)-10], "truncated"},
+		{"not a sequence", append([]byte{0x04}, der[1:]...), "isn't a SEQUENCE"},
+		{"indefinite length", []byte{0x30, 0x80, 0x30, 0x80}, "indefinite length"},
+		{"non-minimal length", []byte{0x30, 0x81, 0x05}, "non-minimal"},
+	} {
+		_, _, err := readCRL(test.der)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want one containing %q", test.desc, err, test.want)
+		}
+	}
+}
+
+func TestParseCRLExtensions(t *testing.T) {
+	idp, err := asn1.Marshal(issuingDistributionPoint{
+		DistributionPoint:   uriDistributionPoint("http://crl.example.com/ca.crl"),
+		OnlyContainsCACerts: true,
+		IndirectCRL:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	freshest, err := asn1.Marshal([]distributionPoint{{DistributionPoint: uriDistributionPoint("http://crl.example.com/delta.crl")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseCRLExtensions([]pkix.Extension{
+		crlNumberExtension(t, oidExtensionCRLNumber, 12, false),
+		crlNumberExtension(t, oidExtensionDeltaCRLIndicator, 10, true),
+		{Id: oidExtensionIssuingDistributionPoint, Critical: true, Value: idp},
+		{Id: oidExtensionFreshestCRL, Value: freshest},
+		{Id: asn1.ObjectIdentifier{1, 2, 3}, Value: []byte{5, 0}},
+	})
+	if err != nil {
+		t.Fatalf("ParseCRLExtensions()=_,%v, want no error", err)
+	}
+	want := &CRLExtensions{
+		Number:        big.NewInt(12),
+		BaseCRLNumber: big.NewInt(10),
+		IssuingDistributionPoint: &IssuingDistributionPoint{
+			DistributionPoint:   []string{"http://crl.example.com/ca.crl"},
+			OnlyContainsCACerts: true,
+			IndirectCRL:         true,
+		},
+		FreshestCRL: []string{"http://crl.example.com/delta.crl"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCRLExtensions()=%+v, want %+v", got, want)
+	}
+
+	if _, err := ParseCRLExtensions([]pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3}, Critical: true}}); err == nil {
+		t.Error("ParseCRLExtensions(unknown critical extension)=nil, want error")
+	}
+	if _, err := ParseCRLExtensions([]pkix.Extension{{Id: oidExtensionCRLNumber, Value: []byte{4, 0}}}); err == nil {
+		t.Error("ParseCRLExtensions(malformed CRL number)=nil, want error")
+	}
+}
+
+func TestIssuingDistributionPointCovers(t *testing.T) {
+	leaf := &Certificate{CRLDistributionPoints: []string{"http://crl.example.com/ca.crl"}}
+	ca := &Certificate{IsCA: true, BasicConstraintsValid: true}
+	for _, test := range []struct {
+		idp  IssuingDistributionPoint
+		c    *Certificate
+		want bool
+	}{
+		{IssuingDistributionPoint{}, leaf, true},
+		{IssuingDistributionPoint{}, ca, true},
+		{IssuingDistributionPoint{OnlyContainsUserCerts: true}, leaf, true},
+		{IssuingDistributionPoint{OnlyContainsUserCerts: true}, ca, false},
+		{IssuingDistributionPoint{OnlyContainsCACerts: true}, leaf, false},
+		{IssuingDistributionPoint{OnlyContainsCACerts: true}, ca, true},
+		{IssuingDistributionPoint{OnlyContainsAttributeCerts: true}, leaf, false},
+		{IssuingDistributionPoint{DistributionPoint: []string{"http://crl.example.com/ca.crl"}}, leaf, true},
+		{IssuingDistributionPoint{DistributionPoint: []string{"http://crl.example.com/other.crl"}}, leaf, false},
+		{IssuingDistributionPoint{DistributionPoint: []string{"http://crl.example.com/other.crl"}}, ca, true},
+	} {
+		if got := test.idp.Covers(test.c); got != test.want {
+			t.Errorf("%+v.Covers(%v)=%v, want %v", test.idp, test.c.CRLDistributionPoints, got, test.want)
+		}
+	}
+}
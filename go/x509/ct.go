@@ -0,0 +1,179 @@
+package x509
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// This file holds support for the X.509 extensions which Certificate
+// Transparency defines (RFC6962 sections 3.1 and 3.3).  The SCTs themselves
+// are TLS encoded, which the ct package handles, so they are passed around
+// here as the bytes of a SignedCertificateTimestampList.
+
+var (
+	// OIDExtensionCTPoison is the critical extension which CAs add to
+	// precertificates so that they can't be used as certificates.
+	OIDExtensionCTPoison = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+	// OIDExtensionCTSCTList is the extension which carries the SCTs
+	// embedded in a certificate.
+	OIDExtensionCTSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+	// OIDExtKeyUsageCTPrecertSigning is the extended key usage of a
+	// Precertificate Signing Certificate, which issues precertificates
+	// on behalf of a CA.
+	OIDExtKeyUsageCTPrecertSigning = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 4}
+)
+
+// The poison extension's value is an ASN.1 NULL.
+var poisonValue = []byte{0x05, 0x00}
+
+// NewPoisonExtension returns the critical poison extension, for adding to
+// the ExtraExtensions of a precertificate's template.
+func NewPoisonExtension() pkix.Extension {
+	return pkix.Extension{Id: OIDExtensionCTPoison, Critical: true, Value: poisonValue}
+}
+
+// IsPrecertificate reports whether the certificate has the poison extension,
+// i.e. is a precertificate rather than a certificate.
+func (c *Certificate) IsPrecertificate() bool {
+	return oidInExtensions(OIDExtensionCTPoison, c.Extensions)
+}
+
+// checkPoison returns an error if |value| isn't the poison extension's.
+func checkPoison(value []byte) error {
+	if !bytes.Equal(value, poisonValue) {
+		return errors.New("x509: CT poison extension value is not NULL")
+	}
+	return nil
+}
+
+// NewSCTListExtension returns the extension carrying the TLS encoded
+// SignedCertificateTimestampList |sctList|, as ct.SerializeSCTList returns,
+// for embedding the SCTs in a certificate.
+func NewSCTListExtension(sctList []byte) (pkix.Extension, error) {
+	value, err := asn1.Marshal(sctList)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: OIDExtensionCTSCTList, Value: value}, nil
+}
+
+// ParseSCTListExtension returns the TLS encoded SignedCertificateTimestampList
+// in |value|, the value of the X.509 or OCSP extension which carries SCTs,
+// which is a DER OCTET STRING holding it.
+func ParseSCTListExtension(value []byte) ([]byte, error) {
+	var sctList []byte
+	rest, err := asn1.Unmarshal(value, &sctList)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("x509: trailing data after SCT list extension")
+	}
+	return sctList, nil
+}
+
+// SCTList returns the TLS encoded SignedCertificateTimestampList embedded in
+// the certificate, or nil if it has none.
+func (c *Certificate) SCTList() ([]byte, error) {
+	for _, e := range c.Extensions {
+		if e.Id.Equal(OIDExtensionCTSCTList) {
+			return ParseSCTListExtension(e.Value)
+		}
+	}
+	return nil, nil
+}
+
+// concat returns the concatenated encodings of elems.
+func concat(elems []asn1.RawValue) []byte {
+	var b bytes.Buffer
+	for _, e := range elems {
+		b.Write(e.FullBytes)
+	}
+	return b.Bytes()
+}
+
+// removeExtensions returns the DER encoded TBSCertificate |tbsDER| without
+// the extensions whose IDs are in |oids|, keeping everything else byte for
+// byte.  If it has none of them, |tbsDER| is returned as it is.
+//
+// The TBSCertificate is walked element by element rather than unmarshalled
+// into a struct, as the asn1 package can't match optional tagged fields of
+// type RawValue, and re-encoding a certificate can change it.
+func removeExtensions(tbsDER []byte, oids ...asn1.ObjectIdentifier) ([]byte, error) {
+	var tbs asn1.RawValue
+	rest, err := asn1.Unmarshal(tbsDER, &tbs)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, asn1.SyntaxError{Msg: "trailing data"}
+	}
+	fields, err := asn1.ReadElements(tbs.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	for i, f := range fields {
+		if f.Class != asn1.ClassContextSpecific || f.Tag != 3 {
+			continue
+		}
+		// extensions [3] EXPLICIT SEQUENCE OF Extension
+		var seq asn1.RawValue
+		if _, err := asn1.Unmarshal(f.Bytes, &seq); err != nil {
+			return nil, err
+		}
+		exts, err := asn1.ReadElements(seq.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		var kept []asn1.RawValue
+		for _, e := range exts {
+			var ext pkix.Extension
+			if _, err := asn1.Unmarshal(e.FullBytes, &ext); err != nil {
+				return nil, err
+			}
+			if !oidInList(ext.Id, oids) {
+				kept = append(kept, e)
+			}
+		}
+		if len(kept) == len(exts) {
+			break
+		}
+		if len(kept) == 0 {
+			fields = append(fields[:i], fields[i+1:]...)
+		} else {
+			seqDER, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: concat(kept)})
+			if err != nil {
+				return nil, err
+			}
+			fieldDER, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: seqDER})
+			if err != nil {
+				return nil, err
+			}
+			fields[i] = asn1.RawValue{FullBytes: fieldDER}
+		}
+		return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: concat(fields)})
+	}
+	return tbsDER, nil
+}
+
+func oidInList(oid asn1.ObjectIdentifier, oids []asn1.ObjectIdentifier) bool {
+	for _, o := range oids {
+		if oid.Equal(o) {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildPrecertTBS returns the DER encoded TBSCertificate |tbsDER| without its
+// poison and SCT list extensions, keeping everything else byte for byte.
+// For a precertificate this is the TBSCertificate which its SCTs sign, and
+// which a log includes in its entry; for a certificate with embedded SCTs it
+// is the TBSCertificate of the precertificate it was issued from (RFC6962
+// section 3.2).  If it has neither extension, |tbsDER| is returned as it is.
+func BuildPrecertTBS(tbsDER []byte) ([]byte, error) {
+	return removeExtensions(tbsDER, OIDExtensionCTPoison, OIDExtensionCTSCTList)
+}
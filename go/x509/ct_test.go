@@ -0,0 +1,190 @@
+package x509
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// createCTCertificates returns certificates made from the same template and
+// key with each of the given sets of extra extensions, so that they differ
+// only in those.
+func createCTCertificates(t *testing.T, dnsNames []string, exts ...[]pkix.Extension) []*Certificate {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certs []*Certificate
+	for _, e := range exts {
+		template := Certificate{
+			SerialNumber:    big.NewInt(1),
+			Subject:         pkix.Name{CommonName: "precert.example.com"},
+			NotBefore:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+			NotAfter:        time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+			DNSNames:        dnsNames,
+			ExtraExtensions: e,
+		}
+		der, err := CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("ParseCertificate()=_,%v", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
+func TestPoisonExtension(t *testing.T) {
+	certs := createCTCertificates(t, []string{"precert.example.com"}, nil, []pkix.Extension{NewPoisonExtension()})
+	cert, precert := certs[0], certs[1]
+	if cert.IsPrecertificate() {
+		t.Error("IsPrecertificate()=true for a certificate")
+	}
+	if !precert.IsPrecertificate() {
+		t.Error("IsPrecertificate()=false for a precertificate")
+	}
+
+	bad := NewPoisonExtension()
+	bad.Value = []byte{0x04, 0x00}
+	der := createJunkCertificate(t, 1, "precert.example.com", "precert.example.com", []pkix.Extension{bad})
+	_, err := ParseCertificate(der)
+	want := NonFatalErrors{Errors: []error{
+		MalformedExtension{ID: OIDExtensionCTPoison, Err: checkPoison(bad.Value)},
+		UnhandledCriticalExtension{OIDExtensionCTPoison},
+	}}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("ParseCertificate(bad poison)=_,%v, want %v", err, want)
+	}
+}
+
+func TestSCTListExtension(t *testing.T) {
+	// A SignedCertificateTimestampList holding one empty SCT.
+	list := []byte{0x00, 0x02, 0x00, 0x00}
+	ext, err := NewSCTListExtension(list)
+	if err != nil {
+		t.Fatalf("NewSCTListExtension()=_,%v", err)
+	}
+	if ext.Critical || !ext.Id.Equal(OIDExtensionCTSCTList) {
+		t.Errorf("NewSCTListExtension()=%v, want a non-critical SCT list extension", ext)
+	}
+	got, err := ParseSCTListExtension(ext.Value)
+	if err != nil || !bytes.Equal(got, list) {
+		t.Errorf("ParseSCTListExtension()=%x,%v, want %x", got, err, list)
+	}
+
+	certs := createCTCertificates(t, nil, nil, []pkix.Extension{ext})
+	if got, err := certs[0].SCTList(); got != nil || err != nil {
+		t.Errorf("SCTList(certificate without SCTs)=%x,%v, want nil,nil", got, err)
+	}
+	if got, err := certs[1].SCTList(); err != nil || !bytes.Equal(got, list) {
+		t.Errorf("SCTList()=%x,%v, want %x", got, err, list)
+	}
+
+	for i, value := range [][]byte{
+		{0x05, 0x00},
+		append(append([]byte{}, ext.Value...), 0x00),
+	} {
+		if _, err := ParseSCTListExtension(value); err == nil {
+			t.Errorf("#%d: ParseSCTListExtension(%x)=_,nil, want error", i, value)
+		}
+		der := createJunkCertificate(t, 1, "www.example.com", "www.example.com",
+			[]pkix.Extension{{Id: OIDExtensionCTSCTList, Value: value}})
+		_, err := ParseCertificate(der)
+		nfe, ok := err.(NonFatalErrors)
+		if !ok || len(nfe.Errors) != 1 {
+			t.Errorf("#%d: ParseCertificate()=_,%v, want one non-fatal error", i, err)
+			continue
+		}
+		if e, ok := nfe.Errors[0].(MalformedExtension); !ok || !e.ID.Equal(OIDExtensionCTSCTList) {
+			t.Errorf("#%d: ParseCertificate()=_,%v, want MalformedExtension", i, err)
+		}
+	}
+}
+
+// withoutExtensionsField returns |tbsDER| without its last field, the empty
+// extensions field which CreateCertificate adds to certificates without
+// extensions.
+func withoutExtensionsField(t *testing.T, tbsDER []byte) []byte {
+	var tbs asn1.RawValue
+	if _, err := asn1.Unmarshal(tbsDER, &tbs); err != nil {
+		t.Fatal(err)
+	}
+	fields, err := asn1.ReadElements(tbs.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := fields[len(fields)-1]; last.Class != asn1.ClassContextSpecific || last.Tag != 3 || len(last.Bytes) != 2 {
+		t.Fatalf("TBSCertificate doesn't end with an empty extensions field")
+	}
+	der, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: concat(fields[:len(fields)-1])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestBuildPrecertTBS(t *testing.T) {
+	sctList, err := NewSCTListExtension([]byte{0x00, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{0x05, 0x00}}
+	for i, exts := range [][]pkix.Extension{
+		// The only extensions, so the extensions field is removed
+		// altogether.
+		{NewPoisonExtension()},
+		{sctList},
+		{NewPoisonExtension(), sctList},
+		// Among other extensions, which are kept in order.
+		{NewPoisonExtension(), other},
+		{other, sctList},
+		{other, NewPoisonExtension(), other, sctList},
+	} {
+		var kept []pkix.Extension
+		for _, e := range exts {
+			if e.Id.Equal(other.Id) {
+				kept = append(kept, e)
+			}
+		}
+		certs := createCTCertificates(t, nil, kept, exts)
+		want, from := certs[0].RawTBSCertificate, certs[1].RawTBSCertificate
+		if len(kept) == 0 {
+			want = withoutExtensionsField(t, want)
+		}
+		tbs, err := BuildPrecertTBS(from)
+		if err != nil {
+			t.Errorf("#%d: BuildPrecertTBS()=_,%v", i, err)
+			continue
+		}
+		if !bytes.Equal(tbs, want) {
+			t.Errorf("#%d: BuildPrecertTBS()=%x, want %x", i, tbs, want)
+		}
+		// Removing the extensions again changes nothing.
+		if again, err := BuildPrecertTBS(tbs); err != nil || !bytes.Equal(again, want) {
+			t.Errorf("#%d: BuildPrecertTBS(BuildPrecertTBS())=%x,%v, want %x", i, again, err, want)
+		}
+		if _, err := ParseTBSCertificate(tbs); err != nil {
+			t.Errorf("#%d: ParseTBSCertificate(BuildPrecertTBS())=_,%v", i, err)
+		}
+	}
+
+	for i, der := range [][]byte{
+		[]byte("garbage"),
+		{0x30, 0x00, 0x00},
+	} {
+		if _, err := BuildPrecertTBS(der); err == nil {
+			t.Errorf("#%d: BuildPrecertTBS(%x)=_,nil, want error", i, der)
+		}
+	}
+}
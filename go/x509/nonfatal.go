@@ -0,0 +1,267 @@
+package x509
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/google/certificate-transparency/go/asn1"
+)
+
+// This file holds the non-fatal errors which parsing a certificate can
+// return in a NonFatalErrors, besides UnhandledCriticalExtension.  CT logs
+// contain many certificates which aren't quite valid, which CT tools need to
+// parse anyway, while still being able to tell what is wrong with them.
+
+// IsFatal reports whether |err|, returned by one of the Parse functions,
+// means that parsing failed: it is non-nil and not a NonFatalErrors.
+func IsFatal(err error) bool {
+	_, ok := err.(NonFatalErrors)
+	return err != nil && !ok
+}
+
+// NegativeSerialNumber is the error for a certificate whose serial number is
+// negative.
+type NegativeSerialNumber struct {
+	SerialNumber *big.Int
+}
+
+func (e NegativeSerialNumber) Error() string {
+	return "x509: negative serial number"
+}
+
+// InvalidIPAddress is the error for an iPAddress subject alternative name
+// which isn't 4 or 16 bytes long.  It isn't included in IPAddresses.
+type InvalidIPAddress struct {
+	Bytes []byte
+}
+
+func (e InvalidIPAddress) Error() string {
+	return fmt.Sprintf("x509: certificate contained IP address of length %d : %v", len(e.Bytes), e.Bytes)
+}
+
+// InvalidString is the error for a string whose bytes aren't valid for its
+// ASN.1 type, e.g. a UTF8String which isn't UTF-8.  The string is still
+// included in the certificate, converted as well as possible.
+type InvalidString struct {
+	// Where the string was, e.g. "subject" or "dNSName".
+	Field string
+	// The ASN.1 tag of the string's type.
+	Tag   int
+	Bytes []byte
+}
+
+func (e InvalidString) Error() string {
+	return fmt.Sprintf("x509: invalid %s in %s (%q)", asn1TagName(e.Tag), e.Field, e.Bytes)
+}
+
+// MalformedExtension is the error for an extension whose value couldn't be
+// parsed.  The fields it would have filled in are left unset, or partially
+// set.  If the extension is critical, an UnhandledCriticalExtension error is
+// returned for it too.
+type MalformedExtension struct {
+	ID  asn1.ObjectIdentifier
+	Err error
+}
+
+func (e MalformedExtension) Error() string {
+	return fmt.Sprintf("x509: malformed extension %v: %v", e.ID, e.Err)
+}
+
+// InvalidTime is the error for a validity time which isn't encoded as RFC 5280
+// section 4.1.2.5 requires, in UTC and with seconds, e.g. one with a UTC
+// offset, or a GeneralizedTime, like 99991231235959Z, tagged as a UTCTime.
+// The time is still included in the certificate, as it was parsed.
+type InvalidTime struct {
+	// "notBefore" or "notAfter".
+	Field string
+	// The ASN.1 tag of the time's type.
+	Tag   int
+	Bytes []byte
+}
+
+func (e InvalidTime) Error() string {
+	return fmt.Sprintf("x509: invalid %s in %s (%q)", asn1TagName(e.Tag), e.Field, e.Bytes)
+}
+
+// ASN.1 string and time tags.
+const (
+	tagUTF8String      = 12
+	tagPrintableString = 19
+	tagIA5String       = 22
+	tagVisibleString   = 26
+	tagBMPString       = 30
+	tagUTCTime         = 23
+	tagGeneralizedTime = 24
+)
+
+func asn1TagName(tag int) string {
+	switch tag {
+	case tagUTF8String:
+		return "UTF8String"
+	case tagPrintableString:
+		return "PrintableString"
+	case tagIA5String:
+		return "IA5String"
+	case tagVisibleString:
+		return "VisibleString"
+	case tagBMPString:
+		return "BMPString"
+	case tagUTCTime:
+		return "UTCTime"
+	case tagGeneralizedTime:
+		return "GeneralizedTime"
+	}
+	return fmt.Sprintf("string with tag %d", tag)
+}
+
+// validString reports whether |b| is a valid string of the ASN.1 type with
+// |tag|.  Types which aren't checked are assumed to be valid.
+func validString(tag int, b []byte) bool {
+	switch tag {
+	case tagUTF8String:
+		return utf8.Valid(b)
+	case tagPrintableString:
+		for _, c := range b {
+			if !isPrintable(c) {
+				return false
+			}
+		}
+	case tagIA5String:
+		for _, c := range b {
+			if c >= utf8.RuneSelf {
+				return false
+			}
+		}
+	case tagVisibleString:
+		for _, c := range b {
+			if c < ' ' || c > '~' {
+				return false
+			}
+		}
+	case tagBMPString:
+		if len(b)%2 != 0 {
+			return false
+		}
+		for _, r := range decodeBMPString(b) {
+			if r == utf8.RuneError {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// decodeBMPString decodes the big-endian UTF-16 of a BMPString, replacing
+// invalid code units with U+FFFD.  A trailing odd byte is ignored.
+func decodeBMPString(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(u))
+}
+
+// isPrintable reports whether |c| is in the ASN.1 PrintableString set.
+func isPrintable(c byte) bool {
+	return 'a' <= c && c <= 'z' ||
+		'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' ||
+		'\'' <= c && c <= ')' ||
+		'+' <= c && c <= '/' ||
+		c == ' ' ||
+		c == ':' ||
+		c == '=' ||
+		c == '?'
+}
+
+// rawAttributeTypeAndValue is a pkix.AttributeTypeAndValue whose value hasn't
+// been parsed.
+type rawAttributeTypeAndValue struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// rawRelativeDistinguishedNameSET is a pkix.RelativeDistinguishedNameSET
+// whose values haven't been parsed.  The name must end in SET for the asn1
+// package to parse it as one.
+type rawRelativeDistinguishedNameSET []rawAttributeTypeAndValue
+
+// checkNameStrings adds an InvalidString error to |nfe| for each string in
+// the DER encoded Name |der| which isn't valid for its type, which the asn1
+// package tolerates.  |field| says which name it is.
+func checkNameStrings(field string, der []byte, nfe *NonFatalErrors) {
+	var rdns []rawRelativeDistinguishedNameSET
+	if _, err := asn1.Unmarshal(der, &rdns); err != nil {
+		// The Name has already been parsed, so this can't happen.
+		return
+	}
+	for _, rdn := range rdns {
+		for _, atv := range rdn {
+			v := atv.Value
+			if v.Class == 0 && !v.IsCompound && !validString(v.Tag, v.Bytes) {
+				nfe.AddError(InvalidString{Field: field, Tag: v.Tag, Bytes: v.Bytes})
+			}
+		}
+	}
+}
+
+// timeLayout is a layout which validity times are parsed with.
+type timeLayout struct {
+	layout string
+	// Whether the layout has a two-digit year, as UTCTimes do.
+	twoDigitYear bool
+}
+
+// parse parses |s| with |l|, mapping two-digit years to 1950 to 2049, as RFC
+// 5280 section 4.1.2.5.1 says.
+func (l timeLayout) parse(s string) (time.Time, error) {
+	t, err := time.Parse(l.layout, s)
+	if err == nil && l.twoDigitYear && t.Year() >= 2050 {
+		t = t.AddDate(-100, 0, 0)
+	}
+	return t.UTC(), err
+}
+
+// The layouts of times as RFC 5280 requires them to be encoded, and those of
+// the times found in certificates which aren't, with UTC offsets or without
+// seconds, which are tried in order.  The layouts of GeneralizedTimes are
+// tried for UTCTimes too, as CAs have used UTCTimes like 99991231235959Z for
+// certificates which don't expire.  The other way round would be ambiguous.
+var (
+	utcTimeLayout          = timeLayout{"060102150405Z", true}
+	generalizedTimeLayout  = timeLayout{"20060102150405Z", false}
+	utcTimeLayouts         = []timeLayout{{"060102150405Z0700", true}, {"0601021504Z0700", true}}
+	generalizedTimeLayouts = []timeLayout{{"20060102150405Z0700", false}, {"200601021504Z0700", false}}
+)
+
+// parseTime parses the UTCTime or GeneralizedTime |v|, which is |field| of a
+// certificate's validity.  If it isn't encoded as RFC 5280 requires but can
+// be parsed anyway, an InvalidTime error is added to |nfe| for it.
+func parseTime(field string, v asn1.RawValue, nfe *NonFatalErrors) (time.Time, error) {
+	if v.Class != 0 || v.IsCompound || (v.Tag != tagUTCTime && v.Tag != tagGeneralizedTime) {
+		return time.Time{}, asn1.StructuralError{Msg: field + " is not a UTCTime or GeneralizedTime"}
+	}
+	s := string(v.Bytes)
+	layout, fallbacks := utcTimeLayout, [][]timeLayout{utcTimeLayouts, generalizedTimeLayouts}
+	if v.Tag == tagGeneralizedTime {
+		layout, fallbacks = generalizedTimeLayout, [][]timeLayout{generalizedTimeLayouts}
+	}
+	// time.Parse accepts fractional seconds which the layout doesn't
+	// have, which RFC 5280 forbids, hence the check of the length.
+	if t, err := layout.parse(s); err == nil && len(s) == len(layout.layout) {
+		return t, nil
+	}
+	for _, layouts := range fallbacks {
+		for _, l := range layouts {
+			if t, err := l.parse(s); err == nil {
+				nfe.AddError(InvalidTime{Field: field, Tag: v.Tag, Bytes: v.Bytes})
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, errors.New("x509: unparsable " + asn1TagName(v.Tag) + " in " + field)
+}
@@ -0,0 +1,129 @@
+package x509
+
+import (
+	"bytes"
+	"time"
+)
+
+// Path is a chain of certificates from a leaf to a root, as found by
+// BuildAllPaths, together with the properties of the chain as a whole.
+type Path struct {
+	// The certificates, from the leaf to the root.
+	Chain []*Certificate
+	// The period in which every certificate in the chain is valid.  If
+	// there is none, NotAfter is before NotBefore.
+	NotBefore, NotAfter time.Time
+	// The extended key usages, of those in PathKeyUsages, which Verify
+	// would accept the chain for.
+	KeyUsages []ExtKeyUsage
+	// The ways in which the chain's names break its name constraints.
+	NameConstraintViolations []NameConstraintViolation
+}
+
+// PathKeyUsages are the extended key usages which BuildAllPaths reports
+// whether each Path can be used for.
+var PathKeyUsages = []ExtKeyUsage{
+	ExtKeyUsageServerAuth,
+	ExtKeyUsageClientAuth,
+	ExtKeyUsageCodeSigning,
+	ExtKeyUsageEmailProtection,
+	ExtKeyUsageTimeStamping,
+	ExtKeyUsageOCSPSigning,
+}
+
+// ValidAt reports whether every certificate in the path is valid at |t|.
+func (p *Path) ValidAt(t time.Time) bool {
+	return !t.Before(p.NotBefore) && !t.After(p.NotAfter)
+}
+
+// BuildAllPaths returns every path from |leaf| to a certificate in |roots|
+// through certificates in |intermediates|, which may be nil.  If |roots| is
+// nil, the system roots are used.
+//
+// Unlike Verify, BuildAllPaths doesn't reject paths because of the time,
+// their key usages or their name constraints, but reports them with each
+// Path instead.  Paths are only rejected if an intermediate isn't a CA or
+// its path length constraint is exceeded.  A path never passes through the
+// same subject and public key twice, so cross-signed CAs can't create
+// loops.  If there are no paths at all, an UnknownAuthorityError is
+// returned.
+func BuildAllPaths(leaf *Certificate, intermediates, roots *CertPool) ([]Path, error) {
+	if roots == nil {
+		if roots = systemRootsPool(); roots == nil {
+			return nil, SystemRootsError{}
+		}
+	}
+	b := &pathBuilder{intermediates: intermediates, roots: roots}
+	b.extend([]*Certificate{leaf})
+	if len(b.paths) == 0 {
+		return nil, UnknownAuthorityError{leaf, b.hintErr, b.hintCert}
+	}
+	return b.paths, nil
+}
+
+type pathBuilder struct {
+	intermediates, roots *CertPool
+	paths                []Path
+	// Why a candidate issuer of the leaf was rejected, for the
+	// UnknownAuthorityError if no paths are found.
+	hintErr  error
+	hintCert *Certificate
+}
+
+// extend adds the paths which extend |chain| to b.paths.
+func (b *pathBuilder) extend(chain []*Certificate) {
+	c := chain[len(chain)-1]
+	roots, failedRoot, rootErr := b.roots.findVerifiedParents(c)
+	intermediates, failedIntermediate, intermediateErr := b.intermediates.findVerifiedParents(c)
+	if len(chain) == 1 {
+		b.hintErr, b.hintCert = rootErr, failedRoot
+		if b.hintErr == nil {
+			b.hintErr, b.hintCert = intermediateErr, failedIntermediate
+		}
+	}
+
+	for _, n := range roots {
+		if root := b.roots.certs[n]; validIssuer(root, rootCertificate, chain) {
+			b.paths = append(b.paths, newPath(appendToFreshChain(chain, root)))
+		}
+	}
+	for _, n := range intermediates {
+		if intermediate := b.intermediates.certs[n]; validIssuer(intermediate, intermediateCertificate, chain) {
+			b.extend(appendToFreshChain(chain, intermediate))
+		}
+	}
+}
+
+// validIssuer reports whether |issuer| can extend |chain|, as a CA of
+// |certType|.
+func validIssuer(issuer *Certificate, certType int, chain []*Certificate) bool {
+	for _, c := range chain {
+		if bytes.Equal(c.RawSubject, issuer.RawSubject) &&
+			bytes.Equal(c.RawSubjectPublicKeyInfo, issuer.RawSubjectPublicKeyInfo) {
+			return false
+		}
+	}
+	if certType == intermediateCertificate && (!issuer.BasicConstraintsValid || !issuer.IsCA) {
+		return false
+	}
+	return !issuer.BasicConstraintsValid || issuer.MaxPathLen < 0 || len(chain)-1 <= issuer.MaxPathLen
+}
+
+func newPath(chain []*Certificate) Path {
+	p := Path{Chain: chain, NotBefore: chain[0].NotBefore, NotAfter: chain[0].NotAfter}
+	for _, c := range chain[1:] {
+		if c.NotBefore.After(p.NotBefore) {
+			p.NotBefore = c.NotBefore
+		}
+		if c.NotAfter.Before(p.NotAfter) {
+			p.NotAfter = c.NotAfter
+		}
+	}
+	for _, usage := range PathKeyUsages {
+		if checkChainForKeyUsage(chain, []ExtKeyUsage{usage}) {
+			p.KeyUsages = append(p.KeyUsages, usage)
+		}
+	}
+	p.NameConstraintViolations = CheckNameConstraints(chain[0], chain[1:])
+	return p
+}
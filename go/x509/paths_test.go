@@ -0,0 +1,184 @@
+package x509
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// pathCA is a CA which can issue certificates for path building tests.
+type pathCA struct {
+	cert *Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+var pathSerial int64
+
+// issue returns a certificate for |key| from |tmpl|, issued by |ca|, or
+// self-signed if |ca| is nil.  Unset validity dates default to 2000 to 2040.
+func issue(t *testing.T, tmpl Certificate, key *ecdsa.PrivateKey, ca *pathCA) *pathCA {
+	pathSerial++
+	tmpl.SerialNumber = big.NewInt(pathSerial)
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	parent, parentKey := &tmpl, key
+	if ca != nil {
+		parent, parentKey = ca.cert, ca.key
+	}
+	der, err := CreateCertificate(rand.Reader, &tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ParseCertificate(der)
+	if IsFatal(err) {
+		t.Fatal(err)
+	}
+	return &pathCA{cert: c, key: key}
+}
+
+func caTemplate(cn string) Certificate {
+	return Certificate{Subject: pkix.Name{CommonName: cn}, BasicConstraintsValid: true, IsCA: true, MaxPathLen: -1}
+}
+
+func poolOf(cas ...*pathCA) *CertPool {
+	pool := NewCertPool()
+	for _, ca := range cas {
+		pool.AddCert(ca.cert)
+	}
+	return pool
+}
+
+func pathNames(paths []Path) [][]string {
+	var names [][]string
+	for _, p := range paths {
+		var n []string
+		for _, c := range p.Chain {
+			n = append(n, c.Subject.CommonName)
+		}
+		names = append(names, n)
+	}
+	return names
+}
+
+func TestBuildAllPathsCrossSigned(t *testing.T) {
+	rootA := issue(t, caTemplate("Root A"), newKey(t), nil)
+	rootB := issue(t, caTemplate("Root B"), newKey(t), nil)
+	// The intermediate is cross-signed, and root A is cross-signed by root
+	// B, as CAs do when introducing a new root.
+	intKey := newKey(t)
+	intTmpl := caTemplate("Intermediate")
+	intTmpl.NotAfter = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	intA := issue(t, intTmpl, intKey, rootA)
+	intB := issue(t, intTmpl, intKey, rootB)
+	crossA := issue(t, caTemplate("Root A"), rootA.key, rootB)
+	leaf := issue(t, Certificate{
+		Subject:     pkix.Name{CommonName: "Leaf"},
+		NotBefore:   time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC),
+		ExtKeyUsage: []ExtKeyUsage{ExtKeyUsageServerAuth, ExtKeyUsageClientAuth},
+	}, newKey(t), intA)
+
+	paths, err := BuildAllPaths(leaf.cert, poolOf(intA, intB, crossA), poolOf(rootA, rootB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"Leaf", "Intermediate", "Root A"},
+		{"Leaf", "Intermediate", "Root A", "Root B"},
+		{"Leaf", "Intermediate", "Root B"},
+	}
+	if got := pathNames(paths); !reflect.DeepEqual(got, want) {
+		t.Fatalf("BuildAllPaths()=%v, want %v", got, want)
+	}
+	for i, p := range paths {
+		if !p.NotBefore.Equal(leaf.cert.NotBefore) || !p.NotAfter.Equal(intA.cert.NotAfter) {
+			t.Errorf("#%d: valid from %v to %v, want %v to %v", i, p.NotBefore, p.NotAfter, leaf.cert.NotBefore, intA.cert.NotAfter)
+		}
+		if want := []ExtKeyUsage{ExtKeyUsageServerAuth, ExtKeyUsageClientAuth}; !reflect.DeepEqual(p.KeyUsages, want) {
+			t.Errorf("#%d: KeyUsages=%v, want %v", i, p.KeyUsages, want)
+		}
+		if len(p.NameConstraintViolations) != 0 {
+			t.Errorf("#%d: NameConstraintViolations=%v, want none", i, p.NameConstraintViolations)
+		}
+	}
+	if p := paths[0]; !p.ValidAt(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) || p.ValidAt(time.Date(2035, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("ValidAt() doesn't match the intersection of the validity periods")
+	}
+}
+
+func TestBuildAllPathsRejections(t *testing.T) {
+	root := issue(t, caTemplate("Root"), newKey(t), nil)
+	noCA := issue(t, Certificate{Subject: pkix.Name{CommonName: "Not a CA"}}, newKey(t), root)
+	leaf := issue(t, Certificate{Subject: pkix.Name{CommonName: "Leaf"}}, newKey(t), noCA)
+	_, err := BuildAllPaths(leaf.cert, poolOf(noCA), poolOf(root))
+	if _, ok := err.(UnknownAuthorityError); !ok {
+		t.Errorf("BuildAllPaths(non-CA intermediate)=_,%v, want UnknownAuthorityError", err)
+	}
+
+	// A root which allows one intermediate below it can't have two.  (A
+	// MaxPathLen of zero can't be marshalled.)
+	rootTmpl := caTemplate("Root")
+	rootTmpl.MaxPathLen = 1
+	root = issue(t, rootTmpl, root.key, nil)
+	int1 := issue(t, caTemplate("Intermediate 1"), newKey(t), root)
+	int2 := issue(t, caTemplate("Intermediate 2"), newKey(t), int1)
+	leaf = issue(t, Certificate{Subject: pkix.Name{CommonName: "Leaf"}}, newKey(t), int2)
+	if _, err := BuildAllPaths(leaf.cert, poolOf(int1, int2), poolOf(root)); err == nil {
+		t.Error("BuildAllPaths(path length exceeded)=_,nil, want error")
+	}
+	leaf = issue(t, Certificate{Subject: pkix.Name{CommonName: "Leaf"}}, newKey(t), int1)
+	if _, err := BuildAllPaths(leaf.cert, poolOf(int1, int2), poolOf(root)); err != nil {
+		t.Errorf("BuildAllPaths(one intermediate)=_,%v, want no error", err)
+	}
+}
+
+func TestBuildAllPathsMetadata(t *testing.T) {
+	root := issue(t, caTemplate("Root"), newKey(t), nil)
+	caTmpl := caTemplate("CA")
+	caTmpl.PermittedDNSDomains = []string{"example.com"}
+	caTmpl.ExtKeyUsage = []ExtKeyUsage{ExtKeyUsageServerAuth}
+	ca := issue(t, caTmpl, newKey(t), root)
+	leaf := issue(t, Certificate{
+		Subject:   pkix.Name{CommonName: "Leaf"},
+		DNSNames:  []string{"www.example.org"},
+		NotBefore: time.Date(2041, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:  time.Date(2042, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, newKey(t), ca)
+
+	// Verify rejects the chain, but BuildAllPaths reports why.
+	paths, err := BuildAllPaths(leaf.cert, poolOf(ca), poolOf(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("BuildAllPaths() returned %d paths, want 1", len(paths))
+	}
+	p := paths[0]
+	if !p.NotAfter.Before(p.NotBefore) {
+		t.Errorf("valid from %v to %v, want no validity period", p.NotBefore, p.NotAfter)
+	}
+	if want := []ExtKeyUsage{ExtKeyUsageServerAuth}; !reflect.DeepEqual(p.KeyUsages, want) {
+		t.Errorf("KeyUsages=%v, want %v", p.KeyUsages, want)
+	}
+	want := []NameConstraintViolation{{Cert: leaf.cert, CA: ca.cert, Type: "dNSName", Name: "www.example.org"}}
+	if !reflect.DeepEqual(p.NameConstraintViolations, want) {
+		t.Errorf("NameConstraintViolations=%v, want %v", p.NameConstraintViolations, want)
+	}
+}
@@ -0,0 +1,239 @@
+package x509
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/certificate-transparency/go/asn1"
+)
+
+// This file parses and marshals certificate policies with their qualifiers
+// (RFC 5280 section 4.2.1.4), which crypto/x509 reduces to their OIDs.
+
+// Policy OIDs.
+var (
+	// The special policy which matches any other.
+	OIDAnyPolicy = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+	// The CA/Browser Forum's policies for Extended Validation, Domain
+	// Validated, Organization Validated and Individual Validated
+	// certificates.
+	OIDPolicyExtendedValidation    = asn1.ObjectIdentifier{2, 23, 140, 1, 1}
+	OIDPolicyDomainValidated       = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}
+	OIDPolicyOrganizationValidated = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 2}
+	OIDPolicyIndividualValidated   = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 3}
+	oidPolicyQualifierCPS          = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}
+	oidPolicyQualifierUserNotice   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 2}
+)
+
+// PolicyInformation is a certificate policy and its qualifiers.
+type PolicyInformation struct {
+	ID asn1.ObjectIdentifier
+	// The URIs of the policy's Certification Practice Statements, from its
+	// CPS pointer qualifiers.
+	CPSURIs []string
+	// Its user notice qualifiers.
+	UserNotices []UserNotice
+	// Its qualifiers of other types, which aren't parsed.
+	OtherQualifiers []PolicyQualifier
+}
+
+// UserNotice is a user notice policy qualifier, text to be displayed to
+// relying parties.  Either or both fields may be set.
+type UserNotice struct {
+	NoticeRef *NoticeReference
+	// The text of the notice, which may have been any of the DisplayText
+	// string types.  It is marshalled as a UTF8String.
+	ExplicitText string
+}
+
+// NoticeReference names notices which an organization has published
+// elsewhere, by number.
+type NoticeReference struct {
+	Organization  string
+	NoticeNumbers []int
+}
+
+// PolicyQualifier is a policy qualifier of a type other than a CPS pointer or
+// user notice.
+type PolicyQualifier struct {
+	ID asn1.ObjectIdentifier
+	// The DER encoding of the qualifier.
+	Value []byte
+}
+
+// HasPolicy reports whether |c| asserts any of the policies |oids|.  The CA
+// of an EV certificate, for example, asserts OIDPolicyExtendedValidation
+// and/or a policy of its own.
+func (c *Certificate) HasPolicy(oids ...asn1.ObjectIdentifier) bool {
+	for _, p := range c.PolicyIdentifiers {
+		if oidInList(p, oids) {
+			return true
+		}
+	}
+	return false
+}
+
+// rawPolicyInformation is the ASN.1 form of PolicyInformation.
+type rawPolicyInformation struct {
+	Policy     asn1.ObjectIdentifier
+	Qualifiers []policyQualifierInfo `asn1:"optional"`
+}
+
+type policyQualifierInfo struct {
+	ID        asn1.ObjectIdentifier
+	Qualifier asn1.RawValue
+}
+
+type noticeReference struct {
+	Organization  asn1.RawValue
+	NoticeNumbers []int
+}
+
+// parsePolicies parses the value of a certificate policies extension.  It
+// returns an error if the extension can't be parsed at all; qualifiers which
+// can't be are left out, with a MalformedExtension error added to |nfe| for
+// each, and strings which are invalid for their types are converted as well
+// as possible, with an InvalidString error.
+func parsePolicies(value []byte, nfe *NonFatalErrors) ([]PolicyInformation, error) {
+	var raw []rawPolicyInformation
+	if rest, err := asn1.Unmarshal(value, &raw); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("x509: trailing data after certificate policies")
+	}
+	policies := make([]PolicyInformation, len(raw))
+	for i, r := range raw {
+		p := &policies[i]
+		p.ID = r.Policy
+		for _, q := range r.Qualifiers {
+			var err error
+			switch {
+			case q.ID.Equal(oidPolicyQualifierCPS):
+				if q.Qualifier.Class != asn1.ClassUniversal || q.Qualifier.Tag != tagIA5String {
+					err = errors.New("cPSuri is not an IA5String")
+					break
+				}
+				var uri string
+				if uri, err = parseDisplayText("cPSuri", q.Qualifier, nfe); err == nil {
+					p.CPSURIs = append(p.CPSURIs, uri)
+				}
+			case q.ID.Equal(oidPolicyQualifierUserNotice):
+				var notice UserNotice
+				if notice, err = parseUserNotice(q.Qualifier, nfe); err == nil {
+					p.UserNotices = append(p.UserNotices, notice)
+				}
+			default:
+				p.OtherQualifiers = append(p.OtherQualifiers, PolicyQualifier{ID: q.ID, Value: q.Qualifier.FullBytes})
+			}
+			if err != nil {
+				nfe.AddError(MalformedExtension{ID: oidExtensionCertificatePolicies, Err: fmt.Errorf("policy %v: %v", r.Policy, err)})
+			}
+		}
+	}
+	return policies, nil
+}
+
+// parseUserNotice parses the UserNotice qualifier |v|: a SEQUENCE of an
+// optional NoticeReference and an optional DisplayText.
+func parseUserNotice(v asn1.RawValue, nfe *NonFatalErrors) (UserNotice, error) {
+	var notice UserNotice
+	if v.Class != asn1.ClassUniversal || v.Tag != asn1.TagSequence {
+		return notice, errors.New("user notice is not a SEQUENCE")
+	}
+	elems, err := asn1.ReadElements(v.Bytes)
+	if err != nil {
+		return notice, err
+	}
+	if len(elems) > 0 && elems[0].Class == asn1.ClassUniversal && elems[0].Tag == asn1.TagSequence {
+		var ref noticeReference
+		if _, err := asn1.Unmarshal(elems[0].FullBytes, &ref); err != nil {
+			return notice, err
+		}
+		org, err := parseDisplayText("organization", ref.Organization, nfe)
+		if err != nil {
+			return notice, err
+		}
+		notice.NoticeRef = &NoticeReference{Organization: org, NoticeNumbers: ref.NoticeNumbers}
+		elems = elems[1:]
+	}
+	switch len(elems) {
+	case 0:
+	case 1:
+		text, err := parseDisplayText("explicitText", elems[0], nfe)
+		if err != nil {
+			return notice, err
+		}
+		notice.ExplicitText = text
+	default:
+		return notice, errors.New("too many elements in user notice")
+	}
+	return notice, nil
+}
+
+// parseDisplayText returns the value of the DisplayText |v| in |field|, which
+// may be an IA5String, VisibleString, BMPString or UTF8String.
+func parseDisplayText(field string, v asn1.RawValue, nfe *NonFatalErrors) (string, error) {
+	if v.Class != asn1.ClassUniversal || v.IsCompound {
+		return "", fmt.Errorf("%s is not a string", field)
+	}
+	var s string
+	switch v.Tag {
+	case tagIA5String, tagVisibleString, tagUTF8String:
+		s = string(v.Bytes)
+	case tagBMPString:
+		s = decodeBMPString(v.Bytes)
+	default:
+		return "", fmt.Errorf("%s is a %s", field, asn1TagName(v.Tag))
+	}
+	if !validString(v.Tag, v.Bytes) {
+		nfe.AddError(InvalidString{Field: field, Tag: v.Tag, Bytes: v.Bytes})
+	}
+	return s, nil
+}
+
+// marshalPolicies returns the value of a certificate policies extension
+// holding |policies|.
+func marshalPolicies(policies []PolicyInformation) ([]byte, error) {
+	raw := make([]rawPolicyInformation, len(policies))
+	for i, p := range policies {
+		raw[i].Policy = p.ID
+		for _, uri := range p.CPSURIs {
+			raw[i].Qualifiers = append(raw[i].Qualifiers, policyQualifierInfo{
+				ID:        oidPolicyQualifierCPS,
+				Qualifier: asn1.RawValue{Tag: tagIA5String, Bytes: []byte(uri)},
+			})
+		}
+		for _, n := range p.UserNotices {
+			var elems []asn1.RawValue
+			if n.NoticeRef != nil {
+				ref, err := asn1.Marshal(noticeReference{
+					Organization:  asn1.RawValue{Tag: tagUTF8String, Bytes: []byte(n.NoticeRef.Organization)},
+					NoticeNumbers: n.NoticeRef.NoticeNumbers,
+				})
+				if err != nil {
+					return nil, err
+				}
+				elems = append(elems, asn1.RawValue{FullBytes: ref})
+			}
+			if n.ExplicitText != "" {
+				text, err := asn1.Marshal(asn1.RawValue{Tag: tagUTF8String, Bytes: []byte(n.ExplicitText)})
+				if err != nil {
+					return nil, err
+				}
+				elems = append(elems, asn1.RawValue{FullBytes: text})
+			}
+			notice, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: concat(elems)})
+			if err != nil {
+				return nil, err
+			}
+			raw[i].Qualifiers = append(raw[i].Qualifiers, policyQualifierInfo{
+				ID:        oidPolicyQualifierUserNotice,
+				Qualifier: asn1.RawValue{FullBytes: notice},
+			})
+		}
+		for _, q := range p.OtherQualifiers {
+			raw[i].Qualifiers = append(raw[i].Qualifiers, policyQualifierInfo{ID: q.ID, Qualifier: asn1.RawValue{FullBytes: q.Value}})
+		}
+	}
+	return asn1.Marshal(raw)
+}
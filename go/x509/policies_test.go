@@ -0,0 +1,169 @@
+package x509
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+var (
+	testPolicy  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 5, 1}
+	testPolicy2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 5, 2}
+)
+
+func TestPoliciesRoundTrip(t *testing.T) {
+	for i, tc := range []struct {
+		tmpl Certificate
+		want []PolicyInformation
+	}{
+		{
+			tmpl: Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{OIDPolicyExtendedValidation, testPolicy}},
+			want: []PolicyInformation{{ID: OIDPolicyExtendedValidation}, {ID: testPolicy}},
+		},
+		{
+			tmpl: Certificate{Policies: []PolicyInformation{
+				{ID: OIDPolicyExtendedValidation},
+				{
+					ID:      testPolicy,
+					CPSURIs: []string{"https://pki.example.com/cps", "https://pki.example.com/cps2"},
+					UserNotices: []UserNotice{
+						{ExplicitText: "Relying parties must read the CPS"},
+						{NoticeRef: &NoticeReference{Organization: "Example Ltd.", NoticeNumbers: []int{1, 2}}},
+						{
+							NoticeRef:    &NoticeReference{Organization: "Exämple Ltd.", NoticeNumbers: []int{3}},
+							ExplicitText: "Ünicode",
+						},
+					},
+					OtherQualifiers: []PolicyQualifier{{ID: asn1.ObjectIdentifier{1, 2, 3}, Value: []byte{0x05, 0x00}}},
+				},
+			}},
+		},
+	} {
+		tc.tmpl.Subject = pkix.Name{CommonName: "Policies"}
+		if tc.want == nil {
+			tc.want = tc.tmpl.Policies
+		}
+		c := constrainedChain(t, &tc.tmpl)[0]
+		if _, err := ParseCertificate(c.Raw); err != nil {
+			t.Errorf("#%d: ParseCertificate()=_,%v, want no error", i, err)
+		}
+		if !reflect.DeepEqual(c.Policies, tc.want) {
+			t.Errorf("#%d: Policies=%+v, want %+v", i, c.Policies, tc.want)
+		}
+		var ids []asn1.ObjectIdentifier
+		for _, p := range tc.want {
+			ids = append(ids, p.ID)
+		}
+		if !reflect.DeepEqual(c.PolicyIdentifiers, ids) {
+			t.Errorf("#%d: PolicyIdentifiers=%v, want %v", i, c.PolicyIdentifiers, ids)
+		}
+	}
+}
+
+// policiesDER returns a certificate policies extension value asserting
+// testPolicy with |qualifiers|.
+func policiesDER(t *testing.T, qualifiers ...policyQualifierInfo) []byte {
+	der, err := asn1.Marshal([]rawPolicyInformation{{Policy: testPolicy, Qualifiers: qualifiers}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// userNoticeDER returns a user notice qualifier holding |elems|.
+func userNoticeDER(elems ...asn1.RawValue) policyQualifierInfo {
+	return policyQualifierInfo{
+		ID:        oidPolicyQualifierUserNotice,
+		Qualifier: asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: concat(marshalRawValues(elems))},
+	}
+}
+
+func marshalRawValues(values []asn1.RawValue) []asn1.RawValue {
+	for i := range values {
+		values[i].FullBytes, _ = asn1.Marshal(values[i])
+	}
+	return values
+}
+
+func TestParsePolicies(t *testing.T) {
+	for i, tc := range []struct {
+		value      []byte
+		want       []PolicyInformation
+		wantErrors []string
+	}{
+		{
+			value: policiesDER(t, userNoticeDER(asn1.RawValue{Tag: tagVisibleString, Bytes: []byte("Visible")})),
+			want:  []PolicyInformation{{ID: testPolicy, UserNotices: []UserNotice{{ExplicitText: "Visible"}}}},
+		},
+		{
+			value: policiesDER(t, userNoticeDER(asn1.RawValue{Tag: tagBMPString, Bytes: []byte{0, 'B', 0, 'M', 0, 'P', 0x00, 0xe9}})),
+			want:  []PolicyInformation{{ID: testPolicy, UserNotices: []UserNotice{{ExplicitText: "BMPé"}}}},
+		},
+		{
+			value: policiesDER(t, userNoticeDER(asn1.RawValue{Tag: tagIA5String, Bytes: []byte("IA5")})),
+			want:  []PolicyInformation{{ID: testPolicy, UserNotices: []UserNotice{{ExplicitText: "IA5"}}}},
+		},
+		{
+			// An empty user notice is allowed.
+			value: policiesDER(t, userNoticeDER()),
+			want:  []PolicyInformation{{ID: testPolicy, UserNotices: []UserNotice{{}}}},
+		},
+		{
+			value:      policiesDER(t, userNoticeDER(asn1.RawValue{Tag: tagVisibleString, Bytes: []byte("tab\t")})),
+			want:       []PolicyInformation{{ID: testPolicy, UserNotices: []UserNotice{{ExplicitText: "tab\t"}}}},
+			wantErrors: []string{`x509: invalid VisibleString in explicitText ("tab\t")`},
+		},
+		{
+			value:      policiesDER(t, userNoticeDER(asn1.RawValue{Tag: tagPrintableString, Bytes: []byte("Printable")})),
+			want:       []PolicyInformation{{ID: testPolicy}},
+			wantErrors: []string{"x509: malformed extension [2 5 29 32]: policy [1 3 6 1 4 1 11129 2 5 1]: explicitText is a PrintableString"},
+		},
+		{
+			value: policiesDER(t,
+				policyQualifierInfo{ID: oidPolicyQualifierCPS, Qualifier: asn1.RawValue{Tag: tagUTF8String, Bytes: []byte("https://pki.example.com/utf8")}},
+				policyQualifierInfo{ID: oidPolicyQualifierCPS, Qualifier: asn1.RawValue{Tag: tagIA5String, Bytes: []byte("https://pki.example.com/cps")}},
+			),
+			want:       []PolicyInformation{{ID: testPolicy, CPSURIs: []string{"https://pki.example.com/cps"}}},
+			wantErrors: []string{"x509: malformed extension [2 5 29 32]: policy [1 3 6 1 4 1 11129 2 5 1]: cPSuri is not an IA5String"},
+		},
+	} {
+		var nfe NonFatalErrors
+		got, err := parsePolicies(tc.value, &nfe)
+		if err != nil {
+			t.Errorf("#%d: parsePolicies()=_,%v, want no error", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("#%d: parsePolicies()=%+v, want %+v", i, got, tc.want)
+		}
+		var gotErrors []string
+		for _, e := range nfe.Errors {
+			gotErrors = append(gotErrors, e.Error())
+		}
+		if !reflect.DeepEqual(gotErrors, tc.wantErrors) {
+			t.Errorf("#%d: parsePolicies() errors=%q, want %q", i, gotErrors, tc.wantErrors)
+		}
+	}
+
+	if _, err := parsePolicies([]byte{0x30, 0x03, 0x02, 0x01, 0x01}, &NonFatalErrors{}); err == nil {
+		t.Error("parsePolicies(SEQUENCE OF INTEGER)=_,nil, want error")
+	}
+}
+
+func TestHasPolicy(t *testing.T) {
+	c := &Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{testPolicy, OIDPolicyExtendedValidation}}
+	if !c.HasPolicy(OIDPolicyExtendedValidation) {
+		t.Error("HasPolicy(EV)=false, want true")
+	}
+	if !c.HasPolicy(OIDPolicyDomainValidated, testPolicy) {
+		t.Error("HasPolicy(DV, testPolicy)=false, want true")
+	}
+	if c.HasPolicy(OIDPolicyDomainValidated, testPolicy2) {
+		t.Error("HasPolicy(DV, testPolicy2)=true, want false")
+	}
+	if c.HasPolicy() {
+		t.Error("HasPolicy()=true, want false")
+	}
+}
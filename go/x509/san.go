@@ -0,0 +1,190 @@
+package x509
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// This file parses and marshals the Subject Alternative Names (RFC 5280
+// section 4.2.1.6) which crypto/x509 ignores: otherNames, directoryNames and
+// registeredIDs.
+
+// otherName type OIDs.
+var (
+	// An SRVName (RFC 4985), an IA5String such as
+	// "_xmpp-server.example.com".
+	OIDOtherNameSRVName = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 8, 7}
+	// A Microsoft User Principal Name, a UTF8String such as
+	// "user@example.com".
+	OIDOtherNameUPN = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+)
+
+// OtherName is an otherName Subject Alternative Name: a name of a type
+// identified by an OID, whose value depends on the type.
+type OtherName struct {
+	TypeID asn1.ObjectIdentifier
+	// The value, without the explicit tag around it.
+	Value asn1.RawValue
+}
+
+// StringValue returns the value of |n| if it is an ASN.1 string, as the
+// values of SRVNames and UPNs are.
+func (n OtherName) StringValue() (string, bool) {
+	v := n.Value
+	if v.Class != asn1.ClassUniversal || v.IsCompound {
+		return "", false
+	}
+	switch v.Tag {
+	case tagUTF8String, tagPrintableString, tagIA5String, tagVisibleString:
+		return string(v.Bytes), true
+	case tagBMPString:
+		return decodeBMPString(v.Bytes), true
+	}
+	return "", false
+}
+
+// OtherNameStrings returns the string values of |c|'s otherName Subject
+// Alternative Names of the type |typeID|, e.g. OIDOtherNameSRVName.
+func (c *Certificate) OtherNameStrings(typeID asn1.ObjectIdentifier) []string {
+	var names []string
+	for _, n := range c.OtherNames {
+		if s, ok := n.StringValue(); ok && n.TypeID.Equal(typeID) {
+			names = append(names, s)
+		}
+	}
+	return names
+}
+
+// The tags of the GeneralNames parsed here.
+const (
+	sanOtherName     = 0
+	sanDirectoryName = 4
+	sanRegisteredID  = 8
+)
+
+// parseOtherName parses the otherName GeneralName |v|: an implicitly tagged
+// SEQUENCE of the type OID and the explicitly tagged value.
+func parseOtherName(v asn1.RawValue) (OtherName, error) {
+	elems, err := asn1.ReadElements(v.Bytes)
+	if err != nil {
+		return OtherName{}, err
+	}
+	if len(elems) != 2 {
+		return OtherName{}, fmt.Errorf("otherName has %d elements, want 2", len(elems))
+	}
+	var n OtherName
+	if _, err := asn1.Unmarshal(elems[0].FullBytes, &n.TypeID); err != nil {
+		return OtherName{}, err
+	}
+	if e := elems[1]; e.Class != asn1.ClassContextSpecific || e.Tag != 0 || !e.IsCompound {
+		return OtherName{}, errors.New("otherName value is not explicitly tagged")
+	}
+	if rest, err := asn1.Unmarshal(elems[1].Bytes, &n.Value); err != nil {
+		return OtherName{}, err
+	} else if len(rest) != 0 {
+		return OtherName{}, errors.New("trailing data after otherName value")
+	}
+	return n, nil
+}
+
+// parseDirectoryName parses the directoryName GeneralName |v|.
+func parseDirectoryName(v asn1.RawValue) (pkix.Name, error) {
+	var name pkix.Name
+	if !v.IsCompound {
+		return name, errors.New("directoryName is not explicitly tagged")
+	}
+	var rdns pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(v.Bytes, &rdns); err != nil {
+		return name, err
+	} else if len(rest) != 0 {
+		return name, errors.New("trailing data after directoryName")
+	}
+	name.FillFromRDNSequence(&rdns)
+	return name, nil
+}
+
+// parseRegisteredID parses the registeredID GeneralName |v|, an implicitly
+// tagged OBJECT IDENTIFIER.
+func parseRegisteredID(v asn1.RawValue) (asn1.ObjectIdentifier, error) {
+	der, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagOID, Bytes: v.Bytes})
+	if err != nil {
+		return nil, err
+	}
+	var id asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(der, &id); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// parseOtherSAN parses the otherName, directoryName or registeredID |v| into
+// |out|.  It returns false, adding a MalformedExtension error to |nfe|, if
+// it can't, and true if it isn't one of those.
+func parseOtherSAN(v asn1.RawValue, out *Certificate, nfe *NonFatalErrors) bool {
+	var err error
+	switch v.Tag {
+	case sanOtherName:
+		var n OtherName
+		if n, err = parseOtherName(v); err == nil {
+			out.OtherNames = append(out.OtherNames, n)
+		}
+	case sanDirectoryName:
+		var name pkix.Name
+		if name, err = parseDirectoryName(v); err == nil {
+			out.DirectoryNames = append(out.DirectoryNames, name)
+		}
+	case sanRegisteredID:
+		var id asn1.ObjectIdentifier
+		if id, err = parseRegisteredID(v); err == nil {
+			out.RegisteredIDs = append(out.RegisteredIDs, id)
+		}
+	}
+	if err != nil {
+		nfe.AddError(MalformedExtension{ID: oidExtensionSubjectAltName, Err: fmt.Errorf("GeneralName [%d]: %v", v.Tag, err)})
+		return false
+	}
+	return true
+}
+
+// marshalOtherSANs returns the GeneralNames for |template|'s OtherNames,
+// DirectoryNames and RegisteredIDs.
+func marshalOtherSANs(template *Certificate) ([]asn1.RawValue, error) {
+	var names []asn1.RawValue
+	for _, n := range template.OtherNames {
+		typeID, err := asn1.Marshal(n.TypeID)
+		if err != nil {
+			return nil, err
+		}
+		value, err := asn1.Marshal(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		value, err = asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: value})
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: sanOtherName, IsCompound: true, Bytes: append(typeID, value...)})
+	}
+	for _, name := range template.DirectoryNames {
+		der, err := asn1.Marshal(name.ToRDNSequence())
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: sanDirectoryName, IsCompound: true, Bytes: der})
+	}
+	for _, id := range template.RegisteredIDs {
+		der, err := asn1.Marshal(id)
+		if err != nil {
+			return nil, err
+		}
+		var v asn1.RawValue
+		if _, err := asn1.Unmarshal(der, &v); err != nil {
+			return nil, err
+		}
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: sanRegisteredID, Bytes: v.Bytes})
+	}
+	return names, nil
+}
@@ -0,0 +1,91 @@
+package x509
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+func TestOtherSANsRoundTrip(t *testing.T) {
+	tmpl := Certificate{
+		Subject:  pkix.Name{CommonName: "SANs"},
+		DNSNames: []string{"www.example.com"},
+		URIs:     []string{"https://www.example.com/"},
+		OtherNames: []OtherName{
+			{TypeID: OIDOtherNameSRVName, Value: asn1.RawValue{Tag: tagIA5String, Bytes: []byte("_xmpp-server.example.com")}},
+			{TypeID: OIDOtherNameUPN, Value: asn1.RawValue{Tag: tagUTF8String, Bytes: []byte("üser@example.com")}},
+			{TypeID: asn1.ObjectIdentifier{1, 2, 3}, Value: asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true}},
+		},
+		DirectoryNames: []pkix.Name{{CommonName: "Directory", Organization: []string{"Example Ltd."}}},
+		RegisteredIDs:  []asn1.ObjectIdentifier{{1, 2, 3, 4}},
+	}
+	c := constrainedChain(t, &tmpl)[0]
+	if _, err := ParseCertificate(c.Raw); err != nil {
+		t.Errorf("ParseCertificate()=_,%v, want no error", err)
+	}
+	if !reflect.DeepEqual(c.URIs, tmpl.URIs) {
+		t.Errorf("URIs=%v, want %v", c.URIs, tmpl.URIs)
+	}
+	if len(c.OtherNames) != len(tmpl.OtherNames) {
+		t.Fatalf("OtherNames=%v, want %v", c.OtherNames, tmpl.OtherNames)
+	}
+	for i, n := range c.OtherNames {
+		want := tmpl.OtherNames[i]
+		if !n.TypeID.Equal(want.TypeID) || n.Value.Tag != want.Value.Tag || string(n.Value.Bytes) != string(want.Value.Bytes) {
+			t.Errorf("OtherNames[%d]=%+v, want %+v", i, n, want)
+		}
+	}
+	if got := c.OtherNameStrings(OIDOtherNameSRVName); !reflect.DeepEqual(got, []string{"_xmpp-server.example.com"}) {
+		t.Errorf("OtherNameStrings(SRVName)=%q", got)
+	}
+	if got := c.OtherNameStrings(OIDOtherNameUPN); !reflect.DeepEqual(got, []string{"üser@example.com"}) {
+		t.Errorf("OtherNameStrings(UPN)=%q", got)
+	}
+	if _, ok := c.OtherNames[2].StringValue(); ok {
+		t.Error("StringValue() of a SEQUENCE succeeded")
+	}
+	if len(c.DirectoryNames) != 1 || c.DirectoryNames[0].CommonName != "Directory" || !reflect.DeepEqual(c.DirectoryNames[0].Organization, []string{"Example Ltd."}) {
+		t.Errorf("DirectoryNames=%+v, want %+v", c.DirectoryNames, tmpl.DirectoryNames)
+	}
+	if !reflect.DeepEqual(c.RegisteredIDs, tmpl.RegisteredIDs) {
+		t.Errorf("RegisteredIDs=%v, want %v", c.RegisteredIDs, tmpl.RegisteredIDs)
+	}
+}
+
+func TestMalformedOtherSANs(t *testing.T) {
+	for i, name := range []asn1.RawValue{
+		// An otherName without its value.
+		{Class: asn1.ClassContextSpecific, Tag: sanOtherName, IsCompound: true, Bytes: []byte{0x06, 0x01, 0x2a}},
+		// An otherName whose value isn't explicitly tagged.
+		{Class: asn1.ClassContextSpecific, Tag: sanOtherName, IsCompound: true, Bytes: []byte{0x06, 0x01, 0x2a, 0x16, 0x01, 'a'}},
+		// A directoryName which isn't a Name.
+		{Class: asn1.ClassContextSpecific, Tag: sanDirectoryName, IsCompound: true, Bytes: []byte{0x16, 0x01, 'a'}},
+		{Class: asn1.ClassContextSpecific, Tag: sanRegisteredID},
+	} {
+		value, err := asn1.Marshal([]asn1.RawValue{name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// As the only name, in a critical extension, the malformed name
+		// leaves the extension unhandled.
+		tmpl := Certificate{
+			Subject:         pkix.Name{CommonName: "SANs"},
+			ExtraExtensions: []pkix.Extension{{Id: oidExtensionSubjectAltName, Critical: true, Value: value}},
+		}
+		c := constrainedChain(t, &tmpl)[0]
+		_, err = ParseCertificate(c.Raw)
+		nfe, ok := err.(NonFatalErrors)
+		if !ok || len(nfe.Errors) != 2 {
+			t.Errorf("#%d: ParseCertificate()=_,%v, want MalformedExtension and UnhandledCriticalExtension", i, err)
+			continue
+		}
+		if m, ok := nfe.Errors[0].(MalformedExtension); !ok || !m.ID.Equal(oidExtensionSubjectAltName) {
+			t.Errorf("#%d: ParseCertificate() error %v, want MalformedExtension", i, nfe.Errors[0])
+		}
+		if _, ok := nfe.Errors[1].(UnhandledCriticalExtension); !ok {
+			t.Errorf("#%d: ParseCertificate() error %v, want UnhandledCriticalExtension", i, nfe.Errors[1])
+		}
+	}
+}
@@ -5,6 +5,7 @@
 package x509
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"runtime"
@@ -115,6 +116,37 @@ func (e UnknownAuthorityError) Error() string {
 	return s
 }
 
+// ChainLimitReason is the reason a candidate chain was abandoned.
+type ChainLimitReason int
+
+const (
+	// ChainTooLong results when a chain would be longer than
+	// VerifyOptions.MaxChainLength.
+	ChainTooLong ChainLimitReason = iota
+	// ChainLoop results when a chain would contain the same subject and
+	// public key twice, and VerifyOptions.DetectKeyLoops is set.
+	ChainLoop
+)
+
+// ChainLimitError results when no chain could be built, and at least one
+// candidate chain was abandoned because of the limits in VerifyOptions.
+type ChainLimitError struct {
+	// Certificate is the certificate at which the first abandoned chain
+	// could not be extended.
+	Certificate *Certificate
+	Reason      ChainLimitReason
+}
+
+func (e ChainLimitError) Error() string {
+	switch e.Reason {
+	case ChainTooLong:
+		return "x509: no chain found within the maximum chain length"
+	case ChainLoop:
+		return fmt.Sprintf("x509: no chain found without a loop through %q", e.Certificate.Subject.CommonName)
+	}
+	return "x509: no chain found within limits"
+}
+
 // SystemRootsError results when we fail to load the system root certificates.
 type SystemRootsError struct {
 }
@@ -136,6 +168,14 @@ type VerifyOptions struct {
 	// constraint down the chain which mirrors Windows CryptoAPI behaviour,
 	// but not the spec. To accept any key usage, include ExtKeyUsageAny.
 	KeyUsages []ExtKeyUsage
+	// MaxChainLength is the maximum number of certificates, including the
+	// leaf and the root, in a chain. Zero means there is no limit.
+	MaxChainLength int
+	// DetectKeyLoops stops a chain from being built through the same
+	// subject and public key twice, as can happen when CAs cross-sign each
+	// other. Otherwise only the same certificate appearing twice is
+	// treated as a loop.
+	DetectKeyLoops bool
 }
 
 const (
@@ -235,8 +275,12 @@ func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err e
 		}
 	}
 
-	candidateChains, err := c.buildChains(make(map[int][][]*Certificate), []*Certificate{c}, &opts)
+	var limitErr *ChainLimitError
+	candidateChains, err := c.buildChains(make(map[chainCacheKey][][]*Certificate), []*Certificate{c}, &opts, &limitErr)
 	if err != nil {
+		if _, ok := err.(UnknownAuthorityError); ok && limitErr != nil {
+			err = *limitErr
+		}
 		return
 	}
 
@@ -273,10 +317,34 @@ func appendToFreshChain(chain []*Certificate, cert *Certificate) []*Certificate
 	return n
 }
 
-func (c *Certificate) buildChains(cache map[int][][]*Certificate, currentChain []*Certificate, opts *VerifyOptions) (chains [][]*Certificate, err error) {
+// chainCacheKey identifies the chains buildChains found under an
+// intermediate.
+type chainCacheKey struct {
+	intermediate int
+	// depth is the length of the chain by which the intermediate was
+	// reached, if MaxChainLength makes the chains under it depend on that.
+	depth int
+}
+
+// buildChains returns the chains from c to a root which extend currentChain.
+// If a candidate chain is abandoned because of the limits in opts, and
+// *limitErr is nil, it is set to describe why.
+func (c *Certificate) buildChains(cache map[chainCacheKey][][]*Certificate, currentChain []*Certificate, opts *VerifyOptions, limitErr **ChainLimitError) (chains [][]*Certificate, err error) {
+	abandon := func(reason ChainLimitReason) {
+		if *limitErr == nil {
+			*limitErr = &ChainLimitError{Certificate: c, Reason: reason}
+		}
+	}
+	// Whether adding a root would take the chain over the maximum length.
+	tooLong := opts.MaxChainLength > 0 && len(currentChain) >= opts.MaxChainLength
+
 	possibleRoots, failedRoot, rootErr := opts.Roots.findVerifiedParents(c)
 	for _, rootNum := range possibleRoots {
 		root := opts.Roots.certs[rootNum]
+		if tooLong {
+			abandon(ChainTooLong)
+			continue
+		}
 		err = root.isValid(rootCertificate, currentChain, opts)
 		if err != nil {
 			continue
@@ -290,18 +358,40 @@ nextIntermediate:
 		intermediate := opts.Intermediates.certs[intermediateNum]
 		for _, cert := range currentChain {
 			if cert == intermediate {
+				if opts.DetectKeyLoops {
+					abandon(ChainLoop)
+				}
 				continue nextIntermediate
 			}
+			if opts.DetectKeyLoops && bytes.Equal(cert.RawSubject, intermediate.RawSubject) &&
+				bytes.Equal(cert.RawSubjectPublicKeyInfo, intermediate.RawSubjectPublicKeyInfo) {
+				abandon(ChainLoop)
+				continue nextIntermediate
+			}
+		}
+		// A chain ending in an intermediate needs at least a root as well.
+		if opts.MaxChainLength > 0 && len(currentChain)+1 >= opts.MaxChainLength {
+			abandon(ChainTooLong)
+			continue
 		}
 		err = intermediate.isValid(intermediateCertificate, currentChain, opts)
 		if err != nil {
 			continue
 		}
+		key := chainCacheKey{intermediate: intermediateNum}
+		if opts.MaxChainLength > 0 {
+			key.depth = len(currentChain)
+		}
 		var childChains [][]*Certificate
-		childChains, ok := cache[intermediateNum]
+		childChains, ok := cache[key]
 		if !ok {
-			childChains, err = intermediate.buildChains(cache, appendToFreshChain(currentChain, intermediate), opts)
-			cache[intermediateNum] = childChains
+			childChains, err = intermediate.buildChains(cache, appendToFreshChain(currentChain, intermediate), opts, limitErr)
+			// With DetectKeyLoops, the chains under an intermediate
+			// depend on every key on the way to it, so they can't
+			// be reused.
+			if !opts.DetectKeyLoops {
+				cache[key] = childChains
+			}
 		}
 		chains = append(chains, childChains...)
 	}
@@ -8,8 +8,13 @@ import (
 	// START CT CHANGES
 	"github.com/google/certificate-transparency/go/x509/pkix"
 	// END CT CHANGES
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/pem"
 	"errors"
+	"fmt"
+	"math/big"
 	"runtime"
 	"strings"
 	"testing"
@@ -26,6 +31,7 @@ type verifyTest struct {
 	keyUsages            []ExtKeyUsage
 	testSystemRootsError bool
 	disableTimeChecks    bool
+	maxChainLength       int
 
 	errorCallback  func(*testing.T, int, error) bool
 	expectedChains [][]string
@@ -237,6 +243,28 @@ var verifyTests = []verifyTest{
 			},
 		},
 	},
+	{
+		leaf:           googleLeaf,
+		intermediates:  []string{thawteIntermediate},
+		roots:          []string{verisignRoot},
+		currentTime:    1302726541,
+		maxChainLength: 3,
+
+		expectedChains: [][]string{
+			{"Google", "Thawte", "VeriSign"},
+		},
+	},
+	{
+		// The chain is one certificate too long.
+		leaf:           googleLeaf,
+		intermediates:  []string{thawteIntermediate},
+		roots:          []string{verisignRoot},
+		currentTime:    1302726541,
+		maxChainLength: 2,
+		systemSkip:     true,
+
+		errorCallback: expectChainTooLong,
+	},
 }
 
 func expectHostnameError(t *testing.T, i int, err error) (ok bool) {
@@ -271,6 +299,14 @@ func expectAuthorityUnknown(t *testing.T, i int, err error) (ok bool) {
 	return true
 }
 
+func expectChainTooLong(t *testing.T, i int, err error) (ok bool) {
+	if lim, ok := err.(ChainLimitError); !ok || lim.Reason != ChainTooLong {
+		t.Errorf("#%d: error was not ChainTooLong: %s", i, err)
+		return false
+	}
+	return true
+}
+
 func expectSystemRootsError(t *testing.T, i int, err error) bool {
 	if _, ok := err.(SystemRootsError); !ok {
 		t.Errorf("#%d: error was not SystemRootsError: %s", i, err)
@@ -314,6 +350,7 @@ func testVerify(t *testing.T, useSystemRoots bool) {
 			CurrentTime:       time.Unix(test.currentTime, 0),
 			KeyUsages:         test.keyUsages,
 			DisableTimeChecks: test.disableTimeChecks,
+			MaxChainLength:    test.maxChainLength,
 		}
 
 		if !useSystemRoots {
@@ -973,3 +1010,128 @@ AbEVtQwdpf5pLGkkeB6zpxxxYu7KyJesF12KwvhHhm4qxFYxldBniYUr+WymXUad
 DKqC5JlR3XC321Y9YeRq4VzW9v493kHMB65jUr9TU/Qr6cf9tveCX4XSQRjbgbME
 HMUfpIBvFSDJ3gyICh3WZlXi/EjJKSZp4A==
 -----END CERTIFICATE-----`
+
+// loopTestTemplate returns a template for a certificate in a cross-signed
+// hierarchy.
+func loopTestTemplate(serial int64, cn string, isCA bool) *Certificate {
+	return &Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Unix(1000, 0),
+		NotAfter:              time.Unix(100000, 0),
+		KeyUsage:              KeyUsageCertSign | KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+}
+
+func createLoopTestCert(t *testing.T, tmpl, parent *Certificate, pub interface{}, priv interface{}) *Certificate {
+	der, err := CreateCertificate(rand.Reader, tmpl, parent, pub, priv)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+	cert, err := ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %s", err)
+	}
+	return cert
+}
+
+func TestVerifyKeyLoops(t *testing.T) {
+	// Two CAs, A and B, which have each cross-signed the other twice.
+	keyA, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyB, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := loopTestTemplate
+	create := func(tmpl, parent *Certificate, pub interface{}, priv interface{}) *Certificate {
+		return createLoopTestCert(t, tmpl, parent, pub, priv)
+	}
+	intermediates := NewCertPool()
+	for serial := int64(1); serial <= 4; serial += 2 {
+		intermediates.AddCert(create(template(serial, "A", true), template(0, "B", true), &keyA.PublicKey, keyB))
+		intermediates.AddCert(create(template(serial+1, "B", true), template(0, "A", true), &keyB.PublicKey, keyA))
+	}
+	leaf := create(template(5, "leaf", false), template(0, "A", true), &keyA.PublicKey, keyA)
+
+	opts := VerifyOptions{
+		Intermediates: intermediates,
+		Roots:         NewCertPool(),
+		CurrentTime:   time.Unix(2000, 0),
+		KeyUsages:     []ExtKeyUsage{ExtKeyUsageAny},
+	}
+	if _, err := leaf.Verify(opts); err == nil {
+		t.Fatal("chain without a root verified")
+	} else if _, ok := err.(UnknownAuthorityError); !ok {
+		t.Errorf("error without limits was not UnknownAuthorityError: %s", err)
+	}
+
+	opts.DetectKeyLoops = true
+	_, err = leaf.Verify(opts)
+	if lim, ok := err.(ChainLimitError); !ok || lim.Reason != ChainLoop {
+		t.Errorf("error with DetectKeyLoops was not ChainLoop: %s", err)
+	}
+}
+
+func TestVerifyCrossSignedMeshIsBounded(t *testing.T) {
+	// Every one of the CAs has cross-signed every other, and none of them
+	// is a root, so every path through them has to be tried.  Without
+	// limits, or if what is found under each intermediate isn't reused,
+	// there are far too many to try.
+	const numCAs = 6
+	keys := make([]*ecdsa.PrivateKey, numCAs)
+	for i := range keys {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	name := func(i int) string { return fmt.Sprintf("CA %d", i) }
+	intermediates := NewCertPool()
+	serial := int64(1)
+	for i := range keys {
+		for j := range keys {
+			if i != j {
+				tmpl := loopTestTemplate(serial, name(i), true)
+				intermediates.AddCert(createLoopTestCert(t, tmpl, loopTestTemplate(0, name(j), true), &keys[i].PublicKey, keys[j]))
+				serial++
+			}
+		}
+	}
+	leaf := createLoopTestCert(t, loopTestTemplate(serial, "leaf", false), loopTestTemplate(0, name(0), true), &keys[0].PublicKey, keys[0])
+
+	for _, test := range []struct {
+		detectKeyLoops bool
+		reason         ChainLimitReason
+	}{
+		{false, ChainTooLong},
+		{true, ChainLoop},
+	} {
+		opts := VerifyOptions{
+			Intermediates:  intermediates,
+			Roots:          NewCertPool(),
+			CurrentTime:    time.Unix(2000, 0),
+			KeyUsages:      []ExtKeyUsage{ExtKeyUsageAny},
+			MaxChainLength: 12,
+			DetectKeyLoops: test.detectKeyLoops,
+		}
+		done := make(chan error, 1)
+		go func() {
+			_, err := leaf.Verify(opts)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if lim, ok := err.(ChainLimitError); !ok || lim.Reason != test.reason {
+				t.Errorf("DetectKeyLoops=%t: error was not ChainLimitError with reason %d: %s", test.detectKeyLoops, test.reason, err)
+			}
+		case <-time.After(30 * time.Second):
+			t.Fatalf("DetectKeyLoops=%t: verifying through the mesh didn't finish", test.detectKeyLoops)
+		}
+	}
+}
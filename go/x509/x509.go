@@ -144,10 +144,15 @@ type dsaSignature struct {
 
 type ecdsaSignature dsaSignature
 
+// START CT CHANGES
+// The times are parsed by parseTime, which tolerates encodings which aren't
+// quite right.
 type validity struct {
-	NotBefore, NotAfter time.Time
+	NotBefore, NotAfter asn1.RawValue
 }
 
+// END CT CHANGES
+
 type publicKeyInfo struct {
 	Raw       asn1.RawContent
 	Algorithm pkix.AlgorithmIdentifier
@@ -515,15 +520,38 @@ type Certificate struct {
 	DNSNames       []string
 	EmailAddresses []string
 	IPAddresses    []net.IP
+	// START CT CHANGES
+	URIs           []string
+	OtherNames     []OtherName
+	DirectoryNames []pkix.Name
+	RegisteredIDs  []asn1.ObjectIdentifier
+	// END CT CHANGES
 
 	// Name constraints
 	PermittedDNSDomainsCritical bool // if true then the name constraints are marked critical.
 	PermittedDNSDomains         []string
+	// START CT CHANGES
+	// The other name constraints, which Verify doesn't check, but
+	// CheckNameConstraints does.
+	ExcludedDNSDomains      []string
+	PermittedEmailAddresses []string
+	ExcludedEmailAddresses  []string
+	PermittedIPRanges       []*net.IPNet
+	ExcludedIPRanges        []*net.IPNet
+	PermittedURIDomains     []string
+	ExcludedURIDomains      []string
+	// END CT CHANGES
 
 	// CRL Distribution Points
 	CRLDistributionPoints []string
 
 	PolicyIdentifiers []asn1.ObjectIdentifier
+
+	// START CT CHANGES
+	// The certificate policies with their qualifiers.  When creating a
+	// certificate, Policies is used instead of PolicyIdentifiers if set.
+	Policies []PolicyInformation
+	// END CT CHANGES
 }
 
 // ErrUnsupportedAlgorithm results from attempting to perform an operation that
@@ -623,6 +651,20 @@ func (c *Certificate) CheckSignatureFrom(parent *Certificate) (err error) {
 // CheckSignature verifies that signature is a valid signature over signed from
 // c's public key.
 func (c *Certificate) CheckSignature(algo SignatureAlgorithm, signed, signature []byte) (err error) {
+	// START CT CHANGES
+	hashType, err := signatureHash(algo)
+	if err != nil {
+		return err
+	}
+	h := hashType.New()
+
+	h.Write(signed)
+	return c.checkDigestSignature(hashType, h.Sum(nil), signature)
+}
+
+// signatureHash returns the hash which signatures of type algo are over, if
+// it is available.
+func signatureHash(algo SignatureAlgorithm) (crypto.Hash, error) {
 	var hashType crypto.Hash
 
 	switch algo {
@@ -635,17 +677,20 @@ func (c *Certificate) CheckSignature(algo SignatureAlgorithm, signed, signature
 	case SHA512WithRSA, ECDSAWithSHA512:
 		hashType = crypto.SHA512
 	default:
-		return ErrUnsupportedAlgorithm
+		return 0, ErrUnsupportedAlgorithm
 	}
 
 	if !hashType.Available() {
-		return ErrUnsupportedAlgorithm
+		return 0, ErrUnsupportedAlgorithm
 	}
-	h := hashType.New()
-
-	h.Write(signed)
-	digest := h.Sum(nil)
+	return hashType, nil
+}
 
+// checkDigestSignature verifies that signature is a valid signature from c's
+// public key over digest, the hash of type hashType of what was signed, so
+// that data too large to hold can be hashed as it is read.
+func (c *Certificate) checkDigestSignature(hashType crypto.Hash, digest, signature []byte) (err error) {
+	// END CT CHANGES
 	switch pub := c.PublicKey.(type) {
 	case *rsa.PublicKey:
 		return rsa.VerifyPKCS1v15(pub, hashType, digest, signature)
@@ -683,6 +728,17 @@ func (c *Certificate) CheckCRLSignature(crl *pkix.CertificateList) (err error) {
 	return c.CheckSignature(algo, crl.TBSCertList.Raw, crl.SignatureValue.RightAlign())
 }
 
+// START CT CHANGES
+
+// SignatureAlgorithmFromOID returns the signature algorithm identified by oid,
+// or UnknownSignatureAlgorithm, for checking signatures over structures other
+// than certificates and CRLs, such as OCSP responses, with CheckSignature.
+func SignatureAlgorithmFromOID(oid asn1.ObjectIdentifier) SignatureAlgorithm {
+	return getSignatureAlgorithmFromOID(oid)
+}
+
+// END CT CHANGES
+
 // START CT CHANGES
 type UnhandledCriticalExtension struct {
 	ID asn1.ObjectIdentifier
@@ -699,12 +755,6 @@ type basicConstraints struct {
 	MaxPathLen int  `asn1:"optional,default:-1"`
 }
 
-// RFC 5280 4.2.1.4
-type policyInformation struct {
-	Policy asn1.ObjectIdentifier
-	// policyQualifiers omitted
-}
-
 // RFC 5280, 4.2.1.10
 type nameConstraints struct {
 	Permitted []generalSubtree `asn1:"optional,tag:0"`
@@ -712,7 +762,10 @@ type nameConstraints struct {
 }
 
 type generalSubtree struct {
-	Name string `asn1:"tag:2,optional,ia5"`
+	// START CT CHANGES
+	// The base GeneralName, of whichever type it is.
+	Base asn1.RawValue
+	// END CT CHANGES
 }
 
 // RFC 5280, 4.2.2.1
@@ -863,7 +916,7 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 
 	if in.TBSCertificate.SerialNumber.Sign() < 0 {
 		// START CT CHANGES
-		nfe.AddError(errors.New("x509: negative serial number"))
+		nfe.AddError(NegativeSerialNumber{in.TBSCertificate.SerialNumber})
 		// END CT CHANGES
 	}
 
@@ -878,14 +931,36 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 		return nil, err
 	}
 
+	// START CT CHANGES
+	checkNameStrings("issuer", in.TBSCertificate.Issuer.FullBytes, &nfe)
+	checkNameStrings("subject", in.TBSCertificate.Subject.FullBytes, &nfe)
+	// END CT CHANGES
+
 	out.Issuer.FillFromRDNSequence(&issuer)
 	out.Subject.FillFromRDNSequence(&subject)
 
-	out.NotBefore = in.TBSCertificate.Validity.NotBefore
-	out.NotAfter = in.TBSCertificate.Validity.NotAfter
+	// START CT CHANGES
+	if out.NotBefore, err = parseTime("notBefore", in.TBSCertificate.Validity.NotBefore, &nfe); err != nil {
+		return nil, err
+	}
+	if out.NotAfter, err = parseTime("notAfter", in.TBSCertificate.Validity.NotAfter, &nfe); err != nil {
+		return nil, err
+	}
+	// END CT CHANGES
 
+	// START CT CHANGES
+extensions:
+	// END CT CHANGES
 	for _, e := range in.TBSCertificate.Extensions {
 		out.Extensions = append(out.Extensions, e)
+		// START CT CHANGES
+		malformed := func(err error) {
+			nfe.AddError(MalformedExtension{ID: e.Id, Err: err})
+			if e.Critical {
+				nfe.AddError(UnhandledCriticalExtension{e.Id})
+			}
+		}
+		// END CT CHANGES
 
 		if len(e.Id) == 4 && e.Id[0] == 2 && e.Id[1] == 5 && e.Id[2] == 29 {
 			switch e.Id[3] {
@@ -904,6 +979,10 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 					out.KeyUsage = KeyUsage(usage)
 					continue
 				}
+				// START CT CHANGES
+				// Fall through to the critical check below.
+				nfe.AddError(MalformedExtension{ID: e.Id, Err: err})
+				// END CT CHANGES
 			case 19:
 				// RFC 5280, 4.2.1.9
 				var constraints basicConstraints
@@ -915,6 +994,10 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 					out.MaxPathLen = constraints.MaxPathLen
 					continue
 				}
+				// START CT CHANGES
+				// Fall through to the critical check below.
+				nfe.AddError(MalformedExtension{ID: e.Id, Err: err})
+				// END CT CHANGES
 			case 17:
 				// RFC 5280, 4.2.1.6
 
@@ -935,10 +1018,16 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 				var seq asn1.RawValue
 				_, err := asn1.Unmarshal(e.Value, &seq)
 				if err != nil {
-					return nil, err
+					// START CT CHANGES
+					malformed(err)
+					continue extensions
+					// END CT CHANGES
 				}
 				if !seq.IsCompound || seq.Tag != 16 || seq.Class != 0 {
-					return nil, asn1.StructuralError{Msg: "bad SAN sequence"}
+					// START CT CHANGES
+					malformed(asn1.StructuralError{Msg: "bad SAN sequence"})
+					continue extensions
+					// END CT CHANGES
 				}
 
 				parsedName := false
@@ -948,22 +1037,47 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 					var v asn1.RawValue
 					rest, err = asn1.Unmarshal(rest, &v)
 					if err != nil {
-						return nil, err
+						// START CT CHANGES
+						malformed(err)
+						continue extensions
+						// END CT CHANGES
 					}
 					switch v.Tag {
 					case 1:
+						// START CT CHANGES
+						if !validString(tagIA5String, v.Bytes) {
+							nfe.AddError(InvalidString{Field: "rfc822Name", Tag: tagIA5String, Bytes: v.Bytes})
+						}
+						// END CT CHANGES
 						out.EmailAddresses = append(out.EmailAddresses, string(v.Bytes))
 						parsedName = true
 					case 2:
+						// START CT CHANGES
+						if !validString(tagIA5String, v.Bytes) {
+							nfe.AddError(InvalidString{Field: "dNSName", Tag: tagIA5String, Bytes: v.Bytes})
+						}
+						// END CT CHANGES
 						out.DNSNames = append(out.DNSNames, string(v.Bytes))
 						parsedName = true
+					// START CT CHANGES
+					case 6:
+						if !validString(tagIA5String, v.Bytes) {
+							nfe.AddError(InvalidString{Field: "uniformResourceIdentifier", Tag: tagIA5String, Bytes: v.Bytes})
+						}
+						out.URIs = append(out.URIs, string(v.Bytes))
+						parsedName = true
+					case sanOtherName, sanDirectoryName, sanRegisteredID:
+						if parseOtherSAN(v, out, &nfe) {
+							parsedName = true
+						}
+					// END CT CHANGES
 					case 7:
 						switch len(v.Bytes) {
 						case net.IPv4len, net.IPv6len:
 							out.IPAddresses = append(out.IPAddresses, v.Bytes)
 						default:
 							// START CT CHANGES
-							nfe.AddError(fmt.Errorf("x509: certificate contained IP address of length %d : %v", len(v.Bytes), v.Bytes))
+							nfe.AddError(InvalidIPAddress{v.Bytes})
 							// END CT CHANGES
 						}
 					}
@@ -991,29 +1105,17 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 				//
 				// BaseDistance ::= INTEGER (0..MAX)
 
-				var constraints nameConstraints
-				_, err := asn1.Unmarshal(e.Value, &constraints)
+				// START CT CHANGES
+				unenforced, err := parseNameConstraints(out, e.Value)
 				if err != nil {
-					return nil, err
+					malformed(err)
+					continue extensions
 				}
-
-				if len(constraints.Excluded) > 0 && e.Critical {
-					// START CT CHANGES
+				// Verify only enforces permitted DNS domains.
+				if unenforced && e.Critical {
 					nfe.AddError(UnhandledCriticalExtension{e.Id})
-					// END CT CHANGES
-				}
-
-				for _, subtree := range constraints.Permitted {
-					if len(subtree.Name) == 0 {
-						if e.Critical {
-							// START CT CHANGES
-							nfe.AddError(UnhandledCriticalExtension{e.Id})
-							// END CT CHANGES
-						}
-						continue
-					}
-					out.PermittedDNSDomains = append(out.PermittedDNSDomains, subtree.Name)
 				}
+				// END CT CHANGES
 				continue
 
 			case 31:
@@ -1033,14 +1135,20 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 				var cdp []distributionPoint
 				_, err := asn1.Unmarshal(e.Value, &cdp)
 				if err != nil {
-					return nil, err
+					// START CT CHANGES
+					malformed(err)
+					continue extensions
+					// END CT CHANGES
 				}
 
 				for _, dp := range cdp {
 					var n asn1.RawValue
 					_, err = asn1.Unmarshal(dp.DistributionPoint.FullName.Bytes, &n)
 					if err != nil {
-						return nil, err
+						// START CT CHANGES
+						malformed(err)
+						continue extensions
+						// END CT CHANGES
 					}
 
 					if n.Tag == 6 {
@@ -1054,7 +1162,10 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 				var a authKeyId
 				_, err = asn1.Unmarshal(e.Value, &a)
 				if err != nil {
-					return nil, err
+					// START CT CHANGES
+					malformed(err)
+					continue extensions
+					// END CT CHANGES
 				}
 				out.AuthorityKeyId = a.Id
 				continue
@@ -1071,7 +1182,10 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 				var keyUsage []asn1.ObjectIdentifier
 				_, err = asn1.Unmarshal(e.Value, &keyUsage)
 				if err != nil {
-					return nil, err
+					// START CT CHANGES
+					malformed(err)
+					continue extensions
+					// END CT CHANGES
 				}
 
 				for _, u := range keyUsage {
@@ -1089,27 +1203,37 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 				var keyid []byte
 				_, err = asn1.Unmarshal(e.Value, &keyid)
 				if err != nil {
-					return nil, err
+					// START CT CHANGES
+					malformed(err)
+					continue extensions
+					// END CT CHANGES
 				}
 				out.SubjectKeyId = keyid
 				continue
 
 			case 32:
 				// RFC 5280 4.2.1.4: Certificate Policies
-				var policies []policyInformation
-				if _, err = asn1.Unmarshal(e.Value, &policies); err != nil {
-					return nil, err
+				// START CT CHANGES
+				var policies []PolicyInformation
+				if policies, err = parsePolicies(e.Value, &nfe); err != nil {
+					malformed(err)
+					continue extensions
 				}
+				out.Policies = policies
 				out.PolicyIdentifiers = make([]asn1.ObjectIdentifier, len(policies))
 				for i, policy := range policies {
-					out.PolicyIdentifiers[i] = policy.Policy
+					out.PolicyIdentifiers[i] = policy.ID
 				}
+				// END CT CHANGES
 			}
 		} else if e.Id.Equal(oidExtensionAuthorityInfoAccess) {
 			// RFC 5280 4.2.2.1: Authority Information Access
 			var aia []authorityInfoAccess
 			if _, err = asn1.Unmarshal(e.Value, &aia); err != nil {
-				return nil, err
+				// START CT CHANGES
+				malformed(err)
+				continue extensions
+				// END CT CHANGES
 			}
 
 			for _, v := range aia {
@@ -1123,7 +1247,22 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 					out.IssuingCertificateURL = append(out.IssuingCertificateURL, string(v.Location.Bytes))
 				}
 			}
+			// START CT CHANGES
+		} else if e.Id.Equal(OIDExtensionCTPoison) {
+			// RFC 6962 3.1: precertificates' poison is understood, so
+			// doesn't count as an unhandled critical extension.
+			if err := checkPoison(e.Value); err != nil {
+				malformed(err)
+			}
+			continue
+		} else if e.Id.Equal(OIDExtensionCTSCTList) {
+			// RFC 6962 3.3: embedded SCTs
+			if _, err := ParseSCTListExtension(e.Value); err != nil {
+				malformed(err)
+				continue
+			}
 		}
+		// END CT CHANGES
 
 		if e.Critical {
 			// START CT CHANGES
@@ -1160,6 +1299,12 @@ func ParseTBSCertificate(asn1Data []byte) (*Certificate, error) {
 // END CT CHANGES
 
 // ParseCertificate parses a single certificate from the given ASN.1 DER data.
+// START CT CHANGES
+// If the certificate is only slightly malformed, it is returned along with a
+// NonFatalErrors listing what is wrong with it, e.g. as NegativeSerialNumber,
+// InvalidString, InvalidTime, MalformedExtension or UnhandledCriticalExtension
+// errors.
+// END CT CHANGES
 func ParseCertificate(asn1Data []byte) (*Certificate, error) {
 	var cert certificate
 	rest, err := asn1.Unmarshal(asn1Data, &cert)
@@ -1175,6 +1320,10 @@ func ParseCertificate(asn1Data []byte) (*Certificate, error) {
 
 // ParseCertificates parses one or more certificates from the given ASN.1 DER
 // data. The certificates must be concatenated with no intermediate padding.
+// START CT CHANGES
+// If any of the certificates parse with non-fatal errors, they are all
+// returned along with a NonFatalErrors holding all their errors.
+// END CT CHANGES
 func ParseCertificates(asn1Data []byte) ([]*Certificate, error) {
 	var v []*certificate
 
@@ -1189,13 +1338,22 @@ func ParseCertificates(asn1Data []byte) ([]*Certificate, error) {
 	}
 
 	ret := make([]*Certificate, len(v))
+	// START CT CHANGES
+	var nfe NonFatalErrors
 	for i, ci := range v {
 		cert, err := parseCertificate(ci)
-		if err != nil {
+		if IsFatal(err) {
 			return nil, err
 		}
+		if err != nil {
+			nfe.Errors = append(nfe.Errors, err.(NonFatalErrors).Errors...)
+		}
 		ret[i] = cert
 	}
+	if nfe.HasError() {
+		return ret, nfe
+	}
+	// END CT CHANGES
 
 	return ret, nil
 }
@@ -1334,7 +1492,13 @@ func buildExtensions(template *Certificate) (ret []pkix.Extension, err error) {
 		n++
 	}
 
-	if (len(template.DNSNames) > 0 || len(template.EmailAddresses) > 0 || len(template.IPAddresses) > 0) &&
+	// START CT CHANGES
+	otherSANs, err := marshalOtherSANs(template)
+	if err != nil {
+		return
+	}
+	if (len(template.DNSNames) > 0 || len(template.EmailAddresses) > 0 || len(template.IPAddresses) > 0 || len(template.URIs) > 0 || len(otherSANs) > 0) &&
+		// END CT CHANGES
 		!oidInExtensions(oidExtensionSubjectAltName, template.ExtraExtensions) {
 		ret[n].Id = oidExtensionSubjectAltName
 		var rawValues []asn1.RawValue
@@ -1352,6 +1516,12 @@ func buildExtensions(template *Certificate) (ret []pkix.Extension, err error) {
 			}
 			rawValues = append(rawValues, asn1.RawValue{Tag: 7, Class: 2, Bytes: ip})
 		}
+		// START CT CHANGES
+		for _, uri := range template.URIs {
+			rawValues = append(rawValues, asn1.RawValue{Tag: 6, Class: 2, Bytes: []byte(uri)})
+		}
+		rawValues = append(rawValues, otherSANs...)
+		// END CT CHANGES
 		ret[n].Value, err = asn1.Marshal(rawValues)
 		if err != nil {
 			return
@@ -1359,36 +1529,38 @@ func buildExtensions(template *Certificate) (ret []pkix.Extension, err error) {
 		n++
 	}
 
-	if len(template.PolicyIdentifiers) > 0 &&
+	// START CT CHANGES
+	if (len(template.Policies) > 0 || len(template.PolicyIdentifiers) > 0) &&
 		!oidInExtensions(oidExtensionCertificatePolicies, template.ExtraExtensions) {
 		ret[n].Id = oidExtensionCertificatePolicies
-		policies := make([]policyInformation, len(template.PolicyIdentifiers))
-		for i, policy := range template.PolicyIdentifiers {
-			policies[i].Policy = policy
+		policies := template.Policies
+		if len(policies) == 0 {
+			policies = make([]PolicyInformation, len(template.PolicyIdentifiers))
+			for i, policy := range template.PolicyIdentifiers {
+				policies[i].ID = policy
+			}
 		}
-		ret[n].Value, err = asn1.Marshal(policies)
+		ret[n].Value, err = marshalPolicies(policies)
+		// END CT CHANGES
 		if err != nil {
 			return
 		}
 		n++
 	}
 
-	if len(template.PermittedDNSDomains) > 0 &&
+	// START CT CHANGES
+	if hasNameConstraints(template) &&
 		!oidInExtensions(oidExtensionNameConstraints, template.ExtraExtensions) {
 		ret[n].Id = oidExtensionNameConstraints
 		ret[n].Critical = template.PermittedDNSDomainsCritical
 
-		var out nameConstraints
-		out.Permitted = make([]generalSubtree, len(template.PermittedDNSDomains))
-		for i, permitted := range template.PermittedDNSDomains {
-			out.Permitted[i] = generalSubtree{Name: permitted}
-		}
-		ret[n].Value, err = asn1.Marshal(out)
+		ret[n].Value, err = marshalNameConstraints(template)
 		if err != nil {
 			return
 		}
 		n++
 	}
+	// END CT CHANGES
 
 	if len(template.CRLDistributionPoints) > 0 &&
 		!oidInExtensions(oidExtensionCRLDistributionPoints, template.ExtraExtensions) {
@@ -1432,6 +1604,10 @@ func subjectBytes(cert *Certificate) ([]byte, error) {
 // NotAfter, KeyUsage, ExtKeyUsage, UnknownExtKeyUsage, BasicConstraintsValid,
 // IsCA, MaxPathLen, SubjectKeyId, DNSNames, PermittedDNSDomainsCritical,
 // PermittedDNSDomains.
+// START CT CHANGES
+// The other name constraints (ExcludedDNSDomains and so on), and URIs,
+// OtherNames, DirectoryNames and RegisteredIDs, are used too.
+// END CT CHANGES
 //
 // The certificate is signed by parent. If parent is equal to template then the
 // certificate is self-signed. The parameter pub is the public key of the
@@ -1497,13 +1673,24 @@ func CreateCertificate(rand io.Reader, template, parent *Certificate, pub interf
 		return
 	}
 
+	// START CT CHANGES
+	notBefore, err := asn1.Marshal(template.NotBefore.UTC())
+	if err != nil {
+		return
+	}
+	notAfter, err := asn1.Marshal(template.NotAfter.UTC())
+	if err != nil {
+		return
+	}
+	// END CT CHANGES
+
 	encodedPublicKey := asn1.BitString{BitLength: len(publicKeyBytes) * 8, Bytes: publicKeyBytes}
 	c := tbsCertificate{
 		Version:            2,
 		SerialNumber:       template.SerialNumber,
 		SignatureAlgorithm: signatureAlgorithm,
 		Issuer:             asn1.RawValue{FullBytes: asn1Issuer},
-		Validity:           validity{template.NotBefore.UTC(), template.NotAfter.UTC()},
+		Validity:           validity{asn1.RawValue{FullBytes: notBefore}, asn1.RawValue{FullBytes: notAfter}},
 		Subject:            asn1.RawValue{FullBytes: asn1Subject},
 		PublicKey:          publicKeyInfo{nil, publicKeyAlgorithm, encodedPublicKey},
 		Extensions:         extensions,
@@ -744,6 +744,203 @@ func TestNonFatalErrors(t *testing.T) {
 	}
 }
 
+// createJunkCertificate returns a self-signed certificate with the serial
+// number, common name, DNS name and extra extensions given.
+func createJunkCertificate(t *testing.T, serial int64, cn, dnsName string, exts []pkix.Extension) []byte {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := Certificate{
+		SerialNumber:    big.NewInt(serial),
+		Subject:         pkix.Name{CommonName: cn},
+		NotBefore:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:        time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		DNSNames:        []string{dnsName},
+		ExtraExtensions: exts,
+	}
+	der, err := CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestParseCertificateNonFatalErrors(t *testing.T) {
+	oidUnknown := asn1.ObjectIdentifier{1, 2, 3, 4}
+	for i, tc := range []struct {
+		serial      int64
+		cn, dnsName string
+		exts        []pkix.Extension
+		// Bytes of the certificate to replace, as CreateCertificate
+		// won't create invalid strings.
+		old, new string
+		want     []error
+	}{
+		{serial: 1, cn: "www.example.com", dnsName: "www.example.com"},
+		{
+			serial: -1, cn: "www.example.com", dnsName: "www.example.com",
+			want: []error{NegativeSerialNumber{big.NewInt(-1)}},
+		},
+		{
+			// A UTF8String.
+			serial: 1, cn: "caf\u00e9", dnsName: "www.example.com",
+			old: "caf\xc3\xa9", new: "caf\xc3\x28",
+			want: []error{
+				InvalidString{Field: "issuer", Tag: tagUTF8String, Bytes: []byte("caf\xc3\x28")},
+				InvalidString{Field: "subject", Tag: tagUTF8String, Bytes: []byte("caf\xc3\x28")},
+			},
+		},
+		{
+			// A PrintableString, which the asn1 package decodes as
+			// ISO 8859-1.
+			serial: 1, cn: "cafe", dnsName: "www.example.com",
+			old: "cafe", new: "caf\xe9",
+			want: []error{
+				InvalidString{Field: "issuer", Tag: tagPrintableString, Bytes: []byte("caf\xe9")},
+				InvalidString{Field: "subject", Tag: tagPrintableString, Bytes: []byte("caf\xe9")},
+			},
+		},
+		{
+			serial: 1, cn: "www.example.com", dnsName: "www.exXmple.com",
+			old: "www.exXmple.com", new: "www.ex\xe4mple.com",
+			want: []error{InvalidString{Field: "dNSName", Tag: tagIA5String, Bytes: []byte("www.ex\xe4mple.com")}},
+		},
+		{
+			// A GeneralizedTime without seconds.
+			serial: 1, cn: "www.example.com", dnsName: "www.example.com",
+			old: "\x17\x0d400101000000Z", new: "\x18\x0d204001010000Z",
+			want: []error{InvalidTime{Field: "notAfter", Tag: tagGeneralizedTime, Bytes: []byte("204001010000Z")}},
+		},
+		{
+			serial: 1, cn: "www.example.com", dnsName: "www.example.com",
+			exts: []pkix.Extension{{Id: oidUnknown, Critical: true, Value: []byte{5, 0}}},
+			want: []error{UnhandledCriticalExtension{oidUnknown}},
+		},
+		{
+			serial: 1, cn: "www.example.com", dnsName: "www.example.com",
+			exts: []pkix.Extension{{Id: oidExtensionAuthorityKeyId, Value: []byte{1, 2, 3}}},
+			want: []error{MalformedExtension{ID: oidExtensionAuthorityKeyId}},
+		},
+		{
+			serial: 1, cn: "www.example.com", dnsName: "www.example.com",
+			exts: []pkix.Extension{{Id: oidExtensionKeyUsage, Critical: true, Value: []byte{1, 2, 3}}},
+			want: []error{MalformedExtension{ID: oidExtensionKeyUsage}, UnhandledCriticalExtension{oidExtensionKeyUsage}},
+		},
+	} {
+		der := createJunkCertificate(t, tc.serial, tc.cn, tc.dnsName, tc.exts)
+		if tc.old != "" {
+			der = bytes.Replace(der, []byte(tc.old), []byte(tc.new), -1)
+		}
+		cert, err := ParseCertificate(der)
+		if IsFatal(err) {
+			t.Errorf("#%d: ParseCertificate()=%v, want at most non-fatal errors", i, err)
+			continue
+		}
+		if cert == nil {
+			t.Errorf("#%d: ParseCertificate() returned no certificate", i)
+			continue
+		}
+		var got []error
+		if err != nil {
+			got = err.(NonFatalErrors).Errors
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("#%d: ParseCertificate() errors=%v, want %v", i, got, tc.want)
+			continue
+		}
+		for j, e := range got {
+			// The errors the extensions' values caused are implementation
+			// details.
+			if m, ok := e.(MalformedExtension); ok {
+				if m.Err == nil {
+					t.Errorf("#%d: MalformedExtension %d has no Err", i, j)
+				}
+				m.Err = nil
+				e = m
+			}
+			if !reflect.DeepEqual(e, tc.want[j]) {
+				t.Errorf("#%d: ParseCertificate() error %d=%#v, want %#v", i, j, e, tc.want[j])
+			}
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	for _, tc := range []struct {
+		tag     int
+		in      string
+		want    time.Time
+		invalid bool
+	}{
+		{tag: tagUTCTime, in: "150102030405Z", want: time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{tag: tagUTCTime, in: "500102030405Z", want: time.Date(1950, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{tag: tagGeneralizedTime, in: "20500102030405Z", want: time.Date(2050, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{tag: tagGeneralizedTime, in: "99991231235959Z", want: time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)},
+		{tag: tagUTCTime, in: "1501020304Z", want: time.Date(2015, 1, 2, 3, 4, 0, 0, time.UTC), invalid: true},
+		{tag: tagUTCTime, in: "150102030405+0100", want: time.Date(2015, 1, 2, 2, 4, 5, 0, time.UTC), invalid: true},
+		{tag: tagUTCTime, in: "1501020304-0130", want: time.Date(2015, 1, 2, 4, 34, 0, 0, time.UTC), invalid: true},
+		{tag: tagUTCTime, in: "99991231235959Z", want: time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC), invalid: true},
+		{tag: tagGeneralizedTime, in: "201501020304Z", want: time.Date(2015, 1, 2, 3, 4, 0, 0, time.UTC), invalid: true},
+		{tag: tagGeneralizedTime, in: "20150102030405.5Z", want: time.Date(2015, 1, 2, 3, 4, 5, 5e8, time.UTC), invalid: true},
+	} {
+		var nfe NonFatalErrors
+		got, err := parseTime("notAfter", asn1.RawValue{Tag: tc.tag, Bytes: []byte(tc.in)}, &nfe)
+		if err != nil {
+			t.Errorf("parseTime(%s %q)=_,%v", asn1TagName(tc.tag), tc.in, err)
+			continue
+		}
+		if !got.Equal(tc.want) || got.Location() != time.UTC {
+			t.Errorf("parseTime(%s %q)=%v, want %v", asn1TagName(tc.tag), tc.in, got, tc.want)
+		}
+		want := InvalidTime{Field: "notAfter", Tag: tc.tag, Bytes: []byte(tc.in)}
+		if tc.invalid && (len(nfe.Errors) != 1 || !reflect.DeepEqual(nfe.Errors[0], want)) {
+			t.Errorf("parseTime(%s %q) gave errors %v, want %v", asn1TagName(tc.tag), tc.in, nfe.Errors, want)
+		} else if !tc.invalid && nfe.HasError() {
+			t.Errorf("parseTime(%s %q) gave errors %v, want none", asn1TagName(tc.tag), tc.in, nfe.Errors)
+		}
+	}
+
+	for _, v := range []asn1.RawValue{
+		{Tag: tagUTCTime, Bytes: []byte("not a time")},
+		{Tag: tagGeneralizedTime, Bytes: []byte("2015")},
+		{Tag: tagUTF8String, Bytes: []byte("150102030405Z")},
+	} {
+		var nfe NonFatalErrors
+		if _, err := parseTime("notBefore", v, &nfe); err == nil {
+			t.Errorf("parseTime(%s %q)=_,nil, want error", asn1TagName(v.Tag), v.Bytes)
+		}
+	}
+}
+
+func TestIsFatal(t *testing.T) {
+	for i, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{NonFatalErrors{[]error{NegativeSerialNumber{}}}, false},
+		{errors.New("x509: bad"), true},
+	} {
+		if got := IsFatal(tc.err); got != tc.want {
+			t.Errorf("#%d: IsFatal(%v)=%t, want %t", i, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestParseCertificatesCollectsNonFatalErrors(t *testing.T) {
+	good := createJunkCertificate(t, 1, "www.example.com", "www.example.com", nil)
+	bad := createJunkCertificate(t, -1, "www.example.com", "www.example.com", nil)
+	certs, err := ParseCertificates(append(append([]byte(nil), good...), bad...))
+	if len(certs) != 2 {
+		t.Fatalf("ParseCertificates() returned %d certificates, want 2", len(certs))
+	}
+	nfe, ok := err.(NonFatalErrors)
+	if !ok || len(nfe.Errors) != 1 {
+		t.Errorf("ParseCertificates()=%v, want one non-fatal error", err)
+	}
+}
+
 // END CT CHANGES
 
 const derCRLBase64 = "MIINqzCCDJMCAQEwDQYJKoZIhvcNAQEFBQAwVjEZMBcGA1UEAxMQUEtJIEZJTk1FQ0NBTklDQTEVMBMGA1UEChMMRklOTUVDQ0FOSUNBMRUwEwYDVQQLEwxGSU5NRUNDQU5JQ0ExCzAJBgNVBAYTAklUFw0xMTA1MDQxNjU3NDJaFw0xMTA1MDQyMDU3NDJaMIIMBzAhAg4Ze1od49Lt1qIXBydAzhcNMDkwNzE2MDg0MzIyWjAAMCECDl0HSL9bcZ1Ci/UHJ0DPFw0wOTA3MTYwODQzMTNaMAAwIQIOESB9tVAmX3cY7QcnQNAXDTA5MDcxNjA4NDUyMlowADAhAg4S1tGAQ3mHt8uVBydA1RcNMDkwODA0MTUyNTIyWjAAMCECDlQ249Y7vtC25ScHJ0DWFw0wOTA4MDQxNTI1MzdaMAAwIQIOISMop3NkA4PfYwcnQNkXDTA5MDgwNDExMDAzNFowADAhAg56/BMoS29KEShTBydA2hcNMDkwODA0MTEwMTAzWjAAMCECDnBp/22HPH5CSWoHJ0DbFw0wOTA4MDQxMDU0NDlaMAAwIQIOV9IP+8CD8bK+XAcnQNwXDTA5MDgwNDEwNTcxN1owADAhAg4v5aRz0IxWqYiXBydA3RcNMDkwODA0MTA1NzQ1WjAAMCECDlOU34VzvZAybQwHJ0DeFw0wOTA4MDQxMDU4MjFaMAAwIAINO4CD9lluIxcwBydBAxcNMDkwNzIyMTUzMTU5WjAAMCECDgOllfO8Y1QA7/wHJ0ExFw0wOTA3MjQxMTQxNDNaMAAwIQIOJBX7jbiCdRdyjgcnQUQXDTA5MDkxNjA5MzAwOFowADAhAg5iYSAgmDrlH/RZBydBRRcNMDkwOTE2MDkzMDE3WjAAMCECDmu6k6srP3jcMaQHJ0FRFw0wOTA4MDQxMDU2NDBaMAAwIQIOX8aHlO0V+WVH4QcnQVMXDTA5MDgwNDEwNTcyOVowADAhAg5flK2rg3NnsRgDBydBzhcNMTEwMjAxMTUzMzQ2WjAAMCECDg35yJDL1jOPTgoHJ0HPFw0xMTAyMDExNTM0MjZaMAAwIQIOMyFJ6+e9iiGVBQcnQdAXDTA5MDkxODEzMjAwNVowADAhAg5Emb/Oykucmn8fBydB1xcNMDkwOTIxMTAxMDQ3WjAAMCECDjQKCncV+MnUavMHJ0HaFw0wOTA5MjIwODE1MjZaMAAwIQIOaxiFUt3dpd+tPwcnQfQXDTEwMDYxODA4NDI1MVowADAhAg5G7P8nO0tkrMt7BydB9RcNMTAwNjE4MDg0MjMwWjAAMCECDmTCC3SXhmDRst4HJ0H2Fw0wOTA5MjgxMjA3MjBaMAAwIQIOHoGhUr/pRwzTKgcnQfcXDTA5MDkyODEyMDcyNFowADAhAg50wrcrCiw8mQmPBydCBBcNMTAwMjE2MTMwMTA2WjAAMCECDifWmkvwyhEqwEcHJ0IFFw0xMDAyMTYxMzAxMjBaMAAwIQIOfgPmlW9fg+osNgcnQhwXDTEwMDQxMzA5NTIwMFowADAhAg4YHAGuA6LgCk7tBydCHRcNMTAwNDEzMDk1MTM4WjAAMCECDi1zH1bxkNJhokAHJ0IsFw0xMDA0MTMwOTU5MzBaMAAwIQIOMipNccsb/wo2fwcnQi0XDTEwMDQxMzA5NTkwMFowADAhAg46lCmvPl4GpP6ABydCShcNMTAwMTE5MDk1MjE3WjAAMCECDjaTcaj+wBpcGAsHJ0JLFw0xMDAxMTkwOTUyMzRaMAAwIQIOOMC13EOrBuxIOQcnQloXDTEwMDIwMTA5NDcwNVowADAhAg5KmZl+krz4RsmrBydCWxcNMTAwMjAxMDk0NjQwWjAAMCECDmLG3zQJ/fzdSsUHJ0JiFw0xMDAzMDEwOTUxNDBaMAAwIQIOP39ksgHdojf4owcnQmMXDTEwMDMwMTA5NTExN1owADAhAg4LDQzvWNRlD6v9BydCZBcNMTAwMzAxMDk0NjIyWjAAMCECDkmNfeclaFhIaaUHJ0JlFw0xMDAzMDEwOTQ2MDVaMAAwIQIOT/qWWfpH/m8NTwcnQpQXDTEwMDUxMTA5MTgyMVowADAhAg5m/ksYxvCEgJSvBydClRcNMTAwNTExMDkxODAxWjAAMCECDgvf3Ohq6JOPU9AHJ0KWFw0xMDA1MTEwOTIxMjNaMAAwIQIOKSPas10z4jNVIQcnQpcXDTEwMDUxMTA5MjEwMlowADAhAg4mCWmhoZ3lyKCDBydCohcNMTEwNDI4MTEwMjI1WjAAMCECDkeiyRsBMK0Gvr4HJ0KjFw0xMTA0MjgxMTAyMDdaMAAwIQIOa09b/nH2+55SSwcnQq4XDTExMDQwMTA4Mjk0NlowADAhAg5O7M7iq7gGplr1BydCrxcNMTEwNDAxMDgzMDE3WjAAMCECDjlT6mJxUjTvyogHJ0K1Fw0xMTAxMjcxNTQ4NTJaMAAwIQIODS/l4UUFLe21NAcnQrYXDTExMDEyNzE1NDgyOFowADAhAg5lPRA0XdOUF6lSBydDHhcNMTEwMTI4MTQzNTA1WjAAMCECDixKX4fFGGpENwgHJ0MfFw0xMTAxMjgxNDM1MzBaMAAwIQIORNBkqsPnpKTtbAcnQ08XDTEwMDkwOTA4NDg0MlowADAhAg5QL+EMM3lohedEBydDUBcNMTAwOTA5MDg0ODE5WjAAMCECDlhDnHK+HiTRAXcHJ0NUFw0xMDEwMTkxNjIxNDBaMAAwIQIOdBFqAzq/INz53gcnQ1UXDTEwMTAxOTE2MjA0NFowADAhAg4OjR7s8MgKles1BydDWhcNMTEwMTI3MTY1MzM2WjAAMCECDmfR/elHee+d0SoHJ0NbFw0xMTAxMjcxNjUzNTZaMAAwIQIOBTKv2ui+KFMI+wcnQ5YXDTEwMDkxNTEwMjE1N1owADAhAg49F3c/GSah+oRUBydDmxcNMTEwMTI3MTczMjMzWjAAMCECDggv4I61WwpKFMMHJ0OcFw0xMTAxMjcxNzMyNTVaMAAwIQIOXx/Y8sEvwS10LAcnQ6UXDTExMDEyODExMjkzN1owADAhAg5LSLbnVrSKaw/9BydDphcNMTEwMTI4MTEyOTIwWjAAMCECDmFFoCuhKUeACQQHJ0PfFw0xMTAxMTExMDE3MzdaMAAwIQIOQTDdFh2fSPF6AAcnQ+AXDTExMDExMTEwMTcxMFowADAhAg5B8AOXX61FpvbbBydD5RcNMTAxMDA2MTAxNDM2WjAAMCECDh41P2Gmi7PkwI4HJ0PmFw0xMDEwMDYxMDE2MjVaMAAwIQIOWUHGLQCd+Ale9gcnQ/0XDTExMDUwMjA3NTYxMFowADAhAg5Z2c9AYkikmgWOBydD/hcNMTEwNTAyMDc1NjM0WjAAMCECDmf/UD+/h8nf+74HJ0QVFw0xMTA0MTUwNzI4MzNaMAAwIQIOICvj4epy3MrqfwcnRBYXDTExMDQxNTA3Mjg1NlowADAhAg4bouRMfOYqgv4xBydEHxcNMTEwMzA4MTYyNDI1WjAAMCECDhebWHGoKiTp7pEHJ0QgFw0xMTAzMDgxNjI0NDhaMAAwIQIOX+qnxxAqJ8LtawcnRDcXDTExMDEzMTE1MTIyOFowADAhAg4j0fICqZ+wkOdqBydEOBcNMTEwMTMxMTUxMTQxWjAAMCECDhmXjsV4SUpWtAMHJ0RLFw0xMTAxMjgxMTI0MTJaMAAwIQIODno/w+zG43kkTwcnREwXDTExMDEyODExMjM1MlowADAhAg4b1gc88767Fr+LBydETxcNMTEwMTI4MTEwMjA4WjAAMCECDn+M3Pa1w2nyFeUHJ0RQFw0xMTAxMjgxMDU4NDVaMAAwIQIOaduoyIH61tqybAcnRJUXDTEwMTIxNTA5NDMyMlowADAhAg4nLqQPkyi3ESAKBydElhcNMTAxMjE1MDk0MzM2WjAAMCECDi504NIMH8578gQHJ0SbFw0xMTAyMTQxNDA1NDFaMAAwIQIOGuaM8PDaC5u1egcnRJwXDTExMDIxNDE0MDYwNFowADAhAg4ehYq/BXGnB5PWBydEnxcNMTEwMjA0MDgwOTUxWjAAMCECDkSD4eS4FxW5H20HJ0SgFw0xMTAyMDQwODA5MjVaMAAwIQIOOCcb6ilYObt1egcnRKEXDTExMDEyNjEwNDEyOVowADAhAg58tISWCCwFnKGnBydEohcNMTEwMjA0MDgxMzQyWjAAMCECDn5rjtabY/L/WL0HJ0TJFw0xMTAyMDQxMTAzNDFaMAAwDQYJKoZIhvcNAQEFBQADggEBAGnF2Gs0+LNiYCW1Ipm83OXQYP/bd5tFFRzyz3iepFqNfYs4D68/QihjFoRHQoXEB0OEe1tvaVnnPGnEOpi6krwekquMxo4H88B5SlyiFIqemCOIss0SxlCFs69LmfRYvPPvPEhoXtQ3ZThe0UvKG83GOklhvGl6OaiRf4Mt+m8zOT4Wox/j6aOBK6cw6qKCdmD+Yj1rrNqFGg1CnSWMoD6S6mwNgkzwdBUJZ22BwrzAAo4RHa2Uy3ef1FjwD0XtU5N3uDSxGGBEDvOe5z82rps3E22FpAA8eYl8kaXtmWqyvYU0epp4brGuTxCuBMCAsxt/OjIjeNNQbBGkwxgfYA0="